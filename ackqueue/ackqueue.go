@@ -0,0 +1,295 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package ackqueue implements an unbounded, thread-safe FIFO queue with acknowledgement-based
+// consumption, providing at-least-once delivery for in-process work distribution.
+// Internally, Pop moves the popped value to an in-flight set, identified by a receipt, instead
+// of discarding it; the value is only discarded once acknowledged with Ack. Nack, or the
+// expiration of the optional visibility timeout, returns the value to the head of the queue,
+// so it is delivered again before any other value.
+// The ready values are stored in a queueimpl3 queue, preceded by a stack of the returned
+// values. In-flight values expire in the same order they were popped, so the expired ones
+// are found by checking the oldest in-flight values on Pop, without scanning the set.
+// DrainAndClose stops accepting values and waits until all the values were delivered and
+// acknowledged, for a graceful shutdown.
+package ackqueue
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/christianrpetrin/queue-tests/queueerr"
+	"github.com/christianrpetrin/queue-tests/queueimpl3"
+)
+
+// Options configures a queue.
+// The zero value for Options holds the default configuration.
+type Options struct {
+	// VisibilityTimeout is how long a popped value stays in flight before it is returned to
+	// the head of the queue, unless acknowledged.
+	// A VisibilityTimeout of 0 or less keeps the values in flight until acknowledged.
+	VisibilityTimeout time.Duration
+
+	// Now returns the current time.
+	// A nil Now uses time.Now.
+	Now func() time.Time
+}
+
+// Receipt identifies a delivery of a value, i.e. a successful Pop.
+// Each delivery of the same value has a different receipt.
+type Receipt uint64
+
+// AckQueue represents an unbounded FIFO queue whose popped values must be acknowledged.
+// AckQueue is safe for concurrent use by multiple goroutines.
+// The zero value for queue is not ready to use; use New to create a queue.
+type AckQueue struct {
+	// opts holds the queue configuration.
+	opts Options
+
+	// mu guards all other fields.
+	mu sync.Mutex
+
+	// q holds the values ready to be delivered.
+	q queueimpl3.Queueimpl3
+
+	// returned holds the values returned to the head of the queue, delivered before q values.
+	// The next value to be delivered is the last one.
+	returned []interface{}
+
+	// inFlight holds the values in flight, by receipt.
+	inFlight map[Receipt]delivery
+
+	// order holds the receipts of the values in flight, in the order they were popped,
+	// including the already acknowledged ones that were not discarded yet.
+	// It is only used if the visibility timeout is enabled.
+	order queueimpl3.Queueimpl3
+
+	// next holds the next receipt.
+	next Receipt
+
+	// closed holds whether the queue was closed by DrainAndClose.
+	closed bool
+
+	// drained is closed once the queue is closed and all its values were acknowledged.
+	drained chan struct{}
+}
+
+// delivery represents a value in flight.
+type delivery struct {
+	// v holds the user added value.
+	v interface{}
+
+	// deadline holds the time the value is returned to the queue if not acknowledged.
+	deadline time.Time
+}
+
+// New returns an initialized queue configured by opts.
+func New(opts Options) *AckQueue {
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+	q := &AckQueue{
+		opts:     opts,
+		inFlight: make(map[Receipt]delivery),
+		next:     1,
+		drained:  make(chan struct{}),
+	}
+	q.q.Init()
+	q.order.Init()
+	return q
+}
+
+// Len returns the number of values ready to be delivered, not counting the values in flight.
+// The complexity is O(1).
+func (q *AckQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.q.Len() + len(q.returned)
+}
+
+// InFlight returns the number of values delivered but not acknowledged yet, including the
+// ones whose visibility timeout expired but were not returned to the queue yet.
+// The complexity is O(1).
+func (q *AckQueue) InFlight() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.inFlight)
+}
+
+// Push adds a value to the queue.
+// Push panics if the queue was closed by DrainAndClose; use PushE to get an error instead.
+// The complexity is O(1).
+func (q *AckQueue) Push(v interface{}) {
+	if err := q.PushE(v); err != nil {
+		panic("ackqueue: push to a closed queue")
+	}
+}
+
+// PushE adds a value to the queue.
+// It is the same as Push, but returns queueerr.ErrClosed if the queue was closed by
+// DrainAndClose, so producers racing with the shutdown can stop gracefully.
+// The complexity is O(1).
+func (q *AckQueue) PushE(v interface{}) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return queueerr.ErrClosed
+	}
+	q.q.Push(v)
+	return nil
+}
+
+// DrainAndClose closes the queue, so values cannot be pushed anymore, and waits until all
+// the values were delivered and acknowledged, or ctx is done. Nacked and expired values are
+// delivered again as usual while waiting.
+// It returns the number of values abandoned, i.e. ready or in flight when ctx is done, and
+// ctx.Err() if any value was abandoned. The abandoned values can still be popped and acknowledged.
+// DrainAndClose may be called multiple times.
+func (q *AckQueue) DrainAndClose(ctx context.Context) (int, error) {
+	q.mu.Lock()
+	q.closed = true
+	q.checkDrained()
+	q.mu.Unlock()
+
+	select {
+	case <-q.drained:
+		return 0, nil
+	case <-ctx.Done():
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		if n := q.q.Len() + len(q.returned) + len(q.inFlight); n > 0 {
+			return n, ctx.Err()
+		}
+		return 0, nil
+	}
+}
+
+// Pop retrieves the next element from the queue, moving it to the in-flight set until it is
+// acknowledged using the returned receipt.
+// The in-flight values whose visibility timeout expired are returned to the head of the
+// queue first, so they are delivered again before any other value.
+// The third, bool result indicates whether a valid value was returned;
+//   if the queue is empty, false will be returned.
+// The complexity is O(1), not counting the cost of returning the expired values.
+func (q *AckQueue) Pop() (interface{}, Receipt, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := q.opts.Now()
+	q.expire(now)
+
+	var v interface{}
+	if n := len(q.returned); n > 0 {
+		v = q.returned[n-1]
+		q.returned[n-1] = nil // Avoid memory leaks
+		q.returned = q.returned[:n-1]
+	} else if pv, ok := q.q.Pop(); ok {
+		v = pv
+	} else {
+		return nil, 0, false
+	}
+
+	r := q.next
+	q.next++
+	d := delivery{v: v}
+	if q.opts.VisibilityTimeout > 0 {
+		d.deadline = now.Add(q.opts.VisibilityTimeout)
+		q.order.Push(r)
+	}
+	q.inFlight[r] = d
+	return v, r, true
+}
+
+// Ack acknowledges the delivery identified by receipt r, discarding its value.
+// It returns false if r is not in flight, e.g. because it was already acknowledged, or because
+// its visibility timeout expired and the value was returned to the queue.
+// The complexity is O(1).
+func (q *AckQueue) Ack(r Receipt) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if _, ok := q.inFlight[r]; !ok {
+		return false
+	}
+	delete(q.inFlight, r)
+	q.checkDrained()
+	return true
+}
+
+// Nack returns the value of the delivery identified by receipt r to the head of the
+// queue, so it is delivered again before any other value.
+// It returns false if r is not in flight, e.g. because it was already acknowledged, or because
+// its visibility timeout expired and the value was returned to the queue.
+// The complexity is O(1).
+func (q *AckQueue) Nack(r Receipt) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	d, ok := q.inFlight[r]
+	if !ok {
+		return false
+	}
+	delete(q.inFlight, r)
+	q.returned = append(q.returned, d.v)
+	return true
+}
+
+// expire returns the in-flight values whose visibility timeout expired at now to the head
+// of the queue, in the order they were popped.
+// Queue q must be locked.
+func (q *AckQueue) expire(now time.Time) {
+	var expired []interface{}
+	for {
+		front, ok := q.order.Front()
+		if !ok {
+			break
+		}
+		r := front.(Receipt)
+		d, ok := q.inFlight[r]
+		if ok && d.deadline.After(now) {
+			break
+		}
+
+		q.order.Pop()
+		if ok {
+			delete(q.inFlight, r)
+			expired = append(expired, d.v)
+		}
+	}
+
+	// The next value to be delivered is the last one, so the first popped goes last.
+	for i := len(expired) - 1; i >= 0; i-- {
+		q.returned = append(q.returned, expired[i])
+	}
+}
+
+// checkDrained closes drained if the queue is closed and all its values were acknowledged.
+// Queue q must be locked.
+func (q *AckQueue) checkDrained() {
+	if !q.closed || q.q.Len() > 0 || len(q.returned) > 0 || len(q.inFlight) > 0 {
+		return
+	}
+	select {
+	case <-q.drained:
+	default:
+		close(q.drained)
+	}
+}
@@ -0,0 +1,298 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ackqueue
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/christianrpetrin/queue-tests/queueerr"
+)
+
+const (
+	// concurrentCount holds the number of values pushed by each goroutine in the concurrent tests.
+	concurrentCount = 10000
+
+	// goroutines holds the number of producer and consumer goroutines in the concurrent tests.
+	goroutines = 4
+)
+
+// fakeClock is a manually advanced clock.
+type fakeClock struct {
+	// t holds the current time.
+	t time.Time
+}
+
+func (c *fakeClock) now() time.Time { return c.t }
+
+func (c *fakeClock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func TestAckQueuePopAckShouldRetrieveAllElementsInOrder(t *testing.T) {
+	q := New(Options{})
+	for i := 0; i < 10; i++ {
+		q.Push(i)
+	}
+
+	for i := 0; i < 10; i++ {
+		v, r, ok := q.Pop()
+		if !ok || v != i {
+			t.Errorf("Expected: %d; Got: %v", i, v)
+		}
+		if q.InFlight() != 1 {
+			t.Errorf("Expected: %d values in flight; Got: %d", 1, q.InFlight())
+		}
+		if !q.Ack(r) {
+			t.Errorf("Expected: receipt %d acknowledged; Got: not in flight", r)
+		}
+		if q.Ack(r) {
+			t.Errorf("Expected: receipt %d not in flight anymore; Got: acknowledged again", r)
+		}
+	}
+	if v, _, ok := q.Pop(); ok || v != nil {
+		t.Errorf("Expected: nil as the queue should be empty; Got: %v", v)
+	}
+	if q.InFlight() != 0 {
+		t.Errorf("Expected: %d values in flight; Got: %d", 0, q.InFlight())
+	}
+}
+
+func TestAckQueueNackShouldReturnValueToHead(t *testing.T) {
+	q := New(Options{})
+	for i := 0; i < 3; i++ {
+		q.Push(i)
+	}
+
+	_, r0, _ := q.Pop()
+	_, r1, _ := q.Pop()
+	q.Nack(r0)
+	q.Nack(r1)
+	if q.Len() != 3 || q.InFlight() != 0 {
+		t.Errorf("Expected: %d ready, %d in flight; Got: %d, %d", 3, 0, q.Len(), q.InFlight())
+	}
+	if q.Nack(r1) {
+		t.Errorf("Expected: receipt %d not in flight anymore; Got: returned again", r1)
+	}
+
+	for _, expected := range []int{1, 0, 2} {
+		v, r, ok := q.Pop()
+		if !ok || v != expected {
+			t.Errorf("Expected: %d; Got: %v", expected, v)
+		}
+		if r == r0 || r == r1 {
+			t.Errorf("Expected: new receipt; Got: %d", r)
+		}
+	}
+}
+
+func TestAckQueueVisibilityTimeoutShouldRedeliverUnacknowledgedValues(t *testing.T) {
+	c := &fakeClock{t: time.Unix(1000, 0)}
+	q := New(Options{VisibilityTimeout: time.Second, Now: c.now})
+	for i := 0; i < 4; i++ {
+		q.Push(i)
+	}
+
+	_, r0, _ := q.Pop()
+	_, r1, _ := q.Pop()
+	c.advance(time.Second / 2)
+	_, r2, _ := q.Pop()
+	q.Ack(r1)
+	c.advance(time.Second / 2)
+
+	// Value 0 expired, value 1 was acknowledged and value 2 is still in flight.
+	for _, expected := range []int{0, 3} {
+		if v, _, ok := q.Pop(); !ok || v != expected {
+			t.Errorf("Expected: %d; Got: %v", expected, v)
+		}
+	}
+	if q.Ack(r0) {
+		t.Errorf("Expected: expired receipt %d not in flight; Got: acknowledged", r0)
+	}
+	if !q.Ack(r2) {
+		t.Errorf("Expected: receipt %d acknowledged; Got: not in flight", r2)
+	}
+}
+
+func TestAckQueueVisibilityTimeoutShouldRedeliverExpiredValuesInOrder(t *testing.T) {
+	c := &fakeClock{t: time.Unix(1000, 0)}
+	q := New(Options{VisibilityTimeout: time.Second, Now: c.now})
+	for i := 0; i < 4; i++ {
+		q.Push(i)
+	}
+
+	for i := 0; i < 3; i++ {
+		q.Pop()
+	}
+	c.advance(time.Second)
+	for _, expected := range []int{0, 1, 2, 3} {
+		if v, _, ok := q.Pop(); !ok || v != expected {
+			t.Errorf("Expected: %d; Got: %v", expected, v)
+		}
+	}
+}
+
+func TestAckQueueConcurrentPopAckNackShouldDeliverAllValuesAtLeastOnce(t *testing.T) {
+	q := New(Options{})
+	var wg sync.WaitGroup
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < concurrentCount; j++ {
+				q.Push(i*concurrentCount + j)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	acked := make([][]int, goroutines)
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for n := 0; ; n++ {
+				v, r, ok := q.Pop()
+				if !ok {
+					return
+				}
+				// Fail every other delivery.
+				if n%2 == 0 {
+					q.Nack(r)
+					continue
+				}
+				if q.Ack(r) {
+					acked[i] = append(acked[i], v.(int))
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	seen := make(map[int]bool)
+	for _, vs := range acked {
+		for _, v := range vs {
+			if seen[v] {
+				t.Errorf("Expected: %d acknowledged once; Got: acknowledged twice", v)
+			}
+			seen[v] = true
+		}
+	}
+	if len(seen) != goroutines*concurrentCount {
+		t.Errorf("Expected: %d values; Got: %d", goroutines*concurrentCount, len(seen))
+	}
+}
+
+func TestAckQueueDrainAndCloseShouldWaitForAllValuesToBeAcknowledged(t *testing.T) {
+	q := New(Options{})
+	for i := 0; i < concurrentCount; i++ {
+		q.Push(i)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for n := 0; ; n++ {
+				_, r, ok := q.Pop()
+				if !ok {
+					if q.InFlight() == 0 && q.Len() == 0 {
+						return
+					}
+					continue
+				}
+				if (i+n)%3 == 0 {
+					q.Nack(r)
+				} else {
+					q.Ack(r)
+				}
+			}
+		}(i)
+	}
+
+	if n, err := q.DrainAndClose(context.Background()); n != 0 || err != nil {
+		t.Errorf("Expected: %d, %v; Got: %d, %v", 0, nil, n, err)
+	}
+	if q.Len() != 0 || q.InFlight() != 0 {
+		t.Errorf("Expected: %d values ready and in flight; Got: %d, %d", 0, q.Len(), q.InFlight())
+	}
+	wg.Wait()
+}
+
+func TestAckQueueDrainAndCloseShouldReportAbandonedValuesWhenContextIsDone(t *testing.T) {
+	q := New(Options{})
+	for i := 0; i < 3; i++ {
+		q.Push(i)
+	}
+	_, r0, _ := q.Pop()
+	_, r1, _ := q.Pop()
+	q.Ack(r0)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if n, err := q.DrainAndClose(ctx); n != 2 || err != context.DeadlineExceeded {
+		t.Errorf("Expected: %d, %v; Got: %d, %v", 2, context.DeadlineExceeded, n, err)
+	}
+
+	// The abandoned values are still delivered and acknowledged, draining the queue.
+	q.Ack(r1)
+	if v, r, ok := q.Pop(); !ok || v != 2 || !q.Ack(r) {
+		t.Errorf("Expected: %d; Got: %v", 2, v)
+	}
+	if n, err := q.DrainAndClose(context.Background()); n != 0 || err != nil {
+		t.Errorf("Expected: %d, %v; Got: %d, %v", 0, nil, n, err)
+	}
+}
+
+func TestAckQueuePushAfterDrainAndCloseShouldPanic(t *testing.T) {
+	q := New(Options{})
+	if n, err := q.DrainAndClose(context.Background()); n != 0 || err != nil {
+		t.Errorf("Expected: %d, %v; Got: %d, %v", 0, nil, n, err)
+	}
+
+	defer func() {
+		if r := recover(); r == nil {
+			t.Error("Expected: panic; Got: no panic")
+		}
+	}()
+	q.Push(1)
+}
+
+func TestAckQueuePushEAfterDrainAndCloseShouldReturnErrClosed(t *testing.T) {
+	q := New(Options{})
+	if err := q.PushE(1); err != nil {
+		t.Errorf("Expected: %v; Got: %v", nil, err)
+	}
+	if v, r, ok := q.Pop(); !ok || v != 1 || !q.Ack(r) {
+		t.Errorf("Expected: %d; Got: %v", 1, v)
+	}
+	if n, err := q.DrainAndClose(context.Background()); n != 0 || err != nil {
+		t.Errorf("Expected: %d, %v; Got: %d, %v", 0, nil, n, err)
+	}
+
+	if err := q.PushE(2); err != queueerr.ErrClosed {
+		t.Errorf("Expected: %v; Got: %v", queueerr.ErrClosed, err)
+	}
+	if l := q.Len(); l != 0 {
+		t.Errorf("Expected: %d; Got: %d", 0, l)
+	}
+}
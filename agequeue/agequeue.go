@@ -0,0 +1,167 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package agequeue implements an unbounded, dynamically growing FIFO queue that tracks
+// how long each value spent in the queue.
+// Internally, queue wraps a queueimpl3 queue, storing each value along with the time it
+// was pushed. The age of the oldest value and the time each popped value spent in the
+// queue (its sojourn time) are the key signals for latency alerting and load shedding,
+// and they cannot be derived from the queue length alone.
+// Optionally, the CoDel overload controller drops values on Pop when their sojourn
+// time stays above a target for too long, so the queue works as a bounded latency
+// request buffer.
+package agequeue
+
+import (
+	"time"
+
+	"github.com/christianrpetrin/queue-tests/queueimpl3"
+)
+
+// Options configures a queue.
+// The zero value for Options holds the default configuration.
+type Options struct {
+	// Now returns the current time.
+	// A nil Now uses time.Now.
+	Now func() time.Time
+
+	// OnPop, if not nil, is called with each popped value and its sojourn time.
+	OnPop func(v interface{}, sojourn time.Duration)
+
+	// CoDel, if not nil, enables the CoDel overload controller, which drops
+	// values on Pop to bound their sojourn time.
+	CoDel *CoDel
+}
+
+// AgeQueue represents an unbounded, dynamically growing FIFO queue that tracks
+// the time its values spend in the queue.
+type AgeQueue struct {
+	// q holds the queue entries.
+	q queueimpl3.Queueimpl3
+
+	// opts holds the queue configuration.
+	opts Options
+
+	// codel holds the CoDel overload controller state.
+	codel codelState
+}
+
+// entry represents a queue value along with the time it was pushed.
+type entry struct {
+	// v holds the user added value.
+	v interface{}
+
+	// t holds the time v was pushed.
+	t time.Time
+}
+
+// New returns an initialized queue configured by opts.
+func New(opts Options) *AgeQueue {
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+	q := &AgeQueue{opts: opts}
+	q.q.Init()
+	return q
+}
+
+// Init initializes or clears queue q.
+func (q *AgeQueue) Init() *AgeQueue {
+	q.q.Init()
+	q.codel = codelState{}
+	return q
+}
+
+// Len returns the number of elements of queue q.
+// The complexity is O(1).
+func (q *AgeQueue) Len() int { return q.q.Len() }
+
+// Front returns the first element of queue q or nil if the queue is empty.
+// The second, bool result indicates whether a valid value was returned;
+//   if the queue is empty, false will be returned.
+// The complexity is O(1).
+func (q *AgeQueue) Front() (interface{}, bool) {
+	e, ok := q.q.Front()
+	if !ok {
+		return nil, false
+	}
+	return e.(entry).v, true
+}
+
+// OldestAge returns the time the first element of queue q has spent in the queue,
+// or 0 if the queue is empty.
+// The complexity is O(1).
+func (q *AgeQueue) OldestAge() time.Duration {
+	e, ok := q.q.Front()
+	if !ok {
+		return 0
+	}
+	return q.opts.Now().Sub(e.(entry).t)
+}
+
+// Push adds a value to the queue, recording the current time.
+// The complexity is O(1).
+func (q *AgeQueue) Push(v interface{}) {
+	q.q.Push(entry{v: v, t: q.opts.Now()})
+}
+
+// Pop retrieves and removes the next element from the queue.
+// The second, bool result indicates whether a valid value was returned;
+//   if the queue is empty, false will be returned.
+// The complexity is O(1), not counting the cost of the OnPop callback.
+func (q *AgeQueue) Pop() (interface{}, bool) {
+	v, _, ok := q.PopWithAge()
+	return v, ok
+}
+
+// PopWithAge retrieves and removes the next element from the queue, along with its sojourn time
+// (i.e. the time it spent in the queue).
+// The third, bool result indicates whether a valid value was returned;
+//   if the queue is empty, false will be returned.
+// If the CoDel overload controller is enabled, values may be dropped before
+// the returned one, and if all values are dropped false is returned.
+// The complexity is O(1), not counting the cost of the callbacks and of the dropped values.
+func (q *AgeQueue) PopWithAge() (interface{}, time.Duration, bool) {
+	var v interface{}
+	var sojourn time.Duration
+	var ok bool
+	if q.opts.CoDel != nil {
+		v, sojourn, ok = q.popCoDel()
+	} else {
+		v, sojourn, ok = q.pop(q.opts.Now())
+	}
+	if !ok {
+		return nil, 0, false
+	}
+
+	if q.opts.OnPop != nil {
+		q.opts.OnPop(v, sojourn)
+	}
+	return v, sojourn, true
+}
+
+// pop removes the next element from the queue, returning it along with its sojourn time at time now.
+func (q *AgeQueue) pop(now time.Time) (interface{}, time.Duration, bool) {
+	e, ok := q.q.Pop()
+	if !ok {
+		return nil, 0, false
+	}
+	return e.(entry).v, now.Sub(e.(entry).t), true
+}
@@ -0,0 +1,207 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package agequeue
+
+import (
+	"testing"
+	"time"
+)
+
+// fakeClock is a manually advanced clock.
+type fakeClock struct {
+	t time.Time
+}
+
+func (c *fakeClock) now() time.Time { return c.t }
+
+func (c *fakeClock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func TestAgeQueueNewQueueShouldReturnInitiazedInstanceOfQueue(t *testing.T) {
+	q := New(Options{})
+
+	if q == nil {
+		t.Error("Expected: new instance of queue; Got: nil")
+	}
+	if q.OldestAge() != 0 {
+		t.Errorf("Expected: %v; Got: %v", 0, q.OldestAge())
+	}
+}
+
+func TestAgeQueuePushPopFrontShouldRetrieveAllElementsInOrder(t *testing.T) {
+	q := New(Options{})
+	for i := 0; i < 1000; i++ {
+		q.Push(i)
+	}
+
+	for i := 0; i < 1000; i++ {
+		if v, ok := q.Front(); !ok || v.(int) != i {
+			t.Errorf("Expected: %d; Got: %d", i, v)
+		}
+		if v, ok := q.Pop(); !ok || v.(int) != i {
+			t.Errorf("Expected: %d; Got: %d", i, v)
+		}
+	}
+	if v, ok := q.Pop(); ok || v != nil {
+		t.Errorf("Expected: nil as the queue should be empty; Got: %d", v)
+	}
+	if v, _, ok := q.PopWithAge(); ok || v != nil {
+		t.Errorf("Expected: nil as the queue should be empty; Got: %d", v)
+	}
+}
+
+func TestAgeQueueShouldReportOldestAgeAndSojournTime(t *testing.T) {
+	c := &fakeClock{t: time.Unix(1000, 0)}
+	var sojourns []time.Duration
+	q := New(Options{
+		Now:   c.now,
+		OnPop: func(v interface{}, sojourn time.Duration) { sojourns = append(sojourns, sojourn) },
+	})
+
+	q.Push(1)
+	c.advance(time.Second)
+	q.Push(2)
+	c.advance(time.Second)
+	if age := q.OldestAge(); age != 2*time.Second {
+		t.Errorf("Expected: %v; Got: %v", 2*time.Second, age)
+	}
+
+	if v, sojourn, ok := q.PopWithAge(); !ok || v.(int) != 1 || sojourn != 2*time.Second {
+		t.Errorf("Expected: 1 and %v; Got: %v and %v", 2*time.Second, v, sojourn)
+	}
+	if age := q.OldestAge(); age != time.Second {
+		t.Errorf("Expected: %v; Got: %v", time.Second, age)
+	}
+	c.advance(time.Second)
+	q.Pop()
+
+	if len(sojourns) != 2 || sojourns[0] != 2*time.Second || sojourns[1] != 2*time.Second {
+		t.Errorf("Expected: [2s 2s]; Got: %v", sojourns)
+	}
+	if q.OldestAge() != 0 {
+		t.Errorf("Expected: %v; Got: %v", 0, q.OldestAge())
+	}
+}
+
+func TestAgeQueueInitShouldClearQueue(t *testing.T) {
+	q := New(Options{})
+	q.Push(1)
+	q.Init()
+
+	if q.Len() != 0 {
+		t.Errorf("Expected: %d; Got: %d", 0, q.Len())
+	}
+	if v, ok := q.Front(); ok || v != nil {
+		t.Errorf("Expected: nil as the queue should be empty; Got: %d", v)
+	}
+}
+
+func TestAgeQueueCoDelShouldDropValuesOfStandingQueue(t *testing.T) {
+	c := &fakeClock{t: time.Unix(1000, 0)}
+	var dropped []int
+	q := New(Options{
+		Now: c.now,
+		CoDel: &CoDel{
+			Target:   5 * time.Millisecond,
+			Interval: 100 * time.Millisecond,
+			OnDrop:   func(v interface{}, sojourn time.Duration) { dropped = append(dropped, v.(int)) },
+		},
+	})
+	for i := 0; i < 1000; i++ {
+		q.Push(i)
+	}
+
+	// The sojourn time goes above target, but not for long enough.
+	c.advance(10 * time.Millisecond)
+	if v, ok := q.Pop(); !ok || v.(int) != 0 || len(dropped) != 0 {
+		t.Errorf("Expected: 0 and no drops; Got: %v and %v", v, dropped)
+	}
+
+	// The sojourn time stayed above target for the whole interval, so start dropping.
+	c.advance(100 * time.Millisecond)
+	if v, ok := q.Pop(); !ok || v.(int) != 2 || len(dropped) != 1 || dropped[0] != 1 {
+		t.Errorf("Expected: 2 and 1 dropped; Got: %v and %v", v, dropped)
+	}
+
+	// The next drop is only due after another interval.
+	if v, ok := q.Pop(); !ok || v.(int) != 3 || len(dropped) != 1 {
+		t.Errorf("Expected: 3 and 1 drop; Got: %v and %v", v, dropped)
+	}
+	c.advance(100 * time.Millisecond)
+	if v, ok := q.Pop(); !ok || v.(int) != 5 || len(dropped) != 2 || dropped[1] != 4 {
+		t.Errorf("Expected: 5 and 4 dropped; Got: %v and %v", v, dropped)
+	}
+
+	// Values pushed after the overload have a low sojourn time, so dropping stops.
+	q.Init()
+	q.Push(1000)
+	q.Push(1001)
+	c.advance(time.Millisecond)
+	for i := 1000; i <= 1001; i++ {
+		if v, ok := q.Pop(); !ok || v.(int) != i || len(dropped) != 2 {
+			t.Errorf("Expected: %d and 2 drops; Got: %v and %v", i, v, dropped)
+		}
+	}
+}
+
+func TestAgeQueueCoDelWithLowSojournTimeShouldNotDropValues(t *testing.T) {
+	c := &fakeClock{t: time.Unix(1000, 0)}
+	drops := 0
+	q := New(Options{
+		Now:   c.now,
+		CoDel: &CoDel{OnDrop: func(v interface{}, sojourn time.Duration) { drops++ }},
+	})
+
+	// A short burst is absorbed, as long as it is drained within the interval.
+	for i := 0; i < 50; i++ {
+		q.Push(i)
+	}
+	for i := 0; i < 50; i++ {
+		c.advance(time.Millisecond)
+		q.Pop()
+	}
+	for i := 0; i < 1000; i++ {
+		q.Push(i)
+		c.advance(time.Millisecond)
+		q.Pop()
+	}
+	if drops != 0 {
+		t.Errorf("Expected: no drops; Got: %d", drops)
+	}
+}
+
+func TestAgeQueueCoDelShouldReturnFalseWhenAllValuesAreDropped(t *testing.T) {
+	c := &fakeClock{t: time.Unix(1000, 0)}
+	q := New(Options{Now: c.now, CoDel: &CoDel{}})
+	for i := 0; i < 3; i++ {
+		q.Push(i)
+	}
+
+	c.advance(time.Second)
+	q.Pop()
+	c.advance(time.Second)
+	q.Pop()
+	if v, ok := q.Pop(); ok {
+		t.Errorf("Expected: empty queue; Got: %v", v)
+	}
+	if q.Len() != 0 {
+		t.Errorf("Expected: %d; Got: %d", 0, q.Len())
+	}
+}
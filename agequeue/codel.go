@@ -0,0 +1,162 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package agequeue
+
+import (
+	"math"
+	"time"
+)
+
+const (
+	// DefaultCoDelTarget holds the default CoDel target sojourn time.
+	DefaultCoDelTarget = 5 * time.Millisecond
+
+	// DefaultCoDelInterval holds the default CoDel interval.
+	DefaultCoDelInterval = 100 * time.Millisecond
+)
+
+// CoDel configures the CoDel (Controlled Delay) overload controller, as described by RFC 8289.
+// Once the sojourn time of the popped values stays above Target for at least Interval, the
+// controller enters the dropping state, where it drops values on Pop at an increasing rate
+// (inversely proportional to the square root of the number of drops) until the sojourn time
+// falls below Target again. Short bursts are absorbed, while standing queues are drained.
+type CoDel struct {
+	// Target is the acceptable standing sojourn time.
+	// A Target of 0 or less uses DefaultCoDelTarget.
+	Target time.Duration
+
+	// Interval is the time the sojourn time must stay above Target before dropping starts.
+	// It should be in the order of the worst case time to react to the drops (e.g. a round trip).
+	// An Interval of 0 or less uses DefaultCoDelInterval.
+	Interval time.Duration
+
+	// OnDrop, if not nil, is called with each dropped value and its sojourn time.
+	OnDrop func(v interface{}, sojourn time.Duration)
+}
+
+// codelState holds the CoDel overload controller state.
+type codelState struct {
+	// firstAboveTime holds the time at which dropping starts if the sojourn time
+	// stays above target, or the zero time if the sojourn time is below target.
+	firstAboveTime time.Time
+
+	// dropNext holds the time of the next drop, when dropping.
+	dropNext time.Time
+
+	// count holds the number of drops since entering the dropping state.
+	count int
+
+	// lastCount holds the count value when the dropping state was last left.
+	lastCount int
+
+	// dropping holds whether the controller is in the dropping state.
+	dropping bool
+}
+
+// popCoDel removes the next element from the queue that is not dropped by the CoDel controller.
+func (q *AgeQueue) popCoDel() (interface{}, time.Duration, bool) {
+	target, interval := q.opts.CoDel.Target, q.opts.CoDel.Interval
+	if target <= 0 {
+		target = DefaultCoDelTarget
+	}
+	if interval <= 0 {
+		interval = DefaultCoDelInterval
+	}
+
+	c := &q.codel
+	now := q.opts.Now()
+	v, sojourn, ok, okToDrop := q.doPop(now, target, interval)
+	if !ok {
+		c.dropping = false
+		return nil, 0, false
+	}
+
+	if c.dropping {
+		if !okToDrop {
+			// The sojourn time fell below target, so leave the dropping state.
+			c.dropping = false
+		}
+		for c.dropping && !now.Before(c.dropNext) {
+			q.drop(v, sojourn)
+			c.count++
+			v, sojourn, ok, okToDrop = q.doPop(now, target, interval)
+			if !ok {
+				c.dropping = false
+				return nil, 0, false
+			}
+			if !okToDrop {
+				c.dropping = false
+			} else {
+				c.dropNext = controlLaw(c.dropNext, interval, c.count)
+			}
+		}
+	} else if okToDrop {
+		q.drop(v, sojourn)
+		v, sojourn, ok, _ = q.doPop(now, target, interval)
+		c.dropping = true
+
+		// If the dropping state was left recently, resume from the previous drop rate.
+		if delta := c.count - c.lastCount; delta > 1 && now.Sub(c.dropNext) < 16*interval {
+			c.count = delta
+		} else {
+			c.count = 1
+		}
+		c.dropNext = controlLaw(now, interval, c.count)
+		c.lastCount = c.count
+		if !ok {
+			c.dropping = false
+			return nil, 0, false
+		}
+	}
+	return v, sojourn, true
+}
+
+// doPop removes the next element from the queue, also returning whether it can be dropped,
+// which is the case if the sojourn time has been above target for at least interval.
+func (q *AgeQueue) doPop(now time.Time, target, interval time.Duration) (v interface{}, sojourn time.Duration, ok, okToDrop bool) {
+	c := &q.codel
+	v, sojourn, ok = q.pop(now)
+	if !ok {
+		c.firstAboveTime = time.Time{}
+		return nil, 0, false, false
+	}
+
+	if sojourn < target {
+		c.firstAboveTime = time.Time{}
+	} else if c.firstAboveTime.IsZero() {
+		c.firstAboveTime = now.Add(interval)
+	} else if !now.Before(c.firstAboveTime) {
+		okToDrop = true
+	}
+	return v, sojourn, true, okToDrop
+}
+
+// drop calls the OnDrop callback with dropped value v.
+func (q *AgeQueue) drop(v interface{}, sojourn time.Duration) {
+	if q.opts.CoDel.OnDrop != nil {
+		q.opts.CoDel.OnDrop(v, sojourn)
+	}
+}
+
+// controlLaw returns the time of the next drop after time t, given the number of drops so far.
+func controlLaw(t time.Time, interval time.Duration, count int) time.Time {
+	return t.Add(time.Duration(float64(interval) / math.Sqrt(float64(count))))
+}
@@ -0,0 +1,165 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package agingqueue implements an unbounded, dynamically growing priority queue where the
+// priority of each value increases with the time it spent in the queue (i.e. aging), so
+// low priority values are eventually served even while higher priority values keep coming.
+// Internally, queue keeps a queueimpl3 FIFO queue per distinct priority in a levels list.
+// As the aging function never decreases with the waiting time, the oldest value of each
+// priority has the highest effective priority among the values of that priority, so Pop only
+// needs to compare the first value of each priority, regardless of the number of values in
+// the queue.
+package agingqueue
+
+import (
+	"time"
+
+	"github.com/christianrpetrin/queue-tests/levels"
+)
+
+// AgingFunc returns the effective priority of a value of the given priority that has been
+// waiting in the queue for the given time.
+// An AgingFunc must not decrease as wait grows, for any given priority.
+type AgingFunc func(priority int, wait time.Duration) float64
+
+// LinearAging returns an aging function where the effective priority of a value
+// grows by perSecond for each second it waits in the queue.
+func LinearAging(perSecond float64) AgingFunc {
+	return func(priority int, wait time.Duration) float64 {
+		return float64(priority) + perSecond*wait.Seconds()
+	}
+}
+
+// Options configures a queue.
+// The zero value for Options holds the default configuration.
+type Options struct {
+	// Aging returns the effective priority of the queue values.
+	// A nil Aging disables aging, so values are popped by priority only.
+	Aging AgingFunc
+
+	// Now returns the current time.
+	// A nil Now uses time.Now.
+	Now func() time.Time
+}
+
+// AgingQueue represents an unbounded, dynamically growing priority queue with aging.
+// Values with the same effective priority are popped in FIFO order.
+// The zero value for queue is not ready to use; use New to create a queue.
+type AgingQueue struct {
+	// opts holds the queue configuration.
+	opts Options
+
+	// levels holds a level for each distinct priority of the queue values, sorted by
+	// descending priority.
+	levels levels.List
+
+	// seq holds the sequence number of the next pushed value.
+	seq uint64
+
+	// len holds the current queue length.
+	len int
+}
+
+// entry represents a queue value along with the time it was pushed.
+type entry struct {
+	// v holds the user added value.
+	v interface{}
+
+	// t holds the time v was pushed.
+	t time.Time
+
+	// seq holds the push sequence number, which breaks ties in FIFO order.
+	seq uint64
+}
+
+// New returns an initialized queue configured by opts.
+func New(opts Options) *AgingQueue {
+	if opts.Aging == nil {
+		opts.Aging = LinearAging(0)
+	}
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+	return &AgingQueue{opts: opts}
+}
+
+// Len returns the number of elements of queue q.
+// The complexity is O(1).
+func (q *AgingQueue) Len() int { return q.len }
+
+// Front returns the element of queue q with the highest effective priority, or nil if the queue is empty.
+// The second, bool result indicates whether a valid value was returned;
+//   if the queue is empty, false will be returned.
+// The complexity is O(p), where p is the number of distinct priorities in the queue.
+func (q *AgingQueue) Front() (interface{}, bool) {
+	l := q.next()
+	if l == nil {
+		return nil, false
+	}
+	e, _ := l.Q.Front()
+	return e.(entry).v, true
+}
+
+// Push adds a value with the given priority to the queue.
+// Higher values mean higher priority.
+// The complexity is O(1), or O(p) if no other value of the same priority is in the queue,
+// where p is the number of distinct priorities in the queue.
+func (q *AgingQueue) Push(v interface{}, priority int) {
+	l := q.levels.Get(priority)
+	l.Q.Push(entry{v: v, t: q.opts.Now(), seq: q.seq})
+	q.seq++
+	q.len++
+}
+
+// Pop retrieves and removes the element with the highest effective priority from the queue.
+// The second, bool result indicates whether a valid value was returned;
+//   if the queue is empty, false will be returned.
+// The complexity is O(p), where p is the number of distinct priorities in the queue.
+func (q *AgingQueue) Pop() (interface{}, bool) {
+	l := q.next()
+	if l == nil {
+		return nil, false
+	}
+
+	e, _ := l.Q.Pop()
+	q.len--
+	if l.Q.Len() == 0 {
+		q.levels.Remove(l)
+	}
+	return e.(entry).v, true
+}
+
+// next returns the level whose first value has the highest effective priority,
+// or nil if the queue is empty.
+func (q *AgingQueue) next() *levels.Level {
+	var best *levels.Level
+	var bestPriority float64
+	var bestSeq uint64
+	now := q.opts.Now()
+	for _, l := range q.levels.Levels() {
+		v, _ := l.Q.Front()
+		e := v.(entry)
+		p := q.opts.Aging(l.Priority, now.Sub(e.t))
+		if best == nil || p > bestPriority || p == bestPriority && e.seq < bestSeq {
+			best, bestPriority, bestSeq = l, p, e.seq
+		}
+	}
+	return best
+}
@@ -0,0 +1,138 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package agingqueue
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// fakeClock is a manually advanced clock.
+type fakeClock struct {
+	t time.Time
+}
+
+func (c *fakeClock) now() time.Time { return c.t }
+
+func (c *fakeClock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func TestAgingQueueNewQueueShouldReturnInitiazedInstanceOfQueue(t *testing.T) {
+	q := New(Options{})
+
+	if q == nil {
+		t.Error("Expected: new instance of queue; Got: nil")
+	}
+	if v, ok := q.Pop(); ok || v != nil {
+		t.Errorf("Expected: nil as the queue should be empty; Got: %v", v)
+	}
+	if v, ok := q.Front(); ok || v != nil {
+		t.Errorf("Expected: nil as the queue should be empty; Got: %v", v)
+	}
+}
+
+func TestAgingQueueWithoutAgingShouldPopByPriorityThenFIFO(t *testing.T) {
+	q := New(Options{})
+	q.Push("low1", 1)
+	q.Push("high1", 10)
+	q.Push("mid", 5)
+	q.Push("high2", 10)
+	q.Push("low2", 1)
+
+	for _, expected := range []string{"high1", "high2", "mid", "low1", "low2"} {
+		if v, ok := q.Front(); !ok || v.(string) != expected {
+			t.Errorf("Expected: %s; Got: %v", expected, v)
+		}
+		if v, ok := q.Pop(); !ok || v.(string) != expected {
+			t.Errorf("Expected: %s; Got: %v", expected, v)
+		}
+	}
+	if q.Len() != 0 || q.levels.Len() != 0 {
+		t.Errorf("Expected: empty queue; Got: %d values and %d levels", q.Len(), q.levels.Len())
+	}
+}
+
+func TestAgingQueueWithAgingShouldEventuallyServeLowPriorityValues(t *testing.T) {
+	c := &fakeClock{t: time.Unix(1000, 0)}
+	q := New(Options{Aging: LinearAging(1), Now: c.now})
+	q.Push("low", 0)
+
+	// A steady stream of higher priority values only delays the low priority value
+	// until it waited long enough for its effective priority to catch up.
+	for i := 0; ; i++ {
+		q.Push("high", 5)
+		c.advance(time.Second)
+		v, _ := q.Pop()
+		if v.(string) == "low" {
+			if i < 5 {
+				t.Errorf("Expected: low served after at least 5 seconds; Got: %d seconds", i+1)
+			}
+			break
+		}
+		if i > 10 {
+			t.Fatal("Expected: low priority value to be served; Got: starved")
+		}
+	}
+}
+
+// shadowEntry is an entry of the brute force model used to check the ordering invariant.
+type shadowEntry struct {
+	v        int
+	priority int
+	t        time.Time
+}
+
+func TestAgingQueueShouldAlwaysPopValueWithHighestEffectivePriority(t *testing.T) {
+	c := &fakeClock{t: time.Unix(1000, 0)}
+	aging := func(priority int, wait time.Duration) float64 {
+		// A non-linear aging function, growing faster for higher priorities.
+		return float64(priority) + float64(priority+1)*wait.Seconds()*wait.Seconds()
+	}
+	q := New(Options{Aging: aging, Now: c.now})
+	r := rand.New(rand.NewSource(1))
+
+	var shadow []shadowEntry
+	for i := 0; i < 5000; i++ {
+		if r.Intn(3) > 0 {
+			e := shadowEntry{v: i, priority: r.Intn(8), t: c.now()}
+			q.Push(e.v, e.priority)
+			shadow = append(shadow, e)
+		} else if len(shadow) > 0 {
+			// The expected value is the one with the highest effective priority,
+			// breaking ties in push order.
+			best := 0
+			for j, e := range shadow {
+				if aging(e.priority, c.now().Sub(e.t)) > aging(shadow[best].priority, c.now().Sub(shadow[best].t)) {
+					best = j
+				}
+			}
+			v, ok := q.Pop()
+			if !ok || v.(int) != shadow[best].v {
+				t.Fatalf("Expected: %d; Got: %v", shadow[best].v, v)
+			}
+			shadow = append(shadow[:best], shadow[best+1:]...)
+		}
+		if q.Len() != len(shadow) {
+			t.Fatalf("Expected: %d; Got: %d", len(shadow), q.Len())
+		}
+		c.advance(time.Duration(r.Intn(100)) * time.Millisecond)
+	}
+}
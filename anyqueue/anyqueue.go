@@ -0,0 +1,231 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package anyqueue implements a queue façade backed by any of the queue implementations in
+// this repo, selected at runtime by name, so applications can switch implementations using
+// a configuration setting or a command line flag, e.g. to A/B test them in production.
+// Internally, a registry maps each kind (e.g. "impl7" or "lockfree") to a backend that
+// builds queues of that kind; all built-in implementations are registered by the package,
+// and others can be added using Register.
+// Queues built by NewKind are only safe for concurrent use if the backend is; the Concurrent
+// option wraps the sequential implementations with a mutex, so any kind can be shared by
+// multiple goroutines.
+package anyqueue
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/christianrpetrin/queue-tests/faaqueue"
+	"github.com/christianrpetrin/queue-tests/fcqueue"
+	"github.com/christianrpetrin/queue-tests/lockfreequeue"
+	"github.com/christianrpetrin/queue-tests/queueimpl1"
+	"github.com/christianrpetrin/queue-tests/queueimpl10"
+	"github.com/christianrpetrin/queue-tests/queueimpl11"
+	"github.com/christianrpetrin/queue-tests/queueimpl2"
+	"github.com/christianrpetrin/queue-tests/queueimpl3"
+	"github.com/christianrpetrin/queue-tests/queueimpl4"
+	"github.com/christianrpetrin/queue-tests/queueimpl5"
+	"github.com/christianrpetrin/queue-tests/queueimpl6"
+	"github.com/christianrpetrin/queue-tests/queueimpl7"
+	"github.com/christianrpetrin/queue-tests/queueimpl8"
+	"github.com/christianrpetrin/queue-tests/queuetest"
+	"github.com/christianrpetrin/queue-tests/safequeue"
+)
+
+// UnknownKindError is returned by NewKind when no backend is registered for the requested kind.
+type UnknownKindError struct {
+	// Kind holds the requested kind.
+	Kind string
+}
+
+// Error returns the error message, holding the requested kind.
+func (e *UnknownKindError) Error() string {
+	return fmt.Sprintf("anyqueue: unknown kind %q", e.Kind)
+}
+
+// Queue is the set of operations shared by all the queue implementations.
+// Implementations with more operations (e.g. Front) can be type asserted to them.
+type Queue interface {
+	queuetest.Queue
+}
+
+// Options holds the options used to build a queue.
+type Options struct {
+	// Concurrent requests a queue safe for concurrent use by multiple goroutines.
+	Concurrent bool
+
+	// Reclamation requests a lock-free queue reclaiming its nodes using epoch-based
+	// reclamation. It is ignored by the backends not supporting it.
+	Reclamation bool
+}
+
+// Option sets one of the options used to build a queue.
+type Option func(o *Options)
+
+// Concurrent returns an option requesting a queue safe for concurrent use.
+// Queues of sequential kinds are wrapped with a mutex.
+func Concurrent() Option {
+	return func(o *Options) { o.Concurrent = true }
+}
+
+// Reclamation returns an option requesting epoch-based reclamation of the queue nodes,
+// which is supported by the lockfree and faa kinds.
+func Reclamation() Option {
+	return func(o *Options) { o.Reclamation = true }
+}
+
+// Backend describes how to build the queues of a kind.
+type Backend struct {
+	// New returns a new, empty queue built using options o.
+	New func(o Options) Queue
+
+	// Concurrent tells whether the queues returned by New are safe for concurrent use.
+	Concurrent bool
+}
+
+var (
+	// mu guards backends.
+	mu sync.RWMutex
+
+	// backends holds the registered backends, by kind.
+	backends = make(map[string]Backend)
+)
+
+func init() {
+	sequential := func(new func() Queue) Backend {
+		return Backend{New: func(Options) Queue { return new() }}
+	}
+	Register("impl1", sequential(func() Queue { return queueimpl1.New() }))
+	Register("impl2", sequential(func() Queue { return queueimpl2.New() }))
+	Register("impl3", sequential(func() Queue { return queueimpl3.New() }))
+	Register("impl4", sequential(func() Queue { return queueimpl4.New() }))
+	Register("impl5", sequential(func() Queue { return queueimpl5.New() }))
+	Register("impl6", sequential(func() Queue { return queueimpl6.New() }))
+	Register("impl7", sequential(func() Queue { return queueimpl7.New() }))
+	Register("impl8", sequential(func() Queue { return queueimpl8.New() }))
+	Register("impl10", sequential(func() Queue { return queueimpl10.New() }))
+	Register("impl11", sequential(func() Queue { return queueimpl11.New() }))
+	Register("safe", Backend{
+		New:        func(Options) Queue { return safequeue.New() },
+		Concurrent: true,
+	})
+	Register("lockfree", Backend{
+		New: func(o Options) Queue {
+			if o.Reclamation {
+				return lockfreequeue.NewWithReclamation()
+			}
+			return lockfreequeue.New()
+		},
+		Concurrent: true,
+	})
+	Register("faa", Backend{
+		New: func(o Options) Queue {
+			if o.Reclamation {
+				return faaqueue.NewWithReclamation()
+			}
+			return faaqueue.New()
+		},
+		Concurrent: true,
+	})
+	Register("fc", Backend{
+		New:        func(Options) Queue { return fcqueue.New() },
+		Concurrent: true,
+	})
+}
+
+// Register makes backend b available under name kind.
+// Register panics if it is called twice with the same kind, or if b.New is nil.
+func Register(kind string, b Backend) {
+	if b.New == nil {
+		panic("anyqueue: Register backend New is nil")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if _, dup := backends[kind]; dup {
+		panic("anyqueue: Register called twice for kind " + kind)
+	}
+	backends[kind] = b
+}
+
+// Kinds returns the sorted list of the registered kinds.
+func Kinds() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	kinds := make([]string, 0, len(backends))
+	for kind := range backends {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	return kinds
+}
+
+// NewKind returns a new, empty queue of kind kind, built using options opts.
+// If no backend is registered for kind, an *UnknownKindError is returned.
+func NewKind(kind string, opts ...Option) (Queue, error) {
+	mu.RLock()
+	b, ok := backends[kind]
+	mu.RUnlock()
+	if !ok {
+		return nil, &UnknownKindError{Kind: kind}
+	}
+
+	var o Options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	q := b.New(o)
+	if o.Concurrent && !b.Concurrent {
+		q = &lockedQueue{q: q}
+	}
+	return q, nil
+}
+
+// lockedQueue wraps a sequential queue, guarding every operation with a mutex.
+type lockedQueue struct {
+	// mu guards q.
+	mu sync.Mutex
+
+	// q holds the wrapped queue.
+	q Queue
+}
+
+// Len returns the number of elements of queue q.
+func (q *lockedQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.q.Len()
+}
+
+// Push adds a value to the queue.
+func (q *lockedQueue) Push(v interface{}) {
+	q.mu.Lock()
+	q.q.Push(v)
+	q.mu.Unlock()
+}
+
+// Pop retrieves and removes the next element from the queue.
+func (q *lockedQueue) Pop() (interface{}, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.q.Pop()
+}
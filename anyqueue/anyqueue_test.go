@@ -0,0 +1,178 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package anyqueue
+
+import (
+	"sort"
+	"sync"
+	"testing"
+)
+
+func TestKindsShouldListBuiltInKinds(t *testing.T) {
+	kinds := Kinds()
+	if !sort.StringsAreSorted(kinds) {
+		t.Errorf("Expected: sorted kinds; Got: %v", kinds)
+	}
+	for _, want := range []string{"impl1", "impl3", "impl7", "impl11", "safe", "lockfree", "faa", "fc"} {
+		found := false
+		for _, kind := range kinds {
+			if kind == want {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("Expected: %s in kinds; Got: %v", want, kinds)
+		}
+	}
+}
+
+func TestNewKindShouldReturnFIFOQueueOfEveryKind(t *testing.T) {
+	for _, kind := range Kinds() {
+		for _, opts := range [][]Option{nil, {Concurrent()}, {Concurrent(), Reclamation()}} {
+			q, err := NewKind(kind, opts...)
+			if err != nil {
+				t.Fatalf("%s: Expected: nil error; Got: %v", kind, err)
+			}
+
+			count := 300
+			for i := 0; i < count; i++ {
+				v := i
+				q.Push(&v)
+			}
+			if q.Len() != count {
+				t.Errorf("%s: Expected: %d; Got: %d", kind, count, q.Len())
+			}
+			for i := 0; i < count; i++ {
+				v, ok := q.Pop()
+				if !ok || *v.(*int) != i {
+					t.Fatalf("%s: Expected: %d; Got: %v", kind, i, v)
+				}
+			}
+			if v, ok := q.Pop(); ok {
+				t.Errorf("%s: Expected: empty queue; Got: %v", kind, v)
+			}
+		}
+	}
+}
+
+func TestNewKindWithUnknownKindShouldReturnError(t *testing.T) {
+	q, err := NewKind("impl0")
+	if e, ok := err.(*UnknownKindError); !ok || e.Kind != "impl0" {
+		t.Errorf("Expected: %v; Got: %v", &UnknownKindError{Kind: "impl0"}, err)
+	}
+	if q != nil {
+		t.Errorf("Expected: nil queue; Got: %v", q)
+	}
+}
+
+func TestNewKindWithConcurrentShouldWrapSequentialKindsOnly(t *testing.T) {
+	if q, _ := NewKind("impl7", Concurrent()); !isLocked(q) {
+		t.Errorf("Expected: impl7 wrapped with a mutex; Got: %T", q)
+	}
+	if q, _ := NewKind("impl7"); isLocked(q) {
+		t.Errorf("Expected: impl7 not wrapped; Got: %T", q)
+	}
+	if q, _ := NewKind("lockfree", Concurrent()); isLocked(q) {
+		t.Errorf("Expected: lockfree not wrapped; Got: %T", q)
+	}
+}
+
+func TestNewKindWithConcurrentShouldBeSafeForConcurrentUse(t *testing.T) {
+	q, err := NewKind("impl3", Concurrent())
+	if err != nil {
+		t.Fatalf("Expected: nil error; Got: %v", err)
+	}
+
+	producers, count := 4, 1000
+	var wg sync.WaitGroup
+	for p := 0; p < producers; p++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < count; i++ {
+				q.Push(i)
+			}
+		}()
+	}
+	wg.Wait()
+	if q.Len() != producers*count {
+		t.Errorf("Expected: %d; Got: %d", producers*count, q.Len())
+	}
+}
+
+func TestRegisterShouldAddKind(t *testing.T) {
+	Register("test", Backend{New: func(o Options) Queue {
+		if !o.Reclamation {
+			t.Error("Expected: Reclamation option; Got: none")
+		}
+		return new(stack)
+	}})
+	defer unregister("test")
+
+	q, err := NewKind("test", Reclamation())
+	if err != nil {
+		t.Fatalf("Expected: nil error; Got: %v", err)
+	}
+	if _, ok := q.(*stack); !ok {
+		t.Errorf("Expected: *stack; Got: %T", q)
+	}
+}
+
+func TestRegisterTwiceShouldPanic(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil {
+			t.Error("Expected: panic; Got: none")
+		}
+	}()
+	Register("impl1", Backend{New: func(Options) Queue { return new(stack) }})
+}
+
+// isLocked returns whether q is wrapped with a mutex.
+func isLocked(q Queue) bool {
+	_, ok := q.(*lockedQueue)
+	return ok
+}
+
+// unregister removes the backend registered for kind.
+func unregister(kind string) {
+	mu.Lock()
+	delete(backends, kind)
+	mu.Unlock()
+}
+
+// stack is a minimal queue registered by the tests.
+type stack struct {
+	// v holds the stack values.
+	v []interface{}
+}
+
+func (s *stack) Len() int { return len(s.v) }
+
+func (s *stack) Push(v interface{}) { s.v = append(s.v, v) }
+
+func (s *stack) Pop() (interface{}, bool) {
+	if len(s.v) == 0 {
+		return nil, false
+	}
+	v := s.v[len(s.v)-1]
+	s.v = s.v[:len(s.v)-1]
+	return v, true
+}
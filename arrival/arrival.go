@@ -0,0 +1,191 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package arrival implements bursty arrival patterns, and runs them against concurrent queues
+// to measure how the queues behave when bursts force them to grow rapidly and then shrink.
+// Internally, a single producer goroutine pushes each burst of values back to back, and then
+// sleeps until the next burst is due, while concurrent consumer goroutines pop values as fast
+// as they can. The producer samples the queue length after each burst, and the consumers
+// record when the number of popped values reaches the number of values pushed up to each
+// burst, i.e. when the burst has been drained.
+package arrival
+
+import (
+	"math/rand"
+	"runtime"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/christianrpetrin/queue-tests/queuetest"
+)
+
+// Queue is the set of operations the arrival patterns need from a queue.
+// The queue must be safe for concurrent use by multiple goroutines.
+type Queue interface {
+	queuetest.Queue
+}
+
+// Burst represents a burst of values pushed back to back.
+type Burst struct {
+	// Size holds the number of values of the burst.
+	Size int
+
+	// Gap holds how long to wait after the burst before pushing the next one.
+	Gap time.Duration
+}
+
+// Pattern returns the next burst of an arrival pattern each time it is called.
+type Pattern func() Burst
+
+// Poisson returns a pattern whose bursts arrive as a Poisson process, i.e. separated by
+// exponentially distributed gaps with mean meanGap, and whose sizes are exponentially
+// distributed with mean meanSize, holding at least one value. Patterns using the same seed
+// return the same bursts.
+func Poisson(meanSize int, meanGap time.Duration, seed int64) Pattern {
+	r := rand.New(rand.NewSource(seed))
+	return func() Burst {
+		return Burst{
+			Size: 1 + int(r.ExpFloat64()*float64(meanSize-1)),
+			Gap:  time.Duration(r.ExpFloat64() * float64(meanGap)),
+		}
+	}
+}
+
+// OnOff returns a pattern alternating on periods, when bursts of size values are pushed every
+// gap, with off periods, when no values are pushed for off. Each on period holds on bursts.
+func OnOff(on, size int, gap, off time.Duration) Pattern {
+	if on < 1 {
+		on = 1
+	}
+	i := 0
+	return func() Burst {
+		i++
+		if i%on == 0 {
+			return Burst{Size: size, Gap: off}
+		}
+		return Burst{Size: size, Gap: gap}
+	}
+}
+
+// Options holds the options of a run.
+type Options struct {
+	// Bursts holds the number of bursts pushed by the run. 0 means 10 bursts.
+	Bursts int
+
+	// Consumers holds the number of consumer goroutines. 0 means 1 consumer.
+	Consumers int
+}
+
+// Result holds the measurements of a run.
+type Result struct {
+	// Values holds the number of values pushed and popped.
+	Values int
+
+	// MaxLen holds the largest queue length sampled after each burst.
+	MaxLen int
+
+	// MeanDrain holds the mean burst drain time, i.e. the time between the first value of a
+	// burst being pushed and all values pushed up to that burst being popped.
+	MeanDrain time.Duration
+
+	// MaxDrain holds the largest burst drain time.
+	MaxDrain time.Duration
+
+	// Elapsed holds the time taken by the whole run.
+	Elapsed time.Duration
+}
+
+// Run pushes the bursts of pattern p to empty queue q while the consumers pop them, and
+// returns the measurements once all values were popped.
+// The pushed values are the int indices of the values, in push order.
+func Run(q Queue, p Pattern, o Options) Result {
+	if o.Bursts <= 0 {
+		o.Bursts = 10
+	}
+	if o.Consumers <= 0 {
+		o.Consumers = 1
+	}
+
+	bursts := make([]Burst, o.Bursts)
+	totals := make([]int64, o.Bursts)
+	var total int64
+	for i := range bursts {
+		bursts[i] = p()
+		if bursts[i].Size < 1 {
+			bursts[i].Size = 1
+		}
+		total += int64(bursts[i].Size)
+		totals[i] = total
+	}
+
+	// starts is written by the producer before pushing each burst, and read by the
+	// consumers after popping it, so the queue synchronizes the accesses.
+	starts := make([]time.Time, o.Bursts)
+	drains := make([]time.Duration, o.Bursts)
+	var popped int64
+	var wg sync.WaitGroup
+	begin := time.Now()
+	for c := 0; c < o.Consumers; c++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for atomic.LoadInt64(&popped) < total {
+				if _, ok := q.Pop(); !ok {
+					runtime.Gosched()
+					continue
+				}
+				n := atomic.AddInt64(&popped, 1)
+				if i := sort.Search(len(totals), func(i int) bool { return totals[i] >= n }); totals[i] == n {
+					drains[i] = time.Since(starts[i])
+				}
+			}
+		}()
+	}
+
+	r := Result{Values: int(total)}
+	v := 0
+	for i, b := range bursts {
+		starts[i] = time.Now()
+		for j := 0; j < b.Size; j++ {
+			q.Push(v)
+			v++
+		}
+		if l := q.Len(); l > r.MaxLen {
+			r.MaxLen = l
+		}
+		if b.Gap > 0 && i < len(bursts)-1 {
+			time.Sleep(b.Gap)
+		}
+	}
+	wg.Wait()
+	r.Elapsed = time.Since(begin)
+
+	var sum time.Duration
+	for _, d := range drains {
+		sum += d
+		if d > r.MaxDrain {
+			r.MaxDrain = d
+		}
+	}
+	r.MeanDrain = sum / time.Duration(len(drains))
+	return r
+}
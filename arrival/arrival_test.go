@@ -0,0 +1,135 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package arrival
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/christianrpetrin/queue-tests/safequeue"
+)
+
+// recordingQueue is a SafeQueue recording the popped values.
+type recordingQueue struct {
+	*safequeue.SafeQueue
+
+	// mu guards popped.
+	mu sync.Mutex
+
+	// popped holds the popped values.
+	popped []int
+}
+
+// Pop retrieves, records and removes the next element from the queue.
+func (q *recordingQueue) Pop() (interface{}, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	v, ok := q.SafeQueue.Pop()
+	if ok {
+		q.popped = append(q.popped, v.(int))
+	}
+	return v, ok
+}
+
+func TestPoissonWithSameSeedShouldReturnSameBursts(t *testing.T) {
+	p1 := Poisson(100, time.Millisecond, 1)
+	p2 := Poisson(100, time.Millisecond, 1)
+	for i := 0; i < 100; i++ {
+		if b1, b2 := p1(), p2(); b1 != b2 {
+			t.Fatalf("Expected: %v; Got: %v", b1, b2)
+		}
+	}
+}
+
+func TestPoissonShouldReturnBurstsWithGivenMeans(t *testing.T) {
+	p := Poisson(100, time.Millisecond, 1)
+	const count = 10000
+	var size int
+	var gap time.Duration
+	for i := 0; i < count; i++ {
+		b := p()
+		if b.Size < 1 {
+			t.Fatalf("Expected: burst size at least 1; Got: %d", b.Size)
+		}
+		size += b.Size
+		gap += b.Gap
+	}
+
+	if mean := size / count; mean < 90 || mean > 110 {
+		t.Errorf("Expected: mean size about 100; Got: %d", mean)
+	}
+	if mean := gap / count; mean < 900*time.Microsecond || mean > 1100*time.Microsecond {
+		t.Errorf("Expected: mean gap about 1ms; Got: %v", mean)
+	}
+}
+
+func TestOnOffShouldAlternateOnAndOffPeriods(t *testing.T) {
+	p := OnOff(3, 10, time.Millisecond, time.Second)
+	want := []time.Duration{time.Millisecond, time.Millisecond, time.Second, time.Millisecond, time.Millisecond, time.Second}
+	for i, gap := range want {
+		if b := p(); b.Size != 10 || b.Gap != gap {
+			t.Errorf("Expected: burst %d {10 %v}; Got: %v", i, gap, b)
+		}
+	}
+}
+
+func TestRunShouldPopAllValuesInOrder(t *testing.T) {
+	q := &recordingQueue{SafeQueue: safequeue.New()}
+	r := Run(q, OnOff(2, 1000, 0, time.Millisecond), Options{Bursts: 5, Consumers: 4})
+
+	if r.Values != 5000 {
+		t.Errorf("Expected: 5000; Got: %d", r.Values)
+	}
+	if len(q.popped) != r.Values {
+		t.Fatalf("Expected: %d popped values; Got: %d", r.Values, len(q.popped))
+	}
+	for i, v := range q.popped {
+		if v != i {
+			t.Fatalf("Expected: %d; Got: %d", i, v)
+		}
+	}
+	if l := q.Len(); l != 0 {
+		t.Errorf("Expected: 0 as all values were popped; Got: %d", l)
+	}
+	if r.MaxLen < 1 || r.MaxLen > r.Values {
+		t.Errorf("Expected: max length between 1 and %d; Got: %d", r.Values, r.MaxLen)
+	}
+	if r.MeanDrain <= 0 || r.MeanDrain > r.MaxDrain || r.MaxDrain > r.Elapsed {
+		t.Errorf("Expected: 0 < mean drain <= max drain <= elapsed; Got: %v, %v, %v", r.MeanDrain, r.MaxDrain, r.Elapsed)
+	}
+}
+
+func TestRunWithZeroOptionsShouldUseDefaults(t *testing.T) {
+	bursts := 0
+	p := func() Burst {
+		bursts++
+		return Burst{Size: 0}
+	}
+	r := Run(safequeue.New(), p, Options{})
+
+	if bursts != 10 {
+		t.Errorf("Expected: 10 bursts; Got: %d", bursts)
+	}
+	if r.Values != 10 {
+		t.Errorf("Expected: 10 values as empty bursts hold a single value; Got: %d", r.Values)
+	}
+}
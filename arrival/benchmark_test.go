@@ -0,0 +1,89 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+//go:build go1.13
+// +build go1.13
+
+package arrival
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/christianrpetrin/queue-tests/faaqueue"
+	"github.com/christianrpetrin/queue-tests/fcqueue"
+	"github.com/christianrpetrin/queue-tests/lockfreequeue"
+	"github.com/christianrpetrin/queue-tests/safequeue"
+)
+
+var (
+	// benchQueues holds the concurrent queues probed by the benchmark tests.
+	benchQueues = []struct {
+		name string
+		new  func() Queue
+	}{
+		{name: "SafeQueue", new: func() Queue { return safequeue.New() }},
+		{name: "LockFree", new: func() Queue { return lockfreequeue.New() }},
+		{name: "FetchAndAdd", new: func() Queue { return faaqueue.New() }},
+		{name: "FlatCombining", new: func() Queue { return fcqueue.New() }},
+	}
+
+	// benchPatterns holds the arrival patterns probed by the benchmark tests.
+	// Each pattern is created once per run, so all runs push the same bursts.
+	benchPatterns = []struct {
+		name string
+		new  func() Pattern
+	}{
+		{name: "Poisson", new: func() Pattern { return Poisson(1000, 500*time.Microsecond, 1) }},
+		{name: "OnOff", new: func() Pattern { return OnOff(5, 2000, 0, 2*time.Millisecond) }},
+	}
+
+	// benchConsumers holds the number of consumer goroutines probed by the benchmark tests.
+	benchConsumers = []int{1, 4}
+)
+
+// BenchmarkBursty probes each queue with bursty arrival patterns and concurrent consumers,
+// reporting the largest queue length in the maxlen metric, and the mean and largest burst
+// drain time in the drain-ns and maxdrain-ns metrics, averaged over all runs.
+// Each run pushes 20 bursts.
+func BenchmarkBursty(b *testing.B) {
+	for _, p := range benchPatterns {
+		for _, q := range benchQueues {
+			for _, consumers := range benchConsumers {
+				p, q, consumers := p, q, consumers
+				b.Run(p.name+"/"+q.name+"/"+strconv.Itoa(consumers), func(b *testing.B) {
+					b.ReportAllocs()
+					var maxLen int
+					var drain, maxDrain time.Duration
+					for n := 0; n < b.N; n++ {
+						r := Run(q.new(), p.new(), Options{Bursts: 20, Consumers: consumers})
+						maxLen += r.MaxLen
+						drain += r.MeanDrain
+						maxDrain += r.MaxDrain
+					}
+					b.ReportMetric(float64(maxLen)/float64(b.N), "maxlen")
+					b.ReportMetric(float64(drain.Nanoseconds())/float64(b.N), "drain-ns")
+					b.ReportMetric(float64(maxDrain.Nanoseconds())/float64(b.N), "maxdrain-ns")
+				})
+			}
+		}
+	}
+}
@@ -61,7 +61,11 @@ var (
 func BenchmarkList(b *testing.B) {
 	for _, test := range tests {
 		b.Run(strconv.Itoa(test.count), func(b *testing.B) {
+			p := startPhases(b)
+			defer p.end()
+
 			for n := 0; n < b.N; n++ {
+				p.phase("push")
 				l := list.New()
 
 				for i := 0; i < test.count; i++ {
@@ -71,6 +75,7 @@ func BenchmarkList(b *testing.B) {
 						l.Remove(l.Front())
 					}
 				}
+				p.phase("pop")
 				for e := l.Front(); e != nil; e = e.Next() {
 					tmp = e.Value
 				}
@@ -84,12 +89,17 @@ func BenchmarkChannel(b *testing.B) {
 		// Only run the first 8 tests for channel as it is bounded and don't support very large channel sizes.
 		if i <= 8 {
 			b.Run(strconv.Itoa(test.count), func(b *testing.B) {
+				p := startPhases(b)
+				defer p.end()
+
 				for n := 0; n < b.N; n++ {
+					p.phase("push")
 					c := make(chan int, test.count)
 
 					for i := 0; i < test.count; i++ {
 						c <- i
 					}
+					p.phase("pop")
 					for i := 0; i < test.count; i++ {
 						tmp = <-c
 					}
@@ -102,7 +112,11 @@ func BenchmarkChannel(b *testing.B) {
 func BenchmarkGammazero(b *testing.B) {
 	for _, test := range tests {
 		b.Run(strconv.Itoa(test.count), func(b *testing.B) {
+			p := startPhases(b)
+			defer p.end()
+
 			for n := 0; n < b.N; n++ {
+				p.phase("push")
 				var q gammazero.Deque
 
 				for i := 0; i < test.count; i++ {
@@ -112,6 +126,7 @@ func BenchmarkGammazero(b *testing.B) {
 						tmp = q.PopFront()
 					}
 				}
+				p.phase("pop")
 				for q.Len() > 0 {
 					tmp = q.PopFront()
 				}
@@ -123,7 +138,11 @@ func BenchmarkGammazero(b *testing.B) {
 func BenchmarkPhf(b *testing.B) {
 	for _, test := range tests {
 		b.Run(strconv.Itoa(test.count), func(b *testing.B) {
+			p := startPhases(b)
+			defer p.end()
+
 			for n := 0; n < b.N; n++ {
+				p.phase("push")
 				q := phf.New()
 
 				for i := 0; i < test.count; i++ {
@@ -133,6 +152,7 @@ func BenchmarkPhf(b *testing.B) {
 						tmp = q.PopFront()
 					}
 				}
+				p.phase("pop")
 				for q.Len() > 0 {
 					tmp = q.PopFront()
 				}
@@ -144,7 +164,11 @@ func BenchmarkPhf(b *testing.B) {
 func BenchmarkJuju(b *testing.B) {
 	for _, test := range tests {
 		b.Run(strconv.Itoa(test.count), func(b *testing.B) {
+			p := startPhases(b)
+			defer p.end()
+
 			for n := 0; n < b.N; n++ {
+				p.phase("push")
 				q := juju.New()
 
 				for i := 0; i < test.count; i++ {
@@ -154,6 +178,7 @@ func BenchmarkJuju(b *testing.B) {
 						tmp, tmp2 = q.PopFront()
 					}
 				}
+				p.phase("pop")
 				for q.Len() > 0 {
 					tmp, tmp2 = q.PopFront()
 				}
@@ -165,7 +190,11 @@ func BenchmarkJuju(b *testing.B) {
 func BenchmarkImpl1(b *testing.B) {
 	for _, test := range tests {
 		b.Run(strconv.Itoa(test.count), func(b *testing.B) {
+			p := startPhases(b)
+			defer p.end()
+
 			for n := 0; n < b.N; n++ {
+				p.phase("push")
 				q := queueimpl1.New()
 
 				for i := 0; i < test.count; i++ {
@@ -175,6 +204,7 @@ func BenchmarkImpl1(b *testing.B) {
 						tmp, tmp2 = q.Pop()
 					}
 				}
+				p.phase("pop")
 				for q.Len() > 0 {
 					tmp, tmp2 = q.Pop()
 				}
@@ -185,7 +215,11 @@ func BenchmarkImpl1(b *testing.B) {
 func BenchmarkImpl2(b *testing.B) {
 	for _, test := range tests {
 		b.Run(strconv.Itoa(test.count), func(b *testing.B) {
+			p := startPhases(b)
+			defer p.end()
+
 			for n := 0; n < b.N; n++ {
+				p.phase("push")
 				q := queueimpl2.New()
 
 				for i := 0; i < test.count; i++ {
@@ -195,6 +229,7 @@ func BenchmarkImpl2(b *testing.B) {
 						tmp, tmp2 = q.Pop()
 					}
 				}
+				p.phase("pop")
 				for q.Len() > 0 {
 					tmp, tmp2 = q.Pop()
 				}
@@ -206,7 +241,11 @@ func BenchmarkImpl2(b *testing.B) {
 func BenchmarkImpl3(b *testing.B) {
 	for _, test := range tests {
 		b.Run(strconv.Itoa(test.count), func(b *testing.B) {
+			p := startPhases(b)
+			defer p.end()
+
 			for n := 0; n < b.N; n++ {
+				p.phase("push")
 				q := queueimpl3.New()
 
 				for i := 0; i < test.count; i++ {
@@ -216,6 +255,7 @@ func BenchmarkImpl3(b *testing.B) {
 						tmp, tmp2 = q.Pop()
 					}
 				}
+				p.phase("pop")
 				for q.Len() > 0 {
 					tmp, tmp2 = q.Pop()
 				}
@@ -227,7 +267,11 @@ func BenchmarkImpl3(b *testing.B) {
 func BenchmarkImpl4(b *testing.B) {
 	for _, test := range tests {
 		b.Run(strconv.Itoa(test.count), func(b *testing.B) {
+			p := startPhases(b)
+			defer p.end()
+
 			for n := 0; n < b.N; n++ {
+				p.phase("push")
 				q := queueimpl4.New()
 
 				for i := 0; i < test.count; i++ {
@@ -237,6 +281,7 @@ func BenchmarkImpl4(b *testing.B) {
 						tmp, tmp2 = q.Pop()
 					}
 				}
+				p.phase("pop")
 				for q.Len() > 0 {
 					tmp, tmp2 = q.Pop()
 				}
@@ -248,7 +293,11 @@ func BenchmarkImpl4(b *testing.B) {
 func BenchmarkImpl5(b *testing.B) {
 	for _, test := range tests {
 		b.Run(strconv.Itoa(test.count), func(b *testing.B) {
+			p := startPhases(b)
+			defer p.end()
+
 			for n := 0; n < b.N; n++ {
+				p.phase("push")
 				q := queueimpl5.New()
 
 				for i := 0; i < test.count; i++ {
@@ -258,6 +307,7 @@ func BenchmarkImpl5(b *testing.B) {
 						tmp, tmp2 = q.Pop()
 					}
 				}
+				p.phase("pop")
 				for q.Len() > 0 {
 					tmp, tmp2 = q.Pop()
 				}
@@ -269,7 +319,11 @@ func BenchmarkImpl5(b *testing.B) {
 func BenchmarkImpl6(b *testing.B) {
 	for _, test := range tests {
 		b.Run(strconv.Itoa(test.count), func(b *testing.B) {
+			p := startPhases(b)
+			defer p.end()
+
 			for n := 0; n < b.N; n++ {
+				p.phase("push")
 				q := queueimpl6.New()
 
 				for i := 0; i < test.count; i++ {
@@ -279,6 +333,7 @@ func BenchmarkImpl6(b *testing.B) {
 						tmp, tmp2 = q.Pop()
 					}
 				}
+				p.phase("pop")
 				for q.Len() > 0 {
 					tmp, tmp2 = q.Pop()
 				}
@@ -290,7 +345,11 @@ func BenchmarkImpl6(b *testing.B) {
 func BenchmarkImpl7(b *testing.B) {
 	for _, test := range tests {
 		b.Run(strconv.Itoa(test.count), func(b *testing.B) {
+			p := startPhases(b)
+			defer p.end()
+
 			for n := 0; n < b.N; n++ {
+				p.phase("push")
 				q := queueimpl7.New()
 
 				for i := 0; i < test.count; i++ {
@@ -300,6 +359,7 @@ func BenchmarkImpl7(b *testing.B) {
 						tmp, tmp2 = q.Pop()
 					}
 				}
+				p.phase("pop")
 				for q.Len() > 0 {
 					tmp, tmp2 = q.Pop()
 				}
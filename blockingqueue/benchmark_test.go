@@ -0,0 +1,55 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package blockingqueue
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/christianrpetrin/queue-tests/lockfreequeue"
+)
+
+// benchStrategies holds the wait strategies probed by the benchmark tests, in order.
+var benchStrategies = []string{"BusySpin", "SpinThenYield", "SpinThenPark", "Park"}
+
+// BenchmarkWaitStrategyThroughput probes a single producer pushing b.N values to a single
+// consumer, using each wait strategy.
+func BenchmarkWaitStrategyThroughput(b *testing.B) {
+	for _, name := range benchStrategies {
+		s := strategies[name]
+		b.Run(name, func(b *testing.B) {
+			q := New(lockfreequeue.New(), s)
+			var wg sync.WaitGroup
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for n := 0; n < b.N; n++ {
+					q.Push(n)
+				}
+			}()
+			for n := 0; n < b.N; n++ {
+				q.Pop(context.Background())
+			}
+			wg.Wait()
+		})
+	}
+}
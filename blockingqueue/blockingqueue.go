@@ -0,0 +1,391 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package blockingqueue implements a blocking FIFO queue on top of any of the concurrent queues,
+// with a configurable wait strategy, similar to the LMAX Disruptor wait strategies.
+// Internally, consumers finding the queue empty first busy-spin checking it again, then yield
+// the processor between checks, and finally park until a producer pushes a value; each of these
+// phases is optional, so latency sensitive users can spin while throughput users can park right away.
+// Producers only wake up parked consumers when there is any, so pushing to a queue whose consumers
+// are not parked costs a single atomic load on top of the underlying queue push.
+// Closing the queue wakes up all consumers, which drain the remaining values and then fail
+// with queueerr.ErrClosed; DrainAndClose closes the queue and waits for consumers to drain it.
+// Pausing the queue stops delivering values to consumers, which wait until the queue is
+// resumed, while producers keep pushing values.
+package blockingqueue
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"sync/atomic"
+
+	"github.com/christianrpetrin/queue-tests/queueerr"
+)
+
+// Queue is the concurrent queue the values are stored in, such as safequeue.SafeQueue,
+// lockfreequeue.LockFreeQueue, fcqueue.FCQueue or faaqueue.FAAQueue.
+// Queue must be safe for concurrent use by multiple goroutines.
+type Queue interface {
+	// Push adds a value to the queue.
+	Push(v interface{})
+
+	// Pop retrieves and removes the next value from the queue.
+	Pop() (interface{}, bool)
+}
+
+// WaitStrategy configures how consumers wait for values while the queue is empty.
+// Consumers first busy-spin, then yield, then park; a phase with a limit of 0 is skipped,
+// and a phase with a negative limit never ends, so the following phases are never reached.
+type WaitStrategy struct {
+	// Spins holds the number of times a consumer checks the queue again right away.
+	Spins int
+
+	// Yields holds the number of times a consumer yields the processor, using
+	// runtime.Gosched, before checking the queue again.
+	Yields int
+}
+
+var (
+	// BusySpin makes consumers check the queue in a tight loop, keeping a processor busy
+	// while waiting. It has the lowest latency, but is only suitable when there are at
+	// least as many processors as busy goroutines.
+	BusySpin = WaitStrategy{Spins: -1}
+
+	// SpinThenYield makes consumers spin for a short while and then yield the processor
+	// between checks, trading some latency for letting other goroutines run.
+	SpinThenYield = WaitStrategy{Spins: 100, Yields: -1}
+
+	// SpinThenPark makes consumers spin and yield for a short while and then park until a
+	// value is pushed, so short waits are cheap and long waits don't use any processor.
+	SpinThenPark = WaitStrategy{Spins: 100, Yields: 10}
+
+	// Park makes consumers park right away, which has the highest latency but the lowest
+	// processor usage, and maximizes the producers throughput.
+	Park = WaitStrategy{}
+)
+
+// BlockingQueue represents an unbounded FIFO queue whose Pop blocks while the queue is empty.
+// BlockingQueue is safe for concurrent use by multiple producers and consumers.
+// The zero value for queue is not ready to use; use New to create a queue.
+type BlockingQueue struct {
+	// len holds the number of values pushed and not popped yet.
+	// Kept as the first field to guarantee its 64-bit alignment.
+	len int64
+
+	// parked holds the number of consumers that are, or are about to be, parked.
+	parked int32
+
+	// closed is 1 once the queue was closed; 0 otherwise.
+	closed int32
+
+	// paused is 1 while the queue is paused; 0 otherwise.
+	paused int32
+
+	// q holds the values.
+	q Queue
+
+	// s holds the wait strategy.
+	s WaitStrategy
+
+	// wake is used to wake up a parked consumer. It has a buffer of 1, so a producer
+	// never blocks; a consumer woken up passes the wake up on to the next parked one.
+	wake chan struct{}
+
+	// done is closed once the queue is closed, waking up all parked consumers.
+	done chan struct{}
+
+	// closeOnce guards closing done.
+	closeOnce sync.Once
+
+	// drained is closed once the queue is closed and all its values were popped.
+	drained chan struct{}
+
+	// drainOnce guards closing drained.
+	drainOnce sync.Once
+
+	// pauseMu guards resumed and serializes the paused updates.
+	pauseMu sync.Mutex
+
+	// resumed is closed once the paused queue is resumed, waking up the waiting consumers;
+	// it is nil while the queue is not paused.
+	resumed chan struct{}
+}
+
+// testHookPark, if not nil, is called by parking consumers between checking whether the queue
+// is paused and popping, so tests can pause the queue in between.
+var testHookPark func()
+
+// New returns a blocking queue storing the values in q, whose consumers wait using strategy s.
+// Queue q must not be used directly afterwards, as parked consumers are only woken up by
+// values pushed using the returned queue.
+func New(q Queue, s WaitStrategy) *BlockingQueue {
+	return &BlockingQueue{
+		q:       q,
+		s:       s,
+		wake:    make(chan struct{}, 1),
+		done:    make(chan struct{}),
+		drained: make(chan struct{}),
+	}
+}
+
+// Close closes the queue, waking up all waiting consumers. Consumers still pop the values
+// pushed before Close, and then fail with queueerr.ErrClosed.
+// Close may be called multiple times, but Push must not be called concurrently with or after it.
+func (q *BlockingQueue) Close() {
+	q.closeOnce.Do(func() {
+		atomic.StoreInt32(&q.closed, 1)
+		close(q.done)
+	})
+}
+
+// DrainAndClose closes the queue and waits until consumers popped all the values pushed
+// before, or ctx is done. It returns the number of values abandoned in the queue, i.e. not
+// popped yet when ctx is done, and ctx.Err() if any value was abandoned.
+// DrainAndClose may be called multiple times, but Push must not be called concurrently
+// with or after it.
+func (q *BlockingQueue) DrainAndClose(ctx context.Context) (int, error) {
+	q.Close()
+
+	// Consumers only signal the queue is drained if it was closed already when they popped the
+	// last value, so check whether the queue was drained before Close.
+	if q.Len() == 0 {
+		return 0, nil
+	}
+	select {
+	case <-q.drained:
+		return 0, nil
+	case <-ctx.Done():
+		if n := q.Len(); n > 0 {
+			return n, ctx.Err()
+		}
+		return 0, nil
+	}
+}
+
+// Len returns the number of values pushed to the queue and not popped yet.
+// The complexity is O(1).
+func (q *BlockingQueue) Len() int {
+	return int(atomic.LoadInt64(&q.len))
+}
+
+// Pause pauses the queue: consumers stop retrieving values and Pop waits until the queue is
+// resumed, even if the queue is closed, while producers keep pushing values.
+// A consumer that already retrieved a value when Pause is called still returns it.
+// Pausing a paused queue has no effect.
+func (q *BlockingQueue) Pause() {
+	q.pauseMu.Lock()
+	defer q.pauseMu.Unlock()
+	if q.resumed == nil {
+		q.resumed = make(chan struct{})
+		atomic.StoreInt32(&q.paused, 1)
+	}
+}
+
+// Resume resumes the paused queue, waking up the consumers waiting for it.
+// Resuming a queue that is not paused has no effect.
+func (q *BlockingQueue) Resume() {
+	q.pauseMu.Lock()
+	defer q.pauseMu.Unlock()
+	if q.resumed != nil {
+		atomic.StoreInt32(&q.paused, 0)
+		close(q.resumed)
+		q.resumed = nil
+
+		// A consumer that found the queue not paused, but then failed to pop because it was
+		// paused in between, waits on wake rather than on resumed.
+		if atomic.LoadInt32(&q.parked) > 0 {
+			q.signal()
+		}
+	}
+}
+
+// Paused returns whether the queue is paused.
+func (q *BlockingQueue) Paused() bool {
+	return atomic.LoadInt32(&q.paused) != 0
+}
+
+// Push adds a value to the queue, waking up a parked consumer, if any.
+// Push panics if the queue was closed; use PushE to get an error instead.
+// The complexity is the same as the underlying queue Push.
+func (q *BlockingQueue) Push(v interface{}) {
+	if err := q.PushE(v); err != nil {
+		panic("blockingqueue: push to a closed queue")
+	}
+}
+
+// PushE adds a value to the queue, waking up a parked consumer, if any.
+// It is the same as Push, but returns queueerr.ErrClosed if the queue was closed.
+// The complexity is the same as the underlying queue Push.
+func (q *BlockingQueue) PushE(v interface{}) error {
+	if atomic.LoadInt32(&q.closed) != 0 {
+		return queueerr.ErrClosed
+	}
+	// The length is increased before pushing, so it never goes below 0 while consumers pop the value.
+	atomic.AddInt64(&q.len, 1)
+	q.q.Push(v)
+	if atomic.LoadInt32(&q.parked) > 0 {
+		q.signal()
+	}
+	return nil
+}
+
+// TryPop retrieves and removes the next element from the queue without blocking.
+// The second, bool result indicates whether a valid value was returned;
+//   if the queue is empty or paused, false will be returned.
+// The complexity is the same as the underlying queue Pop.
+func (q *BlockingQueue) TryPop() (interface{}, bool) {
+	if q.Paused() {
+		return nil, false
+	}
+	return q.pop()
+}
+
+// PopE retrieves and removes the next element from the queue without blocking.
+// It returns queueerr.ErrClosed if the queue is empty and closed, or queueerr.ErrEmpty if
+// the queue is empty but still open, or paused.
+// The complexity is the same as the underlying queue Pop.
+func (q *BlockingQueue) PopE() (interface{}, error) {
+	if q.Paused() {
+		return nil, queueerr.ErrEmpty
+	}
+	if v, ok := q.pop(); ok {
+		return v, nil
+	}
+	if atomic.LoadInt32(&q.closed) == 0 {
+		return nil, queueerr.ErrEmpty
+	}
+
+	// Values pushed before Close may not have been visible to the first pop, so retry once
+	// now that no more values can be pushed.
+	if v, ok := q.pop(); ok {
+		return v, nil
+	}
+	return nil, queueerr.ErrClosed
+}
+
+// Pop retrieves and removes the next element from the queue, waiting according to the
+// queue wait strategy while it is empty, until a value is available, the queue is closed,
+// in which case queueerr.ErrClosed is returned, or ctx is done, in which case ctx.Err()
+// is returned. While the queue is paused, Pop waits for it to be resumed.
+// The complexity is the same as the underlying queue Pop, not counting the wait.
+func (q *BlockingQueue) Pop(ctx context.Context) (interface{}, error) {
+	if v, err := q.PopE(); err != queueerr.ErrEmpty {
+		return v, err
+	}
+
+	for i := 0; q.s.Spins < 0 || i < q.s.Spins; i++ {
+		if v, err := q.PopE(); err != queueerr.ErrEmpty {
+			return v, err
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+	}
+	for i := 0; q.s.Yields < 0 || i < q.s.Yields; i++ {
+		runtime.Gosched()
+		if v, err := q.PopE(); err != queueerr.ErrEmpty {
+			return v, err
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return q.park(ctx)
+}
+
+// park blocks until a value is available, the queue is closed or ctx is done, waiting
+// for the queue to be resumed while it is paused.
+func (q *BlockingQueue) park(ctx context.Context) (interface{}, error) {
+	// Announce the consumer is about to park and check the queue again, so a
+	// value pushed before the announcement is not missed.
+	atomic.AddInt32(&q.parked, 1)
+	defer atomic.AddInt32(&q.parked, -1)
+
+	for {
+		if r := q.resumedChan(); r != nil {
+			select {
+			case <-r:
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+			continue
+		}
+
+		if testHookPark != nil {
+			testHookPark()
+		}
+		if v, err := q.PopE(); err != queueerr.ErrEmpty {
+			if err == nil {
+				q.passOn()
+			}
+			return v, err
+		}
+
+		select {
+		case <-q.wake:
+		case <-q.done:
+		case <-ctx.Done():
+			if v, ok := q.TryPop(); ok {
+				q.passOn()
+				return v, nil
+			}
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// pop retrieves and removes the next element from the underlying queue, signaling the queue
+// was drained if it is closed and the popped value was the last one.
+func (q *BlockingQueue) pop() (interface{}, bool) {
+	v, ok := q.q.Pop()
+	if ok && atomic.AddInt64(&q.len, -1) == 0 && atomic.LoadInt32(&q.closed) != 0 {
+		q.drainOnce.Do(func() { close(q.drained) })
+	}
+	return v, ok
+}
+
+// resumedChan returns the channel closed once the queue is resumed, or nil if the queue is not paused.
+func (q *BlockingQueue) resumedChan() chan struct{} {
+	if !q.Paused() {
+		return nil
+	}
+	q.pauseMu.Lock()
+	defer q.pauseMu.Unlock()
+	return q.resumed
+}
+
+// passOn wakes up another parked consumer, if any, after a parked consumer popped a value.
+// The single buffered wake up may stand for multiple values pushed while consumers were
+// parked, so it is passed on to make sure no consumer stays parked while values are available.
+func (q *BlockingQueue) passOn() {
+	// The consumer calling passOn is still counted as parked.
+	if atomic.LoadInt32(&q.parked) > 1 {
+		q.signal()
+	}
+}
+
+// signal wakes up a parked consumer, unless a wake up is already pending.
+func (q *BlockingQueue) signal() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
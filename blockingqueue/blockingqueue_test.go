@@ -0,0 +1,412 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package blockingqueue
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/christianrpetrin/queue-tests/lockfreequeue"
+	"github.com/christianrpetrin/queue-tests/queueerr"
+	"github.com/christianrpetrin/queue-tests/safequeue"
+)
+
+const (
+	// concurrentCount holds the number of values pushed by each goroutine in the concurrent tests.
+	concurrentCount = 10000
+
+	// goroutines holds the number of producer and consumer goroutines in the concurrent tests.
+	goroutines = 4
+)
+
+// strategies holds the wait strategies probed by the tests.
+var strategies = map[string]WaitStrategy{
+	"BusySpin":      BusySpin,
+	"SpinThenYield": SpinThenYield,
+	"SpinThenPark":  SpinThenPark,
+	"Park":          Park,
+}
+
+func TestBlockingQueuePopShouldReturnPushedValuesInOrder(t *testing.T) {
+	for name, s := range strategies {
+		q := New(lockfreequeue.New(), s)
+		for i := 0; i < 10; i++ {
+			q.Push(i)
+		}
+		for i := 0; i < 10; i++ {
+			v, err := q.Pop(context.Background())
+			if err != nil || v != i {
+				t.Errorf("%s: Expected: %d; Got: %v, %v", name, i, v, err)
+			}
+		}
+		if v, ok := q.TryPop(); ok {
+			t.Errorf("%s: Expected: empty queue; Got: %v", name, v)
+		}
+	}
+}
+
+func TestBlockingQueuePopShouldWaitForPushedValue(t *testing.T) {
+	for name, s := range strategies {
+		q := New(safequeue.New(), s)
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			q.Push(1)
+		}()
+
+		v, err := q.Pop(context.Background())
+		if err != nil || v != 1 {
+			t.Errorf("%s: Expected: %d; Got: %v, %v", name, 1, v, err)
+		}
+	}
+}
+
+func TestBlockingQueuePopShouldReturnContextErrorWhenDone(t *testing.T) {
+	for name, s := range strategies {
+		q := New(lockfreequeue.New(), s)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		v, err := q.Pop(ctx)
+		cancel()
+		if err != context.DeadlineExceeded || v != nil {
+			t.Errorf("%s: Expected: %v; Got: %v, %v", name, context.DeadlineExceeded, v, err)
+		}
+		if p := atomic.LoadInt32(&q.parked); p != 0 {
+			t.Errorf("%s: Expected: %d parked consumers; Got: %d", name, 0, p)
+		}
+	}
+}
+
+func TestBlockingQueueConcurrentPushPopShouldRetrieveAllElements(t *testing.T) {
+	for _, name := range []string{"SpinThenPark", "Park"} {
+		q := New(lockfreequeue.New(), strategies[name])
+		var wg sync.WaitGroup
+		for p := 0; p < goroutines; p++ {
+			wg.Add(1)
+			go func(p int) {
+				defer wg.Done()
+				for i := 0; i < concurrentCount; i++ {
+					q.Push(p*concurrentCount + i)
+				}
+			}(p)
+		}
+
+		seen := make([]bool, goroutines*concurrentCount)
+		var mu sync.Mutex
+		for c := 0; c < goroutines; c++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := 0; i < concurrentCount; i++ {
+					v, err := q.Pop(context.Background())
+					if err != nil {
+						t.Errorf("%s: Expected: no error; Got: %v", name, err)
+						return
+					}
+					mu.Lock()
+					if seen[v.(int)] {
+						t.Errorf("%s: Expected: %d to be popped once; Got: popped twice", name, v)
+					}
+					seen[v.(int)] = true
+					mu.Unlock()
+				}
+			}()
+		}
+		wg.Wait()
+
+		for i, s := range seen {
+			if !s {
+				t.Errorf("%s: Expected: %d to be popped; Got: not popped", name, i)
+			}
+		}
+	}
+}
+
+func TestBlockingQueueParkedConsumersShouldAllBeWokenUp(t *testing.T) {
+	q := New(lockfreequeue.New(), Park)
+	var wg sync.WaitGroup
+	for c := 0; c < goroutines; c++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := q.Pop(context.Background()); err != nil {
+				t.Errorf("Expected: no error; Got: %v", err)
+			}
+		}()
+	}
+	for atomic.LoadInt32(&q.parked) < goroutines {
+		time.Sleep(time.Millisecond)
+	}
+
+	// A burst of values pushed while all consumers are parked must wake all of them up.
+	for i := 0; i < goroutines; i++ {
+		q.Push(i)
+	}
+	wg.Wait()
+}
+
+func TestBlockingQueuePopEShouldReturnErrEmptyWhenEmpty(t *testing.T) {
+	q := New(lockfreequeue.New(), Park)
+	q.Push(1)
+
+	if v, err := q.PopE(); err != nil || v != 1 {
+		t.Errorf("Expected: %d; Got: %v, %v", 1, v, err)
+	}
+	if v, err := q.PopE(); err != queueerr.ErrEmpty || v != nil {
+		t.Errorf("Expected: %v; Got: %v, %v", queueerr.ErrEmpty, v, err)
+	}
+}
+
+func TestBlockingQueueCloseShouldDrainValuesThenReturnErrClosed(t *testing.T) {
+	for name, s := range strategies {
+		q := New(lockfreequeue.New(), s)
+		q.Push(1)
+		q.Close()
+		q.Close()
+
+		if v, err := q.Pop(context.Background()); err != nil || v != 1 {
+			t.Errorf("%s: Expected: %d; Got: %v, %v", name, 1, v, err)
+		}
+		if v, err := q.Pop(context.Background()); err != queueerr.ErrClosed || v != nil {
+			t.Errorf("%s: Expected: %v; Got: %v, %v", name, queueerr.ErrClosed, v, err)
+		}
+		if v, err := q.PopE(); err != queueerr.ErrClosed || v != nil {
+			t.Errorf("%s: Expected: %v; Got: %v, %v", name, queueerr.ErrClosed, v, err)
+		}
+	}
+}
+
+func TestBlockingQueuePushEAfterCloseShouldReturnErrClosed(t *testing.T) {
+	for name, s := range strategies {
+		q := New(lockfreequeue.New(), s)
+		if err := q.PushE(1); err != nil {
+			t.Errorf("%s: Expected: %v; Got: %v", name, nil, err)
+		}
+		q.Close()
+
+		if err := q.PushE(2); err != queueerr.ErrClosed {
+			t.Errorf("%s: Expected: %v; Got: %v", name, queueerr.ErrClosed, err)
+		}
+		if v, err := q.Pop(context.Background()); err != nil || v != 1 {
+			t.Errorf("%s: Expected: %d; Got: %v, %v", name, 1, v, err)
+		}
+		if v, err := q.Pop(context.Background()); err != queueerr.ErrClosed || v != nil {
+			t.Errorf("%s: Expected: %v; Got: %v, %v", name, queueerr.ErrClosed, v, err)
+		}
+	}
+}
+
+func TestBlockingQueueCloseShouldWakeUpAllWaitingConsumers(t *testing.T) {
+	for name, s := range strategies {
+		q := New(safequeue.New(), s)
+		var wg sync.WaitGroup
+		errs := make(chan error, goroutines)
+		for i := 0; i < goroutines; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := q.Pop(context.Background())
+				errs <- err
+			}()
+		}
+
+		time.Sleep(10 * time.Millisecond)
+		q.Close()
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			if err != queueerr.ErrClosed {
+				t.Errorf("%s: Expected: %v; Got: %v", name, queueerr.ErrClosed, err)
+			}
+		}
+	}
+}
+
+func TestBlockingQueueDrainAndCloseShouldWaitForConsumersToDrainQueue(t *testing.T) {
+	for name, s := range strategies {
+		q := New(lockfreequeue.New(), s)
+		for i := 0; i < concurrentCount; i++ {
+			q.Push(i)
+		}
+		if l := q.Len(); l != concurrentCount {
+			t.Errorf("%s: Expected: %d; Got: %d", name, concurrentCount, l)
+		}
+
+		var wg sync.WaitGroup
+		for i := 0; i < goroutines; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for {
+					if _, err := q.Pop(context.Background()); err != nil {
+						return
+					}
+				}
+			}()
+		}
+
+		if n, err := q.DrainAndClose(context.Background()); n != 0 || err != nil {
+			t.Errorf("%s: Expected: %d, %v; Got: %d, %v", name, 0, nil, n, err)
+		}
+		if l := q.Len(); l != 0 {
+			t.Errorf("%s: Expected: %d; Got: %d", name, 0, l)
+		}
+		wg.Wait()
+	}
+}
+
+func TestBlockingQueueDrainAndCloseShouldReportAbandonedValuesWhenContextIsDone(t *testing.T) {
+	q := New(safequeue.New(), Park)
+	q.Push(1)
+	q.Push(2)
+	if v, err := q.Pop(context.Background()); err != nil || v != 1 {
+		t.Errorf("Expected: %d; Got: %v, %v", 1, v, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if n, err := q.DrainAndClose(ctx); n != 1 || err != context.DeadlineExceeded {
+		t.Errorf("Expected: %d, %v; Got: %d, %v", 1, context.DeadlineExceeded, n, err)
+	}
+
+	// The abandoned values can still be popped.
+	if v, err := q.Pop(context.Background()); err != nil || v != 2 {
+		t.Errorf("Expected: %d; Got: %v, %v", 2, v, err)
+	}
+	if n, err := q.DrainAndClose(ctx); n != 0 || err != nil {
+		t.Errorf("Expected: %d, %v; Got: %d, %v", 0, nil, n, err)
+	}
+}
+
+func TestBlockingQueuePushAfterCloseShouldPanic(t *testing.T) {
+	q := New(lockfreequeue.New(), Park)
+	q.Close()
+
+	defer func() {
+		if r := recover(); r == nil {
+			t.Error("Expected: panic; Got: no panic")
+		}
+	}()
+	q.Push(1)
+}
+
+func TestBlockingQueuePauseShouldHoldConsumersUntilResumed(t *testing.T) {
+	for name, s := range strategies {
+		if s.Spins < 0 {
+			// Busy spinning consumers never wait, so they keep spinning while paused.
+			continue
+		}
+		q := New(lockfreequeue.New(), s)
+		q.Pause()
+		q.Pause()
+		if !q.Paused() {
+			t.Errorf("%s: Expected: paused; Got: not paused", name)
+		}
+
+		popped := make(chan interface{}, goroutines)
+		for i := 0; i < goroutines; i++ {
+			go func() {
+				v, _ := q.Pop(context.Background())
+				popped <- v
+			}()
+		}
+		for i := 0; i < goroutines; i++ {
+			q.Push(i)
+		}
+		if v, ok := q.TryPop(); ok {
+			t.Errorf("%s: Expected: no value while paused; Got: %v", name, v)
+		}
+		if v, err := q.PopE(); err != queueerr.ErrEmpty {
+			t.Errorf("%s: Expected: %v; Got: %v, %v", name, queueerr.ErrEmpty, v, err)
+		}
+		select {
+		case v := <-popped:
+			t.Errorf("%s: Expected: no value while paused; Got: %v", name, v)
+		case <-time.After(10 * time.Millisecond):
+		}
+
+		q.Resume()
+		q.Resume()
+		if q.Paused() {
+			t.Errorf("%s: Expected: not paused; Got: paused", name)
+		}
+		seen := make(map[interface{}]bool)
+		for i := 0; i < goroutines; i++ {
+			seen[<-popped] = true
+		}
+		if len(seen) != goroutines {
+			t.Errorf("%s: Expected: %d values; Got: %v", name, goroutines, seen)
+		}
+	}
+}
+
+func TestBlockingQueueResumeShouldWakeUpConsumerPausedBeforePopping(t *testing.T) {
+	q := New(lockfreequeue.New(), Park)
+	q.Push(1)
+	q.Pause()
+
+	// The queue is paused again right after the parked consumer found it resumed.
+	paused := make(chan struct{})
+	var once sync.Once
+	testHookPark = func() {
+		once.Do(func() {
+			q.Pause()
+			close(paused)
+		})
+	}
+	defer func() { testHookPark = nil }()
+
+	popped := make(chan interface{}, 1)
+	go func() {
+		v, _ := q.Pop(context.Background())
+		popped <- v
+	}()
+	for atomic.LoadInt32(&q.parked) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	q.Resume()
+	<-paused
+
+	// Let the consumer fail to pop and wait to be woken up, then resume the queue again.
+	time.Sleep(10 * time.Millisecond)
+	q.Resume()
+	select {
+	case v := <-popped:
+		if v != 1 {
+			t.Errorf("Expected: %d; Got: %v", 1, v)
+		}
+	case <-time.After(time.Second):
+		t.Error("Expected: consumer woken up by Resume; Got: consumer still parked")
+	}
+}
+
+func TestBlockingQueuePausedPopShouldReturnContextErrorWhenDone(t *testing.T) {
+	q := New(lockfreequeue.New(), SpinThenPark)
+	q.Push(1)
+	q.Pause()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if v, err := q.Pop(ctx); err != context.DeadlineExceeded || v != nil {
+		t.Errorf("Expected: %v; Got: %v, %v", context.DeadlineExceeded, v, err)
+	}
+}
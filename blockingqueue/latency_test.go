@@ -0,0 +1,60 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+//go:build go1.13
+// +build go1.13
+
+package blockingqueue
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/christianrpetrin/queue-tests/lockfreequeue"
+)
+
+// BenchmarkWaitStrategyLatency probes the average time a value spends between being pushed
+// to an empty queue and being popped by a waiting consumer, using each wait strategy.
+// The latency is reported in the latency-ns/op metric.
+func BenchmarkWaitStrategyLatency(b *testing.B) {
+	for _, name := range benchStrategies {
+		s := strategies[name]
+		b.Run(name, func(b *testing.B) {
+			q := New(lockfreequeue.New(), s)
+			done := make(chan struct{})
+			var total time.Duration
+			go func() {
+				defer close(done)
+				for n := 0; n < b.N; n++ {
+					v, _ := q.Pop(context.Background())
+					total += time.Since(v.(time.Time))
+				}
+			}()
+			for n := 0; n < b.N; n++ {
+				// Give the consumer time to start waiting.
+				time.Sleep(10 * time.Microsecond)
+				q.Push(time.Now())
+			}
+			<-done
+			b.ReportMetric(float64(total.Nanoseconds())/float64(b.N), "latency-ns/op")
+		})
+	}
+}
@@ -0,0 +1,320 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package broadcast implements an unbounded, dynamically growing broadcast (fan-out) FIFO queue,
+// where every subscriber receives every value pushed after it subscribed.
+// Internally, queue store the values in fixed sized slices that are linked using a singly linked
+// list, exactly once regardless of the number of subscribers. Each subscriber keeps its own cursor
+// into the linked list, and the slices are released once all subscribers consumed their values.
+// The number of values a subscriber may fall behind can optionally be bounded, in which case a
+// policy determines what happens to slow subscribers: block the publisher, drop the oldest values
+// or disconnect the subscriber.
+package broadcast
+
+import (
+	"sync"
+
+	"github.com/christianrpetrin/queue-tests/queueerr"
+)
+
+const (
+	// internalSliceSize holds the size of each internal slice.
+	internalSliceSize = 128
+)
+
+// Policy determines what happens when a value is pushed while a subscriber
+// is already capacity values behind.
+type Policy int
+
+const (
+	// Block blocks the publisher until all subscribers are below capacity.
+	Block Policy = iota
+
+	// Drop drops the oldest unconsumed value of the slow subscriber.
+	Drop
+
+	// Disconnect disconnects the slow subscriber, which then stops receiving values.
+	Disconnect
+)
+
+// Broadcast represents an unbounded, dynamically growing broadcast FIFO queue.
+// Broadcast and its subscribers are safe for concurrent use by multiple goroutines.
+type Broadcast struct {
+	// mu guards all fields, including the subscribers fields.
+	mu sync.Mutex
+
+	// cond is signaled when a subscriber consumes a value or is removed, so a
+	// blocked publisher can check whether it can proceed.
+	cond *sync.Cond
+
+	// tail points to the last node of the linked list.
+	tail *node
+
+	// tp is the index of the next free position in the tail node.
+	tp int
+
+	// published holds the number of values pushed so far.
+	published uint64
+
+	// capacity holds how many values a subscriber may fall behind, or 0 if unbounded.
+	capacity int
+
+	// policy holds what happens to subscribers falling behind capacity values.
+	policy Policy
+
+	// subscribers holds the connected subscribers.
+	subscribers map[*Subscriber]struct{}
+}
+
+// node represents a queue node.
+// Each node holds an slice of user managed values.
+type node struct {
+	// v holds the list of user added values in this node.
+	v []interface{}
+
+	// n points to the next node in the linked list.
+	n *node
+}
+
+// Subscriber represents a subscription to a broadcast queue.
+type Subscriber struct {
+	// b holds the broadcast queue the subscriber is subscribed to.
+	b *Broadcast
+
+	// node points to the node holding the next value to consume.
+	node *node
+
+	// pos is the index of the next value to consume in node.
+	pos int
+
+	// next holds the sequence number of the next value to consume.
+	next uint64
+
+	// dropped holds the number of values dropped by the Drop policy.
+	dropped uint64
+
+	// connected holds whether the subscriber is still connected.
+	connected bool
+}
+
+// New returns an initialized broadcast queue.
+// Capacity bounds how many values each subscriber may fall behind, with policy
+// determining what happens to slow subscribers; a capacity of 0 or less means
+// subscribers are unbounded and policy is ignored.
+func New(capacity int, policy Policy) *Broadcast {
+	if capacity < 0 {
+		capacity = 0
+	}
+	b := &Broadcast{
+		tail:        newNode(),
+		capacity:    capacity,
+		policy:      policy,
+		subscribers: make(map[*Subscriber]struct{}),
+	}
+	b.cond = sync.NewCond(&b.mu)
+	return b
+}
+
+// Subscribe returns a new subscriber, which receives all values pushed from now on.
+// The complexity is O(1).
+func (b *Broadcast) Subscribe() *Subscriber {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	s := &Subscriber{
+		b:         b,
+		node:      b.tail,
+		pos:       b.tp,
+		next:      b.published,
+		connected: true,
+	}
+	b.subscribers[s] = struct{}{}
+	return s
+}
+
+// Subscribers returns the number of connected subscribers.
+// The complexity is O(1).
+func (b *Broadcast) Subscribers() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.subscribers)
+}
+
+// Push adds a value to the queue, making it available to all connected subscribers.
+// If the queue is bounded and a subscriber is capacity values behind, the queue
+// policy is applied to it first; with the Block policy, Push blocks until all
+// subscribers are below capacity.
+// The complexity is O(1) if the queue is unbounded; O(n) otherwise, where n is
+// the number of subscribers.
+func (b *Broadcast) Push(v interface{}) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.capacity > 0 {
+		b.applyPolicy()
+	}
+
+	if b.tp >= internalSliceSize {
+		n := newNode()
+		b.tail.n = n
+		b.tail = n
+		b.tp = 0
+	}
+	b.tail.v[b.tp] = v
+	b.tp++
+	b.published++
+}
+
+// applyPolicy applies the queue policy to the subscribers that are capacity values behind.
+func (b *Broadcast) applyPolicy() {
+	switch b.policy {
+	case Drop:
+		for s := range b.subscribers {
+			if s.lag() >= b.capacity {
+				s.advance()
+				s.dropped++
+			}
+		}
+	case Disconnect:
+		for s := range b.subscribers {
+			if s.lag() >= b.capacity {
+				b.remove(s)
+			}
+		}
+	default:
+		for b.full() {
+			b.cond.Wait()
+		}
+	}
+}
+
+// full returns whether any subscriber is capacity values behind.
+func (b *Broadcast) full() bool {
+	for s := range b.subscribers {
+		if s.lag() >= b.capacity {
+			return true
+		}
+	}
+	return false
+}
+
+// remove disconnects subscriber s.
+func (b *Broadcast) remove(s *Subscriber) {
+	delete(b.subscribers, s)
+	s.connected = false
+	s.node = nil // Avoid memory leaks
+	if b.policy == Block {
+		b.cond.Broadcast()
+	}
+}
+
+// Pop retrieves and removes the next value for subscriber s.
+// The second, bool result indicates whether a valid value was returned;
+//   if there are no new values or the subscriber is disconnected, false will be returned.
+// The complexity is O(1).
+func (s *Subscriber) Pop() (interface{}, bool) {
+	v, err := s.PopE()
+	return v, err == nil
+}
+
+// PopE retrieves and removes the next value for subscriber s.
+// It returns queueerr.ErrClosed if the subscriber is disconnected, or queueerr.ErrEmpty if
+// there are no new values.
+// The complexity is O(1).
+func (s *Subscriber) PopE() (interface{}, error) {
+	b := s.b
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !s.connected {
+		return nil, queueerr.ErrClosed
+	}
+	if s.lag() == 0 {
+		return nil, queueerr.ErrEmpty
+	}
+
+	v := s.advance()
+	if b.policy == Block && b.capacity > 0 {
+		b.cond.Broadcast()
+	}
+	return v, nil
+}
+
+// Len returns the number of values subscriber s didn't consume yet.
+// The complexity is O(1).
+func (s *Subscriber) Len() int {
+	s.b.mu.Lock()
+	defer s.b.mu.Unlock()
+
+	if !s.connected {
+		return 0
+	}
+	return s.lag()
+}
+
+// Dropped returns the number of values dropped for subscriber s by the Drop policy.
+func (s *Subscriber) Dropped() uint64 {
+	s.b.mu.Lock()
+	defer s.b.mu.Unlock()
+	return s.dropped
+}
+
+// Connected returns whether subscriber s is still connected, i.e. it was neither
+// closed nor disconnected by the Disconnect policy.
+func (s *Subscriber) Connected() bool {
+	s.b.mu.Lock()
+	defer s.b.mu.Unlock()
+	return s.connected
+}
+
+// Close disconnects subscriber s, which then stops receiving values.
+// Closing a disconnected subscriber has no effect.
+func (s *Subscriber) Close() {
+	s.b.mu.Lock()
+	defer s.b.mu.Unlock()
+
+	if s.connected {
+		s.b.remove(s)
+	}
+}
+
+// lag returns the number of values subscriber s didn't consume yet.
+func (s *Subscriber) lag() int {
+	return int(s.b.published - s.next)
+}
+
+// advance moves the cursor of subscriber s past its next value, returning the value.
+func (s *Subscriber) advance() interface{} {
+	if s.pos >= internalSliceSize {
+		s.node = s.node.n
+		s.pos = 0
+	}
+	v := s.node.v[s.pos]
+	s.pos++
+	s.next++
+	return v
+}
+
+// newNode returns an initialized node.
+func newNode() *node {
+	return &node{
+		v: make([]interface{}, internalSliceSize),
+	}
+}
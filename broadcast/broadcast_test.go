@@ -0,0 +1,232 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package broadcast
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/christianrpetrin/queue-tests/queueerr"
+)
+
+func TestBroadcastNewShouldReturnInitiazedInstanceOfQueue(t *testing.T) {
+	b := New(0, Block)
+
+	if b == nil {
+		t.Error("Expected: new instance of queue; Got: nil")
+	}
+	if b.Subscribers() != 0 {
+		t.Errorf("Expected: %d; Got: %d", 0, b.Subscribers())
+	}
+}
+
+func TestBroadcastPushShouldDeliverAllValuesToAllSubscribers(t *testing.T) {
+	b := New(0, Block)
+	s1 := b.Subscribe()
+	b.Push(-1)
+	s2 := b.Subscribe()
+
+	for i := 0; i < 1000; i++ {
+		b.Push(i)
+	}
+
+	if v, ok := s1.Pop(); !ok || v.(int) != -1 {
+		t.Errorf("Expected: %d; Got: %d", -1, v)
+	}
+	for _, s := range []*Subscriber{s1, s2} {
+		if s.Len() != 1000 {
+			t.Errorf("Expected: %d; Got: %d", 1000, s.Len())
+		}
+		for i := 0; i < 1000; i++ {
+			if v, ok := s.Pop(); !ok || v.(int) != i {
+				t.Errorf("Expected: %d; Got: %d", i, v)
+			}
+		}
+		if v, ok := s.Pop(); ok || v != nil {
+			t.Errorf("Expected: nil as there are no new values; Got: %d", v)
+		}
+	}
+}
+
+func TestBroadcastWithDropPolicyShouldDropOldestValues(t *testing.T) {
+	b := New(10, Drop)
+	slow := b.Subscribe()
+	fast := b.Subscribe()
+
+	for i := 0; i < 300; i++ {
+		b.Push(i)
+		if v, ok := fast.Pop(); !ok || v.(int) != i {
+			t.Errorf("Expected: %d; Got: %d", i, v)
+		}
+	}
+
+	if slow.Len() != 10 {
+		t.Errorf("Expected: %d; Got: %d", 10, slow.Len())
+	}
+	if slow.Dropped() != 290 {
+		t.Errorf("Expected: %d; Got: %d", 290, slow.Dropped())
+	}
+	if fast.Dropped() != 0 {
+		t.Errorf("Expected: %d; Got: %d", 0, fast.Dropped())
+	}
+	for i := 290; i < 300; i++ {
+		if v, ok := slow.Pop(); !ok || v.(int) != i {
+			t.Errorf("Expected: %d; Got: %d", i, v)
+		}
+	}
+}
+
+func TestBroadcastWithDisconnectPolicyShouldDisconnectSlowSubscribers(t *testing.T) {
+	b := New(10, Disconnect)
+	slow := b.Subscribe()
+	fast := b.Subscribe()
+
+	for i := 0; i < 11; i++ {
+		b.Push(i)
+		fast.Pop()
+	}
+
+	if slow.Connected() {
+		t.Error("Expected: slow subscriber disconnected; Got: connected")
+	}
+	if !fast.Connected() {
+		t.Error("Expected: fast subscriber connected; Got: disconnected")
+	}
+	if b.Subscribers() != 1 {
+		t.Errorf("Expected: %d; Got: %d", 1, b.Subscribers())
+	}
+	if v, ok := slow.Pop(); ok || v != nil {
+		t.Errorf("Expected: nil as the subscriber is disconnected; Got: %d", v)
+	}
+	if slow.Len() != 0 {
+		t.Errorf("Expected: %d; Got: %d", 0, slow.Len())
+	}
+}
+
+func TestBroadcastWithBlockPolicyShouldBlockPublisherUntilSubscribersCatchUp(t *testing.T) {
+	b := New(10, Block)
+	s := b.Subscribe()
+	for i := 0; i < 10; i++ {
+		b.Push(i)
+	}
+
+	pushed := make(chan struct{})
+	go func() {
+		defer close(pushed)
+		b.Push(10)
+	}()
+
+	select {
+	case <-pushed:
+		t.Fatal("Expected: publisher blocked as the subscriber is full; Got: not blocked")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	if v, ok := s.Pop(); !ok || v.(int) != 0 {
+		t.Errorf("Expected: %d; Got: %d", 0, v)
+	}
+	select {
+	case <-pushed:
+	case <-time.After(10 * time.Second):
+		t.Fatal("Expected: publisher unblocked; Got: blocked")
+	}
+	if s.Len() != 10 {
+		t.Errorf("Expected: %d; Got: %d", 10, s.Len())
+	}
+}
+
+func TestBroadcastCloseShouldUnblockPublisher(t *testing.T) {
+	b := New(1, Block)
+	s := b.Subscribe()
+	b.Push(0)
+
+	pushed := make(chan struct{})
+	go func() {
+		defer close(pushed)
+		b.Push(1)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	s.Close()
+	s.Close()
+
+	select {
+	case <-pushed:
+	case <-time.After(10 * time.Second):
+		t.Fatal("Expected: publisher unblocked; Got: blocked")
+	}
+	if s.Connected() {
+		t.Error("Expected: subscriber disconnected; Got: connected")
+	}
+}
+
+func TestBroadcastConcurrentSubscribersShouldReceiveAllValuesInOrder(t *testing.T) {
+	const count = 10000
+	b := New(100, Block)
+	subscribers := make([]*Subscriber, 4)
+	for i := range subscribers {
+		subscribers[i] = b.Subscribe()
+	}
+
+	var wg sync.WaitGroup
+	for _, s := range subscribers {
+		wg.Add(1)
+		go func(s *Subscriber) {
+			defer wg.Done()
+			for i := 0; i < count; {
+				v, ok := s.Pop()
+				if !ok {
+					time.Sleep(time.Microsecond)
+					continue
+				}
+				if v.(int) != i {
+					t.Errorf("Expected: %d; Got: %d", i, v)
+					s.Close()
+					return
+				}
+				i++
+			}
+		}(s)
+	}
+
+	for i := 0; i < count; i++ {
+		b.Push(i)
+	}
+	wg.Wait()
+}
+
+func TestBroadcastPopEShouldReturnErrClosedWhenDisconnected(t *testing.T) {
+	b := New(0, Drop)
+	s := b.Subscribe()
+	b.Push(1)
+
+	if v, err := s.PopE(); err != nil || v != 1 {
+		t.Errorf("Expected: %d; Got: %v, %v", 1, v, err)
+	}
+	if v, err := s.PopE(); err != queueerr.ErrEmpty || v != nil {
+		t.Errorf("Expected: %v; Got: %v, %v", queueerr.ErrEmpty, v, err)
+	}
+	b.Push(2)
+	s.Close()
+	if v, err := s.PopE(); err != queueerr.ErrClosed || v != nil {
+		t.Errorf("Expected: %v; Got: %v, %v", queueerr.ErrClosed, v, err)
+	}
+}
@@ -0,0 +1,202 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Command benchdiff runs the benchmark tests twice, against two git refs and/or using two Go
+// toolchains, and compares the results using benchstat, which annotates each difference with
+// its statistical significance (i.e. the p-value, or "~" if there is no significant difference).
+//
+// Each side of the comparison is run in a temporary git worktree checked out at its ref, or in
+// the current working tree if its ref is empty, using its Go toolchain. As the repo has no
+// go.mod, the benchmark tests are run in GOPATH mode: worktrees are checked out in a temporary
+// GOPATH, so the repo packages imported by the benchmark tests are the ones of the worktree,
+// while the current working tree must be in GOPATH. As benchstat needs multiple samples of each
+// benchmark test to estimate their variance, each benchmark test is run -count times; 10 or
+// more is recommended.
+//
+// benchstat must be installed, e.g. using:
+//
+//	go install golang.org/x/perf/cmd/benchstat@latest
+//
+// Usage:
+//
+//	go run ./cmd/benchdiff -old=master -new= -bench=Impl3 -count=10
+//	go run ./cmd/benchdiff -old-go=go1.10 -new-go=go1.11
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"go/build"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// importPath holds the import path of the repo packages.
+const importPath = "github.com/christianrpetrin/queue-tests"
+
+// side describes one side of the comparison.
+type side struct {
+	// name is the name of the side, used to name its results file.
+	name string
+
+	// ref is the git ref to run the benchmark tests against, or empty to use the current working tree.
+	ref string
+
+	// goCmd is the Go toolchain command used to run the benchmark tests.
+	goCmd string
+}
+
+// config holds the comparison parameters.
+type config struct {
+	// bench is the regular expression selecting the benchmark tests to run.
+	bench string
+
+	// count is the number of times each benchmark test is run.
+	count int
+
+	// pkgs holds the space separated list of packages whose benchmark tests are run.
+	pkgs string
+
+	// benchstat is the benchstat command used to compare the results.
+	benchstat string
+
+	// out is the directory the raw results are written to, or empty to use a temporary directory.
+	out string
+}
+
+func main() {
+	var cfg config
+	before := side{name: "old"}
+	after := side{name: "new"}
+	flag.StringVar(&before.ref, "old", "HEAD", "git ref of the baseline; empty to use the current working tree")
+	flag.StringVar(&after.ref, "new", "", "git ref to compare with the baseline; empty to use the current working tree")
+	flag.StringVar(&before.goCmd, "old-go", "go", "Go toolchain command of the baseline")
+	flag.StringVar(&after.goCmd, "new-go", "go", "Go toolchain command to compare with the baseline")
+	flag.StringVar(&cfg.bench, "bench", ".", "regular expression selecting the benchmark tests to run")
+	flag.IntVar(&cfg.count, "count", 10, "number of times each benchmark test is run")
+	flag.StringVar(&cfg.pkgs, "pkgs", ".", "space separated list of packages whose benchmark tests are run")
+	flag.StringVar(&cfg.benchstat, "benchstat", "benchstat", "benchstat command used to compare the results")
+	flag.StringVar(&cfg.out, "out", "", "directory the raw results are written to (default a temporary directory)")
+	flag.Parse()
+
+	if err := run(cfg, before, after); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// run runs the benchmark tests of both sides before and after and compares their results.
+func run(cfg config, before, after side) error {
+	if before.ref == after.ref && before.goCmd == after.goCmd {
+		return errors.New("benchdiff: old and new are the same; set different refs and/or Go toolchains")
+	}
+	if _, err := exec.LookPath(cfg.benchstat); err != nil {
+		return fmt.Errorf("benchdiff: %v; install it using go install golang.org/x/perf/cmd/benchstat@latest", err)
+	}
+
+	out := cfg.out
+	if out == "" {
+		dir, err := ioutil.TempDir("", "benchdiff")
+		if err != nil {
+			return fmt.Errorf("benchdiff: %v", err)
+		}
+		defer os.RemoveAll(dir)
+		out = dir
+	} else if err := os.MkdirAll(out, 0755); err != nil {
+		return fmt.Errorf("benchdiff: %v", err)
+	}
+
+	var files []string
+	for _, s := range []side{before, after} {
+		file := filepath.Join(out, s.name+".txt")
+		if err := runSide(cfg, s, file); err != nil {
+			return err
+		}
+		files = append(files, file)
+	}
+
+	cmd := exec.Command(cfg.benchstat, files...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("benchdiff: benchstat failed: %v", err)
+	}
+	return nil
+}
+
+// runSide runs the benchmark tests of side s, writing the results to file.
+func runSide(cfg config, s side, file string) error {
+	fmt.Fprintf(os.Stderr, "benchdiff: running %s (ref %q, toolchain %q)\n", s.name, s.ref, s.goCmd)
+
+	// The repo has no go.mod, so the packages are built in GOPATH mode, where they import each
+	// other by import path.
+	dir := ""
+	env := append(os.Environ(), "GO111MODULE=off")
+	if s.ref != "" {
+		// The worktree is checked out at the repo import path in a temporary GOPATH, listed
+		// first so the repo packages resolve to the worktree rather than to any other checkout.
+		gopath, err := ioutil.TempDir("", "benchdiff-"+s.name)
+		if err != nil {
+			return fmt.Errorf("benchdiff: %v", err)
+		}
+		defer os.RemoveAll(gopath)
+		wt := filepath.Join(gopath, "src", filepath.FromSlash(importPath))
+		if err := os.MkdirAll(filepath.Dir(wt), 0755); err != nil {
+			return fmt.Errorf("benchdiff: %v", err)
+		}
+		if err := git("worktree", "add", "--detach", wt, s.ref); err != nil {
+			return err
+		}
+		defer git("worktree", "remove", "--force", wt)
+		dir = wt
+		env = append(env, "GOPATH="+gopath+string(os.PathListSeparator)+build.Default.GOPATH)
+	}
+
+	f, err := os.Create(file)
+	if err != nil {
+		return fmt.Errorf("benchdiff: %v", err)
+	}
+	defer f.Close()
+
+	args := []string{"test", "-run=^$", "-bench=" + cfg.bench, "-benchmem", fmt.Sprintf("-count=%d", cfg.count)}
+	cmd := exec.Command(s.goCmd, append(args, strings.Fields(cfg.pkgs)...)...)
+	cmd.Dir = dir
+	cmd.Env = env
+	cmd.Stdout = f
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("benchdiff: running the %s benchmark tests failed: %v", s.name, err)
+	}
+	return f.Close()
+}
+
+// git runs the git command with arguments args in the current working directory.
+func git(args ...string) error {
+	cmd := exec.Command("git", args...)
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("benchdiff: git %v failed: %v", args, err)
+	}
+	return nil
+}
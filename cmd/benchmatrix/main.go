@@ -0,0 +1,309 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Command benchmatrix runs the benchmark tests using multiple installed Go toolchains and
+// aggregates the results into a single JSON or CSV file, so the implementations can be
+// compared across Go releases, whose append growth and GC behavior materially affect them.
+//
+// Each benchmark test is run -count times per toolchain; the results are aggregated into one
+// record per toolchain and benchmark test, holding the mean of each metric (e.g. ns/op, B/op,
+// allocs/op and custom metrics) over the runs.
+//
+// As the repo has no go.mod, the benchmark tests are run in GOPATH mode (GO111MODULE=off), so
+// the repo must be checked out at $GOPATH/src/github.com/christianrpetrin/queue-tests.
+//
+// Additional toolchains can be installed using golang.org/dl, e.g.:
+//
+//	go install golang.org/dl/go1.21.13@latest && go1.21.13 download
+//
+// Usage:
+//
+//	go run ./cmd/benchmatrix -go=go1.21.13,go1.22.6,go -bench=Impl -count=5 -format=csv -o=matrix.csv
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// config holds the benchmark matrix parameters.
+type config struct {
+	// toolchains holds the Go toolchain commands the benchmark tests are run with.
+	toolchains []string
+
+	// bench is the regular expression selecting the benchmark tests to run.
+	bench string
+
+	// count is the number of times each benchmark test is run per toolchain.
+	count int
+
+	// pkgs holds the packages whose benchmark tests are run.
+	pkgs []string
+
+	// format is the output format, either json or csv.
+	format string
+
+	// out is the output file, or empty to write to the standard output.
+	out string
+}
+
+// record holds the aggregated results of a benchmark test run using a toolchain.
+type record struct {
+	// Go is the toolchain version, as reported by go version (e.g. go1.22.6).
+	Go string `json:"go"`
+
+	// Package is the package holding the benchmark test.
+	Package string `json:"package"`
+
+	// Benchmark is the benchmark test name, without the GOMAXPROCS suffix.
+	Benchmark string `json:"benchmark"`
+
+	// Procs is the GOMAXPROCS value the benchmark test was run with.
+	Procs int `json:"procs"`
+
+	// Runs is the number of runs aggregated in the record.
+	Runs int `json:"runs"`
+
+	// Metrics holds the mean of each metric over the runs reporting it, by unit (e.g. ns/op).
+	Metrics map[string]float64 `json:"metrics"`
+
+	// counts holds the number of runs reporting each metric, by unit.
+	counts map[string]int
+}
+
+// key identifies the records aggregating the runs of the same benchmark test.
+type key struct {
+	// goVersion is the toolchain version.
+	goVersion string
+
+	// pkg is the package holding the benchmark test.
+	pkg string
+
+	// benchmark is the benchmark test name, without the GOMAXPROCS suffix.
+	benchmark string
+
+	// procs is the GOMAXPROCS value.
+	procs int
+}
+
+func main() {
+	var cfg config
+	var toolchains, pkgs string
+	flag.StringVar(&toolchains, "go", "go", "comma separated list of Go toolchain commands to run the benchmark tests with")
+	flag.StringVar(&cfg.bench, "bench", ".", "regular expression selecting the benchmark tests to run")
+	flag.IntVar(&cfg.count, "count", 5, "number of times each benchmark test is run per toolchain")
+	flag.StringVar(&pkgs, "pkgs", ".", "comma separated list of packages whose benchmark tests are run")
+	flag.StringVar(&cfg.format, "format", "json", "output format: json or csv")
+	flag.StringVar(&cfg.out, "o", "", "output file (default standard output)")
+	flag.Parse()
+	cfg.toolchains = splitList(toolchains)
+	cfg.pkgs = splitList(pkgs)
+
+	if cfg.format != "json" && cfg.format != "csv" {
+		fmt.Fprintf(os.Stderr, "benchmatrix: unknown format %q\n", cfg.format)
+		os.Exit(2)
+	}
+	if len(cfg.toolchains) == 0 {
+		fmt.Fprintln(os.Stderr, "benchmatrix: no toolchains selected")
+		os.Exit(2)
+	}
+
+	if err := run(cfg); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// splitList returns the non-empty items of the comma separated list s.
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// run runs the benchmark tests using each toolchain and writes the aggregated results.
+func run(cfg config) error {
+	records := make(map[key]*record)
+	var order []key
+	for _, tc := range cfg.toolchains {
+		version, err := goVersion(tc)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "benchmatrix: running %s (%s)\n", tc, version)
+
+		args := []string{"test", "-run=^$", "-bench=" + cfg.bench, "-benchmem", fmt.Sprintf("-count=%d", cfg.count)}
+		cmd := exec.Command(tc, append(args, cfg.pkgs...)...)
+		cmd.Env = append(os.Environ(), "GO111MODULE=off")
+		cmd.Stderr = os.Stderr
+		out, err := cmd.Output()
+		if err != nil {
+			return fmt.Errorf("benchmatrix: running the benchmark tests using %s failed: %v", tc, err)
+		}
+		if err := parse(bytes.NewReader(out), version, records, &order); err != nil {
+			return err
+		}
+	}
+
+	rs := make([]*record, 0, len(order))
+	for _, k := range order {
+		rs = append(rs, records[k])
+	}
+	if cfg.out == "" {
+		return write(os.Stdout, cfg.format, rs)
+	}
+	f, err := os.Create(cfg.out)
+	if err != nil {
+		return fmt.Errorf("benchmatrix: %v", err)
+	}
+	err = write(f, cfg.format, rs)
+	if cerr := f.Close(); err == nil && cerr != nil {
+		err = fmt.Errorf("benchmatrix: %v", cerr)
+	}
+	return err
+}
+
+// write writes records rs to w using format.
+func write(w io.Writer, format string, rs []*record) error {
+	var err error
+	if format == "csv" {
+		err = writeCSV(w, rs)
+	} else {
+		e := json.NewEncoder(w)
+		e.SetIndent("", "  ")
+		err = e.Encode(rs)
+	}
+	if err != nil {
+		return fmt.Errorf("benchmatrix: %v", err)
+	}
+	return nil
+}
+
+// goVersion returns the version of toolchain tc, e.g. go1.22.6.
+func goVersion(tc string) (string, error) {
+	out, err := exec.Command(tc, "env", "GOVERSION").Output()
+	if err != nil {
+		return "", fmt.Errorf("benchmatrix: getting the version of %s failed: %v", tc, err)
+	}
+	v := strings.TrimSpace(string(out))
+	if v == "" {
+		return "", errors.New("benchmatrix: " + tc + " reported an empty version")
+	}
+	return v, nil
+}
+
+// parse parses the go test -bench output read from r, produced by toolchain version, adding the
+// results to the records aggregating them. Keys of newly added records are appended to order.
+func parse(r io.Reader, version string, records map[key]*record, order *[]key) error {
+	pkg := ""
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line := s.Text()
+		if strings.HasPrefix(line, "pkg: ") {
+			pkg = strings.TrimPrefix(line, "pkg: ")
+			continue
+		}
+
+		// Result lines look like:
+		// BenchmarkImpl3/100-8   349084   3579 ns/op   2400 B/op   4 allocs/op
+		fields := strings.Fields(line)
+		if len(fields) < 4 || !strings.HasPrefix(fields[0], "Benchmark") || len(fields)%2 != 0 {
+			continue
+		}
+		if _, err := strconv.Atoi(fields[1]); err != nil {
+			continue
+		}
+
+		name, procs := fields[0], 1
+		if i := strings.LastIndex(name, "-"); i >= 0 {
+			if p, err := strconv.Atoi(name[i+1:]); err == nil {
+				name, procs = name[:i], p
+			}
+		}
+
+		k := key{goVersion: version, pkg: pkg, benchmark: name, procs: procs}
+		rec, ok := records[k]
+		if !ok {
+			rec = &record{Go: version, Package: pkg, Benchmark: name, Procs: procs, Metrics: make(map[string]float64), counts: make(map[string]int)}
+			records[k] = rec
+			*order = append(*order, k)
+		}
+		for i := 2; i < len(fields); i += 2 {
+			v, err := strconv.ParseFloat(fields[i], 64)
+			if err != nil {
+				return fmt.Errorf("benchmatrix: invalid metric %q in line %q", fields[i], line)
+			}
+			// Incrementally update the mean over the runs reporting the metric, as custom
+			// metrics may not be reported by all runs.
+			unit := fields[i+1]
+			rec.counts[unit]++
+			rec.Metrics[unit] += (v - rec.Metrics[unit]) / float64(rec.counts[unit])
+		}
+		rec.Runs++
+	}
+	return s.Err()
+}
+
+// writeCSV writes records rs to w as CSV, with a header row and one column per metric unit.
+func writeCSV(w io.Writer, rs []*record) error {
+	units := make(map[string]bool)
+	for _, r := range rs {
+		for u := range r.Metrics {
+			units[u] = true
+		}
+	}
+	var cols []string
+	for u := range units {
+		cols = append(cols, u)
+	}
+	sort.Strings(cols)
+
+	cw := csv.NewWriter(w)
+	cw.Write(append([]string{"go", "package", "benchmark", "procs", "runs"}, cols...))
+	for _, r := range rs {
+		row := []string{r.Go, r.Package, r.Benchmark, strconv.Itoa(r.Procs), strconv.Itoa(r.Runs)}
+		for _, u := range cols {
+			v, ok := r.Metrics[u]
+			if !ok {
+				row = append(row, "")
+				continue
+			}
+			row = append(row, strconv.FormatFloat(v, 'g', -1, 64))
+		}
+		cw.Write(row)
+	}
+	cw.Flush()
+	return cw.Error()
+}
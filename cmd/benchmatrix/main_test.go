@@ -0,0 +1,53 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseShouldAverageEachMetricOverTheRunsReportingIt(t *testing.T) {
+	out := `pkg: github.com/christianrpetrin/queue-tests
+BenchmarkImpl3/100-8   1000   3000 ns/op
+BenchmarkImpl3/100-8   1000   5000 ns/op   10 spills/op
+PASS
+`
+	records := make(map[key]*record)
+	var order []key
+	if err := parse(strings.NewReader(out), "go1.22.6", records, &order); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(order) != 1 {
+		t.Fatalf("Expected: %d records; Got: %d", 1, len(order))
+	}
+	rec := records[order[0]]
+	if rec.Runs != 2 || rec.Benchmark != "BenchmarkImpl3/100" || rec.Procs != 8 {
+		t.Errorf("Expected: %d runs of %s-%d; Got: %d runs of %s-%d", 2, "BenchmarkImpl3/100", 8, rec.Runs, rec.Benchmark, rec.Procs)
+	}
+	if v := rec.Metrics["ns/op"]; v != 4000 {
+		t.Errorf("Expected: %v ns/op; Got: %v", 4000, v)
+	}
+	if v := rec.Metrics["spills/op"]; v != 10 {
+		t.Errorf("Expected: %v spills/op; Got: %v", 10, v)
+	}
+}
@@ -0,0 +1,329 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Command profilegen runs a representative workload against the queue implementations in this
+// repo while profiling the CPU, writing the profile to default.pgo, so the implementations can
+// be built using profile-guided optimization (PGO), which uses the profile to decide, among
+// others, which calls in the queue hot loops to inline.
+//
+// The workload mirrors the benchmark tests: each implementation is filled with bursts of
+// values of different lengths, popping a value every three pushes for some of them, and then
+// drained, for an equal share of the configured duration.
+//
+// Using the -compare flag, profilegen then runs the benchmark tests twice per run, once built
+// without PGO (-pgo=off) and once using the profile, and prints the mean ns/op of each
+// benchmark test for both builds and their difference. PGO requires Go 1.21 or later.
+//
+// Usage:
+//
+//	go run ./cmd/profilegen -duration=30s -o=default.pgo -compare -pkgs=./payload -bench=Payload/Impl -count=5
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime/pprof"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/christianrpetrin/queue-tests/queueimpl1"
+	"github.com/christianrpetrin/queue-tests/queueimpl10"
+	"github.com/christianrpetrin/queue-tests/queueimpl11"
+	"github.com/christianrpetrin/queue-tests/queueimpl2"
+	"github.com/christianrpetrin/queue-tests/queueimpl3"
+	"github.com/christianrpetrin/queue-tests/queueimpl4"
+	"github.com/christianrpetrin/queue-tests/queueimpl5"
+	"github.com/christianrpetrin/queue-tests/queueimpl6"
+	"github.com/christianrpetrin/queue-tests/queueimpl7"
+	"github.com/christianrpetrin/queue-tests/queueimpl8"
+	"github.com/christianrpetrin/queue-tests/queuetest"
+)
+
+// impl describes a profiled queue implementation.
+type impl struct {
+	// name is the value used to select the implementation via the -impls flag.
+	name string
+
+	// new returns a new, empty queue.
+	new func() queuetest.Queue
+}
+
+// impls holds all profiled implementations, in the order they are run.
+var impls = []impl{
+	{name: "impl1", new: func() queuetest.Queue { return queueimpl1.New() }},
+	{name: "impl2", new: func() queuetest.Queue { return queueimpl2.New() }},
+	{name: "impl3", new: func() queuetest.Queue { return queueimpl3.New() }},
+	{name: "impl4", new: func() queuetest.Queue { return queueimpl4.New() }},
+	{name: "impl5", new: func() queuetest.Queue { return queueimpl5.New() }},
+	{name: "impl6", new: func() queuetest.Queue { return queueimpl6.New() }},
+	{name: "impl7", new: func() queuetest.Queue { return queueimpl7.New() }},
+	{name: "impl8", new: func() queuetest.Queue { return queueimpl8.New() }},
+	{name: "impl10", new: func() queuetest.Queue { return queueimpl10.New() }},
+	{name: "impl11", new: func() queuetest.Queue { return queueimpl11.New() }},
+}
+
+// bursts holds the bursts of values pushed by the workload, as in the benchmark tests.
+var bursts = []struct {
+	// count is the number of values pushed.
+	count int
+
+	// remove tells whether a value is popped every three pushes.
+	remove bool
+}{
+	{count: 1},
+	{count: 10},
+	{count: 100, remove: true},
+	{count: 1000},
+	{count: 10000, remove: true},
+	{count: 100000},
+}
+
+// config holds the profilegen parameters.
+type config struct {
+	// duration is how long the workload runs for, across all implementations.
+	duration time.Duration
+
+	// out is the file the CPU profile is written to.
+	out string
+
+	// compare tells whether to compare the benchmark tests built with and without PGO.
+	compare bool
+
+	// bench is the regular expression selecting the benchmark tests to compare.
+	bench string
+
+	// count is the number of times each benchmark test is run per build.
+	count int
+
+	// pkgs holds the packages whose benchmark tests are compared.
+	pkgs []string
+}
+
+// result holds the ns/op of a benchmark test built with and without PGO.
+type result struct {
+	// name is the benchmark test name, including the GOMAXPROCS suffix.
+	name string
+
+	// off holds the mean ns/op without PGO, or 0 if it was not reported.
+	off float64
+
+	// pgo holds the mean ns/op using the profile, or 0 if it was not reported.
+	pgo float64
+}
+
+// tmp stores the popped values, avoiding any compiler optimizations.
+var tmp interface{}
+
+func main() {
+	var cfg config
+	var names, pkgs string
+	flag.DurationVar(&cfg.duration, "duration", 30*time.Second, "how long to run the workload for, across all implementations")
+	flag.StringVar(&cfg.out, "o", "default.pgo", "file the CPU profile is written to")
+	flag.StringVar(&names, "impls", "", "comma separated list of implementations to run the workload against (default all)")
+	flag.BoolVar(&cfg.compare, "compare", false, "compare the benchmark tests built with and without PGO")
+	flag.StringVar(&cfg.bench, "bench", "Payload/Impl", "regular expression selecting the benchmark tests to compare")
+	flag.IntVar(&cfg.count, "count", 5, "number of times each benchmark test is run per build")
+	flag.StringVar(&pkgs, "pkgs", "./payload", "comma separated list of packages whose benchmark tests are compared")
+	flag.Parse()
+	cfg.pkgs = strings.Split(pkgs, ",")
+
+	selected, err := selectImpls(names)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	if err := profile(selected, cfg); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if cfg.compare {
+		if err := compare(cfg); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+}
+
+// selectImpls returns the implementations named in the comma separated list names.
+// An empty list selects all implementations.
+func selectImpls(names string) ([]impl, error) {
+	if names == "" {
+		return impls, nil
+	}
+
+	var selected []impl
+	for _, name := range strings.Split(names, ",") {
+		found := false
+		for _, i := range impls {
+			if i.name == strings.TrimSpace(name) {
+				selected = append(selected, i)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("profilegen: unknown implementation %q", name)
+		}
+	}
+	return selected, nil
+}
+
+// profile runs the workload against implementations is while profiling the CPU,
+// writing the profile to cfg.out.
+func profile(is []impl, cfg config) error {
+	f, err := os.Create(cfg.out)
+	if err != nil {
+		return fmt.Errorf("profilegen: %v", err)
+	}
+	if err := pprof.StartCPUProfile(f); err != nil {
+		f.Close()
+		return fmt.Errorf("profilegen: %v", err)
+	}
+
+	share := cfg.duration / time.Duration(len(is))
+	for _, i := range is {
+		fmt.Fprintf(os.Stderr, "profilegen: running %s for %v\n", i.name, share)
+		run(i, share)
+	}
+
+	pprof.StopCPUProfile()
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("profilegen: %v", err)
+	}
+	fmt.Fprintf(os.Stderr, "profilegen: profile written to %s\n", cfg.out)
+	return nil
+}
+
+// run fills and drains new queues of implementation i with the workload bursts for duration d.
+func run(i impl, d time.Duration) {
+	for start := time.Now(); time.Since(start) < d; {
+		for _, b := range bursts {
+			q := i.new()
+			for j := 0; j < b.count; j++ {
+				q.Push(j)
+
+				if b.remove && j > 0 && j%3 == 0 {
+					tmp, _ = q.Pop()
+				}
+			}
+			for q.Len() > 0 {
+				tmp, _ = q.Pop()
+			}
+		}
+	}
+}
+
+// compare runs the benchmark tests built without PGO and using the cfg.out profile,
+// and prints the mean ns/op of each benchmark test for both builds.
+func compare(cfg config) error {
+	profile, err := filepath.Abs(cfg.out)
+	if err != nil {
+		return fmt.Errorf("profilegen: %v", err)
+	}
+
+	var results []*result
+	byName := make(map[string]*result)
+	for _, pgo := range []string{"off", profile} {
+		fmt.Fprintf(os.Stderr, "profilegen: running the benchmark tests using -pgo=%s\n", pgo)
+		args := []string{"test", "-run=^$", "-bench=" + cfg.bench, fmt.Sprintf("-count=%d", cfg.count), "-pgo=" + pgo}
+		cmd := exec.Command("go", append(args, cfg.pkgs...)...)
+		cmd.Stderr = os.Stderr
+		out, err := cmd.Output()
+		if err != nil {
+			return fmt.Errorf("profilegen: running the benchmark tests using -pgo=%s failed: %v", pgo, err)
+		}
+
+		means, order, err := parse(bytes.NewReader(out))
+		if err != nil {
+			return err
+		}
+		for _, name := range order {
+			r, ok := byName[name]
+			if !ok {
+				r = &result{name: name}
+				byName[name] = r
+				results = append(results, r)
+			}
+			if pgo == "off" {
+				r.off = means[name]
+			} else {
+				r.pgo = means[name]
+			}
+		}
+	}
+	return write(os.Stdout, results)
+}
+
+// parse parses the go test -bench output read from r, returning the mean ns/op of each
+// benchmark test, by name, and the names in the order they were first reported.
+func parse(r io.Reader) (map[string]float64, []string, error) {
+	means := make(map[string]float64)
+	runs := make(map[string]int)
+	var order []string
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		// Result lines look like:
+		// BenchmarkPayload/Impl3/Interface/100-8   349084   3579 ns/op
+		fields := strings.Fields(s.Text())
+		if len(fields) < 4 || !strings.HasPrefix(fields[0], "Benchmark") {
+			continue
+		}
+		for i := 2; i+1 < len(fields); i += 2 {
+			if fields[i+1] != "ns/op" {
+				continue
+			}
+			v, err := strconv.ParseFloat(fields[i], 64)
+			if err != nil {
+				return nil, nil, fmt.Errorf("profilegen: invalid ns/op %q in line %q", fields[i], s.Text())
+			}
+			name := fields[0]
+			if runs[name] == 0 {
+				order = append(order, name)
+			}
+			// Incrementally update the mean over the runs.
+			means[name] += (v - means[name]) / float64(runs[name]+1)
+			runs[name]++
+		}
+	}
+	return means, order, s.Err()
+}
+
+// write writes results rs to w as a table, with the ns/op difference using PGO in percent.
+func write(w io.Writer, rs []*result) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "benchmark\tns/op (-pgo=off)\tns/op (pgo)\tdelta\t")
+	for _, r := range rs {
+		delta := "~"
+		if r.off > 0 && r.pgo > 0 {
+			delta = fmt.Sprintf("%+.1f%%", (r.pgo-r.off)/r.off*100)
+		}
+		fmt.Fprintf(tw, "%s\t%.1f\t%.1f\t%s\t\n", r.name, r.off, r.pgo, delta)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,251 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Command soak continuously churns the queue implementations in this repo
+// while sampling the heap size, in order to detect slow memory leaks such as
+// values or nodes retained via stale pointers.
+//
+// Each implementation is soaked in turn. A churn cycle pushes a random burst
+// of pointer values to the queue and then pops values until the queue is back
+// to its base length, so every heap sample is taken with the same number of
+// live values in the queue. Heap samples are taken after a forced GC.
+// The first periodic sample is used as the baseline, so the queue internals
+// have already grown to their steady state size by then. If heap in use at
+// the end of the run exceeds the baseline by more than the configured
+// tolerance, the implementation is reported as leaking.
+//
+// Usage:
+//
+//	go run ./cmd/soak -duration=2h -interval=1m -impls=impl3,impl7
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math/rand"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/christianrpetrin/queue-tests/queueimpl1"
+	"github.com/christianrpetrin/queue-tests/queueimpl2"
+	"github.com/christianrpetrin/queue-tests/queueimpl3"
+	"github.com/christianrpetrin/queue-tests/queueimpl4"
+	"github.com/christianrpetrin/queue-tests/queueimpl5"
+	"github.com/christianrpetrin/queue-tests/queueimpl6"
+	"github.com/christianrpetrin/queue-tests/queueimpl7"
+	"github.com/christianrpetrin/queue-tests/queuetest"
+)
+
+// impl describes a soakable queue implementation.
+type impl struct {
+	// name is the value used to select the implementation via the -impls flag.
+	name string
+
+	// new returns a new, empty queue.
+	new func() queuetest.Queue
+}
+
+// impls holds all soakable implementations, in the order they are soaked.
+var impls = []impl{
+	{name: "impl1", new: func() queuetest.Queue { return queueimpl1.New() }},
+	{name: "impl2", new: func() queuetest.Queue { return queueimpl2.New() }},
+	{name: "impl3", new: func() queuetest.Queue { return queueimpl3.New() }},
+	{name: "impl4", new: func() queuetest.Queue { return queueimpl4.New() }},
+	{name: "impl5", new: func() queuetest.Queue { return queueimpl5.New() }},
+	{name: "impl6", new: func() queuetest.Queue { return queueimpl6.New() }},
+	{name: "impl7", new: func() queuetest.Queue { return queueimpl7.New() }},
+}
+
+// config holds the soak test parameters.
+type config struct {
+	// duration is how long each implementation is soaked for.
+	duration time.Duration
+
+	// interval is how often the heap is sampled.
+	interval time.Duration
+
+	// base is the number of values kept in the queue between churn cycles.
+	base int
+
+	// burst is the maximum number of values pushed in a single churn cycle.
+	burst int
+
+	// payload is the size in bytes of each pushed value.
+	payload int
+
+	// tolerance is the maximum allowed heap growth, in bytes, between the
+	// first and last samples before an implementation is reported as leaking.
+	tolerance uint64
+}
+
+// sample holds a single heap measurement.
+type sample struct {
+	// at is the time elapsed since the soak of the implementation started.
+	at time.Duration
+
+	// heapInuse is the number of bytes in in-use heap spans after a forced GC.
+	heapInuse uint64
+
+	// heapObjects is the number of allocated heap objects after a forced GC.
+	heapObjects uint64
+
+	// cycles is the number of churn cycles executed so far.
+	cycles int64
+}
+
+func main() {
+	var cfg config
+	var names string
+	flag.DurationVar(&cfg.duration, "duration", time.Hour, "how long to soak each implementation for")
+	flag.DurationVar(&cfg.interval, "interval", time.Minute, "how often to sample the heap")
+	flag.IntVar(&cfg.base, "base", 1000, "number of values kept in the queue between churn cycles")
+	flag.IntVar(&cfg.burst, "burst", 100000, "maximum number of values pushed in a single churn cycle")
+	flag.IntVar(&cfg.payload, "payload", 64, "size in bytes of each pushed value")
+	flag.Uint64Var(&cfg.tolerance, "tolerance", 1<<20, "maximum allowed heap growth in bytes")
+	flag.StringVar(&names, "impls", "", "comma separated list of implementations to soak (default all)")
+	flag.Parse()
+
+	selected, err := selectImpls(names)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	leaking := false
+	for _, i := range selected {
+		if !soak(i, cfg) {
+			leaking = true
+		}
+	}
+	if leaking {
+		os.Exit(1)
+	}
+}
+
+// selectImpls returns the implementations named in the comma separated list names.
+// An empty list selects all implementations.
+func selectImpls(names string) ([]impl, error) {
+	if names == "" {
+		return impls, nil
+	}
+
+	var selected []impl
+	for _, name := range strings.Split(names, ",") {
+		found := false
+		for _, i := range impls {
+			if i.name == strings.TrimSpace(name) {
+				selected = append(selected, i)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("soak: unknown implementation %q", name)
+		}
+	}
+	return selected, nil
+}
+
+// soak churns a new queue of implementation i for cfg.duration, sampling the heap
+// every cfg.interval. It returns false if the implementation appears to leak.
+func soak(i impl, cfg config) bool {
+	fmt.Printf("soaking %s for %v\n", i.name, cfg.duration)
+
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+	q := i.new()
+	for q.Len() < cfg.base {
+		q.Push(newPayload(cfg.payload))
+	}
+
+	start := time.Now()
+	printSample(i.name, takeSample(0, 0))
+
+	var first, last *sample
+	var cycles int64
+	next := start.Add(cfg.interval)
+	for time.Since(start) < cfg.duration {
+		churn(q, r.Intn(cfg.burst)+1, cfg)
+		cycles++
+
+		if now := time.Now(); !now.Before(next) {
+			s := takeSample(now.Sub(start), cycles)
+			printSample(i.name, s)
+			if first == nil {
+				first = &s
+			}
+			last = &s
+			next = now.Add(cfg.interval)
+		}
+	}
+	runtime.KeepAlive(q)
+
+	if first == last {
+		fmt.Printf("%s: not enough samples, duration must be at least twice the interval\n", i.name)
+		return true
+	}
+
+	growth := int64(last.heapInuse) - int64(first.heapInuse)
+	if growth > int64(cfg.tolerance) {
+		fmt.Printf("%s: LEAK? heap in use grew by %d bytes (tolerance %d) over %d cycles\n",
+			i.name, growth, cfg.tolerance, last.cycles)
+		return false
+	}
+	fmt.Printf("%s: ok, heap in use changed by %d bytes over %d cycles\n", i.name, growth, last.cycles)
+	return true
+}
+
+// churn pushes n values to queue q and then pops values until it is back to cfg.base length.
+func churn(q queuetest.Queue, n int, cfg config) {
+	for i := 0; i < n; i++ {
+		q.Push(newPayload(cfg.payload))
+	}
+	for q.Len() > cfg.base {
+		if _, ok := q.Pop(); !ok {
+			panic("soak: pop from a non-empty queue failed")
+		}
+	}
+}
+
+// newPayload returns a new pointer value holding size bytes.
+func newPayload(size int) *[]byte {
+	b := make([]byte, size)
+	return &b
+}
+
+// takeSample forces a GC and returns the current heap measurements.
+func takeSample(at time.Duration, cycles int64) sample {
+	runtime.GC()
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	return sample{
+		at:          at,
+		heapInuse:   m.HeapInuse,
+		heapObjects: m.HeapObjects,
+		cycles:      cycles,
+	}
+}
+
+// printSample prints sample s of implementation name.
+func printSample(name string, s sample) {
+	fmt.Printf("%s\t%v\theap_inuse=%d\theap_objects=%d\tcycles=%d\n",
+		name, s.at.Truncate(time.Second), s.heapInuse, s.heapObjects, s.cycles)
+}
@@ -0,0 +1,93 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package codec implements the element codecs used by the queue serialization features,
+// such as the disk-backed and spilling queues and the queue checkpoints.
+// A codec converts each queue value to and from a self-contained binary representation,
+// so values can be decoded individually and in any order.
+package codec
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+)
+
+// ElementCodec encodes and decodes queue values.
+// An ElementCodec must be safe for concurrent use.
+type ElementCodec interface {
+	// Encode returns the binary representation of v.
+	// The returned slice may be retained by the caller.
+	Encode(v interface{}) ([]byte, error)
+
+	// Decode returns the value represented by b.
+	// Decode must not retain b.
+	Decode(b []byte) (interface{}, error)
+}
+
+// Bytes is a codec for values of type []byte, which are stored as is.
+// Decoded values are always of type []byte.
+var Bytes ElementCodec = bytesCodec{}
+
+// Gob is a codec that encodes values using encoding/gob.
+// Values of types other than the gob supported basic types must be registered
+// using gob.Register before being encoded or decoded.
+// Each value is encoded along with its type information, so Gob is convenient
+// but not compact; a codec for a concrete, known type is preferable when
+// serialization performance matters.
+var Gob ElementCodec = gobCodec{}
+
+// bytesCodec implements the Bytes codec.
+type bytesCodec struct{}
+
+// Encode returns v, that must be of type []byte.
+func (bytesCodec) Encode(v interface{}) ([]byte, error) {
+	b, ok := v.([]byte)
+	if !ok {
+		return nil, fmt.Errorf("codec: value of type %T cannot be encoded by the bytes codec", v)
+	}
+	return b, nil
+}
+
+// Decode returns a copy of b.
+func (bytesCodec) Decode(b []byte) (interface{}, error) {
+	return append([]byte{}, b...), nil
+}
+
+// gobCodec implements the Gob codec.
+type gobCodec struct{}
+
+// Encode returns the gob encoding of v.
+func (gobCodec) Encode(v interface{}) ([]byte, error) {
+	var b bytes.Buffer
+	if err := gob.NewEncoder(&b).Encode(&v); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// Decode returns the value whose gob encoding is b.
+func (gobCodec) Decode(b []byte) (interface{}, error) {
+	var v interface{}
+	if err := gob.NewDecoder(bytes.NewReader(b)).Decode(&v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
@@ -0,0 +1,88 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package codec
+
+import (
+	"encoding/gob"
+	"reflect"
+	"testing"
+)
+
+// gobTestValue is a user defined type encoded by the gob codec tests.
+type gobTestValue struct {
+	ID   int
+	Name string
+}
+
+func init() {
+	gob.Register(gobTestValue{})
+}
+
+func TestBytesShouldRoundTripByteValues(t *testing.T) {
+	b := []byte("value")
+	e, err := Bytes.Encode(b)
+	if err != nil {
+		t.Fatalf("Expected: no error; Got: %v", err)
+	}
+	v, err := Bytes.Decode(e)
+	if err != nil || string(v.([]byte)) != "value" {
+		t.Errorf("Expected: value; Got: %v, %v", v, err)
+	}
+
+	// The decoded value must not alias the encoded one.
+	e[0] = 'x'
+	if string(v.([]byte)) != "value" {
+		t.Errorf("Expected: value; Got: %s", v)
+	}
+}
+
+func TestBytesWithInvalidValueShouldFail(t *testing.T) {
+	if _, err := Bytes.Encode("value"); err == nil {
+		t.Error("Expected: error; Got: nil")
+	}
+}
+
+func TestGobShouldRoundTripValues(t *testing.T) {
+	for _, v := range []interface{}{1, "value", []byte("value"), 1.5, gobTestValue{ID: 1, Name: "value"}} {
+		e, err := Gob.Encode(v)
+		if err != nil {
+			t.Fatalf("Expected: no error; Got: %v", err)
+		}
+		d, err := Gob.Decode(e)
+		if err != nil || !reflect.DeepEqual(d, v) {
+			t.Errorf("Expected: %v; Got: %v, %v", v, d, err)
+		}
+	}
+}
+
+func TestGobWithUnregisteredTypeShouldFail(t *testing.T) {
+	type unregistered struct{ ID int }
+
+	if _, err := Gob.Encode(unregistered{ID: 1}); err == nil {
+		t.Error("Expected: error; Got: nil")
+	}
+}
+
+func TestGobWithInvalidDataShouldFail(t *testing.T) {
+	if _, err := Gob.Decode([]byte("invalid")); err == nil {
+		t.Error("Expected: error; Got: nil")
+	}
+}
@@ -0,0 +1,142 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package ctxqueue implements an unbounded, dynamically growing FIFO queue that carries a
+// context along with each value.
+// Internally, queue wraps a queueimpl3 queue, storing each value along with the context it
+// was pushed with, so the cancellation, deadline and request scoped values (e.g. trace
+// metadata) of the producer travel through the queue to the consumer without wrapping every
+// payload in a custom struct.
+// Storing a context keeps it, and its values, reachable until the value is popped; PopLive
+// discards the values whose context is done rather than delivering already abandoned work.
+package ctxqueue
+
+import (
+	"context"
+
+	"github.com/christianrpetrin/queue-tests/queueimpl3"
+)
+
+// CtxQueue represents an unbounded, dynamically growing FIFO queue whose values carry a context.
+// The zero value for queue is an empty queue ready to use.
+type CtxQueue struct {
+	// q holds the queue entries.
+	q queueimpl3.Queueimpl3
+
+	// discarded holds the number of elements discarded by PopLive.
+	discarded uint64
+}
+
+// entry represents a queue value along with the context it was pushed with.
+type entry struct {
+	// ctx holds the context v was pushed with.
+	ctx context.Context
+
+	// v holds the user added value.
+	v interface{}
+}
+
+// New returns an initialized queue.
+func New() *CtxQueue {
+	return new(CtxQueue).Init()
+}
+
+// Init initializes or clears queue q.
+func (q *CtxQueue) Init() *CtxQueue {
+	q.q.Init()
+	q.discarded = 0
+	return q
+}
+
+// Len returns the number of elements of queue q.
+// The complexity is O(1).
+func (q *CtxQueue) Len() int { return q.q.Len() }
+
+// Front returns the first element of queue q or nil if the queue is empty.
+// The second, bool result indicates whether a valid value was returned;
+//   if the queue is empty, false will be returned.
+// The complexity is O(1).
+func (q *CtxQueue) Front() (interface{}, bool) {
+	e, ok := q.q.Front()
+	if !ok {
+		return nil, false
+	}
+	return e.(entry).v, true
+}
+
+// Push adds a value to the queue, along with context.Background().
+// The complexity is O(1).
+func (q *CtxQueue) Push(v interface{}) {
+	q.PushWithContext(context.Background(), v)
+}
+
+// PushWithContext adds a value to the queue, along with context ctx.
+// PushWithContext panics if ctx is nil.
+// The complexity is O(1).
+func (q *CtxQueue) PushWithContext(ctx context.Context, v interface{}) {
+	if ctx == nil {
+		panic("ctxqueue: nil context")
+	}
+	q.q.Push(entry{ctx: ctx, v: v})
+}
+
+// Pop retrieves and removes the next element from the queue, discarding its context.
+// The second, bool result indicates whether a valid value was returned;
+//   if the queue is empty, false will be returned.
+// The complexity is O(1).
+func (q *CtxQueue) Pop() (interface{}, bool) {
+	_, v, ok := q.PopWithContext()
+	return v, ok
+}
+
+// PopWithContext retrieves and removes the next element from the queue, along with the
+// context it was pushed with.
+// The third, bool result indicates whether a valid value was returned;
+//   if the queue is empty, a nil context and false will be returned.
+// The complexity is O(1).
+func (q *CtxQueue) PopWithContext() (context.Context, interface{}, bool) {
+	e, ok := q.q.Pop()
+	if !ok {
+		return nil, nil, false
+	}
+	return e.(entry).ctx, e.(entry).v, true
+}
+
+// PopLive retrieves and removes the next element from the queue whose context is not done
+// yet, along with its context, discarding the elements before it whose context is done.
+// The third, bool result indicates whether a valid value was returned;
+//   if the queue is empty, or all its elements were discarded, false will be returned.
+// The complexity is O(1), not counting the cost of the discarded elements.
+func (q *CtxQueue) PopLive() (context.Context, interface{}, bool) {
+	for {
+		ctx, v, ok := q.PopWithContext()
+		if !ok {
+			return nil, nil, false
+		}
+		if ctx.Err() == nil {
+			return ctx, v, true
+		}
+		q.discarded++
+	}
+}
+
+// Discarded returns the number of elements discarded by PopLive so far.
+// The complexity is O(1).
+func (q *CtxQueue) Discarded() uint64 { return q.discarded }
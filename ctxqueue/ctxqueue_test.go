@@ -0,0 +1,115 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ctxqueue
+
+import (
+	"context"
+	"testing"
+)
+
+// traceKey is the context key of the trace id in the tests.
+type traceKey struct{}
+
+func TestCtxQueueNewQueueShouldReturnInitiazedInstanceOfQueue(t *testing.T) {
+	q := New()
+
+	if q == nil {
+		t.Error("Expected: new instance of queue; Got: nil")
+	}
+	if q.Len() != 0 {
+		t.Errorf("Expected: %d; Got: %d", 0, q.Len())
+	}
+}
+
+func TestCtxQueuePushPopFrontShouldRetrieveAllElementsInOrder(t *testing.T) {
+	var q CtxQueue
+	for i := 0; i < 1000; i++ {
+		q.Push(i)
+	}
+
+	for i := 0; i < 1000; i++ {
+		if v, ok := q.Front(); !ok || v.(int) != i {
+			t.Errorf("Expected: %d; Got: %v", i, v)
+		}
+		if v, ok := q.Pop(); !ok || v.(int) != i {
+			t.Errorf("Expected: %d; Got: %v", i, v)
+		}
+	}
+	if v, ok := q.Pop(); ok || v != nil {
+		t.Errorf("Expected: nil as the queue should be empty; Got: %v", v)
+	}
+	if ctx, v, ok := q.PopWithContext(); ok || ctx != nil || v != nil {
+		t.Errorf("Expected: nil as the queue should be empty; Got: %v, %v", ctx, v)
+	}
+}
+
+func TestCtxQueuePopWithContextShouldReturnPushedContext(t *testing.T) {
+	q := New()
+	for i := 0; i < 10; i++ {
+		q.PushWithContext(context.WithValue(context.Background(), traceKey{}, i), i)
+	}
+	q.Push(10)
+
+	for i := 0; i < 10; i++ {
+		ctx, v, ok := q.PopWithContext()
+		if !ok || v != i || ctx.Value(traceKey{}) != i {
+			t.Errorf("Expected: %d with trace %d; Got: %v with trace %v", i, i, v, ctx.Value(traceKey{}))
+		}
+	}
+	if ctx, v, ok := q.PopWithContext(); !ok || v != 10 || ctx != context.Background() {
+		t.Errorf("Expected: %d with background context; Got: %v with %v", 10, v, ctx)
+	}
+}
+
+func TestCtxQueuePushWithNilContextShouldPanic(t *testing.T) {
+	q := New()
+	defer func() {
+		if r := recover(); r == nil {
+			t.Error("Expected: panic; Got: no panic")
+		}
+	}()
+	q.PushWithContext(nil, 1)
+}
+
+func TestCtxQueuePopLiveShouldDiscardElementsWhoseContextIsDone(t *testing.T) {
+	q := New()
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	q.PushWithContext(canceled, 0)
+	q.PushWithContext(canceled, 1)
+	q.Push(2)
+	q.PushWithContext(canceled, 3)
+
+	if _, v, ok := q.PopLive(); !ok || v != 2 {
+		t.Errorf("Expected: %d; Got: %v", 2, v)
+	}
+	if _, v, ok := q.PopLive(); ok || v != nil {
+		t.Errorf("Expected: nil as all elements should be discarded; Got: %v", v)
+	}
+	if q.Discarded() != 3 {
+		t.Errorf("Expected: %d; Got: %d", 3, q.Discarded())
+	}
+	q.Init()
+	if q.Discarded() != 0 {
+		t.Errorf("Expected: %d; Got: %d", 0, q.Discarded())
+	}
+}
@@ -0,0 +1,540 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package diskqueue implements an unbounded, durable FIFO queue backed by files on disk.
+// Internally, queue appends the pushed values to a segmented write-ahead log and
+// deletes each segment file once all its values were popped.
+// The position of the next value to pop is kept in a separate cursor file, so on
+// open the queue recovers all values that were pushed but not popped yet.
+// A torn record at the end of the last segment (e.g. caused by a crash in the middle
+// of a Push) is discarded on open.
+// This implementation tests the cost of durability compared with the in-memory queues.
+package diskqueue
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/christianrpetrin/queue-tests/codec"
+	"github.com/christianrpetrin/queue-tests/queueerr"
+)
+
+const (
+	// DefaultSegmentSize holds the default size, in bytes, after which a new segment is started.
+	DefaultSegmentSize = 16 << 20
+
+	// segmentSuffix holds the file name suffix of the segment files.
+	segmentSuffix = ".seg"
+
+	// cursorName holds the name of the cursor file.
+	cursorName = "cursor"
+
+	// recordHeaderSize holds the size of a record header: the payload length
+	// followed by the payload CRC-32 checksum.
+	recordHeaderSize = 8
+
+	// cursorSize holds the size of the cursor file: the segment id followed by the offset.
+	cursorSize = 16
+)
+
+// ErrCorrupted is returned by Open when a segment other than the last one holds an invalid record.
+var ErrCorrupted = errors.New("diskqueue: corrupted segment")
+
+// Options configures a queue.
+// The zero value for Options holds the default configuration.
+type Options struct {
+	// SegmentSize is the size, in bytes, after which a new segment is started.
+	// A SegmentSize of 0 or less uses DefaultSegmentSize.
+	SegmentSize int64
+
+	// Codec encodes and decodes the queue values.
+	// A nil Codec uses codec.Bytes, so the queue values must be of type []byte.
+	Codec codec.ElementCodec
+
+	// Sync, if true, forces every Push and Pop to be flushed to stable storage
+	// before returning. Otherwise data is only written to the OS page cache, so
+	// it survives a process crash but not necessarily an OS crash or power loss.
+	Sync bool
+}
+
+// DiskQueue represents an unbounded, durable FIFO queue.
+// Values are stored encoded by the configured codec.
+// DiskQueue is not safe for concurrent use.
+type DiskQueue struct {
+	// dir holds the directory where the queue files are stored.
+	dir string
+
+	// opts holds the queue configuration.
+	opts Options
+
+	// segs holds the queue segments, from the segment being read to the segment being written.
+	segs []segment
+
+	// w holds the last segment file, where values are appended.
+	w *os.File
+
+	// r holds the first segment file, where values are popped from.
+	r *os.File
+
+	// rOff holds the offset in the first segment of the next value to be popped.
+	rOff int64
+
+	// cursor holds the cursor file.
+	cursor *os.File
+
+	// len holds the current queue length.
+	len int
+
+	// err holds the first I/O error that occurred, if any.
+	err error
+
+	// closed holds whether the queue was closed.
+	closed bool
+
+	// buf holds a scratch buffer used to encode records and the cursor.
+	buf []byte
+}
+
+// segment represents a segment file.
+type segment struct {
+	// id holds the segment id, that is also used as the segment file name.
+	id uint64
+
+	// size holds the size, in bytes, of the valid records in the segment.
+	size int64
+}
+
+// Open opens the queue stored in directory dir, creating it if it doesn't exist.
+// All values pushed but not popped yet by a previous queue opened in dir are recovered.
+func Open(dir string, opts Options) (*DiskQueue, error) {
+	if opts.SegmentSize <= 0 {
+		opts.SegmentSize = DefaultSegmentSize
+	}
+	if opts.Codec == nil {
+		opts.Codec = codec.Bytes
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	q := &DiskQueue{dir: dir, opts: opts}
+	if err := q.recover(); err != nil {
+		q.Close()
+		return nil, err
+	}
+	return q, nil
+}
+
+// Close closes the queue files; the queue must not be used afterwards.
+// Close returns the first error that occurred while using the queue, if any.
+func (q *DiskQueue) Close() error {
+	files := []*os.File{q.w, q.cursor}
+	if q.r != q.w {
+		files = append(files, q.r)
+	}
+	for _, f := range files {
+		if f == nil {
+			continue
+		}
+		if err := f.Close(); err != nil {
+			q.fail(err)
+		}
+	}
+	q.r, q.w, q.cursor = nil, nil, nil
+	q.closed = true
+	return q.err
+}
+
+// Err returns the first I/O error that occurred while pushing or popping values, if any.
+// Once an error occurs, Push discards the pushed values and Pop reports the queue as empty.
+// Values that cannot be decoded are reported as errors as well.
+func (q *DiskQueue) Err() error { return q.err }
+
+// Len returns the number of elements of queue q.
+// The complexity is O(1).
+func (q *DiskQueue) Len() int { return q.len }
+
+// Front returns the first element of queue q or nil if the queue is empty.
+// The second, bool result indicates whether a valid value was returned;
+//   if the queue is empty, false will be returned.
+// The complexity is O(1), not counting the cost of reading and decoding the value.
+func (q *DiskQueue) Front() (interface{}, bool) {
+	if q.len == 0 || q.err != nil || !q.advance() {
+		return nil, false
+	}
+
+	b, _, err := readRecord(q.r, q.rOff, q.segs[0].size)
+	if err != nil {
+		q.fail(err)
+		return nil, false
+	}
+	v, err := q.opts.Codec.Decode(b)
+	if err != nil {
+		q.fail(err)
+		return nil, false
+	}
+	return v, true
+}
+
+// Push adds a value to the queue.
+// Push panics if v cannot be encoded by the queue codec.
+// The complexity is O(1), not counting the cost of encoding and writing the value.
+func (q *DiskQueue) Push(v interface{}) {
+	b, err := q.opts.Codec.Encode(v)
+	if err != nil {
+		panic(fmt.Sprintf("diskqueue: cannot encode pushed value: %v", err))
+	}
+	if q.err != nil {
+		return
+	}
+
+	last := &q.segs[len(q.segs)-1]
+	if last.size >= q.opts.SegmentSize {
+		if err := q.roll(); err != nil {
+			q.fail(err)
+			return
+		}
+		last = &q.segs[len(q.segs)-1]
+	}
+
+	q.buf = appendRecord(q.buf[:0], b)
+	if _, err := q.w.WriteAt(q.buf, last.size); err != nil {
+		q.fail(err)
+		return
+	}
+	if q.opts.Sync {
+		if err := q.w.Sync(); err != nil {
+			q.fail(err)
+			return
+		}
+	}
+	last.size += int64(len(q.buf))
+	q.len++
+}
+
+// Pop retrieves and removes the next element from the queue.
+// The second, bool result indicates whether a valid value was returned;
+//   if the queue is empty, false will be returned.
+// The complexity is O(1), not counting the cost of reading and decoding the value.
+func (q *DiskQueue) Pop() (interface{}, bool) {
+	if q.len == 0 || q.err != nil || !q.advance() {
+		return nil, false
+	}
+
+	b, next, err := readRecord(q.r, q.rOff, q.segs[0].size)
+	if err != nil {
+		q.fail(err)
+		return nil, false
+	}
+	v, err := q.opts.Codec.Decode(b)
+	if err != nil {
+		q.fail(err)
+		return nil, false
+	}
+	if err := q.writeCursor(q.segs[0].id, next); err != nil {
+		q.fail(err)
+		return nil, false
+	}
+	q.rOff = next
+	q.len--
+	return v, true
+}
+
+// PopE retrieves and removes the next element from the queue.
+// It returns queueerr.ErrClosed if the queue was closed, the first I/O error that occurred,
+// if any (see Err), or queueerr.ErrEmpty if the queue is empty.
+// The complexity is O(1), not counting the cost of reading and decoding the value.
+func (q *DiskQueue) PopE() (interface{}, error) {
+	if q.closed {
+		return nil, queueerr.ErrClosed
+	}
+	if v, ok := q.Pop(); ok {
+		return v, nil
+	}
+	if q.err != nil {
+		return nil, q.err
+	}
+	return nil, queueerr.ErrEmpty
+}
+
+// advance moves the read position to the next segment if the first segment
+// was fully popped, deleting the first segment file.
+// It returns false if an I/O error occurred.
+func (q *DiskQueue) advance() bool {
+	for q.rOff >= q.segs[0].size && len(q.segs) > 1 {
+		old := q.segs[0]
+		next := q.segs[1]
+
+		// Move the cursor first, so a crash before the file is deleted just
+		// leaves a stale segment behind, which is deleted on open.
+		if err := q.writeCursor(next.id, 0); err != nil {
+			q.fail(err)
+			return false
+		}
+		if q.r != q.w {
+			q.r.Close()
+		}
+		q.segs = q.segs[1:]
+		q.rOff = 0
+		if len(q.segs) == 1 {
+			q.r = q.w
+		} else {
+			r, err := os.Open(q.segmentPath(next.id))
+			if err != nil {
+				q.fail(err)
+				return false
+			}
+			q.r = r
+		}
+		if err := os.Remove(q.segmentPath(old.id)); err != nil {
+			q.fail(err)
+			return false
+		}
+	}
+	return true
+}
+
+// roll starts a new segment.
+func (q *DiskQueue) roll() error {
+	id := q.segs[len(q.segs)-1].id + 1
+	w, err := os.OpenFile(q.segmentPath(id), os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if q.w != q.r {
+		if err := q.w.Close(); err != nil {
+			w.Close()
+			return err
+		}
+	}
+	q.w = w
+	q.segs = append(q.segs, segment{id: id})
+	return nil
+}
+
+// recover opens the queue files, discarding the segments that were fully popped
+// and checking the records of the remaining segments.
+func (q *DiskQueue) recover() error {
+	ids, err := q.segmentIDs()
+	if err != nil {
+		return err
+	}
+
+	q.cursor, err = os.OpenFile(filepath.Join(q.dir, cursorName), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	id, off, err := q.readCursor()
+	if err != nil {
+		return err
+	}
+
+	// Delete the segments that were fully popped already.
+	for len(ids) > 0 && ids[0] < id {
+		if err := os.Remove(q.segmentPath(ids[0])); err != nil {
+			return err
+		}
+		ids = ids[1:]
+	}
+	if len(ids) == 0 || ids[0] != id {
+		// The cursor segment doesn't exist, so it was empty.
+		off = 0
+	}
+	if len(ids) == 0 {
+		ids = append(ids, id)
+	}
+
+	for i, id := range ids {
+		last := i == len(ids)-1
+		f, err := os.OpenFile(q.segmentPath(id), os.O_RDWR|os.O_CREATE, 0644)
+		if err != nil {
+			return err
+		}
+		start := int64(0)
+		if i == 0 {
+			start = off
+		}
+		n, size, err := scanSegment(f, start)
+		if err != nil && (!last || err != ErrCorrupted) {
+			f.Close()
+			return err
+		}
+		if err == ErrCorrupted {
+			// Discard the torn record at the end of the last segment.
+			if err := f.Truncate(size); err != nil {
+				f.Close()
+				return err
+			}
+		}
+		q.len += n
+		q.segs = append(q.segs, segment{id: id, size: size})
+
+		switch {
+		case i == 0:
+			q.r = f
+		case !last:
+			f.Close()
+		}
+		if last {
+			q.w = f
+		}
+	}
+	q.rOff = off
+	if q.rOff > q.segs[0].size {
+		q.rOff = q.segs[0].size
+	}
+	return nil
+}
+
+// segmentIDs returns the ids of the segment files in the queue directory, in ascending order.
+func (q *DiskQueue) segmentIDs() ([]uint64, error) {
+	d, err := os.Open(q.dir)
+	if err != nil {
+		return nil, err
+	}
+	names, err := d.Readdirnames(-1)
+	d.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []uint64
+	for _, name := range names {
+		if !strings.HasSuffix(name, segmentSuffix) {
+			continue
+		}
+		id, err := strconv.ParseUint(strings.TrimSuffix(name, segmentSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	sort.Sort(segmentIDs(ids))
+	return ids, nil
+}
+
+// segmentIDs implements sort.Interface, sorting segment ids in ascending order.
+type segmentIDs []uint64
+
+func (s segmentIDs) Len() int           { return len(s) }
+func (s segmentIDs) Less(i, j int) bool { return s[i] < s[j] }
+func (s segmentIDs) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+// segmentPath returns the path of the segment file with id id.
+func (q *DiskQueue) segmentPath(id uint64) string {
+	return filepath.Join(q.dir, fmt.Sprintf("%020d%s", id, segmentSuffix))
+}
+
+// readCursor returns the segment id and offset stored in the cursor file.
+// An empty cursor file points to the start of segment 0.
+func (q *DiskQueue) readCursor() (uint64, int64, error) {
+	var b [cursorSize]byte
+	if _, err := q.cursor.ReadAt(b[:], 0); err == io.EOF {
+		return 0, 0, nil
+	} else if err != nil {
+		return 0, 0, err
+	}
+	return binary.LittleEndian.Uint64(b[:8]), int64(binary.LittleEndian.Uint64(b[8:])), nil
+}
+
+// writeCursor stores the segment id and offset of the next value to be popped in the cursor file.
+func (q *DiskQueue) writeCursor(id uint64, off int64) error {
+	var b [cursorSize]byte
+	binary.LittleEndian.PutUint64(b[:8], id)
+	binary.LittleEndian.PutUint64(b[8:], uint64(off))
+	if _, err := q.cursor.WriteAt(b[:], 0); err != nil {
+		return err
+	}
+	if q.opts.Sync {
+		return q.cursor.Sync()
+	}
+	return nil
+}
+
+// fail records err as the queue error, unless an error was recorded already.
+func (q *DiskQueue) fail(err error) {
+	if q.err == nil {
+		q.err = err
+	}
+}
+
+// appendRecord appends the record holding payload b to buf and returns the extended buffer.
+func appendRecord(buf, b []byte) []byte {
+	var h [recordHeaderSize]byte
+	binary.LittleEndian.PutUint32(h[:4], uint32(len(b)))
+	binary.LittleEndian.PutUint32(h[4:], crc32.ChecksumIEEE(b))
+	buf = append(buf, h[:]...)
+	return append(buf, b...)
+}
+
+// readRecord reads the record at offset off of segment f, whose valid records end at offset size.
+// It returns the record payload and the offset of the next record.
+func readRecord(f *os.File, off, size int64) ([]byte, int64, error) {
+	var h [recordHeaderSize]byte
+	if size-off < recordHeaderSize {
+		return nil, 0, ErrCorrupted
+	}
+	if _, err := f.ReadAt(h[:], off); err != nil {
+		return nil, 0, err
+	}
+	n := int64(binary.LittleEndian.Uint32(h[:4]))
+	if size-off-recordHeaderSize < n {
+		return nil, 0, ErrCorrupted
+	}
+	b := make([]byte, n)
+	if _, err := f.ReadAt(b, off+recordHeaderSize); err != nil {
+		return nil, 0, err
+	}
+	if crc32.ChecksumIEEE(b) != binary.LittleEndian.Uint32(h[4:]) {
+		return nil, 0, ErrCorrupted
+	}
+	return b, off + recordHeaderSize + n, nil
+}
+
+// scanSegment checks the records of segment f from offset off to the end of the file.
+// It returns the number of valid records and the offset where the valid records end.
+// If an invalid record is found, ErrCorrupted is returned along with the valid records
+// found before it.
+func scanSegment(f *os.File, off int64) (int, int64, error) {
+	fi, err := f.Stat()
+	if err != nil {
+		return 0, 0, err
+	}
+	size := fi.Size()
+
+	n := 0
+	for off < size {
+		_, next, err := readRecord(f, off, size)
+		if err != nil {
+			return n, off, err
+		}
+		off = next
+		n++
+	}
+	return n, off, nil
+}
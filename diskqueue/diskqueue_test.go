@@ -0,0 +1,287 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package diskqueue
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/christianrpetrin/queue-tests/codec"
+	"github.com/christianrpetrin/queue-tests/queueerr"
+)
+
+// tempDir creates a new temporary directory, failing the test on error.
+// The caller must remove the directory once done.
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "diskqueue-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+// openTestQueue opens a queue in dir, failing the test on error.
+func openTestQueue(t *testing.T, dir string, opts Options) *DiskQueue {
+	q, err := Open(dir, opts)
+	if err != nil {
+		t.Fatalf("Expected: no error; Got: %v", err)
+	}
+	return q
+}
+
+// segmentFiles returns the number of segment files in dir.
+func segmentFiles(t *testing.T, dir string) int {
+	m, err := filepath.Glob(filepath.Join(dir, "*"+segmentSuffix))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(m)
+}
+
+func TestDiskQueueOpenShouldReturnEmptyQueue(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	q := openTestQueue(t, dir, Options{})
+	defer q.Close()
+
+	if q.Len() != 0 {
+		t.Errorf("Expected: %d; Got: %d", 0, q.Len())
+	}
+	if v, ok := q.Pop(); ok || v != nil {
+		t.Errorf("Expected: nil as the queue should be empty; Got: %v", v)
+	}
+}
+
+func TestDiskQueuePushPopFrontShouldRetrieveAllElementsInOrder(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	q := openTestQueue(t, dir, Options{SegmentSize: 100})
+	defer q.Close()
+
+	for i := 0; i < 1000; i++ {
+		q.Push([]byte(strconv.Itoa(i)))
+	}
+	for i := 0; i < 1000; i++ {
+		if v, ok := q.Front(); !ok || string(v.([]byte)) != strconv.Itoa(i) {
+			t.Errorf("Expected: %d; Got: %s", i, v)
+		}
+		if v, ok := q.Pop(); !ok || string(v.([]byte)) != strconv.Itoa(i) {
+			t.Errorf("Expected: %d; Got: %s", i, v)
+		}
+	}
+	if v, ok := q.Pop(); ok || v != nil {
+		t.Errorf("Expected: nil as the queue should be empty; Got: %v", v)
+	}
+	if err := q.Close(); err != nil {
+		t.Errorf("Expected: no error; Got: %v", err)
+	}
+}
+
+func TestDiskQueuePushWithInvalidTypeShouldPanic(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	q := openTestQueue(t, dir, Options{})
+	defer q.Close()
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected: panic; Got: no panic")
+		}
+	}()
+	q.Push(1)
+}
+
+func TestDiskQueuePopShouldDeleteConsumedSegments(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	q := openTestQueue(t, dir, Options{SegmentSize: 100})
+	defer q.Close()
+
+	for i := 0; i < 100; i++ {
+		q.Push([]byte("0123456789"))
+	}
+	if n := segmentFiles(t, dir); n < 10 {
+		t.Errorf("Expected: at least %d segments; Got: %d", 10, n)
+	}
+	for q.Len() > 0 {
+		q.Pop()
+	}
+	if n := segmentFiles(t, dir); n != 1 {
+		t.Errorf("Expected: %d segment; Got: %d", 1, n)
+	}
+}
+
+func TestDiskQueueOpenShouldRecoverPendingElements(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	q := openTestQueue(t, dir, Options{SegmentSize: 100})
+	for i := 0; i < 100; i++ {
+		q.Push([]byte(strconv.Itoa(i)))
+	}
+	for i := 0; i < 55; i++ {
+		q.Pop()
+	}
+	if err := q.Close(); err != nil {
+		t.Fatalf("Expected: no error; Got: %v", err)
+	}
+
+	q = openTestQueue(t, dir, Options{SegmentSize: 100})
+	defer q.Close()
+	if q.Len() != 45 {
+		t.Errorf("Expected: %d; Got: %d", 45, q.Len())
+	}
+	q.Push([]byte("100"))
+	for i := 55; i <= 100; i++ {
+		if v, ok := q.Pop(); !ok || string(v.([]byte)) != strconv.Itoa(i) {
+			t.Errorf("Expected: %d; Got: %s", i, v)
+		}
+	}
+}
+
+func TestDiskQueueOpenWithTornRecordShouldDiscardIt(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	q := openTestQueue(t, dir, Options{})
+	q.Push([]byte("1"))
+	q.Push([]byte("2"))
+	q.Close()
+
+	// Simulate a crash in the middle of a Push by appending a partial record.
+	f, err := os.OpenFile(q.segmentPath(0), os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write(appendRecord(nil, []byte("3"))[:recordHeaderSize])
+	f.Close()
+
+	q = openTestQueue(t, dir, Options{})
+	defer q.Close()
+	if q.Len() != 2 {
+		t.Errorf("Expected: %d; Got: %d", 2, q.Len())
+	}
+	q.Push([]byte("3"))
+	for i := 1; i <= 3; i++ {
+		if v, ok := q.Pop(); !ok || string(v.([]byte)) != strconv.Itoa(i) {
+			t.Errorf("Expected: %d; Got: %s", i, v)
+		}
+	}
+}
+
+func TestDiskQueueOpenWithCorruptedSegmentShouldFail(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	q := openTestQueue(t, dir, Options{SegmentSize: 10})
+	for i := 0; i < 3; i++ {
+		q.Push([]byte("0123456789"))
+	}
+	q.Close()
+
+	// Flip a payload byte of the first segment, which is not the last one.
+	f, err := os.OpenFile(q.segmentPath(0), os.O_RDWR, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteAt([]byte("x"), recordHeaderSize)
+	f.Close()
+
+	if _, err := Open(dir, Options{SegmentSize: 10}); err != ErrCorrupted {
+		t.Errorf("Expected: %v; Got: %v", ErrCorrupted, err)
+	}
+}
+
+func TestDiskQueueSyncShouldRetrieveAllElementsInOrder(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	q := openTestQueue(t, dir, Options{Sync: true})
+	defer q.Close()
+
+	for i := 0; i < 10; i++ {
+		q.Push([]byte(strconv.Itoa(i)))
+	}
+	for i := 0; i < 10; i++ {
+		if v, ok := q.Pop(); !ok || string(v.([]byte)) != strconv.Itoa(i) {
+			t.Errorf("Expected: %d; Got: %s", i, v)
+		}
+	}
+}
+
+func TestDiskQueueWithGobCodecShouldRecoverAllElementsInOrder(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	q := openTestQueue(t, dir, Options{Codec: codec.Gob})
+	for i := 0; i < 10; i++ {
+		q.Push(i)
+	}
+	q.Close()
+
+	q = openTestQueue(t, dir, Options{Codec: codec.Gob})
+	defer q.Close()
+	for i := 0; i < 10; i++ {
+		if v, ok := q.Pop(); !ok || v.(int) != i {
+			t.Errorf("Expected: %d; Got: %v", i, v)
+		}
+	}
+}
+
+func TestDiskQueueWithMismatchedCodecShouldReportError(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	q := openTestQueue(t, dir, Options{})
+	q.Push([]byte("not gob"))
+	q.Close()
+
+	q = openTestQueue(t, dir, Options{Codec: codec.Gob})
+	defer q.Close()
+	if v, ok := q.Pop(); ok {
+		t.Errorf("Expected: no value; Got: %v", v)
+	}
+	if q.Err() == nil {
+		t.Error("Expected: error; Got: nil")
+	}
+}
+
+func TestDiskQueuePopEShouldReturnErrorDescribingFailure(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	q := openTestQueue(t, dir, Options{})
+	q.Push([]byte("1"))
+
+	if v, err := q.PopE(); err != nil || string(v.([]byte)) != "1" {
+		t.Errorf("Expected: %s; Got: %v, %v", "1", v, err)
+	}
+	if v, err := q.PopE(); err != queueerr.ErrEmpty || v != nil {
+		t.Errorf("Expected: %v; Got: %v, %v", queueerr.ErrEmpty, v, err)
+	}
+	q.Push([]byte("not gob"))
+	q.Close()
+	if v, err := q.PopE(); err != queueerr.ErrClosed || v != nil {
+		t.Errorf("Expected: %v; Got: %v, %v", queueerr.ErrClosed, v, err)
+	}
+
+	q = openTestQueue(t, dir, Options{Codec: codec.Gob})
+	defer q.Close()
+	if v, err := q.PopE(); err == nil || err == queueerr.ErrEmpty || err != q.Err() {
+		t.Errorf("Expected: %v; Got: %v, %v", q.Err(), v, err)
+	}
+}
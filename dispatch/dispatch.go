@@ -0,0 +1,296 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package dispatch implements a dispatcher feeding a group of consumer goroutines from a
+// single blocking queue.
+// Internally, each consumer goroutine pops the next value from the queue and handles it
+// before popping the following one, so each value is delivered to exactly one consumer,
+// and is never delivered again (at-most-once delivery), even if handling it fails.
+// The dispatcher tracks the values in flight (i.e. popped but not handled yet) and the
+// values delivered by each consumer; shutting it down closes the queue and waits for the
+// consumers to handle the values still in the queue before returning, and DrainAndClose
+// also reports how many values were abandoned if it times out.
+// Pausing the dispatcher stops delivering values to the consumers until it is resumed, e.g.
+// during a downstream outage, while producers keep pushing values to the queue.
+package dispatch
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+// Queue is the set of operations the dispatcher needs from a blocking queue,
+// e.g. a blockingqueue.BlockingQueue.
+type Queue interface {
+	// Pop retrieves and removes the next value, blocking while the queue is empty, until ctx
+	// is done or the queue is closed and drained, in which case an error is returned.
+	Pop(ctx context.Context) (interface{}, error)
+
+	// Close closes the queue, waking up the blocked consumers.
+	Close()
+}
+
+// pauser is implemented by queues that can be paused, e.g. a blockingqueue.BlockingQueue.
+type pauser interface {
+	// Pause stops the queue from delivering values to consumers.
+	Pause()
+
+	// Resume resumes delivering values to consumers.
+	Resume()
+}
+
+// lener is implemented by queues that are able to report their length, e.g. a
+// blockingqueue.BlockingQueue.
+type lener interface {
+	// Len returns the number of values in the queue.
+	Len() int
+}
+
+// Handler handles value v delivered to consumer, numbered from 0.
+// Ctx is canceled if the dispatcher shutdown times out.
+type Handler func(ctx context.Context, consumer int, v interface{})
+
+// Dispatcher represents a group of consumer goroutines fed from a single queue.
+// Dispatcher is safe for concurrent use by multiple goroutines.
+type Dispatcher struct {
+	// q holds the queue the values are popped from.
+	q Queue
+
+	// h holds the handler the values are delivered to.
+	h Handler
+
+	// consumers holds the state of each consumer.
+	consumers []consumer
+
+	// ctx is canceled to stop the consumers without draining the queue.
+	ctx context.Context
+
+	// cancel cancels ctx.
+	cancel context.CancelFunc
+
+	// wg is used to wait for the consumers to exit.
+	wg sync.WaitGroup
+
+	// mu guards popCtx, popCancel and resumed.
+	mu sync.Mutex
+
+	// popCtx is passed to the queue Pop, and is canceled by Pause to interrupt the
+	// consumers waiting for a value.
+	popCtx context.Context
+
+	// popCancel cancels popCtx.
+	popCancel context.CancelFunc
+
+	// resumed is closed once the paused dispatcher is resumed, waking up the waiting consumers;
+	// it is nil while the dispatcher is not paused.
+	resumed chan struct{}
+}
+
+// consumer represents the state of a consumer goroutine.
+type consumer struct {
+	// delivered holds the number of values delivered to the consumer.
+	// Kept as the first field to guarantee its 64-bit alignment.
+	delivered uint64
+
+	// inFlight is 1 while the consumer is handling a value; 0 otherwise.
+	inFlight int32
+
+	// _ keeps each consumer in its own cache line.
+	_ cacheLinePad
+}
+
+// cacheLineSize holds the assumed size of a CPU cache line.
+// It is 64 bytes on most amd64 and arm64 CPUs.
+const cacheLineSize = 64
+
+// cacheLinePad keeps fields updated by different goroutines in different cache lines.
+type cacheLinePad [cacheLineSize]byte
+
+// ConsumerStats holds the statistics of a consumer.
+type ConsumerStats struct {
+	// InFlight holds whether the consumer is handling a value.
+	InFlight bool
+
+	// Delivered holds the number of values delivered to the consumer so far, including
+	// the one in flight, if any.
+	Delivered uint64
+}
+
+// New returns a dispatcher delivering the values of queue q to handler h, starting
+// consumers goroutines, or 1 if consumers is 0 or less.
+// Queue q must not be popped directly afterwards, and must only be closed by Shutdown.
+func New(q Queue, consumers int, h Handler) *Dispatcher {
+	if consumers <= 0 {
+		consumers = 1
+	}
+	d := &Dispatcher{
+		q:         q,
+		h:         h,
+		consumers: make([]consumer, consumers),
+	}
+	d.ctx, d.cancel = context.WithCancel(context.Background())
+	d.popCtx, d.popCancel = context.WithCancel(d.ctx)
+	d.wg.Add(consumers)
+	for i := range d.consumers {
+		go d.consume(i)
+	}
+	return d
+}
+
+// Consumers returns the number of consumers.
+func (d *Dispatcher) Consumers() int { return len(d.consumers) }
+
+// InFlight returns the number of values popped from the queue that are being handled.
+// The complexity is O(c), where c is the number of consumers.
+func (d *Dispatcher) InFlight() int {
+	n := 0
+	for i := range d.consumers {
+		n += int(atomic.LoadInt32(&d.consumers[i].inFlight))
+	}
+	return n
+}
+
+// Stats returns the statistics of consumer i.
+func (d *Dispatcher) Stats(i int) ConsumerStats {
+	c := &d.consumers[i]
+	return ConsumerStats{
+		InFlight:  atomic.LoadInt32(&c.inFlight) != 0,
+		Delivered: atomic.LoadUint64(&c.delivered),
+	}
+}
+
+// Pause stops delivering values to the consumers until Resume is called; the values pushed
+// in the meantime are kept in the queue.
+// Consumers handling a value keep handling it, and a consumer that popped a value while
+// Pause is called still delivers it. If the queue cannot be paused, a consumer waiting for
+// a value when Pause is called may still deliver the next pushed value.
+// Pausing a paused dispatcher has no effect.
+func (d *Dispatcher) Pause() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.resumed == nil {
+		if p, ok := d.q.(pauser); ok {
+			p.Pause()
+		}
+		d.resumed = make(chan struct{})
+		d.popCancel()
+	}
+}
+
+// Resume resumes delivering values to the consumers of the paused dispatcher.
+// Resuming a dispatcher that is not paused has no effect.
+func (d *Dispatcher) Resume() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.resumed != nil {
+		if p, ok := d.q.(pauser); ok {
+			p.Resume()
+		}
+		d.popCtx, d.popCancel = context.WithCancel(d.ctx)
+		close(d.resumed)
+		d.resumed = nil
+	}
+}
+
+// Paused returns whether the dispatcher is paused.
+func (d *Dispatcher) Paused() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.resumed != nil
+}
+
+// Shutdown closes the queue and waits for the consumers to handle all the values left in
+// the queue and exit.
+// If ctx is done first, the consumers are stopped without draining the queue, the context
+// passed to the handlers is canceled and ctx.Err() is returned without waiting for the
+// values in flight.
+// The queue is only drained while the dispatcher is not paused, so shutting down a paused
+// dispatcher waits for it to be resumed or for ctx to be done.
+// Shutdown may be called multiple times.
+func (d *Dispatcher) Shutdown(ctx context.Context) error {
+	_, err := d.DrainAndClose(ctx)
+	return err
+}
+
+// DrainAndClose closes the queue and waits for the consumers to handle all the values left
+// in the queue and exit, like Shutdown.
+// If ctx is done first, it returns ctx.Err() and the number of values abandoned, i.e. the
+// values in flight, whose handlers context is canceled, and, if the queue is able to report
+// its length, the values left in the queue. The count is a snapshot taken when ctx is done,
+// so a value popped by a consumer at that very moment may not be counted.
+// DrainAndClose may be called multiple times.
+func (d *Dispatcher) DrainAndClose(ctx context.Context) (int, error) {
+	d.q.Close()
+
+	done := make(chan struct{})
+	go func() {
+		d.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		d.cancel()
+		return 0, nil
+	case <-ctx.Done():
+		// Count the abandoned values before canceling the handlers, which then stop being in flight.
+		n := d.InFlight()
+		if l, ok := d.q.(lener); ok {
+			n += l.Len()
+		}
+		d.cancel()
+		return n, ctx.Err()
+	}
+}
+
+// consume delivers values to handler h as consumer i until the queue is closed and
+// drained, or the dispatcher is stopped.
+func (d *Dispatcher) consume(i int) {
+	defer d.wg.Done()
+
+	c := &d.consumers[i]
+	for d.ctx.Err() == nil {
+		d.mu.Lock()
+		ctx, resumed := d.popCtx, d.resumed
+		d.mu.Unlock()
+		if resumed != nil {
+			select {
+			case <-resumed:
+			case <-d.ctx.Done():
+			}
+			continue
+		}
+
+		v, err := d.q.Pop(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				// Interrupted by Pause or by the shutdown timing out, checked by the loop.
+				continue
+			}
+			return
+		}
+
+		atomic.StoreInt32(&c.inFlight, 1)
+		atomic.AddUint64(&c.delivered, 1)
+		d.h(d.ctx, i, v)
+		atomic.StoreInt32(&c.inFlight, 0)
+	}
+}
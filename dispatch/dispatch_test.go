@@ -0,0 +1,312 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package dispatch
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/christianrpetrin/queue-tests/blockingqueue"
+	"github.com/christianrpetrin/queue-tests/lockfreequeue"
+)
+
+const (
+	// concurrentCount holds the number of values pushed by each goroutine in the concurrent tests.
+	concurrentCount = 10000
+
+	// goroutines holds the number of producer and consumer goroutines in the concurrent tests.
+	goroutines = 4
+)
+
+// newQueue returns a new blocking queue parking its consumers.
+func newQueue() *blockingqueue.BlockingQueue {
+	return blockingqueue.New(lockfreequeue.New(), blockingqueue.Park)
+}
+
+func TestDispatcherShouldDeliverEachValueToExactlyOneConsumer(t *testing.T) {
+	q := newQueue()
+	var mu sync.Mutex
+	delivered := make(map[int]int)
+	d := New(q, goroutines, func(ctx context.Context, consumer int, v interface{}) {
+		mu.Lock()
+		delivered[v.(int)]++
+		mu.Unlock()
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < concurrentCount; j++ {
+				q.Push(i*concurrentCount + j)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if err := d.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Expected: no error; Got: %v", err)
+	}
+
+	if len(delivered) != goroutines*concurrentCount {
+		t.Errorf("Expected: %d values; Got: %d", goroutines*concurrentCount, len(delivered))
+	}
+	for v, n := range delivered {
+		if n != 1 {
+			t.Errorf("Expected: %d delivered once; Got: delivered %d times", v, n)
+		}
+	}
+	var total uint64
+	for i := 0; i < d.Consumers(); i++ {
+		total += d.Stats(i).Delivered
+	}
+	if total != goroutines*concurrentCount {
+		t.Errorf("Expected: %d delivered values; Got: %d", goroutines*concurrentCount, total)
+	}
+}
+
+func TestDispatcherShouldTrackValuesInFlight(t *testing.T) {
+	q := newQueue()
+	started := make(chan int, goroutines)
+	release := make(chan struct{})
+	d := New(q, goroutines, func(ctx context.Context, consumer int, v interface{}) {
+		started <- consumer
+		<-release
+	})
+
+	for i := 0; i < goroutines; i++ {
+		q.Push(i)
+	}
+	for i := 0; i < goroutines; i++ {
+		<-started
+	}
+	if d.InFlight() != goroutines {
+		t.Errorf("Expected: %d values in flight; Got: %d", goroutines, d.InFlight())
+	}
+	for i := 0; i < goroutines; i++ {
+		if s := d.Stats(i); !s.InFlight || s.Delivered != 1 {
+			t.Errorf("Expected: consumer %d handling its first value; Got: %+v", i, s)
+		}
+	}
+
+	close(release)
+	if err := d.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Expected: no error; Got: %v", err)
+	}
+	if d.InFlight() != 0 {
+		t.Errorf("Expected: %d values in flight; Got: %d", 0, d.InFlight())
+	}
+}
+
+func TestDispatcherShutdownShouldDrainQueue(t *testing.T) {
+	q := newQueue()
+	var mu sync.Mutex
+	var handled []interface{}
+	d := New(q, 1, func(ctx context.Context, consumer int, v interface{}) {
+		time.Sleep(time.Millisecond)
+		mu.Lock()
+		handled = append(handled, v)
+		mu.Unlock()
+	})
+
+	for i := 0; i < 10; i++ {
+		q.Push(i)
+	}
+	if err := d.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Expected: no error; Got: %v", err)
+	}
+	if len(handled) != 10 {
+		t.Fatalf("Expected: %d handled values; Got: %d", 10, len(handled))
+	}
+	for i, v := range handled {
+		if v != i {
+			t.Errorf("Expected: %d; Got: %v", i, v)
+		}
+	}
+	if err := d.Shutdown(context.Background()); err != nil {
+		t.Errorf("Expected: no error on second shutdown; Got: %v", err)
+	}
+}
+
+func TestDispatcherShutdownShouldStopConsumersWhenContextIsDone(t *testing.T) {
+	q := newQueue()
+	d := New(q, 1, func(ctx context.Context, consumer int, v interface{}) {
+		<-ctx.Done()
+	})
+
+	for i := 0; i < 10; i++ {
+		q.Push(i)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := d.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Expected: %v; Got: %v", context.DeadlineExceeded, err)
+	}
+
+	// The canceled consumer exits after handling its value in flight, leaving the other values.
+	for d.InFlight() != 0 {
+		runtime.Gosched()
+	}
+	if s := d.Stats(0); s.Delivered != 1 {
+		t.Errorf("Expected: %d delivered value; Got: %d", 1, s.Delivered)
+	}
+}
+
+func TestDispatcherDrainAndCloseShouldDrainQueue(t *testing.T) {
+	q := newQueue()
+	var mu sync.Mutex
+	var handled []interface{}
+	d := New(q, goroutines, func(ctx context.Context, consumer int, v interface{}) {
+		time.Sleep(time.Millisecond)
+		mu.Lock()
+		handled = append(handled, v)
+		mu.Unlock()
+	})
+
+	for i := 0; i < 10; i++ {
+		q.Push(i)
+	}
+	if n, err := d.DrainAndClose(context.Background()); n != 0 || err != nil {
+		t.Fatalf("Expected: %d, %v; Got: %d, %v", 0, nil, n, err)
+	}
+	if len(handled) != 10 {
+		t.Errorf("Expected: %d handled values; Got: %d", 10, len(handled))
+	}
+	if d.InFlight() != 0 || q.Len() != 0 {
+		t.Errorf("Expected: %d values in flight and in the queue; Got: %d, %d", 0, d.InFlight(), q.Len())
+	}
+}
+
+func TestDispatcherDrainAndCloseShouldReportAbandonedValuesWhenContextIsDone(t *testing.T) {
+	q := newQueue()
+	started := make(chan struct{}, 1)
+	d := New(q, 1, func(ctx context.Context, consumer int, v interface{}) {
+		started <- struct{}{}
+		<-ctx.Done()
+	})
+
+	for i := 0; i < 10; i++ {
+		q.Push(i)
+	}
+	<-started
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	// The value in flight and the ones left in the queue are abandoned.
+	if n, err := d.DrainAndClose(ctx); n != 10 || err != context.DeadlineExceeded {
+		t.Errorf("Expected: %d, %v; Got: %d, %v", 10, context.DeadlineExceeded, n, err)
+	}
+}
+
+func TestDispatcherNewWithInvalidConsumersShouldStartOneConsumer(t *testing.T) {
+	d := New(newQueue(), 0, func(ctx context.Context, consumer int, v interface{}) {})
+	defer d.Shutdown(context.Background())
+
+	if d.Consumers() != 1 {
+		t.Errorf("Expected: %d; Got: %d", 1, d.Consumers())
+	}
+}
+
+func TestDispatcherPauseShouldStopDeliveryUntilResumed(t *testing.T) {
+	q := newQueue()
+	delivered := make(chan interface{}, 10)
+	d := New(q, goroutines, func(ctx context.Context, consumer int, v interface{}) {
+		delivered <- v
+	})
+
+	// Let the consumers block waiting for a value before pausing.
+	time.Sleep(time.Millisecond)
+	d.Pause()
+	d.Pause()
+	if !d.Paused() {
+		t.Error("Expected: paused; Got: not paused")
+	}
+	for i := 0; i < 10; i++ {
+		q.Push(i)
+	}
+	select {
+	case v := <-delivered:
+		t.Errorf("Expected: no value delivered while paused; Got: %v", v)
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	d.Resume()
+	d.Resume()
+	if d.Paused() {
+		t.Error("Expected: not paused; Got: paused")
+	}
+	if err := d.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Expected: no error; Got: %v", err)
+	}
+	if len(delivered) != 10 {
+		t.Errorf("Expected: %d delivered values; Got: %d", 10, len(delivered))
+	}
+}
+
+func TestDispatcherConcurrentPauseResumeShouldDeliverAllValues(t *testing.T) {
+	q := newQueue()
+	var mu sync.Mutex
+	delivered := make(map[int]int)
+	d := New(q, goroutines, func(ctx context.Context, consumer int, v interface{}) {
+		mu.Lock()
+		delivered[v.(int)]++
+		mu.Unlock()
+	})
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				d.Resume()
+				return
+			default:
+				d.Pause()
+				runtime.Gosched()
+				d.Resume()
+				runtime.Gosched()
+			}
+		}
+	}()
+	for i := 0; i < concurrentCount; i++ {
+		q.Push(i)
+	}
+	close(stop)
+	wg.Wait()
+	if err := d.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Expected: no error; Got: %v", err)
+	}
+
+	if len(delivered) != concurrentCount {
+		t.Errorf("Expected: %d values; Got: %d", concurrentCount, len(delivered))
+	}
+	for v, n := range delivered {
+		if n != 1 {
+			t.Errorf("Expected: %d delivered once; Got: delivered %d times", v, n)
+		}
+	}
+}
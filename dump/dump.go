@@ -0,0 +1,108 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package dump implements the diagnostics dump of the queue implementations in this repo,
+// showing their internal shape, e.g. to compare how the implementations grow.
+// Internally, each implementation describes its nodes (i.e. the slices, arrays or ring
+// buffers the values are stored in) from the first to the last one, and this package
+// formats them the same way for all implementations: a summary line with the queue length,
+// the node count and the overall utilization, followed by a line per node with its
+// utilization and, optionally, the previews of its first values.
+package dump
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+// MaxPreviews holds the maximum number of values previewed per node.
+const MaxPreviews = 8
+
+// Node describes a node of a queue.
+type Node struct {
+	// Len holds the number of values in the node.
+	Len int
+
+	// Cap holds the number of values the node is able to hold, including the positions
+	// already popped and the ones not pushed yet.
+	Cap int
+
+	// Values holds the values in the node, from the first to the last one, or at least the
+	// first MaxPreviews of them. It is only used to preview the values, so it may be nil
+	// if no values are previewed.
+	Values []interface{}
+}
+
+// String returns the summary of queue impl holding length values in nodes, in the format
+// used by the String methods of the implementations, e.g.
+//
+//	queueimpl3: len=300 nodes=3 cap=384 utilization=78.1%
+func String(impl string, length int, nodes []Node) string {
+	c := 0
+	for _, n := range nodes {
+		c += n.Cap
+	}
+	return fmt.Sprintf("%s: len=%d nodes=%d cap=%d utilization=%s", impl, length, len(nodes), c, utilization(length, c))
+}
+
+// Write writes the summary of queue impl holding length values in nodes to w, followed by a
+// line per node. If preview is not nil, each node line also holds the first values of the
+// node, formatted using preview, e.g.
+//
+//	queueimpl3: len=300 nodes=3 cap=384 utilization=78.1%
+//	  node 0: len=127 cap=128 utilization=99.2% values=[1 2 3 4 5 6 7 8 ...]
+func Write(w io.Writer, impl string, length int, nodes []Node, preview func(v interface{}) string) error {
+	b := bufio.NewWriter(w)
+	fmt.Fprintln(b, String(impl, length, nodes))
+	for i, n := range nodes {
+		fmt.Fprintf(b, "  node %d: len=%d cap=%d utilization=%s", i, n.Len, n.Cap, utilization(n.Len, n.Cap))
+		if preview != nil {
+			vs := n.Values
+			if len(vs) > MaxPreviews {
+				vs = vs[:MaxPreviews]
+			}
+			b.WriteString(" values=[")
+			for j, v := range vs {
+				if j > 0 {
+					b.WriteByte(' ')
+				}
+				b.WriteString(preview(v))
+			}
+			if n.Len > len(vs) {
+				b.WriteString(" ...")
+			}
+			b.WriteByte(']')
+		}
+		b.WriteByte('\n')
+	}
+	return b.Flush()
+}
+
+// Preview is a preview function formatting values using the default fmt format.
+func Preview(v interface{}) string { return fmt.Sprint(v) }
+
+// utilization returns the percentage of capacity c used by l values.
+func utilization(l, c int) string {
+	if c == 0 {
+		return "0.0%"
+	}
+	return fmt.Sprintf("%.1f%%", float64(l)*100/float64(c))
+}
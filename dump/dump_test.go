@@ -0,0 +1,67 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package dump
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestStringShouldSummarizeNodes(t *testing.T) {
+	nodes := []Node{{Len: 127, Cap: 128}, {Len: 128, Cap: 128}, {Len: 45, Cap: 128}}
+	want := "impl: len=300 nodes=3 cap=384 utilization=78.1%"
+	if s := String("impl", 300, nodes); s != want {
+		t.Errorf("Expected: %q; Got: %q", want, s)
+	}
+
+	want = "impl: len=0 nodes=0 cap=0 utilization=0.0%"
+	if s := String("impl", 0, nil); s != want {
+		t.Errorf("Expected: %q; Got: %q", want, s)
+	}
+}
+
+func TestWriteShouldDescribeEachNode(t *testing.T) {
+	nodes := []Node{
+		{Len: 10, Cap: 16, Values: []interface{}{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}},
+		{Len: 2, Cap: 4, Values: []interface{}{"a", "b"}},
+	}
+	var b bytes.Buffer
+	if err := Write(&b, "impl", 12, nodes, nil); err != nil {
+		t.Fatalf("Expected: no error; Got: %v", err)
+	}
+	want := "impl: len=12 nodes=2 cap=20 utilization=60.0%\n" +
+		"  node 0: len=10 cap=16 utilization=62.5%\n" +
+		"  node 1: len=2 cap=4 utilization=50.0%\n"
+	if b.String() != want {
+		t.Errorf("Expected: %q; Got: %q", want, b.String())
+	}
+
+	b.Reset()
+	if err := Write(&b, "impl", 12, nodes, Preview); err != nil {
+		t.Fatalf("Expected: no error; Got: %v", err)
+	}
+	want = "impl: len=12 nodes=2 cap=20 utilization=60.0%\n" +
+		"  node 0: len=10 cap=16 utilization=62.5% values=[0 1 2 3 4 5 6 7 ...]\n" +
+		"  node 1: len=2 cap=4 utilization=50.0% values=[a b]\n"
+	if b.String() != want {
+		t.Errorf("Expected: %q; Got: %q", want, b.String())
+	}
+}
@@ -0,0 +1,49 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package epoch
+
+import (
+	"testing"
+)
+
+// BenchmarkPin probes the cost of pinning and unpinning a goroutine.
+func BenchmarkPin(b *testing.B) {
+	d := NewDomain(func(v interface{}) {})
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			d.Pin().Unpin()
+		}
+	})
+}
+
+// BenchmarkRetire probes the cost of pinning, retiring an object and unpinning,
+// including the periodic epoch advances and reclamation.
+func BenchmarkRetire(b *testing.B) {
+	d := NewDomain(func(v interface{}) {})
+	b.RunParallel(func(pb *testing.PB) {
+		v := &testObject{}
+		for pb.Next() {
+			g := d.Pin()
+			d.Retire(v)
+			g.Unpin()
+		}
+	})
+}
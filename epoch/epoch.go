@@ -0,0 +1,188 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package epoch implements epoch-based memory reclamation for lock-free data structures.
+// Internally, a domain holds a global epoch counter and a list of participants. Goroutines pin
+// themselves to the current epoch before accessing the data structure, and unpin once done.
+// Objects unlinked from the data structure are retired rather than reused right away; the
+// global epoch only advances once all pinned participants observed the current epoch, and an
+// object retired in epoch e is only reclaimed when the global epoch advances to e+3, when no
+// goroutine can still hold a reference to it.
+// In Go the garbage collector already guarantees memory safety; reclamation lets lock-free data
+// structures recycle their nodes instead of allocating new ones, without being exposed to
+// the ABA problem, and makes the reclamation cost explicit and measurable.
+package epoch
+
+import (
+	"sync"
+	"sync/atomic"
+	"unsafe"
+)
+
+// advanceEvery holds how many objects are retired between attempts to advance the epoch.
+const advanceEvery = 64
+
+// cacheLineSize holds the assumed size of a CPU cache line.
+// It is 64 bytes on most amd64 and arm64 CPUs.
+const cacheLineSize = 64
+
+// cacheLinePad keeps fields updated by different goroutines in different cache lines.
+type cacheLinePad [cacheLineSize]byte
+
+// Domain represents a reclamation domain, usually one per data structure.
+// Domain is safe for concurrent use by multiple goroutines.
+type Domain struct {
+	// epoch holds the global epoch.
+	// Kept as the first field to guarantee its 64-bit alignment.
+	epoch uint64
+
+	// _ keeps participants in a different cache line than epoch.
+	_ cacheLinePad
+
+	// participants points to the first participant of the participants linked list.
+	participants unsafe.Pointer
+
+	// reclaim is called with each object that can be reclaimed.
+	reclaim func(v interface{})
+
+	// mu guards retired and retires, and serializes the epoch updates.
+	mu sync.Mutex
+
+	// retired holds the objects retired in each of the last three epochs, indexed by epoch modulo 3.
+	retired [3][]interface{}
+
+	// retires holds the number of objects retired so far.
+	retires uint64
+}
+
+// participant represents a goroutine that is, or was, pinned to an epoch.
+// Participants are never removed from the domain; instead, inactive ones are reused.
+type participant struct {
+	// state holds the epoch the participant is pinned to, shifted left by one, with the
+	// lowest bit set; or 0 if the participant is inactive.
+	// Kept as the first field to guarantee its 64-bit alignment.
+	state uint64
+
+	// next points to the next participant in the linked list. It is immutable once the
+	// participant is linked.
+	next *participant
+
+	// _ keeps each participant in its own cache line.
+	_ cacheLinePad
+}
+
+// Guard represents a pinned goroutine.
+type Guard struct {
+	// p holds the participant pinned to an epoch.
+	p *participant
+}
+
+// NewDomain returns a new domain calling reclaim with each object that can be reclaimed,
+// i.e. that no goroutine can still hold a reference to.
+// Reclaim may be called by any goroutine retiring objects, while pinned.
+func NewDomain(reclaim func(v interface{})) *Domain {
+	return &Domain{reclaim: reclaim}
+}
+
+// Epoch returns the current global epoch.
+func (d *Domain) Epoch() uint64 { return atomic.LoadUint64(&d.epoch) }
+
+// Pin pins the calling goroutine to the current epoch, so objects it observes in the data
+// structure are not reclaimed until it calls Unpin on the returned guard.
+// Guards must be unpinned promptly, as a pinned guard prevents the epoch from advancing.
+// The complexity is O(p), where p is the largest number of goroutines pinned at the same time.
+func (d *Domain) Pin() Guard {
+	state := atomic.LoadUint64(&d.epoch)<<1 | 1
+	for p := (*participant)(atomic.LoadPointer(&d.participants)); p != nil; p = p.next {
+		if atomic.LoadUint64(&p.state) == 0 && atomic.CompareAndSwapUint64(&p.state, 0, state) {
+			return Guard{p: p}
+		}
+	}
+
+	// All participants are in use, so add a new one.
+	p := &participant{state: state}
+	for {
+		head := atomic.LoadPointer(&d.participants)
+		p.next = (*participant)(head)
+		if atomic.CompareAndSwapPointer(&d.participants, head, unsafe.Pointer(p)) {
+			return Guard{p: p}
+		}
+	}
+}
+
+// Unpin unpins the goroutine pinned by guard g.
+// Guard g must not be used afterwards.
+func (g Guard) Unpin() {
+	atomic.StoreUint64(&g.p.state, 0)
+}
+
+// Retire marks object v, which was unlinked from the data structure, to be reclaimed once
+// no goroutine can still hold a reference to it.
+// Retire may be called while pinned or not.
+// The complexity is O(1), or O(p) when attempting to advance the epoch, where p is the
+// number of participants, not counting the cost of reclaiming objects.
+func (d *Domain) Retire(v interface{}) {
+	d.mu.Lock()
+	e := atomic.LoadUint64(&d.epoch)
+	d.retired[e%3] = append(d.retired[e%3], v)
+	d.retires++
+	advance := d.retires%advanceEvery == 0
+	d.mu.Unlock()
+
+	if advance {
+		d.TryAdvance()
+	}
+}
+
+// TryAdvance advances the global epoch if all pinned goroutines observed the current one,
+// reclaiming the objects retired two epochs before the current one.
+// It returns whether the epoch was advanced.
+// TryAdvance is called periodically by Retire, so it only needs to be called explicitly
+// to reclaim objects sooner, e.g. when the data structure becomes idle.
+func (d *Domain) TryAdvance() bool {
+	e := atomic.LoadUint64(&d.epoch)
+	for p := (*participant)(atomic.LoadPointer(&d.participants)); p != nil; p = p.next {
+		if s := atomic.LoadUint64(&p.state); s&1 == 1 && s>>1 != e {
+			return false
+		}
+	}
+
+	// The epoch is updated while holding the lock, so concurrent Retire calls
+	// either observe epoch e, or epoch e+1 with its bucket already emptied.
+	d.mu.Lock()
+	if atomic.LoadUint64(&d.epoch) != e {
+		d.mu.Unlock()
+		return false
+	}
+	atomic.StoreUint64(&d.epoch, e+1)
+
+	// No goroutine can be pinned to epoch e-1 anymore, so the objects retired in
+	// epoch e-2, whose bucket is reused by epoch e+1, can be reclaimed.
+	bucket := &d.retired[(e+1)%3]
+	vs := *bucket
+	*bucket = nil
+	d.mu.Unlock()
+
+	for i, v := range vs {
+		d.reclaim(v)
+		vs[i] = nil // Avoid memory leaks
+	}
+	return true
+}
@@ -0,0 +1,148 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package epoch
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// testObject is an object retired by the tests.
+type testObject struct {
+	// reclaimed is 1 once the object was reclaimed.
+	reclaimed int32
+}
+
+// reclaimTestObject marks v as reclaimed.
+func reclaimTestObject(v interface{}) {
+	atomic.StoreInt32(&v.(*testObject).reclaimed, 1)
+}
+
+func TestDomainShouldNotReclaimObjectsWhilePinnedToAnOlderEpoch(t *testing.T) {
+	d := NewDomain(reclaimTestObject)
+	g := d.Pin()
+	o := &testObject{}
+	d.Retire(o)
+
+	for i := 0; i < 10; i++ {
+		d.TryAdvance()
+	}
+	if d.Epoch() != 1 {
+		t.Errorf("Expected: epoch %d; Got: %d", 1, d.Epoch())
+	}
+	if atomic.LoadInt32(&o.reclaimed) != 0 {
+		t.Error("Expected: object not reclaimed while pinned; Got: reclaimed")
+	}
+
+	g.Unpin()
+	for i := 0; i < 3; i++ {
+		if !d.TryAdvance() {
+			t.Errorf("Expected: epoch advanced; Got: not advanced")
+		}
+	}
+	if atomic.LoadInt32(&o.reclaimed) != 1 {
+		t.Error("Expected: object reclaimed; Got: not reclaimed")
+	}
+}
+
+func TestDomainShouldReclaimObjectsAfterThreeEpochs(t *testing.T) {
+	d := NewDomain(reclaimTestObject)
+	o := &testObject{}
+	d.Retire(o)
+
+	for i := 0; i < 2; i++ {
+		d.TryAdvance()
+		if atomic.LoadInt32(&o.reclaimed) != 0 {
+			t.Errorf("Expected: object not reclaimed after %d advances; Got: reclaimed", i+1)
+		}
+	}
+	d.TryAdvance()
+	if atomic.LoadInt32(&o.reclaimed) != 1 {
+		t.Error("Expected: object reclaimed; Got: not reclaimed")
+	}
+}
+
+func TestDomainPinShouldReuseInactiveParticipants(t *testing.T) {
+	d := NewDomain(reclaimTestObject)
+	for i := 0; i < 100; i++ {
+		d.Pin().Unpin()
+	}
+	g1, g2 := d.Pin(), d.Pin()
+	g1.Unpin()
+	g2.Unpin()
+
+	n := 0
+	for p := (*participant)(d.participants); p != nil; p = p.next {
+		n++
+	}
+	if n != 2 {
+		t.Errorf("Expected: %d participants; Got: %d", 2, n)
+	}
+}
+
+func TestDomainConcurrentRetireShouldNeverReclaimObservedObjects(t *testing.T) {
+	// Readers observe the current object while pinned, and check it was not
+	// reclaimed; writers replace and retire it.
+	d := NewDomain(reclaimTestObject)
+	var current atomic.Value
+	current.Store(&testObject{})
+
+	var wg sync.WaitGroup
+	var failures int32
+	for w := 0; w < 2; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 10000; i++ {
+				g := d.Pin()
+				old := current.Load().(*testObject)
+				current.Store(&testObject{})
+				d.Retire(old)
+				g.Unpin()
+			}
+		}()
+	}
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 10000; i++ {
+				g := d.Pin()
+				o := current.Load().(*testObject)
+				runtime.Gosched()
+				if atomic.LoadInt32(&o.reclaimed) != 0 {
+					atomic.AddInt32(&failures, 1)
+				}
+				g.Unpin()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if failures != 0 {
+		t.Errorf("Expected: no reclaimed object observed; Got: %d", failures)
+	}
+	if d.Epoch() == 0 {
+		t.Error("Expected: epoch advanced; Got: not advanced")
+	}
+}
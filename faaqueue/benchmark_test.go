@@ -0,0 +1,139 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package faaqueue
+
+import (
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/christianrpetrin/queue-tests/lockfreequeue"
+	"github.com/christianrpetrin/queue-tests/queuetest"
+)
+
+var (
+	// benchGoroutines holds the number of goroutines probed by the benchmark tests.
+	benchGoroutines = []int{1, 4, 16, 64}
+
+	// benchLen stores the polled lengths, avoiding any compiler optimizations.
+	benchLen int64
+)
+
+// BenchmarkContention probes the throughput of the fetch-and-add and the Michael-Scott
+// lock-free queues, with and without epoch-based reclamation, while an increasing number of goroutines each push and pop values in pairs.
+func BenchmarkContention(b *testing.B) {
+	queues := []struct {
+		name string
+		new  func() queuetest.Queue
+	}{
+		{name: "FetchAndAdd", new: func() queuetest.Queue { return New() }},
+		{name: "MichaelScott", new: func() queuetest.Queue { return lockfreequeue.New() }},
+		{name: "FetchAndAddEpoch", new: func() queuetest.Queue { return NewWithReclamation() }},
+		{name: "MichaelScottEpoch", new: func() queuetest.Queue { return lockfreequeue.NewWithReclamation() }},
+	}
+
+	for _, queue := range queues {
+		queue := queue
+		for _, goroutines := range benchGoroutines {
+			goroutines := goroutines
+			b.Run(queue.name+"/"+strconv.Itoa(goroutines), func(b *testing.B) {
+				q := queue.new()
+				perGoroutine := b.N/goroutines + 1
+
+				var wg sync.WaitGroup
+				for g := 0; g < goroutines; g++ {
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+						for n := 0; n < perGoroutine; n++ {
+							q.Push(n)
+							for {
+								if _, ok := q.Pop(); ok {
+									break
+								}
+								runtime.Gosched()
+							}
+						}
+					}()
+				}
+				wg.Wait()
+			})
+		}
+	}
+}
+
+// BenchmarkLenPolling probes the throughput of the fetch-and-add and the Michael-Scott
+// lock-free queues, counting their length using a single atomic counter and a sharded
+// counter, while an increasing number of goroutines each push and pop values in pairs and,
+// with polling, check the queue length every pollEvery pairs, e.g. to apply backpressure.
+func BenchmarkLenPolling(b *testing.B) {
+	const pollEvery = 4
+	queues := []struct {
+		name string
+		new  func() queuetest.Queue
+	}{
+		{name: "FetchAndAdd", new: func() queuetest.Queue { return New() }},
+		{name: "FetchAndAddSharded", new: func() queuetest.Queue { return NewWithShardedLen() }},
+		{name: "MichaelScott", new: func() queuetest.Queue { return lockfreequeue.New() }},
+		{name: "MichaelScottSharded", new: func() queuetest.Queue { return lockfreequeue.NewWithShardedLen() }},
+	}
+
+	for _, queue := range queues {
+		for _, poll := range []bool{false, true} {
+			name := queue.name + "/NoPoll"
+			if poll {
+				name = queue.name + "/Poll"
+			}
+			for _, goroutines := range benchGoroutines {
+				queue, poll, goroutines := queue, poll, goroutines
+				b.Run(name+"/"+strconv.Itoa(goroutines), func(b *testing.B) {
+					q := queue.new()
+					perGoroutine := b.N/goroutines + 1
+
+					var wg sync.WaitGroup
+					for g := 0; g < goroutines; g++ {
+						wg.Add(1)
+						go func() {
+							defer wg.Done()
+							l := 0
+							for n := 0; n < perGoroutine; n++ {
+								q.Push(n)
+								if poll && n%pollEvery == 0 {
+									l += q.Len()
+								}
+								for {
+									if _, ok := q.Pop(); ok {
+										break
+									}
+									runtime.Gosched()
+								}
+							}
+							atomic.AddInt64(&benchLen, int64(l))
+						}()
+					}
+					wg.Wait()
+				})
+			}
+		}
+	}
+}
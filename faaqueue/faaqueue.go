@@ -0,0 +1,333 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package faaqueue implements an unbounded, dynamically growing, lock-free FIFO queue
+// using segments of fetch-and-add indexed cells, in the style of LCRQ.
+// Internally, queue store the values in fixed sized segments that are linked using a singly
+// linked list, like the Michael-Scott queue does with single values. Within a segment,
+// producers and consumers don't contend on a single compare-and-swap of the list head or
+// tail; instead, each of them takes a distinct cell index using an atomic fetch-and-add,
+// and then only competes for that cell with the single consumer (or producer) that took
+// the same index, so most operations succeed at the first attempt under contention.
+// A new segment is only linked, using compare-and-swap, when the tail segment is full.
+//
+// LCRQ, as described by Morrison and Afek in "Fast Concurrent Queues for x86 Processors",
+// reuses each segment as a ring buffer, which requires a double-width compare-and-swap that
+// the Go sync/atomic package doesn't provide. This implementation follows the same design
+// without the ring buffer reuse, as described by Correia and Ramalhete for their FAAArrayQueue:
+// each cell is used at most once, and fully consumed segments are left to the garbage collector
+// or, optionally, reclaimed using epoch-based reclamation and reused as new segments.
+// Reset clears the queue while other goroutines may be using it, returning the removed values.
+// Optionally, the queue length is counted using a sharded counter, so producers and consumers
+// don't contend on a single length counter either, at the cost of a slower Len.
+package faaqueue
+
+import (
+	"sync"
+	"sync/atomic"
+	"unsafe"
+
+	"github.com/christianrpetrin/queue-tests/epoch"
+	"github.com/christianrpetrin/queue-tests/shardcount"
+)
+
+// segmentSize holds the number of cells of each segment.
+const segmentSize = 1024
+
+// taken marks a cell whose value was taken by a consumer, or that a consumer
+// gave up on before a producer stored a value in it.
+var taken = unsafe.Pointer(new(interface{}))
+
+// cacheLineSize holds the assumed size of a CPU cache line.
+// It is 64 bytes on most amd64 and arm64 CPUs.
+const cacheLineSize = 64
+
+// cacheLinePad keeps fields updated by different goroutines in different cache lines.
+type cacheLinePad [cacheLineSize]byte
+
+// FAAQueue represents an unbounded, dynamically growing, lock-free FIFO queue.
+// FAAQueue is safe for concurrent use by multiple producers and consumers.
+// The zero value for queue is not ready to use; use New to create a queue.
+type FAAQueue struct {
+	// len holds the current queue length, unless the length is sharded.
+	// Kept as the first field to guarantee its 64-bit alignment.
+	len int64
+
+	// _ keeps head in a different cache line than len.
+	_ cacheLinePad
+
+	// head points to the first segment of the linked list. It is updated by the consumers.
+	head unsafe.Pointer
+
+	// _ keeps tail in a different cache line than head.
+	_ cacheLinePad
+
+	// tail points to the last segment of the linked list, or to a segment behind it
+	// while a new segment is being linked. It is updated by the producers.
+	tail unsafe.Pointer
+
+	// _ keeps the read-mostly fields below in a different cache line than tail.
+	_ cacheLinePad
+
+	// d holds the reclamation domain of the fully consumed segments, or nil if
+	// they are left to the garbage collector.
+	d *epoch.Domain
+
+	// free holds the reclaimed segments, ready to be reused.
+	free sync.Pool
+
+	// sl holds the queue length if it is sharded, or nil if it is held by len.
+	sl *shardcount.Counter
+}
+
+// testHookYield, if not nil, is called between the atomic steps of the queue operations,
+// so tests can control how concurrent operations interleave.
+var testHookYield func()
+
+// yield calls testHookYield, if set.
+func yield() {
+	if testHookYield != nil {
+		testHookYield()
+	}
+}
+
+// segment represents a queue segment.
+type segment struct {
+	// deq holds the index of the next cell to be taken by a consumer.
+	// Kept as the first field to guarantee its 64-bit alignment.
+	deq int64
+
+	// _ keeps enq in a different cache line than deq.
+	_ cacheLinePad
+
+	// enq holds the index of the next cell to be taken by a producer.
+	enq int64
+
+	// _ keeps the cells in a different cache line than enq.
+	_ cacheLinePad
+
+	// cells holds pointers to the segment values. A nil cell was not used yet.
+	cells [segmentSize]unsafe.Pointer
+
+	// next points to the next segment in the linked list.
+	next unsafe.Pointer
+}
+
+// New returns an initialized queue.
+func New() *FAAQueue {
+	return new(FAAQueue).Init()
+}
+
+// NewWithReclamation returns an initialized queue that reclaims the fully consumed segments
+// using epoch-based reclamation and reuses them as new segments, reducing the allocation
+// rate and the garbage collector load at the cost of pinning each operation to an epoch.
+func NewWithReclamation() *FAAQueue {
+	q := new(FAAQueue)
+	q.d = epoch.NewDomain(q.reclaim)
+	return q.Init()
+}
+
+// NewWithShardedLen returns an initialized queue that counts its length using a sharded
+// counter, so producers and consumers running on different Ps update different cache lines,
+// instead of all of them contending on a single length counter after taking distinct cells.
+// Len sums all shards, so it costs O(p), where p is GOMAXPROCS, rather than O(1).
+func NewWithShardedLen() *FAAQueue {
+	q := new(FAAQueue)
+	q.sl = shardcount.New()
+	return q.Init()
+}
+
+// Init initializes or clears queue q.
+// Init is not safe for concurrent use with any other queue q method; use Reset to clear
+// a queue other goroutines may be using.
+func (q *FAAQueue) Init() *FAAQueue {
+	s := unsafe.Pointer(new(segment))
+	atomic.StorePointer(&q.head, s)
+	atomic.StorePointer(&q.tail, s)
+	atomic.StoreInt64(&q.len, 0)
+	if q.sl != nil {
+		q.sl.Reset()
+	}
+	return q
+}
+
+// Len returns the number of elements of queue q.
+// As values are added and removed concurrently, the returned length may be stale.
+// The complexity is O(1), or O(p) if the length is sharded, where p is GOMAXPROCS.
+func (q *FAAQueue) Len() int {
+	l := int64(0)
+	if q.sl != nil {
+		l = q.sl.Load()
+	} else {
+		l = atomic.LoadInt64(&q.len)
+	}
+	// Values are counted after being stored, so a concurrent pop may
+	// temporarily make the length negative.
+	if l > 0 {
+		return int(l)
+	}
+	return 0
+}
+
+// addLen adds delta to the queue length.
+func (q *FAAQueue) addLen(delta int64) {
+	if q.sl != nil {
+		q.sl.Add(delta)
+	} else {
+		atomic.AddInt64(&q.len, delta)
+	}
+}
+
+// Push adds a value to the queue.
+// The complexity is O(1).
+func (q *FAAQueue) Push(v interface{}) {
+	if q.d != nil {
+		g := q.d.Pin()
+		defer g.Unpin()
+	}
+
+	p := unsafe.Pointer(&v)
+	for {
+		tail := (*segment)(atomic.LoadPointer(&q.tail))
+		yield()
+		i := atomic.AddInt64(&tail.enq, 1) - 1
+		yield()
+		if i < segmentSize {
+			if atomic.CompareAndSwapPointer(&tail.cells[i], nil, p) {
+				break
+			}
+			// A consumer gave up on the cell, so take another one.
+			continue
+		}
+
+		// The segment is full, so link a new one holding v, or help a
+		// concurrent producer that already linked one.
+		if unsafe.Pointer(tail) != atomic.LoadPointer(&q.tail) {
+			continue
+		}
+		next := atomic.LoadPointer(&tail.next)
+		yield()
+		if next == nil {
+			s := q.newSegment()
+			s.enq = 1
+			s.cells[0] = p
+			if atomic.CompareAndSwapPointer(&tail.next, nil, unsafe.Pointer(s)) {
+				yield()
+				atomic.CompareAndSwapPointer(&q.tail, unsafe.Pointer(tail), unsafe.Pointer(s))
+				break
+			}
+			if q.d != nil {
+				// s was never linked, so it can be reused right away.
+				s.enq = 0
+				s.cells[0] = nil
+				q.free.Put(s)
+			}
+		} else {
+			atomic.CompareAndSwapPointer(&q.tail, unsafe.Pointer(tail), next)
+		}
+	}
+	q.addLen(1)
+}
+
+// Pop retrieves and removes the next element from the queue.
+// The second, bool result indicates whether a valid value was returned;
+//   if the queue is empty, false will be returned.
+// The complexity is O(1).
+func (q *FAAQueue) Pop() (interface{}, bool) {
+	if q.d != nil {
+		g := q.d.Pin()
+		defer g.Unpin()
+	}
+
+	for {
+		head := (*segment)(atomic.LoadPointer(&q.head))
+		yield()
+		if atomic.LoadInt64(&head.deq) >= atomic.LoadInt64(&head.enq) && atomic.LoadPointer(&head.next) == nil {
+			return nil, false
+		}
+		yield()
+
+		i := atomic.AddInt64(&head.deq, 1) - 1
+		yield()
+		if i >= segmentSize {
+			// The segment was fully consumed, so move to the next one.
+			next := atomic.LoadPointer(&head.next)
+			if next == nil {
+				return nil, false
+			}
+			// Tail must not fall behind head, so help the producer linking next advance it.
+			atomic.CompareAndSwapPointer(&q.tail, unsafe.Pointer(head), next)
+			yield()
+			if atomic.CompareAndSwapPointer(&q.head, unsafe.Pointer(head), next) && q.d != nil {
+				// Both head and tail are past the segment, so it is no longer reachable.
+				q.d.Retire(head)
+			}
+			continue
+		}
+
+		// Mark the cell as taken, so that if the producer that took the same
+		// index didn't store its value yet, it gives up on the cell.
+		p := atomic.SwapPointer(&head.cells[i], taken)
+		if p == nil {
+			continue
+		}
+		q.addLen(-1)
+		return *(*interface{})(p), true
+	}
+}
+
+// Reset removes all elements from queue q, returning them from the first to the last one,
+// so values displaced by clearing a queue in use are not lost.
+// Reset is safe for concurrent use with the other queue q methods, as it pops the values
+// one at a time until the queue is observed empty: each value is returned either by Reset
+// or by a concurrent Pop, never both, and values pushed concurrently with Reset are either
+// returned by it or left in the queue.
+// Reset may not return while producers keep pushing values faster than it removes them.
+// The complexity is O(n), where n is the number of removed elements.
+func (q *FAAQueue) Reset() []interface{} {
+	var vs []interface{}
+	for {
+		v, ok := q.Pop()
+		if !ok {
+			return vs
+		}
+		vs = append(vs, v)
+	}
+}
+
+// newSegment returns an empty segment, reusing a reclaimed segment if available.
+func (q *FAAQueue) newSegment() *segment {
+	if s, ok := q.free.Get().(*segment); ok {
+		return s
+	}
+	return new(segment)
+}
+
+// reclaim clears the retired segment v and makes it available for reuse.
+func (q *FAAQueue) reclaim(v interface{}) {
+	s := v.(*segment)
+	for i := range s.cells {
+		atomic.StorePointer(&s.cells[i], nil) // Avoid memory leaks
+	}
+	atomic.StorePointer(&s.next, nil)
+	atomic.StoreInt64(&s.deq, 0)
+	atomic.StoreInt64(&s.enq, 0)
+	q.free.Put(s)
+}
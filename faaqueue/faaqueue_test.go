@@ -0,0 +1,473 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package faaqueue
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/christianrpetrin/queue-tests/queuetest"
+	"github.com/christianrpetrin/queue-tests/schedtest"
+)
+
+const (
+	// concurrentCount holds the number of values pushed by each goroutine in the concurrent tests.
+	concurrentCount = 10000
+
+	// goroutines holds the number of producer and consumer goroutines in the concurrent tests.
+	goroutines = 4
+
+	// maxInterleavings holds the maximum number of interleavings explored by the scheduled tests.
+	maxInterleavings = 100000
+
+	// randomSchedules holds the number of random schedules run by the scheduled tests.
+	randomSchedules = 100
+)
+
+// constructors holds the queue constructors probed by the scheduled tests.
+var constructors = map[string]func() *FAAQueue{
+	"GC":          New,
+	"Reclamation": NewWithReclamation,
+	"ShardedLen":  NewWithShardedLen,
+}
+
+func TestFAAQueueNewQueueShouldReturnInitiazedInstanceOfQueue(t *testing.T) {
+	q := New()
+
+	if q == nil {
+		t.Error("Expected: new instance of queue; Got: nil")
+	}
+	if v, ok := q.Pop(); ok || v != nil {
+		t.Errorf("Expected: nil as the queue should be empty; Got: %d", v)
+	}
+}
+
+func TestFAAQueuePushPopShouldRetrieveAllElementsInOrder(t *testing.T) {
+	q := New()
+	for r := 0; r < 2; r++ {
+		// Span multiple segments.
+		for i := 0; i < 3*segmentSize; i++ {
+			q.Push(i)
+		}
+		if q.Len() != 3*segmentSize {
+			t.Errorf("Expected: %d; Got: %d", 3*segmentSize, q.Len())
+		}
+
+		for i := 0; i < 3*segmentSize; i++ {
+			if v, ok := q.Pop(); !ok || v.(int) != i {
+				t.Errorf("Expected: %d; Got: %d", i, v)
+			}
+		}
+		if v, ok := q.Pop(); ok || v != nil {
+			t.Errorf("Expected: nil as the queue should be empty; Got: %d", v)
+		}
+		if q.Len() != 0 {
+			t.Errorf("Expected: %d; Got: %d", 0, q.Len())
+		}
+	}
+}
+
+func TestFAAQueueWithNilValuesShouldReturnAllValuesInOrder(t *testing.T) {
+	q := New()
+	q.Push(1)
+	q.Push(nil)
+	q.Push(2)
+
+	for _, expected := range []interface{}{1, nil, 2} {
+		if v, ok := q.Pop(); !ok || v != expected {
+			t.Errorf("Expected: %v; Got: %v", expected, v)
+		}
+	}
+}
+
+func TestFAAQueueInitShouldClearQueue(t *testing.T) {
+	q := New()
+	q.Push(1)
+	q.Init()
+
+	if q.Len() != 0 {
+		t.Errorf("Expected: %d; Got: %d", 0, q.Len())
+	}
+	if v, ok := q.Pop(); ok || v != nil {
+		t.Errorf("Expected: nil as the queue should be empty; Got: %d", v)
+	}
+}
+
+func TestFAAQueueResetShouldReturnAllElementsInOrder(t *testing.T) {
+	q := New()
+	if vs := q.Reset(); len(vs) != 0 {
+		t.Errorf("Expected: no values as the queue is empty; Got: %v", vs)
+	}
+
+	count := 300
+	for i := 0; i < count; i++ {
+		q.Push(i)
+	}
+	vs := q.Reset()
+	if len(vs) != count {
+		t.Fatalf("Expected: %d; Got: %d", count, len(vs))
+	}
+	for i, v := range vs {
+		if v != i {
+			t.Fatalf("Expected: %d; Got: %v", i, v)
+		}
+	}
+	if q.Len() != 0 {
+		t.Errorf("Expected: %d; Got: %d", 0, q.Len())
+	}
+	if v, ok := q.Pop(); ok || v != nil {
+		t.Errorf("Expected: nil as the queue should be empty; Got: %d", v)
+	}
+
+	q.Push(1)
+	if v, ok := q.Pop(); !ok || v != 1 {
+		t.Errorf("Expected: 1; Got: %v", v)
+	}
+}
+
+func TestFAAQueueConcurrentPushPopResetShouldRetrieveAllElementsOnce(t *testing.T) {
+	q := New()
+	queuetest.CheckConcurrentReset(t, "faaqueue", q, goroutines, concurrentCount)
+}
+
+func TestFAAQueueWithReclamationResetShouldReturnAllElementsInOrder(t *testing.T) {
+	q := NewWithReclamation()
+	if vs := q.Reset(); len(vs) != 0 {
+		t.Errorf("Expected: no values as the queue is empty; Got: %v", vs)
+	}
+
+	count := 300
+	for i := 0; i < count; i++ {
+		q.Push(i)
+	}
+	vs := q.Reset()
+	if len(vs) != count {
+		t.Fatalf("Expected: %d; Got: %d", count, len(vs))
+	}
+	for i, v := range vs {
+		if v != i {
+			t.Fatalf("Expected: %d; Got: %v", i, v)
+		}
+	}
+	if q.Len() != 0 {
+		t.Errorf("Expected: %d; Got: %d", 0, q.Len())
+	}
+	if v, ok := q.Pop(); ok || v != nil {
+		t.Errorf("Expected: nil as the queue should be empty; Got: %d", v)
+	}
+
+	q.Push(1)
+	if v, ok := q.Pop(); !ok || v != 1 {
+		t.Errorf("Expected: 1; Got: %v", v)
+	}
+}
+
+func TestFAAQueueWithReclamationConcurrentPushPopResetShouldRetrieveAllElementsOnce(t *testing.T) {
+	q := NewWithReclamation()
+	queuetest.CheckConcurrentReset(t, "faaqueue", q, goroutines, concurrentCount)
+}
+
+func TestFAAQueueConcurrentPushPopShouldRetrieveAllElements(t *testing.T) {
+	testConcurrentPushPop(t, New())
+}
+
+func TestFAAQueueWithReclamationConcurrentPushPopShouldRetrieveAllElements(t *testing.T) {
+	testConcurrentPushPop(t, NewWithReclamation())
+}
+
+func TestFAAQueueWithShardedLenConcurrentPushPopShouldRetrieveAllElements(t *testing.T) {
+	q := NewWithShardedLen()
+	testConcurrentPushPop(t, q)
+	if q.Len() != 0 {
+		t.Errorf("Expected: %d; Got: %d", 0, q.Len())
+	}
+}
+
+func TestFAAQueueWithShardedLenLenShouldReturnLengthAfterCompletedOperations(t *testing.T) {
+	q := NewWithShardedLen()
+	for i := 0; i < 2*segmentSize; i++ {
+		q.Push(i)
+	}
+	q.Pop()
+	if q.Len() != 2*segmentSize-1 {
+		t.Errorf("Expected: %d; Got: %d", 2*segmentSize-1, q.Len())
+	}
+
+	q.Reset()
+	if q.Len() != 0 {
+		t.Errorf("Expected: %d after Reset; Got: %d", 0, q.Len())
+	}
+	q.Push(1)
+	q.Init()
+	if q.Len() != 0 {
+		t.Errorf("Expected: %d after Init; Got: %d", 0, q.Len())
+	}
+}
+
+func TestFAAQueueWithReclamationShouldReuseClearedSegments(t *testing.T) {
+	q := NewWithReclamation()
+	for i := 0; i < 10*segmentSize; i++ {
+		q.Push(i)
+		if v, ok := q.Pop(); !ok || v != i {
+			t.Fatalf("Expected: %d; Got: %v", i, v)
+		}
+	}
+
+	s := q.newSegment()
+	if s.deq != 0 || s.enq != 0 || s.next != nil {
+		t.Errorf("Expected: cleared reclaimed segment; Got: deq=%d, enq=%d, next=%v", s.deq, s.enq, s.next)
+	}
+	for i, c := range s.cells {
+		if c != nil {
+			t.Fatalf("Expected: cleared cell %d; Got: %v", i, c)
+		}
+	}
+}
+
+// testConcurrentPushPop pushes values to queue q from multiple producers while multiple
+// consumers pop them, and verifies every value is popped exactly once.
+func testConcurrentPushPop(t *testing.T, q *FAAQueue) {
+	var wg sync.WaitGroup
+	for p := 0; p < goroutines; p++ {
+		wg.Add(1)
+		go func(p int) {
+			defer wg.Done()
+			for i := 0; i < concurrentCount; i++ {
+				q.Push(p*concurrentCount + i)
+			}
+		}(p)
+	}
+
+	seen := make([]bool, goroutines*concurrentCount)
+	var mu sync.Mutex
+	for c := 0; c < goroutines; c++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < concurrentCount; {
+				v, ok := q.Pop()
+				if !ok {
+					runtime.Gosched()
+					continue
+				}
+				mu.Lock()
+				if seen[v.(int)] {
+					t.Errorf("Expected: %d to be popped once; Got: popped twice", v)
+				}
+				seen[v.(int)] = true
+				mu.Unlock()
+				i++
+			}
+		}()
+	}
+	wg.Wait()
+
+	for i, s := range seen {
+		if !s {
+			t.Errorf("Expected: %d to be popped; Got: not popped", i)
+		}
+	}
+}
+
+func TestFAAQueueConcurrentPushShouldKeepProducerOrder(t *testing.T) {
+	q := New()
+	var wg sync.WaitGroup
+	for p := 0; p < goroutines; p++ {
+		wg.Add(1)
+		go func(p int) {
+			defer wg.Done()
+			for i := 0; i < concurrentCount; i++ {
+				q.Push(p*concurrentCount + i)
+			}
+		}(p)
+	}
+
+	// A single consumer must see the values of each producer in push order.
+	last := make([]int, goroutines)
+	for i := range last {
+		last[i] = -1
+	}
+	for popped := 0; popped < goroutines*concurrentCount; {
+		v, ok := q.Pop()
+		if !ok {
+			runtime.Gosched()
+			continue
+		}
+		p, i := v.(int)/concurrentCount, v.(int)%concurrentCount
+		if i != last[p]+1 {
+			t.Fatalf("Expected: %d; Got: %d", p*concurrentCount+last[p]+1, v)
+		}
+		last[p] = i
+		popped++
+	}
+	wg.Wait()
+}
+
+func TestFAAQueueEveryInterleavingOfPushPopShouldPopEachValueOnce(t *testing.T) {
+	for name, newQueue := range constructors {
+		testEveryInterleaving(t, name, testPushPop(newQueue, 0))
+	}
+}
+
+func TestFAAQueueRandomSchedulesOfPushPopAcrossSegmentsShouldPopEachValueOnce(t *testing.T) {
+	// Consumers can make producers retry indefinitely by taking the cells they are about to
+	// store their values in, so the interleavings across a segment boundary are unbounded
+	// and are only sampled.
+	for name, newQueue := range constructors {
+		var s schedtest.Scheduler
+		testHookYield = s.Yield
+		test := testPushPop(newQueue, segmentSize-1)
+		for seed := int64(0); seed < 10*randomSchedules; seed++ {
+			if err := test(&s, schedtest.Random(seed)); err != nil {
+				t.Fatalf("%s: seed %d: %v", name, seed, err)
+			}
+		}
+		testHookYield = nil
+	}
+}
+
+// testPushPop returns a scheduled test where two threads push a value each and then pop a
+// value each, on a queue built using newQueue where prefill values were pushed and popped.
+// Prefilling the queue with segmentSize-1 values makes the threads cross a segment boundary.
+func testPushPop(newQueue func() *FAAQueue, prefill int) func(s *schedtest.Scheduler, choose schedtest.Chooser) error {
+	return func(s *schedtest.Scheduler, choose schedtest.Chooser) error {
+		q := newQueue()
+		for i := 0; i < prefill; i++ {
+			q.Push(i)
+			q.Pop()
+		}
+		var popped [2]interface{}
+		var ok [2]bool
+		thread := func(i int) func() {
+			return func() {
+				q.Push(i)
+				popped[i], ok[i] = q.Pop()
+			}
+		}
+
+		schedule, err := s.Run(choose, thread(0), thread(1))
+		if err != nil {
+			return err
+		}
+		if !ok[0] || !ok[1] || popped[0] == popped[1] || q.Len() != 0 {
+			return fmt.Errorf("schedule %v: popped %v, %v with %d values left", schedule, popped, ok, q.Len())
+		}
+		return nil
+	}
+}
+
+func TestFAAQueueEveryInterleavingOfConcurrentPopsShouldPopValueOnce(t *testing.T) {
+	for name, newQueue := range constructors {
+		testEveryInterleaving(t, name, func(s *schedtest.Scheduler, choose schedtest.Chooser) error {
+			q := newQueue()
+			q.Push(1)
+			var ok [2]bool
+			schedule, err := s.Run(choose,
+				func() { _, ok[0] = q.Pop() },
+				func() { _, ok[1] = q.Pop() })
+			if err != nil {
+				return err
+			}
+			if ok[0] == ok[1] {
+				return fmt.Errorf("schedule %v: pops returned %v", schedule, ok)
+			}
+			return nil
+		})
+	}
+}
+
+func TestFAAQueueRandomSchedulesShouldPopEachValueOnce(t *testing.T) {
+	// Enough values are pushed and popped to fill multiple segments, advance the epoch and
+	// reuse the reclaimed segments.
+	const threads, values = 3, segmentSize
+	for name, newQueue := range constructors {
+		var s schedtest.Scheduler
+		s.MaxSteps = 100 * threads * values
+		testHookYield = s.Yield
+		for seed := int64(0); seed < randomSchedules/10; seed++ {
+			q := newQueue()
+			seen := make([]int, threads*values)
+			var fns []func()
+			for i := 0; i < threads; i++ {
+				i := i
+				fns = append(fns, func() {
+					for j := 0; j < values; j++ {
+						q.Push(i*values + j)
+						if v, ok := q.Pop(); ok {
+							seen[v.(int)]++
+						}
+					}
+				})
+			}
+			if _, err := s.Run(schedtest.Random(seed), fns...); err != nil {
+				t.Fatalf("%s: seed %d: %v", name, seed, err)
+			}
+
+			for v, ok := q.Pop(); ok; v, ok = q.Pop() {
+				seen[v.(int)]++
+			}
+			for v, n := range seen {
+				if n != 1 {
+					t.Fatalf("%s: seed %d: Expected: %d popped once; Got: popped %d times", name, seed, v, n)
+				}
+			}
+		}
+		testHookYield = nil
+	}
+}
+
+// testEveryInterleaving runs test for every interleaving of the queue operations run by
+// test, reporting the first failing interleaving of the queue built using constructor name.
+func testEveryInterleaving(t *testing.T, name string, test func(s *schedtest.Scheduler, choose schedtest.Chooser) error) {
+	var s schedtest.Scheduler
+	testHookYield = s.Yield
+	defer func() { testHookYield = nil }()
+
+	runs, err := schedtest.Explore(maxInterleavings, func(choose schedtest.Chooser) error {
+		return test(&s, choose)
+	})
+	if err != nil {
+		t.Errorf("%s: %v", name, err)
+	}
+	if runs >= maxInterleavings {
+		t.Errorf("%s: Expected: less than %d interleavings; Got: %d", name, maxInterleavings, runs)
+	}
+}
+
+func TestFAAQueueProducerOrderShouldHoldWithPreemptionsInsideOperations(t *testing.T) {
+	in := queuetest.NewInjector(queuetest.Faults{Seed: 1, Points: queuetest.Inside, Preempt: 0.5})
+	testHookYield = in.Inside
+	defer func() { testHookYield = nil }()
+
+	for name, newQueue := range constructors {
+		newQueue := newQueue
+		impl := queuetest.ConcurrentImpl{Name: name, New: func() queuetest.ConcurrentQueue { return newQueue() }}
+		queuetest.CheckNoDeadlock(t, time.Minute, func() {
+			queuetest.CheckProducerOrder(t, impl, goroutines, goroutines, concurrentCount/10)
+		})
+	}
+	if in.Stats().Preemptions == 0 {
+		t.Error("Expected: injected preemptions; Got: none")
+	}
+}
@@ -0,0 +1,82 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package fcqueue
+
+import (
+	"runtime"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/christianrpetrin/queue-tests/lockfreequeue"
+	"github.com/christianrpetrin/queue-tests/safequeue"
+)
+
+// benchGoroutines holds the number of goroutines probed by the benchmark tests.
+var benchGoroutines = []int{1, 4, 16, 64}
+
+// concurrentQueue is the set of operations the benchmark tests need from a concurrent queue.
+type concurrentQueue interface {
+	Push(v interface{})
+	Pop() (interface{}, bool)
+}
+
+// BenchmarkConcurrentQueue probes the throughput of concurrent queues while an increasing
+// number of goroutines each push and pop values in pairs.
+func BenchmarkConcurrentQueue(b *testing.B) {
+	queues := []struct {
+		name string
+		new  func() concurrentQueue
+	}{
+		{name: "FlatCombining", new: func() concurrentQueue { return New() }},
+		{name: "Mutex", new: func() concurrentQueue { return safequeue.New() }},
+		{name: "LockFree", new: func() concurrentQueue { return lockfreequeue.New() }},
+	}
+
+	for _, queue := range queues {
+		queue := queue
+		for _, goroutines := range benchGoroutines {
+			goroutines := goroutines
+			b.Run(queue.name+"/"+strconv.Itoa(goroutines), func(b *testing.B) {
+				q := queue.new()
+				perGoroutine := b.N/goroutines + 1
+
+				var wg sync.WaitGroup
+				for g := 0; g < goroutines; g++ {
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+						for n := 0; n < perGoroutine; n++ {
+							q.Push(n)
+							for {
+								if _, ok := q.Pop(); ok {
+									break
+								}
+								runtime.Gosched()
+							}
+						}
+					}()
+				}
+				wg.Wait()
+			})
+		}
+	}
+}
@@ -0,0 +1,231 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package fcqueue implements an unbounded, dynamically growing, thread-safe FIFO queue
+// using flat combining.
+// Internally, queue wraps a sequential queueimpl3 queue. Instead of each goroutine acquiring
+// a lock to apply its own operation, goroutines publish their operations to an array of slots,
+// and whichever goroutine acquires the combiner lock applies all published operations in a
+// single batch, as described by Hendler, Incze, Shavit and Tzafrir in "Flat Combining and the
+// Synchronization-Parallelism Tradeoff". The queue internals are only touched by the combiner,
+// so they stay in its cache, and the lock is acquired once per batch rather than once per operation.
+// Reset clears the queue while other goroutines may be using it, returning the removed values.
+package fcqueue
+
+import (
+	"runtime"
+	"sync/atomic"
+
+	"github.com/christianrpetrin/queue-tests/queueimpl3"
+)
+
+const (
+	// slotFree means the slot can be claimed by a goroutine.
+	slotFree int32 = iota
+
+	// slotClaimed means a goroutine is publishing an operation to the slot.
+	slotClaimed
+
+	// slotPending means the slot holds an operation waiting to be applied by the combiner.
+	slotPending
+
+	// slotDone means the slot operation was applied, and its result is ready.
+	slotDone
+)
+
+const (
+	// opPush pushes the slot value.
+	opPush = iota
+
+	// opPop pops a value into the slot.
+	opPop
+
+	// opFront reads the first value into the slot.
+	opFront
+
+	// opReset removes all values into the slot.
+	opReset
+)
+
+// combinePasses holds the maximum number of passes over the slots the combiner
+// makes per batch, so operations published while combining join the batch.
+const combinePasses = 3
+
+// cacheLineSize holds the assumed size of a CPU cache line.
+// It is 64 bytes on most amd64 and arm64 CPUs.
+const cacheLineSize = 64
+
+// cacheLinePad keeps fields updated by different goroutines in different cache lines.
+type cacheLinePad [cacheLineSize]byte
+
+// FCQueue represents an unbounded, dynamically growing, thread-safe FIFO queue using flat combining.
+// The zero value for queue is not ready to use; use New to create a queue.
+type FCQueue struct {
+	// len holds the current queue length. It is updated by the combiner.
+	// Kept as the first field to guarantee its 64-bit alignment.
+	len int64
+
+	// lock is 1 while a goroutine is acting as the combiner; 0 otherwise.
+	lock int32
+
+	// next holds the index of the slot the next operation starts looking for a free slot from.
+	next uint32
+
+	// _ keeps q in a different cache line than the fields above.
+	_ cacheLinePad
+
+	// q holds the queue values. It is only accessed by the combiner.
+	q queueimpl3.Queueimpl3
+
+	// slots holds the publication slots.
+	slots []slot
+}
+
+// slot represents a publication slot.
+type slot struct {
+	// state holds the slot state.
+	state int32
+
+	// op holds the published operation.
+	op int
+
+	// v holds the value to push, or the value popped or read by the combiner.
+	v interface{}
+
+	// ok holds whether the combiner popped or read a valid value.
+	ok bool
+
+	// _ keeps each slot in its own cache line.
+	_ cacheLinePad
+}
+
+// New returns an initialized queue with a publication slot for each potentially concurrent operation.
+func New() *FCQueue {
+	return &FCQueue{slots: make([]slot, 4*runtime.GOMAXPROCS(0))}
+}
+
+// Len returns the number of elements of queue q.
+// As values are added and removed concurrently, the returned length may be stale.
+// The complexity is O(1).
+func (q *FCQueue) Len() int { return int(atomic.LoadInt64(&q.len)) }
+
+// Front returns the first element of queue q or nil if the queue is empty.
+// The second, bool result indicates whether a valid value was returned;
+//   if the queue is empty, false will be returned.
+// Note the returned value may have been popped already by the time Front returns.
+// The complexity is O(1), not counting the time spent waiting for the combiner.
+func (q *FCQueue) Front() (interface{}, bool) {
+	return q.do(opFront, nil)
+}
+
+// Push adds a value to the queue.
+// The complexity is O(1), not counting the time spent waiting for the combiner.
+func (q *FCQueue) Push(v interface{}) {
+	q.do(opPush, v)
+}
+
+// Pop retrieves and removes the next element from the queue.
+// The second, bool result indicates whether a valid value was returned;
+//   if the queue is empty, false will be returned.
+// The complexity is O(1), not counting the time spent waiting for the combiner.
+func (q *FCQueue) Pop() (interface{}, bool) {
+	return q.do(opPop, nil)
+}
+
+// Reset atomically removes all elements from queue q, returning them from the first to
+// the last one, so values displaced by clearing a queue in use are not lost.
+// Reset is applied by the combiner like any other operation, so values pushed concurrently
+// with Reset are either returned by it or left in the queue.
+// The complexity is O(n), where n is the number of removed elements, not counting the time
+// spent waiting for the combiner.
+func (q *FCQueue) Reset() []interface{} {
+	v, _ := q.do(opReset, nil)
+	return v.([]interface{})
+}
+
+// do publishes operation op with value v and waits for it to be applied, acting as
+// the combiner if no other goroutine is.
+func (q *FCQueue) do(op int, v interface{}) (interface{}, bool) {
+	s := q.claim()
+	s.op = op
+	s.v = v
+	atomic.StoreInt32(&s.state, slotPending)
+
+	for atomic.LoadInt32(&s.state) != slotDone {
+		if atomic.CompareAndSwapInt32(&q.lock, 0, 1) {
+			q.combine()
+			atomic.StoreInt32(&q.lock, 0)
+			continue
+		}
+		runtime.Gosched()
+	}
+
+	v, ok := s.v, s.ok
+	s.v = nil // Avoid memory leaks
+	atomic.StoreInt32(&s.state, slotFree)
+	return v, ok
+}
+
+// claim returns a free slot, after marking it as claimed.
+func (q *FCQueue) claim() *slot {
+	for i := atomic.AddUint32(&q.next, 1); ; i++ {
+		s := &q.slots[i%uint32(len(q.slots))]
+		if atomic.LoadInt32(&s.state) == slotFree && atomic.CompareAndSwapInt32(&s.state, slotFree, slotClaimed) {
+			return s
+		}
+		if i%uint32(len(q.slots)) == 0 {
+			// All slots may be in use, so let their operations complete.
+			runtime.Gosched()
+		}
+	}
+}
+
+// combine applies all pending operations.
+// The combiner lock must be held.
+func (q *FCQueue) combine() {
+	for pass := 0; pass < combinePasses; pass++ {
+		applied := 0
+		for i := range q.slots {
+			s := &q.slots[i]
+			if atomic.LoadInt32(&s.state) != slotPending {
+				continue
+			}
+			switch s.op {
+			case opPush:
+				q.q.Push(s.v)
+				s.v, s.ok = nil, true
+			case opPop:
+				s.v, s.ok = q.q.Pop()
+			case opFront:
+				s.v, s.ok = q.q.Front()
+			case opReset:
+				vs := make([]interface{}, q.q.Len())
+				q.q.PopN(vs)
+				s.v, s.ok = vs, true
+			}
+			atomic.StoreInt32(&s.state, slotDone)
+			applied++
+		}
+		if applied == 0 {
+			break
+		}
+	}
+	atomic.StoreInt64(&q.len, int64(q.q.Len()))
+}
@@ -0,0 +1,182 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package fcqueue
+
+import (
+	"runtime"
+	"sync"
+	"testing"
+
+	"github.com/christianrpetrin/queue-tests/queuetest"
+)
+
+const (
+	// concurrentCount holds the number of values pushed by each goroutine in the concurrent tests.
+	concurrentCount = 10000
+
+	// goroutines holds the number of producer and consumer goroutines in the concurrent tests.
+	goroutines = 4
+)
+
+func TestFCQueueNewQueueShouldReturnInitiazedInstanceOfQueue(t *testing.T) {
+	q := New()
+
+	if q == nil {
+		t.Error("Expected: new instance of queue; Got: nil")
+	}
+}
+
+func TestFCQueuePushPopFrontShouldRetrieveAllElementsInOrder(t *testing.T) {
+	q := New()
+	for i := 0; i < 1000; i++ {
+		q.Push(i)
+	}
+	if q.Len() != 1000 {
+		t.Errorf("Expected: %d; Got: %d", 1000, q.Len())
+	}
+
+	for i := 0; i < 1000; i++ {
+		if v, ok := q.Front(); !ok || v.(int) != i {
+			t.Errorf("Expected: %d; Got: %d", i, v)
+		}
+		if v, ok := q.Pop(); !ok || v.(int) != i {
+			t.Errorf("Expected: %d; Got: %d", i, v)
+		}
+	}
+	if v, ok := q.Pop(); ok || v != nil {
+		t.Errorf("Expected: nil as the queue should be empty; Got: %d", v)
+	}
+	if q.Len() != 0 {
+		t.Errorf("Expected: %d; Got: %d", 0, q.Len())
+	}
+}
+
+func TestFCQueueResetShouldReturnAllElementsInOrder(t *testing.T) {
+	q := New()
+	if vs := q.Reset(); len(vs) != 0 {
+		t.Errorf("Expected: no values as the queue is empty; Got: %v", vs)
+	}
+
+	count := 300
+	for i := 0; i < count; i++ {
+		q.Push(i)
+	}
+	vs := q.Reset()
+	if len(vs) != count {
+		t.Fatalf("Expected: %d; Got: %d", count, len(vs))
+	}
+	for i, v := range vs {
+		if v != i {
+			t.Fatalf("Expected: %d; Got: %v", i, v)
+		}
+	}
+	if q.Len() != 0 {
+		t.Errorf("Expected: %d; Got: %d", 0, q.Len())
+	}
+	if v, ok := q.Pop(); ok || v != nil {
+		t.Errorf("Expected: nil as the queue should be empty; Got: %d", v)
+	}
+
+	q.Push(1)
+	if v, ok := q.Pop(); !ok || v != 1 {
+		t.Errorf("Expected: 1; Got: %v", v)
+	}
+}
+
+func TestFCQueueConcurrentPushPopResetShouldRetrieveAllElementsOnce(t *testing.T) {
+	q := New()
+	queuetest.CheckConcurrentReset(t, "fcqueue", q, goroutines, concurrentCount)
+}
+
+func TestFCQueueConcurrentPushPopShouldRetrieveAllElementsInProducerOrder(t *testing.T) {
+	q := New()
+	var wg sync.WaitGroup
+	for p := 0; p < goroutines; p++ {
+		wg.Add(1)
+		go func(p int) {
+			defer wg.Done()
+			for i := 0; i < concurrentCount; i++ {
+				q.Push(p*concurrentCount + i)
+			}
+		}(p)
+	}
+
+	// A single consumer must see the values of each producer in push order.
+	last := make([]int, goroutines)
+	for i := range last {
+		last[i] = -1
+	}
+	for popped := 0; popped < goroutines*concurrentCount; {
+		v, ok := q.Pop()
+		if !ok {
+			runtime.Gosched()
+			continue
+		}
+		p, i := v.(int)/concurrentCount, v.(int)%concurrentCount
+		if i != last[p]+1 {
+			t.Fatalf("Expected: %d; Got: %d", p*concurrentCount+last[p]+1, v)
+		}
+		last[p] = i
+		popped++
+	}
+	wg.Wait()
+}
+
+func TestFCQueueConcurrentPushPopShouldRetrieveAllElements(t *testing.T) {
+	q := New()
+	var wg sync.WaitGroup
+	for p := 0; p < goroutines; p++ {
+		wg.Add(1)
+		go func(p int) {
+			defer wg.Done()
+			for i := 0; i < concurrentCount; i++ {
+				q.Push(p*concurrentCount + i)
+			}
+		}(p)
+	}
+
+	seen := make([]bool, goroutines*concurrentCount)
+	var mu sync.Mutex
+	for c := 0; c < goroutines; c++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < concurrentCount; {
+				v, ok := q.Pop()
+				if !ok {
+					runtime.Gosched()
+					continue
+				}
+				mu.Lock()
+				seen[v.(int)] = true
+				mu.Unlock()
+				i++
+			}
+		}()
+	}
+	wg.Wait()
+
+	for i, s := range seen {
+		if !s {
+			t.Errorf("Expected: %d to be popped; Got: not popped", i)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package invariant implements the debug mode of the queue implementations in this repo.
+// Internally, implementations check their internal invariants (e.g. positions within bounds,
+// length consistent with the node chain, no nil nodes, popped positions cleared) after every
+// operation that modifies the queue, and panic with a *Violation holding a detailed dump of
+// their internal state when an invariant doesn't hold, pointing at the faulty operation rather
+// than at a later, seemingly unrelated one.
+// The debug mode is enabled by the queuedebug build tag, e.g.
+//
+//	go test -tags queuedebug ./...
+//
+// Implementations guard the checks with Enabled, which is a constant, so they are compiled
+// out of regular builds and don't cost anything.
+package invariant
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// walkBudget holds the number of elements a check is expected to walk per operation.
+const walkBudget = 64
+
+// Violation describes an internal invariant that doesn't hold.
+type Violation struct {
+	// Impl holds the name of the implementation whose invariant doesn't hold.
+	Impl string
+
+	// Op holds the name of the operation after which the invariant doesn't hold.
+	Op string
+
+	// Reason describes the invariant that doesn't hold.
+	Reason string
+
+	// Dump holds a description of the implementation internal state.
+	Dump string
+}
+
+// Error returns the description of the violation, including the internal state dump.
+func (v *Violation) Error() string {
+	return fmt.Sprintf("%s: invariant violated after %s: %s\n%s", v.Impl, v.Op, v.Reason, v.Dump)
+}
+
+// Fail panics with a *Violation of implementation impl after operation op, described by reason.
+// Dump is only called once the violation was found, so building the dump may be expensive.
+func Fail(impl, op, reason string, dump func() string) {
+	panic(&Violation{Impl: impl, Op: op, Reason: reason, Dump: dump()})
+}
+
+// ops holds the number of times Due was called.
+var ops uint64
+
+// Due reports whether a check walking n elements, e.g. the nodes of a linked list, should run
+// now. Checks walking up to 64 elements always run, while longer ones run once every n/64
+// calls, so the checks of large queues cost O(1) amortized per operation instead of making
+// the tests exercising them quadratic.
+// Due is safe for concurrent use by multiple goroutines.
+func Due(n int) bool {
+	c := atomic.AddUint64(&ops, 1)
+	return n <= walkBudget || c%uint64(n/walkBudget) == 0
+}
@@ -0,0 +1,63 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package invariant
+
+import (
+	"testing"
+)
+
+func TestFailShouldPanicWithViolation(t *testing.T) {
+	defer func() {
+		v, ok := recover().(*Violation)
+		if !ok {
+			t.Fatalf("Expected: *Violation; Got: %v", v)
+		}
+		want := &Violation{Impl: "impl", Op: "Push", Reason: "length out of bounds", Dump: "len=-1"}
+		if *v != *want {
+			t.Errorf("Expected: %+v; Got: %+v", want, v)
+		}
+		if e := v.Error(); e != "impl: invariant violated after Push: length out of bounds\nlen=-1" {
+			t.Errorf("Expected: error describing the violation; Got: %q", e)
+		}
+	}()
+	Fail("impl", "Push", "length out of bounds", func() string { return "len=-1" })
+}
+
+func TestDueShouldAlwaysRunShortChecks(t *testing.T) {
+	for i := 0; i < 1000; i++ {
+		if !Due(i % (walkBudget + 1)) {
+			t.Fatalf("Expected: check walking %d elements due; Got: not due", i%(walkBudget+1))
+		}
+	}
+}
+
+func TestDueShouldRunLongChecksPeriodically(t *testing.T) {
+	n := 10 * walkBudget
+	due := 0
+	for i := 0; i < 1000; i++ {
+		if Due(n) {
+			due++
+		}
+	}
+	if due != 100 {
+		t.Errorf("Expected: %d checks due; Got: %d", 100, due)
+	}
+}
@@ -0,0 +1,216 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package lenstats implements a queue length histogram, exposing the distribution of the
+// queue length over time rather than its current value or its high watermark only.
+// Internally, the histogram counts length samples in power of two buckets, so recording a
+// sample costs a few atomic operations, regardless of the length range, and the relative
+// error of the reported quantiles is bounded by a factor of two.
+// Samples can be recorded by the queue on each operation (e.g. safequeue.SetLenHistogram),
+// or on a timer using Sample, with any queue exposing its length.
+package lenstats
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// buckets holds the number of histogram buckets: one for length 0 and one for each power of two.
+const buckets = 64
+
+// Histogram represents a queue length histogram.
+// Bucket 0 counts the samples of length 0, and bucket i counts the samples of length
+// between 2^(i-1) and 2^i-1.
+// The zero value for Histogram is an empty histogram ready to use.
+// Histogram is safe for concurrent use by multiple goroutines.
+type Histogram struct {
+	// count holds the number of samples.
+	// Kept as the first field to guarantee its 64-bit alignment.
+	count uint64
+
+	// sum holds the sum of all samples.
+	sum uint64
+
+	// max holds the largest sample.
+	max uint64
+
+	// counts holds the number of samples in each bucket.
+	counts [buckets]uint64
+}
+
+// Bucket represents a histogram bucket.
+type Bucket struct {
+	// Min holds the smallest length counted in the bucket.
+	Min int
+
+	// Max holds the largest length counted in the bucket.
+	Max int
+
+	// Count holds the number of samples counted in the bucket.
+	Count uint64
+}
+
+// Snapshot represents the state of a histogram at a point in time.
+type Snapshot struct {
+	// Buckets holds the histogram buckets, up to the one counting the largest sample.
+	Buckets []Bucket
+
+	// Count holds the number of samples.
+	Count uint64
+
+	// Max holds the largest sample.
+	Max int
+
+	// Mean holds the mean of all samples, or 0 if there are no samples.
+	Mean float64
+}
+
+// Observe records queue length sample l; negative samples are recorded as 0.
+// The complexity is O(1).
+func (h *Histogram) Observe(l int) {
+	if l < 0 {
+		l = 0
+	}
+	v := uint64(l)
+	atomic.AddUint64(&h.counts[bitLen(v)], 1)
+	atomic.AddUint64(&h.sum, v)
+	for {
+		m := atomic.LoadUint64(&h.max)
+		if v <= m || atomic.CompareAndSwapUint64(&h.max, m, v) {
+			break
+		}
+	}
+	atomic.AddUint64(&h.count, 1)
+}
+
+// Snapshot returns the current state of histogram h.
+// Samples recorded concurrently may be partially reflected in the returned snapshot,
+// e.g. counted in a bucket but not in Count yet.
+// The complexity is O(1).
+func (h *Histogram) Snapshot() Snapshot {
+	s := Snapshot{
+		Count: atomic.LoadUint64(&h.count),
+		Max:   int(atomic.LoadUint64(&h.max)),
+	}
+	if s.Count > 0 {
+		s.Mean = float64(atomic.LoadUint64(&h.sum)) / float64(s.Count)
+	}
+
+	last := 0
+	var counts [buckets]uint64
+	for i := range counts {
+		counts[i] = atomic.LoadUint64(&h.counts[i])
+		if counts[i] > 0 {
+			last = i
+		}
+	}
+	s.Buckets = make([]Bucket, last+1)
+	for i := range s.Buckets {
+		s.Buckets[i] = Bucket{Min: bucketMin(i), Max: bucketMax(i), Count: counts[i]}
+	}
+	return s
+}
+
+// Reset removes all samples from histogram h.
+// Samples recorded concurrently may be partially removed.
+func (h *Histogram) Reset() {
+	for i := range h.counts {
+		atomic.StoreUint64(&h.counts[i], 0)
+	}
+	atomic.StoreUint64(&h.sum, 0)
+	atomic.StoreUint64(&h.max, 0)
+	atomic.StoreUint64(&h.count, 0)
+}
+
+// Quantile returns an upper bound of the q-quantile of the samples in snapshot s, i.e. the
+// largest length of the bucket holding it, capped at the largest sample; e.g. Quantile(0.99)
+// returns a length the queue was at or below in at least 99% of the samples.
+// It returns 0 if there are no samples.
+// The complexity is O(b), where b is the number of buckets.
+func (s Snapshot) Quantile(q float64) int {
+	var total uint64
+	for _, b := range s.Buckets {
+		total += b.Count
+	}
+	if total == 0 {
+		return 0
+	}
+
+	rank := uint64(q*float64(total) + 0.5)
+	if rank < 1 {
+		rank = 1
+	}
+	var seen uint64
+	for _, b := range s.Buckets {
+		seen += b.Count
+		if seen >= rank {
+			if b.Max > s.Max {
+				return s.Max
+			}
+			return b.Max
+		}
+	}
+	return s.Max
+}
+
+// Sample records the value returned by length into histogram h every interval, until the
+// returned stop function is called; stop must be called only once.
+// Sampling on a timer records the length over time regardless of the operations rate, and
+// works with any queue, e.g. passing the queue Len or LenApprox method as length.
+func Sample(h *Histogram, interval time.Duration, length func() int) (stop func()) {
+	t := time.NewTicker(interval)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-t.C:
+				h.Observe(length())
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		t.Stop()
+		close(done)
+	}
+}
+
+// bucketMin returns the smallest length counted in bucket i.
+func bucketMin(i int) int {
+	if i == 0 {
+		return 0
+	}
+	return int(uint64(1) << uint(i-1))
+}
+
+// bucketMax returns the largest length counted in bucket i.
+func bucketMax(i int) int {
+	return int(uint64(1)<<uint(i) - 1)
+}
+
+// bitLen returns the minimum number of bits required to represent v, or 0 if v is 0.
+func bitLen(v uint64) int {
+	n := 0
+	for ; v != 0; v >>= 1 {
+		n++
+	}
+	return n
+}
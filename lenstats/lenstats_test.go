@@ -0,0 +1,163 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package lenstats
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const (
+	// concurrentCount holds the number of samples recorded by each goroutine in the concurrent tests.
+	concurrentCount = 10000
+
+	// goroutines holds the number of goroutines in the concurrent tests.
+	goroutines = 4
+)
+
+func TestHistogramWithZeroValueShouldBeEmpty(t *testing.T) {
+	var h Histogram
+	s := h.Snapshot()
+
+	if s.Count != 0 || s.Max != 0 || s.Mean != 0 {
+		t.Errorf("Expected: empty snapshot; Got: %+v", s)
+	}
+	if q := s.Quantile(0.5); q != 0 {
+		t.Errorf("Expected: %d; Got: %d", 0, q)
+	}
+}
+
+func TestHistogramObserveShouldCountSamplesInPowerOfTwoBuckets(t *testing.T) {
+	var h Histogram
+	for _, l := range []int{-1, 0, 1, 2, 3, 4, 7, 8, 100} {
+		h.Observe(l)
+	}
+	s := h.Snapshot()
+
+	expected := []Bucket{
+		{Min: 0, Max: 0, Count: 2},
+		{Min: 1, Max: 1, Count: 1},
+		{Min: 2, Max: 3, Count: 2},
+		{Min: 4, Max: 7, Count: 2},
+		{Min: 8, Max: 15, Count: 1},
+		{Min: 16, Max: 31, Count: 0},
+		{Min: 32, Max: 63, Count: 0},
+		{Min: 64, Max: 127, Count: 1},
+	}
+	if len(s.Buckets) != len(expected) {
+		t.Fatalf("Expected: %d buckets; Got: %+v", len(expected), s.Buckets)
+	}
+	for i, b := range expected {
+		if s.Buckets[i] != b {
+			t.Errorf("Expected: bucket %d %+v; Got: %+v", i, b, s.Buckets[i])
+		}
+	}
+	if s.Count != 9 || s.Max != 100 || s.Mean != 125.0/9 {
+		t.Errorf("Expected: %d samples, max %d, mean %v; Got: %+v", 9, 100, 125.0/9, s)
+	}
+}
+
+func TestHistogramObserveWithLargestLengthShouldUseLastBucket(t *testing.T) {
+	var h Histogram
+	maxInt := int(^uint(0) >> 1)
+	h.Observe(maxInt)
+	s := h.Snapshot()
+
+	if b := s.Buckets[len(s.Buckets)-1]; b.Count != 1 || b.Max != maxInt {
+		t.Errorf("Expected: largest length counted in the last bucket; Got: %+v", b)
+	}
+}
+
+func TestSnapshotQuantileShouldReturnBucketUpperBound(t *testing.T) {
+	var h Histogram
+	for i := 0; i < 90; i++ {
+		h.Observe(3)
+	}
+	for i := 0; i < 10; i++ {
+		h.Observe(50)
+	}
+	s := h.Snapshot()
+
+	tests := map[float64]int{0: 3, 0.5: 3, 0.9: 3, 0.95: 50, 1: 50}
+	for q, expected := range tests {
+		if l := s.Quantile(q); l != expected {
+			t.Errorf("Expected: %v-quantile %d; Got: %d", q, expected, l)
+		}
+	}
+}
+
+func TestHistogramResetShouldRemoveAllSamples(t *testing.T) {
+	var h Histogram
+	h.Observe(10)
+	h.Reset()
+
+	if s := h.Snapshot(); s.Count != 0 || s.Max != 0 || len(s.Buckets) != 1 || s.Buckets[0].Count != 0 {
+		t.Errorf("Expected: empty snapshot; Got: %+v", s)
+	}
+}
+
+func TestHistogramConcurrentObserveShouldCountAllSamples(t *testing.T) {
+	var h Histogram
+	var wg sync.WaitGroup
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < concurrentCount; j++ {
+				h.Observe(j)
+			}
+		}()
+	}
+	wg.Wait()
+
+	s := h.Snapshot()
+	var total uint64
+	for _, b := range s.Buckets {
+		total += b.Count
+	}
+	if s.Count != goroutines*concurrentCount || total != s.Count {
+		t.Errorf("Expected: %d samples; Got: %d, %d in buckets", goroutines*concurrentCount, s.Count, total)
+	}
+	if s.Max != concurrentCount-1 {
+		t.Errorf("Expected: %d; Got: %d", concurrentCount-1, s.Max)
+	}
+}
+
+func TestSampleShouldObserveLengthPeriodically(t *testing.T) {
+	var h Histogram
+	var calls int32
+	stop := Sample(&h, time.Millisecond, func() int {
+		atomic.AddInt32(&calls, 1)
+		return 5
+	})
+	for atomic.LoadInt32(&calls) < 3 {
+		runtime.Gosched()
+	}
+	stop()
+
+	s := h.Snapshot()
+	if s.Count < 2 || s.Max != 5 {
+		t.Errorf("Expected: at least %d samples of %d; Got: %+v", 2, 5, s)
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package levels implements the list of per-priority FIFO queues shared by the priority
+// queues in this repo (e.g. agingqueue and shedqueue), which keep the values of each distinct
+// priority in push order.
+// Internally, the list keeps the levels both in a map by priority, to find the level of a
+// pushed value in O(1), and in a slice sorted by descending priority, so the highest and
+// lowest priorities are the first and last levels.
+package levels
+
+import (
+	"sort"
+
+	"github.com/christianrpetrin/queue-tests/queueimpl3"
+)
+
+// Level holds the values of a single priority.
+type Level struct {
+	// Priority holds the priority of the level values.
+	Priority int
+
+	// Q holds the level values, in FIFO order.
+	Q queueimpl3.Queueimpl3
+}
+
+// List represents a list of levels sorted by descending priority.
+// The zero value for List is an empty list ready to use.
+type List struct {
+	// byPriority holds the levels by priority.
+	byPriority map[int]*Level
+
+	// order holds the levels sorted by descending priority.
+	order []*Level
+}
+
+// Len returns the number of levels of list l.
+// The complexity is O(1).
+func (l *List) Len() int { return len(l.order) }
+
+// Levels returns the levels of list l, sorted by descending priority.
+// The returned slice is only valid until the next Get or Remove, and must not be modified.
+// The complexity is O(1).
+func (l *List) Levels() []*Level { return l.order }
+
+// Get returns the level of the given priority, inserting an empty level in list l if it has
+// none.
+// The complexity is O(1), or O(p) if the level is inserted, where p is the number of levels.
+func (l *List) Get(priority int) *Level {
+	if lv, ok := l.byPriority[priority]; ok {
+		return lv
+	}
+	if l.byPriority == nil {
+		l.byPriority = make(map[int]*Level)
+	}
+
+	lv := &Level{Priority: priority}
+	l.byPriority[priority] = lv
+	i := sort.Search(len(l.order), func(i int) bool { return l.order[i].Priority < priority })
+	l.order = append(l.order, nil)
+	copy(l.order[i+1:], l.order[i:])
+	l.order[i] = lv
+	return lv
+}
+
+// Remove removes level lv from list l, usually once it is empty.
+// The complexity is O(p), where p is the number of levels.
+func (l *List) Remove(lv *Level) {
+	delete(l.byPriority, lv.Priority)
+	for i, o := range l.order {
+		if o == lv {
+			copy(l.order[i:], l.order[i+1:])
+			l.order[len(l.order)-1] = nil // Avoid memory leaks
+			l.order = l.order[:len(l.order)-1]
+			return
+		}
+	}
+}
@@ -0,0 +1,60 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package levels
+
+import (
+	"testing"
+)
+
+func TestListGetShouldKeepLevelsSortedByDescendingPriority(t *testing.T) {
+	var l List
+	for _, p := range []int{3, -1, 7, 3, 0, 7} {
+		l.Get(p).Q.Push(p)
+	}
+
+	want := []int{7, 3, 0, -1}
+	if l.Len() != len(want) {
+		t.Fatalf("Expected: %d; Got: %d", len(want), l.Len())
+	}
+	for i, lv := range l.Levels() {
+		if lv.Priority != want[i] {
+			t.Errorf("Expected: %d; Got: %d", want[i], lv.Priority)
+		}
+	}
+	if lv := l.Get(3); lv.Q.Len() != 2 {
+		t.Errorf("Expected: %d; Got: %d", 2, lv.Q.Len())
+	}
+}
+
+func TestListRemoveShouldRemoveLevel(t *testing.T) {
+	var l List
+	for _, p := range []int{1, 2, 3} {
+		l.Get(p)
+	}
+
+	l.Remove(l.Get(2))
+	if l.Len() != 2 || l.Levels()[0].Priority != 3 || l.Levels()[1].Priority != 1 {
+		t.Errorf("Expected: levels %v; Got: %d levels", []int{3, 1}, l.Len())
+	}
+	if lv := l.Get(2); lv.Q.Len() != 0 || l.Len() != 3 {
+		t.Errorf("Expected: empty level; Got: %d values", lv.Q.Len())
+	}
+}
@@ -0,0 +1,150 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package lockfreequeue
+
+import (
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+var (
+	// batchSizes holds the producer batch sizes probed by the benchmark tests.
+	// A batch size of 1 means no batching.
+	batchSizes = []int{1, 8, 64, 512}
+
+	// benchProducers holds the number of producer goroutines in the benchmark tests.
+	benchProducers = 4
+)
+
+// BenchmarkBatchProducer probes the throughput of multiple producers pushing
+// values in batches while a single consumer pops them.
+func BenchmarkBatchProducer(b *testing.B) {
+	for _, size := range batchSizes {
+		size := size
+		b.Run(strconv.Itoa(size), func(b *testing.B) {
+			q := New()
+			perProducer := b.N/benchProducers + 1
+
+			var wg sync.WaitGroup
+			for i := 0; i < benchProducers; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					p := q.NewBatchProducer(size)
+					for n := 0; n < perProducer; n++ {
+						p.Push(n)
+					}
+					p.Flush()
+				}()
+			}
+
+			for popped := 0; popped < perProducer*benchProducers; {
+				if _, ok := q.Pop(); ok {
+					popped++
+				} else {
+					runtime.Gosched()
+				}
+			}
+			wg.Wait()
+		})
+	}
+}
+
+// unpaddedCounters holds a producer and a consumer counter in the same cache line.
+type unpaddedCounters struct {
+	// p holds the producer counter.
+	p int64
+
+	// c holds the consumer counter.
+	c int64
+}
+
+// paddedCounters holds a producer and a consumer counter in different cache lines.
+type paddedCounters struct {
+	// p holds the producer counter.
+	p int64
+
+	// _ keeps c in a different cache line than p.
+	_ cacheLinePad
+
+	// c holds the consumer counter.
+	c int64
+}
+
+// BenchmarkReclamation probes the throughput of concurrent producers and consumers when
+// the unlinked nodes are left to the garbage collector, and when they are reclaimed using
+// epoch-based reclamation and reused.
+func BenchmarkReclamation(b *testing.B) {
+	b.Run("GC", func(b *testing.B) { benchmarkPushPop(b, New()) })
+	b.Run("Epoch", func(b *testing.B) { benchmarkPushPop(b, NewWithReclamation()) })
+}
+
+// benchmarkPushPop pushes and pops b.N values to queue q from benchProducers goroutines.
+func benchmarkPushPop(b *testing.B, q *LockFreeQueue) {
+	b.ReportAllocs()
+	var wg sync.WaitGroup
+	perProducer := b.N/benchProducers + 1
+	for i := 0; i < benchProducers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := 0; n < perProducer; n++ {
+				q.Push(n)
+				for {
+					if _, ok := q.Pop(); ok {
+						break
+					}
+					runtime.Gosched()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// BenchmarkFalseSharing probes the cost of false sharing, which the queue avoids by padding
+// the fields updated by the producers (tail) and by the consumers (head), by having two
+// goroutines update two adjacent or padded counters, respectively.
+// The effect is only visible when GOMAXPROCS is at least 2.
+func BenchmarkFalseSharing(b *testing.B) {
+	var u unpaddedCounters
+	var p paddedCounters
+	b.Run("Unpadded", func(b *testing.B) { benchmarkCounters(b, &u.p, &u.c) })
+	b.Run("Padded", func(b *testing.B) { benchmarkCounters(b, &p.p, &p.c) })
+}
+
+// benchmarkCounters increments counters p and c b.N times each from two different goroutines.
+func benchmarkCounters(b *testing.B, p, c *int64) {
+	var wg sync.WaitGroup
+	for _, counter := range []*int64{p, c} {
+		wg.Add(1)
+		go func(counter *int64) {
+			defer wg.Done()
+			for n := 0; n < b.N; n++ {
+				atomic.AddInt64(counter, 1)
+			}
+		}(counter)
+	}
+	wg.Wait()
+}
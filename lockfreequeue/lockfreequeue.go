@@ -0,0 +1,529 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package lockfreequeue implements an unbounded, dynamically growing, lock-free FIFO queue.
+// Internally, queue store the values in a singly linked list of nodes which are linked and
+// unlinked using atomic compare-and-swap operations, as described by Michael and Scott in
+// "Simple, Fast, and Practical Non-Blocking and Blocking Concurrent Queue Algorithms".
+// The head of the linked list always points to a dummy node, whose next node holds the
+// first value in the queue.
+// Watermark callbacks can notify producers when the queue grows too long and when it
+// drains back, so they can be throttled without polling Len.
+// Optionally, unlinked nodes are reclaimed using epoch-based reclamation and reused by
+// later pushes, instead of being left to the garbage collector.
+// Reset clears the queue while other goroutines may be using it, returning the removed values.
+// Optionally, the queue length is counted using a sharded counter, so producers and consumers
+// running on different Ps don't contend on a single length counter, at the cost of a slower Len.
+package lockfreequeue
+
+import (
+	"sync"
+	"sync/atomic"
+	"unsafe"
+
+	"github.com/christianrpetrin/queue-tests/epoch"
+	"github.com/christianrpetrin/queue-tests/queueerr"
+	"github.com/christianrpetrin/queue-tests/shardcount"
+)
+
+// LockFreeQueue represents an unbounded, dynamically growing, lock-free FIFO queue.
+// LockFreeQueue is safe for concurrent use by multiple producers and consumers.
+// The zero value for queue is not ready to use; use New to create a queue.
+type LockFreeQueue struct {
+	// Len holds the current queue length, unless the length is sharded.
+	// Kept as the first field to guarantee its 64-bit alignment.
+	// It is updated by both producers and consumers.
+	len int64
+
+	// _ keeps head in a different cache line than len.
+	_ cacheLinePad
+
+	// Head points to the dummy node of the linked list.
+	// It is updated by the consumers.
+	head unsafe.Pointer
+
+	// _ keeps tail in a different cache line than head.
+	_ cacheLinePad
+
+	// Tail points to the last node of the linked list, or to a node behind it
+	// while a push is in progress.
+	// It is updated by the producers.
+	tail unsafe.Pointer
+
+	// _ keeps the read-mostly fields below in a different cache line than tail.
+	_ cacheLinePad
+
+	// w holds the watermarks configuration.
+	w Watermarks
+
+	// high is 1 if the queue length reached the high watermark and didn't
+	// drop back to the low watermark yet; 0 otherwise.
+	high int32
+
+	// d holds the reclamation domain of the unlinked nodes, or nil if they are
+	// left to the garbage collector.
+	d *epoch.Domain
+
+	// free holds the reclaimed nodes, ready to be reused.
+	free sync.Pool
+
+	// sl holds the queue length if it is sharded, or nil if it is held by len.
+	sl *shardcount.Counter
+}
+
+// cacheLineSize holds the assumed size of a CPU cache line.
+// It is 64 bytes on most amd64 and arm64 CPUs.
+const cacheLineSize = 64
+
+// cacheLinePad separates fields updated by different goroutines, so they are
+// stored in different cache lines and updating one doesn't invalidate the
+// cache line holding the other (i.e. false sharing).
+type cacheLinePad [cacheLineSize]byte
+
+// Watermarks configures callbacks notifying when the queue length reaches a
+// high watermark and when it later drops back to a low watermark.
+// The callbacks are called by the goroutine whose operation made the length
+// cross the watermark; so they may call the queue methods, but the queue length
+// may have changed by the time they run, and OnHigh and OnLow calls triggered by
+// different goroutines may run concurrently.
+type Watermarks struct {
+	// High is the length at which OnHigh is called.
+	// A High of 0 or less disables the watermarks.
+	High int
+
+	// Low is the length at which OnLow is called, once the length reached High.
+	// Low should be lower than High.
+	Low int
+
+	// OnHigh, if not nil, is called with the queue length when it reaches High.
+	OnHigh func(l int)
+
+	// OnLow, if not nil, is called with the queue length when it drops back to Low.
+	OnLow func(l int)
+}
+
+// testHookYield, if not nil, is called between the atomic steps of the queue operations,
+// so tests can control how concurrent operations interleave.
+var testHookYield func()
+
+// yield calls testHookYield, if set.
+func yield() {
+	if testHookYield != nil {
+		testHookYield()
+	}
+}
+
+// node represents a queue node.
+type node struct {
+	// v holds the user added value. It is never modified after the node is linked,
+	// until the node is reclaimed.
+	v interface{}
+
+	// n points to the next node in the linked list.
+	n unsafe.Pointer
+}
+
+// New returns an initialized queue.
+func New() *LockFreeQueue {
+	return new(LockFreeQueue).Init()
+}
+
+// NewWithReclamation returns an initialized queue that reclaims the unlinked nodes using
+// epoch-based reclamation and reuses them for the pushed values, reducing the allocation
+// rate and the garbage collector load at the cost of pinning each operation to an epoch.
+func NewWithReclamation() *LockFreeQueue {
+	q := new(LockFreeQueue)
+	q.d = epoch.NewDomain(q.reclaim)
+	return q.Init()
+}
+
+// NewWithShardedLen returns an initialized queue that counts its length using a sharded
+// counter, so producers and consumers running on different Ps update different cache lines,
+// instead of contending on a single length counter. Len sums all shards, so it costs O(p),
+// where p is GOMAXPROCS, rather than O(1); and, if watermarks are set, each operation also
+// sums all shards to check them.
+func NewWithShardedLen() *LockFreeQueue {
+	q := new(LockFreeQueue)
+	q.sl = shardcount.New()
+	return q.Init()
+}
+
+// Init initializes or clears queue q.
+// Init is not safe for concurrent use with any other queue q method; use Reset to clear
+// a queue other goroutines may be using.
+func (q *LockFreeQueue) Init() *LockFreeQueue {
+	n := unsafe.Pointer(&node{})
+	atomic.StorePointer(&q.head, n)
+	atomic.StorePointer(&q.tail, n)
+	atomic.StoreInt64(&q.len, 0)
+	if q.sl != nil {
+		q.sl.Reset()
+	}
+	atomic.StoreInt32(&q.high, 0)
+	return q
+}
+
+// SetWatermarks sets the watermarks configuration of queue q.
+// If the queue length is already at or above w.High, w.OnHigh is called right away.
+// SetWatermarks is not safe for concurrent use with any other queue q method.
+func (q *LockFreeQueue) SetWatermarks(w Watermarks) {
+	q.w = w
+	atomic.StoreInt32(&q.high, 0)
+	if w.High > 0 {
+		q.watermark(q.Len())
+	}
+}
+
+// Len returns the number of elements of queue q.
+// As values are added and removed concurrently, the returned length may be stale.
+// The complexity is O(1), or O(p) if the length is sharded, where p is GOMAXPROCS.
+func (q *LockFreeQueue) Len() int {
+	l := q.loadLen()
+	// Values are counted after being linked, so a concurrent pop may
+	// temporarily make the length negative.
+	if l > 0 {
+		return int(l)
+	}
+	return 0
+}
+
+// loadLen returns the queue length, which may be negative while values are being pushed.
+func (q *LockFreeQueue) loadLen() int64 {
+	if q.sl != nil {
+		return q.sl.Load()
+	}
+	return atomic.LoadInt64(&q.len)
+}
+
+// addLen adds delta to the queue length, returning the length right after it was updated
+// if watermarks are set. If the length is sharded and no watermarks are set, the length is
+// not needed, so 0 is returned to avoid summing all shards.
+func (q *LockFreeQueue) addLen(delta int64) int {
+	if q.sl == nil {
+		return int(atomic.AddInt64(&q.len, delta))
+	}
+	q.sl.Add(delta)
+	if q.w.High > 0 {
+		return int(q.sl.Load())
+	}
+	return 0
+}
+
+// LenApprox returns the number of elements of queue q using a single atomic read per
+// counter, so it doesn't contend with producers and consumers.
+// As the queue is lock-free, there is no cheaper or more exact way to get its length,
+// so LenApprox is the same as Len; it is provided for consistency with the lock based
+// queues, where Len requires acquiring the queue lock.
+// The returned length may be stale.
+// The complexity is O(1), or O(p) if the length is sharded, where p is GOMAXPROCS.
+func (q *LockFreeQueue) LenApprox() int { return q.Len() }
+
+// Front returns the first element of queue q or nil if the queue is empty.
+// The second, bool result indicates whether a valid value was returned;
+//   if the queue is empty, false will be returned.
+// The complexity is O(1).
+func (q *LockFreeQueue) Front() (interface{}, bool) {
+	if q.d != nil {
+		g := q.d.Pin()
+		defer g.Unpin()
+	}
+
+	for {
+		head := atomic.LoadPointer(&q.head)
+		yield()
+		next := atomic.LoadPointer(&(*node)(head).n)
+		yield()
+		if head != atomic.LoadPointer(&q.head) {
+			continue
+		}
+		if next == nil {
+			return nil, false
+		}
+		return (*node)(next).v, true
+	}
+}
+
+// Push adds a value to the queue.
+// The complexity is O(1).
+func (q *LockFreeQueue) Push(v interface{}) {
+	n := q.newNode(v)
+	q.pushChain(n, n)
+	l := q.addLen(1)
+	if q.w.High > 0 {
+		q.watermark(l)
+	}
+}
+
+// Pop retrieves and removes the next element from the queue.
+// The second, bool result indicates whether a valid value was returned;
+//   if the queue is empty, false will be returned.
+// The node holding the returned value becomes the new dummy node, so the
+// most recently popped value is only released after the next value is popped.
+// The complexity is O(1).
+func (q *LockFreeQueue) Pop() (interface{}, bool) {
+	v, l, ok := q.pop()
+	if ok && q.w.High > 0 {
+		q.watermark(l)
+	}
+	return v, ok
+}
+
+// PopE retrieves and removes the next element from the queue.
+// It is the same as Pop, but returns queueerr.ErrEmpty if the queue is empty.
+// The complexity is O(1).
+func (q *LockFreeQueue) PopE() (interface{}, error) {
+	if v, ok := q.Pop(); ok {
+		return v, nil
+	}
+	return nil, queueerr.ErrEmpty
+}
+
+// Reset atomically removes all elements from queue q, returning them from the first to
+// the last one, so values displaced by clearing a queue in use are not lost.
+// Reset is safe for concurrent use with the other queue q methods: it unlinks all nodes
+// using a single compare-and-swap of the head, so values pushed concurrently with Reset
+// are either returned by it or left in the queue, and are never popped twice.
+// As with Pop, the node holding the last returned value becomes the new dummy node.
+// The complexity is O(n), where n is the number of removed elements.
+func (q *LockFreeQueue) Reset() []interface{} {
+	vs, l := q.detach()
+	if len(vs) > 0 && q.w.High > 0 {
+		q.watermark(l)
+	}
+	return vs
+}
+
+// detach unlinks all nodes after the dummy node, returning their values and the queue
+// length right after they were removed.
+// The watermarks are left to the caller, so they are not called while pinned.
+func (q *LockFreeQueue) detach() ([]interface{}, int) {
+	if q.d != nil {
+		g := q.d.Pin()
+		defer g.Unpin()
+	}
+
+	for {
+		head := atomic.LoadPointer(&q.head)
+		yield()
+		tail := atomic.LoadPointer(&q.tail)
+		next := atomic.LoadPointer(&(*node)(head).n)
+		yield()
+		if head != atomic.LoadPointer(&q.head) {
+			continue
+		}
+		if next == nil {
+			return nil, 0
+		}
+		if head == tail {
+			// Tail is falling behind; help the in progress push advance it.
+			atomic.CompareAndSwapPointer(&q.tail, tail, next)
+			yield()
+			continue
+		}
+		yield()
+		if !atomic.CompareAndSwapPointer(&q.head, head, tail) {
+			continue
+		}
+
+		// The nodes from next to tail are no longer reachable by the consumers, and their
+		// links are immutable, as tail was already past them.
+		var vs []interface{}
+		for n := head; n != tail; {
+			next := atomic.LoadPointer(&(*node)(n).n)
+			vs = append(vs, (*node)(next).v)
+			if q.d != nil {
+				q.d.Retire((*node)(n))
+			}
+			n = next
+		}
+		return vs, q.addLen(-int64(len(vs)))
+	}
+}
+
+// pop removes the next element from the queue, returning it and the queue length
+// right after it was removed.
+// The watermarks are left to the caller, so they are not called while pinned.
+func (q *LockFreeQueue) pop() (interface{}, int, bool) {
+	if q.d != nil {
+		g := q.d.Pin()
+		defer g.Unpin()
+	}
+
+	for {
+		head := atomic.LoadPointer(&q.head)
+		yield()
+		tail := atomic.LoadPointer(&q.tail)
+		next := atomic.LoadPointer(&(*node)(head).n)
+		yield()
+		if head != atomic.LoadPointer(&q.head) {
+			continue
+		}
+		if next == nil {
+			return nil, 0, false
+		}
+		if head == tail {
+			// Tail is falling behind; help the in progress push advance it.
+			atomic.CompareAndSwapPointer(&q.tail, tail, next)
+			yield()
+			continue
+		}
+		yield()
+		if atomic.CompareAndSwapPointer(&q.head, head, next) {
+			v := (*node)(next).v
+			l := q.addLen(-1)
+			if q.d != nil {
+				// Tail is past head, so the old dummy node is no longer reachable.
+				q.d.Retire((*node)(head))
+			}
+			return v, l, true
+		}
+	}
+}
+
+// newNode returns a node holding value v, reusing a reclaimed node if available.
+func (q *LockFreeQueue) newNode(v interface{}) *node {
+	if n, ok := q.free.Get().(*node); ok {
+		n.v = v
+		return n
+	}
+	return &node{v: v}
+}
+
+// reclaim clears the retired node v and makes it available for reuse.
+func (q *LockFreeQueue) reclaim(v interface{}) {
+	n := v.(*node)
+	n.v = nil // Avoid memory leaks
+	atomic.StorePointer(&n.n, nil)
+	q.free.Put(n)
+}
+
+// watermark calls the watermark callback if length l crossed a watermark.
+func (q *LockFreeQueue) watermark(l int) {
+	if l >= q.w.High {
+		if atomic.CompareAndSwapInt32(&q.high, 0, 1) && q.w.OnHigh != nil {
+			q.w.OnHigh(l)
+		}
+	} else if l <= q.w.Low {
+		if atomic.CompareAndSwapInt32(&q.high, 1, 0) && q.w.OnLow != nil {
+			q.w.OnLow(l)
+		}
+	}
+}
+
+// pushChain atomically links the chain of nodes starting at first and ending at last
+// to the end of the linked list.
+func (q *LockFreeQueue) pushChain(first, last *node) {
+	if q.d != nil {
+		g := q.d.Pin()
+		defer g.Unpin()
+	}
+
+	for {
+		tail := atomic.LoadPointer(&q.tail)
+		yield()
+		next := atomic.LoadPointer(&(*node)(tail).n)
+		yield()
+		if tail != atomic.LoadPointer(&q.tail) {
+			continue
+		}
+		if next != nil {
+			// Tail is falling behind; help the in progress push advance it.
+			atomic.CompareAndSwapPointer(&q.tail, tail, next)
+			yield()
+			continue
+		}
+		yield()
+		if atomic.CompareAndSwapPointer(&(*node)(tail).n, nil, unsafe.Pointer(first)) {
+			yield()
+			atomic.CompareAndSwapPointer(&q.tail, tail, unsafe.Pointer(last))
+			return
+		}
+	}
+}
+
+// BatchProducer accumulates values in a producer local buffer and adds them
+// to the queue using a single atomic operation once the buffer is full or
+// Flush is called.
+// Buffered values are not visible to consumers until they are flushed, so
+// batching trades latency for throughput.
+// A BatchProducer is not safe for concurrent use; each producer goroutine
+// should use its own.
+type BatchProducer struct {
+	// q holds the queue the values are added to.
+	q *LockFreeQueue
+
+	// size holds the maximum number of buffered values.
+	size int
+
+	// first points to the first buffered node.
+	first *node
+
+	// last points to the last buffered node.
+	last *node
+
+	// len holds the number of buffered values.
+	len int
+}
+
+// NewBatchProducer returns a producer that adds values to queue q in batches of up to size values.
+// A size smaller than 1 is treated as 1 (i.e. no batching).
+func (q *LockFreeQueue) NewBatchProducer(size int) *BatchProducer {
+	if size < 1 {
+		size = 1
+	}
+	return &BatchProducer{q: q, size: size}
+}
+
+// Push adds a value to the producer buffer, flushing the buffer if it is full.
+// The complexity is O(1).
+func (p *BatchProducer) Push(v interface{}) {
+	n := p.q.newNode(v)
+	if p.first == nil {
+		p.first = n
+	} else {
+		p.last.n = unsafe.Pointer(n)
+	}
+	p.last = n
+	p.len++
+
+	if p.len >= p.size {
+		p.Flush()
+	}
+}
+
+// Flush adds all buffered values to the queue.
+// The complexity is O(1).
+func (p *BatchProducer) Flush() {
+	if p.len == 0 {
+		return
+	}
+
+	p.q.pushChain(p.first, p.last)
+	l := p.q.addLen(int64(p.len))
+	if p.q.w.High > 0 {
+		p.q.watermark(l)
+	}
+	p.first = nil
+	p.last = nil
+	p.len = 0
+}
+
+// Len returns the number of buffered values that were not added to the queue yet.
+func (p *BatchProducer) Len() int { return p.len }
@@ -0,0 +1,677 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package lockfreequeue
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+	"unsafe"
+
+	"github.com/christianrpetrin/queue-tests/queueerr"
+	"github.com/christianrpetrin/queue-tests/queuetest"
+	"github.com/christianrpetrin/queue-tests/schedtest"
+)
+
+const (
+	// concurrentCount holds the number of values pushed by each goroutine in the concurrent tests.
+	concurrentCount = 10000
+
+	// goroutines holds the number of producer and consumer goroutines in the concurrent tests.
+	goroutines = 4
+
+	// maxInterleavings holds the maximum number of interleavings explored by the scheduled tests.
+	maxInterleavings = 100000
+
+	// randomSchedules holds the number of random schedules run by the scheduled tests.
+	randomSchedules = 100
+)
+
+// constructors holds the queue constructors probed by the scheduled tests.
+var constructors = map[string]func() *LockFreeQueue{
+	"GC":          New,
+	"Reclamation": NewWithReclamation,
+	"ShardedLen":  NewWithShardedLen,
+}
+
+func TestLockFreeQueueNewQueueShouldReturnInitiazedInstanceOfQueue(t *testing.T) {
+	q := New()
+
+	if q == nil {
+		t.Error("Expected: new instance of queue; Got: nil")
+	}
+}
+
+func TestLockFreeQueueWithNilValuesShouldReturnAllValuesInOrder(t *testing.T) {
+	q := New()
+	q.Push(1)
+	q.Push(nil)
+	q.Push(2)
+	q.Push(nil)
+
+	v, ok := q.Pop()
+	if !ok || v.(int) != 1 {
+		t.Errorf("Expected: 1; Got: %d", v)
+	}
+	v, ok = q.Pop()
+	if !ok || v != nil {
+		t.Errorf("Expected: nil; Got: %d", v)
+	}
+	v, ok = q.Pop()
+	if !ok || v.(int) != 2 {
+		t.Errorf("Expected: 2; Got: %d", v)
+	}
+	v, ok = q.Pop()
+	if !ok || v != nil {
+		t.Errorf("Expected: nil; Got: %d", v)
+	}
+	_, ok = q.Pop()
+	if ok {
+		t.Error("Expected: empty queue (ok=false); Got: ok=true")
+	}
+}
+
+func TestLockFreeQueuePushPopFrontShouldRetrieveAllElementsInOrder(t *testing.T) {
+	q := New()
+	for i := 0; i < 1000; i++ {
+		q.Push(i)
+		if q.Len() != i+1 {
+			t.Errorf("Expected: %d; Got: %d", i+1, q.Len())
+		}
+	}
+
+	for i := 0; i < 1000; i++ {
+		if v, ok := q.Front(); !ok || v.(int) != i {
+			t.Errorf("Expected: %d; Got: %d", i, v)
+		}
+		if v, ok := q.Pop(); !ok || v.(int) != i {
+			t.Errorf("Expected: %d; Got: %d", i, v)
+		}
+	}
+	if v, ok := q.Front(); ok || v != nil {
+		t.Errorf("Expected: nil as the queue should be empty; Got: %d", v)
+	}
+	if v, ok := q.Pop(); ok || v != nil {
+		t.Errorf("Expected: nil as the queue should be empty; Got: %d", v)
+	}
+	if q.Len() != 0 {
+		t.Errorf("Expected: %d; Got: %d", 0, q.Len())
+	}
+}
+
+func TestLockFreeQueueInitShouldClearQueue(t *testing.T) {
+	q := New()
+	q.Push(1)
+	q.Init()
+
+	if q.Len() != 0 {
+		t.Errorf("Expected: %d; Got: %d", 0, q.Len())
+	}
+	if v, ok := q.Pop(); ok || v != nil {
+		t.Errorf("Expected: nil as the queue should be empty; Got: %d", v)
+	}
+}
+
+func TestLockFreeQueueResetShouldReturnAllElementsInOrder(t *testing.T) {
+	q := New()
+	if vs := q.Reset(); len(vs) != 0 {
+		t.Errorf("Expected: no values as the queue is empty; Got: %v", vs)
+	}
+
+	count := 300
+	for i := 0; i < count; i++ {
+		q.Push(i)
+	}
+	vs := q.Reset()
+	if len(vs) != count {
+		t.Fatalf("Expected: %d; Got: %d", count, len(vs))
+	}
+	for i, v := range vs {
+		if v != i {
+			t.Fatalf("Expected: %d; Got: %v", i, v)
+		}
+	}
+	if q.Len() != 0 {
+		t.Errorf("Expected: %d; Got: %d", 0, q.Len())
+	}
+	if v, ok := q.Pop(); ok || v != nil {
+		t.Errorf("Expected: nil as the queue should be empty; Got: %d", v)
+	}
+
+	q.Push(1)
+	if v, ok := q.Pop(); !ok || v != 1 {
+		t.Errorf("Expected: 1; Got: %v", v)
+	}
+}
+
+func TestLockFreeQueueConcurrentPushPopResetShouldRetrieveAllElementsOnce(t *testing.T) {
+	q := New()
+	queuetest.CheckConcurrentReset(t, "lockfreequeue", q, goroutines, concurrentCount)
+}
+
+func TestLockFreeQueueWithReclamationResetShouldReturnAllElementsInOrder(t *testing.T) {
+	q := NewWithReclamation()
+	if vs := q.Reset(); len(vs) != 0 {
+		t.Errorf("Expected: no values as the queue is empty; Got: %v", vs)
+	}
+
+	count := 300
+	for i := 0; i < count; i++ {
+		q.Push(i)
+	}
+	vs := q.Reset()
+	if len(vs) != count {
+		t.Fatalf("Expected: %d; Got: %d", count, len(vs))
+	}
+	for i, v := range vs {
+		if v != i {
+			t.Fatalf("Expected: %d; Got: %v", i, v)
+		}
+	}
+	if q.Len() != 0 {
+		t.Errorf("Expected: %d; Got: %d", 0, q.Len())
+	}
+	if v, ok := q.Pop(); ok || v != nil {
+		t.Errorf("Expected: nil as the queue should be empty; Got: %d", v)
+	}
+
+	q.Push(1)
+	if v, ok := q.Pop(); !ok || v != 1 {
+		t.Errorf("Expected: 1; Got: %v", v)
+	}
+}
+
+func TestLockFreeQueueWithReclamationConcurrentPushPopResetShouldRetrieveAllElementsOnce(t *testing.T) {
+	q := NewWithReclamation()
+	queuetest.CheckConcurrentReset(t, "lockfreequeue", q, goroutines, concurrentCount)
+}
+
+func TestLockFreeQueueConcurrentPushPopShouldRetrieveAllElementsOnce(t *testing.T) {
+	q := New()
+	testConcurrentPushPop(t, func(p int) func(v interface{}) {
+		return q.Push
+	}, q.Pop)
+}
+
+func TestLockFreeQueueConcurrentBatchPushPopShouldRetrieveAllElementsOnce(t *testing.T) {
+	q := New()
+	testConcurrentPushPop(t, func(p int) func(v interface{}) {
+		bp := q.NewBatchProducer(p*7 + 1)
+		return func(v interface{}) {
+			bp.Push(v)
+			if v.(int)%concurrentCount == concurrentCount-1 {
+				bp.Flush()
+			}
+		}
+	}, q.Pop)
+}
+
+func TestLockFreeQueueWithReclamationConcurrentPushPopShouldRetrieveAllElementsOnce(t *testing.T) {
+	q := NewWithReclamation()
+	testConcurrentPushPop(t, func(p int) func(v interface{}) {
+		return q.Push
+	}, q.Pop)
+}
+
+func TestLockFreeQueueWithReclamationConcurrentBatchPushPopShouldRetrieveAllElementsOnce(t *testing.T) {
+	q := NewWithReclamation()
+	testConcurrentPushPop(t, func(p int) func(v interface{}) {
+		bp := q.NewBatchProducer(p*7 + 1)
+		return func(v interface{}) {
+			bp.Push(v)
+			if v.(int)%concurrentCount == concurrentCount-1 {
+				bp.Flush()
+			}
+		}
+	}, q.Pop)
+}
+
+func TestLockFreeQueueWithShardedLenConcurrentPushPopShouldRetrieveAllElementsOnce(t *testing.T) {
+	q := NewWithShardedLen()
+	testConcurrentPushPop(t, func(p int) func(v interface{}) {
+		return q.Push
+	}, q.Pop)
+	if q.Len() != 0 {
+		t.Errorf("Expected: %d; Got: %d", 0, q.Len())
+	}
+}
+
+func TestLockFreeQueueWithShardedLenLenShouldReturnLengthAfterCompletedOperations(t *testing.T) {
+	q := NewWithShardedLen()
+	for i := 0; i < 10; i++ {
+		q.Push(i)
+	}
+	q.Pop()
+	if q.Len() != 9 {
+		t.Errorf("Expected: %d; Got: %d", 9, q.Len())
+	}
+
+	bp := q.NewBatchProducer(4)
+	for i := 0; i < 3; i++ {
+		bp.Push(i)
+	}
+	bp.Flush()
+	if q.Len() != 12 {
+		t.Errorf("Expected: %d after Flush; Got: %d", 12, q.Len())
+	}
+
+	q.Reset()
+	if q.Len() != 0 {
+		t.Errorf("Expected: %d after Reset; Got: %d", 0, q.Len())
+	}
+	q.Push(1)
+	q.Init()
+	if q.Len() != 0 {
+		t.Errorf("Expected: %d after Init; Got: %d", 0, q.Len())
+	}
+}
+
+func TestLockFreeQueueWithShardedLenWatermarksShouldNotifyWhenLengthCrossesWatermarks(t *testing.T) {
+	q := NewWithShardedLen()
+	var events []int
+	q.SetWatermarks(Watermarks{
+		High:   10,
+		Low:    5,
+		OnHigh: func(l int) { events = append(events, l) },
+		OnLow:  func(l int) { events = append(events, -l) },
+	})
+
+	for i := 0; i < 20; i++ {
+		q.Push(i)
+	}
+	for i := 0; i < 20; i++ {
+		q.Pop()
+	}
+
+	expected := []int{10, -5}
+	if len(events) != len(expected) || events[0] != expected[0] || events[1] != expected[1] {
+		t.Errorf("Expected: %v; Got: %v", expected, events)
+	}
+}
+
+func TestLockFreeQueueWithReclamationShouldReuseNodes(t *testing.T) {
+	q := NewWithReclamation()
+	for i := 0; i < concurrentCount; i++ {
+		q.Push(i)
+		if v, ok := q.Front(); !ok || v != i {
+			t.Fatalf("Expected: %d; Got: %v", i, v)
+		}
+		if v, ok := q.Pop(); !ok || v != i {
+			t.Fatalf("Expected: %d; Got: %v", i, v)
+		}
+	}
+
+	n := q.newNode(nil)
+	if n.v != nil || n.n != nil {
+		t.Errorf("Expected: cleared reclaimed node; Got: %+v", n)
+	}
+	allocs := testing.AllocsPerRun(100, func() {
+		q.Push(1)
+		q.Pop()
+	})
+	if allocs > 0 {
+		t.Errorf("Expected: no allocations as nodes are reused; Got: %v", allocs)
+	}
+}
+
+func TestLockFreeQueueBatchProducerShouldOnlyPublishFlushedValues(t *testing.T) {
+	q := New()
+	p := q.NewBatchProducer(3)
+
+	p.Push(1)
+	p.Push(2)
+	if q.Len() != 0 || p.Len() != 2 {
+		t.Errorf("Expected: 0 queued and 2 buffered values; Got: %d and %d", q.Len(), p.Len())
+	}
+	if _, ok := q.Pop(); ok {
+		t.Error("Expected: empty queue as the values are buffered; Got: non-empty")
+	}
+
+	p.Push(3)
+	p.Push(4)
+	if q.Len() != 3 || p.Len() != 1 {
+		t.Errorf("Expected: 3 queued and 1 buffered values; Got: %d and %d", q.Len(), p.Len())
+	}
+	p.Flush()
+	p.Flush()
+	for i := 1; i <= 4; i++ {
+		if v, ok := q.Pop(); !ok || v.(int) != i {
+			t.Errorf("Expected: %d; Got: %d", i, v)
+		}
+	}
+	if _, ok := q.Pop(); ok {
+		t.Error("Expected: empty queue; Got: non-empty")
+	}
+}
+
+func TestLockFreeQueueBatchProducerWithInvalidSizeShouldNotBuffer(t *testing.T) {
+	q := New()
+	p := q.NewBatchProducer(0)
+
+	p.Push(1)
+	if v, ok := q.Pop(); !ok || v.(int) != 1 {
+		t.Errorf("Expected: 1; Got: %d", v)
+	}
+}
+
+// testConcurrentPushPop pushes values from multiple producers, using the push function
+// returned by newPush for each producer, while multiple consumers pop them using pop.
+// It verifies every value is popped exactly once and that the values pushed by each
+// producer are popped in order by each consumer.
+func testConcurrentPushPop(t *testing.T, newPush func(p int) func(v interface{}), pop func() (interface{}, bool)) {
+	var wg sync.WaitGroup
+	for p := 0; p < goroutines; p++ {
+		wg.Add(1)
+		go func(p int, push func(v interface{})) {
+			defer wg.Done()
+			for i := 0; i < concurrentCount; i++ {
+				push(p*concurrentCount + i)
+			}
+		}(p, newPush(p))
+	}
+
+	popped := make([][]int, goroutines)
+	for c := 0; c < goroutines; c++ {
+		wg.Add(1)
+		go func(c int) {
+			defer wg.Done()
+			for len(popped[c]) < concurrentCount {
+				v, ok := pop()
+				if !ok {
+					runtime.Gosched()
+					continue
+				}
+				popped[c] = append(popped[c], v.(int))
+			}
+		}(c)
+	}
+	wg.Wait()
+
+	seen := make([]int, goroutines*concurrentCount)
+	for c := range popped {
+		last := make([]int, goroutines)
+		for i := range last {
+			last[i] = -1
+		}
+		for _, v := range popped[c] {
+			seen[v]++
+			p := v / concurrentCount
+			if v <= last[p] {
+				t.Errorf("Expected: values of producer %d in order; Got: %d after %d", p, v, last[p])
+			}
+			last[p] = v
+		}
+	}
+	for v, s := range seen {
+		if s != 1 {
+			t.Errorf("Expected: %d popped once; Got: popped %d times", v, s)
+		}
+	}
+}
+
+func TestLockFreeQueueWatermarksShouldNotifyWhenLengthCrossesWatermarks(t *testing.T) {
+	q := New()
+	var events []int
+	q.SetWatermarks(Watermarks{
+		High:   10,
+		Low:    5,
+		OnHigh: func(l int) { events = append(events, l) },
+		OnLow:  func(l int) { events = append(events, -l) },
+	})
+
+	for r := 0; r < 2; r++ {
+		for i := 0; i < 20; i++ {
+			q.Push(i)
+		}
+		for i := 0; i < 20; i++ {
+			q.Pop()
+		}
+	}
+
+	expected := []int{10, -5, 10, -5}
+	if len(events) != len(expected) {
+		t.Fatalf("Expected: %v; Got: %v", expected, events)
+	}
+	for i := range expected {
+		if events[i] != expected[i] {
+			t.Fatalf("Expected: %v; Got: %v", expected, events)
+		}
+	}
+}
+
+func TestLockFreeQueueWatermarksCallbacksShouldBeAbleToUseQueue(t *testing.T) {
+	q := New()
+	var high, low int
+	q.SetWatermarks(Watermarks{
+		High:   2,
+		Low:    0,
+		OnHigh: func(l int) { high = q.Len() },
+		OnLow:  func(l int) { low = q.Len() },
+	})
+
+	q.Push(1)
+	q.Push(2)
+	q.Pop()
+	q.Pop()
+	if high != 2 || low != 0 {
+		t.Errorf("Expected: 2 and 0; Got: %d and %d", high, low)
+	}
+}
+
+func TestLockFreeQueueSetWatermarksWithLongQueueShouldNotifyRightAway(t *testing.T) {
+	q := New()
+	for i := 0; i < 10; i++ {
+		q.Push(i)
+	}
+
+	high := 0
+	q.SetWatermarks(Watermarks{High: 5, OnHigh: func(l int) { high = l }})
+	if high != 10 {
+		t.Errorf("Expected: %d; Got: %d", 10, high)
+	}
+}
+
+func TestLockFreeQueueProducerAndConsumerFieldsShouldBeInDifferentCacheLines(t *testing.T) {
+	var q LockFreeQueue
+	if d := unsafe.Offsetof(q.tail) - unsafe.Offsetof(q.head); d < cacheLineSize {
+		t.Errorf("Expected: at least %d bytes between head and tail; Got: %d", cacheLineSize, d)
+	}
+}
+
+func TestLockFreeQueueLenApproxShouldReturnLengthAfterCompletedOperations(t *testing.T) {
+	q := New()
+	for i := 0; i < 10; i++ {
+		q.Push(i)
+	}
+	q.Pop()
+
+	if l := q.LenApprox(); l != 9 {
+		t.Errorf("Expected: %d; Got: %d", 9, l)
+	}
+}
+
+func TestLockFreeQueueEveryInterleavingOfPushPopShouldPopEachValueOnce(t *testing.T) {
+	for name, newQueue := range constructors {
+		testEveryInterleaving(t, name, func(s *schedtest.Scheduler, choose schedtest.Chooser) error {
+			q := newQueue()
+			var popped [2]interface{}
+			var ok [2]bool
+			thread := func(i int) func() {
+				return func() {
+					q.Push(i)
+					popped[i], ok[i] = q.Pop()
+				}
+			}
+
+			schedule, err := s.Run(choose, thread(0), thread(1))
+			if err != nil {
+				return err
+			}
+			if !ok[0] || !ok[1] || popped[0] == popped[1] || q.Len() != 0 {
+				return fmt.Errorf("schedule %v: popped %v, %v with %d values left", schedule, popped, ok, q.Len())
+			}
+			return nil
+		})
+	}
+}
+
+func TestLockFreeQueueEveryInterleavingOfConcurrentPopsShouldPopValueOnce(t *testing.T) {
+	for name, newQueue := range constructors {
+		testEveryInterleaving(t, name, func(s *schedtest.Scheduler, choose schedtest.Chooser) error {
+			q := newQueue()
+			q.Push(1)
+			var ok [2]bool
+			var front interface{}
+			schedule, err := s.Run(choose,
+				func() { _, ok[0] = q.Pop() },
+				func() { _, ok[1] = q.Pop() },
+				func() { front, _ = q.Front() })
+			if err != nil {
+				return err
+			}
+			if ok[0] == ok[1] || (front != nil && front != 1) {
+				return fmt.Errorf("schedule %v: pops returned %v, front returned %v", schedule, ok, front)
+			}
+			return nil
+		})
+	}
+}
+
+func TestLockFreeQueueEveryInterleavingOfPushPopResetShouldRetrieveEachValueOnce(t *testing.T) {
+	for name, newQueue := range constructors {
+		testEveryInterleaving(t, name, func(s *schedtest.Scheduler, choose schedtest.Chooser) error {
+			q := newQueue()
+			q.Push(0)
+			var popped interface{}
+			var ok bool
+			var reset []interface{}
+			schedule, err := s.Run(choose,
+				func() {
+					q.Push(1)
+					popped, ok = q.Pop()
+				},
+				func() { reset = q.Reset() })
+			if err != nil {
+				return err
+			}
+
+			got := append(q.Reset(), reset...)
+			if ok {
+				got = append(got, popped)
+			}
+			seen := make(map[interface{}]int)
+			for _, v := range got {
+				seen[v]++
+			}
+			if len(got) != 2 || seen[0] != 1 || seen[1] != 1 || q.Len() != 0 {
+				return fmt.Errorf("schedule %v: popped %v, %v, reset %v with %d values left", schedule, popped, ok, reset, q.Len())
+			}
+			return nil
+		})
+	}
+}
+
+func TestLockFreeQueueRandomSchedulesShouldPopEachValueOnce(t *testing.T) {
+	// Enough values are pushed and popped to advance the epoch and reuse the reclaimed nodes.
+	const threads, values = 3, 100
+	for name, newQueue := range constructors {
+		var s schedtest.Scheduler
+		testHookYield = s.Yield
+		for seed := int64(0); seed < randomSchedules; seed++ {
+			q := newQueue()
+			seen := make([]int, threads*values)
+			var fns []func()
+			for i := 0; i < threads; i++ {
+				i := i
+				fns = append(fns, func() {
+					for j := 0; j < values; j++ {
+						q.Push(i*values + j)
+						if v, ok := q.Pop(); ok {
+							seen[v.(int)]++
+						}
+					}
+				})
+			}
+			if _, err := s.Run(schedtest.Random(seed), fns...); err != nil {
+				t.Fatalf("%s: seed %d: %v", name, seed, err)
+			}
+
+			for v, ok := q.Pop(); ok; v, ok = q.Pop() {
+				seen[v.(int)]++
+			}
+			for v, n := range seen {
+				if n != 1 {
+					t.Fatalf("%s: seed %d: Expected: %d popped once; Got: popped %d times", name, seed, v, n)
+				}
+			}
+		}
+		testHookYield = nil
+	}
+}
+
+// testEveryInterleaving runs test for every interleaving of the queue operations run by
+// test, reporting the first failing interleaving of the queue built using constructor name.
+func testEveryInterleaving(t *testing.T, name string, test func(s *schedtest.Scheduler, choose schedtest.Chooser) error) {
+	var s schedtest.Scheduler
+	testHookYield = s.Yield
+	defer func() { testHookYield = nil }()
+
+	runs, err := schedtest.Explore(maxInterleavings, func(choose schedtest.Chooser) error {
+		return test(&s, choose)
+	})
+	if err != nil {
+		t.Errorf("%s: %v", name, err)
+	}
+	if runs >= maxInterleavings {
+		t.Errorf("%s: Expected: less than %d interleavings; Got: %d", name, maxInterleavings, runs)
+	}
+}
+
+func TestLockFreeQueuePopEShouldReturnErrEmptyWhenEmpty(t *testing.T) {
+	q := New()
+	q.Push(1)
+
+	if v, err := q.PopE(); err != nil || v != 1 {
+		t.Errorf("Expected: %d; Got: %v, %v", 1, v, err)
+	}
+	if v, err := q.PopE(); err != queueerr.ErrEmpty || v != nil {
+		t.Errorf("Expected: %v; Got: %v, %v", queueerr.ErrEmpty, v, err)
+	}
+}
+
+func TestLockFreeQueueProducerOrderShouldHoldWithPreemptionsInsideOperations(t *testing.T) {
+	in := queuetest.NewInjector(queuetest.Faults{Seed: 1, Points: queuetest.Inside, Preempt: 0.5})
+	testHookYield = in.Inside
+	defer func() { testHookYield = nil }()
+
+	for name, newQueue := range constructors {
+		newQueue := newQueue
+		impl := queuetest.ConcurrentImpl{Name: name, New: func() queuetest.ConcurrentQueue { return newQueue() }}
+		queuetest.CheckNoDeadlock(t, time.Minute, func() {
+			queuetest.CheckProducerOrder(t, impl, goroutines, goroutines, concurrentCount/10)
+		})
+	}
+	if in.Stats().Preemptions == 0 {
+		t.Error("Expected: injected preemptions; Got: none")
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package mailbox
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/christianrpetrin/queue-tests/mpscqueue"
+)
+
+var (
+	// benchSenders holds the number of sender goroutines probed by the throughput benchmark tests.
+	benchSenders = []int{1, 4, 16}
+
+	// channelMailboxSize holds the buffer size of the channel based mailbox.
+	channelMailboxSize = 1024
+
+	// Used to store temp values, avoiding any compiler optimizations.
+	tmp interface{}
+)
+
+// benchMessage is a message sent to the mailbox by the benchmark tests.
+type benchMessage struct {
+	mpscqueue.Node
+
+	// sent holds the time the message was sent.
+	sent time.Time
+}
+
+// BenchmarkMailboxThroughput probes multiple senders sending b.N messages to a single receiver.
+func BenchmarkMailboxThroughput(b *testing.B) {
+	for _, senders := range benchSenders {
+		senders := senders
+		b.Run("Mailbox/"+strconv.Itoa(senders), func(b *testing.B) {
+			m := New()
+			benchmarkThroughput(b, senders, func(msg *benchMessage) { m.Send(msg) }, func() { tmp = m.Receive() })
+		})
+		b.Run("Channel/"+strconv.Itoa(senders), func(b *testing.B) {
+			c := make(chan *benchMessage, channelMailboxSize)
+			benchmarkThroughput(b, senders, func(msg *benchMessage) { c <- msg }, func() { tmp = <-c })
+		})
+	}
+}
+
+// benchmarkThroughput sends b.N messages from senders goroutines using send,
+// while the benchmark goroutine receives them using receive.
+func benchmarkThroughput(b *testing.B, senders int, send func(msg *benchMessage), receive func()) {
+	perSender := b.N/senders + 1
+
+	var wg sync.WaitGroup
+	for s := 0; s < senders; s++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := 0; n < perSender; n++ {
+				send(&benchMessage{})
+			}
+		}()
+	}
+
+	for n := 0; n < perSender*senders; n++ {
+		receive()
+	}
+	wg.Wait()
+}
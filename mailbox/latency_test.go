@@ -0,0 +1,67 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+//go:build go1.13
+// +build go1.13
+
+package mailbox
+
+import (
+	"testing"
+	"time"
+)
+
+// BenchmarkMailboxWakeUpLatency probes the time it takes for a message to reach a
+// receiver that is blocked waiting for messages. The sender waits for the receiver
+// to process each message before sending the next one, so the receiver always
+// blocks before each message arrives. The latency is reported in the latency-ns/op metric.
+func BenchmarkMailboxWakeUpLatency(b *testing.B) {
+	b.Run("Mailbox", func(b *testing.B) {
+		m := New()
+		benchmarkWakeUpLatency(b, func(msg *benchMessage) { m.Send(msg) }, func() *benchMessage {
+			return m.Receive().(*benchMessage)
+		})
+	})
+	b.Run("Channel", func(b *testing.B) {
+		c := make(chan *benchMessage, channelMailboxSize)
+		benchmarkWakeUpLatency(b, func(msg *benchMessage) { c <- msg }, func() *benchMessage {
+			return <-c
+		})
+	})
+}
+
+// benchmarkWakeUpLatency sends b.N messages using send, one at a time, to a
+// receiver goroutine receiving them using receive.
+func benchmarkWakeUpLatency(b *testing.B, send func(msg *benchMessage), receive func() *benchMessage) {
+	ack := make(chan time.Duration)
+	go func() {
+		for n := 0; n < b.N; n++ {
+			msg := receive()
+			ack <- time.Since(msg.sent)
+		}
+	}()
+
+	var total time.Duration
+	for n := 0; n < b.N; n++ {
+		send(&benchMessage{sent: time.Now()})
+		total += <-ack
+	}
+	b.ReportMetric(float64(total.Nanoseconds())/float64(b.N), "latency-ns/op")
+}
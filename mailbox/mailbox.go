@@ -0,0 +1,137 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package mailbox implements an unbounded actor mailbox, suitable as an actor or event loop inbox.
+// Internally, mailbox stores the messages in an intrusive mpscqueue.MPSCQueue and wakes up the
+// single receiving goroutine when messages arrive while it is blocked waiting for them.
+// Senders only notify the receiver when it is actually waiting, so sending a message to a busy
+// receiver costs a single atomic swap plus a single atomic load.
+package mailbox
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/christianrpetrin/queue-tests/mpscqueue"
+)
+
+const (
+	// running indicates the receiver is not waiting for messages.
+	running int32 = iota
+
+	// waiting indicates the receiver is, or is about to be, blocked waiting for messages.
+	waiting
+)
+
+// Mailbox represents an unbounded, multi-producer single-consumer actor mailbox.
+// Send is safe for concurrent use by multiple goroutines, while the receive
+// methods must only be called by a single goroutine at a time.
+// The zero value for mailbox is not ready to use; use New to create a mailbox.
+type Mailbox struct {
+	// q holds the messages.
+	q *mpscqueue.MPSCQueue
+
+	// state holds whether the receiver is waiting for messages.
+	state int32
+
+	// wake is used to wake up the receiver. It has a buffer of 1, so a sender
+	// never blocks as at most one wake up is pending at any given time.
+	wake chan struct{}
+}
+
+// New returns an initialized mailbox.
+func New() *Mailbox {
+	return &Mailbox{
+		q:    mpscqueue.New(),
+		wake: make(chan struct{}, 1),
+	}
+}
+
+// Send adds message e to the mailbox, waking up the receiver if it is waiting for messages.
+// Send is safe for concurrent use by multiple goroutines and never blocks.
+// The complexity is O(1).
+func (m *Mailbox) Send(e mpscqueue.Element) {
+	m.q.Push(e)
+	if atomic.LoadInt32(&m.state) == waiting && atomic.CompareAndSwapInt32(&m.state, waiting, running) {
+		m.wake <- struct{}{}
+	}
+}
+
+// TryReceive retrieves and removes the next message from the mailbox without blocking.
+// The second, bool result indicates whether a valid message was returned;
+//   if the mailbox is empty, false will be returned.
+// The complexity is O(1).
+func (m *Mailbox) TryReceive() (mpscqueue.Element, bool) {
+	return m.q.Pop()
+}
+
+// Receive retrieves and removes the next message from the mailbox, blocking
+// until a message is available.
+// The complexity is O(1).
+func (m *Mailbox) Receive() mpscqueue.Element {
+	e, _ := m.receive(context.Background())
+	return e
+}
+
+// ReceiveContext retrieves and removes the next message from the mailbox, blocking
+// until a message is available or ctx is done, in which case ctx.Err() is returned.
+// The complexity is O(1).
+func (m *Mailbox) ReceiveContext(ctx context.Context) (mpscqueue.Element, error) {
+	return m.receive(ctx)
+}
+
+// receive retrieves and removes the next message from the mailbox, blocking until
+// a message is available or ctx is done.
+func (m *Mailbox) receive(ctx context.Context) (mpscqueue.Element, error) {
+	for {
+		if e, ok := m.q.Pop(); ok {
+			return e, nil
+		}
+
+		// Announce the receiver is about to wait and check the queue again, so a
+		// message sent before the announcement is not missed.
+		atomic.StoreInt32(&m.state, waiting)
+		if e, ok := m.q.Pop(); ok {
+			m.cancelWait()
+			return e, nil
+		}
+
+		// A woken up receiver may still observe an empty queue if the push of a
+		// previous message is still in progress; the sender of that message will
+		// wake up the receiver again once the push completes.
+		select {
+		case <-m.wake:
+		case <-ctx.Done():
+			m.cancelWait()
+			if e, ok := m.q.Pop(); ok {
+				return e, nil
+			}
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// cancelWait announces the receiver is no longer waiting, consuming the wake
+// up sent by a sender that observed the receiver waiting, if any.
+func (m *Mailbox) cancelWait() {
+	if !atomic.CompareAndSwapInt32(&m.state, waiting, running) {
+		<-m.wake
+	}
+}
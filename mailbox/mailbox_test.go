@@ -0,0 +1,153 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package mailbox
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/christianrpetrin/queue-tests/mpscqueue"
+)
+
+const (
+	// concurrentCount holds the number of messages sent by each goroutine in the concurrent tests.
+	concurrentCount = 10000
+
+	// senders holds the number of sender goroutines in the concurrent tests.
+	senders = 4
+)
+
+// testMessage is a message sent to the mailbox by the tests.
+type testMessage struct {
+	mpscqueue.Node
+
+	// v holds the message value.
+	v int
+}
+
+func TestMailboxNewShouldReturnInitiazedInstanceOfMailbox(t *testing.T) {
+	m := New()
+
+	if m == nil {
+		t.Error("Expected: new instance of mailbox; Got: nil")
+	}
+	if e, ok := m.TryReceive(); ok || e != nil {
+		t.Errorf("Expected: empty mailbox; Got: %v", e)
+	}
+}
+
+func TestMailboxSendReceiveShouldRetrieveAllMessagesInOrder(t *testing.T) {
+	m := New()
+	for i := 0; i < 1000; i++ {
+		m.Send(&testMessage{v: i})
+	}
+
+	for i := 0; i < 1000; i++ {
+		if e := m.Receive(); e.(*testMessage).v != i {
+			t.Errorf("Expected: %d; Got: %d", i, e.(*testMessage).v)
+		}
+	}
+	if e, ok := m.TryReceive(); ok || e != nil {
+		t.Errorf("Expected: empty mailbox; Got: %v", e)
+	}
+}
+
+func TestMailboxReceiveShouldWaitForMessage(t *testing.T) {
+	m := New()
+	received := make(chan int)
+	go func() {
+		received <- m.Receive().(*testMessage).v
+	}()
+
+	select {
+	case v := <-received:
+		t.Fatalf("Expected: receive blocked as the mailbox is empty; Got: %d", v)
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	m.Send(&testMessage{v: 1})
+	select {
+	case v := <-received:
+		if v != 1 {
+			t.Errorf("Expected: 1; Got: %d", v)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Expected: receiver woken up; Got: lost wake up")
+	}
+}
+
+func TestMailboxReceiveContextShouldReturnContextError(t *testing.T) {
+	m := New()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if e, err := m.ReceiveContext(ctx); err != context.DeadlineExceeded || e != nil {
+		t.Errorf("Expected: %v; Got: %v, %v", context.DeadlineExceeded, e, err)
+	}
+
+	// The mailbox must still be usable after a cancelled receive.
+	m.Send(&testMessage{v: 1})
+	if e, err := m.ReceiveContext(context.Background()); err != nil || e.(*testMessage).v != 1 {
+		t.Errorf("Expected: 1; Got: %v, %v", e, err)
+	}
+}
+
+func TestMailboxConcurrentSendShouldNotLoseWakeUps(t *testing.T) {
+	m := New()
+	var wg sync.WaitGroup
+	for s := 0; s < senders; s++ {
+		wg.Add(1)
+		go func(s int) {
+			defer wg.Done()
+			for i := 0; i < concurrentCount; i++ {
+				m.Send(&testMessage{v: s*concurrentCount + i})
+				if i%100 == 0 {
+					// Let the receiver drain the mailbox and block waiting for messages.
+					time.Sleep(time.Microsecond)
+				}
+			}
+		}(s)
+	}
+
+	seen := make([]bool, senders*concurrentCount)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < senders*concurrentCount; i++ {
+			seen[m.Receive().(*testMessage).v] = true
+		}
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(30 * time.Second):
+		t.Fatal("Expected: all messages received; Got: receiver blocked (lost wake up)")
+	}
+	wg.Wait()
+
+	for v, s := range seen {
+		if !s {
+			t.Errorf("Expected: %d received; Got: not received", v)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package middleware implements decorators adding features (e.g. metrics, tracing, TTL
+// filtering and rate limiting) around any of the queue implementations in this repo, so the
+// features are composed as needed instead of being built into each implementation.
+// Internally, a middleware is a function returning a queue that wraps the next queue in the
+// chain, usually by embedding it and overriding some of its operations, and Wrap applies the
+// middlewares from the innermost to the outermost one.
+// Wrapped queues only expose the Queue operations; the other operations of the wrapped
+// implementation (e.g. Front) are not reachable through the chain.
+// The middlewares in this package are safe for concurrent use if the wrapped queue is.
+package middleware
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/christianrpetrin/queue-tests/queuetest"
+)
+
+// Queue is the set of operations shared by all the queue implementations.
+type Queue interface {
+	queuetest.Queue
+}
+
+// Middleware returns a queue adding a feature around the operations of queue next.
+type Middleware func(next Queue) Queue
+
+// Wrap returns queue q wrapped by middlewares mw.
+// The first middleware is the outermost one: each operation goes through mw[0], then mw[1],
+// and so on, before reaching q.
+func Wrap(q Queue, mw ...Middleware) Queue {
+	for i := len(mw) - 1; i >= 0; i-- {
+		q = mw[i](q)
+	}
+	return q
+}
+
+// Counters holds the number of operations counted by the Metrics middleware.
+// Counters is safe for concurrent use by multiple goroutines.
+type Counters struct {
+	// pushes holds the number of pushed values.
+	pushes uint64
+
+	// pops holds the number of popped values.
+	pops uint64
+
+	// misses holds the number of pops that found the queue empty.
+	misses uint64
+}
+
+// Pushes returns the number of pushed values.
+func (c *Counters) Pushes() uint64 { return atomic.LoadUint64(&c.pushes) }
+
+// Pops returns the number of popped values.
+func (c *Counters) Pops() uint64 { return atomic.LoadUint64(&c.pops) }
+
+// Misses returns the number of pops that found the queue empty.
+func (c *Counters) Misses() uint64 { return atomic.LoadUint64(&c.misses) }
+
+// Metrics returns a middleware counting the queue operations in c.
+// A Counters may be shared by multiple queues, to count their operations together.
+func Metrics(c *Counters) Middleware {
+	return func(next Queue) Queue { return &metricsQueue{Queue: next, c: c} }
+}
+
+// metricsQueue counts the operations of the queue it wraps.
+type metricsQueue struct {
+	// Queue holds the wrapped queue.
+	Queue
+
+	// c holds the operation counters.
+	c *Counters
+}
+
+// Push adds a value to the queue.
+func (q *metricsQueue) Push(v interface{}) {
+	q.Queue.Push(v)
+	atomic.AddUint64(&q.c.pushes, 1)
+}
+
+// Pop retrieves and removes the next element from the queue.
+func (q *metricsQueue) Pop() (interface{}, bool) {
+	v, ok := q.Queue.Pop()
+	if ok {
+		atomic.AddUint64(&q.c.pops, 1)
+	} else {
+		atomic.AddUint64(&q.c.misses, 1)
+	}
+	return v, ok
+}
+
+// Op identifies a traced queue operation.
+type Op int
+
+const (
+	// OpPush identifies Push.
+	OpPush Op = iota
+
+	// OpPop identifies Pop.
+	OpPop
+)
+
+// String returns the name of operation o.
+func (o Op) String() string {
+	if o == OpPush {
+		return "push"
+	}
+	return "pop"
+}
+
+// Event describes a traced queue operation.
+type Event struct {
+	// Op holds the traced operation.
+	Op Op
+
+	// Value holds the pushed or popped value, or nil if Pop found the queue empty.
+	Value interface{}
+
+	// OK is false if Pop found the queue empty, and true otherwise.
+	OK bool
+
+	// Duration holds the time the operation took, including the inner middlewares.
+	Duration time.Duration
+}
+
+// Trace returns a middleware calling fn with an event describing each Push and Pop, once
+// the operation completed.
+// Fn is called by the goroutines calling the queue operations, so it must be safe for
+// concurrent use if the queue is used concurrently.
+func Trace(fn func(e Event)) Middleware {
+	return func(next Queue) Queue { return &traceQueue{Queue: next, fn: fn} }
+}
+
+// traceQueue traces the operations of the queue it wraps.
+type traceQueue struct {
+	// Queue holds the wrapped queue.
+	Queue
+
+	// fn is called with each traced event.
+	fn func(e Event)
+}
+
+// Push adds a value to the queue.
+func (q *traceQueue) Push(v interface{}) {
+	start := time.Now()
+	q.Queue.Push(v)
+	q.fn(Event{Op: OpPush, Value: v, OK: true, Duration: time.Since(start)})
+}
+
+// Pop retrieves and removes the next element from the queue.
+func (q *traceQueue) Pop() (interface{}, bool) {
+	start := time.Now()
+	v, ok := q.Queue.Pop()
+	q.fn(Event{Op: OpPop, Value: v, OK: ok, Duration: time.Since(start)})
+	return v, ok
+}
@@ -0,0 +1,136 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package middleware
+
+import (
+	"testing"
+	"time"
+
+	"github.com/christianrpetrin/queue-tests/queueimpl7"
+	"github.com/christianrpetrin/queue-tests/queuetest"
+)
+
+// recorderQueue records the names of the middlewares each operation went through.
+type recorderQueue struct {
+	// Queue holds the wrapped queue.
+	Queue
+
+	// name holds the middleware name.
+	name string
+
+	// calls points to the recorded names.
+	calls *[]string
+}
+
+func (q *recorderQueue) Push(v interface{}) {
+	*q.calls = append(*q.calls, q.name)
+	q.Queue.Push(v)
+}
+
+// recorder returns a middleware recording its name in calls on each Push.
+func recorder(name string, calls *[]string) Middleware {
+	return func(next Queue) Queue { return &recorderQueue{Queue: next, name: name, calls: calls} }
+}
+
+// fakeClock is a manually advanced clock.
+type fakeClock struct {
+	t time.Time
+}
+
+func (c *fakeClock) now() time.Time { return c.t }
+
+func (c *fakeClock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func TestWrapShouldApplyMiddlewaresFromOutermostToInnermost(t *testing.T) {
+	var calls []string
+	q := Wrap(queueimpl7.New(), recorder("a", &calls), recorder("b", &calls), recorder("c", &calls))
+	q.Push(1)
+
+	if len(calls) != 3 || calls[0] != "a" || calls[1] != "b" || calls[2] != "c" {
+		t.Errorf("Expected: [a b c]; Got: %v", calls)
+	}
+	if v, ok := q.Pop(); !ok || v.(int) != 1 {
+		t.Errorf("Expected: 1; Got: %v", v)
+	}
+}
+
+func TestWrapWithoutMiddlewaresShouldReturnTheQueue(t *testing.T) {
+	q := queueimpl7.New()
+	if w := Wrap(q); w != Queue(q) {
+		t.Errorf("Expected: %p; Got: %p", q, w)
+	}
+}
+
+func TestWrapShouldKeepQueueProperties(t *testing.T) {
+	var c Counters
+	queuetest.CheckProperties(t, queuetest.Impl{
+		Name: "middleware",
+		New: func() queuetest.Queue {
+			return Wrap(queueimpl7.New(),
+				Metrics(&c),
+				Trace(func(Event) {}),
+				RateLimit(1e12, 1<<30, RateLimitOptions{}),
+				TTL(time.Hour, TTLOptions{}))
+		},
+	}, nil)
+	if c.Pushes() == 0 || c.Pushes() < c.Pops() {
+		t.Errorf("Expected: pushes, and at least as many as pops; Got: %d and %d", c.Pushes(), c.Pops())
+	}
+}
+
+func TestMetricsShouldCountOperations(t *testing.T) {
+	var c Counters
+	q := Wrap(queueimpl7.New(), Metrics(&c))
+	q2 := Wrap(queueimpl7.New(), Metrics(&c))
+	for i := 0; i < 5; i++ {
+		q.Push(i)
+	}
+	q2.Push(5)
+	for i := 0; i < 7; i++ {
+		q.Pop()
+	}
+
+	if c.Pushes() != 6 || c.Pops() != 5 || c.Misses() != 2 {
+		t.Errorf("Expected: 6 pushes, 5 pops and 2 misses; Got: %d, %d and %d", c.Pushes(), c.Pops(), c.Misses())
+	}
+	if q.Len() != 0 || q2.Len() != 1 {
+		t.Errorf("Expected: lengths 0 and 1; Got: %d and %d", q.Len(), q2.Len())
+	}
+}
+
+func TestTraceShouldReportEachOperation(t *testing.T) {
+	var events []Event
+	q := Wrap(queueimpl7.New(), Trace(func(e Event) { events = append(events, e) }))
+	q.Push("a")
+	q.Pop()
+	q.Pop()
+
+	expected := []Event{{Op: OpPush, Value: "a", OK: true}, {Op: OpPop, Value: "a", OK: true}, {Op: OpPop}}
+	if len(events) != len(expected) {
+		t.Fatalf("Expected: %d events; Got: %v", len(expected), events)
+	}
+	for i, e := range expected {
+		got := events[i]
+		if got.Op != e.Op || got.Value != e.Value || got.OK != e.OK || got.Duration < 0 {
+			t.Errorf("Expected: %s %v %t; Got: %s %v %t %v", e.Op, e.Value, e.OK, got.Op, got.Value, got.OK, got.Duration)
+		}
+	}
+}
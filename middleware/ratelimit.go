@@ -0,0 +1,105 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package middleware
+
+import (
+	"sync"
+	"time"
+)
+
+// RateLimitOptions configures the RateLimit middleware.
+// The zero value for RateLimitOptions holds the default configuration.
+type RateLimitOptions struct {
+	// Now returns the current time.
+	// A nil Now uses time.Now.
+	Now func() time.Time
+}
+
+// RateLimit returns a middleware limiting the rate of popped values to perSecond values per
+// second, allowing bursts of up to burst values, using a token bucket: each popped value takes
+// a token, and tokens are added at the given rate, up to burst tokens.
+// Once the bucket is empty, Pop returns false without popping from the wrapped queue, as if the
+// queue was empty, so consumers should check Len to tell the two cases apart.
+// Pushes are not limited. The bucket starts full.
+func RateLimit(perSecond float64, burst int, opts RateLimitOptions) Middleware {
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+	return func(next Queue) Queue {
+		return &rateLimitQueue{
+			Queue:     next,
+			perSecond: perSecond,
+			burst:     float64(burst),
+			tokens:    float64(burst),
+			last:      opts.Now(),
+			now:       opts.Now,
+		}
+	}
+}
+
+// rateLimitQueue limits the rate of the values popped from the queue it wraps.
+type rateLimitQueue struct {
+	// Queue holds the wrapped queue.
+	Queue
+
+	// perSecond holds the number of tokens added each second.
+	perSecond float64
+
+	// burst holds the bucket size.
+	burst float64
+
+	// now returns the current time.
+	now func() time.Time
+
+	// mu guards tokens and last, and serializes the pops so concurrent consumers don't
+	// take more tokens than available.
+	mu sync.Mutex
+
+	// tokens holds the number of tokens in the bucket.
+	tokens float64
+
+	// last holds the time tokens was last updated.
+	last time.Time
+}
+
+// Pop retrieves and removes the next element from the queue, if the rate limit allows it.
+func (q *rateLimitQueue) Pop() (interface{}, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := q.now()
+	if elapsed := now.Sub(q.last); elapsed > 0 {
+		q.tokens += elapsed.Seconds() * q.perSecond
+		if q.tokens > q.burst {
+			q.tokens = q.burst
+		}
+		q.last = now
+	}
+	if q.tokens < 1 {
+		return nil, false
+	}
+
+	v, ok := q.Queue.Pop()
+	if ok {
+		q.tokens--
+	}
+	return v, ok
+}
@@ -0,0 +1,93 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package middleware
+
+import (
+	"testing"
+	"time"
+
+	"github.com/christianrpetrin/queue-tests/queueimpl7"
+)
+
+func TestRateLimitShouldLimitPops(t *testing.T) {
+	c := &fakeClock{t: time.Unix(1000, 0)}
+	q := Wrap(queueimpl7.New(), RateLimit(10, 3, RateLimitOptions{Now: c.now}))
+	for i := 0; i < 10; i++ {
+		q.Push(i)
+	}
+
+	// The bucket starts full, allowing a burst of 3 pops.
+	next := 0
+	for i := 0; i < 3; i++ {
+		if v, ok := q.Pop(); !ok || v.(int) != next {
+			t.Fatalf("Expected: %d; Got: %v", next, v)
+		}
+		next++
+	}
+	if v, ok := q.Pop(); ok || v != nil {
+		t.Errorf("Expected: nil as the rate limit was hit; Got: %v", v)
+	}
+	if q.Len() != 7 {
+		t.Errorf("Expected: %d; Got: %d", 7, q.Len())
+	}
+
+	// 10 pops per second add a token each 100ms.
+	c.advance(250 * time.Millisecond)
+	for i := 0; i < 2; i++ {
+		if v, ok := q.Pop(); !ok || v.(int) != next {
+			t.Fatalf("Expected: %d; Got: %v", next, v)
+		}
+		next++
+	}
+	if _, ok := q.Pop(); ok {
+		t.Error("Expected: rate limit hit after 2 pops; Got: value")
+	}
+	c.advance(50 * time.Millisecond)
+	if _, ok := q.Pop(); !ok {
+		t.Error("Expected: value, as the partial token completed; Got: none")
+	}
+
+	// Tokens don't accumulate beyond the burst size.
+	c.advance(time.Hour)
+	popped := 0
+	for {
+		if _, ok := q.Pop(); !ok {
+			break
+		}
+		popped++
+	}
+	if popped != 3 {
+		t.Errorf("Expected: %d pops; Got: %d", 3, popped)
+	}
+}
+
+func TestRateLimitShouldNotTakeTokensWhenEmpty(t *testing.T) {
+	c := &fakeClock{t: time.Unix(1000, 0)}
+	q := Wrap(queueimpl7.New(), RateLimit(1, 1, RateLimitOptions{Now: c.now}))
+	for i := 0; i < 5; i++ {
+		q.Pop()
+	}
+	q.Push(1)
+
+	if v, ok := q.Pop(); !ok || v.(int) != 1 {
+		t.Errorf("Expected: 1; Got: %v", v)
+	}
+}
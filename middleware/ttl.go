@@ -0,0 +1,94 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package middleware
+
+import (
+	"time"
+)
+
+// TTLOptions configures the TTL middleware.
+// The zero value for TTLOptions holds the default configuration.
+type TTLOptions struct {
+	// Now returns the current time.
+	// A nil Now uses time.Now.
+	Now func() time.Time
+
+	// OnExpire, if not nil, is called with each expired value and its age.
+	OnExpire func(v interface{}, age time.Duration)
+}
+
+// TTL returns a middleware discarding the values that spent more than ttl in the queue:
+// Pop skips them, and pops the next value instead.
+// The queue stores each value along with the time it was pushed, so the middlewares
+// following TTL in Wrap, and the wrapped queue, see the values in an internal wrapper; TTL
+// is therefore usually the last middleware. Len counts the expired values not skipped yet.
+func TTL(ttl time.Duration, opts TTLOptions) Middleware {
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+	return func(next Queue) Queue { return &ttlQueue{Queue: next, ttl: ttl, opts: opts} }
+}
+
+// ttlQueue discards the values that expired in the queue it wraps.
+type ttlQueue struct {
+	// Queue holds the wrapped queue.
+	Queue
+
+	// ttl holds the time after which values expire.
+	ttl time.Duration
+
+	// opts holds the middleware configuration.
+	opts TTLOptions
+}
+
+// ttlEntry represents a queue value along with the time it was pushed.
+type ttlEntry struct {
+	// v holds the user added value.
+	v interface{}
+
+	// t holds the time v was pushed.
+	t time.Time
+}
+
+// Push adds a value to the queue.
+func (q *ttlQueue) Push(v interface{}) {
+	q.Queue.Push(ttlEntry{v: v, t: q.opts.Now()})
+}
+
+// Pop retrieves and removes the next element that did not expire from the queue.
+// The complexity is O(e) plus the cost of the wrapped queue Pop, where e is the number of
+// expired values skipped.
+func (q *ttlQueue) Pop() (interface{}, bool) {
+	for {
+		v, ok := q.Queue.Pop()
+		if !ok {
+			return nil, false
+		}
+		e := v.(ttlEntry)
+		if age := q.opts.Now().Sub(e.t); age > q.ttl {
+			if q.opts.OnExpire != nil {
+				q.opts.OnExpire(e.v, age)
+			}
+			continue
+		}
+		return e.v, true
+	}
+}
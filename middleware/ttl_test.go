@@ -0,0 +1,77 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package middleware
+
+import (
+	"testing"
+	"time"
+
+	"github.com/christianrpetrin/queue-tests/queueimpl7"
+)
+
+func TestTTLShouldSkipExpiredValues(t *testing.T) {
+	c := &fakeClock{t: time.Unix(1000, 0)}
+	var expired []interface{}
+	q := Wrap(queueimpl7.New(), TTL(time.Second, TTLOptions{
+		Now: c.now,
+		OnExpire: func(v interface{}, age time.Duration) {
+			if age <= time.Second {
+				t.Errorf("Expected: age over 1s; Got: %v", age)
+			}
+			expired = append(expired, v)
+		},
+	}))
+	q.Push("old1")
+	q.Push("old2")
+	c.advance(500 * time.Millisecond)
+	q.Push("new")
+	c.advance(time.Second)
+
+	if q.Len() != 3 {
+		t.Errorf("Expected: %d, as expired values are counted until skipped; Got: %d", 3, q.Len())
+	}
+	if v, ok := q.Pop(); !ok || v.(string) != "new" {
+		t.Errorf("Expected: new; Got: %v", v)
+	}
+	if len(expired) != 2 || expired[0] != "old1" || expired[1] != "old2" {
+		t.Errorf("Expected: [old1 old2] expired; Got: %v", expired)
+	}
+
+	q.Push("last")
+	c.advance(2 * time.Second)
+	if v, ok := q.Pop(); ok || v != nil {
+		t.Errorf("Expected: nil as all values expired; Got: %v", v)
+	}
+	if q.Len() != 0 {
+		t.Errorf("Expected: %d; Got: %d", 0, q.Len())
+	}
+}
+
+func TestTTLShouldKeepValuesUpToTheirTTL(t *testing.T) {
+	c := &fakeClock{t: time.Unix(1000, 0)}
+	q := Wrap(queueimpl7.New(), TTL(time.Second, TTLOptions{Now: c.now}))
+	q.Push(1)
+	c.advance(time.Second)
+
+	if v, ok := q.Pop(); !ok || v.(int) != 1 {
+		t.Errorf("Expected: 1; Got: %v", v)
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package minmaxheap
+
+import (
+	"container/heap"
+	"math/rand"
+	"strconv"
+	"testing"
+)
+
+var (
+	// benchCounts holds the number of items to add to the queue in each test.
+	benchCounts = []int{100, 10000, 100000}
+
+	// Used to store temp values, avoiding any compiler optimizations.
+	tmp  interface{}
+	tmp2 bool
+)
+
+// minHeap is a container/heap min heap, used as the baseline.
+type minHeap []interface{}
+
+func (h minHeap) Len() int            { return len(h) }
+func (h minHeap) Less(i, j int) bool  { return h[i].(int) < h[j].(int) }
+func (h minHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *minHeap) Push(v interface{}) { *h = append(*h, v) }
+func (h *minHeap) Pop() interface{} {
+	old := *h
+	v := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return v
+}
+
+// benchValues returns count random values, boxed only once.
+func benchValues(count int) []interface{} {
+	r := rand.New(rand.NewSource(1))
+	vs := make([]interface{}, count)
+	for i := range vs {
+		vs[i] = r.Int()
+	}
+	return vs
+}
+
+// BenchmarkPushPop probes pushing count random values and then popping all of them, using
+// PopMin only, alternating PopMin and PopMax, and using a container/heap min heap as the baseline.
+func BenchmarkPushPop(b *testing.B) {
+	for _, count := range benchCounts {
+		vs := benchValues(count)
+		b.Run("PopMin/"+strconv.Itoa(count), func(b *testing.B) {
+			q := New(lessInt)
+			for n := 0; n < b.N; n++ {
+				for _, v := range vs {
+					q.Push(v)
+				}
+				for q.Len() > 0 {
+					tmp, tmp2 = q.PopMin()
+				}
+			}
+		})
+		b.Run("PopMinMax/"+strconv.Itoa(count), func(b *testing.B) {
+			q := New(lessInt)
+			for n := 0; n < b.N; n++ {
+				for _, v := range vs {
+					q.Push(v)
+				}
+				for q.Len() > 0 {
+					tmp, tmp2 = q.PopMin()
+					tmp, tmp2 = q.PopMax()
+				}
+			}
+		})
+		b.Run("ContainerHeap/"+strconv.Itoa(count), func(b *testing.B) {
+			h := new(minHeap)
+			for n := 0; n < b.N; n++ {
+				for _, v := range vs {
+					heap.Push(h, v)
+				}
+				for h.Len() > 0 {
+					tmp = heap.Pop(h)
+				}
+			}
+		})
+	}
+}
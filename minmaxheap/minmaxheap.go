@@ -0,0 +1,222 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package minmaxheap implements an unbounded, dynamically growing double-ended priority queue,
+// able to retrieve and remove both its smallest and its largest value, e.g. for schedulers that
+// usually serve the most urgent work first but sometimes shed the least urgent one.
+// Internally, queue store the values in a min-max heap, as described by Atkinson, Sack, Santoro
+// and Strothotte in "Min-Max Heaps and Generalized Priority Queues": a binary heap stored in a
+// slice whose even levels (starting with the root) are ordered as a min heap and whose odd
+// levels are ordered as a max heap, so the smallest value is the root and the largest value is
+// one of its children.
+package minmaxheap
+
+// MinMaxHeap represents an unbounded, dynamically growing double-ended priority queue.
+// Values that compare equal are retrieved in no particular order.
+type MinMaxHeap struct {
+	// h holds the heap values.
+	h []interface{}
+
+	// less reports whether value a is smaller than value b.
+	less func(a, b interface{}) bool
+}
+
+// New returns an initialized queue ordering the values using less, which reports whether
+// value a is smaller than value b.
+func New(less func(a, b interface{}) bool) *MinMaxHeap {
+	return &MinMaxHeap{less: less}
+}
+
+// Init initializes or clears queue q.
+func (q *MinMaxHeap) Init() *MinMaxHeap {
+	for i := range q.h {
+		q.h[i] = nil // Avoid memory leaks
+	}
+	q.h = q.h[:0]
+	return q
+}
+
+// Len returns the number of elements of queue q.
+// The complexity is O(1).
+func (q *MinMaxHeap) Len() int { return len(q.h) }
+
+// Min returns the smallest element of queue q or nil if the queue is empty.
+// The second, bool result indicates whether a valid value was returned;
+//   if the queue is empty, false will be returned.
+// The complexity is O(1).
+func (q *MinMaxHeap) Min() (interface{}, bool) {
+	if len(q.h) == 0 {
+		return nil, false
+	}
+	return q.h[0], true
+}
+
+// Max returns the largest element of queue q or nil if the queue is empty.
+// The second, bool result indicates whether a valid value was returned;
+//   if the queue is empty, false will be returned.
+// The complexity is O(1).
+func (q *MinMaxHeap) Max() (interface{}, bool) {
+	if len(q.h) == 0 {
+		return nil, false
+	}
+	return q.h[q.max()], true
+}
+
+// Push adds a value to the queue.
+// The complexity is O(log n).
+func (q *MinMaxHeap) Push(v interface{}) {
+	q.h = append(q.h, v)
+	q.bubbleUp(len(q.h) - 1)
+}
+
+// PopMin retrieves and removes the smallest element from the queue.
+// The second, bool result indicates whether a valid value was returned;
+//   if the queue is empty, false will be returned.
+// The complexity is O(log n).
+func (q *MinMaxHeap) PopMin() (interface{}, bool) {
+	if len(q.h) == 0 {
+		return nil, false
+	}
+	return q.remove(0), true
+}
+
+// PopMax retrieves and removes the largest element from the queue.
+// The second, bool result indicates whether a valid value was returned;
+//   if the queue is empty, false will be returned.
+// The complexity is O(log n).
+func (q *MinMaxHeap) PopMax() (interface{}, bool) {
+	if len(q.h) == 0 {
+		return nil, false
+	}
+	return q.remove(q.max()), true
+}
+
+// max returns the index of the largest value of the non-empty heap.
+func (q *MinMaxHeap) max() int {
+	switch {
+	case len(q.h) == 1:
+		return 0
+	case len(q.h) == 2 || q.less(q.h[2], q.h[1]):
+		return 1
+	default:
+		return 2
+	}
+}
+
+// remove removes and returns the value at index i, replacing it by the last value.
+func (q *MinMaxHeap) remove(i int) interface{} {
+	v := q.h[i]
+	last := len(q.h) - 1
+	q.h[i] = q.h[last]
+	q.h[last] = nil // Avoid memory leaks
+	q.h = q.h[:last]
+	if i < last {
+		q.trickleDown(i)
+	}
+	return v
+}
+
+// isMinLevel reports whether index i is in a min level, i.e. an even level of the heap.
+func isMinLevel(i int) bool {
+	// The level of index i is the number of times i+1 can be halved before reaching 1.
+	level := 0
+	for n := i + 1; n > 1; n >>= 1 {
+		level++
+	}
+	return level%2 == 0
+}
+
+// bubbleUp moves the value at index i up until the heap is ordered again.
+func (q *MinMaxHeap) bubbleUp(i int) {
+	if i == 0 {
+		return
+	}
+	p := (i - 1) / 2
+	if isMinLevel(i) {
+		if q.less(q.h[p], q.h[i]) {
+			q.h[i], q.h[p] = q.h[p], q.h[i]
+			q.bubbleUpGrandparents(p, true)
+		} else {
+			q.bubbleUpGrandparents(i, false)
+		}
+	} else {
+		if q.less(q.h[i], q.h[p]) {
+			q.h[i], q.h[p] = q.h[p], q.h[i]
+			q.bubbleUpGrandparents(p, false)
+		} else {
+			q.bubbleUpGrandparents(i, true)
+		}
+	}
+}
+
+// bubbleUpGrandparents moves the value at index i up through its grandparents, which are
+// in max levels if max is true, or in min levels otherwise, until it is ordered with them.
+func (q *MinMaxHeap) bubbleUpGrandparents(i int, max bool) {
+	for i > 2 {
+		gp := ((i-1)/2 - 1) / 2
+		if !q.before(i, gp, max) {
+			return
+		}
+		q.h[i], q.h[gp] = q.h[gp], q.h[i]
+		i = gp
+	}
+}
+
+// trickleDown moves the value at index i down until the heap is ordered again.
+func (q *MinMaxHeap) trickleDown(i int) {
+	max := !isMinLevel(i)
+	for {
+		// Find the smallest (or largest, in a max level) value among the children and grandchildren.
+		m := -1
+		first := 2*i + 1
+		for j, end := first, first+2; j < end && j < len(q.h); j++ {
+			if m < 0 || q.before(j, m, max) {
+				m = j
+			}
+			for k, kend := 2*j+1, 2*j+3; k < kend && k < len(q.h); k++ {
+				if q.before(k, m, max) {
+					m = k
+				}
+			}
+		}
+		if m < 0 || !q.before(m, i, max) {
+			return
+		}
+
+		q.h[m], q.h[i] = q.h[i], q.h[m]
+		if m < first+2 {
+			// A child is in the opposite kind of level, so it can't be out of order with its children.
+			return
+		}
+		if p := (m - 1) / 2; q.before(p, m, max) {
+			q.h[m], q.h[p] = q.h[p], q.h[m]
+		}
+		i = m
+	}
+}
+
+// before reports whether the value at index i must be closer to the root than the value at
+// index j: whether it is larger, if max is true, or smaller, otherwise.
+func (q *MinMaxHeap) before(i, j int, max bool) bool {
+	if max {
+		return q.less(q.h[j], q.h[i])
+	}
+	return q.less(q.h[i], q.h[j])
+}
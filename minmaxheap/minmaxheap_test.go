@@ -0,0 +1,180 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package minmaxheap
+
+import (
+	"math/rand"
+	"runtime"
+	"sort"
+	"testing"
+
+	"github.com/christianrpetrin/queue-tests/queuetest"
+)
+
+// lessInt reports whether int a is smaller than int b.
+func lessInt(a, b interface{}) bool { return a.(int) < b.(int) }
+
+func TestMinMaxHeapNewQueueShouldReturnInitiazedInstanceOfQueue(t *testing.T) {
+	q := New(lessInt)
+
+	if q == nil {
+		t.Error("Expected: new instance of queue; Got: nil")
+	}
+}
+
+func TestMinMaxHeapWithEmptyQueueShouldReturnAsEmpty(t *testing.T) {
+	q := New(lessInt)
+	if _, ok := q.Min(); ok {
+		t.Error("Expected: false as the queue is empty; Got: true")
+	}
+	if _, ok := q.Max(); ok {
+		t.Error("Expected: false as the queue is empty; Got: true")
+	}
+	if _, ok := q.PopMin(); ok {
+		t.Error("Expected: false as the queue is empty; Got: true")
+	}
+	if _, ok := q.PopMax(); ok {
+		t.Error("Expected: false as the queue is empty; Got: true")
+	}
+}
+
+func TestMinMaxHeapPopMinShouldRetrieveAllElementsInAscendingOrder(t *testing.T) {
+	q := New(lessInt)
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 1000; i++ {
+		q.Push(r.Intn(100))
+	}
+
+	last := -1
+	for q.Len() > 0 {
+		v, ok := q.PopMin()
+		if !ok || v.(int) < last {
+			t.Fatalf("Expected: value of at least %d; Got: %v", last, v)
+		}
+		last = v.(int)
+	}
+}
+
+func TestMinMaxHeapPopMaxShouldRetrieveAllElementsInDescendingOrder(t *testing.T) {
+	q := New(lessInt)
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 1000; i++ {
+		q.Push(r.Intn(100))
+	}
+
+	last := 100
+	for q.Len() > 0 {
+		v, ok := q.PopMax()
+		if !ok || v.(int) > last {
+			t.Fatalf("Expected: value of at most %d; Got: %v", last, v)
+		}
+		last = v.(int)
+	}
+}
+
+func TestMinMaxHeapWithRandomOperationsShouldMatchSortedModel(t *testing.T) {
+	q := New(lessInt)
+	r := rand.New(rand.NewSource(1))
+	var model []int
+	for i := 0; i < 100000; i++ {
+		switch r.Intn(5) {
+		case 0, 1:
+			v := r.Intn(1000)
+			q.Push(v)
+			model = append(model, v)
+			sort.Ints(model)
+		case 2:
+			v, ok := q.PopMin()
+			if len(model) == 0 {
+				if ok {
+					t.Fatalf("operation %d: Expected: empty queue; Got: %v", i, v)
+				}
+				continue
+			}
+			if !ok || v.(int) != model[0] {
+				t.Fatalf("operation %d: Expected: min %d; Got: %v", i, model[0], v)
+			}
+			model = model[1:]
+		case 3:
+			v, ok := q.PopMax()
+			if len(model) == 0 {
+				if ok {
+					t.Fatalf("operation %d: Expected: empty queue; Got: %v", i, v)
+				}
+				continue
+			}
+			if !ok || v.(int) != model[len(model)-1] {
+				t.Fatalf("operation %d: Expected: max %d; Got: %v", i, model[len(model)-1], v)
+			}
+			model = model[:len(model)-1]
+		case 4:
+			if len(model) == 0 {
+				continue
+			}
+			if v, ok := q.Min(); !ok || v.(int) != model[0] {
+				t.Fatalf("operation %d: Expected: min %d; Got: %v", i, model[0], v)
+			}
+			if v, ok := q.Max(); !ok || v.(int) != model[len(model)-1] {
+				t.Fatalf("operation %d: Expected: max %d; Got: %v", i, model[len(model)-1], v)
+			}
+		}
+		if q.Len() != len(model) {
+			t.Fatalf("operation %d: Expected: length %d; Got: %d", i, len(model), q.Len())
+		}
+	}
+}
+
+func TestMinMaxHeapInitShouldClearQueue(t *testing.T) {
+	q := New(lessInt)
+	for i := 0; i < 10; i++ {
+		q.Push(i)
+	}
+	q.Init()
+	if l := q.Len(); l != 0 {
+		t.Errorf("Expected: 0 as the queue was cleared; Got: %d", l)
+	}
+
+	q.Push(1)
+	if v, ok := q.PopMax(); !ok || v.(int) != 1 {
+		t.Errorf("Expected: 1; Got: %v", v)
+	}
+}
+
+func TestMinMaxHeapPopShouldReleasePoppedValues(t *testing.T) {
+	q := New(func(a, b interface{}) bool { return a.(*queuetest.LeakTestValue).N < b.(*queuetest.LeakTestValue).N })
+	var f queuetest.Finalizers
+	for i := 0; i < queuetest.LeakTestCount; i++ {
+		q.Push(f.NewValue(i % 10))
+	}
+	for i := 0; i < queuetest.LeakTestCount/2; i++ {
+		if _, ok := q.PopMin(); !ok {
+			t.Fatalf("Expected: value %d; Got: empty queue", i)
+		}
+		if _, ok := q.PopMax(); !ok {
+			t.Fatalf("Expected: value %d; Got: empty queue", i)
+		}
+	}
+
+	if r := f.Wait(queuetest.LeakTestCount); r != queuetest.LeakTestCount {
+		t.Errorf("Expected: %d released values; Got: %d", queuetest.LeakTestCount, r)
+	}
+	runtime.KeepAlive(q)
+}
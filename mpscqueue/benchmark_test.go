@@ -0,0 +1,115 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package mpscqueue
+
+import (
+	"runtime"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/christianrpetrin/queue-tests/lockfreequeue"
+	"github.com/christianrpetrin/queue-tests/safequeue"
+)
+
+var (
+	// mailboxProducers holds the number of producer goroutines probed by the mailbox benchmark tests.
+	mailboxProducers = []int{1, 4, 16}
+
+	// Used to store temp values, avoiding any compiler optimizations.
+	tmp interface{}
+)
+
+// message is a message sent to an actor mailbox in the benchmark tests.
+type message struct {
+	Node
+
+	// v holds the message payload.
+	v int
+}
+
+// BenchmarkMailbox probes the actor mailbox use case, where multiple producers
+// send newly allocated messages to a single consumer. The intrusive queue links
+// the messages themselves, while the other queues allocate a node (or slot) to
+// hold each message.
+func BenchmarkMailbox(b *testing.B) {
+	for _, producers := range mailboxProducers {
+		producers := producers
+		b.Run("Intrusive/"+strconv.Itoa(producers), func(b *testing.B) {
+			q := New()
+			benchmarkMailbox(b, producers, func(m *message) { q.Push(m) }, func() bool {
+				e, ok := q.Pop()
+				tmp = e
+				return ok
+			})
+		})
+		b.Run("LockFree/"+strconv.Itoa(producers), func(b *testing.B) {
+			q := lockfreequeue.New()
+			benchmarkMailbox(b, producers, func(m *message) { q.Push(m) }, func() bool {
+				v, ok := q.Pop()
+				tmp = v
+				return ok
+			})
+		})
+		b.Run("Mutex/"+strconv.Itoa(producers), func(b *testing.B) {
+			q := safequeue.New()
+			benchmarkMailbox(b, producers, func(m *message) { q.Push(m) }, func() bool {
+				v, ok := q.Pop()
+				tmp = v
+				return ok
+			})
+		})
+		b.Run("Channel/"+strconv.Itoa(producers), func(b *testing.B) {
+			c := make(chan *message, 1024)
+			benchmarkMailbox(b, producers, func(m *message) { c <- m }, func() bool {
+				tmp = <-c
+				return true
+			})
+		})
+	}
+}
+
+// benchmarkMailbox sends b.N messages from producers goroutines using send,
+// while the benchmark goroutine receives them using receive.
+func benchmarkMailbox(b *testing.B, producers int, send func(m *message), receive func() bool) {
+	b.ReportAllocs()
+	perProducer := b.N/producers + 1
+
+	var wg sync.WaitGroup
+	for p := 0; p < producers; p++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := 0; n < perProducer; n++ {
+				send(&message{v: n})
+			}
+		}()
+	}
+
+	for received := 0; received < perProducer*producers; {
+		if receive() {
+			received++
+		} else {
+			runtime.Gosched()
+		}
+	}
+	wg.Wait()
+}
@@ -0,0 +1,169 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package mpscqueue implements an unbounded, intrusive, multi-producer single-consumer FIFO queue.
+// Internally, queue links the user values directly, using a Node embedded in each value, following
+// the design described by Dmitry Vyukov in "Intrusive MPSC node-based queue".
+// As the values themselves are linked, pushing and popping a value never allocates.
+// Producers only perform a single atomic swap to push a value, and the consumer doesn't perform any
+// atomic read-modify-write operation to pop a value.
+//
+// To be pushed to the queue, values must embed a Node:
+//
+//	type message struct {
+//		mpscqueue.Node
+//		payload string
+//	}
+//
+//	q := mpscqueue.New()
+//	q.Push(&message{payload: "hello"})
+//	e, _ := q.Pop()
+//	m := e.(*message)
+package mpscqueue
+
+import (
+	"sync/atomic"
+	"unsafe"
+)
+
+// Element is a value that can be pushed to the queue.
+// Any pointer to a struct type embedding a Node implements Element.
+type Element interface {
+	// MPSCNode returns the node used to link the element in the queue.
+	MPSCNode() *Node
+}
+
+// Node links an element in the queue.
+// A Node must be embedded in the values pushed to the queue.
+// A value must not be pushed again while it is still in a queue.
+type Node struct {
+	// next points to the next node in the linked list.
+	next unsafe.Pointer
+
+	// e holds the element the node is embedded in while the element is in the queue.
+	e Element
+}
+
+// MPSCNode returns n.
+func (n *Node) MPSCNode() *Node { return n }
+
+// MPSCQueue represents an unbounded, intrusive, multi-producer single-consumer FIFO queue.
+// Push is safe for concurrent use by multiple goroutines, while Pop must only be called
+// by a single goroutine at a time.
+// The zero value for queue is not ready to use; use New to create a queue.
+type MPSCQueue struct {
+	// head points to the most recently pushed node. It is updated by the producers.
+	head unsafe.Pointer
+
+	// _ keeps tail in a different cache line than head.
+	_ cacheLinePad
+
+	// tail points to the next node to pop. It is only accessed by the consumer.
+	tail *Node
+
+	// stub is the node that keeps the linked list non-empty when all elements were popped.
+	stub Node
+}
+
+// cacheLineSize holds the assumed size of a CPU cache line.
+// It is 64 bytes on most amd64 and arm64 CPUs.
+const cacheLineSize = 64
+
+// cacheLinePad separates the producers and consumer fields, so updating one
+// doesn't invalidate the cache line holding the other (i.e. false sharing).
+type cacheLinePad [cacheLineSize]byte
+
+// New returns an initialized queue.
+func New() *MPSCQueue {
+	return new(MPSCQueue).Init()
+}
+
+// Init initializes or clears queue q.
+// Init is not safe for concurrent use with any other queue q method.
+func (q *MPSCQueue) Init() *MPSCQueue {
+	q.stub = Node{}
+	q.tail = &q.stub
+	atomic.StorePointer(&q.head, unsafe.Pointer(&q.stub))
+	return q
+}
+
+// Push adds element e to the queue.
+// Push is safe for concurrent use by multiple goroutines.
+// The complexity is O(1).
+func (q *MPSCQueue) Push(e Element) {
+	n := e.MPSCNode()
+	n.e = e
+	q.push(n)
+}
+
+// Pop retrieves and removes the next element from the queue.
+// The second, bool result indicates whether a valid element was returned;
+//   if the queue is empty, false will be returned.
+// Pop may also return false while a concurrent push of the next element is in
+// progress, in which case the element becomes available shortly afterwards.
+// Pop must only be called by a single goroutine at a time.
+// The complexity is O(1).
+func (q *MPSCQueue) Pop() (Element, bool) {
+	tail := q.tail
+	next := (*Node)(atomic.LoadPointer(&tail.next))
+	if tail == &q.stub {
+		if next == nil {
+			return nil, false
+		}
+		q.tail = next
+		tail = next
+		next = (*Node)(atomic.LoadPointer(&tail.next))
+	}
+
+	if next == nil {
+		if tail != (*Node)(atomic.LoadPointer(&q.head)) {
+			// A producer swapped the head but didn't link it yet.
+			return nil, false
+		}
+
+		// Tail is the last node; push the stub so tail can be unlinked.
+		q.push(&q.stub)
+		next = (*Node)(atomic.LoadPointer(&tail.next))
+		if next == nil {
+			// A producer swapped the head before the stub but didn't link it yet.
+			return nil, false
+		}
+	}
+
+	q.tail = next
+	e := tail.e
+	tail.e = nil // Avoid memory leaks
+	atomic.StorePointer(&tail.next, nil)
+	return e, true
+}
+
+// Empty reports whether queue q has no elements.
+// As elements are pushed concurrently, the result may be stale.
+// Empty must only be called by the consumer goroutine.
+func (q *MPSCQueue) Empty() bool {
+	return q.tail == &q.stub && atomic.LoadPointer(&q.stub.next) == nil
+}
+
+// push links node n to the end of the linked list.
+func (q *MPSCQueue) push(n *Node) {
+	atomic.StorePointer(&n.next, nil)
+	prev := (*Node)(atomic.SwapPointer(&q.head, unsafe.Pointer(n)))
+	atomic.StorePointer(&prev.next, unsafe.Pointer(n))
+}
@@ -0,0 +1,172 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package mpscqueue
+
+import (
+	"runtime"
+	"sync"
+	"testing"
+	"unsafe"
+)
+
+const (
+	// concurrentCount holds the number of values pushed by each goroutine in the concurrent tests.
+	concurrentCount = 10000
+
+	// producers holds the number of producer goroutines in the concurrent tests.
+	producers = 4
+)
+
+// testElement is an element pushed to the queue by the tests.
+type testElement struct {
+	Node
+
+	// v holds the element value.
+	v int
+}
+
+func TestMPSCQueueNewQueueShouldReturnInitiazedInstanceOfQueue(t *testing.T) {
+	q := New()
+
+	if q == nil {
+		t.Error("Expected: new instance of queue; Got: nil")
+	}
+	if !q.Empty() {
+		t.Error("Expected: empty queue; Got: non-empty")
+	}
+}
+
+func TestMPSCQueuePushPopShouldRetrieveAllElementsInOrder(t *testing.T) {
+	tests := map[string]struct {
+		putCount []int
+		getCount []int
+	}{
+		"Test 1 item":     {putCount: []int{1}, getCount: []int{1}},
+		"Test 1000 items": {putCount: []int{1000}, getCount: []int{1000}},
+		"Test sequence 1": {putCount: []int{1, 2, 100, 101}, getCount: []int{1, 2, 100, 101}},
+		"Test sequence 2": {putCount: []int{10, 1}, getCount: []int{1, 10}},
+		"Test sequence 3": {putCount: []int{101, 101}, getCount: []int{100, 102}},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			q := New()
+			lastPut := 0
+			lastGet := 0
+			for count := 0; count < len(test.getCount); count++ {
+				for i := 1; i <= test.putCount[count]; i++ {
+					lastPut++
+					q.Push(&testElement{v: lastPut})
+				}
+
+				for i := 1; i <= test.getCount[count]; i++ {
+					lastGet++
+					e, ok := q.Pop()
+					if !ok || e.(*testElement).v != lastGet {
+						t.Errorf("Expected: %d; Got: %v", lastGet, e)
+					}
+				}
+			}
+
+			if e, ok := q.Pop(); ok || e != nil {
+				t.Errorf("Expected: nil as the queue should be empty; Got: %v", e)
+			}
+			if !q.Empty() {
+				t.Error("Expected: empty queue; Got: non-empty")
+			}
+		})
+	}
+}
+
+func TestMPSCQueuePopShouldAllowPushingElementAgain(t *testing.T) {
+	q := New()
+	e1 := &testElement{v: 1}
+	e2 := &testElement{v: 2}
+
+	for i := 0; i < 3; i++ {
+		q.Push(e1)
+		q.Push(e2)
+		if e, ok := q.Pop(); !ok || e != e1 {
+			t.Errorf("Expected: %v; Got: %v", e1, e)
+		}
+		q.Push(e1)
+		if e, ok := q.Pop(); !ok || e != e2 {
+			t.Errorf("Expected: %v; Got: %v", e2, e)
+		}
+		if e, ok := q.Pop(); !ok || e != e1 {
+			t.Errorf("Expected: %v; Got: %v", e1, e)
+		}
+	}
+	if _, ok := q.Pop(); ok {
+		t.Error("Expected: empty queue; Got: non-empty")
+	}
+	if e1.e != nil || e2.e != nil {
+		t.Error("Expected: popped nodes not referencing their elements; Got: referencing")
+	}
+}
+
+func TestMPSCQueueConcurrentPushShouldRetrieveAllElementsInProducerOrder(t *testing.T) {
+	q := New()
+	var wg sync.WaitGroup
+	for p := 0; p < producers; p++ {
+		wg.Add(1)
+		go func(p int) {
+			defer wg.Done()
+			for i := 0; i < concurrentCount; i++ {
+				q.Push(&testElement{v: p*concurrentCount + i})
+			}
+		}(p)
+	}
+
+	seen := make([]bool, producers*concurrentCount)
+	last := []int{-1, -1, -1, -1}
+	for popped := 0; popped < producers*concurrentCount; {
+		e, ok := q.Pop()
+		if !ok {
+			runtime.Gosched()
+			continue
+		}
+		v := e.(*testElement).v
+		if seen[v] {
+			t.Errorf("Expected: %d popped once; Got: popped again", v)
+		}
+		seen[v] = true
+		if p := v / concurrentCount; v <= last[p] {
+			t.Errorf("Expected: values of producer %d in order; Got: %d after %d", p, v, last[p])
+		} else {
+			last[p] = v
+		}
+		popped++
+	}
+	wg.Wait()
+
+	if !q.Empty() {
+		t.Error("Expected: empty queue; Got: non-empty")
+	}
+}
+
+func TestMPSCQueueProducerAndConsumerFieldsShouldBeInDifferentCacheLines(t *testing.T) {
+	var q MPSCQueue
+	if d := unsafe.Offsetof(q.tail) - unsafe.Offsetof(q.head); d < cacheLineSize {
+		t.Errorf("Expected: at least %d bytes between head and tail; Got: %d", cacheLineSize, d)
+	}
+}
@@ -0,0 +1,191 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package mux implements a fan-in multiplexer that moves values from multiple source
+// queues into a single output queue, selecting the source to consume from next using
+// a configurable policy.
+// Any queue in this repo can be used as a source or as the output. When the sources
+// or the output are shared with other goroutines, they must be safe for concurrent
+// use (e.g. safequeue.SafeQueue or lockfreequeue.LockFreeQueue).
+package mux
+
+import (
+	"context"
+	"time"
+)
+
+// Policy selects the source queue the next value is consumed from.
+type Policy int
+
+const (
+	// RoundRobin consumes one value from each non-empty source in turn.
+	RoundRobin Policy = iota
+
+	// Priority always consumes from the first non-empty source, in the order
+	// the sources were provided (i.e. the first source has the highest priority).
+	Priority
+
+	// LongestQueueFirst always consumes from the source with the most values.
+	// Ties are broken in favor of the first source in the order the sources were provided.
+	LongestQueueFirst
+)
+
+// Source is a queue values are consumed from.
+type Source interface {
+	// Len returns the number of values in the queue.
+	Len() int
+
+	// Pop retrieves and removes the next value from the queue.
+	Pop() (interface{}, bool)
+}
+
+// Sink is a queue values are produced into.
+type Sink interface {
+	// Push adds a value to the queue.
+	Push(v interface{})
+}
+
+// Mux represents a fan-in multiplexer over multiple source queues.
+// A Mux is not safe for concurrent use.
+type Mux struct {
+	// sources holds the source queues.
+	sources []Source
+
+	// out holds the output queue.
+	out Sink
+
+	// policy holds the source selection policy.
+	policy Policy
+
+	// next holds the index of the next source to consider for the RoundRobin policy.
+	next int
+
+	// lens holds the lengths of the sources sampled by the LongestQueueFirst policy, or -1
+	// for the sources already tried. It is reused across steps to avoid allocations.
+	lens []int
+}
+
+// New returns a multiplexer moving values from sources into out according to policy.
+func New(out Sink, policy Policy, sources ...Source) *Mux {
+	return &Mux{
+		sources: sources,
+		out:     out,
+		policy:  policy,
+	}
+}
+
+// Step moves a single value from the source selected by the policy into the output queue.
+// It returns false if all sources are empty, i.e. if popping from each of them failed.
+// The complexity is O(n), where n is the number of sources, or O(n^2) with LongestQueueFirst
+// if popping from non-empty sources fails.
+func (m *Mux) Step() bool {
+	switch m.policy {
+	case Priority:
+		for _, s := range m.sources {
+			if m.move(s) {
+				return true
+			}
+		}
+	case LongestQueueFirst:
+		// A source may be emptied concurrently after its length was sampled, or count values
+		// it can't pop yet (e.g. timerwheel.TimerWheel), so the sources are tried once each,
+		// in descending length order, until a value is moved.
+		m.lens = m.lens[:0]
+		for _, s := range m.sources {
+			m.lens = append(m.lens, s.Len())
+		}
+		for {
+			longest, max := -1, 0
+			for i, l := range m.lens {
+				if l > max {
+					longest, max = i, l
+				}
+			}
+			if longest < 0 {
+				return false
+			}
+			if m.move(m.sources[longest]) {
+				return true
+			}
+			m.lens[longest] = -1
+		}
+	default:
+		for i := 0; i < len(m.sources); i++ {
+			s := m.sources[m.next]
+			m.next = (m.next + 1) % len(m.sources)
+			if m.move(s) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Pump moves up to n values from the sources into the output queue, returning the
+// number of moved values. Fewer than n values are moved only if all sources are empty.
+func (m *Mux) Pump(n int) int {
+	moved := 0
+	for moved < n && m.Step() {
+		moved++
+	}
+	return moved
+}
+
+// Run continuously moves values from the sources into the output queue until ctx is done,
+// returning ctx.Err(). As the queues don't support waiting for values, Run sleeps for the
+// idle duration whenever all sources are empty.
+func (m *Mux) Run(ctx context.Context, idle time.Duration) error {
+	t := time.NewTimer(idle)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		if !m.Step() {
+			// Stop and drain the timer before resetting it, as it may have fired.
+			if !t.Stop() {
+				select {
+				case <-t.C:
+				default:
+				}
+			}
+			t.Reset(idle)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-t.C:
+			}
+		}
+	}
+}
+
+// move moves a single value from source s into the output queue.
+// It returns false if s is empty.
+func (m *Mux) move(s Source) bool {
+	v, ok := s.Pop()
+	if !ok {
+		return false
+	}
+	m.out.Push(v)
+	return true
+}
@@ -0,0 +1,179 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package mux
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/christianrpetrin/queue-tests/queueimpl3"
+	"github.com/christianrpetrin/queue-tests/safequeue"
+)
+
+// newSources returns len(counts) queues, where the i-th queue holds counts[i]
+// values in the form i*100+j, j being the position of the value in the queue.
+func newSources(counts ...int) []Source {
+	sources := make([]Source, len(counts))
+	for i, count := range counts {
+		q := queueimpl3.New()
+		for j := 0; j < count; j++ {
+			q.Push(i*100 + j)
+		}
+		sources[i] = q
+	}
+	return sources
+}
+
+// popAll pops all values from queue q.
+func popAll(q *queueimpl3.Queueimpl3) []int {
+	var vs []int
+	for v, ok := q.Pop(); ok; v, ok = q.Pop() {
+		vs = append(vs, v.(int))
+	}
+	return vs
+}
+
+func TestMuxStepShouldMoveValuesAccordingToPolicy(t *testing.T) {
+	tests := map[string]struct {
+		policy   Policy
+		counts   []int
+		expected []int
+	}{
+		"Test round robin": {
+			policy:   RoundRobin,
+			counts:   []int{3, 1, 2},
+			expected: []int{0, 100, 200, 1, 201, 2},
+		},
+		"Test priority": {
+			policy:   Priority,
+			counts:   []int{2, 1, 2},
+			expected: []int{0, 1, 100, 200, 201},
+		},
+		"Test longest queue first": {
+			policy:   LongestQueueFirst,
+			counts:   []int{1, 3, 2},
+			expected: []int{100, 101, 200, 0, 102, 201},
+		},
+		"Test no values": {
+			policy: RoundRobin,
+			counts: []int{0, 0},
+		},
+		"Test no sources": {
+			policy: LongestQueueFirst,
+		},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			out := queueimpl3.New()
+			m := New(out, test.policy, newSources(test.counts...)...)
+
+			for range test.expected {
+				if !m.Step() {
+					t.Fatal("Expected: value moved; Got: no value moved")
+				}
+			}
+			if m.Step() {
+				t.Error("Expected: no value moved as all sources are empty; Got: value moved")
+			}
+
+			got := popAll(out)
+			if len(got) != len(test.expected) {
+				t.Fatalf("Expected: %v; Got: %v", test.expected, got)
+			}
+			for i := range got {
+				if got[i] != test.expected[i] {
+					t.Fatalf("Expected: %v; Got: %v", test.expected, got)
+				}
+			}
+		})
+	}
+}
+
+// pendingSource is a source whose values are never ready, e.g. a timer wheel whose timers
+// are not due yet: its length counts the values, but popping fails.
+type pendingSource int
+
+func (s pendingSource) Len() int { return int(s) }
+
+func (s pendingSource) Pop() (interface{}, bool) { return nil, false }
+
+func TestMuxLongestQueueFirstStepShouldSkipSourcesFailingToPop(t *testing.T) {
+	src := newSources(1)
+	out := queueimpl3.New()
+	m := New(out, LongestQueueFirst, pendingSource(5), src[0], pendingSource(3))
+
+	if !m.Step() {
+		t.Error("Expected: true; Got: false")
+	}
+	if m.Step() {
+		t.Error("Expected: false as no source can be popped; Got: true")
+	}
+	if vs := popAll(out); len(vs) != 1 || vs[0] != 0 {
+		t.Errorf("Expected: %v; Got: %v", []int{0}, vs)
+	}
+}
+
+func TestMuxPumpShouldMoveUpToNValues(t *testing.T) {
+	out := queueimpl3.New()
+	m := New(out, RoundRobin, newSources(2, 2)...)
+
+	if moved := m.Pump(3); moved != 3 {
+		t.Errorf("Expected: %d; Got: %d", 3, moved)
+	}
+	if moved := m.Pump(3); moved != 1 {
+		t.Errorf("Expected: %d; Got: %d", 1, moved)
+	}
+	if out.Len() != 4 {
+		t.Errorf("Expected: %d; Got: %d", 4, out.Len())
+	}
+}
+
+func TestMuxRunShouldMoveValuesUntilContextIsDone(t *testing.T) {
+	src := safequeue.New()
+	out := safequeue.New()
+	m := New(out, RoundRobin, src)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- m.Run(ctx, time.Millisecond)
+	}()
+
+	for i := 0; i < 100; i++ {
+		src.Push(i)
+	}
+	for deadline := time.Now().Add(10 * time.Second); out.Len() < 100 && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+
+	if err := <-done; err != context.Canceled {
+		t.Errorf("Expected: %v; Got: %v", context.Canceled, err)
+	}
+	for i := 0; i < 100; i++ {
+		if v, ok := out.Pop(); !ok || v.(int) != i {
+			t.Errorf("Expected: %d; Got: %d", i, v)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package orderedqueue implements an unbounded, dynamically growing queue keeping its values
+// sorted on insert, so the smallest value can be retrieved and removed in O(1).
+// It fills the gap between a plain FIFO queue and a heap for mostly ordered arrival streams,
+// e.g. events with timestamps that are only slightly out of order: values not smaller than
+// the largest one are appended in O(1), and the other ones are inserted close to the end.
+// Internally, queue store the values in sorted, fixed sized segments, held in a slice sorted
+// by their values. Push finds the segment to insert a value into using a binary search over
+// the last value of each segment, and then its position within the segment using another
+// binary search, so only the values of a single segment are moved; full segments are split
+// in two. Popped values are removed from the first segment, as in queueimpl3.
+// Values that compare equal are retrieved in the order they were pushed, so with a less
+// function that always returns false the queue is a FIFO queue.
+package orderedqueue
+
+import (
+	"sort"
+)
+
+const (
+	// segmentSize holds the maximum number of values of each segment.
+	segmentSize = 128
+)
+
+// OrderedQueue represents an unbounded, dynamically growing queue keeping its values sorted.
+type OrderedQueue struct {
+	// segs holds the segments, sorted by their values.
+	// It always holds at least one segment, and only the first one can be empty,
+	// if the queue is empty.
+	segs []*segment
+
+	// len holds the current queue length.
+	len int
+
+	// less reports whether value a is smaller than value b.
+	less func(a, b interface{}) bool
+}
+
+// segment represents a queue segment.
+type segment struct {
+	// v holds the segment values; the values from pos to len(v) are sorted.
+	v []interface{}
+
+	// pos holds the index of the first value of the segment, as the values
+	// before it were popped already.
+	pos int
+}
+
+// New returns an initialized queue ordering the values using less, which reports whether
+// value a is smaller than value b.
+func New(less func(a, b interface{}) bool) *OrderedQueue {
+	q := &OrderedQueue{less: less}
+	return q.Init()
+}
+
+// Init initializes or clears queue q.
+func (q *OrderedQueue) Init() *OrderedQueue {
+	for i := range q.segs {
+		q.segs[i] = nil // Avoid memory leaks
+	}
+	q.segs = append(q.segs[:0], newSegment())
+	q.len = 0
+	return q
+}
+
+// Len returns the number of elements of queue q.
+// The complexity is O(1).
+func (q *OrderedQueue) Len() int { return q.len }
+
+// Min returns the smallest element of queue q or nil if the queue is empty.
+// The second, bool result indicates whether a valid value was returned;
+//   if the queue is empty, false will be returned.
+// The complexity is O(1).
+func (q *OrderedQueue) Min() (interface{}, bool) {
+	if q.len == 0 {
+		return nil, false
+	}
+	s := q.segs[0]
+	return s.v[s.pos], true
+}
+
+// Push adds a value to the queue, after the values that compare equal to it.
+// The complexity is O(1) if v is not smaller than the largest element; otherwise, it is
+// O(log n) comparisons plus moving up to a segment of values and, if the segment is full,
+// moving the segments after it.
+func (q *OrderedQueue) Push(v interface{}) {
+	i := len(q.segs) - 1
+	if q.len > 0 && q.less(v, q.segs[i].last()) {
+		// Find the first segment whose last value is larger than v.
+		i = sort.Search(i, func(i int) bool { return q.less(v, q.segs[i].last()) })
+	}
+
+	s := q.segs[i]
+	j := len(s.v)
+	if i < len(q.segs)-1 || (len(s.v) > s.pos && q.less(v, s.last())) {
+		// Find the first value of the segment larger than v.
+		live := s.v[s.pos:]
+		j = s.pos + sort.Search(len(live), func(j int) bool { return q.less(v, live[j]) })
+	}
+
+	if len(s.v) == cap(s.v) {
+		if s.pos > 0 {
+			j -= s.pos
+			s.compact()
+		} else if j == len(s.v) && i == len(q.segs)-1 {
+			// Ordered values are appended to a new segment, so segments are kept full.
+			s = newSegment()
+			q.segs = append(q.segs, s)
+			j = 0
+		} else {
+			// Split the last segment at the insert position, so the values arriving next
+			// fill the new segment; split the other segments in half.
+			at := len(s.v) / 2
+			if i == len(q.segs)-1 {
+				at = j
+			}
+			r := s.split(at)
+			q.segs = append(q.segs, nil)
+			copy(q.segs[i+2:], q.segs[i+1:])
+			q.segs[i+1] = r
+			if j > len(s.v) {
+				j -= len(s.v)
+				s = r
+			}
+		}
+	}
+
+	s.v = append(s.v, nil)
+	copy(s.v[j+1:], s.v[j:])
+	s.v[j] = v
+	q.len++
+}
+
+// PopMin retrieves and removes the smallest element from the queue.
+// The second, bool result indicates whether a valid value was returned;
+//   if the queue is empty, false will be returned.
+// The complexity is O(1), or O(n/k) when the first segment is emptied, where k is
+// the segment size.
+func (q *OrderedQueue) PopMin() (interface{}, bool) {
+	if q.len == 0 {
+		return nil, false
+	}
+
+	s := q.segs[0]
+	v := s.v[s.pos]
+	s.v[s.pos] = nil // Avoid memory leaks
+	s.pos++
+	q.len--
+
+	if s.pos == len(s.v) {
+		if len(q.segs) == 1 {
+			// The first segment is also the last one, so reuse it.
+			s.v = s.v[:0]
+			s.pos = 0
+		} else {
+			copy(q.segs, q.segs[1:])
+			q.segs[len(q.segs)-1] = nil // Avoid memory leaks
+			q.segs = q.segs[:len(q.segs)-1]
+		}
+	}
+	return v, true
+}
+
+// newSegment returns an empty segment.
+func newSegment() *segment {
+	return &segment{v: make([]interface{}, 0, segmentSize)}
+}
+
+// last returns the last value of non-empty segment s.
+func (s *segment) last() interface{} { return s.v[len(s.v)-1] }
+
+// compact moves the values of segment s to the beginning of its slice.
+func (s *segment) compact() {
+	n := copy(s.v, s.v[s.pos:])
+	for i := n; i < len(s.v); i++ {
+		s.v[i] = nil // Avoid memory leaks
+	}
+	s.v = s.v[:n]
+	s.pos = 0
+}
+
+// split moves the values of full segment s, which has no popped values, from index at
+// on to a new segment, which is returned.
+func (s *segment) split(at int) *segment {
+	r := newSegment()
+	r.v = append(r.v, s.v[at:]...)
+	for i := at; i < len(s.v); i++ {
+		s.v[i] = nil // Avoid memory leaks
+	}
+	s.v = s.v[:at]
+	return r
+}
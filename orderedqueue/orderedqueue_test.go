@@ -0,0 +1,200 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package orderedqueue
+
+import (
+	"math/rand"
+	"runtime"
+	"sort"
+	"testing"
+
+	"github.com/christianrpetrin/queue-tests/queuetest"
+)
+
+// item is a value pushed by the stability tests.
+type item struct {
+	// k holds the item key the queue is sorted by.
+	k int
+
+	// seq holds the order the item was pushed in.
+	seq int
+}
+
+// lessInt reports whether int a is smaller than int b.
+func lessInt(a, b interface{}) bool { return a.(int) < b.(int) }
+
+// lessItem reports whether the key of item a is smaller than the key of item b.
+func lessItem(a, b interface{}) bool { return a.(item).k < b.(item).k }
+
+func TestOrderedQueueNewQueueShouldReturnInitiazedInstanceOfQueue(t *testing.T) {
+	q := New(lessInt)
+
+	if q == nil {
+		t.Error("Expected: new instance of queue; Got: nil")
+	}
+}
+
+func TestOrderedQueueWithEmptyQueueShouldReturnAsEmpty(t *testing.T) {
+	q := New(lessInt)
+	if _, ok := q.Min(); ok {
+		t.Error("Expected: false as the queue is empty; Got: true")
+	}
+	if _, ok := q.PopMin(); ok {
+		t.Error("Expected: false as the queue is empty; Got: true")
+	}
+	if l := q.Len(); l != 0 {
+		t.Errorf("Expected: 0 as the queue is empty; Got: %d", l)
+	}
+}
+
+func TestOrderedQueuePopMinShouldRetrieveAllElementsInAscendingOrder(t *testing.T) {
+	q := New(lessInt)
+	r := rand.New(rand.NewSource(1))
+	count := 10 * segmentSize
+	for i := 0; i < count; i++ {
+		q.Push(r.Intn(count))
+	}
+
+	last := -1
+	for i := 0; i < count; i++ {
+		if m, ok := q.Min(); !ok || m.(int) < last {
+			t.Fatalf("Expected: min of at least %d; Got: %v", last, m)
+		}
+		v, ok := q.PopMin()
+		if !ok || v.(int) < last {
+			t.Fatalf("Expected: value of at least %d; Got: %v", last, v)
+		}
+		last = v.(int)
+	}
+	if q.Len() != 0 {
+		t.Errorf("Expected: %d; Got: %d", 0, q.Len())
+	}
+}
+
+func TestOrderedQueueWithEqualValuesShouldRetrieveThemInPushOrder(t *testing.T) {
+	q := New(func(a, b interface{}) bool { return false })
+	count := 10 * segmentSize
+	for i := 0; i < count; i++ {
+		q.Push(i)
+	}
+	for i := 0; i < count; i++ {
+		if v, ok := q.PopMin(); !ok || v.(int) != i {
+			t.Fatalf("Expected: %d; Got: %v", i, v)
+		}
+	}
+}
+
+func TestOrderedQueueWithMostlyOrderedValuesShouldKeepSegmentsFull(t *testing.T) {
+	q := New(lessInt)
+	r := rand.New(rand.NewSource(1))
+	count := 100 * segmentSize
+	for i := 0; i < count; i++ {
+		q.Push(i - r.Intn(10))
+	}
+
+	// Only the values arriving out of order split the segments, so most segments stay full.
+	if max := 2 * count / segmentSize; len(q.segs) > max {
+		t.Errorf("Expected: at most %d segments; Got: %d", max, len(q.segs))
+	}
+	last := -10
+	for q.Len() > 0 {
+		v, _ := q.PopMin()
+		if v.(int) < last {
+			t.Fatalf("Expected: value of at least %d; Got: %v", last, v)
+		}
+		last = v.(int)
+	}
+}
+
+func TestOrderedQueueWithRandomOperationsShouldMatchStableSortedModel(t *testing.T) {
+	q := New(lessItem)
+	r := rand.New(rand.NewSource(1))
+	var model []item
+	for i := 0; i < 100000; i++ {
+		switch r.Intn(4) {
+		case 0, 1:
+			v := item{k: r.Intn(100), seq: i}
+			q.Push(v)
+			j := sort.Search(len(model), func(j int) bool { return v.k < model[j].k })
+			model = append(model, item{})
+			copy(model[j+1:], model[j:])
+			model[j] = v
+		case 2:
+			v, ok := q.PopMin()
+			if len(model) == 0 {
+				if ok {
+					t.Fatalf("operation %d: Expected: empty queue; Got: %v", i, v)
+				}
+				continue
+			}
+			if !ok || v.(item) != model[0] {
+				t.Fatalf("operation %d: Expected: min %v; Got: %v", i, model[0], v)
+			}
+			model = model[1:]
+		case 3:
+			if len(model) == 0 {
+				continue
+			}
+			if v, ok := q.Min(); !ok || v.(item) != model[0] {
+				t.Fatalf("operation %d: Expected: min %v; Got: %v", i, model[0], v)
+			}
+		}
+		if q.Len() != len(model) {
+			t.Fatalf("operation %d: Expected: length %d; Got: %d", i, len(model), q.Len())
+		}
+	}
+}
+
+func TestOrderedQueueInitShouldClearQueue(t *testing.T) {
+	q := New(lessInt)
+	for i := 0; i < 10*segmentSize; i++ {
+		q.Push(i)
+	}
+	q.Init()
+	if l := q.Len(); l != 0 {
+		t.Errorf("Expected: 0 as the queue was cleared; Got: %d", l)
+	}
+
+	q.Push(1)
+	if v, ok := q.PopMin(); !ok || v.(int) != 1 {
+		t.Errorf("Expected: 1; Got: %v", v)
+	}
+}
+
+func TestOrderedQueuePopShouldReleasePoppedValues(t *testing.T) {
+	q := New(func(a, b interface{}) bool { return a.(*queuetest.LeakTestValue).N < b.(*queuetest.LeakTestValue).N })
+	r := rand.New(rand.NewSource(1))
+	var f queuetest.Finalizers
+	for i := 0; i < queuetest.LeakTestCount; i++ {
+		v := f.NewValue(r.Intn(queuetest.LeakTestCount))
+		q.Push(v)
+	}
+	for i := 0; i < queuetest.LeakTestCount; i++ {
+		if _, ok := q.PopMin(); !ok {
+			t.Fatalf("Expected: value %d; Got: empty queue", i)
+		}
+	}
+
+	if r := f.Wait(queuetest.LeakTestCount); r != queuetest.LeakTestCount {
+		t.Errorf("Expected: %d released values; Got: %d", queuetest.LeakTestCount, r)
+	}
+	runtime.KeepAlive(q)
+}
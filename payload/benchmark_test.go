@@ -0,0 +1,173 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+//go:build go1.18
+// +build go1.18
+
+package payload
+
+import (
+	"runtime"
+	"strconv"
+	"testing"
+
+	"github.com/christianrpetrin/queue-tests/queueimpl1"
+	"github.com/christianrpetrin/queue-tests/queueimpl10"
+	"github.com/christianrpetrin/queue-tests/queueimpl11"
+	"github.com/christianrpetrin/queue-tests/queueimpl2"
+	"github.com/christianrpetrin/queue-tests/queueimpl3"
+	"github.com/christianrpetrin/queue-tests/queueimpl4"
+	"github.com/christianrpetrin/queue-tests/queueimpl5"
+	"github.com/christianrpetrin/queue-tests/queueimpl6"
+	"github.com/christianrpetrin/queue-tests/queueimpl7"
+	"github.com/christianrpetrin/queue-tests/queueimpl8"
+)
+
+// value is the logical payload pushed by the benchmark tests, as a small message or job
+// descriptor would be.
+type value struct {
+	id, size, created, deadline int64
+}
+
+// benchImpl describes an implementation probed by the benchmark tests.
+type benchImpl[T any] struct {
+	// name is the name of the sub-benchmark probing the implementation.
+	name string
+
+	// new returns a new, empty queue.
+	new func() queue[T]
+}
+
+var (
+	// ifaceImpls holds the probed interface{} based implementations.
+	// Queueimpl9 only holds pointer-shaped values and is probed by its own benchmark tests.
+	ifaceImpls = []benchImpl[interface{}]{
+		{name: "Impl1", new: func() queue[interface{}] { return queueimpl1.New() }},
+		{name: "Impl2", new: func() queue[interface{}] { return queueimpl2.New() }},
+		{name: "Impl3", new: func() queue[interface{}] { return queueimpl3.New() }},
+		{name: "Impl4", new: func() queue[interface{}] { return queueimpl4.New() }},
+		{name: "Impl5", new: func() queue[interface{}] { return queueimpl5.New() }},
+		{name: "Impl6", new: func() queue[interface{}] { return queueimpl6.New() }},
+		{name: "Impl7", new: func() queue[interface{}] { return queueimpl7.New() }},
+		{name: "Impl8", new: func() queue[interface{}] { return queueimpl8.New() }},
+		{name: "Impl10", new: func() queue[interface{}] { return queueimpl10.New() }},
+		{name: "Impl11", new: func() queue[interface{}] { return queueimpl11.New() }},
+	}
+
+	// valueImpls holds the probed generic implementations holding values.
+	valueImpls = []benchImpl[value]{
+		{name: "Slice", new: func() queue[value] { return new(Slice[value]) }},
+		{name: "Linked", new: func() queue[value] { return new(Linked[value]) }},
+		{name: "Ring", new: func() queue[value] { return new(Ring[value]) }},
+	}
+
+	// pointerImpls holds the probed generic implementations holding pointers.
+	pointerImpls = []benchImpl[*value]{
+		{name: "Slice", new: func() queue[*value] { return new(Slice[*value]) }},
+		{name: "Linked", new: func() queue[*value] { return new(Linked[*value]) }},
+		{name: "Ring", new: func() queue[*value] { return new(Ring[*value]) }},
+	}
+
+	// lengths holds the queue lengths probed by the benchmark tests.
+	lengths = []int{100, 10000, 100000}
+
+	// Used to store temp values, avoiding any compiler optimizations.
+	tmp  interface{}
+	tmp2 int64
+)
+
+// newValue returns payload i.
+func newValue(i int) value {
+	return value{id: int64(i), size: 512, created: int64(i), deadline: int64(i) + 1000}
+}
+
+// BenchmarkPayload probes pushing l payloads to a new queue and then popping all of them:
+//   - Impl*/Interface pushes each payload as a value boxed in an interface{}.
+//   - Impl*/Pointer pushes a pointer to each payload, in an interface{}.
+//   - Slice, Linked and Ring/Value push each payload to a generic queue of values.
+//   - Slice, Linked and Ring/Pointer push a pointer to each payload to a generic queue of pointers.
+//
+// Each payload is created at push time and read back at pop time, so the cost of allocating,
+// boxing and unboxing them is accounted for. Besides the time and allocations per operation,
+// the benchmark tests report the heap kept alive by a queue holding l payloads, per payload,
+// as live-B/value.
+func BenchmarkPayload(b *testing.B) {
+	for _, i := range ifaceImpls {
+		benchmarkPayload(b, i.name+"/Interface", i.new,
+			func(i int) interface{} { return newValue(i) },
+			func(v interface{}) int64 { return v.(value).id })
+		benchmarkPayload(b, i.name+"/Pointer", i.new,
+			func(i int) interface{} { v := newValue(i); return &v },
+			func(v interface{}) int64 { return v.(*value).id })
+	}
+	for _, i := range valueImpls {
+		benchmarkPayload(b, i.name+"/Value", i.new,
+			newValue,
+			func(v value) int64 { return v.id })
+	}
+	for _, i := range pointerImpls {
+		benchmarkPayload(b, i.name+"/Pointer", i.new,
+			func(i int) *value { v := newValue(i); return &v },
+			func(v *value) int64 { return v.id })
+	}
+}
+
+// benchmarkPayload runs the sub-benchmarks named name of BenchmarkPayload, one per length,
+// probing the queues returned by newQueue using payloads created by push and read by pop.
+func benchmarkPayload[T any](b *testing.B, name string, newQueue func() queue[T], push func(i int) T, pop func(v T) int64) {
+	for _, l := range lengths {
+		l := l
+		b.Run(name+"/"+strconv.Itoa(l), func(b *testing.B) {
+			b.ReportAllocs()
+			for n := 0; n < b.N; n++ {
+				q := newQueue()
+				for i := 0; i < l; i++ {
+					q.Push(push(i))
+				}
+				for q.Len() > 0 {
+					v, _ := q.Pop()
+					tmp2 += pop(v)
+				}
+			}
+
+			b.StopTimer()
+			b.ReportMetric(liveHeap(l, newQueue, push)/float64(l), "live-B/value")
+		})
+	}
+}
+
+// liveHeap returns the number of heap bytes kept alive by a queue returned by newQueue
+// holding l payloads created by push.
+func liveHeap[T any](l int, newQueue func() queue[T], push func(i int) T) float64 {
+	tmp = nil // Release the queues left by the other benchmark tests
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+
+	q := newQueue()
+	for i := 0; i < l; i++ {
+		q.Push(push(i))
+	}
+	runtime.GC()
+	runtime.ReadMemStats(&after)
+	runtime.KeepAlive(q)
+
+	return float64(int64(after.HeapAlloc) - int64(before.HeapAlloc))
+}
@@ -0,0 +1,36 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package payload probes how the representation of the queue elements affects the queue
+// performance, comparing the same logical payload stored as an interface{} value, as a pointer,
+// and as a value of a generic queue's type parameter.
+// Storing a non pointer-shaped value (e.g. a struct or an int larger than 255) in an interface{}
+// allocates a copy of the value, and each interface{} slot holds two words the garbage collector
+// has to scan; storing pointers avoids copying the value but still allocates it; a generic queue
+// stores the values themselves in its slots, with no allocation per value.
+// Internally, the package implements generic versions of three of the queue structures in this
+// repo: a single slice (as in queueimpl1), fixed sized slices linked using a singly linked list
+// (as in queueimpl3) and a ring buffer whose capacity is always a power of two (as in queueimpl11).
+// The benchmark tests compare them against all the interface{} based implementations:
+//
+//	go test -benchmem -bench=. -run=^$ ./payload
+//
+// As it relies on type parameters, the package is only built with Go 1.18 or later.
+package payload
@@ -0,0 +1,207 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+//go:build go1.18
+// +build go1.18
+
+package payload
+
+const (
+	// internalSliceSize holds the size of each internal slice of a Linked queue.
+	internalSliceSize = 128
+
+	// minCapacity holds the capacity of the slice allocated by the first Push to a Ring queue.
+	// It must be a power of two.
+	minCapacity = 16
+)
+
+// Slice represents an unbounded, dynamically growing FIFO queue of values of type T,
+// stored in a single slice. Pop removes the first slice element.
+// The zero value for Slice is an empty queue ready to use.
+type Slice[T any] struct {
+	// The queue values.
+	v []T
+}
+
+// Len returns the number of elements of queue q.
+// The complexity is O(1).
+func (q *Slice[T]) Len() int { return len(q.v) }
+
+// Push adds a value to the queue.
+// The complexity is amortized O(1).
+func (q *Slice[T]) Push(v T) {
+	q.v = append(q.v, v)
+}
+
+// Pop retrieves and removes the next element from the queue.
+// The second, bool result indicates whether a valid value was returned;
+//   if the queue is empty, the zero value and false will be returned.
+// The complexity is amortized O(1).
+func (q *Slice[T]) Pop() (T, bool) {
+	var zero T
+	if len(q.v) == 0 {
+		return zero, false
+	}
+
+	v := q.v[0]
+	q.v[0] = zero // Avoid memory leaks
+	q.v = q.v[1:]
+	return v, true
+}
+
+// Linked represents an unbounded, dynamically growing FIFO queue of values of type T,
+// stored in fixed sized slices that are linked using a singly linked list.
+// The zero value for Linked is an empty queue ready to use.
+type Linked[T any] struct {
+	// Head points to the first node of the linked list.
+	head *node[T]
+
+	// Tail points to the last node of the linked list.
+	// In an empty queue, head and tail points to the same node.
+	tail *node[T]
+
+	// Pos is the index pointing to the current first element in the queue
+	// (i.e. first element added in the current queue values).
+	pos int
+
+	// Len holds the current queue length.
+	len int
+}
+
+// node represents a Linked queue node.
+type node[T any] struct {
+	// v holds the list of user added values in this node.
+	v []T
+
+	// n points to the next node in the linked list.
+	n *node[T]
+}
+
+// Len returns the number of elements of queue q.
+// The complexity is O(1).
+func (q *Linked[T]) Len() int { return q.len }
+
+// Push adds a value to the queue.
+// The complexity is O(1).
+func (q *Linked[T]) Push(v T) {
+	if q.head == nil {
+		q.head = &node[T]{v: make([]T, 0, internalSliceSize)}
+		q.tail = q.head
+	} else if len(q.tail.v) >= internalSliceSize {
+		n := &node[T]{v: make([]T, 0, internalSliceSize)}
+		q.tail.n = n
+		q.tail = n
+	}
+
+	q.tail.v = append(q.tail.v, v)
+	q.len++
+}
+
+// Pop retrieves and removes the next element from the queue.
+// The second, bool result indicates whether a valid value was returned;
+//   if the queue is empty, the zero value and false will be returned.
+// The complexity is O(1).
+func (q *Linked[T]) Pop() (T, bool) {
+	var zero T
+	if q.len == 0 {
+		return zero, false
+	}
+
+	v := q.head.v[q.pos]
+	q.head.v[q.pos] = zero // Avoid memory leaks
+	q.len--
+
+	if q.pos >= len(q.head.v)-1 {
+		if q.head.n == nil {
+			// The head node is also the tail node and all its values were popped, so reuse it.
+			q.head.v = q.head.v[:0]
+		} else {
+			h := q.head
+			q.head = h.n
+			h.n = nil // Avoid memory leaks
+		}
+		q.pos = 0
+	} else {
+		q.pos++
+	}
+
+	return v, true
+}
+
+// Ring represents an unbounded, dynamically growing FIFO queue of values of type T,
+// stored in a ring buffer which doubles its capacity whenever it is full.
+// The zero value for Ring is an empty queue ready to use.
+type Ring[T any] struct {
+	// buf holds the queue values. Its length is always zero or a power of two.
+	buf []T
+
+	// Head is the index pointing to the current first element in the queue
+	// (i.e. first element added in the current queue values).
+	head int
+
+	// Len holds the current queue length.
+	len int
+}
+
+// Len returns the number of elements of queue q.
+// The complexity is O(1).
+func (q *Ring[T]) Len() int { return q.len }
+
+// Push adds a value to the queue.
+// The complexity is amortized O(1), as the values are moved to a new slice when the slice is full.
+func (q *Ring[T]) Push(v T) {
+	if q.len == len(q.buf) {
+		q.grow()
+	}
+
+	q.buf[(q.head+q.len)&(len(q.buf)-1)] = v
+	q.len++
+}
+
+// Pop retrieves and removes the next element from the queue.
+// The second, bool result indicates whether a valid value was returned;
+//   if the queue is empty, the zero value and false will be returned.
+// The slice is never shrunk.
+// The complexity is O(1).
+func (q *Ring[T]) Pop() (T, bool) {
+	var zero T
+	if q.len == 0 {
+		return zero, false
+	}
+
+	v := q.buf[q.head]
+	q.buf[q.head] = zero // Avoid memory leaks
+	q.head = (q.head + 1) & (len(q.buf) - 1)
+	q.len--
+	return v, true
+}
+
+// grow moves the values, in order, to a new slice with twice the capacity.
+func (q *Ring[T]) grow() {
+	size := len(q.buf) * 2
+	if size == 0 {
+		size = minCapacity
+	}
+	buf := make([]T, size)
+	n := copy(buf, q.buf[q.head:])
+	copy(buf[n:], q.buf[:q.head])
+	q.buf = buf
+	q.head = 0
+}
@@ -0,0 +1,118 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+//go:build go1.18
+// +build go1.18
+
+package payload
+
+import (
+	"testing"
+)
+
+// queue is the set of operations shared by the generic queues.
+type queue[T any] interface {
+	Len() int
+	Push(v T)
+	Pop() (T, bool)
+}
+
+// genericImpls holds, by name, functions returning new, empty generic queues of ints.
+var genericImpls = map[string]func() queue[int]{
+	"Slice":  func() queue[int] { return new(Slice[int]) },
+	"Linked": func() queue[int] { return new(Linked[int]) },
+	"Ring":   func() queue[int] { return new(Ring[int]) },
+}
+
+func TestGenericQueuesShouldPopValuesInPushOrder(t *testing.T) {
+	for name, newQueue := range genericImpls {
+		q := newQueue()
+		next, want := 0, 0
+		// Interleave pushes and pops, so the Linked and Ring queues move to new nodes and wrap around.
+		for round := 0; round < 10; round++ {
+			for i := 0; i < 300; i++ {
+				q.Push(next)
+				next++
+			}
+			for i := 0; i < 200; i++ {
+				if v, ok := q.Pop(); !ok || v != want {
+					t.Fatalf("%s: Expected: %d, true; Got: %d, %t", name, want, v, ok)
+				}
+				want++
+			}
+		}
+		if q.Len() != next-want {
+			t.Errorf("%s: Expected: length %d; Got: %d", name, next-want, q.Len())
+		}
+		for q.Len() > 0 {
+			if v, ok := q.Pop(); !ok || v != want {
+				t.Fatalf("%s: Expected: %d, true; Got: %d, %t", name, want, v, ok)
+			}
+			want++
+		}
+		if want != next {
+			t.Errorf("%s: Expected: %d values popped; Got: %d", name, next, want)
+		}
+	}
+}
+
+func TestGenericQueuesPopShouldReturnZeroValueWhenEmpty(t *testing.T) {
+	for name, newQueue := range genericImpls {
+		q := newQueue()
+		if v, ok := q.Pop(); ok || v != 0 {
+			t.Errorf("%s: Expected: 0, false; Got: %d, %t", name, v, ok)
+		}
+
+		q.Push(1)
+		q.Pop()
+		if v, ok := q.Pop(); ok || v != 0 {
+			t.Errorf("%s: Expected: 0, false after draining the queue; Got: %d, %t", name, v, ok)
+		}
+	}
+}
+
+func TestGenericQueuesPopShouldClearPoppedSlots(t *testing.T) {
+	v := new(int)
+
+	s := new(Slice[*int])
+	s.Push(v)
+	s.Push(v)
+	backing := s.v
+	s.Pop()
+	if backing[0] != nil {
+		t.Errorf("Slice: Expected: popped slot cleared; Got: %p", backing[0])
+	}
+
+	l := new(Linked[*int])
+	l.Push(v)
+	l.Push(v)
+	l.Pop()
+	if l.head.v[0] != nil {
+		t.Errorf("Linked: Expected: popped slot cleared; Got: %p", l.head.v[0])
+	}
+
+	r := new(Ring[*int])
+	r.Push(v)
+	r.Push(v)
+	r.Pop()
+	if r.buf[0] != nil {
+		t.Errorf("Ring: Expected: popped slot cleared; Got: %p", r.buf[0])
+	}
+}
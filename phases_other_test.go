@@ -0,0 +1,45 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+//go:build !go1.11
+// +build !go1.11
+
+package tests
+
+import (
+	"flag"
+	"testing"
+)
+
+// phases is accepted for compatibility, but has no effect as runtime/trace regions
+// require Go 1.11 or newer.
+var phases = flag.Bool("phases", false, "label the push and pop phases of each benchmark (requires Go 1.11)")
+
+// phaseProfiler does nothing, as runtime/trace regions require Go 1.11 or newer.
+type phaseProfiler struct{}
+
+// startPhases returns nil, as runtime/trace regions require Go 1.11 or newer.
+func startPhases(b *testing.B) *phaseProfiler { return nil }
+
+// phase does nothing.
+func (p *phaseProfiler) phase(phase string) {}
+
+// end does nothing.
+func (p *phaseProfiler) end() {}
@@ -0,0 +1,104 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+//go:build go1.11
+// +build go1.11
+
+package tests
+
+import (
+	"context"
+	"flag"
+	"runtime/pprof"
+	"runtime/trace"
+	"strings"
+	"testing"
+)
+
+// phases enables labeling the push and pop phases of the benchmark tests.
+var phases = flag.Bool("phases", false, "label the push and pop phases of each benchmark with pprof labels and runtime/trace regions")
+
+// phaseProfiler labels the phases of a benchmark test, so the time spent in each phase of
+// each implementation can be told apart in the CPU profile (using the impl, count and phase
+// pprof labels) and in the execution trace (using one task per benchmark test, holding one
+// region per phase).
+// A nil phaseProfiler, returned when the phases flag is not set, does nothing.
+type phaseProfiler struct {
+	// ctx holds the benchmark test task and labels.
+	ctx context.Context
+
+	// task holds the benchmark test trace task.
+	task *trace.Task
+
+	// labels holds the contexts labeling each phase, by phase name.
+	labels map[string]context.Context
+
+	// region holds the trace region of the current phase, or nil if no phase was started.
+	region *trace.Region
+}
+
+// startPhases returns a profiler labeling the phases of benchmark test b, or nil if the
+// phases flag is not set. The profiler must be ended once the benchmark test is done.
+func startPhases(b *testing.B) *phaseProfiler {
+	if !*phases {
+		return nil
+	}
+
+	// Benchmark names look like BenchmarkImpl3/100.
+	name := strings.TrimPrefix(b.Name(), "Benchmark")
+	impl, count := name, ""
+	if i := strings.Index(name, "/"); i >= 0 {
+		impl, count = name[:i], name[i+1:]
+	}
+
+	p := new(phaseProfiler)
+	p.ctx, p.task = trace.NewTask(context.Background(), b.Name())
+	p.ctx = pprof.WithLabels(p.ctx, pprof.Labels("impl", impl, "count", count))
+	p.labels = make(map[string]context.Context)
+	for _, phase := range []string{"push", "pop"} {
+		p.labels[phase] = pprof.WithLabels(p.ctx, pprof.Labels("phase", phase))
+	}
+	return p
+}
+
+// phase ends the current phase, if any, and starts the phase named phase.
+func (p *phaseProfiler) phase(phase string) {
+	if p == nil {
+		return
+	}
+	if p.region != nil {
+		p.region.End()
+	}
+	pprof.SetGoroutineLabels(p.labels[phase])
+	p.region = trace.StartRegion(p.ctx, phase)
+}
+
+// end ends the current phase, if any, and the benchmark test task.
+func (p *phaseProfiler) end() {
+	if p == nil {
+		return
+	}
+	if p.region != nil {
+		p.region.End()
+		p.region = nil
+	}
+	pprof.SetGoroutineLabels(context.Background())
+	p.task.End()
+}
@@ -0,0 +1,37 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package queueerr defines the sentinel errors returned by the error form of the queue
+// operations (e.g. PopE), as an alternative to their bool form.
+// The errors are shared by all implementations, so callers can compare the returned errors
+// against them regardless of the implementation.
+package queueerr
+
+import (
+	"errors"
+)
+
+var (
+	// ErrEmpty is returned when retrieving a value from an empty queue.
+	ErrEmpty = errors.New("queue: empty")
+
+	// ErrClosed is returned when pushing a value to or retrieving a value from a closed queue.
+	ErrClosed = errors.New("queue: closed")
+)
@@ -21,7 +21,10 @@
 package queueimpl1
 
 import (
+	"runtime"
 	"testing"
+
+	"github.com/christianrpetrin/queue-tests/queuetest"
 )
 
 func TestQueueImpl1NewQueueShouldReturnInitiazedInstanceOfQueue(t *testing.T) {
@@ -173,3 +176,21 @@ func TestQueueImpl1PutGetFrontShouldRetrieveAllElementsInOrder(t *testing.T) {
 		})
 	}
 }
+
+func TestQueueImpl1PopShouldReleasePoppedValues(t *testing.T) {
+	q := New()
+	var f queuetest.Finalizers
+	for i := 0; i < queuetest.LeakTestCount; i++ {
+		q.Push(f.NewValue(0))
+	}
+	for i := 0; i < queuetest.LeakTestCount; i++ {
+		if _, ok := q.Pop(); !ok {
+			t.Fatalf("Expected: value %d; Got: empty queue", i)
+		}
+	}
+
+	if r := f.Wait(queuetest.LeakTestCount); r != queuetest.LeakTestCount {
+		t.Errorf("Expected: %d released values; Got: %d", queuetest.LeakTestCount, r)
+	}
+	runtime.KeepAlive(q)
+}
@@ -0,0 +1,108 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package queueimpl10
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/christianrpetrin/queue-tests/queueimpl3"
+)
+
+var (
+	// tinyLengths holds the queue lengths probed by the tiny queue benchmark tests,
+	// including one more value than the inline array can hold.
+	tinyLengths = []int{1, 4, inlineSize, inlineSize + 1}
+
+	// value holds the value pushed by the benchmark tests, boxed only once.
+	value interface{} = 1
+
+	// Used to store temp values, avoiding any compiler optimizations.
+	tmp  interface{}
+	tmp2 bool
+)
+
+// BenchmarkTiny probes a tiny, transient queue declared as a local variable, which is
+// filled with l values and then drained, against queueimpl3, which allocates its
+// 128 slots first node on the first Push.
+func BenchmarkTiny(b *testing.B) {
+	for _, l := range tinyLengths {
+		l := l
+		b.Run("Impl3/"+strconv.Itoa(l), func(b *testing.B) {
+			b.ReportAllocs()
+			for n := 0; n < b.N; n++ {
+				var q queueimpl3.Queueimpl3
+				for i := 0; i < l; i++ {
+					q.Push(value)
+				}
+				for q.Len() > 0 {
+					tmp, tmp2 = q.Pop()
+				}
+			}
+		})
+		b.Run("Impl10/"+strconv.Itoa(l), func(b *testing.B) {
+			b.ReportAllocs()
+			for n := 0; n < b.N; n++ {
+				var q Queueimpl10
+				for i := 0; i < l; i++ {
+					q.Push(value)
+				}
+				for q.Len() > 0 {
+					tmp, tmp2 = q.Pop()
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkTinyNew is the same as BenchmarkTiny, but allocates the queues using New,
+// so the queue itself is allocated from the heap.
+func BenchmarkTinyNew(b *testing.B) {
+	for _, l := range tinyLengths {
+		l := l
+		b.Run("Impl3/"+strconv.Itoa(l), func(b *testing.B) {
+			b.ReportAllocs()
+			for n := 0; n < b.N; n++ {
+				q := queueimpl3.New()
+				for i := 0; i < l; i++ {
+					q.Push(value)
+				}
+				for q.Len() > 0 {
+					tmp, tmp2 = q.Pop()
+				}
+				tmp = q
+			}
+		})
+		b.Run("Impl10/"+strconv.Itoa(l), func(b *testing.B) {
+			b.ReportAllocs()
+			for n := 0; n < b.N; n++ {
+				q := New()
+				for i := 0; i < l; i++ {
+					q.Push(value)
+				}
+				for q.Len() > 0 {
+					tmp, tmp2 = q.Pop()
+				}
+				tmp = q
+			}
+		})
+	}
+}
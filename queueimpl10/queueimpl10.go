@@ -0,0 +1,190 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package queueimpl10 implements an unbounded, dynamically growing FIFO queue.
+// Internally, queue store the first values in a small fixed size array held in the queue
+// itself, used as a ring buffer. Once a value is added to a full array, the values are moved
+// to fixed sized slices that are linked using a singly linked list, which are used from then on.
+// This implementation tests the queue performance for tiny, transient queues, which are very
+// common: a queue that never holds more than 8 values at once doesn't allocate any node, and a
+// queue value that doesn't escape to the heap doesn't allocate at all.
+// Otherwise the nodes are handled as in queueimpl3.
+package queueimpl10
+
+const (
+	// inlineSize holds the size of the array held in the queue itself.
+	// It must be a power of two.
+	inlineSize = 8
+
+	// inlineMask holds the mask used to wrap the positions of the array held in the queue itself.
+	inlineMask = inlineSize - 1
+
+	// internalSliceSize holds the size of each internal slice.
+	internalSliceSize = 128
+)
+
+// Queueimpl10 represents an unbounded, dynamically growing FIFO queue.
+// The zero value for queue is an empty queue ready to use.
+type Queueimpl10 struct {
+	// inline holds the queue values until the first node is allocated.
+	inline [inlineSize]interface{}
+
+	// Head points to the first node of the linked list,
+	// or is nil if the values are held in inline.
+	head *Node
+
+	// Tail points to the last node of the linked list.
+	// In an empty queue, head and tail points to the same node,
+	// or are both nil if the values are held in inline.
+	tail *Node
+
+	// Pos is the index pointing to the current first element in the queue
+	// (i.e. first element added in the current queue values),
+	// in inline if head is nil; in the head node otherwise.
+	pos int
+
+	// Len holds the current queue length.
+	len int
+}
+
+// Node represents a queue node.
+// Each node holds an slice of user managed values.
+type Node struct {
+	// v holds the list of user added values in this node.
+	v []interface{}
+
+	// n points to the next node in the linked list.
+	n *Node
+}
+
+// New returns an initialized queue.
+func New() *Queueimpl10 {
+	return new(Queueimpl10).Init()
+}
+
+// Init initializes or clears queue q.
+// The queue nodes are discarded, so the values are held in inline again.
+func (q *Queueimpl10) Init() *Queueimpl10 {
+	q.inline = [inlineSize]interface{}{} // Avoid memory leaks
+	q.head = nil
+	q.tail = nil
+	q.pos = 0
+	q.len = 0
+	return q
+}
+
+// Len returns the number of elements of queue q.
+// The complexity is O(1).
+func (q *Queueimpl10) Len() int { return q.len }
+
+// Front returns the first element of queue q or nil if the queue is empty.
+// The second, bool result indicates whether a valid value was returned;
+//   if the queue is empty, false will be returned.
+// The complexity is O(1).
+func (q *Queueimpl10) Front() (interface{}, bool) {
+	if q.len == 0 {
+		return nil, false
+	}
+	if q.head == nil {
+		return q.inline[q.pos], true
+	}
+
+	return q.head.v[q.pos], true
+}
+
+// Push adds a value to the queue.
+// The first value added to a full inline array moves the inline values to a new node, and
+// the nodes are used from then on, even if the queue length drops again.
+// The complexity is O(1).
+func (q *Queueimpl10) Push(v interface{}) {
+	if q.head == nil {
+		if q.len < inlineSize {
+			q.inline[(q.pos+q.len)&inlineMask] = v
+			q.len++
+			return
+		}
+		q.spill()
+	} else if len(q.tail.v) >= internalSliceSize {
+		n := newNode()
+		q.tail.n = n
+		q.tail = n
+	}
+
+	q.tail.v = append(q.tail.v, v)
+	q.len++
+}
+
+// Pop retrieves and removes the next element from the queue.
+// The second, bool result indicates whether a valid value was returned;
+//   if the queue is empty, false will be returned.
+// The complexity is O(1).
+func (q *Queueimpl10) Pop() (interface{}, bool) {
+	if q.len == 0 {
+		return nil, false
+	}
+
+	if q.head == nil {
+		v := q.inline[q.pos]
+		q.inline[q.pos] = nil // Avoid memory leaks
+		q.pos = (q.pos + 1) & inlineMask
+		q.len--
+		return v, true
+	}
+
+	v := q.head.v[q.pos]
+	q.head.v[q.pos] = nil // Avoid memory leaks
+	q.len--
+
+	if q.pos >= len(q.head.v)-1 {
+		if q.head.n == nil {
+			// The head node is also the tail node and all its values were popped, so reuse it.
+			q.head.v = q.head.v[:0]
+		} else {
+			h := q.head
+			q.head = h.n
+			h.n = nil // Avoid memory leaks
+		}
+		q.pos = 0
+	} else {
+		q.pos++
+	}
+
+	return v, true
+}
+
+// spill moves the values of the full inline array to a new node, in order.
+func (q *Queueimpl10) spill() {
+	n := newNode()
+	for i := 0; i < inlineSize; i++ {
+		p := (q.pos + i) & inlineMask
+		n.v = append(n.v, q.inline[p])
+		q.inline[p] = nil // Avoid memory leaks
+	}
+	q.head = n
+	q.tail = n
+	q.pos = 0
+}
+
+// newNode returns an initialized node.
+func newNode() *Node {
+	return &Node{
+		v: make([]interface{}, 0, internalSliceSize),
+	}
+}
@@ -0,0 +1,161 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package queueimpl10
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/christianrpetrin/queue-tests/queuetest"
+)
+
+func TestQueueImpl10NewQueueShouldReturnInitiazedInstanceOfQueue(t *testing.T) {
+	q := New()
+
+	if q == nil {
+		t.Error("Expected: new instance of queue; Got: nil")
+	}
+}
+
+func TestQueueImpl10WithZeroValueAndEmptyShouldReturnAsEmpty(t *testing.T) {
+	var q Queueimpl10
+	if _, ok := q.Front(); ok {
+		t.Error("Expected: false as the queue is empty; Got: true")
+	}
+	if _, ok := q.Pop(); ok {
+		t.Error("Expected: false as the queue is empty; Got: true")
+	}
+	if l := q.Len(); l != 0 {
+		t.Errorf("Expected: 0 as the queue is empty; Got: %d", l)
+	}
+}
+
+func TestQueueImpl10ShouldRetrieveAllElementsInOrder(t *testing.T) {
+	for _, count := range []int{1, inlineSize, inlineSize + 1, 1000} {
+		var q Queueimpl10
+		for i := 0; i < count; i++ {
+			q.Push(i)
+		}
+		if l := q.Len(); l != count {
+			t.Errorf("Expected: %d; Got: %d", count, l)
+		}
+
+		for i := 0; i < count; i++ {
+			if v, ok := q.Front(); !ok || v.(int) != i {
+				t.Errorf("Expected: %d; Got: %v", i, v)
+			}
+			if v, ok := q.Pop(); !ok || v.(int) != i {
+				t.Errorf("Expected: %d; Got: %v", i, v)
+			}
+		}
+		if v, ok := q.Pop(); ok || v != nil {
+			t.Errorf("Expected: nil as the queue should be empty; Got: %v", v)
+		}
+	}
+}
+
+func TestQueueImpl10WithWrappedInlineValuesShouldRetrieveAllElementsInOrder(t *testing.T) {
+	var q Queueimpl10
+	next, want := 0, 0
+	for i := 0; i < 5; i++ {
+		q.Push(next)
+		next++
+	}
+	for i := 0; i < 3; i++ {
+		if v, ok := q.Pop(); !ok || v.(int) != want {
+			t.Errorf("Expected: %d; Got: %v", want, v)
+		}
+		want++
+	}
+
+	// Wrap around the end of the inline array, and then spill the inline values to a node.
+	for i := 0; i < inlineSize+1; i++ {
+		q.Push(next)
+		next++
+	}
+	if q.head == nil {
+		t.Error("Expected: values moved to a node; Got: values held inline")
+	}
+	for q.Len() > 0 {
+		if v, ok := q.Pop(); !ok || v.(int) != want {
+			t.Errorf("Expected: %d; Got: %v", want, v)
+		}
+		want++
+	}
+	if want != next {
+		t.Errorf("Expected: %d popped values; Got: %d", next, want)
+	}
+}
+
+func TestQueueImpl10WithInlineValuesShouldNotAllocate(t *testing.T) {
+	value := interface{}(1)
+	allocs := testing.AllocsPerRun(100, func() {
+		var q Queueimpl10
+		for i := 0; i < inlineSize; i++ {
+			q.Push(value)
+		}
+		for q.Len() > 0 {
+			q.Pop()
+		}
+	})
+	if allocs != 0 {
+		t.Errorf("Expected: 0 allocations; Got: %v", allocs)
+	}
+}
+
+func TestQueueImpl10InitShouldHoldValuesInlineAgain(t *testing.T) {
+	q := New()
+	for i := 0; i < inlineSize+1; i++ {
+		q.Push(i)
+	}
+	q.Init()
+	if l := q.Len(); l != 0 {
+		t.Errorf("Expected: 0 as the queue was cleared; Got: %d", l)
+	}
+	if q.head != nil {
+		t.Error("Expected: values held inline; Got: values held in a node")
+	}
+
+	q.Push(1)
+	if v, ok := q.Pop(); !ok || v.(int) != 1 {
+		t.Errorf("Expected: 1; Got: %v", v)
+	}
+}
+
+func TestQueueImpl10PopShouldReleasePoppedValues(t *testing.T) {
+	for _, count := range []int{inlineSize, queuetest.LeakTestCount} {
+		q := New()
+		var f queuetest.Finalizers
+		for i := 0; i < count; i++ {
+			q.Push(f.NewValue(0))
+		}
+		for i := 0; i < count; i++ {
+			if _, ok := q.Pop(); !ok {
+				t.Fatalf("Expected: value %d; Got: empty queue", i)
+			}
+		}
+
+		if r := f.Wait(int32(count)); r != int32(count) {
+			t.Errorf("Expected: %d released values; Got: %d", count, r)
+		}
+		runtime.KeepAlive(q)
+	}
+}
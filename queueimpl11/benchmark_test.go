@@ -0,0 +1,148 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package queueimpl11
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/christianrpetrin/queue-tests/queuetest"
+)
+
+// moduloQueue is the same implementation as Queueimpl11, but wraps the positions using the
+// modulo operation instead of a bitmask.
+type moduloQueue struct {
+	// buf holds the queue values.
+	buf []interface{}
+
+	// head is the index pointing to the current first element in the queue.
+	head int
+
+	// len holds the current queue length.
+	len int
+}
+
+// Len returns the number of elements of queue q.
+func (q *moduloQueue) Len() int { return q.len }
+
+// Push adds a value to the queue.
+func (q *moduloQueue) Push(v interface{}) {
+	if q.len == len(q.buf) {
+		q.grow()
+	}
+
+	q.buf[(q.head+q.len)%len(q.buf)] = v
+	q.len++
+}
+
+// Pop retrieves and removes the next element from the queue.
+func (q *moduloQueue) Pop() (interface{}, bool) {
+	if q.len == 0 {
+		return nil, false
+	}
+
+	v := q.buf[q.head]
+	q.buf[q.head] = nil // Avoid memory leaks
+	q.head = (q.head + 1) % len(q.buf)
+	q.len--
+	return v, true
+}
+
+// grow moves the values, in order, to a new slice with twice the capacity.
+func (q *moduloQueue) grow() {
+	size := len(q.buf) * 2
+	if size == 0 {
+		size = minCapacity
+	}
+	buf := make([]interface{}, size)
+	n := copy(buf, q.buf[q.head:])
+	copy(buf[n:], q.buf[:q.head])
+	q.buf = buf
+	q.head = 0
+}
+
+var (
+	// benchImpls holds the probed position wrapping strategies.
+	benchImpls = []struct {
+		name string
+		new  func() queuetest.Queue
+	}{
+		{name: "Mask", new: func() queuetest.Queue { return New() }},
+		{name: "Modulo", new: func() queuetest.Queue { return new(moduloQueue) }},
+	}
+
+	// lengths holds the queue lengths probed by the benchmark tests.
+	lengths = []int{100, 10000, 100000}
+
+	// value holds the value pushed by the benchmark tests, boxed only once.
+	value interface{} = 1
+
+	// Used to store temp values, avoiding any compiler optimizations.
+	tmp  interface{}
+	tmp2 bool
+)
+
+// BenchmarkChurn probes a long lived queue kept at a stable length, pushing and popping
+// a value in each iteration, so the positions keep wrapping around the end of the slice.
+func BenchmarkChurn(b *testing.B) {
+	for _, i := range benchImpls {
+		for _, l := range lengths {
+			i, l := i, l
+			b.Run(i.name+"/"+strconv.Itoa(l), func(b *testing.B) {
+				q := i.new()
+				for j := 0; j < l; j++ {
+					q.Push(value)
+				}
+				b.ReportAllocs()
+				b.ResetTimer()
+
+				for n := 0; n < b.N; n++ {
+					q.Push(value)
+					tmp, tmp2 = q.Pop()
+				}
+			})
+		}
+	}
+}
+
+// BenchmarkFillDrain probes a long lived queue that is repeatedly filled with l values and
+// then drained, so its slice only grows during the first iteration.
+func BenchmarkFillDrain(b *testing.B) {
+	for _, i := range benchImpls {
+		for _, l := range lengths {
+			i, l := i, l
+			b.Run(i.name+"/"+strconv.Itoa(l), func(b *testing.B) {
+				q := i.new()
+				b.ReportAllocs()
+				b.ResetTimer()
+
+				for n := 0; n < b.N; n++ {
+					for j := 0; j < l; j++ {
+						q.Push(value)
+					}
+					for q.Len() > 0 {
+						tmp, tmp2 = q.Pop()
+					}
+				}
+			})
+		}
+	}
+}
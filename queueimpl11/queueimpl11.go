@@ -0,0 +1,121 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package queueimpl11 implements an unbounded, dynamically growing FIFO queue.
+// Internally, queue store the values in a single slice used as a circular buffer (i.e. ring
+// buffer), which doubles its capacity, moving the values to a new slice, whenever it is full.
+// This implementation tests the queue performance when wrapping the positions of a ring buffer
+// whose capacity is always a power of two using a bitmask, instead of a modulo operation, which
+// requires an integer division as the capacity changes at run time.
+// The benchmark tests compare it against the same implementation using the modulo operation:
+// on amd64, pushing and popping a value costs about half as much using the bitmask (6-9ns
+// against 12-14ns per push and pop pair).
+package queueimpl11
+
+const (
+	// minCapacity holds the capacity of the slice allocated by the first Push.
+	// It must be a power of two.
+	minCapacity = 16
+)
+
+// Queueimpl11 represents an unbounded, dynamically growing FIFO queue.
+// The zero value for queue is an empty queue ready to use.
+type Queueimpl11 struct {
+	// buf holds the queue values. Its length is always zero or a power of two.
+	buf []interface{}
+
+	// Head is the index pointing to the current first element in the queue
+	// (i.e. first element added in the current queue values).
+	head int
+
+	// Len holds the current queue length.
+	len int
+}
+
+// New returns an initialized queue.
+func New() *Queueimpl11 {
+	return new(Queueimpl11).Init()
+}
+
+// Init initializes or clears queue q, releasing its slice.
+// The slice is only allocated when the first value is added to the queue.
+func (q *Queueimpl11) Init() *Queueimpl11 {
+	q.buf = nil
+	q.head = 0
+	q.len = 0
+	return q
+}
+
+// Len returns the number of elements of queue q.
+// The complexity is O(1).
+func (q *Queueimpl11) Len() int { return q.len }
+
+// Front returns the first element of queue q or nil if the queue is empty.
+// The second, bool result indicates whether a valid value was returned;
+//   if the queue is empty, false will be returned.
+// The complexity is O(1).
+func (q *Queueimpl11) Front() (interface{}, bool) {
+	if q.len == 0 {
+		return nil, false
+	}
+
+	return q.buf[q.head], true
+}
+
+// Push adds a value to the queue.
+// The complexity is amortized O(1), as the values are moved to a new slice when the slice is full.
+func (q *Queueimpl11) Push(v interface{}) {
+	if q.len == len(q.buf) {
+		q.grow()
+	}
+
+	q.buf[(q.head+q.len)&(len(q.buf)-1)] = v
+	q.len++
+}
+
+// Pop retrieves and removes the next element from the queue.
+// The second, bool result indicates whether a valid value was returned;
+//   if the queue is empty, false will be returned.
+// The slice is never shrunk; use Init to release it.
+// The complexity is O(1).
+func (q *Queueimpl11) Pop() (interface{}, bool) {
+	if q.len == 0 {
+		return nil, false
+	}
+
+	v := q.buf[q.head]
+	q.buf[q.head] = nil // Avoid memory leaks
+	q.head = (q.head + 1) & (len(q.buf) - 1)
+	q.len--
+	return v, true
+}
+
+// grow moves the values, in order, to a new slice with twice the capacity.
+func (q *Queueimpl11) grow() {
+	size := len(q.buf) * 2
+	if size == 0 {
+		size = minCapacity
+	}
+	buf := make([]interface{}, size)
+	n := copy(buf, q.buf[q.head:])
+	copy(buf[n:], q.buf[:q.head])
+	q.buf = buf
+	q.head = 0
+}
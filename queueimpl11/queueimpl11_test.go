@@ -0,0 +1,141 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package queueimpl11
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/christianrpetrin/queue-tests/queuetest"
+)
+
+func TestQueueImpl11NewQueueShouldReturnInitiazedInstanceOfQueue(t *testing.T) {
+	q := New()
+
+	if q == nil {
+		t.Error("Expected: new instance of queue; Got: nil")
+	}
+}
+
+func TestQueueImpl11WithZeroValueAndEmptyShouldReturnAsEmpty(t *testing.T) {
+	var q Queueimpl11
+	if _, ok := q.Front(); ok {
+		t.Error("Expected: false as the queue is empty; Got: true")
+	}
+	if _, ok := q.Pop(); ok {
+		t.Error("Expected: false as the queue is empty; Got: true")
+	}
+	if l := q.Len(); l != 0 {
+		t.Errorf("Expected: 0 as the queue is empty; Got: %d", l)
+	}
+}
+
+func TestQueueImpl11ShouldRetrieveAllElementsInOrder(t *testing.T) {
+	var q Queueimpl11
+	for i := 0; i < 1000; i++ {
+		q.Push(i)
+	}
+	if l := q.Len(); l != 1000 {
+		t.Errorf("Expected: 1000; Got: %d", l)
+	}
+
+	for i := 0; i < 1000; i++ {
+		if v, ok := q.Front(); !ok || v.(int) != i {
+			t.Errorf("Expected: %d; Got: %v", i, v)
+		}
+		if v, ok := q.Pop(); !ok || v.(int) != i {
+			t.Errorf("Expected: %d; Got: %v", i, v)
+		}
+	}
+	if v, ok := q.Pop(); ok || v != nil {
+		t.Errorf("Expected: nil as the queue should be empty; Got: %v", v)
+	}
+}
+
+func TestQueueImpl11GrowWithWrappedValuesShouldKeepOrder(t *testing.T) {
+	var q Queueimpl11
+	next, want := 0, 0
+	for i := 0; i < minCapacity; i++ {
+		q.Push(next)
+		next++
+	}
+	for i := 0; i < minCapacity/2; i++ {
+		q.Pop()
+		want++
+	}
+
+	// Wrap around the end of the slice, and then grow it.
+	for i := 0; i < minCapacity; i++ {
+		q.Push(next)
+		next++
+	}
+	if c := len(q.buf); c != 2*minCapacity {
+		t.Errorf("Expected: capacity %d; Got: %d", 2*minCapacity, c)
+	}
+	for q.Len() > 0 {
+		if v, ok := q.Pop(); !ok || v.(int) != want {
+			t.Fatalf("Expected: %d; Got: %v", want, v)
+		}
+		want++
+	}
+	if want != next {
+		t.Errorf("Expected: %d popped values; Got: %d", next, want)
+	}
+}
+
+func TestQueueImpl11CapacityShouldBePowerOfTwo(t *testing.T) {
+	var q Queueimpl11
+	for i := 0; i < 10000; i++ {
+		q.Push(i)
+		if c := len(q.buf); c&(c-1) != 0 {
+			t.Fatalf("Expected: power of two capacity; Got: %d", c)
+		}
+	}
+}
+
+func TestQueueImpl11InitShouldReleaseSlice(t *testing.T) {
+	q := New()
+	for i := 0; i < 100; i++ {
+		q.Push(i)
+	}
+	q.Init()
+	if q.buf != nil || q.Len() != 0 {
+		t.Errorf("Expected: empty queue without slice; Got: length %d, capacity %d", q.Len(), len(q.buf))
+	}
+}
+
+func TestQueueImpl11PopShouldReleasePoppedValues(t *testing.T) {
+	q := New()
+	var f queuetest.Finalizers
+	for i := 0; i < queuetest.LeakTestCount; i++ {
+		q.Push(f.NewValue(0))
+	}
+	for i := 0; i < queuetest.LeakTestCount; i++ {
+		if _, ok := q.Pop(); !ok {
+			t.Fatalf("Expected: value %d; Got: empty queue", i)
+		}
+	}
+
+	if r := f.Wait(queuetest.LeakTestCount); r != queuetest.LeakTestCount {
+		t.Errorf("Expected: %d released values; Got: %d", queuetest.LeakTestCount, r)
+	}
+	runtime.KeepAlive(q)
+}
@@ -0,0 +1,205 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package queueimpl3
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+var (
+	// lengths holds the queue lengths probed by the benchmark tests.
+	lengths = []int{0, 100, 10000}
+
+	// value holds the value pushed by the benchmark tests, boxed only once.
+	value interface{} = 1
+
+	// Used to store temp values, avoiding any compiler optimizations.
+	tmp  interface{}
+	tmp2 bool
+)
+
+// BenchmarkChurn probes a long lived queue kept at a stable length, pushing and
+// popping a value in each iteration, so its nodes are continuously exhausted by
+// Pop and needed again by Push.
+func BenchmarkChurn(b *testing.B) {
+	for _, l := range lengths {
+		b.Run(strconv.Itoa(l), func(b *testing.B) {
+			q := New()
+			for i := 0; i < l; i++ {
+				q.Push(i)
+			}
+			b.ReportAllocs()
+			b.ResetTimer()
+
+			for n := 0; n < b.N; n++ {
+				q.Push(value)
+				tmp, tmp2 = q.Pop()
+			}
+		})
+	}
+}
+
+// BenchmarkShrink probes a long lived queue that grows to a large length, and
+// then shrinks back to empty.
+func BenchmarkShrink(b *testing.B) {
+	for _, l := range lengths[1:] {
+		b.Run(strconv.Itoa(l), func(b *testing.B) {
+			q := New()
+			b.ReportAllocs()
+			b.ResetTimer()
+
+			for n := 0; n < b.N; n++ {
+				for i := 0; i < l; i++ {
+					q.Push(value)
+				}
+				for q.Len() > 0 {
+					tmp, tmp2 = q.Pop()
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkBulkPop probes popping all elements of a queue one at a time using Pop,
+// which clears each popped position, against popping them in bulk using PopN and Drain,
+// which clear the popped positions once per node, and using PopSlice, which neither copies
+// nor clears them, handing over each node instead.
+// The pushes refilling the queue are not timed, so the nodes allocated by Push to replace the
+// nodes handed over by PopSlice are not accounted for either.
+func BenchmarkBulkPop(b *testing.B) {
+	pops := []struct {
+		name string
+		pop  func(q *Queueimpl3)
+	}{
+		{
+			name: "Pop",
+			pop: func(q *Queueimpl3) {
+				for q.Len() > 0 {
+					tmp, tmp2 = q.Pop()
+				}
+			},
+		},
+		{
+			name: "PopN",
+			pop: func(q *Queueimpl3) {
+				dst := make([]interface{}, internalSliceSize)
+				for q.Len() > 0 {
+					for _, v := range dst[:q.PopN(dst)] {
+						tmp = v
+					}
+				}
+			},
+		},
+		{
+			name: "Drain",
+			pop: func(q *Queueimpl3) {
+				q.Drain(func(v interface{}) bool {
+					tmp = v
+					return true
+				})
+			},
+		},
+		{
+			name: "PopSlice",
+			pop: func(q *Queueimpl3) {
+				for vs := q.PopSlice(); vs != nil; vs = q.PopSlice() {
+					for _, v := range vs {
+						tmp = v
+					}
+				}
+			},
+		},
+	}
+	for _, p := range pops {
+		for _, l := range lengths[1:] {
+			p, l := p, l
+			b.Run(p.name+"/"+strconv.Itoa(l), func(b *testing.B) {
+				q := New()
+				b.ReportAllocs()
+				b.ResetTimer()
+
+				for n := 0; n < b.N; n++ {
+					b.StopTimer()
+					for i := 0; i < l; i++ {
+						q.Push(value)
+					}
+					b.StartTimer()
+					p.pop(q)
+				}
+			})
+		}
+	}
+}
+
+// discardResponseWriter is an http.ResponseWriter discarding the response, so it doesn't
+// allocate while handling the requests.
+type discardResponseWriter struct {
+	// h holds the response headers.
+	h http.Header
+}
+
+func (w *discardResponseWriter) Header() http.Header         { return w.h }
+func (w *discardResponseWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (w *discardResponseWriter) WriteHeader(statusCode int)  {}
+
+// BenchmarkHandler probes a simulated HTTP handler that uses a request scoped queue to
+// schedule the work of each request, pushing items values and then popping all of them to
+// write the response, with the queue allocated by New or taken from the pool by Get.
+func BenchmarkHandler(b *testing.B) {
+	queues := []struct {
+		name    string
+		get     func() *Queueimpl3
+		release func(q *Queueimpl3)
+	}{
+		{name: "New", get: New, release: func(q *Queueimpl3) {}},
+		{name: "Pool", get: Get, release: Put},
+	}
+	body := []byte("item")
+	for _, qs := range queues {
+		for _, items := range []int{10, 100, 1000} {
+			qs, items := qs, items
+			b.Run(qs.name+"/"+strconv.Itoa(items), func(b *testing.B) {
+				h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					q := qs.get()
+					for i := 0; i < items; i++ {
+						q.Push(value)
+					}
+					for q.Len() > 0 {
+						tmp, tmp2 = q.Pop()
+						w.Write(body)
+					}
+					qs.release(q)
+				})
+				w := &discardResponseWriter{h: make(http.Header)}
+				r := httptest.NewRequest(http.MethodGet, "/", nil)
+				b.ReportAllocs()
+				b.ResetTimer()
+
+				for n := 0; n < b.N; n++ {
+					h.ServeHTTP(w, r)
+				}
+			})
+		}
+	}
+}
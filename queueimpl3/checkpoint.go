@@ -0,0 +1,185 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package queueimpl3
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/christianrpetrin/queue-tests/codec"
+)
+
+// checkpointVersion holds the version of the checkpoint format written by WriteTo.
+const checkpointVersion = 1
+
+// ErrInvalidCheckpoint is returned by ReadFrom when the checkpoint is malformed.
+var ErrInvalidCheckpoint = errors.New("queueimpl3: invalid checkpoint")
+
+// SetCodec sets the codec used by WriteTo and ReadFrom to encode and decode the queue values.
+// With a nil codec, which is the default, codec.Bytes is used, so the queue values must be of type []byte.
+func (q *Queueimpl3) SetCodec(c codec.ElementCodec) {
+	q.codec = c
+}
+
+// WriteTo writes a checkpoint of all queue values to w, without removing them from the queue.
+// The checkpoint holds the format version and the number of values, followed by each value
+// encoded by the queue codec, prefixed by its length. Integers are encoded as uvarints.
+// It returns the number of bytes written.
+// The complexity is O(n), not counting the cost of the codec.
+func (q *Queueimpl3) WriteTo(w io.Writer) (int64, error) {
+	c := q.codecOrDefault()
+	bw := bufio.NewWriter(w)
+	var n int64
+	var buf [binary.MaxVarintLen64]byte
+	write := func(b []byte) error {
+		m, err := bw.Write(b)
+		n += int64(m)
+		return err
+	}
+	writeUvarint := func(x uint64) error {
+		return write(buf[:binary.PutUvarint(buf[:], x)])
+	}
+
+	if err := writeUvarint(checkpointVersion); err != nil {
+		return n, err
+	}
+	if err := writeUvarint(uint64(q.len)); err != nil {
+		return n, err
+	}
+	for node, pos := q.head, q.pos; node != nil && q.len > 0; node, pos = node.n, 0 {
+		for _, v := range node.v[pos:] {
+			b, err := c.Encode(v)
+			if err != nil {
+				return n, err
+			}
+			if err := writeUvarint(uint64(len(b))); err != nil {
+				return n, err
+			}
+			if err := write(b); err != nil {
+				return n, err
+			}
+		}
+	}
+	return n, bw.Flush()
+}
+
+// ReadFrom reads a checkpoint written by WriteTo from r and adds all its values to the queue in order.
+// If an error occurs, no value is added to the queue.
+// If r doesn't implement io.ByteReader, ReadFrom may read past the end of the checkpoint.
+// It returns the number of bytes of the checkpoint read.
+// The complexity is O(n), not counting the cost of the codec.
+func (q *Queueimpl3) ReadFrom(r io.Reader) (int64, error) {
+	br, ok := r.(io.ByteReader)
+	if !ok {
+		b := bufio.NewReader(r)
+		br, r = b, b
+	}
+	cr := &countingReader{r: r, br: br}
+	c := q.codecOrDefault()
+
+	version, err := binary.ReadUvarint(cr)
+	if err != nil {
+		return cr.n, checkpointError(err)
+	}
+	if version != checkpointVersion {
+		return cr.n, fmt.Errorf("queueimpl3: unsupported checkpoint version %d", version)
+	}
+	count, err := binary.ReadUvarint(cr)
+	if err != nil {
+		return cr.n, checkpointError(err)
+	}
+
+	var vs []interface{}
+	var b bytes.Buffer
+	for i := uint64(0); i < count; i++ {
+		l, err := binary.ReadUvarint(cr)
+		if err != nil {
+			return cr.n, checkpointError(err)
+		}
+		// Let the buffer grow as the value is read, so a corrupted length
+		// doesn't cause a huge allocation.
+		b.Reset()
+		if m, err := io.CopyN(&b, cr, int64(l)); err != nil || uint64(m) != l {
+			if err == nil || err == io.EOF {
+				err = ErrInvalidCheckpoint
+			}
+			return cr.n, err
+		}
+		v, err := c.Decode(b.Bytes())
+		if err != nil {
+			return cr.n, err
+		}
+		vs = append(vs, v)
+	}
+
+	for _, v := range vs {
+		q.Push(v)
+	}
+	return cr.n, nil
+}
+
+// codecOrDefault returns the queue codec, or codec.Bytes if no codec was set.
+func (q *Queueimpl3) codecOrDefault() codec.ElementCodec {
+	if q.codec != nil {
+		return q.codec
+	}
+	return codec.Bytes
+}
+
+// checkpointError returns ErrInvalidCheckpoint if err reports a truncated checkpoint; err otherwise.
+func checkpointError(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return ErrInvalidCheckpoint
+	}
+	return err
+}
+
+// countingReader counts the bytes read from a reader.
+type countingReader struct {
+	// r holds the underlying reader.
+	r io.Reader
+
+	// br holds the underlying reader as a byte reader.
+	br io.ByteReader
+
+	// n holds the number of bytes read so far.
+	n int64
+}
+
+// Read reads from the underlying reader.
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+// ReadByte reads a single byte from the underlying reader.
+func (r *countingReader) ReadByte() (byte, error) {
+	c, err := r.br.ReadByte()
+	if err == nil {
+		r.n++
+	}
+	return c, err
+}
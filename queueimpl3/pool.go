@@ -0,0 +1,77 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package queueimpl3
+
+import (
+	"sync"
+
+	"github.com/christianrpetrin/queue-tests/invariant"
+)
+
+// pool holds the queues returned by Put, ready to be handed out again by Get.
+var pool = sync.Pool{
+	New: func() interface{} { return New() },
+}
+
+// Get returns an empty queue from a package-level pool, or a new queue if the pool is empty.
+// It is meant for transient, e.g. request scoped, queues: returning them to the pool using Put
+// once no longer needed lets later Get calls reuse both the queue and its first node, so
+// short lived queues holding up to 128 values don't allocate at all.
+// Get and Put are safe for concurrent use by multiple goroutines, while the returned queue,
+// as any other queue, is not.
+func Get() *Queueimpl3 {
+	return pool.Get().(*Queueimpl3)
+}
+
+// Put clears queue q and returns it to the package-level pool used by Get.
+// The queue codec is cleared, and a single node is kept for reuse; all other nodes are released.
+// Q must not be used after calling Put.
+// The complexity is O(n/128), as each node is cleared in a single operation.
+func Put(q *Queueimpl3) {
+	q.reset()
+	pool.Put(q)
+}
+
+// reset clears queue q, keeping a single empty node (the head node, or else the spare one)
+// as the spare node, so the next Push doesn't need to allocate it.
+func (q *Queueimpl3) reset() {
+	keep := q.head
+	if keep == nil {
+		keep = q.spare
+	}
+	for n := q.head; n != nil; {
+		next := n.n
+		clearValues(n.v)
+		n.n = nil // Avoid memory leaks
+		n.p = nil // Avoid memory leaks
+		n = next
+	}
+
+	q.Init()
+	q.codec = nil
+	if keep != nil {
+		keep.v = keep.v[:0]
+		q.spare = keep
+	}
+	if invariant.Enabled {
+		q.checkInvariants("reset")
+	}
+}
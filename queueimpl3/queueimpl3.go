@@ -22,23 +22,31 @@
 // Internally, queue store the values in fixed sized slices that are linked using a singly linked list.
 // This implementation tests the queue performance when controlling the length and current positions in
 // the slices using the builtin len and append functions.
+// The last node discarded by Pop is kept as a spare and recycled by the next Push needing a
+// new node, so a queue whose length is stable doesn't allocate in steady state, while a
+// shrinking queue keeps at most one discarded node alive.
 package queueimpl3
 
+import (
+	"github.com/christianrpetrin/queue-tests/codec"
+	"github.com/christianrpetrin/queue-tests/invariant"
+	"github.com/christianrpetrin/queue-tests/queueerr"
+)
+
 const (
 	// internalSliceSize holds the size of each internal slice.
 	internalSliceSize = 128
-
-	// internalSliceLastPosition holds the last position of the internal slice.
-	internalSliceLastPosition = 127
 )
 
 // Queueimpl3 represents an unbounded, dynamically growing FIFO queue.
+// The zero value for queue is an empty queue ready to use.
 type Queueimpl3 struct {
 	// Head points to the first node of the linked list.
 	head *Node
 
 	// Tail points to the last node of the linked list.
-	// In an empty queue, head and tail points to the same node.
+	// In an empty queue, head and tail points to the same node,
+	// or are both nil if no value was ever added to the queue.
 	tail *Node
 
 	// Pos is the index pointing to the current first element in the queue
@@ -47,6 +55,13 @@ type Queueimpl3 struct {
 
 	// Len holds the current queue length.
 	len int
+
+	// spare holds an empty node discarded by Pop, recycled by the next Push needing a new
+	// node; or nil if there is none.
+	spare *Node
+
+	// codec encodes and decodes the values written by WriteTo and read by ReadFrom.
+	codec codec.ElementCodec
 }
 
 // Node represents a queue node.
@@ -57,6 +72,10 @@ type Node struct {
 
 	// n points to the next node in the linked list.
 	n *Node
+
+	// p points to the previous node in the linked list, so the queue
+	// can be traversed from the tail.
+	p *Node
 }
 
 // New returns an initialized queue.
@@ -65,12 +84,17 @@ func New() *Queueimpl3 {
 }
 
 // Init initializes or clears queue q.
+// The queue codec is preserved.
+// The first node is only allocated when the first value is added to the queue.
 func (q *Queueimpl3) Init() *Queueimpl3 {
-	n := newNode()
-	q.head = n
-	q.tail = n
+	q.head = nil
+	q.tail = nil
 	q.pos = 0
 	q.len = 0
+	q.spare = nil
+	if invariant.Enabled {
+		q.checkInvariants("Init")
+	}
 	return q
 }
 
@@ -93,14 +117,22 @@ func (q *Queueimpl3) Front() (interface{}, bool) {
 // Push adds a value to the queue.
 // The complexity is O(1) as the underlying slice append uses always have enough capacity.
 func (q *Queueimpl3) Push(v interface{}) {
-	if len(q.tail.v) >= internalSliceSize {
-		n := newNode()
-		q.tail.n = n
+	if q.head == nil || len(q.tail.v) >= internalSliceSize {
+		n := q.allocNode()
+		if q.head == nil {
+			q.head = n
+		} else {
+			n.p = q.tail
+			q.tail.n = n
+		}
 		q.tail = n
 	}
 
 	q.tail.v = append(q.tail.v, v)
 	q.len++
+	if invariant.Enabled {
+		q.checkInvariants("Push")
+	}
 }
 
 // Pop retrieves and removes the next element from the queue.
@@ -115,18 +147,389 @@ func (q *Queueimpl3) Pop() (interface{}, bool) {
 	q.head.v[q.pos] = nil // Avoid memory leaks
 	q.len--
 
-	if q.pos >= internalSliceLastPosition {
-		n := q.head.n
-		q.head.n = nil // Avoid memory leaks
-		q.head = n
+	// Nodes are usually full, except for the tail node and for nodes spliced by Append.
+	if q.pos >= len(q.head.v)-1 {
+		if q.head.n == nil {
+			// The head node is also the tail node and all its values were popped, so reuse it.
+			q.head.v = q.head.v[:0]
+		} else {
+			h := q.head
+			q.head = h.n
+			q.head.p = nil
+			q.freeNode(h)
+		}
 		q.pos = 0
 	} else {
 		q.pos++
 	}
+	if invariant.Enabled {
+		q.checkInvariants("Pop")
+	}
 
 	return v, true
 }
 
+// PopE retrieves and removes the next element from the queue.
+// It is the same as Pop, but returns queueerr.ErrEmpty if the queue is empty.
+// The complexity is O(1).
+func (q *Queueimpl3) PopE() (interface{}, error) {
+	if v, ok := q.Pop(); ok {
+		return v, nil
+	}
+	return nil, queueerr.ErrEmpty
+}
+
+// PopIf retrieves and removes the next element from the queue only if it satisfies pred.
+// The second, bool result indicates whether a value was removed;
+//   if the queue is empty or the next element doesn't satisfy pred, false will be returned.
+// The complexity is O(1), not counting the cost of pred.
+func (q *Queueimpl3) PopIf(pred func(v interface{}) bool) (interface{}, bool) {
+	if q.len == 0 || !pred(q.head.v[q.pos]) {
+		return nil, false
+	}
+
+	return q.Pop()
+}
+
+// PopBack retrieves and removes the last element from the queue (i.e. the most recently added one).
+// The second, bool result indicates whether a valid value was returned;
+//   if the queue is empty, false will be returned.
+// The complexity is O(1).
+func (q *Queueimpl3) PopBack() (interface{}, bool) {
+	if q.len == 0 {
+		return nil, false
+	}
+
+	t := q.tail
+	last := len(t.v) - 1
+	v := t.v[last]
+	t.v[last] = nil // Avoid memory leaks
+	t.v = t.v[:last]
+	q.len--
+
+	if q.len == 0 {
+		// The tail node is also the head node, so reuse it.
+		t.v = t.v[:0]
+		q.pos = 0
+	} else if len(t.v) == 0 {
+		q.tail = t.p
+		q.tail.n = nil // Avoid memory leaks
+		t.p = nil      // Avoid memory leaks
+	}
+	if invariant.Enabled {
+		q.checkInvariants("PopBack")
+	}
+
+	return v, true
+}
+
+// RangeBack calls f with each element of queue q, from the last to the first one,
+// until f returns false.
+// The queue is not modified; f must not modify it either.
+// The complexity is O(n), not counting the cost of f.
+func (q *Queueimpl3) RangeBack(f func(v interface{}) bool) {
+	if q.len == 0 {
+		return
+	}
+
+	for n := q.tail; n != nil; n = n.p {
+		first := 0
+		if n == q.head {
+			first = q.pos
+		}
+		for i := len(n.v) - 1; i >= first; i-- {
+			if !f(n.v[i]) {
+				return
+			}
+		}
+	}
+}
+
+// DrainBack removes the elements of queue q from the last to the first one, calling f
+// with each removed element, until f returns false or the queue is empty.
+// The element for which f returns false is removed as well.
+// F must not modify the queue.
+// The complexity is O(n), where n is the number of removed elements, not counting the cost of f.
+func (q *Queueimpl3) DrainBack(f func(v interface{}) bool) {
+	for {
+		v, ok := q.PopBack()
+		if !ok || !f(v) {
+			return
+		}
+	}
+}
+
+// PopN retrieves and removes up to len(dst) elements from the queue, storing them in dst in order.
+// It returns the number of elements stored in dst, which is smaller than len(dst) only if the
+// queue holds fewer elements.
+// The popped positions are cleared once per node instead of once per element, so popping
+// elements in bulk is cheaper than calling Pop repeatedly.
+// The complexity is O(n), where n is the number of popped elements.
+func (q *Queueimpl3) PopN(dst []interface{}) int {
+	n := 0
+	for n < len(dst) && q.len > 0 {
+		vs := q.head.v[q.pos:]
+		c := copy(dst[n:], vs)
+		clearValues(vs[:c])
+		n += c
+		q.len -= c
+		q.advance(c)
+	}
+	if invariant.Enabled {
+		q.checkInvariants("PopN")
+	}
+	return n
+}
+
+// PopSlice retrieves and removes the elements of the first node of the queue, returning them
+// in order without copying them; or nil if the queue is empty. The returned slice holds up to
+// 128 elements, as nodes do: fewer for the last node and for nodes spliced by Append, or if
+// elements were already popped from the first node.
+// Ownership of the returned slice, including its backing array, is transferred to the caller:
+// the node holding the elements is unlinked from the queue and never recycled, so the queue
+// never reads or writes its backing array again, and the caller can keep, modify, append to
+// or reuse the slice. The elements are not cleared by the queue, so they are kept alive for
+// as long as the caller keeps the slice.
+// As the node is not recycled, Push allocates a new node to replace each node removed by
+// PopSlice, while nodes emptied by Pop, PopN or Drain are recycled as the spare node.
+// The complexity is O(1).
+func (q *Queueimpl3) PopSlice() []interface{} {
+	if q.len == 0 {
+		return nil
+	}
+
+	h := q.head
+	vs := h.v[q.pos:]
+	q.len -= len(vs)
+	q.pos = 0
+	if h.n == nil {
+		// The head node is also the tail node, so unlink it from Push as well.
+		q.head = nil
+		q.tail = nil
+	} else {
+		q.head = h.n
+		q.head.p = nil
+	}
+	h.v = nil // The backing array is owned by the caller
+	h.n = nil // Avoid memory leaks
+	if invariant.Enabled {
+		q.checkInvariants("PopSlice")
+	}
+	return vs
+}
+
+// Drain removes the elements of queue q from the first to the last one, calling f
+// with each removed element, until f returns false or the queue is empty.
+// The element for which f returns false is removed as well.
+// As with PopN, the removed positions are cleared once per node.
+// F must not call any queue q method, as the queue is only updated once per node.
+// The complexity is O(n), where n is the number of removed elements, not counting the cost of f.
+func (q *Queueimpl3) Drain(f func(v interface{}) bool) {
+	for q.len > 0 {
+		vs := q.head.v[q.pos:]
+		i, more := 0, true
+		for i < len(vs) && more {
+			more = f(vs[i])
+			i++
+		}
+		clearValues(vs[:i])
+		q.len -= i
+		q.advance(i)
+		if !more {
+			break
+		}
+	}
+	if invariant.Enabled {
+		q.checkInvariants("Drain")
+	}
+}
+
+// advance moves the first position past the first c elements of the head node, which
+// were removed and cleared already, discarding the head node if all its elements were removed.
+func (q *Queueimpl3) advance(c int) {
+	q.pos += c
+	if q.pos < len(q.head.v) {
+		return
+	}
+
+	if q.head.n == nil {
+		// The head node is also the tail node and all its values were popped, so reuse it.
+		q.head.v = q.head.v[:0]
+	} else {
+		h := q.head
+		q.head = h.n
+		q.head.p = nil
+		q.freeNode(h)
+	}
+	q.pos = 0
+}
+
+// Append moves all elements of queue other to the back of queue q, in order, leaving other empty.
+// The nodes of other are linked to the nodes of q instead of being copied, so
+// the complexity is O(1), regardless of the number of elements of other.
+func (q *Queueimpl3) Append(other *Queueimpl3) {
+	if other == q || other.len == 0 {
+		return
+	}
+
+	// Only the head node may have popped positions, so move the first node
+	// values of other to the front of its slice, copying up to a single node.
+	h := other.head
+	if other.pos > 0 {
+		n := copy(h.v, h.v[other.pos:])
+		for i := n; i < len(h.v); i++ {
+			h.v[i] = nil // Avoid memory leaks
+		}
+		h.v = h.v[:n]
+	}
+
+	if q.len == 0 {
+		q.head = h
+		q.pos = 0
+	} else {
+		q.tail.n = h
+		h.p = q.tail
+	}
+	q.tail = other.tail
+	q.len += other.len
+	other.Init()
+	if invariant.Enabled {
+		q.checkInvariants("Append")
+	}
+}
+
+// SplitAt removes the first n elements of queue q and returns them, in order, in a new queue.
+// If n is larger than the queue length, all elements are removed; if n is 0 or less, the
+// returned queue is empty. The returned queue uses the same codec as q.
+// The nodes holding the removed elements are moved to the new queue instead of being copied,
+// except for the node holding both removed and remaining elements, if any, whose removed
+// elements are copied, so the complexity is O(n/128) rather than O(n).
+func (q *Queueimpl3) SplitAt(n int) *Queueimpl3 {
+	r := &Queueimpl3{codec: q.codec}
+	if n <= 0 || q.len == 0 {
+		return r
+	}
+	if n >= q.len {
+		r.head, r.tail, r.pos, r.len = q.head, q.tail, q.pos, q.len
+		q.head, q.tail, q.pos, q.len = nil, nil, 0, 0
+		return r
+	}
+
+	// Find the node holding the first remaining element.
+	var prev *Node
+	node, start, remaining := q.head, q.pos, n
+	for remaining >= len(node.v)-start {
+		remaining -= len(node.v) - start
+		prev, node, start = node, node.n, 0
+	}
+
+	if prev != nil {
+		// Move the nodes before the boundary node.
+		r.head, r.tail, r.pos = q.head, prev, q.pos
+		prev.n = nil
+		node.p = nil
+	}
+	if remaining > 0 {
+		// Copy the removed elements of the boundary node.
+		c := newNode()
+		c.v = append(c.v, node.v[start:start+remaining]...)
+		for i := start; i < start+remaining; i++ {
+			node.v[i] = nil // Avoid memory leaks
+		}
+		if r.tail == nil {
+			r.head = c
+		} else {
+			r.tail.n = c
+			c.p = r.tail
+		}
+		r.tail = c
+	}
+
+	q.head, q.pos = node, start+remaining
+	r.len = n
+	q.len -= n
+	if invariant.Enabled {
+		q.checkInvariants("SplitAt")
+		r.checkInvariants("SplitAt")
+	}
+	return r
+}
+
+// Merge adds all elements of queue other to the back of queue q, in order,
+// leaving other unchanged.
+// The complexity is O(n), where n is the number of elements of other.
+func (q *Queueimpl3) Merge(other *Queueimpl3) {
+	// Count the values, as other may be q itself.
+	count := other.len
+	for n, pos := other.head, other.pos; n != nil && count > 0; n, pos = n.n, 0 {
+		for _, v := range n.v[pos:] {
+			if count == 0 {
+				break
+			}
+			q.Push(v)
+			count--
+		}
+	}
+}
+
+// Contains returns whether queue q holds a value equal to v.
+// Values are compared using ==, so Contains panics if it compares v with a value of the
+// same, non-comparable type (e.g. a slice), the same way as comparing them directly would.
+// The queue is not modified.
+// The complexity is O(n).
+func (q *Queueimpl3) Contains(v interface{}) bool {
+	_, ok := q.FindFunc(func(e interface{}) bool { return e == v })
+	return ok
+}
+
+// FindFunc returns the index, counting from the first element, of the first element
+// of queue q that satisfies pred.
+// The second, bool result indicates whether an element satisfying pred was found;
+//   if no element satisfies pred, false will be returned.
+// The queue is not modified; pred must not modify it either.
+// The complexity is O(n), not counting the cost of pred.
+func (q *Queueimpl3) FindFunc(pred func(v interface{}) bool) (int, bool) {
+	if q.len == 0 {
+		return 0, false
+	}
+
+	i := 0
+	for n, pos := q.head, q.pos; n != nil; n, pos = n.n, 0 {
+		for _, v := range n.v[pos:] {
+			if pred(v) {
+				return i, true
+			}
+			i++
+		}
+	}
+	return 0, false
+}
+
+// allocNode returns the spare node, if any, or a new node otherwise.
+func (q *Queueimpl3) allocNode() *Node {
+	if n := q.spare; n != nil {
+		q.spare = nil
+		return n
+	}
+	return newNode()
+}
+
+// freeNode keeps node n, whose values were all popped and cleared, as the spare node.
+func (q *Queueimpl3) freeNode(n *Node) {
+	n.n = nil // Avoid memory leaks
+	n.v = n.v[:0]
+	q.spare = n
+}
+
+// clearValues clears all values in vs, avoiding memory leaks.
+// The loop is compiled to a single memory clear, which is cheaper than clearing the values
+// one at a time as they are popped.
+func clearValues(vs []interface{}) {
+	for i := range vs {
+		vs[i] = nil
+	}
+}
+
 // newNode returns an initialized node.
 func newNode() *Node {
 	return &Node{
@@ -21,7 +21,14 @@
 package queueimpl3
 
 import (
+	"bytes"
+	"io/ioutil"
+	"runtime"
+	"strconv"
 	"testing"
+
+	"github.com/christianrpetrin/queue-tests/queueerr"
+	"github.com/christianrpetrin/queue-tests/queuetest"
 )
 
 func TestQueueImpl3NewQueueShouldReturnInitiazedInstanceOfQueue(t *testing.T) {
@@ -32,6 +39,54 @@ func TestQueueImpl3NewQueueShouldReturnInitiazedInstanceOfQueue(t *testing.T) {
 	}
 }
 
+func TestQueueImpl3WithZeroValueShouldReturnReadyToUseQueue(t *testing.T) {
+	var q Queueimpl3
+	q.Push(1)
+	q.Push(2)
+
+	v, ok := q.Pop()
+	if !ok || v.(int) != 1 {
+		t.Errorf("Expected: 1; Got: %d", v)
+	}
+	v, ok = q.Pop()
+	if !ok || v.(int) != 2 {
+		t.Errorf("Expected: 1; Got: %d", v)
+	}
+	_, ok = q.Pop()
+	if ok {
+		t.Error("Expected: empty slice (ok=false); Got: ok=true")
+	}
+}
+
+func TestQueueImpl3WithZeroValueAndEmptyShouldReturnAsEmpty(t *testing.T) {
+	var q Queueimpl3
+	if _, ok := q.Front(); ok {
+		t.Error("Expected: false as the queue is empty; Got: true")
+	}
+	if _, ok := q.Pop(); ok {
+		t.Error("Expected: false as the queue is empty; Got: true")
+	}
+	if _, ok := q.PopIf(func(v interface{}) bool { return true }); ok {
+		t.Error("Expected: false as the queue is empty; Got: true")
+	}
+	if l := q.Len(); l != 0 {
+		t.Errorf("Expected: 0 as the queue is empty; Got: %d", l)
+	}
+}
+
+func TestQueueImpl3InitShouldNotAllocateNodes(t *testing.T) {
+	q := New()
+	q.Push(1)
+	q.Init()
+
+	if q.head != nil || q.tail != nil {
+		t.Error("Expected: no nodes allocated; Got: allocated nodes")
+	}
+	if l := q.Len(); l != 0 {
+		t.Errorf("Expected: 0 as the queue is empty; Got: %d", l)
+	}
+}
+
 func TestQueueImpl3WithNilValuesShouldReturnAllValuesInOrder(t *testing.T) {
 	q := New()
 	q.Push(1)
@@ -173,3 +228,823 @@ func TestQueueImpl3PutGetFrontShouldRetrieveAllElementsInOrder(t *testing.T) {
 		})
 	}
 }
+
+func TestQueueImpl3PushPopWithFullNodeShouldRetrieveAllElementsInOrder(t *testing.T) {
+	q := New()
+	for i := 0; i < internalSliceSize; i++ {
+		q.Push(i)
+	}
+	for i := 0; i < internalSliceSize; i++ {
+		if v, ok := q.Pop(); !ok || v.(int) != i {
+			t.Errorf("Expected: %d; Got: %d", i, v)
+		}
+	}
+
+	q.Push(1)
+	if v, ok := q.Front(); !ok || v.(int) != 1 {
+		t.Errorf("Expected: 1; Got: %d", v)
+	}
+	if v, ok := q.Pop(); !ok || v.(int) != 1 {
+		t.Errorf("Expected: 1; Got: %d", v)
+	}
+	if q.Len() != 0 {
+		t.Errorf("Expected: %d; Got: %d", 0, q.Len())
+	}
+}
+
+func TestQueueImpl3PopIfShouldOnlyRemoveElementsSatisfyingPredicate(t *testing.T) {
+	q := New()
+	for i := 1; i <= 300; i++ {
+		q.Push(i)
+	}
+
+	lessOrEqual150 := func(v interface{}) bool { return v.(int) <= 150 }
+	for i := 1; i <= 150; i++ {
+		v, ok := q.PopIf(lessOrEqual150)
+		if !ok || v.(int) != i {
+			t.Errorf("Expected: %d; Got: %d", i, v)
+		}
+	}
+	if v, ok := q.PopIf(lessOrEqual150); ok || v != nil {
+		t.Errorf("Expected: nil as the next element doesn't satisfy the predicate; Got: %d", v)
+	}
+	if q.Len() != 150 {
+		t.Errorf("Expected: %d; Got: %d", 150, q.Len())
+	}
+	if v, ok := q.Front(); !ok || v.(int) != 151 {
+		t.Errorf("Expected: %d; Got: %d", 151, v)
+	}
+}
+
+func TestQueueImpl3PopIfWithEmptyQueueShouldNotCallPredicate(t *testing.T) {
+	q := New()
+	called := false
+	if v, ok := q.PopIf(func(v interface{}) bool { called = true; return true }); ok || v != nil {
+		t.Errorf("Expected: nil as the queue is empty; Got: %d", v)
+	}
+	if called {
+		t.Error("Expected: predicate not called as the queue is empty; Got: called")
+	}
+}
+
+func TestQueueImpl3PopShouldReleasePoppedValues(t *testing.T) {
+	q := New()
+	var f queuetest.Finalizers
+	for i := 0; i < queuetest.LeakTestCount; i++ {
+		q.Push(f.NewValue(0))
+	}
+	for i := 0; i < queuetest.LeakTestCount; i++ {
+		if _, ok := q.Pop(); !ok {
+			t.Fatalf("Expected: value %d; Got: empty queue", i)
+		}
+	}
+
+	if r := f.Wait(queuetest.LeakTestCount); r != queuetest.LeakTestCount {
+		t.Errorf("Expected: %d released values; Got: %d", queuetest.LeakTestCount, r)
+	}
+	runtime.KeepAlive(q)
+}
+
+func TestQueueImpl3PopShouldReleaseDiscardedNodes(t *testing.T) {
+	q := New()
+	for i := 0; i < queuetest.LeakTestCount; i++ {
+		q.Push(i)
+	}
+	var f queuetest.Finalizers
+	var nodes int32
+	for n := q.head; n != nil; n = n.n {
+		f.Track(n)
+		nodes++
+	}
+	for i := 0; i < queuetest.LeakTestCount; i++ {
+		if _, ok := q.Pop(); !ok {
+			t.Fatalf("Expected: value %d; Got: empty queue", i)
+		}
+	}
+
+	// All nodes but the current head node and the spare node should have been discarded.
+	if r := f.Wait(nodes - 2); r != nodes-2 {
+		t.Errorf("Expected: %d released nodes; Got: %d", nodes-2, r)
+	}
+	runtime.KeepAlive(q)
+}
+
+// stringCodec encodes string values, counting the encoded values.
+type stringCodec struct {
+	encoded int
+}
+
+func (c *stringCodec) Encode(v interface{}) ([]byte, error) {
+	c.encoded++
+	return []byte(v.(string)), nil
+}
+
+func (c *stringCodec) Decode(b []byte) (interface{}, error) {
+	return string(b), nil
+}
+
+func TestQueueImpl3WriteToReadFromShouldRestoreAllElementsInOrder(t *testing.T) {
+	q := New()
+	c := &stringCodec{}
+	q.SetCodec(c)
+	for i := 0; i < 1000; i++ {
+		q.Push(strconv.Itoa(i))
+	}
+	for i := 0; i < 200; i++ {
+		q.Pop()
+	}
+
+	var b bytes.Buffer
+	n, err := q.WriteTo(&b)
+	if err != nil || n != int64(b.Len()) {
+		t.Fatalf("Expected: %d bytes written; Got: %d, %v", b.Len(), n, err)
+	}
+	if q.Len() != 800 || c.encoded != 800 {
+		t.Errorf("Expected: %d; Got: %d values and %d encoded", 800, q.Len(), c.encoded)
+	}
+
+	r := New()
+	r.SetCodec(c)
+	size := int64(b.Len())
+	if n, err := r.ReadFrom(&b); err != nil || n != size {
+		t.Fatalf("Expected: %d bytes read; Got: %d, %v", size, n, err)
+	}
+	if r.Len() != 800 {
+		t.Errorf("Expected: %d; Got: %d", 800, r.Len())
+	}
+	for i := 200; i < 1000; i++ {
+		if v, ok := r.Pop(); !ok || v.(string) != strconv.Itoa(i) {
+			t.Errorf("Expected: %d; Got: %v", i, v)
+		}
+	}
+}
+
+func TestQueueImpl3WriteToReadFromWithoutCodecShouldRestoreByteValues(t *testing.T) {
+	var q Queueimpl3
+	var b bytes.Buffer
+	if _, err := q.WriteTo(&b); err != nil {
+		t.Fatalf("Expected: no error; Got: %v", err)
+	}
+	q.Push([]byte("a"))
+	q.Push([]byte{})
+	if _, err := q.WriteTo(&b); err != nil {
+		t.Fatalf("Expected: no error; Got: %v", err)
+	}
+
+	// Two consecutive checkpoints, the first one empty.
+	var r Queueimpl3
+	for i := 0; i < 2; i++ {
+		if _, err := r.ReadFrom(&b); err != nil {
+			t.Fatalf("Expected: no error; Got: %v", err)
+		}
+	}
+	if v, ok := r.Pop(); !ok || string(v.([]byte)) != "a" {
+		t.Errorf("Expected: a; Got: %v", v)
+	}
+	if v, ok := r.Pop(); !ok || len(v.([]byte)) != 0 {
+		t.Errorf("Expected: empty value; Got: %v", v)
+	}
+	if r.Len() != 0 {
+		t.Errorf("Expected: %d; Got: %d", 0, r.Len())
+	}
+}
+
+func TestQueueImpl3WriteToWithoutCodecAndInvalidValueShouldFail(t *testing.T) {
+	q := New()
+	q.Push(1)
+
+	if _, err := q.WriteTo(ioutil.Discard); err == nil {
+		t.Error("Expected: error; Got: nil")
+	}
+}
+
+func TestQueueImpl3ReadFromWithTruncatedCheckpointShouldNotChangeQueue(t *testing.T) {
+	q := New()
+	for i := 0; i < 10; i++ {
+		q.Push([]byte(strconv.Itoa(i)))
+	}
+	var b bytes.Buffer
+	q.WriteTo(&b)
+
+	for l := 0; l < b.Len(); l++ {
+		r := New()
+		r.Push([]byte("x"))
+		if _, err := r.ReadFrom(bytes.NewReader(b.Bytes()[:l])); err != ErrInvalidCheckpoint {
+			t.Errorf("Expected: %v; Got: %v", ErrInvalidCheckpoint, err)
+		}
+		if r.Len() != 1 {
+			t.Errorf("Expected: %d; Got: %d", 1, r.Len())
+		}
+	}
+}
+
+func TestQueueImpl3ContainsShouldFindOnlyQueuedValues(t *testing.T) {
+	var q Queueimpl3
+	if q.Contains(1) {
+		t.Error("Expected: false as the queue is empty; Got: true")
+	}
+
+	for i := 0; i < 300; i++ {
+		q.Push(i)
+	}
+	for i := 0; i < 10; i++ {
+		q.Pop()
+	}
+	for _, v := range []int{10, 127, 128, 299} {
+		if !q.Contains(v) {
+			t.Errorf("Expected: %d to be found; Got: not found", v)
+		}
+	}
+	for _, v := range []interface{}{9, 300, "10"} {
+		if q.Contains(v) {
+			t.Errorf("Expected: %v not to be found; Got: found", v)
+		}
+	}
+	if q.Len() != 290 {
+		t.Errorf("Expected: %d; Got: %d", 290, q.Len())
+	}
+}
+
+func TestQueueImpl3FindFuncShouldReturnIndexOfFirstMatchingElement(t *testing.T) {
+	q := New()
+	for i := 0; i < 300; i++ {
+		q.Push(i)
+	}
+	q.Pop()
+
+	if i, ok := q.FindFunc(func(v interface{}) bool { return v.(int) >= 200 }); !ok || i != 199 {
+		t.Errorf("Expected: %d; Got: %d", 199, i)
+	}
+	if i, ok := q.FindFunc(func(v interface{}) bool { return v.(int) < 0 }); ok {
+		t.Errorf("Expected: not found; Got: %d", i)
+	}
+	if v, _ := q.Front(); v.(int) != 1 {
+		t.Errorf("Expected: %d; Got: %d", 1, v)
+	}
+}
+
+func TestQueueImpl3RangeBackShouldVisitAllElementsInReverseOrder(t *testing.T) {
+	q := New()
+	q.RangeBack(func(v interface{}) bool {
+		t.Errorf("Expected: no element as the queue is empty; Got: %v", v)
+		return true
+	})
+
+	for i := 0; i < 300; i++ {
+		q.Push(i)
+	}
+	for i := 0; i < 10; i++ {
+		q.Pop()
+	}
+
+	expected := 299
+	q.RangeBack(func(v interface{}) bool {
+		if v.(int) != expected {
+			t.Errorf("Expected: %d; Got: %d", expected, v)
+		}
+		expected--
+		return true
+	})
+	if expected != 9 {
+		t.Errorf("Expected: %d; Got: %d", 9, expected)
+	}
+
+	visited := 0
+	q.RangeBack(func(v interface{}) bool {
+		visited++
+		return visited < 5
+	})
+	if visited != 5 || q.Len() != 290 {
+		t.Errorf("Expected: 5 visited and 290 queued; Got: %d and %d", visited, q.Len())
+	}
+}
+
+func TestQueueImpl3DrainBackShouldRemoveElementsInReverseOrder(t *testing.T) {
+	q := New()
+	for i := 0; i < 300; i++ {
+		q.Push(i)
+	}
+	q.Pop()
+
+	expected := 299
+	q.DrainBack(func(v interface{}) bool {
+		if v.(int) != expected {
+			t.Errorf("Expected: %d; Got: %d", expected, v)
+		}
+		expected--
+		return v.(int) > 100
+	})
+	// 100 is removed as well, as it is the value f returned false for.
+	if q.Len() != 99 {
+		t.Errorf("Expected: %d; Got: %d", 99, q.Len())
+	}
+
+	// The remaining elements are still retrieved in order, including after new pushes.
+	q.Push(1000)
+	for i := 1; i < 100; i++ {
+		if v, ok := q.Pop(); !ok || v.(int) != i {
+			t.Errorf("Expected: %d; Got: %d", i, v)
+		}
+	}
+	if v, ok := q.Pop(); !ok || v.(int) != 1000 {
+		t.Errorf("Expected: %d; Got: %d", 1000, v)
+	}
+
+	q.DrainBack(func(v interface{}) bool {
+		t.Errorf("Expected: no element as the queue is empty; Got: %v", v)
+		return true
+	})
+}
+
+func TestQueueImpl3PopBackShouldEmptyQueue(t *testing.T) {
+	var q Queueimpl3
+	if _, ok := q.PopBack(); ok {
+		t.Error("Expected: false as the queue is empty; Got: true")
+	}
+
+	for r := 0; r < 2; r++ {
+		for i := 0; i < 200; i++ {
+			q.Push(i)
+		}
+		for i := 199; i >= 0; i-- {
+			if v, ok := q.PopBack(); !ok || v.(int) != i {
+				t.Errorf("Expected: %d; Got: %d", i, v)
+			}
+		}
+		if q.Len() != 0 || q.head != q.tail {
+			t.Errorf("Expected: empty queue with a single node; Got: len %d", q.Len())
+		}
+	}
+}
+
+// pushRange pushes the values from first to last, inclusive, to queue q.
+func pushRange(q *Queueimpl3, first, last int) {
+	for i := first; i <= last; i++ {
+		q.Push(i)
+	}
+}
+
+// expectRange pops all values of queue q, checking they are the values from first to last, inclusive.
+func expectRange(t *testing.T, q *Queueimpl3, first, last int) {
+	if q.Len() != last-first+1 {
+		t.Errorf("Expected: %d; Got: %d", last-first+1, q.Len())
+	}
+	for i := first; i <= last; i++ {
+		if v, ok := q.Pop(); !ok || v.(int) != i {
+			t.Fatalf("Expected: %d; Got: %v", i, v)
+		}
+	}
+	if v, ok := q.Pop(); ok {
+		t.Errorf("Expected: empty queue; Got: %v", v)
+	}
+}
+
+func TestQueueImpl3AppendShouldMoveAllElementsInOrder(t *testing.T) {
+	q := New()
+	pushRange(q, 0, 199)
+	q.Pop()
+	other := New()
+	pushRange(other, 190, 499)
+	for i := 0; i < 10; i++ {
+		other.Pop()
+	}
+
+	q.Append(other)
+	if other.Len() != 0 {
+		t.Errorf("Expected: %d; Got: %d", 0, other.Len())
+	}
+	if _, ok := other.Pop(); ok {
+		t.Error("Expected: empty queue; Got: non-empty")
+	}
+
+	// Values can still be added to both queues.
+	q.Push(500)
+	other.Push(0)
+	expectRange(t, q, 1, 500)
+	expectRange(t, other, 0, 0)
+}
+
+func TestQueueImpl3AppendShouldSupportAllQueueOperations(t *testing.T) {
+	q := New()
+	for r := 0; r < 10; r++ {
+		other := New()
+		pushRange(other, r*50, r*50+49)
+		q.Append(other)
+	}
+
+	expected := 499
+	q.RangeBack(func(v interface{}) bool {
+		if v.(int) != expected {
+			t.Errorf("Expected: %d; Got: %d", expected, v)
+		}
+		expected--
+		return true
+	})
+	if i, ok := q.FindFunc(func(v interface{}) bool { return v.(int) == 260 }); !ok || i != 260 {
+		t.Errorf("Expected: %d; Got: %d", 260, i)
+	}
+	for i := 499; i >= 450; i-- {
+		if v, ok := q.PopBack(); !ok || v.(int) != i {
+			t.Errorf("Expected: %d; Got: %v", i, v)
+		}
+	}
+	expectRange(t, q, 0, 449)
+}
+
+func TestQueueImpl3AppendWithEmptyQueuesShouldNotChangeQueues(t *testing.T) {
+	var q, other Queueimpl3
+	q.Append(&other)
+	if q.Len() != 0 || other.Len() != 0 {
+		t.Errorf("Expected: empty queues; Got: %d and %d", q.Len(), other.Len())
+	}
+
+	pushRange(&q, 0, 9)
+	q.Append(&other)
+	q.Append(&q)
+	other.Append(&q)
+	expectRange(t, &other, 0, 9)
+	expectRange(t, &q, 0, -1)
+}
+
+func TestQueueImpl3MergeShouldCopyAllElementsInOrder(t *testing.T) {
+	q := New()
+	pushRange(q, 0, 99)
+	other := New()
+	pushRange(other, 100, 399)
+	other.Pop()
+
+	q.Merge(other)
+	if other.Len() != 299 {
+		t.Errorf("Expected: %d; Got: %d", 299, other.Len())
+	}
+	q.Pop()
+	q.Merge(q)
+	for i := 1; i < 400; i++ {
+		if i == 100 {
+			continue
+		}
+		if v, ok := q.Pop(); !ok || v.(int) != i {
+			t.Fatalf("Expected: %d; Got: %v", i, v)
+		}
+	}
+	for i := 1; i < 400; i++ {
+		if i == 100 {
+			continue
+		}
+		if v, ok := q.Pop(); !ok || v.(int) != i {
+			t.Fatalf("Expected: %d; Got: %v", i, v)
+		}
+	}
+	expectRange(t, other, 101, 399)
+}
+
+func TestQueueImpl3SplitAtShouldSplitElementsInOrder(t *testing.T) {
+	// Split points at the start, inside, and at the end of the nodes, with and
+	// without popped elements in the head node.
+	for _, popped := range []int{0, 10, 128} {
+		for _, n := range []int{1, 5, 118, 127, 128, 129, 246, 256, 300} {
+			q := New()
+			pushRange(q, 0, 499)
+			for i := 0; i < popped; i++ {
+				q.Pop()
+			}
+
+			r := q.SplitAt(n)
+			r.Push(-1)
+			q.Push(500)
+			for i := popped; i < popped+n; i++ {
+				if v, ok := r.Pop(); !ok || v.(int) != i {
+					t.Fatalf("popped %d, n %d: Expected: %d; Got: %v", popped, n, i, v)
+				}
+			}
+			if v, ok := r.Pop(); !ok || v.(int) != -1 || r.Len() != 0 {
+				t.Errorf("popped %d, n %d: Expected: -1 and empty queue; Got: %v", popped, n, v)
+			}
+			expectRange(t, q, popped+n, 500)
+		}
+	}
+}
+
+func TestQueueImpl3SplitAtWithOutOfRangeLengthShouldMoveNoneOrAllElements(t *testing.T) {
+	q := New()
+	pushRange(q, 0, 9)
+
+	if r := q.SplitAt(0); r.Len() != 0 || q.Len() != 10 {
+		t.Errorf("Expected: 0 and 10; Got: %d and %d", r.Len(), q.Len())
+	}
+	r := q.SplitAt(11)
+	if q.Len() != 0 {
+		t.Errorf("Expected: %d; Got: %d", 0, q.Len())
+	}
+	q.Push(10)
+	expectRange(t, r, 0, 9)
+	expectRange(t, q, 10, 10)
+
+	var e Queueimpl3
+	if r := e.SplitAt(1); r.Len() != 0 {
+		t.Errorf("Expected: %d; Got: %d", 0, r.Len())
+	}
+}
+
+func TestQueueImpl3PopEShouldReturnErrEmptyWhenEmpty(t *testing.T) {
+	q := New()
+	q.Push(1)
+
+	if v, err := q.PopE(); err != nil || v != 1 {
+		t.Errorf("Expected: %d; Got: %v, %v", 1, v, err)
+	}
+	if v, err := q.PopE(); err != queueerr.ErrEmpty || v != nil {
+		t.Errorf("Expected: %v; Got: %v, %v", queueerr.ErrEmpty, v, err)
+	}
+}
+
+func TestQueueImpl3PushPopWithStableLengthShouldNotAllocate(t *testing.T) {
+	q := New()
+	for i := 0; i < 1000; i++ {
+		q.Push(i)
+	}
+	// Warm up the spare node.
+	for i := 0; i < internalSliceSize; i++ {
+		q.Push(i)
+		q.Pop()
+	}
+
+	allocs := testing.AllocsPerRun(10, func() {
+		for i := 0; i < 10*internalSliceSize; i++ {
+			// Pushing a non pointer, small int doesn't allocate.
+			q.Push(1)
+			q.Pop()
+		}
+	})
+	if allocs != 0 {
+		t.Errorf("Expected: %d allocations; Got: %v", 0, allocs)
+	}
+}
+
+func TestQueueImpl3PushShouldReuseSpareNode(t *testing.T) {
+	q := New()
+	for i := 0; i < 2*internalSliceSize; i++ {
+		q.Push(i)
+	}
+	first := q.head
+	for i := 0; i < internalSliceSize; i++ {
+		q.Pop()
+	}
+	if q.spare != first {
+		t.Fatal("Expected: exhausted head node kept as spare; Got: discarded")
+	}
+
+	for i := 0; i < internalSliceSize; i++ {
+		q.Push(i)
+	}
+	if q.tail != first || q.spare != nil {
+		t.Error("Expected: spare node relinked as the tail node; Got: new node")
+	}
+	for i := 0; i < 2*internalSliceSize; i++ {
+		expected := i + internalSliceSize
+		if i >= internalSliceSize {
+			expected = i - internalSliceSize
+		}
+		if v, ok := q.Pop(); !ok || v != expected {
+			t.Errorf("Expected: %d; Got: %v", expected, v)
+		}
+	}
+}
+
+func TestQueueImpl3PopNShouldRetrieveAllElementsInOrder(t *testing.T) {
+	q := New()
+	for i := 0; i < 1000; i++ {
+		q.Push(i)
+	}
+	q.Pop()
+
+	next := 1
+	for _, size := range []int{0, 1, 127, 300, 1000} {
+		dst := make([]interface{}, size)
+		n := q.PopN(dst)
+		expected := size
+		if remaining := 1000 - next; expected > remaining {
+			expected = remaining
+		}
+		if n != expected {
+			t.Errorf("Expected: %d popped elements; Got: %d", expected, n)
+		}
+		for _, v := range dst[:n] {
+			if v != next {
+				t.Errorf("Expected: %d; Got: %v", next, v)
+			}
+			next++
+		}
+	}
+	if q.Len() != 0 || next != 1000 {
+		t.Errorf("Expected: empty queue; Got: %d elements, next %d", q.Len(), next)
+	}
+
+	// The queue should still be usable.
+	q.Push(1)
+	if v, ok := q.Pop(); !ok || v != 1 {
+		t.Errorf("Expected: %d; Got: %v", 1, v)
+	}
+}
+
+func TestQueueImpl3PopSliceShouldRetrieveEachNodeInOrder(t *testing.T) {
+	q := New()
+	for i := 0; i < 300; i++ {
+		q.Push(i)
+	}
+	q.Pop()
+
+	next := 1
+	for _, expected := range []int{127, 128, 44} {
+		vs := q.PopSlice()
+		if len(vs) != expected {
+			t.Fatalf("Expected: %d popped elements; Got: %d", expected, len(vs))
+		}
+		for _, v := range vs {
+			if v != next {
+				t.Errorf("Expected: %d; Got: %v", next, v)
+			}
+			next++
+		}
+	}
+	if q.Len() != 0 || next != 300 {
+		t.Errorf("Expected: empty queue; Got: %d elements, next %d", q.Len(), next)
+	}
+	if vs := q.PopSlice(); vs != nil {
+		t.Errorf("Expected: nil; Got: %v", vs)
+	}
+
+	// The queue should still be usable.
+	q.Push(1)
+	if v, ok := q.Pop(); !ok || v != 1 {
+		t.Errorf("Expected: %d; Got: %v", 1, v)
+	}
+}
+
+func TestQueueImpl3PopSliceShouldTransferOwnershipOfTheNode(t *testing.T) {
+	q := New()
+	for i := 0; i < 5; i++ {
+		q.Push(i)
+	}
+	// The node is the tail node, whose spare capacity Push would otherwise use.
+	vs := q.PopSlice()
+	q.Push(5)
+	if extra := vs[:len(vs)+1][len(vs)]; extra != nil {
+		t.Errorf("Expected: nil past the returned elements; Got: %v", extra)
+	}
+
+	vs = append(vs, "owned")
+	vs[0] = "modified"
+	if v, ok := q.Pop(); !ok || v != 5 {
+		t.Errorf("Expected: %d; Got: %v", 5, v)
+	}
+	if q.Len() != 0 {
+		t.Errorf("Expected: %d; Got: %d", 0, q.Len())
+	}
+
+	// Nodes emptied by PopSlice must not be recycled by later pushes.
+	for i := 0; i < 300; i++ {
+		q.Push(i)
+	}
+	vs = q.PopSlice()
+	for i := 0; i < 300; i++ {
+		q.Push(-1)
+	}
+	for i, v := range vs {
+		if v != i {
+			t.Fatalf("Expected: %d; Got: %v", i, v)
+		}
+	}
+}
+
+func TestQueueImpl3DrainShouldStopWhenFunctionReturnsFalse(t *testing.T) {
+	q := New()
+	for i := 0; i < 1000; i++ {
+		q.Push(i)
+	}
+
+	var drained []int
+	q.Drain(func(v interface{}) bool {
+		drained = append(drained, v.(int))
+		return v.(int) < 499
+	})
+	if len(drained) != 500 || q.Len() != 500 {
+		t.Errorf("Expected: %d drained, %d left; Got: %d, %d", 500, 500, len(drained), q.Len())
+	}
+	for i, v := range drained {
+		if v != i {
+			t.Errorf("Expected: %d; Got: %d", i, v)
+		}
+	}
+	if v, ok := q.Front(); !ok || v != 500 {
+		t.Errorf("Expected: %d; Got: %v", 500, v)
+	}
+
+	q.Drain(func(v interface{}) bool { return true })
+	if q.Len() != 0 {
+		t.Errorf("Expected: %d; Got: %d", 0, q.Len())
+	}
+}
+
+func TestQueueImpl3PopNDrainShouldReleasePoppedValues(t *testing.T) {
+	for _, pop := range []func(q *Queueimpl3){
+		func(q *Queueimpl3) { q.PopN(make([]interface{}, queuetest.LeakTestCount/2)) },
+		func(q *Queueimpl3) {
+			n := 0
+			q.Drain(func(v interface{}) bool { n++; return n < queuetest.LeakTestCount/2 })
+		},
+	} {
+		q := New()
+		var f queuetest.Finalizers
+		for i := 0; i < queuetest.LeakTestCount; i++ {
+			q.Push(f.NewValue(0))
+		}
+		pop(q)
+
+		if r := f.Wait(queuetest.LeakTestCount / 2); r != queuetest.LeakTestCount/2 {
+			t.Errorf("Expected: %d released values; Got: %d", queuetest.LeakTestCount/2, r)
+		}
+		runtime.KeepAlive(q)
+	}
+}
+
+func TestQueueImpl3GetShouldReturnEmptyQueue(t *testing.T) {
+	q := Get()
+	for i := 0; i < 300; i++ {
+		q.Push(i)
+	}
+	q.SetCodec(&stringCodec{})
+	Put(q)
+
+	for i := 0; i < 10; i++ {
+		q := Get()
+		if l := q.Len(); l != 0 {
+			t.Errorf("Expected: 0 as the queue should be empty; Got: %d", l)
+		}
+		if _, ok := q.Pop(); ok {
+			t.Error("Expected: false as the queue is empty; Got: true")
+		}
+		if q.codec != nil {
+			t.Error("Expected: codec cleared; Got: codec set")
+		}
+		q.Push(i)
+		if v, ok := q.Pop(); !ok || v.(int) != i {
+			t.Errorf("Expected: %d; Got: %v", i, v)
+		}
+		Put(q)
+	}
+}
+
+func TestQueueImpl3PutShouldKeepSingleEmptyNode(t *testing.T) {
+	q := New()
+	for i := 0; i < 300; i++ {
+		q.Push(i)
+	}
+	q.Pop()
+	q.reset()
+
+	if q.head != nil || q.tail != nil || q.len != 0 || q.pos != 0 {
+		t.Errorf("Expected: empty queue; Got: length %d, position %d", q.len, q.pos)
+	}
+	if q.spare == nil || len(q.spare.v) != 0 || q.spare.n != nil || q.spare.p != nil {
+		t.Error("Expected: single empty spare node; Got: none or a linked one")
+	}
+	for i, v := range q.spare.v[:cap(q.spare.v)] {
+		if v != nil {
+			t.Fatalf("Expected: spare node values cleared; Got: %v at position %d", v, i)
+		}
+	}
+}
+
+func TestQueueImpl3PutShouldReleaseQueuedValues(t *testing.T) {
+	q := New()
+	var f queuetest.Finalizers
+	for i := 0; i < queuetest.LeakTestCount; i++ {
+		q.Push(f.NewValue(0))
+	}
+	q.reset()
+
+	if r := f.Wait(queuetest.LeakTestCount); r != queuetest.LeakTestCount {
+		t.Errorf("Expected: %d released values; Got: %d", queuetest.LeakTestCount, r)
+	}
+	runtime.KeepAlive(q)
+}
+
+func TestQueueImpl3GetPutShouldNotAllocate(t *testing.T) {
+	Put(Get())
+	allocs := testing.AllocsPerRun(100, func() {
+		q := Get()
+		for i := 0; i < internalSliceSize; i++ {
+			q.Push(value)
+		}
+		for q.Len() > 0 {
+			q.Pop()
+		}
+		Put(q)
+	})
+
+	// The pool may be emptied by a garbage collection while running.
+	if allocs > 1 {
+		t.Errorf("Expected: no allocations; Got: %v", allocs)
+	}
+}
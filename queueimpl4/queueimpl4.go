@@ -126,9 +126,14 @@ func (q *Queueimpl4) Pop() (interface{}, bool) {
 	q.len--
 
 	if q.hp >= internalArrayLastPosition {
-		n := q.head.n
-		q.head.n = nil // Avoid memory leaks
-		q.head = n
+		if q.head.n == nil {
+			// The head node is also the tail node and all its values were popped, so reuse it.
+			q.tp = 0
+		} else {
+			n := q.head.n
+			q.head.n = nil // Avoid memory leaks
+			q.head = n
+		}
 		q.hp = 0
 	} else {
 		q.hp++
@@ -117,9 +117,14 @@ func (q *Queueimpl5) Pop() (interface{}, bool) {
 	q.len--
 
 	if q.hp >= internalSliceLastPosition {
-		h := q.head[q.hp].([]interface{})
-		q.head[q.hp] = nil // Avoid memory leaks
-		q.head = h
+		if q.head[q.hp] == nil {
+			// The head slice is also the tail slice and all its values were popped, so reuse it.
+			q.tp = 0
+		} else {
+			h := q.head[q.hp].([]interface{})
+			q.head[q.hp] = nil // Avoid memory leaks
+			q.head = h
+		}
 		q.hp = 0
 	}
 
@@ -21,7 +21,10 @@
 package queueimpl5
 
 import (
+	"runtime"
 	"testing"
+
+	"github.com/christianrpetrin/queue-tests/queuetest"
 )
 
 func TestQueueImpl1NewQueueShouldReturnInitiazedInstanceOfQueue(t *testing.T) {
@@ -173,3 +176,67 @@ func TestQueueImpl1PutGetFrontShouldRetrieveAllElementsInOrder(t *testing.T) {
 		})
 	}
 }
+
+func TestQueueImpl5PopShouldReleasePoppedValues(t *testing.T) {
+	q := New()
+	var f queuetest.Finalizers
+	for i := 0; i < queuetest.LeakTestCount; i++ {
+		q.Push(f.NewValue(0))
+	}
+	for i := 0; i < queuetest.LeakTestCount; i++ {
+		if _, ok := q.Pop(); !ok {
+			t.Fatalf("Expected: value %d; Got: empty queue", i)
+		}
+	}
+
+	if r := f.Wait(queuetest.LeakTestCount); r != queuetest.LeakTestCount {
+		t.Errorf("Expected: %d released values; Got: %d", queuetest.LeakTestCount, r)
+	}
+	runtime.KeepAlive(q)
+}
+
+func TestQueueImpl5PopShouldReleaseDiscardedNodes(t *testing.T) {
+	q := New()
+	for i := 0; i < queuetest.LeakTestCount; i++ {
+		q.Push(i)
+	}
+	var f queuetest.Finalizers
+	var nodes int32
+	for n := q.head; ; {
+		f.Track(&n[0])
+		nodes++
+		next, ok := n[internalSliceLastPosition].([]interface{})
+		if !ok {
+			break
+		}
+		n = next
+	}
+	for i := 0; i < queuetest.LeakTestCount; i++ {
+		if _, ok := q.Pop(); !ok {
+			t.Fatalf("Expected: value %d; Got: empty queue", i)
+		}
+	}
+
+	// All nodes but the current head node should have been discarded.
+	if r := f.Wait(nodes - 1); r != nodes-1 {
+		t.Errorf("Expected: %d released nodes; Got: %d", nodes-1, r)
+	}
+	runtime.KeepAlive(q)
+}
+
+func TestQueueImpl5PopAllValuesOfAFullNodeShouldKeepQueueUsable(t *testing.T) {
+	q := New()
+	for round := 0; round < 3; round++ {
+		for i := 0; i < internalSliceLastPosition; i++ {
+			q.Push(i)
+		}
+		for i := 0; i < internalSliceLastPosition; i++ {
+			if v, ok := q.Pop(); !ok || v.(int) != i {
+				t.Fatalf("Expected: %d; Got: %v", i, v)
+			}
+		}
+		if v, ok := q.Pop(); ok || v != nil {
+			t.Fatalf("Expected: nil as the queue should be empty; Got: %v", v)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package queueimpl6
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/christianrpetrin/queue-tests/dump"
+)
+
+func TestQueueimpl6StringShouldSummarizeInternalShape(t *testing.T) {
+	q := New()
+	if s := q.String(); s != "queueimpl6: len=0 nodes=0 cap=0 utilization=0.0%" {
+		t.Errorf("Expected: %q; Got: %q", "queueimpl6: len=0 nodes=0 cap=0 utilization=0.0%", s)
+	}
+
+	for i := 0; i < 300; i++ {
+		q.Push(i)
+	}
+	for i := 0; i < 10; i++ {
+		q.Pop()
+	}
+	full := "queueimpl6: len=290 nodes=6 cap=376 utilization=77.1%"
+	if s := q.String(); s != full {
+		t.Errorf("Expected: %q; Got: %q", full, s)
+	}
+}
+
+func TestQueueimpl6DumpShouldDescribeEachNode(t *testing.T) {
+	q := New()
+	for i := 0; i < 300; i++ {
+		q.Push(i)
+	}
+	for i := 0; i < 10; i++ {
+		q.Pop()
+	}
+	full := "queueimpl6: len=290 nodes=6 cap=376 utilization=77.1%"
+
+	var b bytes.Buffer
+	if err := q.Dump(&b, nil); err != nil {
+		t.Fatalf("Expected: no error; Got: %v", err)
+	}
+	want := full + "\n" +
+		"  node 0: len=5 cap=8 utilization=62.5%\n" +
+		"  node 1: len=16 cap=16 utilization=100.0%\n" +
+		"  node 2: len=32 cap=32 utilization=100.0%\n" +
+		"  node 3: len=64 cap=64 utilization=100.0%\n" +
+		"  node 4: len=128 cap=128 utilization=100.0%\n" +
+		"  node 5: len=45 cap=128 utilization=35.2%\n"
+	if b.String() != want {
+		t.Errorf("Expected: %q; Got: %q", want, b.String())
+	}
+
+	b.Reset()
+	if err := q.Dump(&b, dump.Preview); err != nil {
+		t.Fatalf("Expected: no error; Got: %v", err)
+	}
+	want = full + "\n" +
+		"  node 0: len=5 cap=8 utilization=62.5% values=[10 11 12 13 14]\n" +
+		"  node 1: len=16 cap=16 utilization=100.0% values=[15 16 17 18 19 20 21 22 ...]\n" +
+		"  node 2: len=32 cap=32 utilization=100.0% values=[31 32 33 34 35 36 37 38 ...]\n" +
+		"  node 3: len=64 cap=64 utilization=100.0% values=[63 64 65 66 67 68 69 70 ...]\n" +
+		"  node 4: len=128 cap=128 utilization=100.0% values=[127 128 129 130 131 132 133 134 ...]\n" +
+		"  node 5: len=45 cap=128 utilization=35.2% values=[255 256 257 258 259 260 261 262 ...]\n"
+	if b.String() != want {
+		t.Errorf("Expected: %q; Got: %q", want, b.String())
+	}
+	if q.Len() != 290 {
+		t.Errorf("Expected: %d; Got: %d", 290, q.Len())
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package queueimpl7
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/christianrpetrin/queue-tests/invariant"
+)
+
+// dumpNodes holds the maximum number of nodes described at each end of the node chain by dump.
+const dumpNodes = 4
+
+// checkInvariants panics with a dump of queue q if any of its internal invariants doesn't
+// hold after operation op. It is only called in debug mode; see package invariant.
+func (q *Queueimpl7) checkInvariants(op string) {
+	if reason := q.violation(); reason != "" {
+		invariant.Fail("queueimpl7", op, reason, q.dump)
+	}
+}
+
+// violation returns the description of the first internal invariant of queue q that doesn't
+// hold, or an empty string if all of them hold.
+// The node chain is only walked when invariant.Due says so.
+func (q *Queueimpl7) violation() string {
+	// Once all values are popped, head is nil while tail still points to the last node,
+	// which is replaced by the next Push.
+	if q.head == nil {
+		if q.len != 0 || q.hp != 0 {
+			return "queue without nodes is not empty"
+		}
+		return ""
+	}
+	if q.tail == nil || q.tail.n != nil {
+		return "tail is nil or has a next node"
+	}
+	if q.len <= 0 || q.hp < 0 || q.hp >= len(q.head.v) {
+		return "length or position out of bounds"
+	}
+	for i, v := range q.head.v[:q.hp] {
+		if v != nil {
+			return fmt.Sprintf("popped position %d of head is not cleared", i)
+		}
+	}
+	if !invariant.Due(q.len / maxInternalSliceSize) {
+		return ""
+	}
+
+	// The slice sizes may be changed by the benchmarks, so only check against the largest one.
+	limit := maxInternalSliceSize
+	if maxFirstSliceSize > limit {
+		limit = maxFirstSliceSize
+	}
+
+	// Each node holds at least one value, so a longer chain has a cycle.
+	count, nodes := -q.hp, 0
+	for n := q.head; ; n = n.n {
+		if nodes++; nodes > q.len {
+			return "node chain is longer than the queue length"
+		}
+		if len(n.v) > limit || len(n.v) == 0 {
+			return fmt.Sprintf("node %d holds %d values", nodes-1, len(n.v))
+		}
+		count += len(n.v)
+		if n.n == nil {
+			if n != q.tail {
+				return fmt.Sprintf("node chain ends at node %d before tail", nodes-1)
+			}
+			break
+		}
+	}
+	if count != q.len {
+		return fmt.Sprintf("node chain holds %d values, but length is %d", count, q.len)
+	}
+	return ""
+}
+
+// dump returns a description of the internal state of queue q, including the first and last
+// nodes of the node chain.
+func (q *Queueimpl7) dump() string {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "len=%d hp=%d lastSliceSize=%d head=%p tail=%p\n", q.len, q.hp, q.lastSliceSize, q.head, q.tail)
+	i := 0
+	for n := q.head; n != nil && i < q.len+1; n, i = n.n, i+1 {
+		if i == dumpNodes {
+			b.WriteString("...\n")
+		}
+		if i < dumpNodes || n.n == nil || n == q.tail {
+			fmt.Fprintf(&b, "node %d %p: len=%d cap=%d n=%p\n", i, n, len(n.v), cap(n.v), n.n)
+		}
+	}
+	return b.String()
+}
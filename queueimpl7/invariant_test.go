@@ -0,0 +1,81 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package queueimpl7
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/christianrpetrin/queue-tests/invariant"
+)
+
+func TestQueueimpl7CheckInvariantsShouldHoldAfterEveryOperation(t *testing.T) {
+	q := New()
+	q.checkInvariants("New")
+	for i := 0; i < 1000; i++ {
+		q.Push(i)
+		q.checkInvariants("Push")
+	}
+	for i := 0; i < 1000; i++ {
+		q.Pop()
+		q.checkInvariants("Pop")
+	}
+	q.Push(1)
+	q.checkInvariants("Push")
+}
+
+func TestQueueimpl7CheckInvariantsShouldPanicWithDumpOnViolation(t *testing.T) {
+	tests := map[string]struct {
+		corrupt func(q *Queueimpl7)
+		reason  string
+	}{
+		"Length":   {func(q *Queueimpl7) { q.len++ }, "node chain holds"},
+		"Position": {func(q *Queueimpl7) { q.hp = -1 }, "out of bounds"},
+		"Cleared":  {func(q *Queueimpl7) { q.head.v[0] = 1 }, "not cleared"},
+		"Cycle":    {func(q *Queueimpl7) { q.head.n.n = q.head }, "longer than the queue length"},
+		"Tail":     {func(q *Queueimpl7) { q.tail = q.head }, "has a next node"},
+	}
+	for name, test := range tests {
+		q := New()
+		for i := 0; i < 300; i++ {
+			q.Push(i)
+		}
+		q.Pop()
+		test.corrupt(q)
+
+		func() {
+			defer func() {
+				v, ok := recover().(*invariant.Violation)
+				if !ok {
+					t.Errorf("%s: Expected: *invariant.Violation; Got: %v", name, v)
+					return
+				}
+				if v.Impl != "queueimpl7" || v.Op != "test" || !strings.Contains(v.Reason, test.reason) {
+					t.Errorf("%s: Expected: violation %q after test; Got: %+v", name, test.reason, v)
+				}
+				if !strings.Contains(v.Dump, "len=") || !strings.Contains(v.Dump, "node 0") {
+					t.Errorf("%s: Expected: dump of the queue; Got: %q", name, v.Dump)
+				}
+			}()
+			q.checkInvariants("test")
+		}()
+	}
+}
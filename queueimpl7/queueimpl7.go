@@ -27,6 +27,10 @@
 // 128 fixed size.
 package queueimpl7
 
+import (
+	"github.com/christianrpetrin/queue-tests/invariant"
+)
+
 // Keeping below as var so it is possible to run the slice size bench tests with no coding changes.
 var (
 	// firstSliceSize holds the size of the first slice.
@@ -81,6 +85,9 @@ func (q *Queueimpl7) Init() *Queueimpl7 {
 	q.tail = nil
 	q.hp = 0
 	q.len = 0
+	if invariant.Enabled {
+		q.checkInvariants("Init")
+	}
 	return q
 }
 
@@ -116,6 +123,9 @@ func (q *Queueimpl7) Push(v interface{}) {
 
 	q.tail.v = append(q.tail.v, v)
 	q.len++
+	if invariant.Enabled {
+		q.checkInvariants("Push")
+	}
 }
 
 // Pop retrieves and removes the current element from the queue.
@@ -138,6 +148,9 @@ func (q *Queueimpl7) Pop() (interface{}, bool) {
 		q.head = n
 		q.hp = 0
 	}
+	if invariant.Enabled {
+		q.checkInvariants("Pop")
+	}
 
 	return v, true
 }
@@ -21,7 +21,10 @@
 package queueimpl7
 
 import (
+	"runtime"
 	"testing"
+
+	"github.com/christianrpetrin/queue-tests/queuetest"
 )
 
 func TestQueueImpl7NewQueueShouldReturnInitiazedInstanceOfQueue(t *testing.T) {
@@ -205,3 +208,45 @@ func TestQueueImpl7PushPopFrontShouldRetrieveAllElementsInOrder(t *testing.T) {
 		})
 	}
 }
+
+func TestQueueImpl7PopShouldReleasePoppedValues(t *testing.T) {
+	q := New()
+	var f queuetest.Finalizers
+	for i := 0; i < queuetest.LeakTestCount; i++ {
+		q.Push(f.NewValue(0))
+	}
+	for i := 0; i < queuetest.LeakTestCount; i++ {
+		if _, ok := q.Pop(); !ok {
+			t.Fatalf("Expected: value %d; Got: empty queue", i)
+		}
+	}
+
+	if r := f.Wait(queuetest.LeakTestCount); r != queuetest.LeakTestCount {
+		t.Errorf("Expected: %d released values; Got: %d", queuetest.LeakTestCount, r)
+	}
+	runtime.KeepAlive(q)
+}
+
+func TestQueueImpl7PopShouldReleaseDiscardedNodes(t *testing.T) {
+	q := New()
+	for i := 0; i < queuetest.LeakTestCount; i++ {
+		q.Push(i)
+	}
+	var f queuetest.Finalizers
+	var nodes int32
+	for n := q.head; n != nil; n = n.n {
+		f.Track(n)
+		nodes++
+	}
+	for i := 0; i < queuetest.LeakTestCount; i++ {
+		if _, ok := q.Pop(); !ok {
+			t.Fatalf("Expected: value %d; Got: empty queue", i)
+		}
+	}
+
+	// All nodes but the current head node should have been discarded.
+	if r := f.Wait(nodes - 1); r != nodes-1 {
+		t.Errorf("Expected: %d released nodes; Got: %d", nodes-1, r)
+	}
+	runtime.KeepAlive(q)
+}
@@ -0,0 +1,73 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+//go:build goexperiment.arenas
+// +build goexperiment.arenas
+
+package queueimpl8
+
+import (
+	"arena"
+)
+
+// ArenaAllocator is an experimental allocator that allocates nodes from a memory arena.
+// Nodes are not released individually; instead, all nodes are released at once
+// when the queue is Reset or when the arena is freed by calling Free.
+// ArenaAllocator is only available when building with GOEXPERIMENT=arenas.
+// An ArenaAllocator is not safe for concurrent use.
+type ArenaAllocator struct {
+	// a holds the arena used to allocate the nodes.
+	a *arena.Arena
+}
+
+// NewArenaAllocator returns an allocator backed by a new arena.
+func NewArenaAllocator() *ArenaAllocator {
+	return &ArenaAllocator{a: arena.NewArena()}
+}
+
+// NewWithArena returns an initialized queue that allocates nodes from a new arena.
+// Calling Reset on the returned queue releases all its nodes at once by freeing the arena.
+func NewWithArena() *Queueimpl8 {
+	return NewWithAllocator(NewArenaAllocator())
+}
+
+// AllocNode returns a node allocated from the arena.
+func (a *ArenaAllocator) AllocNode(size int) *Node {
+	n := arena.New[Node](a.a)
+	n.v = arena.MakeSlice[interface{}](a.a, 0, size)
+	return n
+}
+
+// FreeNode does nothing as nodes are only released when the arena is freed.
+func (a *ArenaAllocator) FreeNode(n *Node) {}
+
+// Reset releases all nodes allocated by a by freeing the arena, and starts
+// allocating nodes from a new arena.
+// Nodes allocated before calling Reset must not be used anymore.
+func (a *ArenaAllocator) Reset() {
+	a.a.Free()
+	a.a = arena.NewArena()
+}
+
+// Free releases all nodes allocated by a.
+// Queues using a, as well as a itself, must not be used after calling Free.
+func (a *ArenaAllocator) Free() {
+	a.a.Free()
+}
@@ -0,0 +1,80 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+//go:build goexperiment.arenas
+// +build goexperiment.arenas
+
+package queueimpl8
+
+import (
+	"testing"
+)
+
+func init() {
+	benchAllocators = append(benchAllocators, benchAllocator{
+		name: "ArenaAllocator",
+		new: func() (Allocator, func()) {
+			a := NewArenaAllocator()
+			return a, a.Free
+		},
+	})
+}
+
+func TestQueueImpl8WithArenaAllocatorShouldRetrieveAllElementsInOrder(t *testing.T) {
+	a := NewArenaAllocator()
+	defer a.Free()
+	q := NewWithAllocator(a)
+
+	for i := 0; i < 1000; i++ {
+		q.Push(i)
+	}
+	for i := 0; i < 1000; i++ {
+		if v, ok := q.Pop(); !ok || v.(int) != i {
+			t.Errorf("Expected: %d; Got: %d", i, v)
+		}
+	}
+	if v, ok := q.Pop(); ok || v != nil {
+		t.Errorf("Expected: nil as the queue should be empty; Got: %d", v)
+	}
+}
+
+func TestQueueImpl8WithArenaResetShouldReturnReadyToUseQueue(t *testing.T) {
+	q := NewWithArena()
+	defer q.a.(*ArenaAllocator).Free()
+
+	for r := 0; r < 3; r++ {
+		for i := 0; i < 1000; i++ {
+			q.Push(i)
+		}
+		for i := 0; i < 500; i++ {
+			if v, ok := q.Pop(); !ok || v.(int) != i {
+				t.Errorf("Expected: %d; Got: %d", i, v)
+			}
+		}
+		q.Reset()
+
+		if q.Len() != 0 {
+			t.Errorf("Expected: %d; Got: %d", 0, q.Len())
+		}
+		if v, ok := q.Front(); ok || v != nil {
+			t.Errorf("Expected: nil as the queue should be empty; Got: %d", v)
+		}
+	}
+}
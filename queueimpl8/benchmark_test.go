@@ -0,0 +1,178 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package queueimpl8
+
+import (
+	"strconv"
+	"testing"
+)
+
+// benchAllocator describes an allocator probed by the benchmark tests.
+type benchAllocator struct {
+	// name holds the benchmark name.
+	name string
+
+	// new returns the allocator to use in a single benchmark iteration and a
+	// function to call at the end of the iteration.
+	new func() (Allocator, func())
+}
+
+// benchPolicy describes a growth policy probed by the benchmark tests.
+type benchPolicy struct {
+	// name holds the benchmark name.
+	name string
+
+	// new returns the growth policy to use in a single queue.
+	new func() GrowthPolicy
+}
+
+var (
+	// benchAllocators holds the allocators probed by the benchmark tests.
+	benchAllocators = []benchAllocator{
+		{
+			name: "GCAllocator",
+			new:  func() (Allocator, func()) { return GCAllocator{}, func() {} },
+		},
+		{
+			// The pool is shared by all iterations, so nodes freed in one
+			// iteration are reused by the next ones.
+			name: "PoolAllocator",
+			new:  func() (Allocator, func()) { return sharedPoolAllocator, func() {} },
+		},
+	}
+
+	// sharedPoolAllocator holds the pool allocator shared by all benchmark iterations.
+	sharedPoolAllocator = &PoolAllocator{}
+
+	// benchPolicies holds the growth policies probed by the benchmark tests.
+	benchPolicies = []benchPolicy{
+		{name: "Fixed128", new: func() GrowthPolicy { return Fixed(128) }},
+		{name: "Fixed1024", new: func() GrowthPolicy { return Fixed(1024) }},
+		{name: "Doubling", new: func() GrowthPolicy { return Doubling(8) }},
+		{name: "CappedDoubling", new: func() GrowthPolicy { return CappedDoubling(8, 1024) }},
+		{name: "Adaptive", new: func() GrowthPolicy { return Adaptive(8, 1024) }},
+	}
+
+	// benchCounts holds the number of items to add to the queue in each test.
+	benchCounts = []int{0, 1, 10, 100, 1000, 10000, 100000}
+
+	// burstCounts holds the number of items to add to the queue in each burst.
+	burstCounts = []int{1000, 10000, 100000}
+
+	// Used to store temp values, avoiding any compiler optimizations.
+	tmp  interface{}
+	tmp2 bool
+)
+
+func BenchmarkAllocator(b *testing.B) {
+	for _, a := range benchAllocators {
+		for _, count := range benchCounts {
+			a, count := a, count
+			b.Run(a.name+"/"+strconv.Itoa(count), func(b *testing.B) {
+				for n := 0; n < b.N; n++ {
+					allocator, done := a.new()
+					q := NewWithAllocator(allocator)
+
+					for i := 0; i < count; i++ {
+						q.Push(i)
+					}
+					for q.Len() > 0 {
+						tmp, tmp2 = q.Pop()
+					}
+					done()
+				}
+			})
+		}
+	}
+}
+
+// BenchmarkBurst probes a long lived queue that is repeatedly filled with a burst
+// of values, drained and then Reset.
+func BenchmarkBurst(b *testing.B) {
+	for _, a := range benchAllocators {
+		for _, count := range burstCounts {
+			a, count := a, count
+			b.Run(a.name+"/"+strconv.Itoa(count), func(b *testing.B) {
+				allocator, done := a.new()
+				q := NewWithAllocator(allocator)
+				b.ResetTimer()
+
+				for n := 0; n < b.N; n++ {
+					for i := 0; i < count; i++ {
+						q.Push(i)
+					}
+					for q.Len() > 0 {
+						tmp, tmp2 = q.Pop()
+					}
+					q.Reset()
+				}
+
+				b.StopTimer()
+				done()
+			})
+		}
+	}
+}
+
+// BenchmarkGrowth sweeps the growth policies, probing a new queue that is filled with
+// count values and then drained.
+func BenchmarkGrowth(b *testing.B) {
+	for _, p := range benchPolicies {
+		for _, count := range benchCounts {
+			p, count := p, count
+			b.Run(p.name+"/"+strconv.Itoa(count), func(b *testing.B) {
+				for n := 0; n < b.N; n++ {
+					q := NewWithOptions(Options{Growth: p.new()})
+
+					for i := 0; i < count; i++ {
+						q.Push(i)
+					}
+					for q.Len() > 0 {
+						tmp, tmp2 = q.Pop()
+					}
+				}
+			})
+		}
+	}
+}
+
+// BenchmarkGrowthBurst sweeps the growth policies, probing a long lived queue that is
+// repeatedly filled with a burst of values and then drained.
+func BenchmarkGrowthBurst(b *testing.B) {
+	for _, p := range benchPolicies {
+		for _, count := range burstCounts {
+			p, count := p, count
+			b.Run(p.name+"/"+strconv.Itoa(count), func(b *testing.B) {
+				q := NewWithOptions(Options{Growth: p.new()})
+				b.ResetTimer()
+
+				for n := 0; n < b.N; n++ {
+					for i := 0; i < count; i++ {
+						q.Push(i)
+					}
+					for q.Len() > 0 {
+						tmp, tmp2 = q.Pop()
+					}
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,132 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package queueimpl8
+
+// GrowthPolicy decides the size of the queue nodes.
+type GrowthPolicy interface {
+	// NodeSize returns the size of the next node to allocate, given the size of the
+	// current tail node, or 0 if the queue has no nodes yet, and the current queue length.
+	// Sizes smaller than 1 are treated as 1.
+	NodeSize(last, len int) int
+}
+
+// fixedPolicy is a growth policy allocating all nodes with the same size.
+type fixedPolicy int
+
+// Fixed returns a growth policy allocating all nodes with size values.
+// Fixed(128) is the default growth policy.
+func Fixed(size int) GrowthPolicy {
+	return fixedPolicy(size)
+}
+
+// NodeSize returns the fixed node size.
+func (p fixedPolicy) NodeSize(last, len int) int { return int(p) }
+
+// doublingPolicy is a growth policy doubling the size of each new node, up to a maximum size.
+type doublingPolicy struct {
+	// initial holds the size of the first node.
+	initial int
+
+	// max holds the maximum node size, or 0 if there is none.
+	max int
+}
+
+// Doubling returns a growth policy allocating the first node with initial values, and then
+// doubling the size of each new node, but never beyond the queue length rounded up to a power
+// of two, so the capacity of the queue nodes stays proportional to the queue length.
+func Doubling(initial int) GrowthPolicy {
+	return doublingPolicy{initial: initial}
+}
+
+// CappedDoubling returns a growth policy that is the same as Doubling, but never allocates
+// nodes with more than max values.
+func CappedDoubling(initial, max int) GrowthPolicy {
+	return doublingPolicy{initial: initial, max: max}
+}
+
+// NodeSize returns twice the size of the last node, bounded by the queue length and the
+// maximum node size, if any.
+func (p doublingPolicy) NodeSize(last, len int) int {
+	size := last * 2
+	if limit := ceilPow2(len + 1); size > limit {
+		size = limit
+	}
+	if size < p.initial {
+		size = p.initial
+	}
+	if p.max > 0 && size > p.max {
+		size = p.max
+	}
+	return size
+}
+
+// adaptivePolicy is a growth policy sizing the nodes according to the recent high-watermark
+// of the queue length.
+type adaptivePolicy struct {
+	// min holds the minimum node size.
+	min int
+
+	// max holds the maximum node size, or 0 or less if there is none.
+	max int
+
+	// hwm holds the decaying high-watermark of the queue length.
+	hwm int
+}
+
+// Adaptive returns a growth policy sizing each new node to an eighth of the recent
+// high-watermark of the queue length, rounded up to a power of two and bounded by min and max.
+// A max of 0 or less means there is no maximum node size, and a max smaller than min is
+// treated as min.
+// The queue length is sampled on each new node; samples lower than the high-watermark make it
+// decay by an eighth of the difference, so the node size adapts to the workload both when the
+// queue grows and when its length settles, e.g. when a long lived queue repeatedly allocates
+// nodes to hold a stable number of values.
+// The returned policy keeps state, so each queue must use its own adaptive policy.
+func Adaptive(min, max int) GrowthPolicy {
+	return &adaptivePolicy{min: min, max: max}
+}
+
+// NodeSize samples the queue length and returns the size derived from the high-watermark.
+func (p *adaptivePolicy) NodeSize(last, len int) int {
+	if len >= p.hwm {
+		p.hwm = len
+	} else {
+		p.hwm -= (p.hwm - len) / 8
+	}
+
+	size := ceilPow2(p.hwm / 8)
+	if p.max > 0 && size > p.max {
+		size = p.max
+	}
+	if size < p.min {
+		size = p.min
+	}
+	return size
+}
+
+// ceilPow2 returns the smallest power of two that is larger than or equal to n.
+func ceilPow2(n int) int {
+	p := 1
+	for p < n {
+		p <<= 1
+	}
+	return p
+}
@@ -0,0 +1,214 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package queueimpl8
+
+import (
+	"testing"
+)
+
+// testPolicies holds the growth policies the queue is tested with.
+var testPolicies = map[string]func() GrowthPolicy{
+	"Fixed":          func() GrowthPolicy { return Fixed(16) },
+	"Doubling":       func() GrowthPolicy { return Doubling(1) },
+	"CappedDoubling": func() GrowthPolicy { return CappedDoubling(2, 64) },
+	"Adaptive":       func() GrowthPolicy { return Adaptive(4, 256) },
+	"Invalid":        func() GrowthPolicy { return Fixed(0) },
+}
+
+// nodeSizes returns the size of each node of queue q, from the first to the last one.
+func nodeSizes(q *Queueimpl8) []int {
+	var sizes []int
+	for n := q.head; n != nil; n = n.n {
+		sizes = append(sizes, cap(n.v))
+	}
+	return sizes
+}
+
+func TestQueueImpl8WithGrowthPolicyShouldRetrieveAllElementsInOrder(t *testing.T) {
+	for name, policy := range testPolicies {
+		for aname, allocator := range testAllocators {
+			q := NewWithOptions(Options{Allocator: allocator(), Growth: policy()})
+			for r := 0; r < 3; r++ {
+				for i := 0; i < 1000; i++ {
+					q.Push(i)
+				}
+				for i := 0; i < 1000; i++ {
+					if v, ok := q.Front(); !ok || v.(int) != i {
+						t.Errorf("%s/%s: Expected: %d; Got: %v", name, aname, i, v)
+					}
+					if v, ok := q.Pop(); !ok || v.(int) != i {
+						t.Errorf("%s/%s: Expected: %d; Got: %v", name, aname, i, v)
+					}
+				}
+				if v, ok := q.Pop(); ok || v != nil {
+					t.Errorf("%s/%s: Expected: nil as the queue should be empty; Got: %v", name, aname, v)
+				}
+			}
+		}
+	}
+}
+
+func TestQueueImpl8WithFixedPolicyShouldAllocateSameSizeNodes(t *testing.T) {
+	q := NewWithOptions(Options{Growth: Fixed(16)})
+	for i := 0; i < 40; i++ {
+		q.Push(i)
+	}
+
+	sizes := nodeSizes(q)
+	if len(sizes) != 3 {
+		t.Fatalf("Expected: 3 nodes; Got: %d", len(sizes))
+	}
+	for i, s := range sizes {
+		if s != 16 {
+			t.Errorf("Expected: node %d size 16; Got: %d", i, s)
+		}
+	}
+}
+
+func TestQueueImpl8WithDefaultPolicyShouldAllocate128ValuesNodes(t *testing.T) {
+	q := New()
+	for i := 0; i < 129; i++ {
+		q.Push(i)
+	}
+
+	sizes := nodeSizes(q)
+	if len(sizes) != 2 || sizes[0] != internalSliceSize || sizes[1] != internalSliceSize {
+		t.Errorf("Expected: 2 nodes of size %d; Got: %v", internalSliceSize, sizes)
+	}
+}
+
+func TestQueueImpl8WithDoublingPolicyShouldDoubleNodeSizes(t *testing.T) {
+	q := NewWithOptions(Options{Growth: Doubling(2)})
+	for i := 0; i < 62; i++ {
+		q.Push(i)
+	}
+
+	want := []int{2, 4, 8, 16, 32}
+	sizes := nodeSizes(q)
+	if len(sizes) != len(want) {
+		t.Fatalf("Expected: %v; Got: %v", want, sizes)
+	}
+	for i := range want {
+		if sizes[i] != want[i] {
+			t.Errorf("Expected: %v; Got: %v", want, sizes)
+			break
+		}
+	}
+}
+
+func TestQueueImpl8WithDoublingPolicyShouldKeepNodeSizesProportionalToLength(t *testing.T) {
+	q := NewWithOptions(Options{Growth: Doubling(2)})
+	for i := 0; i < 10; i++ {
+		q.Push(i)
+	}
+
+	// The queue length stays at 10, so the nodes stop growing at 16 values.
+	for i := 0; i < 1000; i++ {
+		q.Push(i)
+		q.Pop()
+	}
+	if s := cap(q.tail.v); s != 16 {
+		t.Errorf("Expected: 16; Got: %d", s)
+	}
+}
+
+func TestQueueImpl8WithCappedDoublingPolicyShouldNotExceedMaxNodeSize(t *testing.T) {
+	q := NewWithOptions(Options{Growth: CappedDoubling(2, 8)})
+	for i := 0; i < 100; i++ {
+		q.Push(i)
+	}
+
+	for i, s := range nodeSizes(q) {
+		if s > 8 {
+			t.Errorf("Expected: node %d size up to 8; Got: %d", i, s)
+		}
+	}
+	if s := cap(q.tail.v); s != 8 {
+		t.Errorf("Expected: 8; Got: %d", s)
+	}
+}
+
+func TestQueueImpl8WithAdaptivePolicyShouldFollowHighWatermark(t *testing.T) {
+	q := NewWithOptions(Options{Growth: Adaptive(4, 1024)})
+	for i := 0; i < 10000; i++ {
+		q.Push(i)
+	}
+	if s := cap(q.tail.v); s != 1024 {
+		t.Errorf("Expected: 1024 as the queue grew to 10000 values; Got: %d", s)
+	}
+
+	// Keep the queue length at 32, so the high-watermark decays and the nodes shrink.
+	for q.Len() > 32 {
+		q.Pop()
+	}
+	for i := 0; i < 100000; i++ {
+		q.Push(i)
+		q.Pop()
+	}
+	if s := cap(q.tail.v); s != 4 {
+		t.Errorf("Expected: 4 as the queue length settled at 32 values; Got: %d", s)
+	}
+}
+
+func TestQueueImpl8WithUnboundedAdaptivePolicyShouldFollowHighWatermark(t *testing.T) {
+	q := NewWithOptions(Options{Growth: Adaptive(4, 0)})
+	for i := 0; i < 10000; i++ {
+		q.Push(i)
+	}
+	if s := cap(q.tail.v); s != 2048 {
+		t.Errorf("Expected: 2048 as the queue grew to 10000 values; Got: %d", s)
+	}
+}
+
+func TestQueueImpl8WithAdaptivePolicyShouldTreatMaxSmallerThanMinAsMin(t *testing.T) {
+	q := NewWithOptions(Options{Growth: Adaptive(16, 8)})
+	for i := 0; i < 10000; i++ {
+		q.Push(i)
+	}
+
+	for i, s := range nodeSizes(q) {
+		if s != 16 {
+			t.Fatalf("Expected: node %d size 16; Got: %d", i, s)
+		}
+	}
+}
+
+func TestQueueImpl8WithInvalidNodeSizeShouldAllocateSingleValueNodes(t *testing.T) {
+	q := NewWithOptions(Options{Growth: Fixed(-1)})
+	q.Push(1)
+	q.Push(2)
+
+	sizes := nodeSizes(q)
+	if len(sizes) != 2 || sizes[0] != 1 || sizes[1] != 1 {
+		t.Errorf("Expected: 2 nodes of size 1; Got: %v", sizes)
+	}
+}
+
+func TestQueueImpl8PoolAllocatorShouldOnlyReuseSameSizeNodes(t *testing.T) {
+	a := &PoolAllocator{}
+	a.FreeNode(a.AllocNode(16))
+
+	for i := 0; i < 10; i++ {
+		if n := a.AllocNode(32); cap(n.v) != 32 {
+			t.Errorf("Expected: 32; Got: %d", cap(n.v))
+		}
+	}
+}
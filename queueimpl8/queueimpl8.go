@@ -0,0 +1,268 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package queueimpl8 implements an unbounded, dynamically growing FIFO queue.
+// Internally, queue store the values in fixed sized slices that are linked using a singly linked list.
+// This implementation tests the queue performance when allocating and freeing the internal nodes
+// using a configurable allocator, isolating the allocation strategy from the queue structure,
+// and when sizing the nodes using a configurable growth policy.
+// Otherwise this is the same implementation as queueimpl3.
+package queueimpl8
+
+import (
+	"sync"
+)
+
+const (
+	// internalSliceSize holds the size of each internal slice with the default growth policy.
+	internalSliceSize = 128
+)
+
+// Queueimpl8 represents an unbounded, dynamically growing FIFO queue.
+type Queueimpl8 struct {
+	// Head points to the first node of the linked list.
+	head *Node
+
+	// Tail points to the last node of the linked list.
+	// In an empty queue, head and tail points to the same node.
+	tail *Node
+
+	// Pos is the index pointing to the current first element in the queue
+	// (i.e. first element added in the current queue values).
+	pos int
+
+	// Len holds the current queue length.
+	len int
+
+	// a allocates and frees the queue nodes.
+	a Allocator
+
+	// g decides the size of the queue nodes.
+	g GrowthPolicy
+}
+
+// Options holds the queue options.
+type Options struct {
+	// Allocator allocates and frees the queue nodes.
+	// If nil, nodes are allocated using a GCAllocator.
+	Allocator Allocator
+
+	// Growth decides the size of the queue nodes.
+	// If nil, all nodes hold 128 values.
+	Growth GrowthPolicy
+}
+
+// Node represents a queue node.
+// Each node holds an slice of user managed values.
+type Node struct {
+	// v holds the list of user added values in this node.
+	v []interface{}
+
+	// n points to the next node in the linked list.
+	n *Node
+}
+
+// Allocator allocates and frees the queue nodes.
+type Allocator interface {
+	// AllocNode returns a node holding an empty slice with capacity size.
+	AllocNode(size int) *Node
+
+	// FreeNode is called when n is no longer referenced by the queue.
+	// All n values were cleared already.
+	FreeNode(n *Node)
+}
+
+// resetter is implemented by allocators that are able to release all their nodes at once.
+type resetter interface {
+	// Reset releases all nodes allocated so far.
+	Reset()
+}
+
+// GCAllocator is an allocator that allocates nodes from the heap and leaves
+// freeing them to the garbage collector.
+type GCAllocator struct{}
+
+// AllocNode returns a newly allocated node.
+func (GCAllocator) AllocNode(size int) *Node {
+	return newNode(size)
+}
+
+// FreeNode does nothing as the node is collected by the garbage collector.
+func (GCAllocator) FreeNode(n *Node) {}
+
+// PoolAllocator is an allocator that recycles freed nodes using a sync.Pool.
+// Recycled nodes are only reused for nodes of the same size; the other ones are discarded.
+// The zero value for PoolAllocator is ready to use.
+// A PoolAllocator can be safely shared by multiple queues.
+type PoolAllocator struct {
+	// p holds the freed nodes.
+	p sync.Pool
+}
+
+// AllocNode returns a node from the pool, or a newly allocated one if the pool is empty
+// or its next node has a different size.
+func (a *PoolAllocator) AllocNode(size int) *Node {
+	if n, ok := a.p.Get().(*Node); ok && cap(n.v) == size {
+		return n
+	}
+	return newNode(size)
+}
+
+// FreeNode returns node n to the pool.
+func (a *PoolAllocator) FreeNode(n *Node) {
+	n.v = n.v[:0]
+	n.n = nil
+	a.p.Put(n)
+}
+
+// New returns an initialized queue that allocates nodes using a GCAllocator.
+func New() *Queueimpl8 {
+	return NewWithAllocator(GCAllocator{})
+}
+
+// NewWithAllocator returns an initialized queue that allocates nodes using allocator a.
+func NewWithAllocator(a Allocator) *Queueimpl8 {
+	return NewWithOptions(Options{Allocator: a})
+}
+
+// NewWithOptions returns an initialized queue using options o.
+func NewWithOptions(o Options) *Queueimpl8 {
+	q := new(Queueimpl8)
+	q.a = o.Allocator
+	q.g = o.Growth
+	return q.Init()
+}
+
+// Init initializes or clears queue q.
+// The nodes of a non-empty queue q are not returned to the allocator; use Reset for that.
+func (q *Queueimpl8) Init() *Queueimpl8 {
+	if q.a == nil {
+		q.a = GCAllocator{}
+	}
+	if q.g == nil {
+		q.g = Fixed(internalSliceSize)
+	}
+	q.pos = 0
+	q.len = 0
+	n := q.a.AllocNode(q.nodeSize(0))
+	q.head = n
+	q.tail = n
+	return q
+}
+
+// Reset clears queue q, releasing all its nodes.
+// If the queue allocator is able to release all its nodes at once (e.g. ArenaAllocator),
+// the nodes are released in a single operation; otherwise, each node is cleared and then
+// freed individually.
+// The complexity is O(1) if the allocator releases all nodes at once; O(n) otherwise.
+func (q *Queueimpl8) Reset() {
+	if r, ok := q.a.(resetter); ok {
+		q.head = nil
+		q.tail = nil
+		r.Reset()
+	} else {
+		for n := q.head; n != nil; {
+			next := n.n
+			for i := range n.v {
+				n.v[i] = nil // Avoid memory leaks
+			}
+			n.n = nil // Avoid memory leaks
+			q.a.FreeNode(n)
+			n = next
+		}
+	}
+	q.Init()
+}
+
+// Len returns the number of elements of queue q.
+// The complexity is O(1).
+func (q *Queueimpl8) Len() int { return q.len }
+
+// Front returns the first element of queue q or nil if the queue is empty.
+// The second, bool result indicates whether a valid value was returned;
+//   if the queue is empty, false will be returned.
+// The complexity is O(1).
+func (q *Queueimpl8) Front() (interface{}, bool) {
+	if q.len == 0 {
+		return nil, false
+	}
+
+	return q.head.v[q.pos], true
+}
+
+// Push adds a value to the queue.
+// The complexity is O(1), not counting the cost of the allocator and growth policy.
+func (q *Queueimpl8) Push(v interface{}) {
+	if len(q.tail.v) >= cap(q.tail.v) {
+		n := q.a.AllocNode(q.nodeSize(cap(q.tail.v)))
+		q.tail.n = n
+		q.tail = n
+	}
+
+	q.tail.v = append(q.tail.v, v)
+	q.len++
+}
+
+// Pop retrieves and removes the next element from the queue.
+// The second, bool result indicates whether a valid value was returned;
+//   if the queue is empty, false will be returned.
+// The complexity is O(1), not counting the cost of the allocator.
+func (q *Queueimpl8) Pop() (interface{}, bool) {
+	if q.len == 0 {
+		return nil, false
+	}
+
+	v := q.head.v[q.pos]
+	q.head.v[q.pos] = nil // Avoid memory leaks
+	q.len--
+
+	if q.pos >= cap(q.head.v)-1 {
+		if q.head.n == nil {
+			// The head node is also the tail node and all its values were popped, so reuse it.
+			q.head.v = q.head.v[:0]
+		} else {
+			h := q.head
+			q.head = h.n
+			h.n = nil // Avoid memory leaks
+			q.a.FreeNode(h)
+		}
+		q.pos = 0
+	} else {
+		q.pos++
+	}
+
+	return v, true
+}
+
+// nodeSize returns the size of the next node according to the queue growth policy,
+// given the size of the current tail node, or 0 if there is none.
+func (q *Queueimpl8) nodeSize(last int) int {
+	if size := q.g.NodeSize(last, q.len); size > 1 {
+		return size
+	}
+	return 1
+}
+
+// newNode returns an initialized node holding up to size values.
+func newNode(size int) *Node {
+	return &Node{
+		v: make([]interface{}, 0, size),
+	}
+}
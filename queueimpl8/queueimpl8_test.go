@@ -0,0 +1,260 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package queueimpl8
+
+import (
+	"testing"
+)
+
+// testAllocators holds the allocators the queue is tested with.
+var testAllocators = map[string]func() Allocator{
+	"GCAllocator":   func() Allocator { return GCAllocator{} },
+	"PoolAllocator": func() Allocator { return &PoolAllocator{} },
+}
+
+// countingAllocator is a GCAllocator that validates and counts the freed nodes.
+type countingAllocator struct {
+	GCAllocator
+
+	// t is the test to report invalid freed nodes to.
+	t *testing.T
+
+	// allocs holds the number of allocated nodes.
+	allocs int
+
+	// frees holds the number of freed nodes.
+	frees int
+}
+
+// AllocNode counts and allocates a new node.
+func (a *countingAllocator) AllocNode(size int) *Node {
+	a.allocs++
+	return a.GCAllocator.AllocNode(size)
+}
+
+// FreeNode counts and validates freed node n.
+func (a *countingAllocator) FreeNode(n *Node) {
+	a.frees++
+	if n.n != nil {
+		a.t.Error("Expected: freed node not linked to the next node; Got: linked")
+	}
+	for i, v := range n.v {
+		if v != nil {
+			a.t.Errorf("Expected: freed node values cleared; Got: %d at position %d", v, i)
+		}
+	}
+}
+
+func TestQueueImpl8NewQueueShouldReturnInitiazedInstanceOfQueue(t *testing.T) {
+	q := New()
+
+	if q == nil {
+		t.Error("Expected: new instance of queue; Got: nil")
+	}
+}
+
+func TestQueueImpl8WithNilValuesShouldReturnAllValuesInOrder(t *testing.T) {
+	q := New()
+	q.Push(1)
+	q.Push(nil)
+	q.Push(2)
+	q.Push(nil)
+
+	v, ok := q.Pop()
+	if !ok || v.(int) != 1 {
+		t.Errorf("Expected: 1; Got: %d", v)
+	}
+	v, ok = q.Pop()
+	if !ok || v != nil {
+		t.Errorf("Expected: 1; Got: %d", v)
+	}
+	v, ok = q.Pop()
+	if !ok || v.(int) != 2 {
+		t.Errorf("Expected: 1; Got: %d", v)
+	}
+	v, ok = q.Pop()
+	if !ok || v != nil {
+		t.Errorf("Expected: 1; Got: %d", v)
+	}
+	_, ok = q.Pop()
+	if ok {
+		t.Error("Expected: empty slice (ok=false); Got: ok=true")
+	}
+}
+
+func TestQueueImpl8WithZeroValueAfterInitShouldUseGCAllocator(t *testing.T) {
+	var q Queueimpl8
+	q.Init()
+	q.Push(1)
+
+	if _, ok := q.a.(GCAllocator); !ok {
+		t.Errorf("Expected: GCAllocator; Got: %T", q.a)
+	}
+	if v, ok := q.Pop(); !ok || v.(int) != 1 {
+		t.Errorf("Expected: 1; Got: %d", v)
+	}
+}
+
+func TestQueueImpl8PopShouldFreeDiscardedNodes(t *testing.T) {
+	a := &countingAllocator{t: t}
+	q := NewWithAllocator(a)
+	for i := 0; i < 1000; i++ {
+		q.Push(i)
+	}
+	for i := 0; i < 1000; i++ {
+		q.Pop()
+	}
+
+	// All nodes but the current head node should have been freed.
+	if a.frees != a.allocs-1 {
+		t.Errorf("Expected: %d freed nodes; Got: %d", a.allocs-1, a.frees)
+	}
+}
+
+func TestQueueImpl8ResetShouldFreeAllNodes(t *testing.T) {
+	a := &countingAllocator{t: t}
+	q := NewWithAllocator(a)
+	for i := 0; i < 1000; i++ {
+		q.Push(i)
+	}
+	q.Pop()
+	q.Reset()
+
+	// All nodes but the new head node allocated by Reset should have been freed.
+	if a.frees != a.allocs-1 {
+		t.Errorf("Expected: %d freed nodes; Got: %d", a.allocs-1, a.frees)
+	}
+	if q.Len() != 0 {
+		t.Errorf("Expected: %d; Got: %d", 0, q.Len())
+	}
+	q.Push(1)
+	if v, ok := q.Pop(); !ok || v.(int) != 1 {
+		t.Errorf("Expected: 1; Got: %d", v)
+	}
+}
+
+func TestQueueImpl8PushPopFrontShouldRetrieveAllElementsInOrder(t *testing.T) {
+	tests := map[string]struct {
+		putCount       []int
+		getCount       []int
+		remainingCount int
+	}{
+		"Test 1 item": {
+			putCount:       []int{1},
+			getCount:       []int{1},
+			remainingCount: 0,
+		},
+		"Test 100 items": {
+			putCount:       []int{100},
+			getCount:       []int{100},
+			remainingCount: 0,
+		},
+		"Test 1000 items": {
+			putCount:       []int{1000},
+			getCount:       []int{1000},
+			remainingCount: 0,
+		},
+		"Test sequence 1": {
+			putCount:       []int{1, 2, 100, 101},
+			getCount:       []int{1, 2, 100, 101},
+			remainingCount: 0,
+		},
+		"Test sequence 2": {
+			putCount:       []int{10, 1},
+			getCount:       []int{1, 10},
+			remainingCount: 0,
+		},
+		"Test sequence 3": {
+			putCount:       []int{101, 101},
+			getCount:       []int{100, 101},
+			remainingCount: 1,
+		},
+		"Test sequence 4": {
+			putCount:       []int{1000, 1000, 1001},
+			getCount:       []int{10, 10, 1},
+			remainingCount: 2980,
+		},
+		"Test sequence 5": {
+			putCount:       []int{128, 128, 1},
+			getCount:       []int{128, 128, 1},
+			remainingCount: 0,
+		},
+	}
+
+	for allocatorName, newAllocator := range testAllocators {
+		for name, test := range tests {
+			newAllocator, test := newAllocator, test
+			t.Run(allocatorName+"/"+name, func(t *testing.T) {
+				q := NewWithAllocator(newAllocator())
+				lastPut := 0
+				lastGet := 0
+				var ok bool
+				var v interface{}
+				for count := 0; count < len(test.getCount); count++ {
+					for i := 1; i <= test.putCount[count]; i++ {
+						lastPut++
+						q.Push(lastPut)
+						if v, ok = q.Front(); !ok || v != lastGet+1 {
+							t.Errorf("Expected: %d; Got: %d", lastGet, v)
+						}
+					}
+
+					for i := 1; i <= test.getCount[count]; i++ {
+						lastGet++
+						v, ok = q.Front()
+						if !ok || v.(int) != lastGet {
+							t.Errorf("Expected: %d; Got: %d", lastGet, v)
+						}
+						v, ok = q.Pop()
+						if !ok || v.(int) != lastGet {
+							t.Errorf("Expected: %d; Got: %d", lastGet, v)
+						}
+					}
+				}
+
+				if q.Len() != test.remainingCount {
+					t.Errorf("Expected: %d; Got: %d", test.remainingCount, q.Len())
+				}
+
+				for i := 1; i <= test.remainingCount; i++ {
+					lastGet++
+
+					if v, ok = q.Front(); !ok || v.(int) != lastGet {
+						t.Errorf("Expected: %d; Got: %d", lastGet, v)
+					}
+					v, ok = q.Pop()
+					if !ok || v.(int) != lastGet {
+						t.Errorf("Expected: %d; Got: %d", lastGet, v)
+					}
+				}
+				if v, ok = q.Front(); ok || v != nil {
+					t.Errorf("Expected: nil as the queue should be empty; Got: %d", v)
+				}
+				if v, ok = q.Pop(); ok || v != nil {
+					t.Errorf("Expected: nil as the queue should be empty; Got: %d", v)
+				}
+				if q.Len() != 0 {
+					t.Errorf("Expected: %d; Got: %d", 0, q.Len())
+				}
+			})
+		}
+	}
+}
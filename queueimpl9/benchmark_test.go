@@ -0,0 +1,112 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+//go:build queueunsafe
+// +build queueunsafe
+
+package queueimpl9
+
+import (
+	"runtime"
+	"strconv"
+	"testing"
+
+	"github.com/christianrpetrin/queue-tests/queueimpl3"
+	"github.com/christianrpetrin/queue-tests/queuetest"
+)
+
+// benchImpl describes an implementation probed by the benchmark tests.
+type benchImpl struct {
+	// name is the name of the sub-benchmark probing the implementation.
+	name string
+
+	// new returns a new, empty queue.
+	new func() queuetest.Queue
+}
+
+var (
+	// benchImpls holds the probed implementations: queueimpl3, which stores interface{}
+	// values, as the baseline, and this implementation.
+	benchImpls = []benchImpl{
+		{name: "Impl3", new: func() queuetest.Queue { return queueimpl3.New() }},
+		{name: "Impl9", new: func() queuetest.Queue { return New() }},
+	}
+
+	// lengths holds the queue lengths probed by the benchmark tests.
+	lengths = []int{100, 10000, 1000000}
+
+	// value holds the value pushed by the benchmark tests, boxed only once.
+	value interface{} = new(int)
+
+	// Used to store temp values, avoiding any compiler optimizations.
+	tmp  interface{}
+	tmp2 bool
+)
+
+// BenchmarkScan probes the time taken by a full garbage collection while a queue holding
+// l values is alive. All values point to the same object, isolating the time taken to scan
+// the queue slots from the time taken to mark the values.
+func BenchmarkScan(b *testing.B) {
+	for _, i := range benchImpls {
+		for _, l := range lengths {
+			i, l := i, l
+			b.Run(i.name+"/"+strconv.Itoa(l), func(b *testing.B) {
+				tmp = nil // Release the queues left by the other benchmark tests
+				q := i.new()
+				for j := 0; j < l; j++ {
+					q.Push(value)
+				}
+				runtime.GC()
+				b.ResetTimer()
+
+				for n := 0; n < b.N; n++ {
+					runtime.GC()
+				}
+
+				b.StopTimer()
+				runtime.KeepAlive(q)
+			})
+		}
+	}
+}
+
+// BenchmarkFillDrain probes pushing l values to a long lived queue and then popping all of them,
+// accounting for the cost of splitting and rebuilding the interface{} values.
+func BenchmarkFillDrain(b *testing.B) {
+	for _, i := range benchImpls {
+		for _, l := range lengths[:2] {
+			i, l := i, l
+			b.Run(i.name+"/"+strconv.Itoa(l), func(b *testing.B) {
+				q := i.new()
+				b.ReportAllocs()
+				b.ResetTimer()
+
+				for n := 0; n < b.N; n++ {
+					for j := 0; j < l; j++ {
+						q.Push(value)
+					}
+					for q.Len() > 0 {
+						tmp, tmp2 = q.Pop()
+					}
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,35 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package queueimpl9 implements an experimental unbounded, dynamically growing FIFO queue
+// holding pointer-shaped values (pointers, maps, channels, funcs and unsafe.Pointers) of a
+// single dynamic type.
+// Internally, queue store the values in fixed sized slices that are linked using a singly linked list.
+// This implementation tests the queue memory footprint and garbage collector scan time when
+// splitting each interface{} value into its type and data words, storing the type word once
+// per queue and only the data word, an unsafe.Pointer, in each slot. This halves the size of
+// each slot compared to an interface{} slot, at the cost of all values sharing the same type.
+// Otherwise this is the same Push and Pop implementation as queueimpl3.
+//
+// As it relies on the interface{} memory layout, which is not covered by the Go 1
+// compatibility promise, the implementation is only built with the queueunsafe build tag:
+//
+//	go test -tags queueunsafe -benchmem -bench=. ./queueimpl9
+package queueimpl9
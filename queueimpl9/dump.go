@@ -0,0 +1,65 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+//go:build queueunsafe
+// +build queueunsafe
+
+package queueimpl9
+
+import (
+	"io"
+
+	"github.com/christianrpetrin/queue-tests/dump"
+)
+
+// String returns the summary of the internal shape of queue q: its length, node count,
+// capacity and utilization.
+// The complexity is O(n/128).
+func (q *Queueimpl9) String() string {
+	return dump.String("queueimpl9", q.Len(), q.nodes(false))
+}
+
+// Dump writes the internal shape of queue q to w: its summary, followed by the length,
+// capacity and utilization of each node and, if preview is not nil, the first values of
+// each node, formatted using preview. See package dump for the format.
+// The queue is not modified.
+// The complexity is O(n/128), not counting the cost of preview.
+func (q *Queueimpl9) Dump(w io.Writer, preview func(v interface{}) string) error {
+	return dump.Write(w, "queueimpl9", q.Len(), q.nodes(preview != nil), preview)
+}
+
+// nodes describes the nodes of queue q, from the first to the last one, including the
+// first dump.MaxPreviews values of each node if values is true.
+func (q *Queueimpl9) nodes(values bool) []dump.Node {
+	var nodes []dump.Node
+	for n, pos := q.head, q.pos; n != nil; n, pos = n.n, 0 {
+		d := dump.Node{Len: len(n.v) - pos, Cap: cap(n.v)}
+		if values {
+			for _, p := range n.v[pos:] {
+				if len(d.Values) == dump.MaxPreviews {
+					break
+				}
+				d.Values = append(d.Values, q.value(p))
+			}
+		}
+		nodes = append(nodes, d)
+	}
+	return nodes
+}
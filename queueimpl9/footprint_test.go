@@ -0,0 +1,58 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+//go:build queueunsafe && go1.13
+// +build queueunsafe,go1.13
+
+package queueimpl9
+
+import (
+	"runtime"
+	"strconv"
+	"testing"
+)
+
+// BenchmarkFootprint probes the memory allocated by the queue internals to hold l values,
+// reported per value as B/value.
+func BenchmarkFootprint(b *testing.B) {
+	for _, i := range benchImpls {
+		for _, l := range lengths {
+			i, l := i, l
+			b.Run(i.name+"/"+strconv.Itoa(l), func(b *testing.B) {
+				b.ReportAllocs()
+				var before, after runtime.MemStats
+				runtime.ReadMemStats(&before)
+				b.ResetTimer()
+
+				for n := 0; n < b.N; n++ {
+					q := i.new()
+					for j := 0; j < l; j++ {
+						q.Push(value)
+					}
+					tmp = q
+				}
+
+				b.StopTimer()
+				runtime.ReadMemStats(&after)
+				b.ReportMetric(float64(after.TotalAlloc-before.TotalAlloc)/float64(b.N*l), "B/value")
+			})
+		}
+	}
+}
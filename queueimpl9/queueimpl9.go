@@ -0,0 +1,198 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+//go:build queueunsafe
+// +build queueunsafe
+
+package queueimpl9
+
+import (
+	"fmt"
+	"reflect"
+	"unsafe"
+)
+
+const (
+	// internalSliceSize holds the size of each internal slice.
+	internalSliceSize = 128
+)
+
+// Queueimpl9 represents an unbounded, dynamically growing FIFO queue of pointer-shaped values.
+// The zero value for queue is an empty queue ready to use.
+type Queueimpl9 struct {
+	// Head points to the first node of the linked list.
+	head *Node
+
+	// Tail points to the last node of the linked list.
+	// In an empty queue, head and tail points to the same node,
+	// or are both nil if no value was ever added to the queue.
+	tail *Node
+
+	// Pos is the index pointing to the current first element in the queue
+	// (i.e. first element added in the current queue values).
+	pos int
+
+	// Len holds the current queue length.
+	len int
+
+	// typ holds the type word shared by all values of the queue, recorded by the first Push;
+	// or nil if no value was added since the queue was initialized.
+	typ unsafe.Pointer
+}
+
+// Node represents a queue node.
+// Each node holds an slice of the data words of the user managed values.
+type Node struct {
+	// v holds the data words of the user added values in this node.
+	v []unsafe.Pointer
+
+	// n points to the next node in the linked list.
+	n *Node
+}
+
+// eface mirrors the runtime representation of an interface{} value.
+type eface struct {
+	// typ points to the dynamic type of the value.
+	typ unsafe.Pointer
+
+	// data holds the value itself for pointer-shaped types.
+	data unsafe.Pointer
+}
+
+// New returns an initialized queue.
+func New() *Queueimpl9 {
+	return new(Queueimpl9).Init()
+}
+
+// Init initializes or clears queue q.
+// The queue forgets the type of its values, so values of any pointer-shaped type can be added afterwards.
+// The first node is only allocated when the first value is added to the queue.
+func (q *Queueimpl9) Init() *Queueimpl9 {
+	q.head = nil
+	q.tail = nil
+	q.pos = 0
+	q.len = 0
+	q.typ = nil
+	return q
+}
+
+// Len returns the number of elements of queue q.
+// The complexity is O(1).
+func (q *Queueimpl9) Len() int { return q.len }
+
+// Front returns the first element of queue q or nil if the queue is empty.
+// The second, bool result indicates whether a valid value was returned;
+//   if the queue is empty, false will be returned.
+// The complexity is O(1).
+func (q *Queueimpl9) Front() (interface{}, bool) {
+	if q.len == 0 {
+		return nil, false
+	}
+
+	return q.value(q.head.v[q.pos]), true
+}
+
+// Push adds a value to the queue.
+// V must be pointer-shaped and, once the queue holds a value, have the same dynamic type as
+// the values added before it since the queue was initialized; otherwise, Push panics.
+// The complexity is O(1) as the underlying slice append uses always have enough capacity.
+func (q *Queueimpl9) Push(v interface{}) {
+	e := (*eface)(unsafe.Pointer(&v))
+	if e.typ != q.typ || e.typ == nil {
+		q.setType(v)
+	}
+
+	if q.head == nil || len(q.tail.v) >= internalSliceSize {
+		n := newNode()
+		if q.head == nil {
+			q.head = n
+		} else {
+			q.tail.n = n
+		}
+		q.tail = n
+	}
+
+	q.tail.v = append(q.tail.v, e.data)
+	q.len++
+}
+
+// Pop retrieves and removes the next element from the queue.
+// The second, bool result indicates whether a valid value was returned;
+//   if the queue is empty, false will be returned.
+// The complexity is O(1).
+func (q *Queueimpl9) Pop() (interface{}, bool) {
+	if q.len == 0 {
+		return nil, false
+	}
+
+	v := q.head.v[q.pos]
+	q.head.v[q.pos] = nil // Avoid memory leaks
+	q.len--
+
+	if q.pos >= len(q.head.v)-1 {
+		if q.head.n == nil {
+			// The head node is also the tail node and all its values were popped, so reuse it.
+			q.head.v = q.head.v[:0]
+		} else {
+			h := q.head
+			q.head = h.n
+			h.n = nil // Avoid memory leaks
+		}
+		q.pos = 0
+	} else {
+		q.pos++
+	}
+
+	return q.value(v), true
+}
+
+// setType records the dynamic type of value v as the type of the queue values.
+// It panics if v is not pointer-shaped, or if the queue holds values of another type already.
+func (q *Queueimpl9) setType(v interface{}) {
+	t := reflect.TypeOf(v)
+	if t == nil {
+		panic("queueimpl9: push of untyped nil value")
+	}
+	if q.typ != nil {
+		panic(fmt.Sprintf("queueimpl9: push of %v value to a queue of %v values", t, reflect.TypeOf(q.value(nil))))
+	}
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Chan, reflect.Func, reflect.UnsafePointer:
+	default:
+		panic(fmt.Sprintf("queueimpl9: push of %v value, which is not pointer-shaped", t))
+	}
+	q.typ = (*eface)(unsafe.Pointer(&v)).typ
+}
+
+// value returns the interface{} value of the queue type holding data word p.
+func (q *Queueimpl9) value(p unsafe.Pointer) interface{} {
+	var v interface{}
+	e := (*eface)(unsafe.Pointer(&v))
+	e.typ = q.typ
+	e.data = p
+	return v
+}
+
+// newNode returns an initialized node.
+func newNode() *Node {
+	return &Node{
+		v: make([]unsafe.Pointer, 0, internalSliceSize),
+	}
+}
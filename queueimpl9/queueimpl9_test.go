@@ -0,0 +1,188 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+//go:build queueunsafe
+// +build queueunsafe
+
+package queueimpl9
+
+import (
+	"runtime"
+	"testing"
+	"time"
+	"unsafe"
+
+	"github.com/christianrpetrin/queue-tests/queuetest"
+)
+
+func TestQueueImpl9NewQueueShouldReturnInitiazedInstanceOfQueue(t *testing.T) {
+	q := New()
+
+	if q == nil {
+		t.Error("Expected: new instance of queue; Got: nil")
+	}
+}
+
+func TestQueueImpl9WithZeroValueAndEmptyShouldReturnAsEmpty(t *testing.T) {
+	var q Queueimpl9
+	if _, ok := q.Front(); ok {
+		t.Error("Expected: false as the queue is empty; Got: true")
+	}
+	if _, ok := q.Pop(); ok {
+		t.Error("Expected: false as the queue is empty; Got: true")
+	}
+	if l := q.Len(); l != 0 {
+		t.Errorf("Expected: 0 as the queue is empty; Got: %d", l)
+	}
+}
+
+func TestQueueImpl9ShouldRetrieveAllElementsInOrder(t *testing.T) {
+	var q Queueimpl9
+	vs := make([]int, 1000)
+	for i := range vs {
+		vs[i] = i
+		q.Push(&vs[i])
+	}
+	if l := q.Len(); l != len(vs) {
+		t.Errorf("Expected: %d; Got: %d", len(vs), l)
+	}
+
+	for i := range vs {
+		if v, ok := q.Front(); !ok || v.(*int) != &vs[i] {
+			t.Errorf("Expected: %d; Got: %v", i, v)
+		}
+		if v, ok := q.Pop(); !ok || v.(*int) != &vs[i] || *v.(*int) != i {
+			t.Errorf("Expected: %d; Got: %v", i, v)
+		}
+	}
+	if v, ok := q.Pop(); ok || v != nil {
+		t.Errorf("Expected: nil as the queue should be empty; Got: %v", v)
+	}
+}
+
+func TestQueueImpl9WithPointerShapedValuesShouldRetrieveSameValues(t *testing.T) {
+	m := map[int]int{1: 1}
+	c := make(chan int, 1)
+	f := func() int { return 1 }
+	var i int
+	p := unsafe.Pointer(&i)
+	var n *int
+
+	tests := []struct {
+		name  string
+		v     interface{}
+		check func(v interface{}) bool
+	}{
+		{name: "map", v: m, check: func(v interface{}) bool { return v.(map[int]int)[1] == 1 }},
+		{name: "chan", v: c, check: func(v interface{}) bool { return v.(chan int) == c }},
+		{name: "func", v: f, check: func(v interface{}) bool { return v.(func() int)() == 1 }},
+		{name: "unsafe.Pointer", v: p, check: func(v interface{}) bool { return v.(unsafe.Pointer) == p }},
+		{name: "nil pointer", v: n, check: func(v interface{}) bool { return v != nil && v.(*int) == nil }},
+	}
+	for _, test := range tests {
+		q := New()
+		q.Push(test.v)
+		if v, ok := q.Pop(); !ok || !test.check(v) {
+			t.Errorf("%s: Expected: %v; Got: %v", test.name, test.v, v)
+		}
+	}
+}
+
+func TestQueueImpl9PushWithInvalidValueShouldPanic(t *testing.T) {
+	var i int
+	tests := []struct {
+		name string
+		q    *Queueimpl9
+		v    interface{}
+	}{
+		{name: "untyped nil", q: New(), v: nil},
+		{name: "not pointer-shaped", q: New(), v: 1},
+		{name: "struct", q: New(), v: struct{ p *int }{p: &i}},
+		{name: "different type", q: func() *Queueimpl9 { q := New(); q.Push(&i); return q }(), v: new(string)},
+		{name: "untyped nil after value", q: func() *Queueimpl9 { q := New(); q.Push(&i); return q }(), v: nil},
+	}
+	for _, test := range tests {
+		func() {
+			defer func() {
+				if r := recover(); r == nil {
+					t.Errorf("%s: Expected: panic; Got: no panic", test.name)
+				}
+			}()
+			test.q.Push(test.v)
+		}()
+	}
+}
+
+func TestQueueImpl9InitShouldAcceptValuesOfAnotherType(t *testing.T) {
+	q := New()
+	q.Push(new(int))
+	q.Init()
+	if l := q.Len(); l != 0 {
+		t.Errorf("Expected: 0 as the queue was cleared; Got: %d", l)
+	}
+
+	s := "1"
+	q.Push(&s)
+	if v, ok := q.Pop(); !ok || *v.(*string) != s {
+		t.Errorf("Expected: %s; Got: %v", s, v)
+	}
+}
+
+func TestQueueImpl9ShouldKeepQueuedValuesAlive(t *testing.T) {
+	q := New()
+	var f queuetest.Finalizers
+	for i := 0; i < queuetest.LeakTestCount; i++ {
+		q.Push(f.NewValue(0))
+	}
+
+	// The values are only referenced by the unsafe.Pointer slots, which the garbage
+	// collector must scan.
+	for i := 0; i < 3; i++ {
+		runtime.GC()
+		time.Sleep(10 * time.Millisecond)
+	}
+	if r := f.Released(); r != 0 {
+		t.Errorf("Expected: 0 released values as all values are queued; Got: %d", r)
+	}
+	for i := 0; i < queuetest.LeakTestCount; i++ {
+		if _, ok := q.Pop(); !ok {
+			t.Fatalf("Expected: value %d; Got: empty queue", i)
+		}
+	}
+	runtime.KeepAlive(q)
+}
+
+func TestQueueImpl9PopShouldReleasePoppedValues(t *testing.T) {
+	q := New()
+	var f queuetest.Finalizers
+	for i := 0; i < queuetest.LeakTestCount; i++ {
+		q.Push(f.NewValue(0))
+	}
+	for i := 0; i < queuetest.LeakTestCount; i++ {
+		if _, ok := q.Pop(); !ok {
+			t.Fatalf("Expected: value %d; Got: empty queue", i)
+		}
+	}
+
+	if r := f.Wait(queuetest.LeakTestCount); r != queuetest.LeakTestCount {
+		t.Errorf("Expected: %d released values; Got: %d", queuetest.LeakTestCount, r)
+	}
+	runtime.KeepAlive(q)
+}
@@ -0,0 +1,302 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package queuetest
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// ConcurrentQueue is the set of operations the concurrent checks need from an implementation.
+// Push must be safe for concurrent use by multiple goroutines, and so must Pop, unless the
+// implementation only supports a single consumer.
+type ConcurrentQueue interface {
+	// Push adds a value to the queue.
+	Push(v interface{})
+
+	// Pop retrieves and removes the next element from the queue.
+	Pop() (interface{}, bool)
+}
+
+// ConcurrentImpl describes a concurrent queue implementation under test.
+type ConcurrentImpl struct {
+	// Name is the implementation name, used in the failure messages.
+	Name string
+
+	// New returns a new, empty queue.
+	New func() ConcurrentQueue
+
+	// SingleConsumer indicates Pop must only be called by a single goroutine at a time.
+	SingleConsumer bool
+}
+
+// producerValue is a value pushed by the concurrent checks.
+type producerValue struct {
+	// producer holds the index of the producer that pushed the value.
+	producer int
+
+	// seq holds the index of the value among the values pushed by the producer.
+	seq int
+}
+
+// CheckProducerOrder checks that the values pushed concurrently by producers goroutines, items
+// values each, while consumers goroutines pop them concurrently, are all popped exactly once,
+// and that each consumer pops the values of each producer in the order they were pushed, i.e.
+// values from the same producer are never reordered. Consumers is treated as 1 for single
+// consumer implementations. Failures are reported to t.
+func CheckProducerOrder(t *testing.T, impl ConcurrentImpl, producers, consumers, items int) {
+	if err := checkProducerOrder(impl, producers, consumers, items); err != nil {
+		t.Errorf("%s: %v", impl.Name, err)
+	}
+}
+
+// checkProducerOrder runs CheckProducerOrder, returning an error describing the first
+// failure, if any.
+func checkProducerOrder(impl ConcurrentImpl, producers, consumers, items int) error {
+	if impl.SingleConsumer || consumers < 1 {
+		consumers = 1
+	}
+	q := impl.New()
+	total := producers * items
+
+	var wg sync.WaitGroup
+	for p := 0; p < producers; p++ {
+		wg.Add(1)
+		go func(p int) {
+			defer wg.Done()
+			for i := 0; i < items; i++ {
+				q.Push(producerValue{producer: p, seq: i})
+			}
+		}(p)
+	}
+
+	// popped holds the number of times each value was popped, indexed by producer and seq.
+	popped := make([][]int, producers)
+	for p := range popped {
+		popped[p] = make([]int, items)
+	}
+	var mu sync.Mutex
+	var count int
+	errs := make([]error, consumers)
+	for c := 0; c < consumers; c++ {
+		wg.Add(1)
+		go func(c int) {
+			defer wg.Done()
+			last := make([]int, producers)
+			for p := range last {
+				last[p] = -1
+			}
+			for {
+				mu.Lock()
+				done := count == total
+				mu.Unlock()
+				if done {
+					return
+				}
+
+				v, ok := q.Pop()
+				if !ok {
+					runtime.Gosched()
+					continue
+				}
+				pv, ok := v.(producerValue)
+				if !ok {
+					errs[c] = fmt.Errorf("consumer %d: Expected: a pushed value; Got: %v", c, v)
+					return
+				}
+
+				mu.Lock()
+				popped[pv.producer][pv.seq]++
+				count++
+				mu.Unlock()
+				if pv.seq <= last[pv.producer] && errs[c] == nil {
+					errs[c] = fmt.Errorf("consumer %d: Expected: producer %d value after %d; Got: %d",
+						c, pv.producer, last[pv.producer], pv.seq)
+				}
+				last[pv.producer] = pv.seq
+			}
+		}(c)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	for p := range popped {
+		for i, n := range popped[p] {
+			if n != 1 {
+				return fmt.Errorf("Expected: producer %d value %d popped once; Got: %d times", p, i, n)
+			}
+		}
+	}
+	return nil
+}
+
+// ResetQueue is the set of operations CheckConcurrentReset needs from an implementation.
+// All operations must be safe for concurrent use by multiple goroutines.
+type ResetQueue interface {
+	ConcurrentQueue
+
+	// Reset removes all elements from the queue, returning them from the first to the last one.
+	Reset() []interface{}
+}
+
+// CheckConcurrentReset checks that the values pushed concurrently by producers goroutines,
+// items values each, while a consumer pops them and another one removes them using Reset,
+// are all retrieved exactly once, and that each consumer retrieves the values of each producer
+// in the order they were pushed. The name of the implementation under test is used in the
+// failure messages, which are reported to t.
+func CheckConcurrentReset(t *testing.T, name string, q ResetQueue, producers, items int) {
+	if err := checkConcurrentReset(q, producers, items); err != nil {
+		t.Errorf("%s: %v", name, err)
+	}
+}
+
+// checkConcurrentReset runs CheckConcurrentReset, returning an error describing the first
+// failure, if any.
+func checkConcurrentReset(q ResetQueue, producers, items int) error {
+	var wg sync.WaitGroup
+	for p := 0; p < producers; p++ {
+		wg.Add(1)
+		go func(p int) {
+			defer wg.Done()
+			for i := 0; i < items; i++ {
+				q.Push(producerValue{producer: p, seq: i})
+			}
+		}(p)
+	}
+
+	var retrieved int64
+	total := int64(producers * items)
+	consumers := []func() []interface{}{
+		func() []interface{} {
+			if v, ok := q.Pop(); ok {
+				return []interface{}{v}
+			}
+			return nil
+		},
+		q.Reset,
+	}
+	got := make([][]interface{}, len(consumers))
+	for c, retrieve := range consumers {
+		wg.Add(1)
+		go func(c int, retrieve func() []interface{}) {
+			defer wg.Done()
+			for atomic.LoadInt64(&retrieved) < total {
+				vs := retrieve()
+				if len(vs) == 0 {
+					runtime.Gosched()
+					continue
+				}
+				got[c] = append(got[c], vs...)
+				atomic.AddInt64(&retrieved, int64(len(vs)))
+			}
+		}(c, retrieve)
+	}
+	wg.Wait()
+
+	// retrievals holds the number of times each value was retrieved, indexed by producer and seq.
+	retrievals := make([][]int, producers)
+	for p := range retrievals {
+		retrievals[p] = make([]int, items)
+	}
+	for c := range got {
+		last := make([]int, producers)
+		for p := range last {
+			last[p] = -1
+		}
+		for _, v := range got[c] {
+			pv, ok := v.(producerValue)
+			if !ok {
+				return fmt.Errorf("consumer %d: Expected: a pushed value; Got: %v", c, v)
+			}
+			if pv.seq <= last[pv.producer] {
+				return fmt.Errorf("consumer %d: Expected: producer %d value after %d; Got: %d",
+					c, pv.producer, last[pv.producer], pv.seq)
+			}
+			last[pv.producer] = pv.seq
+			retrievals[pv.producer][pv.seq]++
+		}
+	}
+	for p := range retrievals {
+		for i, n := range retrievals[p] {
+			if n != 1 {
+				return fmt.Errorf("Expected: producer %d value %d retrieved once; Got: %d times", p, i, n)
+			}
+		}
+	}
+	return nil
+}
+
+// Fairness measures how fairly implementation impl orders the values pushed concurrently by
+// producers goroutines, items values each, returning Jain's fairness index of the number of
+// values of each producer among the first half of the popped values: 1 means all producers
+// got the same share of the first half, while 1/producers means a single producer got it all,
+// e.g. because the other ones were starved while trying to push.
+// Producers yield after each push, so the measure reflects the queue rather than the goroutine
+// scheduler time slices; in particular, producers interleave even when GOMAXPROCS is 1.
+func Fairness(impl ConcurrentImpl, producers, items int) float64 {
+	q := impl.New()
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	for p := 0; p < producers; p++ {
+		wg.Add(1)
+		go func(p int) {
+			defer wg.Done()
+			<-start
+			for i := 0; i < items; i++ {
+				q.Push(producerValue{producer: p, seq: i})
+				runtime.Gosched()
+			}
+		}(p)
+	}
+	close(start)
+	wg.Wait()
+
+	shares := make([]float64, producers)
+	for i := 0; i < producers*items/2; i++ {
+		v, ok := q.Pop()
+		if !ok {
+			break
+		}
+		shares[v.(producerValue).producer]++
+	}
+	for {
+		if _, ok := q.Pop(); !ok {
+			break
+		}
+	}
+
+	var sum, squares float64
+	for _, s := range shares {
+		sum += s
+		squares += s * s
+	}
+	if squares == 0 {
+		return 0
+	}
+	return sum * sum / (float64(producers) * squares)
+}
@@ -0,0 +1,264 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package queuetest
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/christianrpetrin/queue-tests/blockingqueue"
+	"github.com/christianrpetrin/queue-tests/faaqueue"
+	"github.com/christianrpetrin/queue-tests/fcqueue"
+	"github.com/christianrpetrin/queue-tests/lockfreequeue"
+	"github.com/christianrpetrin/queue-tests/mpscqueue"
+	"github.com/christianrpetrin/queue-tests/safequeue"
+)
+
+const (
+	// concurrentProducers holds the number of producers of the concurrent tests.
+	concurrentProducers = 4
+
+	// concurrentConsumers holds the number of consumers of the concurrent tests.
+	concurrentConsumers = 4
+
+	// concurrentItems holds the number of values pushed by each producer of the concurrent tests.
+	concurrentItems = 10000
+
+	// minFairness holds the minimum fairness index expected from the concurrent implementations.
+	minFairness = 0.9
+)
+
+// blockingQueue adapts a blockingqueue.BlockingQueue to ConcurrentQueue, popping without blocking.
+type blockingQueue struct {
+	*blockingqueue.BlockingQueue
+}
+
+// Pop retrieves and removes the next element from the queue, if any.
+func (q blockingQueue) Pop() (interface{}, bool) { return q.TryPop() }
+
+// mpscElement wraps the values pushed to an mpscqueue.MPSCQueue.
+type mpscElement struct {
+	mpscqueue.Node
+
+	// v holds the pushed value.
+	v interface{}
+}
+
+// mpscQueue adapts an mpscqueue.MPSCQueue to ConcurrentQueue.
+type mpscQueue struct {
+	*mpscqueue.MPSCQueue
+}
+
+// Push adds a value to the queue.
+func (q mpscQueue) Push(v interface{}) { q.MPSCQueue.Push(&mpscElement{v: v}) }
+
+// Pop retrieves and removes the next element from the queue.
+func (q mpscQueue) Pop() (interface{}, bool) {
+	e, ok := q.MPSCQueue.Pop()
+	if !ok {
+		return nil, false
+	}
+	return e.(*mpscElement).v, true
+}
+
+// concurrentImpls returns all concurrent implementations under test.
+// All of them keep the per producer order, and are expected to be fair.
+func concurrentImpls() []ConcurrentImpl {
+	return []ConcurrentImpl{
+		{Name: "safequeue", New: func() ConcurrentQueue { return safequeue.New() }},
+		{Name: "lockfreequeue", New: func() ConcurrentQueue { return lockfreequeue.New() }},
+		{Name: "lockfreequeue/reclamation", New: func() ConcurrentQueue { return lockfreequeue.NewWithReclamation() }},
+		{Name: "faaqueue", New: func() ConcurrentQueue { return faaqueue.New() }},
+		{Name: "faaqueue/reclamation", New: func() ConcurrentQueue { return faaqueue.NewWithReclamation() }},
+		{Name: "fcqueue", New: func() ConcurrentQueue { return fcqueue.New() }},
+		{
+			Name: "blockingqueue",
+			New: func() ConcurrentQueue {
+				return blockingQueue{blockingqueue.New(lockfreequeue.New(), blockingqueue.Park)}
+			},
+		},
+		{Name: "mpscqueue", New: func() ConcurrentQueue { return mpscQueue{mpscqueue.New()} }, SingleConsumer: true},
+	}
+}
+
+func TestProducerOrderShouldHoldForAllConcurrentImplementations(t *testing.T) {
+	for _, impl := range concurrentImpls() {
+		impl := impl
+		t.Run(impl.Name, func(t *testing.T) {
+			CheckProducerOrder(t, impl, concurrentProducers, concurrentConsumers, concurrentItems)
+		})
+	}
+}
+
+func TestFairnessShouldHoldForAllConcurrentImplementations(t *testing.T) {
+	for _, impl := range concurrentImpls() {
+		impl := impl
+		t.Run(impl.Name, func(t *testing.T) {
+			if f := Fairness(impl, concurrentProducers, concurrentItems); f < minFairness {
+				t.Errorf("Expected: fairness index of at least %v; Got: %v", minFairness, f)
+			}
+		})
+	}
+}
+
+// stackQueue is a broken concurrent queue, returning the values in LIFO order.
+type stackQueue struct {
+	// mu guards v.
+	mu sync.Mutex
+
+	// v holds the queue values.
+	v []interface{}
+}
+
+// Push adds a value to the queue.
+func (q *stackQueue) Push(v interface{}) {
+	q.mu.Lock()
+	q.v = append(q.v, v)
+	q.mu.Unlock()
+}
+
+// Pop retrieves and removes the last added element from the queue.
+func (q *stackQueue) Pop() (interface{}, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.v) == 0 {
+		return nil, false
+	}
+	v := q.v[len(q.v)-1]
+	q.v = q.v[:len(q.v)-1]
+	return v, true
+}
+
+// starvingQueue is an unfair concurrent queue, which keeps the producer 0 values in order but
+// only returns them once the values of the other producers were returned.
+type starvingQueue struct {
+	// mu guards others and starved.
+	mu sync.Mutex
+
+	// others holds the values of the producers other than producer 0.
+	others []interface{}
+
+	// starved holds the values of producer 0.
+	starved []interface{}
+}
+
+// Push adds a value to the queue.
+func (q *starvingQueue) Push(v interface{}) {
+	q.mu.Lock()
+	if v.(producerValue).producer == 0 {
+		q.starved = append(q.starved, v)
+	} else {
+		q.others = append(q.others, v)
+	}
+	q.mu.Unlock()
+}
+
+// Pop retrieves and removes the next element from the queue, favoring the other producers.
+func (q *starvingQueue) Pop() (interface{}, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	s := &q.others
+	if len(*s) == 0 {
+		s = &q.starved
+	}
+	if len(*s) == 0 {
+		return nil, false
+	}
+	v := (*s)[0]
+	*s = (*s)[1:]
+	return v, true
+}
+
+func TestCheckProducerOrderShouldDetectReorderedValues(t *testing.T) {
+	err := checkProducerOrder(ConcurrentImpl{Name: "stack", New: func() ConcurrentQueue { return new(stackQueue) }}, 2, 2, 1000)
+	if err == nil {
+		t.Error("Expected: order failure; Got: nil")
+	}
+}
+
+// duplicatingQueue is a broken concurrent queue, returning its first value twice.
+type duplicatingQueue struct {
+	safequeue.SafeQueue
+
+	// pops holds the number of values popped so far.
+	pops *int32
+
+	// first holds the first popped value.
+	first interface{}
+}
+
+// Pop retrieves and removes the next element from the queue, returning the first value again
+// after the tenth pop.
+func (q *duplicatingQueue) Pop() (interface{}, bool) {
+	switch n := atomic.AddInt32(q.pops, 1); {
+	case n == 1:
+		q.first, _ = q.SafeQueue.Pop()
+		return q.first, q.first != nil
+	case n == 10:
+		return q.first, true
+	}
+	return q.SafeQueue.Pop()
+}
+
+func TestCheckProducerOrderShouldDetectDuplicatedValues(t *testing.T) {
+	var pops int32
+	impl := ConcurrentImpl{Name: "duplicating", New: func() ConcurrentQueue { return &duplicatingQueue{pops: &pops} }}
+	if err := checkProducerOrder(impl, 2, 1, 100); err == nil {
+		t.Error("Expected: duplicate failure; Got: nil")
+	}
+}
+
+// duplicatingResetQueue is a broken concurrent queue, whose first Reset returns the first
+// value pushed by producer 0 even if it was popped already.
+type duplicatingResetQueue struct {
+	safequeue.SafeQueue
+
+	// resets holds the number of Reset calls so far.
+	resets int32
+}
+
+// Reset removes all elements from the queue, prepending the first value of producer 0 on
+// the first call.
+func (q *duplicatingResetQueue) Reset() []interface{} {
+	vs := q.SafeQueue.Reset()
+	if atomic.AddInt32(&q.resets, 1) == 1 {
+		vs = append([]interface{}{producerValue{producer: 0, seq: 0}}, vs...)
+	}
+	return vs
+}
+
+func TestCheckConcurrentResetShouldPassForResettableImplementations(t *testing.T) {
+	CheckConcurrentReset(t, "safe", safequeue.New(), concurrentProducers, concurrentItems)
+}
+
+func TestCheckConcurrentResetShouldDetectDuplicatedValues(t *testing.T) {
+	if err := checkConcurrentReset(new(duplicatingResetQueue), 2, 100); err == nil {
+		t.Error("Expected: duplicate failure; Got: nil")
+	}
+}
+
+func TestFairnessShouldDetectStarvedProducers(t *testing.T) {
+	f := Fairness(ConcurrentImpl{Name: "starving", New: func() ConcurrentQueue { return new(starvingQueue) }}, 4, 1000)
+	if f >= minFairness {
+		t.Errorf("Expected: fairness index below %v; Got: %v", minFairness, f)
+	}
+}
@@ -0,0 +1,258 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package queuetest
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// ErrInjectedPanic is the value callbacks panic with when an Injector injects a panic.
+var ErrInjectedPanic = errors.New("queuetest: injected panic")
+
+// FaultPoint identifies the points of the queue operations faults are injected at.
+type FaultPoint uint
+
+const (
+	// BeforePush is the point right before a value is pushed.
+	BeforePush FaultPoint = 1 << iota
+
+	// AfterPush is the point right after a value was pushed.
+	AfterPush
+
+	// BeforePop is the point right before a value is popped.
+	BeforePop
+
+	// AfterPop is the point right after a pop returned, successful or not.
+	AfterPop
+
+	// Inside is the point between the atomic steps of an operation, reached by implementations
+	// calling Injector.Inside from their test hook, e.g. lockfreequeue testHookYield.
+	Inside
+
+	// AllPoints holds all fault points.
+	AllPoints = BeforePush | AfterPush | BeforePop | AfterPop | Inside
+)
+
+// Faults configures the faults injected by an Injector.
+// Probabilities are between 0, never, and 1, always.
+type Faults struct {
+	// Seed seeds the random decisions of whether to inject a fault.
+	// Concurrent goroutines reach the fault points in a non deterministic order, so the same
+	// seed doesn't guarantee the same faults are injected in concurrent tests.
+	Seed int64
+
+	// Points holds the points the preemptions are injected at; 0 means AllPoints.
+	Points FaultPoint
+
+	// Preempt holds the probability of yielding the processor, using runtime.Gosched, at each
+	// fault point, forcing the goroutine to be preempted in the middle of its work.
+	Preempt float64
+
+	// Slow holds the probability of a consumer being delayed by Delay after popping a value,
+	// simulating a slow consumer.
+	Slow float64
+
+	// Delay holds how long a slow consumer is delayed for.
+	Delay time.Duration
+
+	// Panic holds the probability of a callback calling Injector.Callback panicking with
+	// ErrInjectedPanic.
+	Panic float64
+}
+
+// FaultStats holds the number of faults injected by an Injector.
+type FaultStats struct {
+	// Preemptions holds the number of injected preemptions.
+	Preemptions uint64
+
+	// Delays holds the number of delayed consumers.
+	Delays uint64
+
+	// Panics holds the number of injected panics.
+	Panics uint64
+}
+
+// Injector injects faults into the queues and callbacks under test.
+// Injector is safe for concurrent use by multiple goroutines.
+// The zero value for Injector is not ready to use; use NewInjector to create an injector.
+type Injector struct {
+	// state holds the state of the random number generator.
+	// Kept as the first field to guarantee its 64-bit alignment.
+	state uint64
+
+	// stats holds the number of injected faults, updated atomically.
+	stats FaultStats
+
+	// faults holds the injected faults configuration.
+	faults Faults
+}
+
+// NewInjector returns an injector injecting faults f.
+func NewInjector(f Faults) *Injector {
+	if f.Points == 0 {
+		f.Points = AllPoints
+	}
+	return &Injector{state: uint64(f.Seed), faults: f}
+}
+
+// Stats returns the number of faults injected so far.
+func (in *Injector) Stats() FaultStats {
+	return FaultStats{
+		Preemptions: atomic.LoadUint64(&in.stats.Preemptions),
+		Delays:      atomic.LoadUint64(&in.stats.Delays),
+		Panics:      atomic.LoadUint64(&in.stats.Panics),
+	}
+}
+
+// At injects the faults configured for fault point p.
+func (in *Injector) At(p FaultPoint) {
+	if in.faults.Points&p != 0 && in.chance(in.faults.Preempt) {
+		atomic.AddUint64(&in.stats.Preemptions, 1)
+		runtime.Gosched()
+	}
+}
+
+// Inside injects the faults configured for the Inside fault point.
+// It is meant to be set as the test hook called between the atomic steps of the queue operations.
+func (in *Injector) Inside() { in.At(Inside) }
+
+// Callback panics with ErrInjectedPanic according to the configured probability.
+// It is meant to be called by the callbacks passed to the queues under test, e.g. predicates,
+// keys, comparison functions and watermark callbacks.
+func (in *Injector) Callback() {
+	if in.chance(in.faults.Panic) {
+		atomic.AddUint64(&in.stats.Panics, 1)
+		panic(ErrInjectedPanic)
+	}
+}
+
+// Queue returns queue q injecting the configured faults around each of its operations.
+func (in *Injector) Queue(q ConcurrentQueue) ConcurrentQueue {
+	return &faultyQueue{q: q, in: in}
+}
+
+// Impl returns implementation impl whose queues inject the configured faults around each of
+// their operations.
+func (in *Injector) Impl(impl ConcurrentImpl) ConcurrentImpl {
+	return ConcurrentImpl{
+		Name:           impl.Name + "/faults",
+		New:            func() ConcurrentQueue { return in.Queue(impl.New()) },
+		SingleConsumer: impl.SingleConsumer,
+	}
+}
+
+// chance returns true with probability p.
+func (in *Injector) chance(p float64) bool {
+	if p <= 0 {
+		return false
+	}
+	return float64(splitmix(atomic.AddUint64(&in.state, splitmixGamma))>>11)/(1<<53) < p
+}
+
+// splitmixGamma holds the increment of the SplitMix64 generator state.
+const splitmixGamma = 0x9e3779b97f4a7c15
+
+// splitmix returns the SplitMix64 output for state x, so concurrent goroutines can draw random
+// numbers by atomically incrementing a shared state, without a lock.
+func splitmix(x uint64) uint64 {
+	x = (x ^ x>>30) * 0xbf58476d1ce4e5b9
+	x = (x ^ x>>27) * 0x94d049bb133111eb
+	return x ^ x>>31
+}
+
+// faultyQueue represents a queue injecting faults around each of its operations.
+type faultyQueue struct {
+	// q holds the queue under test.
+	q ConcurrentQueue
+
+	// in injects the faults.
+	in *Injector
+}
+
+// Push adds a value to the queue.
+func (q *faultyQueue) Push(v interface{}) {
+	q.in.At(BeforePush)
+	q.q.Push(v)
+	q.in.At(AfterPush)
+}
+
+// Pop retrieves and removes the next element from the queue, delaying the consumer if it is
+// chosen to be slow.
+func (q *faultyQueue) Pop() (interface{}, bool) {
+	q.in.At(BeforePop)
+	v, ok := q.q.Pop()
+	q.in.At(AfterPop)
+	if ok && q.in.chance(q.in.faults.Slow) {
+		atomic.AddUint64(&q.in.stats.Delays, 1)
+		time.Sleep(q.in.faults.Delay)
+	}
+	return v, ok
+}
+
+// Recover calls f, returning whether it panicked with ErrInjectedPanic.
+// Other panics are propagated.
+func Recover(f func()) (panicked bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			if r != ErrInjectedPanic {
+				panic(r)
+			}
+			panicked = true
+		}
+	}()
+	f()
+	return false
+}
+
+// CheckNoDeadlock calls f, failing t with the stacks of all goroutines if f doesn't return
+// within timeout, e.g. because a lock was left held or a goroutine waits for a wake up that
+// never comes. F keeps running in the background once timed out.
+func CheckNoDeadlock(t *testing.T, timeout time.Duration, f func()) {
+	if err := checkNoDeadlock(timeout, f); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// checkNoDeadlock runs CheckNoDeadlock, returning an error holding the goroutine stacks if
+// f doesn't return within timeout.
+func checkNoDeadlock(timeout time.Duration, f func()) error {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		f()
+	}()
+
+	t := time.NewTimer(timeout)
+	defer t.Stop()
+	select {
+	case <-done:
+		return nil
+	case <-t.C:
+		buf := make([]byte, 1<<20)
+		buf = buf[:runtime.Stack(buf, true)]
+		return fmt.Errorf("Expected: return within %v; Got: deadlock?\n%s", timeout, buf)
+	}
+}
@@ -0,0 +1,294 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package queuetest
+
+import (
+	"errors"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/christianrpetrin/queue-tests/lockfreequeue"
+	"github.com/christianrpetrin/queue-tests/queueimpl3"
+	"github.com/christianrpetrin/queue-tests/safequeue"
+)
+
+const (
+	// faultItems holds the number of values pushed by each producer of the fault injection tests.
+	faultItems = 2000
+
+	// deadlockTimeout holds how long the fault injection tests run before being reported as deadlocked.
+	deadlockTimeout = time.Minute
+)
+
+func TestProducerOrderShouldHoldWithInjectedFaults(t *testing.T) {
+	for _, impl := range concurrentImpls() {
+		impl := impl
+		t.Run(impl.Name, func(t *testing.T) {
+			// Each of the concurrentProducers*faultItems values is popped successfully exactly
+			// once, which is when Slow is drawn, so Slow is high enough for about 400 delays to be
+			// injected regardless of the interleaving; none is injected with a probability below e^-400.
+			in := NewInjector(Faults{Seed: 1, Preempt: 0.2, Slow: 0.05, Delay: 100 * time.Microsecond})
+			CheckNoDeadlock(t, deadlockTimeout, func() {
+				CheckProducerOrder(t, in.Impl(impl), concurrentProducers, concurrentConsumers, faultItems)
+			})
+			if s := in.Stats(); s.Preemptions == 0 || s.Delays == 0 {
+				t.Errorf("Expected: injected preemptions and delays; Got: %+v", s)
+			}
+		})
+	}
+}
+
+func TestInjectorShouldInjectFaultsAtConfiguredPointsOnly(t *testing.T) {
+	in := NewInjector(Faults{Points: BeforePush | AfterPop, Preempt: 1})
+	q := in.Queue(safequeue.New())
+	q.Push(1)
+	q.Pop()
+	if s := in.Stats(); s.Preemptions != 2 {
+		t.Errorf("Expected: %d preemptions; Got: %d", 2, s.Preemptions)
+	}
+
+	in = NewInjector(Faults{})
+	q = in.Queue(safequeue.New())
+	q.Push(1)
+	q.Pop()
+	in.Inside()
+	in.Callback()
+	if s := in.Stats(); s != (FaultStats{}) {
+		t.Errorf("Expected: no faults; Got: %+v", s)
+	}
+}
+
+func TestInjectorShouldInjectFaultsWithConfiguredProbability(t *testing.T) {
+	in := NewInjector(Faults{Seed: 1, Preempt: 0.25})
+	for i := 0; i < 10000; i++ {
+		in.At(Inside)
+	}
+	if n := in.Stats().Preemptions; n < 2250 || n > 2750 {
+		t.Errorf("Expected: about %d preemptions; Got: %d", 2500, n)
+	}
+}
+
+func TestRecoverShouldOnlyRecoverInjectedPanics(t *testing.T) {
+	in := NewInjector(Faults{Panic: 1})
+	if !Recover(in.Callback) {
+		t.Error("Expected: injected panic recovered; Got: no panic")
+	}
+	if Recover(func() {}) {
+		t.Error("Expected: no panic; Got: injected panic recovered")
+	}
+
+	other := errors.New("other")
+	defer func() {
+		if r := recover(); r != other {
+			t.Errorf("Expected: %v; Got: %v", other, r)
+		}
+	}()
+	Recover(func() { panic(other) })
+}
+
+func TestCheckNoDeadlockShouldDetectDeadlocks(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	if err := checkNoDeadlock(10*time.Millisecond, func() { <-release }); err == nil {
+		t.Error("Expected: deadlock failure; Got: nil")
+	}
+	if err := checkNoDeadlock(deadlockTimeout, func() {}); err != nil {
+		t.Errorf("Expected: no failure; Got: %v", err)
+	}
+}
+
+// callbackQueue is a concurrent queue whose operations call callbacks that may panic.
+type callbackQueue struct {
+	ConcurrentQueue
+
+	// len returns the number of elements of the queue.
+	len func() int
+
+	// stop stops the callbacks from panicking.
+	stop func()
+}
+
+// checkCallbackPanics pushes and pops values concurrently to queue q, whose callbacks panic
+// with ErrInjectedPanic, checking that the queue doesn't deadlock, that no value is popped
+// more than once, and that the queue is still consistent once the callbacks stop panicking.
+func checkCallbackPanics(t *testing.T, q callbackQueue) {
+	in := NewInjector(Faults{Seed: 1, Preempt: 0.2})
+	fq := in.Queue(q)
+	var mu sync.Mutex
+	popped := make(map[interface{}]int)
+
+	CheckNoDeadlock(t, deadlockTimeout, func() {
+		var producers, consumers sync.WaitGroup
+		done := make(chan struct{})
+		for p := 0; p < concurrentProducers; p++ {
+			producers.Add(1)
+			go func(p int) {
+				defer producers.Done()
+				for i := 0; i < faultItems; i++ {
+					Recover(func() { fq.Push(producerValue{producer: p, seq: i}) })
+				}
+			}(p)
+		}
+		for c := 0; c < concurrentConsumers; c++ {
+			consumers.Add(1)
+			go func() {
+				defer consumers.Done()
+				for {
+					select {
+					case <-done:
+						return
+					default:
+					}
+					var v interface{}
+					var ok bool
+					Recover(func() { v, ok = fq.Pop() })
+					if !ok {
+						runtime.Gosched()
+						continue
+					}
+					mu.Lock()
+					popped[v]++
+					mu.Unlock()
+				}
+			}()
+		}
+		producers.Wait()
+		close(done)
+		consumers.Wait()
+	})
+
+	// Stop panicking, and drain the queue.
+	q.stop()
+	for {
+		v, ok := q.Pop()
+		if !ok {
+			break
+		}
+		popped[v]++
+	}
+	for v, n := range popped {
+		if n != 1 {
+			t.Errorf("Expected: %v popped once; Got: %d times", v, n)
+		}
+	}
+	if l := q.len(); l != 0 {
+		t.Errorf("Expected: length %d once drained; Got: %d", 0, l)
+	}
+	q.Push(1)
+	if v, ok := q.Pop(); !ok || v != 1 || q.len() != 0 {
+		t.Errorf("Expected: %d popped from the drained queue; Got: %v, %v with length %d", 1, v, ok, q.len())
+	}
+}
+
+func TestSafeQueueShouldNotDeadlockWhenCallbacksPanic(t *testing.T) {
+	in, callback, stop := panickingCallback(0.01)
+	sq := safequeue.New()
+	sq.SetUnique(func(v interface{}) interface{} {
+		callback()
+		return v
+	})
+	sq.SetWatermarks(safequeue.Watermarks{
+		High:   4,
+		Low:    1,
+		OnHigh: func(l int) { callback() },
+		OnLow:  func(l int) { callback() },
+	})
+
+	var pops uint32
+	checkCallbackPanics(t, callbackQueue{
+		ConcurrentQueue: concurrentQueueFuncs{
+			push: sq.Push,
+			pop: func() (interface{}, bool) {
+				// Alternate between the operations calling a callback with the queue locked.
+				switch atomic.AddUint32(&pops, 1) % 3 {
+				case 0:
+					return sq.PopIf(func(v interface{}) bool {
+						callback()
+						return true
+					})
+				case 1:
+					var v interface{}
+					var ok bool
+					sq.Do(func(q *queueimpl3.Queueimpl3) {
+						callback()
+						v, ok = q.Pop()
+					})
+					return v, ok
+				default:
+					return sq.Pop()
+				}
+			},
+		},
+		len:  sq.Len,
+		stop: stop,
+	})
+	if in.Stats().Panics == 0 {
+		t.Error("Expected: injected panics; Got: none")
+	}
+}
+
+func TestLockFreeQueueShouldNotDeadlockWhenWatermarkCallbacksPanic(t *testing.T) {
+	in, callback, stop := panickingCallback(0.5)
+	lq := lockfreequeue.New()
+	lq.SetWatermarks(lockfreequeue.Watermarks{
+		High:   4,
+		Low:    1,
+		OnHigh: func(l int) { callback() },
+		OnLow:  func(l int) { callback() },
+	})
+
+	checkCallbackPanics(t, callbackQueue{ConcurrentQueue: lq, len: lq.Len, stop: stop})
+	if in.Stats().Panics == 0 {
+		t.Error("Expected: injected panics; Got: none")
+	}
+}
+
+// panickingCallback returns a callback panicking with probability p, the injector injecting
+// the panics, and a function stopping the callback from panicking.
+func panickingCallback(p float64) (in *Injector, callback func(), stop func()) {
+	in = NewInjector(Faults{Seed: 1, Panic: p})
+	var stopped int32
+	callback = func() {
+		if atomic.LoadInt32(&stopped) == 0 {
+			in.Callback()
+		}
+	}
+	stop = func() { atomic.StoreInt32(&stopped, 1) }
+	return in, callback, stop
+}
+
+// concurrentQueueFuncs adapts a pair of push and pop functions to ConcurrentQueue.
+type concurrentQueueFuncs struct {
+	// push adds a value to the queue.
+	push func(v interface{})
+
+	// pop retrieves and removes the next element from the queue.
+	pop func() (interface{}, bool)
+}
+
+// Push adds a value to the queue.
+func (q concurrentQueueFuncs) Push(v interface{}) { q.push(v) }
+
+// Pop retrieves and removes the next element from the queue.
+func (q concurrentQueueFuncs) Pop() (interface{}, bool) { return q.pop() }
@@ -0,0 +1,77 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package queuetest
+
+import (
+	"runtime"
+	"sync/atomic"
+	"time"
+)
+
+// LeakTestCount holds the number of values pushed to the queue by the leak tests.
+const LeakTestCount = 1000
+
+// LeakTestValue is a pointer value pushed to the queue by the leak tests.
+// It contains pointers so it is not batched by the tiny allocator, which
+// could otherwise delay its finalizer indefinitely.
+type LeakTestValue struct {
+	p [4]*int
+
+	// N holds a number the tests may order the values by, e.g. their priority.
+	N int
+}
+
+// Finalizers counts how many of the objects it tracks were released by the garbage collector,
+// so the leak tests can check the queues don't keep references to popped values or discarded
+// nodes. The zero value for Finalizers is ready to use.
+type Finalizers struct {
+	// released holds the number of tracked objects released so far.
+	released int32
+}
+
+// Track sets a finalizer on object p, which must be a pointer to the beginning of an allocated
+// object, counting its release.
+func (f *Finalizers) Track(p interface{}) {
+	runtime.SetFinalizer(p, func(interface{}) { atomic.AddInt32(&f.released, 1) })
+}
+
+// NewValue returns a new tracked leak test value holding n.
+func (f *Finalizers) NewValue(n int) *LeakTestValue {
+	v := &LeakTestValue{N: n}
+	f.Track(v)
+	return v
+}
+
+// Released returns the number of tracked objects released so far.
+func (f *Finalizers) Released() int32 { return atomic.LoadInt32(&f.released) }
+
+// Wait repeatedly runs the garbage collector until want tracked objects were released
+// or a timeout expires. It returns the last observed number of released objects.
+func (f *Finalizers) Wait(want int32) int32 {
+	for i := 0; i < 100; i++ {
+		runtime.GC()
+		if r := f.Released(); r >= want {
+			return r
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return f.Released()
+}
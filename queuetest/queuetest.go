@@ -0,0 +1,233 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package queuetest implements property-based tests of the queue implementations in this repo.
+// Internally, the tests generate random operation sequences using testing/quick and apply each
+// of them both to the queue under test and to a simple slice based model of a FIFO queue,
+// checking after every operation that Len equals the number of pushes minus the number of pops,
+// that the values are popped in the order the model pops them, that Front agrees with the next
+// Pop, and that Init restores the empty state.
+// Operations push and pop bursts of up to a few hundred values, so sequences cross the internal
+// node or segment boundaries of the implementations.
+// The concurrent implementations are also checked while multiple producers and consumers run
+// concurrently: values pushed by the same producer must never be reordered, and the producers
+// are expected to get a fair share of the queue, i.e. none of them is starved.
+// Implementations able to reset the queue concurrently are checked while a consumer resets it
+// and another one pops, so every value must still be retrieved exactly once and in order.
+// The faults harness wraps the implementations to inject faults, i.e. forced preemptions at
+// configurable points of the operations, slow consumers and panics in the callbacks, so the
+// same checks verify the queues keep their invariants and don't deadlock under faults.
+package queuetest
+
+import (
+	"fmt"
+	"testing"
+	"testing/quick"
+)
+
+// Queue is the set of operations shared by all the queue implementations in this repo, i.e. the
+// operations the property tests need from an implementation; the other packages in this repo
+// needing a queue accept this interface instead of declaring their own.
+// If the implementation also has a Front() (interface{}, bool) method, Front is checked too;
+// and if it has a Close() error method, the queue is closed once each operation sequence is done.
+type Queue interface {
+	// Len returns the number of elements of the queue.
+	Len() int
+
+	// Push adds a value to the queue.
+	Push(v interface{})
+
+	// Pop retrieves and removes the next element from the queue.
+	// The second, bool result indicates whether a valid value was returned;
+	//   if the queue is empty, false will be returned.
+	Pop() (interface{}, bool)
+}
+
+// fronter is implemented by queues with a Front method.
+type fronter interface {
+	// Front returns the first element of the queue.
+	Front() (interface{}, bool)
+}
+
+// closer is implemented by queues that must be closed once no longer needed.
+type closer interface {
+	// Close releases the queue resources.
+	Close() error
+}
+
+// Impl describes a queue implementation under test.
+type Impl struct {
+	// Name is the implementation name, used in the failure messages.
+	Name string
+
+	// New returns a new, empty queue.
+	New func() Queue
+
+	// Init, if not nil, initializes or clears queue q, usually by calling its Init method.
+	// If nil, Init is not checked.
+	Init func(q Queue)
+}
+
+const (
+	// opPush pushes a burst of values.
+	opPush = iota
+
+	// opPushOne pushes a single value, so single pushes are as likely as bursts.
+	opPushOne
+
+	// opPop pops a burst of values.
+	opPop
+
+	// opPopOne pops a single value.
+	opPopOne
+
+	// opFront checks Front, without changing the queue.
+	opFront
+
+	// opInit clears the queue.
+	opInit
+
+	// opCount holds the number of operations.
+	opCount
+)
+
+// maxBurst holds the maximum number of values pushed or popped by a single operation.
+const maxBurst = 300
+
+// CheckProperties checks the properties of implementation impl against random operation
+// sequences generated using config, reporting failures to t.
+// A nil config uses the testing/quick defaults.
+func CheckProperties(t *testing.T, impl Impl, config *quick.Config) {
+	if err := check(impl, config); err != nil {
+		t.Errorf("%s: %v", impl.Name, err)
+	}
+}
+
+// check checks the properties of implementation impl against random operation sequences
+// generated using config, returning an error describing the first failure, if any.
+func check(impl Impl, config *quick.Config) error {
+	var failure error
+	f := func(ops []uint16) bool {
+		failure = run(impl, ops)
+		return failure == nil
+	}
+	if err := quick.Check(f, config); err != nil {
+		if ce, ok := err.(*quick.CheckError); ok {
+			return fmt.Errorf("sequence #%d of %d operations: %v", ce.Count, len(ce.In[0].([]uint16)), failure)
+		}
+		return err
+	}
+	return nil
+}
+
+// run applies the operation sequence ops to a new queue of implementation impl and to the
+// model, returning an error describing the first property that doesn't hold, if any.
+func run(impl Impl, ops []uint16) (err error) {
+	q := impl.New()
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+		if c, ok := q.(closer); ok {
+			if cerr := c.Close(); err == nil && cerr != nil {
+				err = fmt.Errorf("close: %v", cerr)
+			}
+		}
+	}()
+
+	var model []interface{}
+	next := 0
+	for i, o := range ops {
+		kind, n := int(o)%opCount, int(o)/opCount%maxBurst+1
+		switch kind {
+		case opPush, opPushOne:
+			if kind == opPushOne {
+				n = 1
+			}
+			for j := 0; j < n; j++ {
+				q.Push(next)
+				model = append(model, next)
+				next++
+			}
+		case opPop, opPopOne:
+			if kind == opPopOne {
+				n = 1
+			}
+			for j := 0; j < n; j++ {
+				if err := checkFront(q, model); err != nil {
+					return fmt.Errorf("operation %d (pop): %v", i, err)
+				}
+				v, ok := q.Pop()
+				if len(model) == 0 {
+					if ok || v != nil {
+						return fmt.Errorf("operation %d (pop): Expected: nil, false as the queue should be empty; Got: %v, %v", i, v, ok)
+					}
+					break
+				}
+				if !ok || v != model[0] {
+					return fmt.Errorf("operation %d (pop): Expected: %v, true; Got: %v, %v", i, model[0], v, ok)
+				}
+				model[0] = nil
+				model = model[1:]
+			}
+		case opFront:
+			if err := checkFront(q, model); err != nil {
+				return fmt.Errorf("operation %d (front): %v", i, err)
+			}
+		case opInit:
+			if impl.Init == nil {
+				break
+			}
+			impl.Init(q)
+			model = nil
+			if v, ok := q.Pop(); ok || v != nil {
+				return fmt.Errorf("operation %d (init): Expected: nil, false as the queue should be empty; Got: %v, %v", i, v, ok)
+			}
+		}
+
+		if q.Len() != len(model) {
+			return fmt.Errorf("operation %d: Expected: length %d; Got: %d", i, len(model), q.Len())
+		}
+		if err := checkFront(q, model); err != nil {
+			return fmt.Errorf("operation %d: %v", i, err)
+		}
+	}
+	return nil
+}
+
+// checkFront checks Front of queue q, if it has one, returns the first value of the model.
+func checkFront(q Queue, model []interface{}) error {
+	f, ok := q.(fronter)
+	if !ok {
+		return nil
+	}
+
+	v, ok := f.Front()
+	if len(model) == 0 {
+		if ok || v != nil {
+			return fmt.Errorf("Expected: front nil, false as the queue should be empty; Got: %v, %v", v, ok)
+		}
+		return nil
+	}
+	if !ok || v != model[0] {
+		return fmt.Errorf("Expected: front %v, true; Got: %v, %v", model[0], v, ok)
+	}
+	return nil
+}
@@ -0,0 +1,238 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package queuetest
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"testing/quick"
+
+	"github.com/christianrpetrin/queue-tests/agequeue"
+	"github.com/christianrpetrin/queue-tests/agingqueue"
+	"github.com/christianrpetrin/queue-tests/codec"
+	"github.com/christianrpetrin/queue-tests/diskqueue"
+	"github.com/christianrpetrin/queue-tests/faaqueue"
+	"github.com/christianrpetrin/queue-tests/fcqueue"
+	"github.com/christianrpetrin/queue-tests/lockfreequeue"
+	"github.com/christianrpetrin/queue-tests/minmaxheap"
+	"github.com/christianrpetrin/queue-tests/orderedqueue"
+	"github.com/christianrpetrin/queue-tests/queueimpl1"
+	"github.com/christianrpetrin/queue-tests/queueimpl10"
+	"github.com/christianrpetrin/queue-tests/queueimpl11"
+	"github.com/christianrpetrin/queue-tests/queueimpl2"
+	"github.com/christianrpetrin/queue-tests/queueimpl3"
+	"github.com/christianrpetrin/queue-tests/queueimpl4"
+	"github.com/christianrpetrin/queue-tests/queueimpl5"
+	"github.com/christianrpetrin/queue-tests/queueimpl6"
+	"github.com/christianrpetrin/queue-tests/queueimpl7"
+	"github.com/christianrpetrin/queue-tests/queueimpl8"
+	"github.com/christianrpetrin/queue-tests/safequeue"
+	"github.com/christianrpetrin/queue-tests/spillqueue"
+	"github.com/christianrpetrin/queue-tests/weightedqueue"
+)
+
+// agingQueue adapts an agingqueue.AgingQueue to Queue, pushing all values with the same priority.
+type agingQueue struct {
+	*agingqueue.AgingQueue
+}
+
+// Push adds a value to the queue with priority 0.
+func (q agingQueue) Push(v interface{}) { q.AgingQueue.Push(v, 0) }
+
+// weightedQueue adapts a weightedqueue.WeightedQueue to Queue.
+type weightedQueue struct {
+	*weightedqueue.WeightedQueue
+}
+
+// Push adds a value to the queue, which is never rejected as the queue capacity is never reached.
+func (q weightedQueue) Push(v interface{}) { q.WeightedQueue.Push(v) }
+
+// lessInt reports whether int a is smaller than int b.
+func lessInt(a, b interface{}) bool { return a.(int) < b.(int) }
+
+// minMaxHeap adapts a minmaxheap.MinMaxHeap of ints to Queue, popping the smallest value.
+// The property tests push increasing values, so the smallest value is also the oldest one.
+type minMaxHeap struct {
+	*minmaxheap.MinMaxHeap
+}
+
+// Pop retrieves and removes the smallest element from the queue.
+func (q minMaxHeap) Pop() (interface{}, bool) { return q.PopMin() }
+
+// orderedQueue adapts an orderedqueue.OrderedQueue to Queue, popping the smallest value.
+// Values that compare equal are popped in push order, so the queue is probed both ordering
+// the increasing values pushed by the property tests and treating all values as equal.
+type orderedQueue struct {
+	*orderedqueue.OrderedQueue
+}
+
+// Pop retrieves and removes the smallest element from the queue.
+func (q orderedQueue) Pop() (interface{}, bool) { return q.PopMin() }
+
+// impls returns all implementations under test; the ones storing values in files create
+// their directories in dir.
+func impls(t *testing.T, dir string) []Impl {
+	return []Impl{
+		{Name: "impl1", New: func() Queue { return queueimpl1.New() }, Init: func(q Queue) { q.(*queueimpl1.Queueimpl1).Init() }},
+		{Name: "impl2", New: func() Queue { return queueimpl2.New() }, Init: func(q Queue) { q.(*queueimpl2.Queueimpl2).Init() }},
+		{Name: "impl3", New: func() Queue { return queueimpl3.New() }, Init: func(q Queue) { q.(*queueimpl3.Queueimpl3).Init() }},
+		{Name: "impl4", New: func() Queue { return queueimpl4.New() }, Init: func(q Queue) { q.(*queueimpl4.Queueimpl4).Init() }},
+		{Name: "impl5", New: func() Queue { return queueimpl5.New() }, Init: func(q Queue) { q.(*queueimpl5.Queueimpl5).Init() }},
+		{Name: "impl6", New: func() Queue { return queueimpl6.New() }, Init: func(q Queue) { q.(*queueimpl6.Queueimpl6).Init() }},
+		{Name: "impl7", New: func() Queue { return queueimpl7.New() }, Init: func(q Queue) { q.(*queueimpl7.Queueimpl7).Init() }},
+		{Name: "impl8", New: func() Queue { return queueimpl8.New() }, Init: func(q Queue) { q.(*queueimpl8.Queueimpl8).Init() }},
+		{
+			Name: "impl8/pool",
+			New:  func() Queue { return queueimpl8.NewWithAllocator(new(queueimpl8.PoolAllocator)) },
+			Init: func(q Queue) { q.(*queueimpl8.Queueimpl8).Reset() },
+		},
+		{Name: "impl10", New: func() Queue { return queueimpl10.New() }, Init: func(q Queue) { q.(*queueimpl10.Queueimpl10).Init() }},
+		{Name: "impl11", New: func() Queue { return queueimpl11.New() }, Init: func(q Queue) { q.(*queueimpl11.Queueimpl11).Init() }},
+		{Name: "safequeue", New: func() Queue { return safequeue.New() }, Init: func(q Queue) { q.(*safequeue.SafeQueue).Init() }},
+		{Name: "lockfreequeue", New: func() Queue { return lockfreequeue.New() }, Init: func(q Queue) { q.(*lockfreequeue.LockFreeQueue).Init() }},
+		{
+			Name: "lockfreequeue/reclamation",
+			New:  func() Queue { return lockfreequeue.NewWithReclamation() },
+			Init: func(q Queue) { q.(*lockfreequeue.LockFreeQueue).Init() },
+		},
+		{Name: "faaqueue", New: func() Queue { return faaqueue.New() }, Init: func(q Queue) { q.(*faaqueue.FAAQueue).Init() }},
+		{
+			Name: "faaqueue/reclamation",
+			New:  func() Queue { return faaqueue.NewWithReclamation() },
+			Init: func(q Queue) { q.(*faaqueue.FAAQueue).Init() },
+		},
+		{Name: "fcqueue", New: func() Queue { return fcqueue.New() }},
+		{
+			Name: "agequeue",
+			New:  func() Queue { return agequeue.New(agequeue.Options{}) },
+			Init: func(q Queue) { q.(*agequeue.AgeQueue).Init() },
+		},
+		{Name: "agingqueue", New: func() Queue { return agingQueue{agingqueue.New(agingqueue.Options{})} }},
+		{
+			Name: "minmaxheap",
+			New:  func() Queue { return minMaxHeap{minmaxheap.New(lessInt)} },
+			Init: func(q Queue) { q.(minMaxHeap).Init() },
+		},
+		{
+			Name: "orderedqueue",
+			New:  func() Queue { return orderedQueue{orderedqueue.New(lessInt)} },
+			Init: func(q Queue) { q.(orderedQueue).Init() },
+		},
+		{
+			Name: "orderedqueue/stable",
+			New:  func() Queue { return orderedQueue{orderedqueue.New(func(a, b interface{}) bool { return false })} },
+			Init: func(q Queue) { q.(orderedQueue).Init() },
+		},
+		{Name: "weightedqueue", New: func() Queue { return weightedQueue{weightedqueue.New(1<<62, weightedqueue.Reject)} }},
+		{
+			Name: "spillqueue",
+			New: func() Queue {
+				dir, err := ioutil.TempDir(dir, "spillqueue")
+				if err != nil {
+					t.Fatal(err)
+				}
+				return spillqueue.New(spillqueue.Options{Threshold: 64, SegmentLen: 32, Dir: dir, Codec: codec.Gob})
+			},
+		},
+		{
+			Name: "diskqueue",
+			New: func() Queue {
+				dir, err := ioutil.TempDir(dir, "diskqueue")
+				if err != nil {
+					t.Fatal(err)
+				}
+				q, err := diskqueue.Open(dir, diskqueue.Options{SegmentSize: 4096, Codec: codec.Gob})
+				if err != nil {
+					t.Fatal(err)
+				}
+				return q
+			},
+		},
+	}
+}
+
+func TestPropertiesShouldHoldForAllImplementations(t *testing.T) {
+	dir, err := ioutil.TempDir("", "queuetest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, impl := range impls(t, dir) {
+		impl := impl
+		t.Run(impl.Name, func(t *testing.T) {
+			CheckProperties(t, impl, nil)
+		})
+	}
+}
+
+// lifoQueue is a broken queue, returning the values in LIFO order.
+type lifoQueue struct {
+	// v holds the queue values.
+	v []interface{}
+}
+
+// Len returns the number of elements of the queue.
+func (q *lifoQueue) Len() int { return len(q.v) }
+
+// Push adds a value to the queue.
+func (q *lifoQueue) Push(v interface{}) { q.v = append(q.v, v) }
+
+// Pop retrieves and removes the last added element from the queue.
+func (q *lifoQueue) Pop() (interface{}, bool) {
+	if len(q.v) == 0 {
+		return nil, false
+	}
+	v := q.v[len(q.v)-1]
+	q.v = q.v[:len(q.v)-1]
+	return v, true
+}
+
+// leakyQueue is a broken queue, whose Init doesn't clear the queue.
+type leakyQueue struct {
+	queueimpl3.Queueimpl3
+}
+
+func TestCheckShouldDetectWrongOrder(t *testing.T) {
+	err := check(Impl{Name: "lifo", New: func() Queue { return new(lifoQueue) }}, nil)
+	if err == nil {
+		t.Error("Expected: property failure; Got: nil")
+	}
+}
+
+func TestCheckShouldDetectInitNotClearingQueue(t *testing.T) {
+	err := check(Impl{
+		Name: "leaky",
+		New:  func() Queue { q := new(leakyQueue); q.Queueimpl3.Init(); return q },
+		Init: func(q Queue) {},
+	}, &quick.Config{MaxCount: 1000})
+	if err == nil {
+		t.Error("Expected: property failure; Got: nil")
+	}
+}
+
+func TestCheckShouldReportPanics(t *testing.T) {
+	err := check(Impl{Name: "panic", New: func() Queue { return (*lifoQueue)(nil) }}, nil)
+	if err == nil {
+		t.Error("Expected: property failure; Got: nil")
+	}
+}
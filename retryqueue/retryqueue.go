@@ -0,0 +1,269 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package retryqueue implements an unbounded, thread-safe work queue that requeues failed
+// values after an exponential backoff delay.
+// Internally, queue holds the values ready to be processed in a safequeue queue in unique
+// mode, so a value is never waiting to be processed more than once, and the values waiting
+// for their backoff delay to expire in a min-heap ordered by due time. The number of
+// attempts is tracked per value key, and due values are moved to the ready queue when
+// values are retrieved, so values only surface once due.
+package retryqueue
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+
+	"github.com/christianrpetrin/queue-tests/safequeue"
+)
+
+const (
+	// DefaultBaseDelay holds the default delay before retrying a value the first time.
+	DefaultBaseDelay = 5 * time.Millisecond
+
+	// DefaultMaxDelay holds the default maximum delay before retrying a value.
+	DefaultMaxDelay = 1000 * time.Second
+)
+
+// Options configures a queue.
+// The zero value for Options holds the default configuration.
+type Options struct {
+	// Key returns the key identifying value v, used to deduplicate values and to count
+	// their attempts. Keys must be comparable, e.g. a string or an int.
+	// A nil Key uses the values themselves as keys.
+	Key func(v interface{}) interface{}
+
+	// BaseDelay is the delay before retrying a value the first time; the delay doubles
+	// with each further attempt.
+	// A BaseDelay of 0 or less uses DefaultBaseDelay.
+	BaseDelay time.Duration
+
+	// MaxDelay is the maximum delay before retrying a value.
+	// A MaxDelay of 0 or less uses DefaultMaxDelay.
+	MaxDelay time.Duration
+
+	// MaxAttempts is the number of failed attempts after which a value is dropped instead of
+	// being retried.
+	// A MaxAttempts of 0 or less retries values indefinitely.
+	MaxAttempts int
+
+	// Now returns the current time.
+	// A nil Now uses time.Now.
+	Now func() time.Time
+}
+
+// RetryQueue represents an unbounded work queue that requeues failed values after a backoff delay.
+// RetryQueue is safe for concurrent use by multiple goroutines.
+// The zero value for queue is not ready to use; use New to create a queue.
+type RetryQueue struct {
+	// opts holds the queue configuration.
+	opts Options
+
+	// ready holds the values ready to be processed.
+	ready *safequeue.SafeQueue
+
+	// mu guards delayed, attempts and seq.
+	mu sync.Mutex
+
+	// delayed holds the values waiting for their backoff delay to expire.
+	delayed delayedHeap
+
+	// attempts holds the number of failed attempts of each value key.
+	attempts map[interface{}]int
+
+	// seq holds the sequence number of the next delayed value.
+	seq uint64
+}
+
+// delayedValue represents a value waiting for its backoff delay to expire.
+type delayedValue struct {
+	// v holds the user added value.
+	v interface{}
+
+	// due holds the time v is due to be retried.
+	due time.Time
+
+	// seq holds the order v was delayed in, so values due at the same time are retried in order.
+	seq uint64
+}
+
+// delayedHeap is a min-heap of delayed values ordered by due time.
+type delayedHeap []delayedValue
+
+func (h delayedHeap) Len() int { return len(h) }
+
+func (h delayedHeap) Less(i, j int) bool {
+	if h[i].due.Equal(h[j].due) {
+		return h[i].seq < h[j].seq
+	}
+	return h[i].due.Before(h[j].due)
+}
+
+func (h delayedHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *delayedHeap) Push(x interface{}) { *h = append(*h, x.(delayedValue)) }
+
+func (h *delayedHeap) Pop() interface{} {
+	old := *h
+	n := len(old) - 1
+	v := old[n]
+	old[n] = delayedValue{} // Avoid memory leaks
+	*h = old[:n]
+	return v
+}
+
+// New returns an initialized queue configured by opts.
+func New(opts Options) *RetryQueue {
+	if opts.Key == nil {
+		opts.Key = func(v interface{}) interface{} { return v }
+	}
+	if opts.BaseDelay <= 0 {
+		opts.BaseDelay = DefaultBaseDelay
+	}
+	if opts.MaxDelay <= 0 {
+		opts.MaxDelay = DefaultMaxDelay
+	}
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+	q := &RetryQueue{
+		opts:     opts,
+		ready:    safequeue.New(),
+		attempts: make(map[interface{}]int),
+	}
+	q.ready.SetUnique(opts.Key)
+	return q
+}
+
+// Len returns the number of values ready to be processed, not counting the delayed ones
+// that are already due but were not moved to the ready queue yet.
+// The complexity is O(1).
+func (q *RetryQueue) Len() int { return q.ready.Len() }
+
+// Delayed returns the number of values waiting for their backoff delay to expire.
+// The complexity is O(1).
+func (q *RetryQueue) Delayed() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.delayed)
+}
+
+// NextDue returns the time the next delayed value is due to be retried, so consumers
+// finding the queue empty know how long to wait for.
+// The second, bool result indicates whether a valid time was returned;
+//   if there are no delayed values, false will be returned.
+// The complexity is O(1).
+func (q *RetryQueue) NextDue() (time.Time, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.delayed) == 0 {
+		return time.Time{}, false
+	}
+	return q.delayed[0].due, true
+}
+
+// Add adds a value to the queue, ready to be processed right away.
+// Value v is skipped if a value with the same key is already ready to be processed.
+// The complexity is O(1).
+func (q *RetryQueue) Add(v interface{}) {
+	q.ready.Push(v)
+}
+
+// Get retrieves and removes the next value ready to be processed, moving the delayed
+// values that are due to the ready queue first.
+// The second, bool result indicates whether a valid value was returned;
+//   if no value is ready, false will be returned.
+// Once processed, the value should be passed to Retry if processing failed, or to
+// Forget if it succeeded.
+// The complexity is O(1), not counting the cost of moving the due values, which is
+// O(log n) each, where n is the number of delayed values.
+func (q *RetryQueue) Get() (interface{}, bool) {
+	q.mu.Lock()
+	now := q.opts.Now()
+	for len(q.delayed) > 0 && !q.delayed[0].due.After(now) {
+		q.ready.Push(heap.Pop(&q.delayed).(delayedValue).v)
+	}
+	q.mu.Unlock()
+
+	return q.ready.Pop()
+}
+
+// Retry records a failed attempt to process value v and requeues it once its backoff
+// delay expires, returning the delay.
+// The second, bool result indicates whether v was requeued;
+//   if v reached the maximum number of attempts, it is dropped, its attempts are
+//   forgotten and false will be returned.
+// The complexity is O(log n), where n is the number of delayed values.
+func (q *RetryQueue) Retry(v interface{}) (time.Duration, bool) {
+	k := q.opts.Key(v)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.attempts[k]++
+	n := q.attempts[k]
+	if q.opts.MaxAttempts > 0 && n >= q.opts.MaxAttempts {
+		delete(q.attempts, k)
+		return 0, false
+	}
+
+	d := q.backoff(n)
+	heap.Push(&q.delayed, delayedValue{v: v, due: q.opts.Now().Add(d), seq: q.seq})
+	q.seq++
+	return d, true
+}
+
+// Forget forgets the failed attempts of value v, e.g. once it was processed successfully,
+// so a later failure starts over from the base delay.
+// The complexity is O(1).
+func (q *RetryQueue) Forget(v interface{}) {
+	k := q.opts.Key(v)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	delete(q.attempts, k)
+}
+
+// Attempts returns the number of failed attempts recorded for value v.
+// The complexity is O(1).
+func (q *RetryQueue) Attempts(v interface{}) int {
+	k := q.opts.Key(v)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.attempts[k]
+}
+
+// backoff returns the delay before retrying a value after n failed attempts.
+func (q *RetryQueue) backoff(n int) time.Duration {
+	d := q.opts.BaseDelay
+	for i := 1; i < n; i++ {
+		if d > q.opts.MaxDelay/2 {
+			// Doubling d would exceed the maximum delay, or overflow.
+			return q.opts.MaxDelay
+		}
+		d *= 2
+	}
+	if d > q.opts.MaxDelay {
+		d = q.opts.MaxDelay
+	}
+	return d
+}
@@ -0,0 +1,220 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package retryqueue
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock is a manually advanced clock.
+type fakeClock struct {
+	// mu guards t.
+	mu sync.Mutex
+
+	// t holds the current time.
+	t time.Time
+}
+
+func (c *fakeClock) now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.t
+}
+
+func (c *fakeClock) advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.t = c.t.Add(d)
+}
+
+func TestRetryQueueNewShouldUseDefaultOptions(t *testing.T) {
+	q := New(Options{})
+
+	if q.opts.BaseDelay != DefaultBaseDelay || q.opts.MaxDelay != DefaultMaxDelay {
+		t.Errorf("Expected: default options; Got: %+v", q.opts)
+	}
+	if v, ok := q.Get(); ok || v != nil {
+		t.Errorf("Expected: nil as the queue should be empty; Got: %v", v)
+	}
+}
+
+func TestRetryQueueAddShouldSkipValuesAlreadyReady(t *testing.T) {
+	q := New(Options{})
+	q.Add("a")
+	q.Add("b")
+	q.Add("a")
+
+	if q.Len() != 2 {
+		t.Errorf("Expected: %d; Got: %d", 2, q.Len())
+	}
+	for _, expected := range []string{"a", "b"} {
+		if v, ok := q.Get(); !ok || v != expected {
+			t.Errorf("Expected: %s; Got: %v", expected, v)
+		}
+	}
+}
+
+func TestRetryQueueRetryShouldSurfaceValuesOnlyWhenDue(t *testing.T) {
+	c := &fakeClock{t: time.Unix(1000, 0)}
+	q := New(Options{BaseDelay: time.Second, Now: c.now})
+	q.Add("a")
+	v, _ := q.Get()
+
+	if d, ok := q.Retry(v); !ok || d != time.Second {
+		t.Errorf("Expected: %v; Got: %v, %v", time.Second, d, ok)
+	}
+	if due, ok := q.NextDue(); !ok || !due.Equal(c.now().Add(time.Second)) {
+		t.Errorf("Expected: %v; Got: %v, %v", c.now().Add(time.Second), due, ok)
+	}
+	if v, ok := q.Get(); ok {
+		t.Errorf("Expected: no value before the delay expires; Got: %v", v)
+	}
+	if q.Delayed() != 1 {
+		t.Errorf("Expected: %d; Got: %d", 1, q.Delayed())
+	}
+
+	c.advance(time.Second)
+	if v, ok := q.Get(); !ok || v != "a" {
+		t.Errorf("Expected: %s; Got: %v", "a", v)
+	}
+	if _, ok := q.NextDue(); ok || q.Delayed() != 0 {
+		t.Errorf("Expected: %d delayed values; Got: %d", 0, q.Delayed())
+	}
+}
+
+func TestRetryQueueRetryShouldBackOffExponentially(t *testing.T) {
+	c := &fakeClock{t: time.Unix(1000, 0)}
+	q := New(Options{BaseDelay: time.Second, MaxDelay: 5 * time.Second, Now: c.now})
+
+	for i, expected := range []time.Duration{1, 2, 4, 5, 5} {
+		if d, ok := q.Retry("a"); !ok || d != expected*time.Second {
+			t.Errorf("Expected: %v; Got: %v, %v", expected*time.Second, d, ok)
+		}
+		if q.Attempts("a") != i+1 {
+			t.Errorf("Expected: %d attempts; Got: %d", i+1, q.Attempts("a"))
+		}
+	}
+
+	q.Forget("a")
+	if q.Attempts("a") != 0 {
+		t.Errorf("Expected: %d attempts; Got: %d", 0, q.Attempts("a"))
+	}
+	if d, _ := q.Retry("a"); d != time.Second {
+		t.Errorf("Expected: %v; Got: %v", time.Second, d)
+	}
+}
+
+func TestRetryQueueRetryWithLargeAttemptsShouldNotOverflow(t *testing.T) {
+	q := New(Options{BaseDelay: time.Second, MaxDelay: 1<<63 - 1})
+
+	for i := 0; i < 100; i++ {
+		if d, _ := q.Retry("a"); d <= 0 {
+			t.Fatalf("Expected: positive delay; Got: %v", d)
+		}
+	}
+}
+
+func TestRetryQueueRetryShouldDropValuesAfterMaxAttempts(t *testing.T) {
+	c := &fakeClock{t: time.Unix(1000, 0)}
+	q := New(Options{MaxAttempts: 3, Now: c.now})
+
+	for i := 0; i < 2; i++ {
+		if _, ok := q.Retry("a"); !ok {
+			t.Errorf("Expected: value requeued on attempt %d; Got: dropped", i+1)
+		}
+	}
+	if _, ok := q.Retry("a"); ok {
+		t.Error("Expected: value dropped; Got: requeued")
+	}
+	if q.Attempts("a") != 0 {
+		t.Errorf("Expected: %d attempts; Got: %d", 0, q.Attempts("a"))
+	}
+}
+
+func TestRetryQueueDueValuesShouldBeDeduplicatedAndRetrievedInOrder(t *testing.T) {
+	c := &fakeClock{t: time.Unix(1000, 0)}
+	type item struct {
+		id      int
+		attempt int
+	}
+	q := New(Options{Key: func(v interface{}) interface{} { return v.(item).id }, Now: c.now})
+
+	q.Retry(item{id: 1, attempt: 1})
+	q.Retry(item{id: 2, attempt: 1})
+	q.Add(item{id: 1, attempt: 2})
+	c.advance(time.Hour)
+
+	for _, expected := range []item{{id: 1, attempt: 2}, {id: 2, attempt: 1}} {
+		if v, ok := q.Get(); !ok || v != expected {
+			t.Errorf("Expected: %v; Got: %v", expected, v)
+		}
+	}
+	if v, ok := q.Get(); ok {
+		t.Errorf("Expected: duplicate value skipped; Got: %v", v)
+	}
+}
+
+func TestRetryQueueConcurrentGetRetryShouldProcessAllValues(t *testing.T) {
+	const values = 1000
+	q := New(Options{BaseDelay: time.Microsecond, MaxDelay: time.Millisecond})
+	for i := 0; i < values; i++ {
+		q.Add(i)
+	}
+
+	var mu sync.Mutex
+	processed := make(map[int]bool)
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				v, ok := q.Get()
+				if !ok {
+					mu.Lock()
+					done := len(processed) == values
+					mu.Unlock()
+					if done {
+						return
+					}
+					time.Sleep(time.Microsecond)
+					continue
+				}
+
+				// Fail the first attempt of every value.
+				if q.Attempts(v) == 0 {
+					q.Retry(v)
+					continue
+				}
+				q.Forget(v)
+				mu.Lock()
+				if processed[v.(int)] {
+					t.Errorf("Expected: value %d processed once; Got: processed twice", v)
+				}
+				processed[v.(int)] = true
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,71 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package safequeue
+
+import (
+	"runtime"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+var (
+	// batchSizes holds the producer batch sizes probed by the benchmark tests.
+	// A batch size of 1 means no batching.
+	batchSizes = []int{1, 8, 64, 512}
+
+	// benchProducers holds the number of producer goroutines in the benchmark tests.
+	benchProducers = 4
+)
+
+// BenchmarkBatchProducer probes the throughput of multiple producers pushing
+// values in batches while a single consumer pops them.
+func BenchmarkBatchProducer(b *testing.B) {
+	for _, size := range batchSizes {
+		size := size
+		b.Run(strconv.Itoa(size), func(b *testing.B) {
+			q := New()
+			perProducer := b.N/benchProducers + 1
+
+			var wg sync.WaitGroup
+			for i := 0; i < benchProducers; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					p := q.NewBatchProducer(size)
+					for n := 0; n < perProducer; n++ {
+						p.Push(n)
+					}
+					p.Flush()
+				}()
+			}
+
+			for popped := 0; popped < perProducer*benchProducers; {
+				if _, ok := q.Pop(); ok {
+					popped++
+				} else {
+					runtime.Gosched()
+				}
+			}
+			wg.Wait()
+		})
+	}
+}
@@ -0,0 +1,65 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+//go:build go1.13
+// +build go1.13
+
+package safequeue
+
+import (
+	"runtime"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// BenchmarkBatchProducerLatency probes the average time values spend between
+// being pushed by a batching producer and being popped by the consumer.
+// The latency is reported in the latency-ns/op metric.
+func BenchmarkBatchProducerLatency(b *testing.B) {
+	for _, size := range batchSizes {
+		size := size
+		b.Run(strconv.Itoa(size), func(b *testing.B) {
+			q := New()
+
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				p := q.NewBatchProducer(size)
+				for n := 0; n < b.N; n++ {
+					p.Push(time.Now())
+				}
+				p.Flush()
+			}()
+
+			var total time.Duration
+			for popped := 0; popped < b.N; {
+				if v, ok := q.Pop(); ok {
+					total += time.Since(v.(time.Time))
+					popped++
+				} else {
+					runtime.Gosched()
+				}
+			}
+			<-done
+			b.ReportMetric(float64(total.Nanoseconds())/float64(b.N), "latency-ns/op")
+		})
+	}
+}
@@ -0,0 +1,532 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package safequeue implements an unbounded, dynamically growing, thread-safe FIFO queue.
+// Internally, queue wraps a queueimpl3 queue and guards every operation with a mutex.
+// Compound operations such as a conditional pop are provided by PopIf, and arbitrary
+// multi-step operations can be executed atomically using Do.
+// Split returns separate producer and consumer handles, which can be handed out to
+// goroutines that should only add or only remove values, respectively.
+// Watermark callbacks can notify producers when the queue grows too long and when it
+// drains back, so they can be throttled without polling Len.
+// PopRateLimited paces the consumers using a token bucket rate limiter, so the queue can
+// shape the traffic between a bursty producer and a rate capped downstream.
+// SetUnique turns the queue into a deduplicating work queue, whose Push skips the values
+// whose key is already in the queue; the keys are tracked using a map, so membership
+// checks are O(1).
+// SetLenHistogram records the queue length after every operation in a histogram, so the
+// length distribution is available for capacity planning.
+// Init and Reset clear the queue while other goroutines may be using it; Reset also
+// returns the removed values, so they can be handed over instead of being lost.
+package safequeue
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/christianrpetrin/queue-tests/lenstats"
+	"github.com/christianrpetrin/queue-tests/queueerr"
+	"github.com/christianrpetrin/queue-tests/queueimpl3"
+)
+
+// SafeQueue represents an unbounded, dynamically growing, thread-safe FIFO queue.
+// The zero value for queue is an empty queue ready to use.
+type SafeQueue struct {
+	// alen holds a copy of the queue length, updated after every operation
+	// and read without holding the lock by LenApprox.
+	// Kept as the first field to guarantee its 64-bit alignment.
+	alen int64
+
+	// mu guards all other fields.
+	mu sync.Mutex
+
+	// q holds the queue values.
+	q queueimpl3.Queueimpl3
+
+	// w holds the watermarks configuration.
+	w Watermarks
+
+	// high holds whether the queue length reached the high watermark and
+	// didn't drop back to the low watermark yet.
+	high bool
+
+	// rl holds the rate limit configuration of PopRateLimited.
+	rl RateLimit
+
+	// tokens holds the number of tokens in the rate limiter bucket.
+	tokens float64
+
+	// last holds the last time tokens was updated.
+	last time.Time
+
+	// key returns the key identifying value v in unique mode, or is nil if unique mode is disabled.
+	key func(v interface{}) interface{}
+
+	// keys holds the keys of the queue values in unique mode.
+	keys map[interface{}]struct{}
+
+	// hist, if not nil, records the queue length after every operation.
+	hist *lenstats.Histogram
+}
+
+// Watermarks configures callbacks notifying when the queue length reaches a
+// high watermark and when it later drops back to a low watermark.
+// The callbacks are called by the goroutine whose operation made the length
+// cross the watermark, after the queue lock is released; so they may call the
+// queue methods, but the queue length may have changed by the time they run,
+// and OnHigh and OnLow calls triggered by different goroutines may run concurrently.
+type Watermarks struct {
+	// High is the length at which OnHigh is called.
+	// A High of 0 or less disables the watermarks.
+	High int
+
+	// Low is the length at which OnLow is called, once the length reached High.
+	// Low should be lower than High.
+	Low int
+
+	// OnHigh, if not nil, is called with the queue length when it reaches High.
+	OnHigh func(l int)
+
+	// OnLow, if not nil, is called with the queue length when it drops back to Low.
+	OnLow func(l int)
+}
+
+// RateLimit configures the token bucket rate limiter used by PopRateLimited.
+// The bucket holds up to Burst tokens and is refilled at Rate tokens per second;
+// each popped value takes one token.
+type RateLimit struct {
+	// Rate is the number of values per second that can be popped on average.
+	// A Rate of 0 or less disables the rate limiter.
+	Rate float64
+
+	// Burst is the maximum number of values that can be popped at once.
+	// A Burst smaller than 1 is treated as 1.
+	Burst int
+}
+
+// New returns an initialized queue.
+func New() *SafeQueue {
+	return new(SafeQueue).Init()
+}
+
+// Init initializes or clears queue q, discarding its values.
+// Init is safe for concurrent use with the other queue q methods; use Reset to get the
+// discarded values.
+func (q *SafeQueue) Init() *SafeQueue {
+	q.mu.Lock()
+	q.q.Init()
+	if q.key != nil {
+		q.keys = make(map[interface{}]struct{})
+	}
+	q.unlock()
+	return q
+}
+
+// Reset atomically removes all elements from queue q, returning them from the first to
+// the last one, so values displaced by clearing a queue in use are not lost.
+// Values pushed concurrently with Reset are either returned by it or left in the queue.
+// The complexity is O(n), where n is the number of removed elements.
+func (q *SafeQueue) Reset() []interface{} {
+	q.mu.Lock()
+	vs := make([]interface{}, q.q.Len())
+	q.q.PopN(vs)
+	if q.key != nil {
+		q.keys = make(map[interface{}]struct{})
+	}
+	q.unlock()
+	return vs
+}
+
+// SetWatermarks sets the watermarks configuration of queue q.
+// If the queue length is already at or above w.High, w.OnHigh is called right away.
+func (q *SafeQueue) SetWatermarks(w Watermarks) {
+	q.mu.Lock()
+	q.w = w
+	q.high = false
+	q.unlock()
+}
+
+// SetRateLimit sets the rate limiter configuration of PopRateLimited.
+// The rate limiter bucket starts full.
+func (q *SafeQueue) SetRateLimit(rl RateLimit) {
+	if rl.Burst < 1 {
+		rl.Burst = 1
+	}
+	q.mu.Lock()
+	q.rl = rl
+	q.tokens = float64(rl.Burst)
+	q.last = time.Now()
+	q.mu.Unlock()
+}
+
+// SetUnique enables unique mode, in which Push skips the values whose key, as returned by
+// key, is already in the queue; a nil key disables unique mode.
+// Keys must be comparable, e.g. a string or an int.
+// Key is called with the queue locked, so it must not call any other queue q method.
+// If key panics, or returns a key that is not comparable (e.g. a slice), which panics when the
+// key is looked up in the map, the panic propagates to the caller of the method that called
+// key (e.g. SetUnique, Push or Pop) and the queue is unlocked; a pushed value is not added,
+// while a popped value was already removed from the queue and is lost.
+// Values already in the queue, including duplicates, are kept as is.
+// The complexity is O(n), as the keys of the values already in the queue are collected.
+func (q *SafeQueue) SetUnique(key func(v interface{}) interface{}) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.key = key
+	q.rebuildKeys()
+}
+
+// SetLenHistogram sets the histogram recording the queue length after every operation that
+// may modify the queue, e.g. Push and Pop, including the failed ones; a nil h stops recording.
+// The same histogram may be shared by multiple queues, combining their distributions.
+func (q *SafeQueue) SetLenHistogram(h *lenstats.Histogram) {
+	q.mu.Lock()
+	q.hist = h
+	q.mu.Unlock()
+}
+
+// Len returns the number of elements of queue q.
+// The complexity is O(1).
+func (q *SafeQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.q.Len()
+}
+
+// LenApprox returns the number of elements of queue q as of the last completed operation,
+// without acquiring the queue lock, so it doesn't contend with producers and consumers.
+// The returned length may be stale, e.g. not reflect operations in progress; use Len
+// if an exact length is needed.
+// The complexity is O(1).
+func (q *SafeQueue) LenApprox() int {
+	return int(atomic.LoadInt64(&q.alen))
+}
+
+// Front returns the first element of queue q or nil if the queue is empty.
+// The second, bool result indicates whether a valid value was returned;
+//   if the queue is empty, false will be returned.
+// Note the returned value may have been popped already by the time Front returns;
+// use PopIf or Do to inspect and remove the first element atomically.
+// The complexity is O(1).
+func (q *SafeQueue) Front() (interface{}, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.q.Front()
+}
+
+// Contains returns whether queue q holds value v; in unique mode, whether it holds a value
+// with the same key as v.
+// The complexity is O(1) in unique mode; O(n) otherwise.
+func (q *SafeQueue) Contains(v interface{}) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.key == nil {
+		return q.q.Contains(v)
+	}
+	_, ok := q.keys[q.key(v)]
+	return ok
+}
+
+// Push adds a value to the queue.
+// In unique mode, v is skipped if a value with the same key is already in the queue.
+// The complexity is O(1).
+func (q *SafeQueue) Push(v interface{}) {
+	q.mu.Lock()
+	defer q.unlock()
+	q.push(v)
+}
+
+// PushUnique adds a value to the queue, returning whether it was added; i.e. false if
+// unique mode is enabled and a value with the same key is already in the queue.
+// The complexity is O(1).
+func (q *SafeQueue) PushUnique(v interface{}) bool {
+	q.mu.Lock()
+	defer q.unlock()
+	return q.push(v)
+}
+
+// PushBatch adds all values in vs to the queue in order, acquiring the queue lock only once.
+// In unique mode, values whose key is already in the queue, or earlier in vs, are skipped.
+// The complexity is O(n), where n is the number of values in vs.
+func (q *SafeQueue) PushBatch(vs []interface{}) {
+	q.mu.Lock()
+	defer q.unlock()
+	for _, v := range vs {
+		q.push(v)
+	}
+}
+
+// Pop retrieves and removes the next element from the queue.
+// The second, bool result indicates whether a valid value was returned;
+//   if the queue is empty, false will be returned.
+// The complexity is O(1).
+func (q *SafeQueue) Pop() (interface{}, bool) {
+	q.mu.Lock()
+	defer q.unlock()
+	return q.popped(q.q.Pop())
+}
+
+// PopE retrieves and removes the next element from the queue.
+// It is the same as Pop, but returns queueerr.ErrEmpty if the queue is empty.
+// The complexity is O(1).
+func (q *SafeQueue) PopE() (interface{}, error) {
+	if v, ok := q.Pop(); ok {
+		return v, nil
+	}
+	return nil, queueerr.ErrEmpty
+}
+
+// PopRateLimited retrieves and removes the next element from the queue once the rate limiter allows it,
+// waiting for a token to be available if needed.
+// The second, bool result indicates whether a valid value was returned;
+//   if the queue is empty, false will be returned without taking a token.
+// If ctx is done before a token is available, ctx.Err() is returned.
+// If no rate limit was set, PopRateLimited is the same as Pop.
+// The complexity is O(1), not counting the time spent waiting for a token.
+func (q *SafeQueue) PopRateLimited(ctx context.Context) (interface{}, bool, error) {
+	var t *time.Timer
+	for {
+		q.mu.Lock()
+		if q.q.Len() == 0 {
+			q.unlock()
+			return nil, false, nil
+		}
+
+		wait := time.Duration(0)
+		if q.rl.Rate > 0 {
+			now := time.Now()
+			q.tokens += now.Sub(q.last).Seconds() * q.rl.Rate
+			if q.tokens > float64(q.rl.Burst) {
+				q.tokens = float64(q.rl.Burst)
+			}
+			q.last = now
+			if q.tokens < 1 {
+				wait = time.Duration((1 - q.tokens) / q.rl.Rate * float64(time.Second))
+			} else {
+				q.tokens--
+			}
+		}
+		if wait <= 0 {
+			defer q.unlock()
+			v, ok := q.popped(q.q.Pop())
+			return v, ok, nil
+		}
+		q.unlock()
+
+		// Other consumers may take the token in the meantime, so check again after waiting.
+		if t == nil {
+			t = time.NewTimer(wait)
+			defer t.Stop()
+		} else {
+			t.Reset(wait)
+		}
+		select {
+		case <-ctx.Done():
+			return nil, false, ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// PopIf atomically retrieves and removes the next element from the queue only if it satisfies pred.
+// The second, bool result indicates whether a value was removed;
+//   if the queue is empty or the next element doesn't satisfy pred, false will be returned.
+// Pred is called with the queue locked, so it must not call any other queue q method.
+// If pred panics, the queue is unlocked and left as is.
+// The complexity is O(1), not counting the cost of pred.
+func (q *SafeQueue) PopIf(pred func(v interface{}) bool) (interface{}, bool) {
+	q.mu.Lock()
+	defer q.unlock()
+	return q.popped(q.q.PopIf(pred))
+}
+
+// Do calls f with the underlying queue while holding the queue lock, so all
+// operations performed by f are atomic with respect to other queue q methods.
+// F must not retain the underlying queue nor call any other queue q method.
+// In unique mode, f is not restricted by the keys; they are collected again once f returns,
+// so the complexity is O(n), not counting the cost of f.
+func (q *SafeQueue) Do(f func(q *queueimpl3.Queueimpl3)) {
+	q.mu.Lock()
+	defer q.unlock()
+	// The keys are collected again even if f panics, as f may have already modified the queue.
+	defer q.rebuildKeys()
+	f(&q.q)
+}
+
+// push adds value v to the queue, unless unique mode is enabled and its key is
+// already in the queue. It returns whether v was added.
+// Queue q must be locked.
+func (q *SafeQueue) push(v interface{}) bool {
+	if q.key != nil {
+		k := q.key(v)
+		if _, ok := q.keys[k]; ok {
+			return false
+		}
+		q.keys[k] = struct{}{}
+	}
+	q.q.Push(v)
+	return true
+}
+
+// popped removes the key of value v, returned by a pop, in unique mode, returning v and ok as is.
+// Queue q must be locked.
+func (q *SafeQueue) popped(v interface{}, ok bool) (interface{}, bool) {
+	if ok && q.key != nil {
+		delete(q.keys, q.key(v))
+	}
+	return v, ok
+}
+
+// rebuildKeys collects again the keys of all queue values in unique mode.
+// Queue q must be locked.
+func (q *SafeQueue) rebuildKeys() {
+	if q.key == nil {
+		q.keys = nil
+		return
+	}
+	q.keys = make(map[interface{}]struct{}, q.q.Len())
+	q.q.FindFunc(func(v interface{}) bool {
+		q.keys[q.key(v)] = struct{}{}
+		return false
+	})
+}
+
+// unlock updates the approximate length and the length histogram, and releases the queue
+// lock, calling the watermark callback afterwards if the queue length crossed a watermark.
+// Queue q must be locked.
+func (q *SafeQueue) unlock() {
+	atomic.StoreInt64(&q.alen, int64(q.q.Len()))
+	if q.hist != nil {
+		q.hist.Observe(q.q.Len())
+	}
+	if q.w.High <= 0 {
+		q.mu.Unlock()
+		return
+	}
+
+	var f func(l int)
+	l := q.q.Len()
+	if !q.high && l >= q.w.High {
+		q.high = true
+		f = q.w.OnHigh
+	} else if q.high && l <= q.w.Low {
+		q.high = false
+		f = q.w.OnLow
+	}
+	q.mu.Unlock()
+
+	if f != nil {
+		f(l)
+	}
+}
+
+// Producer represents the producing side of a queue.
+// It only allows adding values to the queue.
+type Producer struct {
+	// q holds the queue the values are added to.
+	q *SafeQueue
+}
+
+// Push adds a value to the queue.
+// The complexity is O(1).
+func (p Producer) Push(v interface{}) {
+	p.q.Push(v)
+}
+
+// Consumer represents the consuming side of a queue.
+// It only allows removing values from the queue.
+type Consumer struct {
+	// q holds the queue the values are removed from.
+	q *SafeQueue
+}
+
+// Pop retrieves and removes the next element from the queue.
+// The second, bool result indicates whether a valid value was returned;
+//   if the queue is empty, false will be returned.
+// The complexity is O(1).
+func (c Consumer) Pop() (interface{}, bool) {
+	return c.q.Pop()
+}
+
+// PopIf atomically retrieves and removes the next element from the queue only if it satisfies pred.
+// See SafeQueue.PopIf for details.
+func (c Consumer) PopIf(pred func(v interface{}) bool) (interface{}, bool) {
+	return c.q.PopIf(pred)
+}
+
+// Split returns the producer and consumer handles of queue q.
+// Handing out the producer and consumer handles instead of the queue itself
+// makes the intended usage (e.g. single producer, single consumer) explicit
+// and enforced by the compiler.
+func (q *SafeQueue) Split() (Producer, Consumer) {
+	return Producer{q: q}, Consumer{q: q}
+}
+
+// BatchProducer accumulates values in a producer local buffer and adds them
+// to the queue acquiring the queue lock only once, when the buffer is full or
+// Flush is called.
+// Buffered values are not visible to consumers until they are flushed, so
+// batching trades latency for throughput.
+// A BatchProducer is not safe for concurrent use; each producer goroutine
+// should use its own.
+type BatchProducer struct {
+	// q holds the queue the values are added to.
+	q *SafeQueue
+
+	// buf holds the buffered values.
+	buf []interface{}
+}
+
+// NewBatchProducer returns a producer that adds values to queue q in batches of up to size values.
+// A size smaller than 1 is treated as 1 (i.e. no batching).
+func (q *SafeQueue) NewBatchProducer(size int) *BatchProducer {
+	if size < 1 {
+		size = 1
+	}
+	return &BatchProducer{q: q, buf: make([]interface{}, 0, size)}
+}
+
+// Push adds a value to the producer buffer, flushing the buffer if it is full.
+// The complexity is O(1), not counting the cost of flushing the buffer.
+func (p *BatchProducer) Push(v interface{}) {
+	p.buf = append(p.buf, v)
+	if len(p.buf) >= cap(p.buf) {
+		p.Flush()
+	}
+}
+
+// Flush adds all buffered values to the queue.
+// The complexity is O(n), where n is the number of buffered values.
+func (p *BatchProducer) Flush() {
+	if len(p.buf) == 0 {
+		return
+	}
+
+	p.q.PushBatch(p.buf)
+	for i := range p.buf {
+		p.buf[i] = nil // Avoid memory leaks
+	}
+	p.buf = p.buf[:0]
+}
+
+// Len returns the number of buffered values that were not added to the queue yet.
+func (p *BatchProducer) Len() int { return len(p.buf) }
@@ -0,0 +1,633 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package safequeue
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/christianrpetrin/queue-tests/lenstats"
+	"github.com/christianrpetrin/queue-tests/queueerr"
+	"github.com/christianrpetrin/queue-tests/queueimpl3"
+	"github.com/christianrpetrin/queue-tests/queuetest"
+)
+
+const (
+	// concurrentCount holds the number of values pushed by each goroutine in the concurrent tests.
+	concurrentCount = 10000
+
+	// goroutines holds the number of producer and consumer goroutines in the concurrent tests.
+	goroutines = 4
+)
+
+func TestSafeQueueNewQueueShouldReturnInitiazedInstanceOfQueue(t *testing.T) {
+	q := New()
+
+	if q == nil {
+		t.Error("Expected: new instance of queue; Got: nil")
+	}
+}
+
+func TestSafeQueueWithZeroValueShouldReturnReadyToUseQueue(t *testing.T) {
+	var q SafeQueue
+	q.Push(1)
+
+	if v, ok := q.Pop(); !ok || v.(int) != 1 {
+		t.Errorf("Expected: 1; Got: %d", v)
+	}
+	if _, ok := q.Pop(); ok {
+		t.Error("Expected: empty queue (ok=false); Got: ok=true")
+	}
+}
+
+func TestSafeQueuePushPopFrontShouldRetrieveAllElementsInOrder(t *testing.T) {
+	q := New()
+	for i := 0; i < 1000; i++ {
+		q.Push(i)
+	}
+
+	for i := 0; i < 1000; i++ {
+		if v, ok := q.Front(); !ok || v.(int) != i {
+			t.Errorf("Expected: %d; Got: %d", i, v)
+		}
+		if v, ok := q.Pop(); !ok || v.(int) != i {
+			t.Errorf("Expected: %d; Got: %d", i, v)
+		}
+	}
+	if v, ok := q.Pop(); ok || v != nil {
+		t.Errorf("Expected: nil as the queue should be empty; Got: %d", v)
+	}
+	if q.Len() != 0 {
+		t.Errorf("Expected: %d; Got: %d", 0, q.Len())
+	}
+}
+
+func TestSafeQueueInitShouldClearQueue(t *testing.T) {
+	q := New()
+	q.Push(1)
+	q.Init()
+
+	if q.Len() != 0 {
+		t.Errorf("Expected: %d; Got: %d", 0, q.Len())
+	}
+	if v, ok := q.Front(); ok || v != nil {
+		t.Errorf("Expected: nil as the queue should be empty; Got: %d", v)
+	}
+}
+
+func TestSafeQueueResetShouldReturnAllElementsInOrder(t *testing.T) {
+	q := New()
+	if vs := q.Reset(); len(vs) != 0 {
+		t.Errorf("Expected: no values as the queue is empty; Got: %v", vs)
+	}
+
+	count := 300
+	for i := 0; i < count; i++ {
+		q.Push(i)
+	}
+	vs := q.Reset()
+	if len(vs) != count {
+		t.Fatalf("Expected: %d; Got: %d", count, len(vs))
+	}
+	for i, v := range vs {
+		if v != i {
+			t.Fatalf("Expected: %d; Got: %v", i, v)
+		}
+	}
+	if q.Len() != 0 {
+		t.Errorf("Expected: %d; Got: %d", 0, q.Len())
+	}
+	if v, ok := q.Pop(); ok || v != nil {
+		t.Errorf("Expected: nil as the queue should be empty; Got: %d", v)
+	}
+
+	q.Push(1)
+	if v, ok := q.Pop(); !ok || v != 1 {
+		t.Errorf("Expected: 1; Got: %v", v)
+	}
+}
+
+func TestSafeQueueConcurrentPushPopResetShouldRetrieveAllElementsOnce(t *testing.T) {
+	q := New()
+	queuetest.CheckConcurrentReset(t, "safequeue", q, goroutines, concurrentCount)
+}
+
+func TestSafeQueueConcurrentPushPopShouldRetrieveAllElements(t *testing.T) {
+	q := New()
+	var wg sync.WaitGroup
+	for p := 0; p < goroutines; p++ {
+		wg.Add(1)
+		go func(p int) {
+			defer wg.Done()
+			for i := 0; i < concurrentCount; i++ {
+				q.Push(p*concurrentCount + i)
+			}
+		}(p)
+	}
+
+	seen := make([]bool, goroutines*concurrentCount)
+	var mu sync.Mutex
+	for c := 0; c < goroutines; c++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < concurrentCount; {
+				v, ok := q.Pop()
+				if !ok {
+					runtime.Gosched()
+					continue
+				}
+				mu.Lock()
+				seen[v.(int)] = true
+				mu.Unlock()
+				i++
+			}
+		}()
+	}
+	wg.Wait()
+
+	for i, s := range seen {
+		if !s {
+			t.Errorf("Expected: %d to be popped; Got: not popped", i)
+		}
+	}
+}
+
+func TestSafeQueuePopIfShouldBeAtomic(t *testing.T) {
+	q := New()
+	for i := 0; i < goroutines*concurrentCount; i++ {
+		q.Push(i)
+	}
+
+	// Each consumer only pops values from its own residue class, so with a racy
+	// Front+Pop a consumer would eventually pop another consumer's value.
+	var wg sync.WaitGroup
+	errs := make(chan int, goroutines)
+	for c := 0; c < goroutines; c++ {
+		wg.Add(1)
+		go func(c int) {
+			defer wg.Done()
+			for q.Len() > 0 {
+				v, ok := q.PopIf(func(v interface{}) bool { return v.(int)%goroutines == c })
+				if !ok {
+					runtime.Gosched()
+					continue
+				}
+				if v.(int)%goroutines != c {
+					errs <- v.(int)
+					return
+				}
+			}
+		}(c)
+	}
+	wg.Wait()
+	close(errs)
+
+	for v := range errs {
+		t.Errorf("Expected: values satisfying the predicate only; Got: %d", v)
+	}
+}
+
+func TestSafeQueueDoShouldExecuteOperationsAtomically(t *testing.T) {
+	q := New()
+	var wg sync.WaitGroup
+	for p := 0; p < goroutines; p++ {
+		wg.Add(1)
+		go func(p int) {
+			defer wg.Done()
+			for i := 0; i < concurrentCount; i++ {
+				// Pairs pushed within Do must never be interleaved with other pairs.
+				q.Do(func(q *queueimpl3.Queueimpl3) {
+					q.Push(p)
+					q.Push(p)
+				})
+			}
+		}(p)
+	}
+	wg.Wait()
+
+	if q.Len() != 2*goroutines*concurrentCount {
+		t.Errorf("Expected: %d; Got: %d", 2*goroutines*concurrentCount, q.Len())
+	}
+	for q.Len() > 0 {
+		q.Do(func(q *queueimpl3.Queueimpl3) {
+			v1, _ := q.Pop()
+			v2, _ := q.Pop()
+			if v1 != v2 {
+				t.Errorf("Expected: pair of equal values; Got: %d and %d", v1, v2)
+			}
+		})
+	}
+}
+
+func TestSafeQueueSplitShouldShareQueue(t *testing.T) {
+	q := New()
+	p, c := q.Split()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < concurrentCount; i++ {
+			p.Push(i)
+		}
+	}()
+
+	for i := 0; i < concurrentCount; {
+		v, ok := c.Pop()
+		if !ok {
+			runtime.Gosched()
+			continue
+		}
+		if v.(int) != i {
+			t.Fatalf("Expected: %d; Got: %d", i, v)
+		}
+		i++
+	}
+	<-done
+
+	p.Push(1)
+	if v, ok := c.PopIf(func(v interface{}) bool { return v.(int) == 1 }); !ok || v.(int) != 1 {
+		t.Errorf("Expected: 1; Got: %d", v)
+	}
+	if q.Len() != 0 {
+		t.Errorf("Expected: %d; Got: %d", 0, q.Len())
+	}
+}
+
+func TestSafeQueuePushBatchShouldAddAllValuesInOrder(t *testing.T) {
+	q := New()
+	q.Push(0)
+	q.PushBatch([]interface{}{1, 2, 3})
+
+	for i := 0; i <= 3; i++ {
+		if v, ok := q.Pop(); !ok || v.(int) != i {
+			t.Errorf("Expected: %d; Got: %d", i, v)
+		}
+	}
+	if q.Len() != 0 {
+		t.Errorf("Expected: %d; Got: %d", 0, q.Len())
+	}
+}
+
+func TestSafeQueueBatchProducerShouldOnlyPublishFlushedValues(t *testing.T) {
+	q := New()
+	p := q.NewBatchProducer(3)
+
+	p.Push(1)
+	p.Push(2)
+	if q.Len() != 0 || p.Len() != 2 {
+		t.Errorf("Expected: 0 queued and 2 buffered values; Got: %d and %d", q.Len(), p.Len())
+	}
+
+	p.Push(3)
+	p.Push(4)
+	if q.Len() != 3 || p.Len() != 1 {
+		t.Errorf("Expected: 3 queued and 1 buffered values; Got: %d and %d", q.Len(), p.Len())
+	}
+	p.Flush()
+	p.Flush()
+	for i := 1; i <= 4; i++ {
+		if v, ok := q.Pop(); !ok || v.(int) != i {
+			t.Errorf("Expected: %d; Got: %d", i, v)
+		}
+	}
+	if _, ok := q.Pop(); ok {
+		t.Error("Expected: empty queue; Got: non-empty")
+	}
+}
+
+func TestSafeQueueBatchProducerWithInvalidSizeShouldNotBuffer(t *testing.T) {
+	q := New()
+	p := q.NewBatchProducer(-1)
+
+	p.Push(1)
+	if v, ok := q.Pop(); !ok || v.(int) != 1 {
+		t.Errorf("Expected: 1; Got: %d", v)
+	}
+}
+
+func TestSafeQueueWatermarksShouldNotifyWhenLengthCrossesWatermarks(t *testing.T) {
+	q := New()
+	var events []int
+	q.SetWatermarks(Watermarks{
+		High:   10,
+		Low:    5,
+		OnHigh: func(l int) { events = append(events, l) },
+		OnLow:  func(l int) { events = append(events, -l) },
+	})
+
+	for r := 0; r < 2; r++ {
+		for i := 0; i < 20; i++ {
+			q.Push(i)
+		}
+		for i := 0; i < 20; i++ {
+			q.Pop()
+		}
+	}
+
+	expected := []int{10, -5, 10, -5}
+	if len(events) != len(expected) {
+		t.Fatalf("Expected: %v; Got: %v", expected, events)
+	}
+	for i := range expected {
+		if events[i] != expected[i] {
+			t.Fatalf("Expected: %v; Got: %v", expected, events)
+		}
+	}
+}
+
+func TestSafeQueueWatermarksCallbacksShouldBeAbleToUseQueue(t *testing.T) {
+	q := New()
+	var high, low int
+	q.SetWatermarks(Watermarks{
+		High:   2,
+		Low:    0,
+		OnHigh: func(l int) { high = q.Len() },
+		OnLow:  func(l int) { low = q.Len() },
+	})
+
+	q.Push(1)
+	q.Push(2)
+	q.Pop()
+	q.Pop()
+	if high != 2 || low != 0 {
+		t.Errorf("Expected: 2 and 0; Got: %d and %d", high, low)
+	}
+}
+
+func TestSafeQueueSetWatermarksWithLongQueueShouldNotifyRightAway(t *testing.T) {
+	q := New()
+	for i := 0; i < 10; i++ {
+		q.Push(i)
+	}
+
+	high := 0
+	q.SetWatermarks(Watermarks{High: 5, OnHigh: func(l int) { high = l }})
+	if high != 10 {
+		t.Errorf("Expected: %d; Got: %d", 10, high)
+	}
+}
+
+func TestSafeQueuePopRateLimitedShouldPaceConsumers(t *testing.T) {
+	q := New()
+	q.SetRateLimit(RateLimit{Rate: 1000, Burst: 10})
+	for i := 0; i < 60; i++ {
+		q.Push(i)
+	}
+
+	start := time.Now()
+	for i := 0; i < 60; i++ {
+		v, ok, err := q.PopRateLimited(context.Background())
+		if err != nil || !ok || v.(int) != i {
+			t.Fatalf("Expected: %d; Got: %v, %v", i, v, err)
+		}
+		if i == 9 {
+			if elapsed := time.Since(start); elapsed > 30*time.Millisecond {
+				t.Errorf("Expected: burst popped right away; Got: %v", elapsed)
+			}
+		}
+	}
+	// The last 50 values are popped at 1000 values per second.
+	if elapsed := time.Since(start); elapsed < 45*time.Millisecond {
+		t.Errorf("Expected: at least %v; Got: %v", 45*time.Millisecond, elapsed)
+	}
+}
+
+func TestSafeQueuePopRateLimitedWithEmptyQueueShouldNotTakeToken(t *testing.T) {
+	q := New()
+	q.SetRateLimit(RateLimit{Rate: 0.001, Burst: 1})
+
+	if _, ok, err := q.PopRateLimited(context.Background()); ok || err != nil {
+		t.Errorf("Expected: empty queue; Got: %v, %v", ok, err)
+	}
+	q.Push(1)
+	if v, ok, err := q.PopRateLimited(context.Background()); !ok || err != nil || v.(int) != 1 {
+		t.Errorf("Expected: 1; Got: %v, %v", v, err)
+	}
+}
+
+func TestSafeQueuePopRateLimitedShouldStopWhenContextIsDone(t *testing.T) {
+	q := New()
+	q.SetRateLimit(RateLimit{Rate: 0.001, Burst: 1})
+	q.Push(1)
+	q.Push(2)
+	q.PopRateLimited(context.Background())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, _, err := q.PopRateLimited(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Expected: %v; Got: %v", context.DeadlineExceeded, err)
+	}
+	if q.Len() != 1 {
+		t.Errorf("Expected: %d; Got: %d", 1, q.Len())
+	}
+}
+
+func TestSafeQueuePopRateLimitedWithoutRateLimitShouldPop(t *testing.T) {
+	q := New()
+	q.Push(1)
+
+	if v, ok, err := q.PopRateLimited(context.Background()); !ok || err != nil || v.(int) != 1 {
+		t.Errorf("Expected: 1; Got: %v, %v", v, err)
+	}
+}
+
+func TestSafeQueueLenApproxShouldReturnLengthAfterCompletedOperations(t *testing.T) {
+	q := New()
+	for i := 0; i < 10; i++ {
+		q.Push(i)
+	}
+	q.Pop()
+
+	if l := q.LenApprox(); l != 9 {
+		t.Errorf("Expected: %d; Got: %d", 9, l)
+	}
+}
+
+func TestSafeQueuePopEShouldReturnErrEmptyWhenEmpty(t *testing.T) {
+	q := New()
+	q.Push(1)
+
+	if v, err := q.PopE(); err != nil || v != 1 {
+		t.Errorf("Expected: %d; Got: %v, %v", 1, v, err)
+	}
+	if v, err := q.PopE(); err != queueerr.ErrEmpty || v != nil {
+		t.Errorf("Expected: %v; Got: %v, %v", queueerr.ErrEmpty, v, err)
+	}
+}
+
+func TestSafeQueueSetUniqueShouldSkipValuesAlreadyInQueue(t *testing.T) {
+	q := New()
+	q.Push("a")
+	q.Push("a")
+	q.SetUnique(func(v interface{}) interface{} { return v })
+
+	if q.PushUnique("a") {
+		t.Error("Expected: duplicate value skipped; Got: added")
+	}
+	if !q.PushUnique("b") {
+		t.Error("Expected: new value added; Got: skipped")
+	}
+	q.Push("b")
+	q.PushBatch([]interface{}{"c", "c", "b"})
+	if q.Len() != 4 {
+		t.Errorf("Expected: %d; Got: %d", 4, q.Len())
+	}
+	if !q.Contains("c") || q.Contains("d") {
+		t.Errorf("Expected: %v, %v; Got: %v, %v", true, false, q.Contains("c"), q.Contains("d"))
+	}
+
+	for _, expected := range []string{"a", "a", "b"} {
+		if v, ok := q.Pop(); !ok || v != expected {
+			t.Errorf("Expected: %s; Got: %v", expected, v)
+		}
+	}
+	if !q.PushUnique("b") {
+		t.Error("Expected: popped value added again; Got: skipped")
+	}
+	if v, ok := q.PopIf(func(v interface{}) bool { return v == "c" }); !ok || v != "c" {
+		t.Errorf("Expected: %s; Got: %v", "c", v)
+	}
+	if q.Contains("c") {
+		t.Error("Expected: popped value not contained; Got: contained")
+	}
+}
+
+func TestSafeQueueSetUniqueShouldUseKeyFunction(t *testing.T) {
+	type item struct {
+		id   int
+		data []byte
+	}
+	q := New()
+	q.SetUnique(func(v interface{}) interface{} { return v.(item).id })
+
+	q.Push(item{id: 1, data: []byte("first")})
+	q.Push(item{id: 1, data: []byte("second")})
+	q.Push(item{id: 2})
+	if q.Len() != 2 {
+		t.Errorf("Expected: %d; Got: %d", 2, q.Len())
+	}
+	if v, ok := q.Pop(); !ok || string(v.(item).data) != "first" {
+		t.Errorf("Expected: %s; Got: %v", "first", v)
+	}
+}
+
+func TestSafeQueueSetUniqueWithNonComparableKeyShouldPanicInPushAndUnlockQueue(t *testing.T) {
+	q := New()
+	q.SetUnique(func(v interface{}) interface{} { return v })
+
+	func() {
+		defer func() {
+			if r := recover(); r == nil {
+				t.Error("Expected: panic; Got: no panic")
+			}
+		}()
+		q.Push([]int{1})
+	}()
+	q.Push(1)
+	if q.Len() != 1 {
+		t.Errorf("Expected: %d; Got: %d", 1, q.Len())
+	}
+}
+
+func TestSafeQueueDoShouldKeepUniqueKeysInSync(t *testing.T) {
+	q := New()
+	q.SetUnique(func(v interface{}) interface{} { return v })
+	q.Push(1)
+	q.Do(func(q *queueimpl3.Queueimpl3) {
+		q.Pop()
+		q.Push(2)
+	})
+
+	if q.Contains(1) || !q.Contains(2) {
+		t.Errorf("Expected: %v, %v; Got: %v, %v", false, true, q.Contains(1), q.Contains(2))
+	}
+	if !q.PushUnique(1) || q.PushUnique(2) {
+		t.Error("Expected: keys to reflect the values pushed and popped by Do")
+	}
+
+	q.SetUnique(nil)
+	if !q.PushUnique(2) {
+		t.Error("Expected: duplicate value added with unique mode disabled; Got: skipped")
+	}
+}
+
+func TestSafeQueuePanickingCallbacksShouldNotLeaveQueueLocked(t *testing.T) {
+	q := New()
+	q.SetUnique(func(v interface{}) interface{} {
+		if v == "panic" {
+			panic(v)
+		}
+		return v
+	})
+	mustPanic := func(f func()) {
+		defer func() {
+			if r := recover(); r == nil {
+				t.Error("Expected: panic; Got: no panic")
+			}
+		}()
+		f()
+	}
+
+	mustPanic(func() { q.Push("panic") })
+	mustPanic(func() { q.PushBatch([]interface{}{1, "panic"}) })
+	mustPanic(func() { q.PopIf(func(v interface{}) bool { panic(v) }) })
+	mustPanic(func() {
+		q.Do(func(q *queueimpl3.Queueimpl3) {
+			q.Push(2)
+			panic(2)
+		})
+	})
+
+	// The queue is unlocked, and the keys reflect the values pushed before the panics.
+	if q.Len() != 2 || !q.Contains(1) || !q.Contains(2) || q.PushUnique(2) {
+		t.Errorf("Expected: values 1 and 2 in the queue; Got: length %d", q.Len())
+	}
+}
+
+func TestSafeQueueSetLenHistogramShouldRecordLengthAfterEveryOperation(t *testing.T) {
+	q := New()
+	var h lenstats.Histogram
+	q.SetLenHistogram(&h)
+
+	for i := 0; i < 3; i++ {
+		q.Push(i)
+	}
+	for i := 0; i < 3; i++ {
+		q.Pop()
+	}
+	q.SetLenHistogram(nil)
+	q.Push(1)
+
+	// Lengths 1, 2, 3, 2, 1, 0.
+	s := h.Snapshot()
+	if s.Count != 6 || s.Max != 3 {
+		t.Errorf("Expected: %d samples, max %d; Got: %+v", 6, 3, s)
+	}
+	for i, expected := range []uint64{1, 2, 3} {
+		if s.Buckets[i].Count != expected {
+			t.Errorf("Expected: %d samples in bucket %d; Got: %d", expected, i, s.Buckets[i].Count)
+		}
+	}
+}
@@ -0,0 +1,234 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package schedtest implements a deterministic scheduler to test how concurrent operations on
+// lock-free data structures interleave.
+// Internally, each thread of a test runs in its own goroutine, but only one thread runs at any
+// given time: the running thread runs until it reaches a yield point, usually a test hook placed
+// between the atomic steps of the data structure operations, where the scheduler chooses the
+// next thread to run. Each run therefore follows a single interleaving, identified by the
+// sequence of threads chosen at each step (i.e. the schedule), which can be replayed to
+// reproduce an interleaving that triggered a bug, or systematically explored to check
+// every interleaving of a small test.
+// As the scheduler only switches threads at yield points, threads must not block waiting for
+// each other (e.g. using locks or channels); lock-free data structures never do.
+package schedtest
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+// DefaultMaxSteps holds the default maximum number of steps of a run.
+const DefaultMaxSteps = 10000
+
+// Schedule holds the thread chosen at each step of a run.
+type Schedule []int
+
+// Chooser chooses the thread to run next among the runnable ones, which are never empty.
+// It returns an element of runnable.
+type Chooser func(runnable []int) int
+
+// Random returns a chooser choosing threads uniformly at random, using seed.
+// Runs using the same seed follow the same schedule.
+func Random(seed int64) Chooser {
+	r := rand.New(rand.NewSource(seed))
+	return func(runnable []int) int { return runnable[r.Intn(len(runnable))] }
+}
+
+// Replay returns a chooser following schedule s, so a run follows the same interleaving as the
+// run that produced s. Once s is exhausted, or if the thread chosen by s is not runnable, the
+// first runnable thread is chosen.
+func Replay(s Schedule) Chooser {
+	step := 0
+	return func(runnable []int) int {
+		if step < len(s) {
+			id := s[step]
+			step++
+			for _, r := range runnable {
+				if r == id {
+					return id
+				}
+			}
+		}
+		return runnable[0]
+	}
+}
+
+// Scheduler represents a deterministic scheduler.
+// The zero value for Scheduler is ready to use.
+// A Scheduler runs a single set of threads at a time.
+type Scheduler struct {
+	// MaxSteps holds the maximum number of steps of a run; once reached, the remaining threads
+	// run to completion without yielding, and Run returns an error. 0 means DefaultMaxSteps.
+	MaxSteps int
+
+	// current holds the running thread, or nil if no thread is running.
+	current *thread
+
+	// free is true once the threads run without yielding.
+	free bool
+
+	// yielded is signaled by the running thread when it yields or finishes.
+	yielded chan struct{}
+}
+
+// thread represents a thread run by the scheduler.
+type thread struct {
+	// resume is signaled by the scheduler to resume the thread.
+	resume chan struct{}
+
+	// done is true once the thread finished.
+	done bool
+
+	// panic holds the value the thread panicked with, if any.
+	panic interface{}
+}
+
+// Yield lets the scheduler choose the next thread to run, if called by a thread run by the
+// scheduler; otherwise, Yield does nothing, so data structures can be set up before a run.
+// Yield is meant to be set as the test hook called at the yield points of the data structure.
+func (s *Scheduler) Yield() {
+	t := s.current
+	if t == nil || s.free {
+		return
+	}
+	s.yielded <- struct{}{}
+	<-t.resume
+}
+
+// Run runs each function of threads in its own thread, using choose to choose the thread
+// running at each step, and returns the resulting schedule.
+// A step runs a thread until its next yield point, or until it finishes.
+// Run returns an error if a thread panicked, or if the run exceeded MaxSteps.
+func (s *Scheduler) Run(choose Chooser, threads ...func()) (Schedule, error) {
+	max := s.MaxSteps
+	if max <= 0 {
+		max = DefaultMaxSteps
+	}
+	s.free = false
+	s.yielded = make(chan struct{})
+
+	ts := make([]*thread, len(threads))
+	for i, f := range threads {
+		t := &thread{resume: make(chan struct{})}
+		ts[i] = t
+		go s.start(t, f)
+	}
+
+	var schedule Schedule
+	runnable := make([]int, 0, len(ts))
+	for {
+		runnable = runnable[:0]
+		for i, t := range ts {
+			if !t.done {
+				runnable = append(runnable, i)
+			}
+		}
+		if len(runnable) == 0 {
+			break
+		}
+		if len(schedule) >= max {
+			s.finish(ts)
+			return schedule, fmt.Errorf("schedtest: run exceeded %d steps; schedule %v", max, schedule)
+		}
+
+		id := choose(runnable)
+		schedule = append(schedule, id)
+		s.current = ts[id]
+		ts[id].resume <- struct{}{}
+		<-s.yielded
+	}
+	s.current = nil
+
+	for i, t := range ts {
+		if t.panic != nil {
+			return schedule, fmt.Errorf("schedtest: thread %d panicked: %v; schedule %v", i, t.panic, schedule)
+		}
+	}
+	return schedule, nil
+}
+
+// start runs function f in thread t, once resumed by the scheduler.
+func (s *Scheduler) start(t *thread, f func()) {
+	<-t.resume
+	defer func() {
+		t.panic = recover()
+		t.done = true
+		s.yielded <- struct{}{}
+	}()
+	f()
+}
+
+// finish runs the unfinished threads of ts to completion, without yielding.
+func (s *Scheduler) finish(ts []*thread) {
+	s.current = nil
+	s.free = true
+	n := 0
+	for _, t := range ts {
+		if !t.done {
+			t.resume <- struct{}{}
+			n++
+		}
+	}
+	for ; n > 0; n-- {
+		<-s.yielded
+	}
+}
+
+// Explore calls run repeatedly, each time with a chooser following a different schedule, in
+// depth first order, until all the schedules were explored, maxRuns runs were done, or run
+// returns an error. The run function should reset the data structure under test, run its
+// threads using the chooser and check the result.
+// Explore returns the number of runs done and the first error returned by run, if any.
+func Explore(maxRuns int, run func(choose Chooser) error) (int, error) {
+	// choices holds the chosen index into the runnable threads, and the number of runnable
+	// threads, at each step of the schedule being explored.
+	type choice struct{ index, options int }
+	var choices []choice
+
+	runs := 0
+	for runs < maxRuns {
+		step := 0
+		choose := func(runnable []int) int {
+			if step == len(choices) {
+				choices = append(choices, choice{index: 0, options: len(runnable)})
+			}
+			c := choices[step]
+			step++
+			return runnable[c.index]
+		}
+		runs++
+		if err := run(choose); err != nil {
+			return runs, err
+		}
+
+		// Backtrack to the last step with unexplored choices.
+		choices = choices[:step]
+		for len(choices) > 0 && choices[len(choices)-1].index+1 >= choices[len(choices)-1].options {
+			choices = choices[:len(choices)-1]
+		}
+		if len(choices) == 0 {
+			break
+		}
+		choices[len(choices)-1].index++
+	}
+	return runs, nil
+}
@@ -0,0 +1,157 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package schedtest
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sync/atomic"
+	"testing"
+)
+
+func TestSchedulerRunShouldOnlySwitchThreadsAtYieldPoints(t *testing.T) {
+	var s Scheduler
+	var trace []string
+	thread := func(name string) func() {
+		return func() {
+			trace = append(trace, name+"1")
+			s.Yield()
+			trace = append(trace, name+"2")
+		}
+	}
+
+	schedule, err := s.Run(Replay(Schedule{0, 1, 1, 0}), thread("a"), thread("b"))
+	if err != nil {
+		t.Fatalf("Expected: no error; Got: %v", err)
+	}
+	if expected := []string{"a1", "b1", "b2", "a2"}; !reflect.DeepEqual(trace, expected) {
+		t.Errorf("Expected: %v; Got: %v", expected, trace)
+	}
+	if expected := (Schedule{0, 1, 1, 0}); !reflect.DeepEqual(schedule, expected) {
+		t.Errorf("Expected: %v; Got: %v", expected, schedule)
+	}
+}
+
+func TestSchedulerYieldOutsideRunShouldDoNothing(t *testing.T) {
+	var s Scheduler
+	s.Yield()
+}
+
+func TestSchedulerRunWithSameSeedShouldFollowSameSchedule(t *testing.T) {
+	var s Scheduler
+	thread := func() {
+		for i := 0; i < 10; i++ {
+			s.Yield()
+		}
+	}
+
+	first, _ := s.Run(Random(42), thread, thread, thread)
+	second, _ := s.Run(Random(42), thread, thread, thread)
+	if !reflect.DeepEqual(first, second) {
+		t.Errorf("Expected: %v; Got: %v", first, second)
+	}
+}
+
+func TestSchedulerRunShouldReportPanics(t *testing.T) {
+	var s Scheduler
+	_, err := s.Run(Random(0), func() { panic("boom") }, func() {})
+	if err == nil {
+		t.Error("Expected: error; Got: nil")
+	}
+}
+
+func TestSchedulerRunExceedingMaxStepsShouldFinishThreads(t *testing.T) {
+	s := Scheduler{MaxSteps: 10}
+	var stop int32
+	spin := func() {
+		for atomic.LoadInt32(&stop) == 0 {
+			s.Yield()
+		}
+	}
+	// Once the steps are exhausted, threads run without yielding, so the second thread stops the first.
+	_, err := s.Run(Replay(nil), spin, func() { atomic.StoreInt32(&stop, 1) })
+	if err == nil {
+		t.Error("Expected: error; Got: nil")
+	}
+}
+
+func TestExploreShouldRunEveryInterleavingOnce(t *testing.T) {
+	var s Scheduler
+	thread := func() {
+		s.Yield()
+		s.Yield()
+	}
+
+	seen := make(map[string]bool)
+	runs, err := Explore(1000, func(choose Chooser) error {
+		schedule, err := s.Run(choose, thread, thread)
+		if err != nil {
+			return err
+		}
+		key := fmt.Sprint(schedule)
+		if seen[key] {
+			return fmt.Errorf("schedule %v explored twice", schedule)
+		}
+		seen[key] = true
+		return nil
+	})
+
+	// Each thread runs 3 steps, so there are 6!/(3!3!) interleavings.
+	if err != nil || runs != 20 || len(seen) != 20 {
+		t.Errorf("Expected: %d runs; Got: %d runs, %d schedules, %v", 20, runs, len(seen), err)
+	}
+}
+
+func TestExploreShouldFindLostUpdate(t *testing.T) {
+	var s Scheduler
+	var counter int
+	increment := func() {
+		v := counter
+		s.Yield()
+		counter = v + 1
+	}
+
+	errLostUpdate := errors.New("lost update")
+	var failing Schedule
+	_, err := Explore(1000, func(choose Chooser) error {
+		counter = 0
+		schedule, err := s.Run(choose, increment, increment)
+		if err != nil {
+			return err
+		}
+		if counter != 2 {
+			failing = schedule
+			return errLostUpdate
+		}
+		return nil
+	})
+	if err != errLostUpdate {
+		t.Fatalf("Expected: %v; Got: %v", errLostUpdate, err)
+	}
+
+	// The failing schedule reproduces the lost update.
+	counter = 0
+	s.Run(Replay(failing), increment, increment)
+	if counter != 1 {
+		t.Errorf("Expected: %d; Got: %d", 1, counter)
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package shardcount implements a counter distributed over multiple shards, so goroutines
+// running on different Ps update it without contending on a single memory location.
+// Internally, the counter holds at least as many shards as Ps, each in its own cache line;
+// Add updates the shard of the calling goroutine, and Load sums all shards. Updates are cheap
+// and scale with the number of Ps, while reads cost O(s), where s is the number of shards, and
+// are not atomic with respect to concurrent updates; this suits counters that are updated far
+// more often than they are read, such as the length of a concurrent queue.
+// Go doesn't expose the P a goroutine runs on, so the shard of each goroutine is picked from
+// the address of its stack, which is distinct per goroutine and only changes when the stack
+// grows or shrinks; each goroutine keeps updating the same shard, and goroutines running on
+// different Ps mostly update different shards.
+package shardcount
+
+import (
+	"runtime"
+	"sync/atomic"
+	"unsafe"
+)
+
+// cacheLineSize holds the assumed size of a CPU cache line.
+// It is 64 bytes on most amd64 and arm64 CPUs.
+const cacheLineSize = 64
+
+// stackShift holds the number of low address bits ignored when picking a shard, as they only
+// tell apart positions within the same goroutine stack, whose minimum size is 2KB.
+const stackShift = 11
+
+// Counter represents a sharded counter.
+// The zero value for Counter is not ready to use; use New to create a counter.
+// Counter is safe for concurrent use by multiple goroutines.
+type Counter struct {
+	// shards holds the counter shards. Its length is always a power of two.
+	shards []shard
+
+	// mask holds the bitmask mapping a hash to a shard index.
+	mask uintptr
+}
+
+// shard represents a counter shard.
+type shard struct {
+	// n holds the shard count.
+	// Kept as the first field to guarantee its 64-bit alignment.
+	n int64
+
+	// _ keeps each shard in its own cache line.
+	_ [cacheLineSize - 8]byte
+}
+
+// New returns a counter holding 0, with at least as many shards as Ps (i.e. GOMAXPROCS).
+func New() *Counter {
+	s := 1
+	for s < runtime.GOMAXPROCS(0) {
+		s *= 2
+	}
+	return &Counter{shards: make([]shard, s), mask: uintptr(s - 1)}
+}
+
+// Shards returns the number of shards of counter c.
+func (c *Counter) Shards() int { return len(c.shards) }
+
+// Add adds delta to counter c.
+// The complexity is O(1).
+func (c *Counter) Add(delta int64) {
+	atomic.AddInt64(&c.shards[c.index()].n, delta)
+}
+
+// Load returns the sum of the shards of counter c.
+// The shards are read one at a time, so the sum may not reflect the updates made concurrently
+// with Load; in particular, if values are added to a shard and then removed from another one,
+// the sum may be lower than any value the counter actually held.
+// The complexity is O(s), where s is the number of shards.
+func (c *Counter) Load() int64 {
+	var n int64
+	for i := range c.shards {
+		n += atomic.LoadInt64(&c.shards[i].n)
+	}
+	return n
+}
+
+// Reset sets counter c to 0.
+// Reset is not safe for concurrent use with Add.
+// The complexity is O(s), where s is the number of shards.
+func (c *Counter) Reset() {
+	for i := range c.shards {
+		atomic.StoreInt64(&c.shards[i].n, 0)
+	}
+}
+
+// index returns the index of the shard of the calling goroutine.
+func (c *Counter) index() uintptr {
+	var local byte
+	h := uint64(uintptr(unsafe.Pointer(&local)) >> stackShift)
+	// Fibonacci hashing spreads the stacks, usually allocated next to each other, over all shards.
+	h *= 0x9e3779b97f4a7c15
+	return uintptr(h>>48) & c.mask
+}
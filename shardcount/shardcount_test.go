@@ -0,0 +1,107 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package shardcount
+
+import (
+	"runtime"
+	"sync"
+	"testing"
+)
+
+func TestNewShouldHoldAPowerOfTwoShardsAtLeastAsManyAsPs(t *testing.T) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(6))
+	c := New()
+	if c.Shards() != 8 {
+		t.Errorf("Expected: %d shards; Got: %d", 8, c.Shards())
+	}
+	if c.Load() != 0 {
+		t.Errorf("Expected: %d; Got: %d", 0, c.Load())
+	}
+}
+
+func TestCounterShouldSumConcurrentAdds(t *testing.T) {
+	c := New()
+	var wg sync.WaitGroup
+	for g := 0; g < 16; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				c.Add(2)
+				c.Add(-1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if c.Load() != 16*1000 {
+		t.Errorf("Expected: %d; Got: %d", 16*1000, c.Load())
+	}
+
+	c.Reset()
+	if c.Load() != 0 {
+		t.Errorf("Expected: %d after Reset; Got: %d", 0, c.Load())
+	}
+}
+
+func TestCounterShouldSpreadGoroutinesOverShards(t *testing.T) {
+	c := &Counter{shards: make([]shard, 64), mask: 63}
+	// Keep all goroutines alive until all of them added, so their stacks are not reused.
+	var added, done sync.WaitGroup
+	release := make(chan struct{})
+	for g := 0; g < 64; g++ {
+		added.Add(1)
+		done.Add(1)
+		go func() {
+			defer done.Done()
+			c.Add(1)
+			added.Done()
+			<-release
+		}()
+	}
+	added.Wait()
+	close(release)
+	done.Wait()
+
+	used := 0
+	for i := range c.shards {
+		if c.shards[i].n > 0 {
+			used++
+		}
+	}
+	if used < 16 {
+		t.Errorf("Expected: at least %d shards used by 64 goroutines; Got: %d", 16, used)
+	}
+	if c.Load() != 64 {
+		t.Errorf("Expected: %d; Got: %d", 64, c.Load())
+	}
+}
+
+func TestCounterShouldUpdateTheSameShardFromTheSameGoroutine(t *testing.T) {
+	c := &Counter{shards: make([]shard, 64), mask: 63}
+	i := c.index()
+	for n := 0; n < 100; n++ {
+		c.Add(1)
+	}
+	if c.shards[i].n != 100 {
+		t.Errorf("Expected: %d in shard %d; Got: %d", 100, i, c.shards[i].n)
+	}
+}
@@ -0,0 +1,205 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package shedqueue implements a bounded priority queue that, once full, makes room for new
+// values by shedding queued values instead of rejecting the new ones, e.g. for request buffers
+// in front of overloaded services, where the least valuable or most stale work should be
+// dropped first.
+// Internally, queue keeps a queueimpl3 FIFO queue per distinct priority in a levels list,
+// sorted by priority, as agingqueue does. As the values of each priority are kept in push
+// order, the lowest priority value to shed is the first value of the lowest priority, and the
+// oldest value is the first value of one of the priorities, so shedding doesn't need to look
+// at the other values.
+package shedqueue
+
+import (
+	"github.com/christianrpetrin/queue-tests/levels"
+)
+
+// Policy decides the value shed when a value is pushed to a full queue.
+type Policy int
+
+const (
+	// ShedLowest sheds the lowest priority value, the oldest one among the values of that
+	// priority. A pushed value whose priority is lower than the priority of all queued values
+	// is shed itself.
+	ShedLowest Policy = iota
+
+	// ShedOldest sheds the oldest value, regardless of its priority.
+	// Pushed values are always added.
+	ShedOldest
+)
+
+// Options configures a queue.
+type Options struct {
+	// Capacity holds the maximum number of values in the queue. It must be positive.
+	Capacity int
+
+	// Policy decides the value shed when a value is pushed to a full queue.
+	// The zero value is ShedLowest.
+	Policy Policy
+
+	// OnShed is called with each shed value and its priority, after the queue was updated,
+	// so it may use the queue.
+	// A nil OnShed discards the shed values.
+	OnShed func(v interface{}, priority int)
+}
+
+// ShedQueue represents a bounded priority queue shedding values when full.
+// Values with the same priority are popped in FIFO order.
+// The zero value for queue is not ready to use; use New to create a queue.
+type ShedQueue struct {
+	// opts holds the queue configuration.
+	opts Options
+
+	// levels holds a level for each distinct priority of the queue values, sorted by
+	// descending priority.
+	levels levels.List
+
+	// seq holds the sequence number of the next pushed value.
+	seq uint64
+
+	// len holds the current queue length.
+	len int
+
+	// shed holds the number of values shed so far.
+	shed uint64
+}
+
+// entry represents a queue value along with its push order.
+type entry struct {
+	// v holds the user added value.
+	v interface{}
+
+	// seq holds the push sequence number, which finds the oldest value with ShedOldest.
+	seq uint64
+}
+
+// New returns an initialized queue configured by opts.
+func New(opts Options) *ShedQueue {
+	if opts.Capacity < 1 {
+		panic("shedqueue: non-positive capacity")
+	}
+	return &ShedQueue{opts: opts}
+}
+
+// Len returns the number of elements of queue q.
+// The complexity is O(1).
+func (q *ShedQueue) Len() int { return q.len }
+
+// Cap returns the capacity of queue q.
+// The complexity is O(1).
+func (q *ShedQueue) Cap() int { return q.opts.Capacity }
+
+// Shed returns the number of values shed by queue q so far, including the pushed values
+// that were shed themselves.
+// The complexity is O(1).
+func (q *ShedQueue) Shed() uint64 { return q.shed }
+
+// Front returns the element of queue q with the highest priority, or nil if the queue is empty.
+// The second, bool result indicates whether a valid value was returned;
+//   if the queue is empty, false will be returned.
+// The complexity is O(1).
+func (q *ShedQueue) Front() (interface{}, bool) {
+	if q.len == 0 {
+		return nil, false
+	}
+	e, _ := q.levels.Levels()[0].Q.Front()
+	return e.(entry).v, true
+}
+
+// Push adds a value with the given priority to the queue.
+// Higher values mean higher priority.
+// If the queue is full, a value is shed according to the queue policy, and OnShed is called
+// with it. Push returns false if v was shed itself, or true if it was added to the queue.
+// The complexity is O(1), or O(p) if no other value of the same priority is in the queue,
+// if shedding removes the last value of a priority, or if shedding with ShedOldest, where p
+// is the number of distinct priorities in the queue.
+func (q *ShedQueue) Push(v interface{}, priority int) bool {
+	var victim *levels.Level
+	if q.len >= q.opts.Capacity {
+		switch q.opts.Policy {
+		case ShedOldest:
+			victim = q.oldest()
+		default:
+			victim = q.levels.Levels()[q.levels.Len()-1]
+			if priority < victim.Priority {
+				q.shed++
+				if q.opts.OnShed != nil {
+					q.opts.OnShed(v, priority)
+				}
+				return false
+			}
+		}
+	}
+
+	var shed interface{}
+	if victim != nil {
+		e, _ := victim.Q.Pop()
+		shed = e.(entry).v
+		q.len--
+		q.shed++
+		if victim.Q.Len() == 0 {
+			q.levels.Remove(victim)
+		}
+	}
+
+	l := q.levels.Get(priority)
+	l.Q.Push(entry{v: v, seq: q.seq})
+	q.seq++
+	q.len++
+
+	if victim != nil && q.opts.OnShed != nil {
+		q.opts.OnShed(shed, victim.Priority)
+	}
+	return true
+}
+
+// Pop retrieves and removes the element with the highest priority from the queue.
+// The second, bool result indicates whether a valid value was returned;
+//   if the queue is empty, false will be returned.
+// The complexity is O(1), or O(p) if it removes the last value of a priority, where p is
+// the number of distinct priorities in the queue.
+func (q *ShedQueue) Pop() (interface{}, bool) {
+	if q.len == 0 {
+		return nil, false
+	}
+
+	l := q.levels.Levels()[0]
+	e, _ := l.Q.Pop()
+	q.len--
+	if l.Q.Len() == 0 {
+		q.levels.Remove(l)
+	}
+	return e.(entry).v, true
+}
+
+// oldest returns the level holding the oldest value of the non-empty queue.
+func (q *ShedQueue) oldest() *levels.Level {
+	var oldest *levels.Level
+	var oldestSeq uint64
+	for _, l := range q.levels.Levels() {
+		v, _ := l.Q.Front()
+		if seq := v.(entry).seq; oldest == nil || seq < oldestSeq {
+			oldest, oldestSeq = l, seq
+		}
+	}
+	return oldest
+}
@@ -0,0 +1,257 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package shedqueue
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// shed holds a value shed by a queue along with its priority.
+type shed struct {
+	v        interface{}
+	priority int
+}
+
+// recorder records the values shed by a queue.
+type recorder struct {
+	shed []shed
+}
+
+func (r *recorder) onShed(v interface{}, priority int) { r.shed = append(r.shed, shed{v, priority}) }
+
+func TestShedQueueNewQueueShouldReturnInitiazedInstanceOfQueue(t *testing.T) {
+	q := New(Options{Capacity: 4})
+
+	if q == nil {
+		t.Error("Expected: new instance of queue; Got: nil")
+	}
+	if q.Cap() != 4 {
+		t.Errorf("Expected: %d; Got: %d", 4, q.Cap())
+	}
+	if v, ok := q.Pop(); ok || v != nil {
+		t.Errorf("Expected: nil as the queue should be empty; Got: %v", v)
+	}
+	if v, ok := q.Front(); ok || v != nil {
+		t.Errorf("Expected: nil as the queue should be empty; Got: %v", v)
+	}
+}
+
+func TestShedQueueNewShouldPanicWithNonPositiveCapacity(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected: panic; Got: none")
+		}
+	}()
+	New(Options{})
+}
+
+func TestShedQueueShouldPopByPriorityThenFIFO(t *testing.T) {
+	q := New(Options{Capacity: 8})
+	q.Push("low1", 1)
+	q.Push("high1", 10)
+	q.Push("mid", 5)
+	q.Push("high2", 10)
+	q.Push("low2", 1)
+
+	for _, expected := range []string{"high1", "high2", "mid", "low1", "low2"} {
+		if v, ok := q.Front(); !ok || v.(string) != expected {
+			t.Errorf("Expected: %s; Got: %v", expected, v)
+		}
+		if v, ok := q.Pop(); !ok || v.(string) != expected {
+			t.Errorf("Expected: %s; Got: %v", expected, v)
+		}
+	}
+	if q.Len() != 0 || q.levels.Len() != 0 {
+		t.Errorf("Expected: empty queue; Got: %d values and %d levels", q.Len(), q.levels.Len())
+	}
+	if q.Shed() != 0 {
+		t.Errorf("Expected: %d shed values; Got: %d", 0, q.Shed())
+	}
+}
+
+func TestShedQueueShedLowestShouldShedOldestValueOfLowestPriority(t *testing.T) {
+	r := &recorder{}
+	q := New(Options{Capacity: 3, OnShed: r.onShed})
+	q.Push("mid", 5)
+	q.Push("low1", 1)
+	q.Push("low2", 1)
+
+	if !q.Push("high", 10) {
+		t.Error("Expected: high to be added; Got: shed")
+	}
+	if !q.Push("low3", 1) {
+		t.Error("Expected: low3 to be added; Got: shed")
+	}
+	if q.Push("lowest", 0) {
+		t.Error("Expected: lowest to be shed; Got: added")
+	}
+	q.Push("mid2", 5)
+
+	expectedShed := []shed{{"low1", 1}, {"low2", 1}, {"lowest", 0}, {"low3", 1}}
+	if len(r.shed) != len(expectedShed) {
+		t.Fatalf("Expected: %v; Got: %v", expectedShed, r.shed)
+	}
+	for i, s := range expectedShed {
+		if r.shed[i] != s {
+			t.Errorf("Expected: %v; Got: %v", s, r.shed[i])
+		}
+	}
+	if q.Shed() != uint64(len(expectedShed)) {
+		t.Errorf("Expected: %d shed values; Got: %d", len(expectedShed), q.Shed())
+	}
+	for _, expected := range []string{"high", "mid", "mid2"} {
+		if v, ok := q.Pop(); !ok || v.(string) != expected {
+			t.Errorf("Expected: %s; Got: %v", expected, v)
+		}
+	}
+}
+
+func TestShedQueueShedOldestShouldShedOldestValue(t *testing.T) {
+	r := &recorder{}
+	q := New(Options{Capacity: 3, Policy: ShedOldest, OnShed: r.onShed})
+	q.Push("high1", 10)
+	q.Push("low1", 1)
+	q.Push("high2", 10)
+
+	if !q.Push("lowest", 0) {
+		t.Error("Expected: lowest to be added; Got: shed")
+	}
+	q.Push("mid", 5)
+
+	expectedShed := []shed{{"high1", 10}, {"low1", 1}}
+	if len(r.shed) != len(expectedShed) {
+		t.Fatalf("Expected: %v; Got: %v", expectedShed, r.shed)
+	}
+	for i, s := range expectedShed {
+		if r.shed[i] != s {
+			t.Errorf("Expected: %v; Got: %v", s, r.shed[i])
+		}
+	}
+	for _, expected := range []string{"high2", "mid", "lowest"} {
+		if v, ok := q.Pop(); !ok || v.(string) != expected {
+			t.Errorf("Expected: %s; Got: %v", expected, v)
+		}
+	}
+}
+
+func TestShedQueueOnShedShouldBeAbleToUseTheQueue(t *testing.T) {
+	// Shed values are pushed back with a lower priority, until they reach priority 0.
+	r := &recorder{}
+	var q *ShedQueue
+	q = New(Options{Capacity: 2, OnShed: func(v interface{}, priority int) {
+		if q.Len() != q.Cap() {
+			t.Errorf("Expected: full queue in OnShed; Got: %d values", q.Len())
+		}
+		r.onShed(v, priority)
+		if priority > 0 {
+			q.Push(v, priority-1)
+		}
+	}})
+	q.Push("a", 2)
+	q.Push("b", 2)
+	q.Push("c", 2)
+
+	// c sheds a, which is then shed itself when pushed back, as all queued values have a higher priority.
+	expectedShed := []shed{{"a", 2}, {"a", 1}, {"a", 0}}
+	if len(r.shed) != len(expectedShed) {
+		t.Fatalf("Expected: %v; Got: %v", expectedShed, r.shed)
+	}
+	for i, s := range expectedShed {
+		if r.shed[i] != s {
+			t.Errorf("Expected: %v; Got: %v", s, r.shed[i])
+		}
+	}
+	for _, expected := range []string{"b", "c"} {
+		if v, ok := q.Pop(); !ok || v.(string) != expected {
+			t.Errorf("Expected: %s; Got: %v", expected, v)
+		}
+	}
+}
+
+func TestShedQueueShouldMatchReferenceModel(t *testing.T) {
+	for _, policy := range []Policy{ShedLowest, ShedOldest} {
+		r := &recorder{}
+		q := New(Options{Capacity: 16, Policy: policy, OnShed: r.onShed})
+		rnd := rand.New(rand.NewSource(1))
+
+		// The model holds the queue values in push order.
+		var model []shed
+		var shedCount int
+		for n := 0; n < 10000; n++ {
+			if rnd.Intn(3) == 0 {
+				// Pop the first value with the highest priority.
+				best := -1
+				for i, s := range model {
+					if best < 0 || s.priority > model[best].priority {
+						best = i
+					}
+				}
+				v, ok := q.Pop()
+				if best < 0 {
+					if ok {
+						t.Fatalf("Expected: empty queue; Got: %v", v)
+					}
+					continue
+				}
+				if !ok || v != model[best].v {
+					t.Fatalf("Expected: %v; Got: %v", model[best].v, v)
+				}
+				model = append(model[:best], model[best+1:]...)
+				continue
+			}
+
+			s := shed{n, rnd.Intn(5)}
+			var victim shed
+			if len(model) == q.Cap() {
+				// Shed the first value with the lowest priority, or the first value.
+				w := 0
+				if policy == ShedLowest {
+					for i, m := range model {
+						if m.priority < model[w].priority {
+							w = i
+						}
+					}
+				}
+				if policy == ShedLowest && s.priority < model[w].priority {
+					victim = s
+				} else {
+					victim = model[w]
+					model = append(model[:w], model[w+1:]...)
+				}
+				shedCount++
+			}
+			if victim != s {
+				model = append(model, s)
+			}
+
+			if added := q.Push(s.v, s.priority); added != (victim != s) {
+				t.Fatalf("Expected: added %t; Got: %t", victim != s, added)
+			}
+			if victim != (shed{}) && r.shed[len(r.shed)-1] != victim {
+				t.Fatalf("Expected: %v shed; Got: %v", victim, r.shed[len(r.shed)-1])
+			}
+			if q.Len() != len(model) || len(r.shed) != shedCount || q.Shed() != uint64(shedCount) {
+				t.Fatalf("Expected: %d values and %d shed; Got: %d and %d", len(model), shedCount, q.Len(), len(r.shed))
+			}
+		}
+	}
+}
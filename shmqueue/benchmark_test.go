@@ -0,0 +1,153 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+//go:build (linux || darwin || dragonfly || freebsd || netbsd || openbsd) && go1.13
+// +build linux darwin dragonfly freebsd netbsd openbsd
+// +build go1.13
+
+package shmqueue
+
+import (
+	"sort"
+	"testing"
+	"time"
+)
+
+// benchValue holds the value passed around by the benchmark tests.
+var benchValue = []byte("01234567")
+
+// roundTripper sends a value to an echo and waits for it to come back.
+type roundTripper struct {
+	// name holds the benchmark name.
+	name string
+
+	// start starts the echo, returning the function sending a value to it and waiting for
+	// it back, and the function stopping it.
+	start func(b *testing.B) (roundTrip func(), stop func())
+}
+
+// roundTrippers holds the echoes compared by the benchmark tests.
+var roundTrippers = []roundTripper{
+	{name: "Channel", start: func(b *testing.B) (func(), func()) {
+		in, out := make(chan []byte, DefaultCapacity), make(chan []byte, DefaultCapacity)
+		go func() {
+			for v := range in {
+				out <- v
+			}
+		}()
+		return func() { in <- benchValue; <-out }, func() { close(in) }
+	}},
+	{name: "InProcess", start: func(b *testing.B) (func(), func()) {
+		in, out := createPair(b, Options{})
+		return func() { push(in, benchValue); pop(out) }, startLocalEcho(in, out)
+	}},
+	{name: "CrossProcess", start: func(b *testing.B) (func(), func()) {
+		in, out := createPair(b, Options{})
+		stop := startEcho(b, in, out)
+		// Wait for the echo process to be ready, so its start up is not measured.
+		push(in, benchValue)
+		pop(out)
+		return func() { push(in, benchValue); pop(out) }, stop
+	}},
+}
+
+// BenchmarkPingPong probes the round-trip latency of a value sent to an echo and back, using
+// buffered channels, and a pair of shared memory queues with the echo running in another
+// goroutine or in another process.
+// Besides the mean, it reports the 50th and 99th percentile of the sampled round trips.
+func BenchmarkPingPong(b *testing.B) {
+	for _, rt := range roundTrippers {
+		rt := rt
+		b.Run(rt.name, func(b *testing.B) {
+			roundTrip, stop := rt.start(b)
+			defer stop()
+
+			// Sample every round trip up to a limit, to keep the sampling overhead constant.
+			every := b.N/(1<<16) + 1
+			samples := make([]time.Duration, 0, b.N/every+1)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for n := 0; n < b.N; n++ {
+				if n%every == 0 {
+					start := time.Now()
+					roundTrip()
+					samples = append(samples, time.Since(start))
+				} else {
+					roundTrip()
+				}
+			}
+			b.StopTimer()
+
+			sort.Sort(durations(samples))
+			b.ReportMetric(float64(samples[len(samples)/2].Nanoseconds()), "p50-ns")
+			b.ReportMetric(float64(samples[len(samples)*99/100].Nanoseconds()), "p99-ns")
+		})
+	}
+}
+
+// BenchmarkPipelined probes the throughput of the shared memory queues, keeping up to
+// the queue capacity values in flight to an echo running in another goroutine or in another
+// process.
+func BenchmarkPipelined(b *testing.B) {
+	echoes := []struct {
+		name  string
+		start func(b *testing.B, in, out *ShmQueue) func()
+	}{
+		{name: "InProcess", start: func(b *testing.B, in, out *ShmQueue) func() { return startLocalEcho(in, out) }},
+		{name: "CrossProcess", start: func(b *testing.B, in, out *ShmQueue) func() { return startEcho(b, in, out) }},
+	}
+
+	for _, e := range echoes {
+		e := e
+		b.Run(e.name, func(b *testing.B) {
+			in, out := createPair(b, Options{})
+			stop := e.start(b, in, out)
+			defer stop()
+			push(in, benchValue)
+			pop(out)
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			sent, received := 0, 0
+			for tries := 0; received < b.N; tries++ {
+				progress := false
+				if sent < b.N && in.Push(benchValue) == nil {
+					sent++
+					progress = true
+				}
+				if _, ok := out.Pop(); ok {
+					received++
+					progress = true
+				}
+				if progress {
+					tries = 0
+				}
+				wait(tries)
+			}
+		})
+	}
+}
+
+// durations implements sort.Interface, sorting durations in ascending order.
+type durations []time.Duration
+
+func (d durations) Len() int           { return len(d) }
+func (d durations) Less(i, j int) bool { return d[i] < d[j] }
+func (d durations) Swap(i, j int)      { d[i], d[j] = d[j], d[i] }
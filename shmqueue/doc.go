@@ -0,0 +1,38 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package shmqueue implements an experimental bounded, single-producer single-consumer FIFO
+// queue over shared memory, so the producer and the consumer can run in different OS processes.
+// Internally, queue store the values in a ring buffer of fixed sized slots held in a file mapped
+// into the memory of each process using mmap, along with a header holding the ring buffer
+// geometry and the producer and consumer positions, each in its own cache line. As in
+// queueimpl11, the capacity is always a power of two, so positions are wrapped using a bitmask.
+// Each slot holds a value encoded by the queue codec, prefixed by its length, so values larger
+// than the slot are rejected rather than split across slots.
+// The positions are only ever increased, by the producer and the consumer respectively, using
+// atomic stores, so no lock shared across the processes is needed. Push and Pop never block;
+// there is no cross-process notification, so callers poll the queue, e.g. spinning for a while
+// and then sleeping.
+// This implementation tests the latency of passing values between processes over shared memory
+// compared with passing them between goroutines.
+// The implementation is only built on unix systems providing mmap:
+//
+//	go test -benchmem -bench=. ./shmqueue
+package shmqueue
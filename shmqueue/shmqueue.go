@@ -0,0 +1,362 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+//go:build linux || darwin || dragonfly || freebsd || netbsd || openbsd
+// +build linux darwin dragonfly freebsd netbsd openbsd
+
+package shmqueue
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"syscall"
+	"unsafe"
+
+	"github.com/christianrpetrin/queue-tests/codec"
+	"github.com/christianrpetrin/queue-tests/queueerr"
+)
+
+const (
+	// DefaultCapacity holds the default number of slots of a queue.
+	DefaultCapacity = 1024
+
+	// DefaultSlotSize holds the default size, in bytes, of each slot, including the value length.
+	DefaultSlotSize = 256
+
+	// magic identifies the queue files.
+	magic = 0x514d4853 // "SHMQ" in little endian
+
+	// version holds the version of the queue file format.
+	version = 1
+
+	// cacheLineSize holds the assumed size of a CPU cache line.
+	// It is 64 bytes on most amd64 and arm64 CPUs.
+	cacheLineSize = 64
+
+	// tailOffset holds the offset of the producer position in the file.
+	tailOffset = cacheLineSize
+
+	// headOffset holds the offset of the consumer position in the file.
+	headOffset = 2 * cacheLineSize
+
+	// headerSize holds the size of the file header, which the slots follow: the magic number,
+	// the version, the capacity and the slot size, followed by the producer and the consumer
+	// positions, each in its own cache line.
+	headerSize = 3 * cacheLineSize
+
+	// lengthSize holds the size of the value length prefixing each slot.
+	lengthSize = 4
+)
+
+var (
+	// ErrFull is returned by Push when the queue is full.
+	ErrFull = errors.New("shmqueue: full")
+
+	// ErrTooLarge is returned by Push when the encoded value doesn't fit in a slot.
+	ErrTooLarge = errors.New("shmqueue: value too large")
+
+	// ErrInvalid is returned by Open when the file doesn't hold a valid queue.
+	ErrInvalid = errors.New("shmqueue: invalid queue file")
+)
+
+// Options configures a queue created by Create.
+// The zero value for Options holds the default configuration.
+type Options struct {
+	// Capacity is the number of slots, rounded up to a power of two.
+	// A Capacity of 0 or less uses DefaultCapacity.
+	Capacity int
+
+	// SlotSize is the size, in bytes, of each slot, including the 4 bytes holding the value
+	// length, rounded up to a multiple of 8.
+	// A SlotSize of 0 or less uses DefaultSlotSize.
+	SlotSize int
+
+	// Codec encodes and decodes the queue values. The producer and the consumer must use
+	// codecs able to decode each other values. Open ignores the other options.
+	// A nil Codec uses codec.Bytes, so the queue values must be of type []byte.
+	Codec codec.ElementCodec
+}
+
+// ShmQueue represents a bounded FIFO queue over shared memory.
+// A ShmQueue is safe for concurrent use by a single producer goroutine, calling Push, and a
+// single consumer goroutine, calling Pop and PopE, in the same process or in processes that
+// opened the same file.
+type ShmQueue struct {
+	// f holds the queue file.
+	f *os.File
+
+	// mem holds the mapped file.
+	mem []byte
+
+	// tail points to the producer position in the mapped file.
+	tail *uint64
+
+	// head points to the consumer position in the mapped file.
+	head *uint64
+
+	// mask holds the bitmask wrapping a position to a slot index.
+	mask uint64
+
+	// slotSize holds the size of each slot.
+	slotSize int
+
+	// codec encodes and decodes the queue values.
+	codec codec.ElementCodec
+
+	// err holds the first decoding error that occurred, if any.
+	err error
+
+	// _ keeps the producer cache in a different cache line than the read-only fields.
+	_ [cacheLineSize]byte
+
+	// headCache holds the consumer position last observed by the producer, so the producer
+	// only reads the consumer cache line when the queue looks full.
+	headCache uint64
+
+	// _ keeps the consumer cache in a different cache line than the producer cache.
+	_ [cacheLineSize]byte
+
+	// tailCache holds the producer position last observed by the consumer, so the consumer
+	// only reads the producer cache line when the queue looks empty.
+	tailCache uint64
+}
+
+// Create creates the queue file path, truncating it if it already exists, and opens it.
+// The other processes using the queue open the file using Open.
+func Create(path string, opts Options) (*ShmQueue, error) {
+	capacity := DefaultCapacity
+	if opts.Capacity > 0 {
+		capacity = 1
+		for capacity < opts.Capacity {
+			capacity *= 2
+		}
+	}
+	slotSize := DefaultSlotSize
+	if opts.SlotSize > 0 {
+		slotSize = (opts.SlotSize + 7) &^ 7
+	}
+	if slotSize <= lengthSize || uint64(capacity)*uint64(slotSize) > 1<<40 {
+		return nil, fmt.Errorf("shmqueue: invalid geometry, %d slots of %d bytes", capacity, slotSize)
+	}
+
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, err
+	}
+	var h [headerSize]byte
+	binary.LittleEndian.PutUint32(h[0:], magic)
+	binary.LittleEndian.PutUint32(h[4:], version)
+	binary.LittleEndian.PutUint32(h[8:], uint32(capacity))
+	binary.LittleEndian.PutUint32(h[12:], uint32(slotSize))
+	if _, err := f.WriteAt(h[:], 0); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if err := f.Truncate(int64(headerSize + capacity*slotSize)); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return open(f, opts)
+}
+
+// Open opens the queue file path, created by Create, in this or another process.
+// The values pushed but not popped yet are kept, so a queue can be reopened, e.g. after the
+// consumer restarts; but the queue doesn't survive a reboot unless the file is on disk.
+// Only opts.Codec is used; the queue geometry is read from the file.
+func Open(path string, opts Options) (*ShmQueue, error) {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	return open(f, opts)
+}
+
+// open maps the queue file f, validating its header.
+func open(f *os.File, opts Options) (*ShmQueue, error) {
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	size := fi.Size()
+	var h [headerSize]byte
+	if size < headerSize {
+		f.Close()
+		return nil, ErrInvalid
+	}
+	if _, err := f.ReadAt(h[:], 0); err != nil {
+		f.Close()
+		return nil, err
+	}
+	capacity := uint64(binary.LittleEndian.Uint32(h[8:]))
+	slotSize := uint64(binary.LittleEndian.Uint32(h[12:]))
+	if binary.LittleEndian.Uint32(h[0:]) != magic || binary.LittleEndian.Uint32(h[4:]) != version ||
+		capacity == 0 || capacity&(capacity-1) != 0 || slotSize <= lengthSize || slotSize%8 != 0 ||
+		uint64(size) != headerSize+capacity*slotSize {
+		f.Close()
+		return nil, ErrInvalid
+	}
+
+	mem, err := syscall.Mmap(int(f.Fd()), 0, int(size), syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("shmqueue: mmap failed: %v", err)
+	}
+
+	q := &ShmQueue{
+		f:        f,
+		mem:      mem,
+		tail:     (*uint64)(unsafe.Pointer(&mem[tailOffset])),
+		head:     (*uint64)(unsafe.Pointer(&mem[headOffset])),
+		mask:     capacity - 1,
+		slotSize: int(slotSize),
+		codec:    opts.Codec,
+	}
+	if q.codec == nil {
+		q.codec = codec.Bytes
+	}
+	q.headCache = atomic.LoadUint64(q.head)
+	q.tailCache = atomic.LoadUint64(q.tail)
+	return q, nil
+}
+
+// Close unmaps and closes the queue file; the queue must not be used afterwards.
+// The file is not removed, and the queue values are kept in it.
+func (q *ShmQueue) Close() error {
+	err := syscall.Munmap(q.mem)
+	if cerr := q.f.Close(); err == nil {
+		err = cerr
+	}
+	q.mem = nil
+	q.tail = nil
+	q.head = nil
+	return err
+}
+
+// Err returns the first error that occurred while decoding the popped values, if any.
+// Values that cannot be decoded are removed from the queue, and Pop reports the queue as empty.
+func (q *ShmQueue) Err() error { return q.err }
+
+// Cap returns the number of slots of queue q.
+// The complexity is O(1).
+func (q *ShmQueue) Cap() int { return int(q.mask + 1) }
+
+// MaxValueSize returns the size of the largest encoded value a slot can hold.
+// The complexity is O(1).
+func (q *ShmQueue) MaxValueSize() int { return q.slotSize - lengthSize }
+
+// Len returns the number of elements of queue q.
+// As values are pushed and popped concurrently, the returned length may be stale.
+// The complexity is O(1).
+func (q *ShmQueue) Len() int {
+	head := atomic.LoadUint64(q.head)
+	return int(atomic.LoadUint64(q.tail) - head)
+}
+
+// Push adds a value to the queue, encoded by the queue codec.
+// It returns ErrFull if the queue is full, and ErrTooLarge if the encoded value doesn't fit in
+// a slot; in both cases the value is not added.
+// Push must only be called by the single producer.
+// The complexity is O(1), not counting the cost of encoding the value.
+func (q *ShmQueue) Push(v interface{}) error {
+	b, err := q.codec.Encode(v)
+	if err != nil {
+		return err
+	}
+	if len(b) > q.MaxValueSize() {
+		return ErrTooLarge
+	}
+
+	// Only the producer updates the tail, so it never changes under it.
+	tail := atomic.LoadUint64(q.tail)
+	if tail-q.headCache > q.mask {
+		q.headCache = atomic.LoadUint64(q.head)
+		if tail-q.headCache > q.mask {
+			return ErrFull
+		}
+	}
+
+	s := q.slot(tail)
+	binary.LittleEndian.PutUint32(s, uint32(len(b)))
+	copy(s[lengthSize:], b)
+	// Publish the slot: the consumer only reads it once it observes the new tail.
+	atomic.StoreUint64(q.tail, tail+1)
+	return nil
+}
+
+// Pop retrieves and removes the next element from the queue, decoded by the queue codec.
+// The second, bool result indicates whether a valid value was returned;
+//   if the queue is empty, false will be returned.
+// Pop must only be called by the single consumer.
+// The complexity is O(1), not counting the cost of decoding the value.
+func (q *ShmQueue) Pop() (interface{}, bool) {
+	v, err := q.pop()
+	return v, err == nil
+}
+
+// PopE retrieves and removes the next element from the queue.
+// It is the same as Pop, but returns queueerr.ErrEmpty if the queue is empty, or the
+// decoding error if the value cannot be decoded.
+// The complexity is O(1), not counting the cost of decoding the value.
+func (q *ShmQueue) PopE() (interface{}, error) {
+	return q.pop()
+}
+
+// pop removes the next element from the queue, returning it decoded, or queueerr.ErrEmpty
+// if the queue is empty, or the decoding error if the value cannot be decoded.
+func (q *ShmQueue) pop() (interface{}, error) {
+	// Only the consumer updates the head, so it never changes under it.
+	head := atomic.LoadUint64(q.head)
+	if head == q.tailCache {
+		q.tailCache = atomic.LoadUint64(q.tail)
+		if head == q.tailCache {
+			return nil, queueerr.ErrEmpty
+		}
+	}
+
+	s := q.slot(head)
+	n := binary.LittleEndian.Uint32(s)
+	var v interface{}
+	var err error
+	if int(n) > q.MaxValueSize() {
+		err = fmt.Errorf("shmqueue: invalid value length %d at position %d", n, head)
+	} else {
+		// The codec doesn't retain the slot, so it can be reused once the head is advanced.
+		v, err = q.codec.Decode(s[lengthSize : lengthSize+n])
+	}
+	// Release the slot: the producer only reuses it once it observes the new head.
+	atomic.StoreUint64(q.head, head+1)
+	if err != nil {
+		if q.err == nil {
+			q.err = err
+		}
+		return nil, err
+	}
+	return v, nil
+}
+
+// slot returns the slot holding the value at position p.
+func (q *ShmQueue) slot(p uint64) []byte {
+	off := headerSize + int(p&q.mask)*q.slotSize
+	return q.mem[off : off+q.slotSize]
+}
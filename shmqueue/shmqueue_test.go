@@ -0,0 +1,379 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+//go:build linux || darwin || dragonfly || freebsd || netbsd || openbsd
+// +build linux darwin dragonfly freebsd netbsd openbsd
+
+package shmqueue
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/christianrpetrin/queue-tests/queueerr"
+)
+
+// stopValue is the value telling echo to return.
+const stopValue = "stop"
+
+// testDir holds the directory the test queue files are created in, removed once the tests are done.
+var testDir string
+
+func TestMain(m *testing.M) {
+	dir, err := ioutil.TempDir("", "shmqueue-test")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	testDir = dir
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// wait backs off while a queue is empty or full, after tries attempts: it spins first, so
+// values passed promptly are not delayed, then yields the processor, and then sleeps, so a
+// process running on the same CPU can make progress.
+func wait(tries int) {
+	switch {
+	case tries < 64:
+	case tries < 1024:
+		runtime.Gosched()
+	default:
+		time.Sleep(10 * time.Microsecond)
+	}
+}
+
+// push pushes v to queue q, waiting while the queue is full.
+func push(q *ShmQueue, v interface{}) error {
+	for tries := 0; ; tries++ {
+		err := q.Push(v)
+		if err != ErrFull {
+			return err
+		}
+		wait(tries)
+	}
+}
+
+// pop pops a value from queue q, waiting while the queue is empty.
+func pop(q *ShmQueue) interface{} {
+	for tries := 0; ; tries++ {
+		if v, ok := q.Pop(); ok {
+			return v
+		}
+		wait(tries)
+	}
+}
+
+// echo pops the values from queue in and pushes them to queue out, until it pops stopValue.
+func echo(in, out *ShmQueue) {
+	for {
+		v := pop(in)
+		if string(v.([]byte)) == stopValue {
+			return
+		}
+		push(out, v)
+	}
+}
+
+// TestShmQueueHelperProcess is not a real test: it is run as a separate process by the tests
+// and benchmark tests, echoing the values pushed to the SHMQUEUE_IN queue back to the
+// SHMQUEUE_OUT queue.
+func TestShmQueueHelperProcess(t *testing.T) {
+	if os.Getenv("SHMQUEUE_HELPER") != "1" {
+		t.Skip("only run as a helper process")
+	}
+	in, err := Open(os.Getenv("SHMQUEUE_IN"), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+	out, err := Open(os.Getenv("SHMQUEUE_OUT"), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	echo(in, out)
+}
+
+// tempDir creates a new temporary directory in testDir, failing tb on error.
+func tempDir(tb testing.TB) string {
+	dir, err := ioutil.TempDir(testDir, "")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return dir
+}
+
+// createPair creates the queues to and from an echo, in a temporary directory.
+func createPair(tb testing.TB, opts Options) (in, out *ShmQueue) {
+	dir := tempDir(tb)
+	in, err := Create(filepath.Join(dir, "in"), opts)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	out, err = Create(filepath.Join(dir, "out"), opts)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return in, out
+}
+
+// startEcho runs echo in a separate process, using the files of queues in and out.
+// The returned function stops the process and closes the queues.
+func startEcho(tb testing.TB, in, out *ShmQueue) func() {
+	cmd := exec.Command(os.Args[0], "-test.run=^TestShmQueueHelperProcess$")
+	cmd.Env = append(os.Environ(), "SHMQUEUE_HELPER=1", "SHMQUEUE_IN="+in.f.Name(), "SHMQUEUE_OUT="+out.f.Name())
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		tb.Fatal(err)
+	}
+	return func() {
+		push(in, []byte(stopValue))
+		done := make(chan error, 1)
+		go func() { done <- cmd.Wait() }()
+		select {
+		case err := <-done:
+			if err != nil {
+				tb.Errorf("Expected: echo process to exit cleanly; Got: %v", err)
+			}
+		case <-time.After(10 * time.Second):
+			cmd.Process.Kill()
+			tb.Error("Expected: echo process to exit; Got: timeout")
+		}
+		in.Close()
+		out.Close()
+	}
+}
+
+// startLocalEcho runs echo in a separate goroutine.
+// The returned function stops the goroutine and closes the queues.
+func startLocalEcho(in, out *ShmQueue) func() {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		echo(in, out)
+	}()
+	return func() {
+		push(in, []byte(stopValue))
+		<-done
+		in.Close()
+		out.Close()
+	}
+}
+
+func TestShmQueueShouldPopValuesInPushOrder(t *testing.T) {
+	q, err := Create(filepath.Join(tempDir(t), "q"), Options{Capacity: 8})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+
+	next, want := 0, 0
+	// Push and pop more values than slots, so the positions wrap around.
+	for round := 0; round < 10; round++ {
+		for i := 0; i < 5; i++ {
+			if err := q.Push([]byte(strconv.Itoa(next))); err != nil {
+				t.Fatalf("Expected: no error; Got: %v", err)
+			}
+			next++
+		}
+		for q.Len() > 0 {
+			v, ok := q.Pop()
+			if !ok || string(v.([]byte)) != strconv.Itoa(want) {
+				t.Fatalf("Expected: %d, true; Got: %s, %t", want, v, ok)
+			}
+			want++
+		}
+	}
+	if want != next {
+		t.Errorf("Expected: %d values popped; Got: %d", next, want)
+	}
+}
+
+func TestShmQueuePushShouldFailWhenFull(t *testing.T) {
+	q, err := Create(filepath.Join(tempDir(t), "q"), Options{Capacity: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+
+	if q.Cap() != 4 {
+		t.Errorf("Expected: %d slots; Got: %d", 4, q.Cap())
+	}
+	for i := 0; i < 4; i++ {
+		if err := q.Push([]byte{byte(i)}); err != nil {
+			t.Fatalf("Expected: no error; Got: %v", err)
+		}
+	}
+	if err := q.Push([]byte{4}); err != ErrFull {
+		t.Errorf("Expected: %v; Got: %v", ErrFull, err)
+	}
+
+	q.Pop()
+	if err := q.Push([]byte{4}); err != nil {
+		t.Errorf("Expected: no error after Pop; Got: %v", err)
+	}
+	if q.Len() != 4 {
+		t.Errorf("Expected: %d; Got: %d", 4, q.Len())
+	}
+}
+
+func TestShmQueuePopShouldReportEmptyQueue(t *testing.T) {
+	q, err := Create(filepath.Join(tempDir(t), "q"), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+
+	if v, ok := q.Pop(); ok || v != nil {
+		t.Errorf("Expected: nil, false; Got: %v, %t", v, ok)
+	}
+	if _, err := q.PopE(); err != queueerr.ErrEmpty {
+		t.Errorf("Expected: %v; Got: %v", queueerr.ErrEmpty, err)
+	}
+}
+
+func TestShmQueuePushShouldRejectValuesLargerThanSlots(t *testing.T) {
+	q, err := Create(filepath.Join(tempDir(t), "q"), Options{SlotSize: 13})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+
+	if q.MaxValueSize() != 12 {
+		t.Errorf("Expected: %d bytes; Got: %d", 12, q.MaxValueSize())
+	}
+	if err := q.Push(make([]byte, 13)); err != ErrTooLarge {
+		t.Errorf("Expected: %v; Got: %v", ErrTooLarge, err)
+	}
+	if err := q.Push(make([]byte, 12)); err != nil {
+		t.Errorf("Expected: no error; Got: %v", err)
+	}
+	if err := q.Push("not bytes"); err == nil {
+		t.Error("Expected: codec error; Got: no error")
+	}
+	if q.Len() != 1 {
+		t.Errorf("Expected: %d; Got: %d", 1, q.Len())
+	}
+}
+
+func TestShmQueueOpenShouldShareValuesWithOtherMappings(t *testing.T) {
+	path := filepath.Join(tempDir(t), "q")
+	p, err := Create(path, Options{Capacity: 16, SlotSize: 32})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	p.Push([]byte("a"))
+
+	c, err := Open(path, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Cap() != 16 || c.MaxValueSize() != 28 {
+		t.Errorf("Expected: %d slots of %d bytes; Got: %d of %d", 16, 28, c.Cap(), c.MaxValueSize())
+	}
+	p.Push([]byte("b"))
+	for _, want := range []string{"a", "b"} {
+		if v, ok := c.Pop(); !ok || string(v.([]byte)) != want {
+			t.Errorf("Expected: %s, true; Got: %s, %t", want, v, ok)
+		}
+	}
+	if p.Len() != 0 {
+		t.Errorf("Expected: %d; Got: %d", 0, p.Len())
+	}
+
+	// Values left in the queue are kept when it is reopened.
+	p.Push([]byte("c"))
+	c.Close()
+	c, err = Open(path, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if v, ok := c.Pop(); !ok || string(v.([]byte)) != "c" {
+		t.Errorf("Expected: c, true; Got: %s, %t", v, ok)
+	}
+}
+
+func TestShmQueueOpenShouldRejectInvalidFiles(t *testing.T) {
+	dir := tempDir(t)
+	path := filepath.Join(dir, "q")
+	q, err := Create(path, Options{Capacity: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	q.Close()
+
+	valid, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, b := range map[string][]byte{
+		"empty":     nil,
+		"truncated": valid[:len(valid)-1],
+		"magic":     append([]byte{0}, valid[1:]...),
+		"capacity":  append(append(append([]byte{}, valid[:8]...), 3), valid[9:]...),
+	} {
+		p := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(p, b, 0600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Open(p, Options{}); err != ErrInvalid {
+			t.Errorf("%s: Expected: %v; Got: %v", name, ErrInvalid, err)
+		}
+	}
+}
+
+func TestShmQueueShouldPassValuesAcrossProcesses(t *testing.T) {
+	in, out := createPair(t, Options{Capacity: 16})
+	stop := startEcho(t, in, out)
+	defer stop()
+
+	// Keep up to the queue capacity in flight, so the values wrap around in both queues.
+	const count = 1000
+	sent, received := 0, 0
+	for tries := 0; received < count; tries++ {
+		progress := false
+		if sent < count && in.Push([]byte(strconv.Itoa(sent))) == nil {
+			sent++
+			progress = true
+		}
+		if v, ok := out.Pop(); ok {
+			if string(v.([]byte)) != strconv.Itoa(received) {
+				t.Fatalf("Expected: %d; Got: %s", received, v)
+			}
+			received++
+			progress = true
+		}
+		if progress {
+			tries = 0
+		}
+		wait(tries)
+	}
+}
@@ -0,0 +1,304 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package spillqueue implements an unbounded, dynamically growing FIFO queue that
+// spills values to memory-mapped temporary files when it grows too long.
+// Internally, queue keeps the values near the head and tail in memory, while, once the
+// queue length exceeds a configurable threshold, the values in the middle are stored in
+// fixed sized segments backed by memory-mapped files. The kernel is free to write the
+// segment pages back to disk and evict them, so a very long queue doesn't require its
+// values to be kept in memory. Segments are loaded back in memory, and their files
+// discarded, as the values before them are popped.
+// On platforms without mmap support, segments are kept in memory.
+package spillqueue
+
+import (
+	"encoding/binary"
+
+	"github.com/christianrpetrin/queue-tests/codec"
+	"github.com/christianrpetrin/queue-tests/queueimpl3"
+)
+
+const (
+	// DefaultThreshold holds the default queue length above which values are spilled.
+	DefaultThreshold = 1 << 20
+
+	// DefaultSegmentLen holds the default number of values stored in each segment.
+	DefaultSegmentLen = 4096
+
+	// lenSize holds the size of the length prefix of each value stored in a segment.
+	lenSize = 4
+)
+
+// Options configures a queue.
+// The zero value for Options holds the default configuration.
+type Options struct {
+	// Threshold is the queue length above which values are spilled.
+	// A Threshold of 0 or less uses DefaultThreshold.
+	Threshold int
+
+	// SegmentLen is the number of values stored in each segment.
+	// A SegmentLen of 0 or less uses DefaultSegmentLen.
+	SegmentLen int
+
+	// Dir is the directory where the segment files are created.
+	// An empty Dir uses the default directory for temporary files.
+	// Segment files are removed right after being mapped, so they never
+	// show up in Dir for long.
+	Dir string
+
+	// Codec encodes and decodes the spilled values.
+	// A nil Codec uses codec.Bytes, so the values must be of type []byte to be spilled.
+	Codec codec.ElementCodec
+}
+
+// SpillQueue represents an unbounded, dynamically growing FIFO queue
+// that spills values to memory-mapped files.
+// Spilled values are stored encoded by the configured codec, so popped values
+// are the decoded copies of the pushed ones.
+type SpillQueue struct {
+	// opts holds the queue configuration.
+	opts Options
+
+	// front holds the in-memory values before the spilled segments.
+	front queueimpl3.Queueimpl3
+
+	// segs holds the spilled segments, in queue order.
+	segs []*segment
+
+	// spilled holds the number of values stored in segs.
+	spilled int
+
+	// back holds the in-memory values after the spilled segments.
+	back []interface{}
+
+	// err holds the first error that occurred while spilling or loading values, if any.
+	err error
+}
+
+// segment represents a block of spilled values.
+type segment struct {
+	// b holds the memory-mapped encoded values.
+	b []byte
+
+	// n holds the number of values in the segment.
+	n int
+
+	// mapped holds whether b is memory-mapped, or was allocated in memory
+	// because mapping it failed.
+	mapped bool
+
+	// vs holds the segment values if they could not be encoded, in which
+	// case they are kept in memory as is.
+	vs []interface{}
+}
+
+// New returns an initialized queue configured by opts.
+func New(opts Options) *SpillQueue {
+	if opts.Threshold <= 0 {
+		opts.Threshold = DefaultThreshold
+	}
+	if opts.SegmentLen <= 0 {
+		opts.SegmentLen = DefaultSegmentLen
+	}
+	if opts.Codec == nil {
+		opts.Codec = codec.Bytes
+	}
+	q := &SpillQueue{opts: opts}
+	q.front.Init()
+	return q
+}
+
+// Close clears queue q, unmapping all its segments.
+// Segments are not unmapped by the garbage collector, so Close must be called
+// once a queue holding spilled values is no longer needed.
+// Close returns the first error that occurred while spilling values, if any.
+func (q *SpillQueue) Close() error {
+	for _, s := range q.segs {
+		q.unmap(s)
+	}
+	q.segs = nil
+	q.spilled = 0
+	q.back = nil
+	q.front.Init()
+	return q.err
+}
+
+// Err returns the first error that occurred while spilling or loading values, if any.
+// Values that could not be spilled are kept in memory, so no value is lost;
+// values that could not be loaded back (i.e. decoded) are discarded.
+func (q *SpillQueue) Err() error { return q.err }
+
+// Len returns the number of elements of queue q.
+// The complexity is O(1).
+func (q *SpillQueue) Len() int { return q.front.Len() + q.spilled + len(q.back) }
+
+// Spilled returns the number of elements of queue q that are stored in memory-mapped segments.
+// The complexity is O(1).
+func (q *SpillQueue) Spilled() int { return q.spilled }
+
+// Front returns the first element of queue q or nil if the queue is empty.
+// The second, bool result indicates whether a valid value was returned;
+//   if the queue is empty, false will be returned.
+// The complexity is O(1), not counting the cost of loading a spilled segment.
+func (q *SpillQueue) Front() (interface{}, bool) {
+	q.fill()
+	return q.front.Front()
+}
+
+// Push adds a value to the queue.
+// The complexity is O(1), not counting the cost of spilling a segment.
+func (q *SpillQueue) Push(v interface{}) {
+	if len(q.segs) == 0 && q.Len() < q.opts.Threshold {
+		q.moveBack()
+		q.front.Push(v)
+		return
+	}
+
+	q.back = append(q.back, v)
+	if len(q.back) >= q.opts.SegmentLen {
+		q.spill()
+	}
+}
+
+// Pop retrieves and removes the next element from the queue.
+// The second, bool result indicates whether a valid value was returned;
+//   if the queue is empty, false will be returned.
+// The complexity is O(1), not counting the cost of loading a spilled segment.
+func (q *SpillQueue) Pop() (interface{}, bool) {
+	q.fill()
+	return q.front.Pop()
+}
+
+// fill moves the next values to the front if the front is empty.
+func (q *SpillQueue) fill() {
+	if q.front.Len() > 0 {
+		return
+	}
+	if len(q.segs) > 0 {
+		q.load()
+		return
+	}
+	q.moveBack()
+}
+
+// moveBack moves all back values to the front.
+// There must be no spilled segments.
+func (q *SpillQueue) moveBack() {
+	for i, v := range q.back {
+		q.front.Push(v)
+		q.back[i] = nil // Avoid memory leaks
+	}
+	q.back = q.back[:0]
+}
+
+// spill moves all back values to a new segment.
+// If the values cannot be encoded, they are kept in memory as is; if the
+// segment cannot be mapped, it is allocated in memory instead.
+func (q *SpillQueue) spill() {
+	s := &segment{n: len(q.back)}
+	if bs, size, err := q.encode(); err != nil {
+		q.fail(err)
+		s.vs = append([]interface{}(nil), q.back...)
+	} else {
+		m, err := mapSegment(q.opts.Dir, size)
+		s.mapped = err == nil
+		if !s.mapped {
+			q.fail(err)
+			m = make([]byte, size)
+		}
+		off := 0
+		for _, b := range bs {
+			binary.LittleEndian.PutUint32(m[off:], uint32(len(b)))
+			off += lenSize
+			off += copy(m[off:], b)
+		}
+		s.b = m
+	}
+
+	for i := range q.back {
+		q.back[i] = nil // Avoid memory leaks
+	}
+	q.back = q.back[:0]
+	q.segs = append(q.segs, s)
+	q.spilled += s.n
+}
+
+// encode returns the encoding of all back values, along with the size of the segment storing them.
+func (q *SpillQueue) encode() ([][]byte, int, error) {
+	bs := make([][]byte, len(q.back))
+	size := 0
+	for i, v := range q.back {
+		b, err := q.opts.Codec.Encode(v)
+		if err != nil {
+			return nil, 0, err
+		}
+		bs[i] = b
+		size += lenSize + len(b)
+	}
+	return bs, size, nil
+}
+
+// load moves the values of the first segment to the front and unmaps the segment.
+func (q *SpillQueue) load() {
+	s := q.segs[0]
+	q.segs[0] = nil // Avoid memory leaks
+	q.segs = q.segs[1:]
+	q.spilled -= s.n
+
+	if s.vs != nil {
+		for _, v := range s.vs {
+			q.front.Push(v)
+		}
+		return
+	}
+
+	off := 0
+	for i := 0; i < s.n; i++ {
+		n := int(binary.LittleEndian.Uint32(s.b[off:]))
+		off += lenSize
+		v, err := q.opts.Codec.Decode(s.b[off : off+n])
+		off += n
+		if err != nil {
+			q.fail(err)
+			continue
+		}
+		q.front.Push(v)
+	}
+	q.unmap(s)
+}
+
+// unmap unmaps segment s, if it is memory-mapped.
+func (q *SpillQueue) unmap(s *segment) {
+	if !s.mapped {
+		return
+	}
+	if err := unmapSegment(s.b); err != nil {
+		q.fail(err)
+	}
+	s.b = nil
+}
+
+// fail records err as the queue error, unless an error was recorded already.
+func (q *SpillQueue) fail(err error) {
+	if q.err == nil {
+		q.err = err
+	}
+}
@@ -0,0 +1,169 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package spillqueue
+
+import (
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/christianrpetrin/queue-tests/codec"
+)
+
+func TestSpillQueueNewQueueShouldReturnInitiazedInstanceOfQueue(t *testing.T) {
+	q := New(Options{})
+
+	if q == nil {
+		t.Error("Expected: new instance of queue; Got: nil")
+	}
+	if q.opts.Threshold != DefaultThreshold || q.opts.SegmentLen != DefaultSegmentLen {
+		t.Errorf("Expected: default options; Got: %+v", q.opts)
+	}
+}
+
+func TestSpillQueuePushPopFrontShouldRetrieveAllElementsInOrder(t *testing.T) {
+	q := New(Options{Threshold: 100, SegmentLen: 10})
+	defer q.Close()
+
+	for i := 0; i < 1000; i++ {
+		q.Push([]byte(strconv.Itoa(i)))
+	}
+	if q.Len() != 1000 {
+		t.Errorf("Expected: %d; Got: %d", 1000, q.Len())
+	}
+	if q.Spilled() != 900 {
+		t.Errorf("Expected: %d spilled values; Got: %d", 900, q.Spilled())
+	}
+
+	for i := 0; i < 1000; i++ {
+		if v, ok := q.Front(); !ok || string(v.([]byte)) != strconv.Itoa(i) {
+			t.Errorf("Expected: %d; Got: %s", i, v)
+		}
+		if v, ok := q.Pop(); !ok || string(v.([]byte)) != strconv.Itoa(i) {
+			t.Errorf("Expected: %d; Got: %s", i, v)
+		}
+	}
+	if v, ok := q.Pop(); ok || v != nil {
+		t.Errorf("Expected: nil as the queue should be empty; Got: %v", v)
+	}
+	if q.Len() != 0 || q.Spilled() != 0 {
+		t.Errorf("Expected: %d; Got: %d", 0, q.Len())
+	}
+	if err := q.Close(); err != nil {
+		t.Errorf("Expected: no error; Got: %v", err)
+	}
+}
+
+func TestSpillQueueInterleavedPushPopShouldRetrieveAllElementsInOrder(t *testing.T) {
+	q := New(Options{Threshold: 20, SegmentLen: 7})
+	defer q.Close()
+
+	next, expected := 0, 0
+	for r := 0; r < 100; r++ {
+		for i := 0; i < 30; i++ {
+			q.Push([]byte(strconv.Itoa(next)))
+			next++
+		}
+		for i := 0; i < 25; i++ {
+			if v, ok := q.Pop(); !ok || string(v.([]byte)) != strconv.Itoa(expected) {
+				t.Fatalf("Expected: %d; Got: %s", expected, v)
+			}
+			expected++
+		}
+	}
+	for q.Len() > 0 {
+		if v, ok := q.Pop(); !ok || string(v.([]byte)) != strconv.Itoa(expected) {
+			t.Fatalf("Expected: %d; Got: %s", expected, v)
+		}
+		expected++
+	}
+	if expected != next {
+		t.Errorf("Expected: %d; Got: %d", next, expected)
+	}
+}
+
+func TestSpillQueueWithEmptyValuesShouldRetrieveAllElements(t *testing.T) {
+	q := New(Options{Threshold: 1, SegmentLen: 2})
+	defer q.Close()
+
+	for i := 0; i < 10; i++ {
+		q.Push([]byte{})
+	}
+	for i := 0; i < 10; i++ {
+		if v, ok := q.Pop(); !ok || len(v.([]byte)) != 0 {
+			t.Errorf("Expected: empty value; Got: %v", v)
+		}
+	}
+}
+
+func TestSpillQueueWithInvalidDirShouldKeepValuesInMemory(t *testing.T) {
+	q := New(Options{Threshold: 1, SegmentLen: 2, Dir: string(os.PathSeparator) + "nonexistent-spillqueue-dir"})
+	defer q.Close()
+
+	for i := 0; i < 10; i++ {
+		q.Push([]byte(strconv.Itoa(i)))
+	}
+	for i := 0; i < 10; i++ {
+		if v, ok := q.Pop(); !ok || string(v.([]byte)) != strconv.Itoa(i) {
+			t.Errorf("Expected: %d; Got: %s", i, v)
+		}
+	}
+	if q.Err() == nil && mapSupported {
+		t.Error("Expected: error; Got: nil")
+	}
+}
+
+func TestSpillQueueWithUnencodableValuesShouldKeepThemInMemory(t *testing.T) {
+	q := New(Options{Threshold: 1, SegmentLen: 2})
+	defer q.Close()
+
+	for i := 0; i < 10; i++ {
+		q.Push(i)
+	}
+	if q.Spilled() != 8 {
+		t.Errorf("Expected: %d spilled values; Got: %d", 8, q.Spilled())
+	}
+	for i := 0; i < 10; i++ {
+		if v, ok := q.Pop(); !ok || v.(int) != i {
+			t.Errorf("Expected: %d; Got: %v", i, v)
+		}
+	}
+	if q.Err() == nil {
+		t.Error("Expected: error; Got: nil")
+	}
+}
+
+func TestSpillQueueWithGobCodecShouldRetrieveAllElementsInOrder(t *testing.T) {
+	q := New(Options{Threshold: 10, SegmentLen: 10, Codec: codec.Gob})
+	defer q.Close()
+
+	for i := 0; i < 100; i++ {
+		q.Push(i)
+	}
+	for i := 0; i < 100; i++ {
+		if v, ok := q.Pop(); !ok || v.(int) != i {
+			t.Errorf("Expected: %d; Got: %v", i, v)
+		}
+	}
+	if q.Err() != nil {
+		t.Errorf("Expected: no error; Got: %v", q.Err())
+	}
+}
@@ -0,0 +1,106 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+//go:build go1.13
+// +build go1.13
+
+package stagesim
+
+import (
+	"testing"
+	"time"
+
+	"github.com/christianrpetrin/queue-tests/faaqueue"
+	"github.com/christianrpetrin/queue-tests/fcqueue"
+	"github.com/christianrpetrin/queue-tests/lockfreequeue"
+	"github.com/christianrpetrin/queue-tests/safequeue"
+)
+
+var (
+	// benchQueues holds the concurrent queues probed by the benchmark tests.
+	benchQueues = []struct {
+		name string
+		new  func() Queue
+	}{
+		{name: "SafeQueue", new: func() Queue { return safequeue.New() }},
+		{name: "LockFree", new: func() Queue { return lockfreequeue.New() }},
+		{name: "FetchAndAdd", new: func() Queue { return faaqueue.New() }},
+		{name: "FlatCombining", new: func() Queue { return fcqueue.New() }},
+	}
+
+	// benchSystems holds the simulated systems probed by the benchmark tests.
+	benchSystems = []struct {
+		name   string
+		config Config
+	}{
+		{
+			// A single stage fed by many producers, with negligible service times, which
+			// is dominated by the queue operations.
+			name: "FanIn",
+			config: Config{
+				Producers: 8,
+				Items:     2000,
+				Stages:    []Stage{{Consumers: 2}},
+			},
+		},
+		{
+			// A three stages pipeline, with a slower middle stage served by a larger pool.
+			name: "Pipeline",
+			config: Config{
+				Producers:    4,
+				Items:        500,
+				Interarrival: Exponential(20 * time.Microsecond),
+				Stages: []Stage{
+					{Consumers: 2, Service: Constant(2 * time.Microsecond)},
+					{Consumers: 4, Service: Exponential(5 * time.Microsecond)},
+					{Consumers: 1, Service: Uniform(time.Microsecond, 3*time.Microsecond)},
+				},
+			},
+		},
+	}
+)
+
+// BenchmarkSystem probes each queue in each simulated system, reporting the mean, median,
+// 99th percentile and largest end-to-end latencies, averaged over all runs, in the
+// mean-ns, p50-ns, p99-ns and max-ns metrics.
+func BenchmarkSystem(b *testing.B) {
+	for _, s := range benchSystems {
+		for _, q := range benchQueues {
+			s, q := s, q
+			b.Run(s.name+"/"+q.name, func(b *testing.B) {
+				b.ReportAllocs()
+				var mean, p50, p99, max time.Duration
+				for n := 0; n < b.N; n++ {
+					c := s.config
+					c.Seed = int64(n)
+					r := Run(q.new, c)
+					mean += r.Mean
+					p50 += r.P50
+					p99 += r.P99
+					max += r.Max
+				}
+				b.ReportMetric(float64(mean.Nanoseconds())/float64(b.N), "mean-ns")
+				b.ReportMetric(float64(p50.Nanoseconds())/float64(b.N), "p50-ns")
+				b.ReportMetric(float64(p99.Nanoseconds())/float64(b.N), "p99-ns")
+				b.ReportMetric(float64(max.Nanoseconds())/float64(b.N), "max-ns")
+			})
+		}
+	}
+}
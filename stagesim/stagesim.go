@@ -0,0 +1,247 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package stagesim implements a simulation of a staged system, used to measure whether the
+// differences between the queue implementations matter at system level.
+// Internally, producer goroutines create items at random intervals and push them to the queue
+// of the first stage. Each stage has its own queue and a pool of consumer goroutines, which pop
+// items from the stage queue, serve them for a random service time, and push them to the queue
+// of the next stage. Once an item is served by the last stage, its end-to-end latency, i.e. the
+// time elapsed since it was created, is recorded.
+// Service times are spent spinning, modeling CPU bound work, so the consumers of all stages
+// compete for the CPUs with each other and with the queue operations.
+package stagesim
+
+import (
+	"math/rand"
+	"runtime"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Queue is the set of operations the simulation needs from a queue.
+// The queue must be safe for concurrent use by multiple goroutines.
+type Queue interface {
+	// Push adds a value to the queue.
+	Push(v interface{})
+
+	// Pop retrieves and removes the next element from the queue.
+	Pop() (interface{}, bool)
+}
+
+// Dist returns random durations following a distribution, using r.
+type Dist func(r *rand.Rand) time.Duration
+
+// Constant returns a distribution always returning d.
+func Constant(d time.Duration) Dist {
+	return func(r *rand.Rand) time.Duration { return d }
+}
+
+// Exponential returns an exponential distribution with mean mean.
+func Exponential(mean time.Duration) Dist {
+	return func(r *rand.Rand) time.Duration { return time.Duration(r.ExpFloat64() * float64(mean)) }
+}
+
+// Uniform returns a distribution returning durations uniformly distributed in [min, max),
+// or always returning min if max is not larger than min.
+func Uniform(min, max time.Duration) Dist {
+	if max <= min {
+		return Constant(min)
+	}
+	return func(r *rand.Rand) time.Duration { return min + time.Duration(r.Int63n(int64(max-min))) }
+}
+
+// Stage holds the configuration of a stage.
+type Stage struct {
+	// Consumers holds the number of consumer goroutines of the stage. 0 means 1 consumer.
+	Consumers int
+
+	// Service holds the distribution of the time taken to serve each item.
+	// If nil, items are passed on to the next stage right away.
+	Service Dist
+}
+
+// Config holds the configuration of a simulation.
+type Config struct {
+	// Producers holds the number of producer goroutines. 0 means 1 producer.
+	Producers int
+
+	// Items holds the number of items created by each producer. 0 means 1000 items.
+	Items int
+
+	// Interarrival holds the distribution of the time each producer waits between items.
+	// If nil, each producer creates its items back to back.
+	Interarrival Dist
+
+	// Stages holds the stages, in the order items go through them. Empty means a single stage.
+	Stages []Stage
+
+	// Seed holds the seed of the random durations.
+	Seed int64
+}
+
+// Result holds the measurements of a simulation.
+type Result struct {
+	// Items holds the number of items that went through all stages.
+	Items int
+
+	// Mean holds the mean end-to-end latency.
+	Mean time.Duration
+
+	// P50 holds the median end-to-end latency.
+	P50 time.Duration
+
+	// P99 holds the 99th percentile of the end-to-end latency.
+	P99 time.Duration
+
+	// Max holds the largest end-to-end latency.
+	Max time.Duration
+
+	// Elapsed holds the time taken by the whole simulation.
+	Elapsed time.Duration
+}
+
+// item represents an item going through the stages.
+type item struct {
+	// created holds when the item was created.
+	created time.Time
+}
+
+// stage represents a running stage.
+type stage struct {
+	// served holds the number of items served by the stage.
+	// Kept as the first field to guarantee its 64-bit alignment.
+	served int64
+
+	// q holds the items waiting to be served by the stage.
+	q Queue
+
+	// service holds the distribution of the service time.
+	service Dist
+}
+
+// Run runs a simulation using a new queue returned by newQueue for each stage, and returns
+// the measurements once all items went through all stages.
+func Run(newQueue func() Queue, c Config) Result {
+	if c.Producers <= 0 {
+		c.Producers = 1
+	}
+	if c.Items <= 0 {
+		c.Items = 1000
+	}
+	if len(c.Stages) == 0 {
+		c.Stages = []Stage{{}}
+	}
+	total := int64(c.Producers * c.Items)
+
+	stages := make([]*stage, len(c.Stages))
+	for i, s := range c.Stages {
+		stages[i] = &stage{q: newQueue(), service: s.Service}
+	}
+
+	latencies := make([]time.Duration, total)
+	var wg sync.WaitGroup
+	seed := c.Seed
+	start := time.Now()
+	for i, s := range stages {
+		var next Queue
+		if i < len(stages)-1 {
+			next = stages[i+1].q
+		}
+		consumers := c.Stages[i].Consumers
+		if consumers <= 0 {
+			consumers = 1
+		}
+		for j := 0; j < consumers; j++ {
+			seed++
+			wg.Add(1)
+			go func(s *stage, next Queue, r *rand.Rand) {
+				defer wg.Done()
+				s.consume(next, total, latencies, r)
+			}(s, next, rand.New(rand.NewSource(seed)))
+		}
+	}
+	for i := 0; i < c.Producers; i++ {
+		seed++
+		wg.Add(1)
+		go func(r *rand.Rand) {
+			defer wg.Done()
+			for n := 0; n < c.Items; n++ {
+				if c.Interarrival != nil {
+					if d := c.Interarrival(r); d > 0 {
+						time.Sleep(d)
+					}
+				}
+				stages[0].q.Push(&item{created: time.Now()})
+			}
+		}(rand.New(rand.NewSource(seed)))
+	}
+	wg.Wait()
+
+	r := Result{Items: int(total), Elapsed: time.Since(start)}
+	sort.Sort(durations(latencies))
+	var sum time.Duration
+	for _, l := range latencies {
+		sum += l
+	}
+	r.Mean = sum / time.Duration(total)
+	r.P50 = latencies[(total-1)*50/100]
+	r.P99 = latencies[(total-1)*99/100]
+	r.Max = latencies[total-1]
+	return r
+}
+
+// consume serves the items of stage s until all total items were served, pushing them to the
+// next queue, or recording their latency in latencies if next is nil.
+func (s *stage) consume(next Queue, total int64, latencies []time.Duration, r *rand.Rand) {
+	for atomic.LoadInt64(&s.served) < total {
+		v, ok := s.q.Pop()
+		if !ok {
+			runtime.Gosched()
+			continue
+		}
+
+		it := v.(*item)
+		if s.service != nil {
+			spin(s.service(r))
+		}
+		n := atomic.AddInt64(&s.served, 1)
+		if next != nil {
+			next.Push(it)
+		} else {
+			latencies[n-1] = time.Since(it.created)
+		}
+	}
+}
+
+// spin keeps the calling goroutine busy for d.
+func spin(d time.Duration) {
+	for start := time.Now(); time.Since(start) < d; {
+	}
+}
+
+// durations implements sort.Interface, sorting durations in ascending order.
+type durations []time.Duration
+
+func (d durations) Len() int           { return len(d) }
+func (d durations) Less(i, j int) bool { return d[i] < d[j] }
+func (d durations) Swap(i, j int)      { d[i], d[j] = d[j], d[i] }
@@ -0,0 +1,110 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package stagesim
+
+import (
+	"math/rand"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/christianrpetrin/queue-tests/safequeue"
+)
+
+// countingQueue is a SafeQueue counting the pushed values.
+type countingQueue struct {
+	*safequeue.SafeQueue
+
+	// pushes holds the number of pushed values.
+	pushes *int64
+}
+
+// Push counts and adds a value to the queue.
+func (q countingQueue) Push(v interface{}) {
+	atomic.AddInt64(q.pushes, 1)
+	q.SafeQueue.Push(v)
+}
+
+func TestDistsShouldReturnDurationsWithinRange(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	c := Constant(time.Millisecond)
+	u := Uniform(time.Millisecond, 2*time.Millisecond)
+	e := Exponential(time.Millisecond)
+	var sum time.Duration
+	for i := 0; i < 10000; i++ {
+		if d := c(r); d != time.Millisecond {
+			t.Fatalf("Expected: 1ms; Got: %v", d)
+		}
+		if d := u(r); d < time.Millisecond || d >= 2*time.Millisecond {
+			t.Fatalf("Expected: duration in [1ms, 2ms); Got: %v", d)
+		}
+		sum += e(r)
+	}
+	if mean := sum / 10000; mean < 900*time.Microsecond || mean > 1100*time.Microsecond {
+		t.Errorf("Expected: mean about 1ms; Got: %v", mean)
+	}
+	if d := Uniform(time.Millisecond, time.Millisecond)(r); d != time.Millisecond {
+		t.Errorf("Expected: 1ms; Got: %v", d)
+	}
+}
+
+func TestRunShouldPassAllItemsThroughAllStages(t *testing.T) {
+	var pushes int64
+	newQueue := func() Queue { return countingQueue{SafeQueue: safequeue.New(), pushes: &pushes} }
+	r := Run(newQueue, Config{
+		Producers:    3,
+		Items:        200,
+		Interarrival: Uniform(0, 10*time.Microsecond),
+		Stages: []Stage{
+			{Consumers: 2, Service: Constant(time.Microsecond)},
+			{Consumers: 1},
+			{Consumers: 4, Service: Exponential(time.Microsecond)},
+		},
+	})
+
+	if r.Items != 600 {
+		t.Errorf("Expected: 600; Got: %d", r.Items)
+	}
+	if pushes != 3*600 {
+		t.Errorf("Expected: %d pushes as each item is pushed once per stage; Got: %d", 3*600, pushes)
+	}
+	if r.P50 <= 0 || r.P50 > r.P99 || r.P99 > r.Max || r.Mean > r.Max || r.Max > r.Elapsed {
+		t.Errorf("Expected: 0 < p50 <= p99 <= max <= elapsed and mean <= max; Got: %+v", r)
+	}
+}
+
+func TestRunWithServiceTimeShouldIncludeItInLatency(t *testing.T) {
+	r := Run(func() Queue { return safequeue.New() }, Config{
+		Items:  10,
+		Stages: []Stage{{Service: Constant(time.Millisecond)}, {Service: Constant(time.Millisecond)}},
+	})
+
+	if r.P50 < 2*time.Millisecond {
+		t.Errorf("Expected: latency at least 2ms; Got: %v", r.P50)
+	}
+}
+
+func TestRunWithZeroConfigShouldUseDefaults(t *testing.T) {
+	r := Run(func() Queue { return safequeue.New() }, Config{})
+	if r.Items != 1000 {
+		t.Errorf("Expected: 1000; Got: %d", r.Items)
+	}
+}
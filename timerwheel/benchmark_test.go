@@ -0,0 +1,163 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package timerwheel
+
+import (
+	"container/heap"
+	"math/rand"
+	"strconv"
+	"testing"
+	"time"
+)
+
+const (
+	// benchSpan holds the span of the due times of the timers pushed by the tests.
+	benchSpan = 10 * time.Second
+)
+
+var (
+	// benchCounts holds the number of timers pending in each test.
+	benchCounts = []int{1000, 100000, 1000000}
+
+	// value holds the value pushed by the tests, boxed only once.
+	value interface{} = 1
+
+	// Used to store temp values, avoiding any compiler optimizations.
+	tmp  interface{}
+	tmp2 bool
+)
+
+// delayQueue is a min-heap delay queue, as the one used by retryqueue, used as the baseline.
+type delayQueue struct {
+	// h holds the pending timers.
+	h timerHeap
+
+	// now returns the current time.
+	now func() time.Time
+}
+
+// timerHeap is a min-heap of timers ordered by due time.
+type timerHeap []timerValue
+
+// timerValue represents a value waiting for its due time.
+type timerValue struct {
+	// v holds the value.
+	v interface{}
+
+	// due holds the time v is due.
+	due time.Time
+}
+
+func (h timerHeap) Len() int            { return len(h) }
+func (h timerHeap) Less(i, j int) bool  { return h[i].due.Before(h[j].due) }
+func (h timerHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *timerHeap) Push(x interface{}) { *h = append(*h, x.(timerValue)) }
+func (h *timerHeap) Pop() interface{} {
+	old := *h
+	n := len(old) - 1
+	v := old[n]
+	old[n] = timerValue{}
+	*h = old[:n]
+	return v
+}
+
+func (q *delayQueue) Push(v interface{}, due time.Time) { heap.Push(&q.h, timerValue{v: v, due: due}) }
+
+func (q *delayQueue) Pop() (interface{}, bool) {
+	if len(q.h) == 0 || q.h[0].due.After(q.now()) {
+		return nil, false
+	}
+	return heap.Pop(&q.h).(timerValue).v, true
+}
+
+// scheduler is the set of operations the tests need from a timer queue.
+type scheduler interface {
+	Push(v interface{}, due time.Time)
+	Pop() (interface{}, bool)
+}
+
+// benchImpls holds the timer queues probed by the tests, by name.
+var benchImpls = []struct {
+	name string
+	new  func(now func() time.Time) scheduler
+}{
+	{"TimerWheel", func(now func() time.Time) scheduler { return New(Options{Now: now}) }},
+	{"Heap", func(now func() time.Time) scheduler { return &delayQueue{now: now} }},
+}
+
+// BenchmarkSchedule probes pushing count timers due at random times within benchSpan,
+// and then popping all of them once due.
+func BenchmarkSchedule(b *testing.B) {
+	for _, impl := range benchImpls {
+		for _, count := range benchCounts {
+			impl, count := impl, count
+			b.Run(impl.name+"/"+strconv.Itoa(count), func(b *testing.B) {
+				r := rand.New(rand.NewSource(1))
+				dues := make([]time.Duration, count)
+				for i := range dues {
+					dues[i] = time.Duration(r.Int63n(int64(benchSpan)))
+				}
+				c := &fakeClock{t: time.Unix(1000, 0)}
+				q := impl.new(c.now)
+				b.ResetTimer()
+				for n := 0; n < b.N; n++ {
+					for _, d := range dues {
+						q.Push(value, c.t.Add(d))
+					}
+					c.advance(benchSpan)
+					for i := 0; i < count; i++ {
+						tmp, tmp2 = q.Pop()
+					}
+				}
+			})
+		}
+	}
+}
+
+// BenchmarkChurn probes the steady state of a queue holding about count pending timers,
+// where each iteration pushes a timer due at a random time within benchSpan, advances the
+// clock so one timer is due on average, and pops the due timers.
+func BenchmarkChurn(b *testing.B) {
+	for _, impl := range benchImpls {
+		for _, count := range benchCounts {
+			impl, count := impl, count
+			b.Run(impl.name+"/"+strconv.Itoa(count), func(b *testing.B) {
+				r := rand.New(rand.NewSource(1))
+				c := &fakeClock{t: time.Unix(1000, 0)}
+				q := impl.new(c.now)
+				for i := 0; i < count; i++ {
+					q.Push(value, c.t.Add(time.Duration(r.Int63n(int64(benchSpan)))))
+				}
+				step := benchSpan / time.Duration(count)
+				b.ResetTimer()
+				for n := 0; n < b.N; n++ {
+					q.Push(value, c.t.Add(time.Duration(r.Int63n(int64(benchSpan)))))
+					c.advance(step)
+					for {
+						if tmp, tmp2 = q.Pop(); !tmp2 {
+							break
+						}
+					}
+				}
+			})
+		}
+	}
+}
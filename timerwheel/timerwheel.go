@@ -0,0 +1,258 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package timerwheel implements an unbounded queue of scheduled values, pushed along with
+// a due time, whose Pop only retrieves the values that are due, designed to hold millions
+// of timers.
+// Internally, queue store the values in a hierarchical timing wheel, as described by Varghese
+// and Lauck in "Hashed and Hierarchical Timing Wheels": time is divided in ticks, and each
+// level of the wheel has 64 slots, each of them holding the values due in a range of ticks
+// 64 times larger than the slots of the level below. A value is stored in the lowest level
+// whose slots cover its due tick, and is moved down a level (i.e. cascaded) each time the
+// wheel reaches the range of its slot, until it reaches the lowest level and becomes due.
+// Each value is cascaded at most once per level, so pushing and popping values is O(1)
+// amortized, unlike heap based delay queues (e.g. retryqueue), which are O(log n).
+// Due values are moved to a queueimpl3 queue, from which Pop retrieves them. Empty slots
+// are skipped using a bitmap per level, so idle wheels are advanced cheaply.
+package timerwheel
+
+import (
+	"time"
+
+	"github.com/christianrpetrin/queue-tests/queueimpl3"
+)
+
+const (
+	// DefaultTick holds the default duration of a tick.
+	DefaultTick = time.Millisecond
+
+	// slotBits holds the number of bits of the tick indexing the slots of each level.
+	slotBits = 6
+
+	// slotCount holds the number of slots of each level.
+	slotCount = 1 << slotBits
+
+	// slotMask masks the bits of the tick indexing the slots of a level.
+	slotMask = slotCount - 1
+
+	// levelCount holds the number of levels, enough to cover all 64-bit ticks.
+	levelCount = 11
+)
+
+// Options configures a queue.
+// The zero value for Options holds the default configuration.
+type Options struct {
+	// Tick is the resolution of the due times: values become due up to a tick after their
+	// due time, and values due within the same tick are retrieved in no particular order.
+	// A Tick of 0 or less uses DefaultTick.
+	Tick time.Duration
+
+	// Now returns the current time.
+	// A nil Now uses time.Now.
+	Now func() time.Time
+}
+
+// TimerWheel represents an unbounded queue of scheduled values.
+// TimerWheel is not safe for concurrent use; guard it with a mutex when shared.
+// The zero value for queue is not ready to use; use New to create a queue.
+type TimerWheel struct {
+	// opts holds the queue configuration.
+	opts Options
+
+	// start holds the time of tick 0.
+	start time.Time
+
+	// cur holds the current tick: the values due before it were moved to ready already.
+	cur uint64
+
+	// slots holds the values waiting for their due tick, by level and slot.
+	slots [levelCount][slotCount][]entry
+
+	// occupied holds a bitmap of the non-empty slots of each level.
+	occupied [levelCount]uint64
+
+	// waiting holds the number of values in slots.
+	waiting int
+
+	// ready holds the due values.
+	ready queueimpl3.Queueimpl3
+}
+
+// entry represents a value waiting for its due tick.
+type entry struct {
+	// v holds the user added value.
+	v interface{}
+
+	// t holds the tick v is due at.
+	t uint64
+}
+
+// New returns an initialized queue configured by opts.
+func New(opts Options) *TimerWheel {
+	if opts.Tick <= 0 {
+		opts.Tick = DefaultTick
+	}
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+	q := &TimerWheel{opts: opts, start: opts.Now()}
+	q.ready.Init()
+	return q
+}
+
+// Len returns the number of elements of queue q, both due and not.
+// The complexity is O(1).
+func (q *TimerWheel) Len() int { return q.waiting + q.ready.Len() }
+
+// Push adds value v to the queue, to be retrieved once time due is reached.
+// Values whose due time is already reached are ready to be retrieved right away.
+// The complexity is O(1).
+func (q *TimerWheel) Push(v interface{}, due time.Time) {
+	d := due.Sub(q.start)
+	if d <= 0 {
+		q.ready.Push(v)
+		return
+	}
+
+	// Round the due tick up, so values never become due early.
+	t := uint64((d + q.opts.Tick - 1) / q.opts.Tick)
+	if t < q.cur {
+		q.ready.Push(v)
+		return
+	}
+	q.place(entry{v: v, t: t})
+	q.waiting++
+}
+
+// Pop retrieves and removes the next due element from the queue, if any.
+// The second, bool result indicates whether a valid value was returned;
+//   if no value is due, false will be returned.
+// The complexity is O(1) amortized, as the values becoming due are moved to the ready ones.
+func (q *TimerWheel) Pop() (interface{}, bool) {
+	if q.waiting > 0 {
+		q.advance(uint64(q.opts.Now().Sub(q.start) / q.opts.Tick))
+	}
+	return q.ready.Pop()
+}
+
+// place stores entry e in the lowest level whose slots cover its due tick, which must not
+// be smaller than the current tick.
+func (q *TimerWheel) place(e entry) {
+	l := 0
+	for l < levelCount-1 && e.t>>(slotBits*(l+1)) != q.cur>>(slotBits*(l+1)) {
+		l++
+	}
+	s := (e.t >> (slotBits * l)) & slotMask
+	q.slots[l][s] = append(q.slots[l][s], e)
+	q.occupied[l] |= 1 << s
+}
+
+// advance moves the values due up to tick now to the ready ones.
+func (q *TimerWheel) advance(now uint64) {
+	for q.cur <= now {
+		if q.waiting == 0 {
+			q.cur = now + 1
+			return
+		}
+
+		// Skip the empty slots, as long as there is no value due.
+		t, l := q.next()
+		if t > now {
+			q.moveTo(now + 1)
+			return
+		}
+		if l > 0 {
+			q.moveTo(t)
+			continue
+		}
+
+		es := q.take(0, t&slotMask)
+		for i := range es {
+			q.ready.Push(es[i].v)
+			es[i] = entry{} // Avoid memory leaks
+		}
+		q.waiting -= len(es)
+		q.moveTo(t + 1)
+	}
+}
+
+// next returns the first tick, starting from the current one, at which a non-empty slot
+// is reached, along with the slot level: the values of a level 0 slot are due at the tick,
+// while the values of a higher level slot have to be cascaded.
+// There must be at least one value waiting.
+func (q *TimerWheel) next() (uint64, int) {
+	for l := 0; ; l++ {
+		shift := uint(slotBits * l)
+		s := (q.cur >> shift) & slotMask
+		occupied := q.occupied[l] >> s
+		if l > 0 {
+			// The higher level slots covering the current tick were cascaded already.
+			occupied >>= 1
+			s++
+		}
+		if occupied != 0 {
+			s += uint64(trailingZeros(occupied))
+			return q.cur>>(shift+slotBits)<<(shift+slotBits) | s<<shift, l
+		}
+	}
+}
+
+// trailingZeros returns the number of trailing zero bits of non-zero x.
+func trailingZeros(x uint64) int {
+	n := 0
+	for ; x&1 == 0; x >>= 1 {
+		n++
+	}
+	return n
+}
+
+// moveTo moves the current tick to tick t, cascading the values of the higher level slots
+// covering t if t is in a different range of level 0 slots than the current tick.
+// The slots between the current tick and t must be empty.
+func (q *TimerWheel) moveTo(t uint64) {
+	crossed := t>>slotBits != q.cur>>slotBits
+	q.cur = t
+	if !crossed {
+		return
+	}
+
+	// Cascade the highest levels first, as their values may be moved to the slots
+	// covering t in the lower levels.
+	for l := levelCount - 1; l > 0; l-- {
+		s := (t >> (slotBits * l)) & slotMask
+		if q.occupied[l]&(1<<s) == 0 {
+			continue
+		}
+		es := q.take(l, s)
+		for i := range es {
+			q.place(es[i])
+			es[i] = entry{} // Avoid memory leaks
+		}
+	}
+}
+
+// take empties slot s of level l, returning its entries. The returned slice is reused by
+// the slot, so it must be cleared before any value is placed in the slot again.
+func (q *TimerWheel) take(l int, s uint64) []entry {
+	es := q.slots[l][s]
+	q.slots[l][s] = es[:0]
+	q.occupied[l] &^= 1 << s
+	return es
+}
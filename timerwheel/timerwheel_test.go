@@ -0,0 +1,210 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package timerwheel
+
+import (
+	"math/rand"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/christianrpetrin/queue-tests/queuetest"
+)
+
+// fakeClock is a manually advanced clock.
+type fakeClock struct {
+	// t holds the current time.
+	t time.Time
+}
+
+func (c *fakeClock) now() time.Time { return c.t }
+
+func (c *fakeClock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+// timer is a value pushed by the tests, along with its due time.
+type timer struct {
+	// id identifies the timer.
+	id int
+
+	// due holds the time the timer is due.
+	due time.Time
+}
+
+func TestTimerWheelNewShouldUseDefaultOptions(t *testing.T) {
+	q := New(Options{})
+	if q.opts.Tick != DefaultTick {
+		t.Errorf("Expected: %v; Got: %v", DefaultTick, q.opts.Tick)
+	}
+	if q.opts.Now == nil {
+		t.Error("Expected: time.Now; Got: nil")
+	}
+	if q.Len() != 0 {
+		t.Errorf("Expected: %d; Got: %d", 0, q.Len())
+	}
+	if v, ok := q.Pop(); ok {
+		t.Errorf("Expected: no value as the queue is empty; Got: %v", v)
+	}
+}
+
+func TestTimerWheelPopShouldRetrieveOnlyDueValues(t *testing.T) {
+	c := &fakeClock{t: time.Unix(1000, 0)}
+	q := New(Options{Now: c.now})
+	q.Push("hour", c.t.Add(time.Hour))
+	q.Push("second", c.t.Add(time.Second))
+	q.Push("millisecond", c.t.Add(time.Millisecond))
+	if q.Len() != 3 {
+		t.Errorf("Expected: %d; Got: %d", 3, q.Len())
+	}
+
+	for _, step := range []struct {
+		advance time.Duration
+		want    string
+	}{
+		{time.Millisecond, "millisecond"},
+		{time.Second, "second"},
+		{time.Hour, "hour"},
+	} {
+		if v, ok := q.Pop(); ok {
+			t.Fatalf("Expected: no due value; Got: %v", v)
+		}
+		c.advance(step.advance)
+		if v, ok := q.Pop(); !ok || v != step.want {
+			t.Fatalf("Expected: %s; Got: %v", step.want, v)
+		}
+	}
+	if q.Len() != 0 {
+		t.Errorf("Expected: %d; Got: %d", 0, q.Len())
+	}
+}
+
+func TestTimerWheelPushWithPastDueTimeShouldBeReadyRightAway(t *testing.T) {
+	c := &fakeClock{t: time.Unix(1000, 0)}
+	q := New(Options{Now: c.now})
+	q.Push(1, c.t.Add(-time.Hour))
+	c.advance(time.Second)
+	q.Push(2, c.t.Add(-time.Millisecond))
+
+	for _, want := range []int{1, 2} {
+		if v, ok := q.Pop(); !ok || v != want {
+			t.Errorf("Expected: %d; Got: %v", want, v)
+		}
+	}
+}
+
+func TestTimerWheelPopShouldNotRetrieveValuesEarly(t *testing.T) {
+	c := &fakeClock{t: time.Unix(1000, 0)}
+	q := New(Options{Tick: 10 * time.Millisecond, Now: c.now})
+	q.Push(1, c.t.Add(15*time.Millisecond))
+
+	c.advance(14 * time.Millisecond)
+	if v, ok := q.Pop(); ok {
+		t.Errorf("Expected: no due value; Got: %v", v)
+	}
+
+	// The due time is rounded up to the next tick.
+	c.advance(5 * time.Millisecond)
+	if v, ok := q.Pop(); ok {
+		t.Errorf("Expected: no due value; Got: %v", v)
+	}
+	c.advance(time.Millisecond)
+	if v, ok := q.Pop(); !ok || v != 1 {
+		t.Errorf("Expected: 1; Got: %v", v)
+	}
+}
+
+func TestTimerWheelWithFarDueTimeShouldSkipIdleTicks(t *testing.T) {
+	c := &fakeClock{t: time.Unix(1000, 0)}
+	q := New(Options{Tick: time.Nanosecond, Now: c.now})
+	q.Push(1, c.t.Add(100*365*24*time.Hour))
+
+	c.advance(100*365*24*time.Hour - time.Nanosecond)
+	if v, ok := q.Pop(); ok {
+		t.Errorf("Expected: no due value; Got: %v", v)
+	}
+	c.advance(time.Nanosecond)
+	if v, ok := q.Pop(); !ok || v != 1 {
+		t.Errorf("Expected: 1; Got: %v", v)
+	}
+}
+
+func TestTimerWheelWithRandomTimersShouldRetrieveEachOnceWhenDue(t *testing.T) {
+	c := &fakeClock{t: time.Unix(1000, 0)}
+	tick := time.Millisecond
+	q := New(Options{Tick: tick, Now: c.now})
+	r := rand.New(rand.NewSource(1))
+	spans := []time.Duration{time.Millisecond, 100 * time.Millisecond, 10 * time.Second, time.Hour, 100 * time.Hour}
+
+	pending := make(map[int]time.Time)
+	id := 0
+	for i := 0; i < 2000; i++ {
+		for n := r.Intn(20); n > 0; n-- {
+			due := c.t.Add(time.Duration(r.Int63n(int64(spans[r.Intn(len(spans))]))))
+			q.Push(timer{id: id, due: due}, due)
+			pending[id] = due
+			id++
+		}
+		c.advance(time.Duration(r.Int63n(int64(spans[r.Intn(3)]))))
+
+		for {
+			v, ok := q.Pop()
+			if !ok {
+				break
+			}
+			tm := v.(timer)
+			if _, ok := pending[tm.id]; !ok {
+				t.Fatalf("Expected: timer %d to be pending; Got: retrieved again", tm.id)
+			}
+			if tm.due.After(c.t) {
+				t.Fatalf("Expected: timer due by %v; Got: due at %v", c.t, tm.due)
+			}
+			delete(pending, tm.id)
+		}
+		for id, due := range pending {
+			if !due.Add(tick).After(c.t) {
+				t.Fatalf("Expected: timer %d due at %v to be retrieved by %v; Got: pending", id, due, c.t)
+			}
+		}
+		if q.Len() != len(pending) {
+			t.Fatalf("Expected: %d; Got: %d", len(pending), q.Len())
+		}
+	}
+}
+
+func TestTimerWheelPopShouldReleasePoppedValues(t *testing.T) {
+	c := &fakeClock{t: time.Unix(1000, 0)}
+	q := New(Options{Now: c.now})
+	var f queuetest.Finalizers
+	for i := 0; i < queuetest.LeakTestCount; i++ {
+		v := f.NewValue(0)
+		q.Push(v, c.t.Add(time.Duration(i)*time.Second))
+	}
+	c.advance(queuetest.LeakTestCount * time.Second)
+	for i := 0; i < queuetest.LeakTestCount; i++ {
+		if _, ok := q.Pop(); !ok {
+			t.Fatalf("Expected: value %d; Got: no due value", i)
+		}
+	}
+
+	if r := f.Wait(queuetest.LeakTestCount); r != queuetest.LeakTestCount {
+		t.Errorf("Expected: %d released values; Got: %d", queuetest.LeakTestCount, r)
+	}
+	runtime.KeepAlive(q)
+}
@@ -0,0 +1,133 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package weightedqueue
+
+import (
+	"reflect"
+)
+
+// Sizer returns the weight of value v, e.g. its size in bytes.
+// Sizer must return a non-negative weight, and must return the same weight for the same
+// value for as long as the value is in the queue.
+type Sizer func(v interface{}) int64
+
+// Size returns the approximate number of bytes of memory referenced by value v, using
+// reflection: the size of v itself plus the size of everything reachable from it via
+// pointers, slices, strings, maps and interfaces. Memory reachable multiple times, e.g.
+// a pointer shared by two fields, is only counted once.
+// Size doesn't account for the memory allocator size classes and the map internals, nor
+// for the memory referenced by channels, functions and unsafe pointers, so it is a lower
+// bound of the actual memory usage; use a custom Sizer if a more accurate, or cheaper,
+// estimate is available (e.g. len of a []byte payload).
+// The complexity is O(n), where n is the number of values reachable from v.
+func Size(v interface{}) int64 {
+	if v == nil {
+		return 0
+	}
+	s := sizer{seen: make(map[uintptr]struct{})}
+	rv := reflect.ValueOf(v)
+	return int64(rv.Type().Size()) + s.indirect(rv)
+}
+
+// sizer computes the sizes of all values reachable from a value.
+type sizer struct {
+	// seen holds the addresses of the memory already counted.
+	seen map[uintptr]struct{}
+}
+
+// visit returns whether the memory at address p was not counted yet, marking it as counted.
+func (s *sizer) visit(p uintptr) bool {
+	if _, ok := s.seen[p]; ok {
+		return false
+	}
+	s.seen[p] = struct{}{}
+	return true
+}
+
+// indirect returns the number of bytes reachable from value v, not counting v itself.
+func (s *sizer) indirect(v reflect.Value) int64 {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() || !s.visit(v.Pointer()) {
+			return 0
+		}
+		e := v.Elem()
+		return int64(e.Type().Size()) + s.indirect(e)
+	case reflect.Interface:
+		if v.IsNil() {
+			return 0
+		}
+		e := v.Elem()
+		return int64(e.Type().Size()) + s.indirect(e)
+	case reflect.String:
+		return int64(v.Len())
+	case reflect.Slice:
+		if v.IsNil() || !s.visit(v.Pointer()) {
+			return 0
+		}
+		n := int64(v.Cap()) * int64(v.Type().Elem().Size())
+		if hasPointers(v.Type().Elem()) {
+			for i := 0; i < v.Len(); i++ {
+				n += s.indirect(v.Index(i))
+			}
+		}
+		return n
+	case reflect.Array:
+		var n int64
+		if hasPointers(v.Type().Elem()) {
+			for i := 0; i < v.Len(); i++ {
+				n += s.indirect(v.Index(i))
+			}
+		}
+		return n
+	case reflect.Struct:
+		var n int64
+		for i := 0; i < v.NumField(); i++ {
+			n += s.indirect(v.Field(i))
+		}
+		return n
+	case reflect.Map:
+		if v.IsNil() || !s.visit(v.Pointer()) {
+			return 0
+		}
+		n := int64(v.Len()) * int64(v.Type().Key().Size()+v.Type().Elem().Size())
+		for it := v.MapRange(); it.Next(); {
+			n += s.indirect(it.Key()) + s.indirect(it.Value())
+		}
+		return n
+	default:
+		return 0
+	}
+}
+
+// hasPointers returns whether values of type t may reference other memory.
+func hasPointers(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64, reflect.Complex64, reflect.Complex128:
+		return false
+	case reflect.Array:
+		return hasPointers(t.Elem())
+	default:
+		return true
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package weightedqueue
+
+import (
+	"testing"
+	"unsafe"
+)
+
+// sizerTestValue is a value with unexported fields of all the reference kinds.
+type sizerTestValue struct {
+	b    []byte
+	s    string
+	p    *[64]byte
+	m    map[int]int64
+	i    interface{}
+	next *sizerTestValue
+}
+
+func TestSizeShouldCountReferencedMemory(t *testing.T) {
+	ptr, word := int64(unsafe.Sizeof(uintptr(0))), int64(unsafe.Sizeof(0))
+	tests := []struct {
+		name string
+		v    interface{}
+		want int64
+	}{
+		{"nil", nil, 0},
+		{"int", 1, word},
+		{"string", "hello", 2*word + 5},
+		{"bytes", make([]byte, 10, 100), 3*word + 100},
+		{"pointer", new([64]byte), ptr + 64},
+		{"nil pointer", (*int)(nil), ptr},
+		{"pointers", []*[64]byte{new([64]byte), nil}, 3*word + 2*ptr + 64},
+		{"interfaces", []interface{}{1, "a"}, 3*word + 2*2*ptr + word + 2*word + 1},
+		{"array", [2]string{"ab", "c"}, 4*word + 3},
+		{"map", map[int]int64{1: 1, 2: 2}, ptr + 2*(word+8)},
+	}
+	for _, test := range tests {
+		if got := Size(test.v); got != test.want {
+			t.Errorf("%s: Expected: %d; Got: %d", test.name, test.want, got)
+		}
+	}
+}
+
+func TestSizeShouldCountUnexportedFields(t *testing.T) {
+	v := &sizerTestValue{
+		b: make([]byte, 1000),
+		s: "hello",
+		p: new([64]byte),
+		m: map[int]int64{1: 1},
+		i: 1,
+	}
+	want := int64(unsafe.Sizeof(v)) + int64(unsafe.Sizeof(*v)) + 1000 + 5 + 64 +
+		int64(unsafe.Sizeof(0)+8) + int64(unsafe.Sizeof(0))
+	if got := Size(v); got != want {
+		t.Errorf("Expected: %d; Got: %d", want, got)
+	}
+}
+
+func TestSizeShouldCountSharedMemoryOnce(t *testing.T) {
+	p := new([64]byte)
+	b := make([]byte, 1000)
+	shared := &sizerTestValue{p: p, b: b}
+	shared.next = &sizerTestValue{p: p, b: b, next: shared}
+
+	value := int64(unsafe.Sizeof(*shared))
+	want := int64(unsafe.Sizeof(shared)) + 2*value + 64 + 1000
+	if got := Size(shared); got != want {
+		t.Errorf("Expected: %d; Got: %d", want, got)
+	}
+}
@@ -0,0 +1,246 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package weightedqueue implements a bounded, thread-safe FIFO queue where the bound applies
+// to the total weight of the values rather than to their number.
+// Internally, queue wraps a queueimpl3 queue, storing each value along with its weight
+// (e.g. the size in bytes of a message), and guards every operation with a mutex.
+// A policy determines what happens when a pushed value doesn't fit: reject it, drop the
+// oldest values until it fits, or block the producer until consumers make room for it.
+// Pushed values are weighted by a sizer, so the queue can be bounded by the memory its
+// values use rather than by their number, which doesn't protect memory when payload sizes
+// vary by orders of magnitude; Size estimates the memory used by any value using reflection.
+package weightedqueue
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/christianrpetrin/queue-tests/queueimpl3"
+)
+
+// Policy determines what happens when a value is pushed and the queue doesn't have enough
+// remaining capacity to hold its weight.
+type Policy int
+
+const (
+	// Reject rejects the pushed value.
+	Reject Policy = iota
+
+	// DropOldest drops the oldest values until the pushed value fits.
+	DropOldest
+
+	// Block blocks the producer until enough values are popped for the pushed value to fit.
+	Block
+)
+
+// WeightedQueue represents a bounded, thread-safe FIFO queue whose bound applies to the total
+// weight of its values.
+type WeightedQueue struct {
+	// alen holds a copy of the queue length, updated after every operation
+	// and read without holding the lock by LenApprox.
+	// Kept as the first field to guarantee its 64-bit alignment.
+	alen int64
+
+	// mu guards all other fields.
+	mu sync.Mutex
+
+	// cond is signaled when values are popped, so blocked producers can check whether
+	// their value fits.
+	cond *sync.Cond
+
+	// q holds the queue entries.
+	q queueimpl3.Queueimpl3
+
+	// weight holds the total weight of the queue values.
+	weight int64
+
+	// capacity holds the maximum total weight of the queue values.
+	capacity int64
+
+	// policy holds what happens when a pushed value doesn't fit.
+	policy Policy
+
+	// waiting holds the number of producers blocked waiting for their value to fit.
+	waiting int
+
+	// dropped holds the number of values dropped by the DropOldest policy.
+	dropped uint64
+
+	// sizer returns the weight of the values added by Push.
+	sizer Sizer
+}
+
+// entry represents a queue value along with its weight.
+type entry struct {
+	// v holds the user added value.
+	v interface{}
+
+	// w holds the value weight.
+	w int64
+}
+
+// New returns an initialized queue holding values of up to capacity total weight,
+// with policy determining what happens when a pushed value doesn't fit.
+// Push adds values of weight 1, so the capacity bounds the number of values.
+func New(capacity int64, policy Policy) *WeightedQueue {
+	return NewWithSizer(capacity, policy, unitSize)
+}
+
+// NewWithSizer returns an initialized queue holding values of up to capacity total weight,
+// with policy determining what happens when a pushed value doesn't fit.
+// Push weights the values using sizer s; if s is nil, Size is used, so the capacity bounds
+// the approximate number of bytes referenced by the queue values.
+func NewWithSizer(capacity int64, policy Policy, s Sizer) *WeightedQueue {
+	if s == nil {
+		s = Size
+	}
+	q := &WeightedQueue{capacity: capacity, policy: policy, sizer: s}
+	q.cond = sync.NewCond(&q.mu)
+	q.q.Init()
+	return q
+}
+
+// Len returns the number of elements of queue q.
+// The complexity is O(1).
+func (q *WeightedQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.q.Len()
+}
+
+// LenApprox returns the number of elements of queue q as of the last completed operation,
+// without acquiring the queue lock, so it doesn't contend with producers and consumers.
+// The returned length may be stale, e.g. not reflect operations in progress; use Len
+// if an exact length is needed.
+// The complexity is O(1).
+func (q *WeightedQueue) LenApprox() int {
+	return int(atomic.LoadInt64(&q.alen))
+}
+
+// Weight returns the total weight of the elements of queue q.
+// The complexity is O(1).
+func (q *WeightedQueue) Weight() int64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.weight
+}
+
+// Capacity returns the maximum total weight of the elements of queue q.
+func (q *WeightedQueue) Capacity() int64 { return q.capacity }
+
+// Dropped returns the number of values dropped by the DropOldest policy so far.
+func (q *WeightedQueue) Dropped() uint64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.dropped
+}
+
+// Front returns the first element of queue q or nil if the queue is empty.
+// The second, bool result indicates whether a valid value was returned;
+//   if the queue is empty, false will be returned.
+// The complexity is O(1).
+func (q *WeightedQueue) Front() (interface{}, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	e, ok := q.q.Front()
+	if !ok {
+		return nil, false
+	}
+	return e.(entry).v, true
+}
+
+// Push adds a value to the queue, weighted by the queue sizer; i.e. of weight 1 if the
+// queue was created using New.
+// See PushWeighted for details.
+func (q *WeightedQueue) Push(v interface{}) bool {
+	return q.PushWeighted(v, q.sizer(v))
+}
+
+// PushWeighted adds a value of weight w to the queue.
+// The bool result indicates whether the value was added;
+//   if the value doesn't fit and the policy is Reject, or if w is larger than the queue
+//   capacity, regardless of the policy, false will be returned.
+// PushWeighted panics if w is negative.
+// The complexity is O(1), not counting the values dropped or the time spent blocked.
+func (q *WeightedQueue) PushWeighted(v interface{}, w int64) bool {
+	if w < 0 {
+		panic("weightedqueue: negative weight")
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if w > q.capacity {
+		return false
+	}
+
+	for q.weight+w > q.capacity {
+		switch q.policy {
+		case Reject:
+			return false
+		case DropOldest:
+			e, _ := q.q.Pop()
+			q.weight -= e.(entry).w
+			q.dropped++
+		case Block:
+			q.waiting++
+			q.cond.Wait()
+			q.waiting--
+		}
+	}
+
+	q.q.Push(entry{v: v, w: w})
+	q.weight += w
+	atomic.StoreInt64(&q.alen, int64(q.q.Len()))
+	return true
+}
+
+// Pop retrieves and removes the next element from the queue.
+// The second, bool result indicates whether a valid value was returned;
+//   if the queue is empty, false will be returned.
+// The complexity is O(1).
+func (q *WeightedQueue) Pop() (interface{}, bool) {
+	v, _, ok := q.PopWeighted()
+	return v, ok
+}
+
+// PopWeighted retrieves and removes the next element from the queue, along with its weight.
+// The third, bool result indicates whether a valid value was returned;
+//   if the queue is empty, false will be returned.
+// The complexity is O(1).
+func (q *WeightedQueue) PopWeighted() (interface{}, int64, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	e, ok := q.q.Pop()
+	if !ok {
+		return nil, 0, false
+	}
+
+	q.weight -= e.(entry).w
+	atomic.StoreInt64(&q.alen, int64(q.q.Len()))
+	if q.waiting > 0 {
+		// Blocked producers may wait for values of different weights, so wake them all up.
+		q.cond.Broadcast()
+	}
+	return e.(entry).v, e.(entry).w, true
+}
+
+// unitSize returns 1 for any value v.
+func unitSize(v interface{}) int64 { return 1 }
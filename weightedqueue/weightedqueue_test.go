@@ -0,0 +1,240 @@
+// Copyright (c) 2018 Christian R. Petrin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package weightedqueue
+
+import (
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWeightedQueueNewQueueShouldReturnInitiazedInstanceOfQueue(t *testing.T) {
+	q := New(10, Reject)
+
+	if q == nil {
+		t.Error("Expected: new instance of queue; Got: nil")
+	}
+	if q.Capacity() != 10 || q.Weight() != 0 || q.Len() != 0 {
+		t.Errorf("Expected: empty queue with capacity 10; Got: capacity %d, weight %d, len %d", q.Capacity(), q.Weight(), q.Len())
+	}
+}
+
+func TestWeightedQueuePushPopFrontShouldRetrieveAllElementsInOrder(t *testing.T) {
+	q := New(1000, Reject)
+	for i := 0; i < 1000; i++ {
+		if !q.Push(i) {
+			t.Fatalf("Expected: %d to be pushed; Got: rejected", i)
+		}
+	}
+
+	for i := 0; i < 1000; i++ {
+		if v, ok := q.Front(); !ok || v.(int) != i {
+			t.Errorf("Expected: %d; Got: %d", i, v)
+		}
+		if v, ok := q.Pop(); !ok || v.(int) != i {
+			t.Errorf("Expected: %d; Got: %d", i, v)
+		}
+	}
+	if v, ok := q.Pop(); ok || v != nil {
+		t.Errorf("Expected: nil as the queue should be empty; Got: %d", v)
+	}
+	if v, ok := q.Front(); ok || v != nil {
+		t.Errorf("Expected: nil as the queue should be empty; Got: %d", v)
+	}
+}
+
+func TestWeightedQueueRejectShouldBoundTotalWeight(t *testing.T) {
+	q := New(10, Reject)
+
+	if !q.PushWeighted("a", 6) || !q.PushWeighted("b", 4) {
+		t.Fatal("Expected: values to be pushed; Got: rejected")
+	}
+	if q.PushWeighted("c", 1) {
+		t.Error("Expected: value to be rejected; Got: pushed")
+	}
+	if !q.PushWeighted("d", 0) {
+		t.Error("Expected: weightless value to be pushed; Got: rejected")
+	}
+	if q.Weight() != 10 || q.Len() != 3 {
+		t.Errorf("Expected: weight 10 and len 3; Got: %d and %d", q.Weight(), q.Len())
+	}
+
+	if v, w, ok := q.PopWeighted(); !ok || v.(string) != "a" || w != 6 {
+		t.Errorf("Expected: a of weight 6; Got: %v of weight %d", v, w)
+	}
+	if !q.PushWeighted("e", 6) {
+		t.Error("Expected: value to be pushed; Got: rejected")
+	}
+}
+
+func TestWeightedQueueDropOldestShouldDropValuesUntilPushedValueFits(t *testing.T) {
+	q := New(10, DropOldest)
+	for i := 0; i < 5; i++ {
+		q.PushWeighted(i, 2)
+	}
+
+	if !q.PushWeighted(5, 5) {
+		t.Fatal("Expected: value to be pushed; Got: rejected")
+	}
+	if q.Dropped() != 3 || q.Weight() != 9 {
+		t.Errorf("Expected: 3 dropped and weight 9; Got: %d and %d", q.Dropped(), q.Weight())
+	}
+	for _, expected := range []int{3, 4, 5} {
+		if v, ok := q.Pop(); !ok || v.(int) != expected {
+			t.Errorf("Expected: %d; Got: %v", expected, v)
+		}
+	}
+}
+
+func TestWeightedQueueWithTooHeavyValueShouldRejectIt(t *testing.T) {
+	for _, p := range []Policy{Reject, DropOldest, Block} {
+		q := New(10, p)
+		q.Push(1)
+		if q.PushWeighted(2, 11) {
+			t.Errorf("Expected: value to be rejected with policy %d; Got: pushed", p)
+		}
+		if q.Len() != 1 {
+			t.Errorf("Expected: %d; Got: %d", 1, q.Len())
+		}
+	}
+}
+
+func TestWeightedQueuePushWithNegativeWeightShouldPanic(t *testing.T) {
+	q := New(10, Reject)
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected: panic; Got: no panic")
+		}
+	}()
+	q.PushWeighted(1, -1)
+}
+
+func TestWeightedQueueBlockShouldWaitUntilPushedValueFits(t *testing.T) {
+	q := New(10, Block)
+	q.PushWeighted(1, 8)
+
+	pushed := make(chan struct{})
+	go func() {
+		q.PushWeighted(2, 5)
+		close(pushed)
+	}()
+
+	select {
+	case <-pushed:
+		t.Fatal("Expected: producer to be blocked; Got: value pushed")
+	case <-time.After(10 * time.Millisecond):
+	}
+	q.Pop()
+	<-pushed
+	if v, ok := q.Pop(); !ok || v.(int) != 2 {
+		t.Errorf("Expected: 2; Got: %v", v)
+	}
+}
+
+func TestWeightedQueueBlockConcurrentPushPopShouldRetrieveAllElements(t *testing.T) {
+	const count = 1000
+	q := New(100, Block)
+	var wg sync.WaitGroup
+	for p := 0; p < 4; p++ {
+		wg.Add(1)
+		go func(p int) {
+			defer wg.Done()
+			for i := 0; i < count; i++ {
+				q.PushWeighted(p*count+i, int64(i%10))
+			}
+		}(p)
+	}
+
+	seen := make([]bool, 4*count)
+	for popped := 0; popped < 4*count; {
+		v, ok := q.Pop()
+		if !ok {
+			runtime.Gosched()
+			continue
+		}
+		if q.Weight() > q.Capacity() {
+			t.Fatalf("Expected: weight up to %d; Got: %d", q.Capacity(), q.Weight())
+		}
+		seen[v.(int)] = true
+		popped++
+	}
+	wg.Wait()
+
+	for i, s := range seen {
+		if !s {
+			t.Errorf("Expected: %d to be popped; Got: not popped", i)
+		}
+	}
+}
+
+func TestWeightedQueueLenApproxShouldReturnLengthAfterCompletedOperations(t *testing.T) {
+	q := New(100, Reject)
+	for i := 0; i < 10; i++ {
+		q.Push(i)
+	}
+	q.Pop()
+
+	if l := q.LenApprox(); l != 9 {
+		t.Errorf("Expected: %d; Got: %d", 9, l)
+	}
+}
+
+func TestWeightedQueueWithSizerShouldBoundTotalSize(t *testing.T) {
+	q := NewWithSizer(100, Reject, func(v interface{}) int64 { return int64(len(v.([]byte))) })
+	if !q.Push(make([]byte, 60)) {
+		t.Fatal("Expected: value of size 60 to be added; Got: rejected")
+	}
+	if q.Push(make([]byte, 50)) {
+		t.Error("Expected: value of size 50 to be rejected; Got: added")
+	}
+	if !q.Push(make([]byte, 40)) {
+		t.Error("Expected: value of size 40 to be added; Got: rejected")
+	}
+	if q.Weight() != 100 {
+		t.Errorf("Expected: %d; Got: %d", 100, q.Weight())
+	}
+
+	if v, w, ok := q.PopWeighted(); !ok || len(v.([]byte)) != 60 || w != 60 {
+		t.Errorf("Expected: value of size 60; Got: %v of weight %d", v, w)
+	}
+}
+
+func TestWeightedQueueWithNilSizerShouldBoundApproximateMemory(t *testing.T) {
+	small, large := make([]byte, 10), make([]byte, 10000)
+	q := NewWithSizer(Size(large)+Size(small), DropOldest, nil)
+	for i := 0; i < 5; i++ {
+		if !q.Push(small) {
+			t.Fatalf("Expected: small value %d to be added; Got: rejected", i)
+		}
+	}
+	if !q.Push(large) {
+		t.Fatal("Expected: large value to be added; Got: rejected")
+	}
+
+	// The large value only fits along with a single small value, so the oldest ones are shed.
+	if q.Len() != 2 || q.Dropped() != 4 {
+		t.Errorf("Expected: 2 values and 4 dropped; Got: %d values and %d dropped", q.Len(), q.Dropped())
+	}
+	if q.Weight() != q.Capacity() {
+		t.Errorf("Expected: %d; Got: %d", q.Capacity(), q.Weight())
+	}
+}